@@ -9,13 +9,17 @@ app = App()
 account = os.environ.get('CDK_DEFAULT_ACCOUNT')
 region = os.environ.get('CDK_DEFAULT_REGION', 'ap-south-1')
 environment_name = os.environ.get('ENVIRONMENT', 'dev')
+resource_prefix = os.environ.get('RESOURCE_PREFIX', '')
+enable_grpc_service = os.environ.get('ENABLE_GRPC_SERVICE', 'false').lower() == 'true'
 
 # Create the stack
 NotificationServiceStack(
     app, 
     f"NotificationService-{environment_name}",
     env=Environment(account=account, region=region),
-    environment_name=environment_name
+    environment_name=environment_name,
+    resource_prefix=resource_prefix,
+    enable_grpc_service=enable_grpc_service
 )
 
 app.synth() 
\ No newline at end of file
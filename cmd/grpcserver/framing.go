@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gRPC status codes used by the server
+const (
+	codeOK              = 0
+	codeInvalidArgument = 3
+	codeResourceLimit   = 8
+	codeUnimplemented   = 12
+	codeInternal        = 13
+	codeUnavailable     = 14
+	codeUnauthenticated = 16
+)
+
+// messageHeaderSize is the length-prefixed message header: a compressed flag and a 4-byte big-endian length
+const messageHeaderSize = 5
+
+// maxMessageSize is the largest request message accepted, the default of the gRPC libraries
+const maxMessageSize = 4 << 20
+
+// status is the outcome of a failed call, sent in the grpc-status and grpc-message trailers
+type status struct {
+	code    int
+	message string
+}
+
+func newStatus(code int, message string) *status {
+	return &status{code: code, message: message}
+}
+
+func isGRPCContentType(contentType string) bool {
+	return contentType == "application/grpc" || strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// readMessage reads the single length-prefixed message of a unary call
+func readMessage(body io.Reader) ([]byte, *status) {
+	var header [messageHeaderSize]byte
+	if _, err := io.ReadFull(body, header[:]); err != nil {
+		return nil, newStatus(codeInvalidArgument, "missing request message")
+	}
+	// No grpc-accept-encoding is advertised, so clients only send uncompressed messages
+	if header[0] != 0 {
+		return nil, newStatus(codeUnimplemented, "compressed messages are not supported")
+	}
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxMessageSize {
+		return nil, newStatus(codeResourceLimit, fmt.Sprintf("request message larger than %d bytes", maxMessageSize))
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(body, message); err != nil {
+		return nil, newStatus(codeInvalidArgument, "truncated request message")
+	}
+	return message, nil
+}
+
+// writeResponse sends the response message followed by an OK status
+func writeResponse(w http.ResponseWriter, message []byte) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	var header [messageHeaderSize]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(message)))
+	w.Write(header[:])
+	w.Write(message)
+
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(codeOK))
+}
+
+// writeStatus sends a failed call as a trailers-only response, the status travels in the headers
+func writeStatus(w http.ResponseWriter, s *status) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Status", strconv.Itoa(s.code))
+	w.Header().Set("Grpc-Message", encodeGRPCMessage(s.message))
+	w.WriteHeader(http.StatusOK)
+}
+
+// encodeGRPCMessage percent-encodes the status message as the gRPC protocol requires for grpc-message
+func encodeGRPCMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c >= ' ' && c <= '~' && c != '%' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
@@ -0,0 +1,290 @@
+// Command grpcserver serves the gRPC API of proto/notification_service.proto for internal high-volume
+// producers. It runs as a container inside the VPC and speaks HTTP/2, over TLS when GRPC_TLS_CERT_FILE and
+// GRPC_TLS_KEY_FILE name a certificate and plaintext otherwise; requests are validated like the HTTP API's
+// and queued on the notification queue for the processor. Every call carries a producer token signed with
+// GRPC_PRODUCER_SECRET, the producer it names is recorded on the queued requests.
+//
+// It reads the same environment variables as the Lambdas (REGION, NOTIFICATION_QUEUE_URL, DEDUP_TABLE) plus
+// GRPC_PRODUCER_SECRET, GRPC_PORT (default 50051) and GRPC_MAX_BATCH_SIZE (default 500).
+//
+//	go run ./cmd/grpcserver
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Full method names from proto/notification_service.proto
+const (
+	methodSendNotification = "/notification.v1.NotificationService/SendNotification"
+	methodSendBatch        = "/notification.v1.NotificationService/SendBatch"
+)
+
+// AuthorizationMetadata is the request metadata carrying the caller's producer token, "Bearer <token>"
+const AuthorizationMetadata = "authorization"
+
+// shutdownTimeout is how long in-flight calls get to finish after SIGTERM
+const shutdownTimeout = 10 * time.Second
+
+var maxBatchSize = 500
+
+// producerSecret signs the producer tokens callers authenticate with, see shared.SignProducerToken
+var producerSecret string
+
+func main() {
+	shared.InitAWS()
+	if shared.NotificationQueueURL == "" {
+		fmt.Fprintln(os.Stderr, "NOTIFICATION_QUEUE_URL is required")
+		os.Exit(1)
+	}
+	maxBatchSize = shared.GetEnvInt("GRPC_MAX_BATCH_SIZE", maxBatchSize)
+	producerSecret = os.Getenv("GRPC_PRODUCER_SECRET")
+	if _, err := shared.SignProducerToken(producerSecret, "grpcserver", time.Time{}); err != nil {
+		fmt.Fprintln(os.Stderr, "GRPC_PRODUCER_SECRET is required:", err)
+		os.Exit(1)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(methodSendNotification, unaryHandler(sendNotification))
+	mux.HandleFunc(methodSendBatch, unaryHandler(sendBatch))
+
+	// gRPC clients negotiate HTTP/2 over TLS, or connect with HTTP/2 prior knowledge inside the VPC
+	certFile, keyFile := os.Getenv("GRPC_TLS_CERT_FILE"), os.Getenv("GRPC_TLS_KEY_FILE")
+	var protocols http.Protocols
+	if certFile != "" {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	server := &http.Server{
+		Addr:      ":" + os.Getenv("GRPC_PORT"),
+		Handler:   mux,
+		Protocols: &protocols,
+	}
+	if server.Addr == ":" {
+		server.Addr = ":50051"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			shared.LogError(shutdownCtx).Err(err).Msg("gRPC server shutdown failed")
+		}
+	}()
+
+	shared.LogInfo(ctx).Str("addr", server.Addr).Int("maxBatchSize", maxBatchSize).Bool("tls", certFile != "").Msg("gRPC server started")
+	var err error
+	if certFile != "" {
+		err = server.ListenAndServeTLS(certFile, keyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		shared.LogError(ctx).Err(err).Msg("gRPC server failed")
+		os.Exit(1)
+	}
+}
+
+// unaryMethod handles the message of a unary call, returning the response message or the call's status
+type unaryMethod func(ctx context.Context, producerID string, message []byte) ([]byte, *status)
+
+// unaryHandler serves a unary gRPC method: it authenticates the caller, reads the single request message,
+// runs the method with the request-scoped logger and answers with the response message or the error status
+func unaryHandler(method unaryMethod) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := shared.WithLogger(r.Context(), "grpc")
+
+		if r.Method != http.MethodPost || !isGRPCContentType(r.Header.Get("Content-Type")) {
+			http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		producerID, err := authenticateProducer(r.Header.Get(AuthorizationMetadata))
+		if err != nil {
+			shared.LogWarn(ctx).Err(err).Str("method", r.URL.Path).Msg("Unauthenticated gRPC call rejected")
+			writeStatus(w, newStatus(codeUnauthenticated, "a valid producer token is required"))
+			return
+		}
+
+		message, readStatus := readMessage(io.LimitReader(r.Body, maxMessageSize+messageHeaderSize+1))
+		if readStatus != nil {
+			writeStatus(w, readStatus)
+			return
+		}
+
+		var response []byte
+		var callStatus *status
+		if err := shared.CatchPanic(ctx, func() error {
+			response, callStatus = method(ctx, producerID, message)
+			return nil
+		}); err != nil {
+			callStatus = newStatus(codeInternal, "internal error")
+		}
+		if callStatus != nil {
+			writeStatus(w, callStatus)
+			return
+		}
+		writeResponse(w, response)
+	}
+}
+
+// authenticateProducer returns the producer named by the bearer token of the authorization metadata. The
+// token is signed with the server's secret, so a caller cannot send as another producer
+func authenticateProducer(authorization string) (string, error) {
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok {
+		return "", shared.ErrInvalidProducerToken
+	}
+	return shared.VerifyProducerToken(producerSecret, strings.TrimSpace(token), shared.GetCurrentTime())
+}
+
+func sendNotification(ctx context.Context, producerID string, message []byte) ([]byte, *status) {
+	request, err := shared.UnmarshalProtobufRequest(message)
+	if err != nil {
+		return nil, newStatus(codeInvalidArgument, "invalid NotificationRequest: "+err.Error())
+	}
+	request = prepareRequest(request, producerID)
+	if err := request.Validate(); err != nil {
+		return nil, newStatus(codeInvalidArgument, err.Error())
+	}
+
+	duplicateOf, err := claimDedupKey(ctx, request)
+	if err != nil {
+		return nil, newStatus(codeUnavailable, "failed to check dedup key")
+	}
+	if duplicateOf != "" {
+		shared.LogInfo(ctx).Str("notificationRequestId", request.ID).Str("duplicateOf", duplicateOf).Msg("Duplicate request suppressed")
+		return shared.MarshalSendNotificationResponse(request.ID, duplicateOf), nil
+	}
+
+	if err := services.EnqueueNotificationRequests(ctx, []shared.NotificationRequest{request}); err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationRequestId", request.ID).Msg("Failed to queue notification request")
+		releaseDedupKeys(ctx, []shared.NotificationRequest{request})
+		return nil, newStatus(codeUnavailable, "failed to queue request")
+	}
+
+	shared.LogInfo(ctx).Str("notificationRequestId", request.ID).Str("producerId", producerID).Msg("Notification request queued")
+	return shared.MarshalSendNotificationResponse(request.ID, ""), nil
+}
+
+// sendBatch queues the valid requests of a batch together and reports the invalid ones and the duplicates,
+// so one bad request does not hold back the rest. When no request could be queued the whole call fails and
+// callers should retry it with the same request IDs. When only some were, the others are reported failed so
+// callers retry just those, the queued ones keep their dedup keys
+func sendBatch(ctx context.Context, producerID string, message []byte) ([]byte, *status) {
+	requests, err := shared.UnmarshalSendBatchRequest(message)
+	if err != nil {
+		return nil, newStatus(codeInvalidArgument, "invalid SendBatchRequest: "+err.Error())
+	}
+	if len(requests) == 0 {
+		return nil, newStatus(codeInvalidArgument, "requests is required")
+	}
+	if len(requests) > maxBatchSize {
+		return nil, newStatus(codeInvalidArgument, fmt.Sprintf("a batch holds at most %d requests", maxBatchSize))
+	}
+
+	results := make([]shared.SendResult, 0, len(requests))
+	valid := make([]shared.NotificationRequest, 0, len(requests))
+	validResults := make([]int, 0, len(requests)) // Index in results of each valid request
+	for _, request := range requests {
+		request = prepareRequest(request, producerID)
+		if err := request.Validate(); err != nil {
+			results = append(results, shared.SendResult{ID: request.ID, Error: err.Error()})
+			continue
+		}
+		duplicateOf, err := claimDedupKey(ctx, request)
+		if err != nil {
+			releaseDedupKeys(ctx, valid)
+			return nil, newStatus(codeUnavailable, "failed to check dedup key")
+		}
+		if duplicateOf != "" {
+			results = append(results, shared.SendResult{ID: request.ID, DuplicateOf: duplicateOf})
+			continue
+		}
+		results = append(results, shared.SendResult{ID: request.ID, Queued: true})
+		valid = append(valid, request)
+		validResults = append(validResults, len(results)-1)
+	}
+
+	queued := len(valid)
+	if err := services.EnqueueNotificationRequests(ctx, valid); err != nil {
+		var sendErr *services.SqsSendError
+		if !errors.As(err, &sendErr) || len(sendErr.Unsent) == len(valid) {
+			shared.LogError(ctx).Err(err).Int("requests", len(valid)).Msg("Failed to queue notification batch")
+			releaseDedupKeys(ctx, valid)
+			return nil, newStatus(codeUnavailable, "failed to queue requests")
+		}
+
+		// The queued requests keep their dedup keys, only the ones reported failed give theirs up
+		unsent := make([]shared.NotificationRequest, 0, len(sendErr.Unsent))
+		for _, i := range sendErr.Unsent {
+			unsent = append(unsent, valid[i])
+			results[validResults[i]] = shared.SendResult{ID: valid[i].ID, Error: "failed to queue request, retry it"}
+		}
+		shared.LogError(ctx).Err(err).Int("requests", len(valid)).Int("unsent", len(unsent)).Msg("Failed to queue part of a notification batch")
+		releaseDedupKeys(ctx, unsent)
+		queued -= len(unsent)
+	}
+
+	shared.LogInfo(ctx).Int("queued", queued).Int("rejected", len(requests)-queued).Str("producerId", producerID).Msg("Notification batch queued")
+	return shared.MarshalSendBatchResponse(results), nil
+}
+
+// claimDedupKey claims the request's dedup key before it is queued and returns the request it duplicates,
+// empty when it has no dedup key or holds it. The processor claims the key again for the same request
+func claimDedupKey(ctx context.Context, request shared.NotificationRequest) (string, error) {
+	if request.DedupKey == "" {
+		return "", nil
+	}
+	holder, err := db.ClaimRequestDedupKey(ctx, request.DedupKey, request.ID, request.DedupWindow())
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationRequestId", request.ID).Msg("Failed to claim dedup key")
+		return "", err
+	}
+	if holder == request.ID {
+		return "", nil
+	}
+	return holder, nil
+}
+
+// releaseDedupKeys gives up the dedup keys claimed for requests that could not be queued, so producers
+// retrying them under new IDs are not told they are duplicates
+func releaseDedupKeys(ctx context.Context, requests []shared.NotificationRequest) {
+	for _, request := range requests {
+		if request.DedupKey == "" {
+			continue
+		}
+		if err := db.ReleaseRequestDedupKey(ctx, request.DedupKey, request.ID); err != nil {
+			shared.LogError(ctx).Err(err).Str("notificationRequestId", request.ID).Msg("Failed to release dedup key")
+		}
+	}
+}
+
+// prepareRequest gives a request without an ID a generated one and records the authenticated calling service
+// as its producer, replacing any producer the request declares. The processor adds the server's task role,
+// the principal the queue saw, as for any service account
+func prepareRequest(request shared.NotificationRequest, producerID string) shared.NotificationRequest {
+	if request.ID == "" {
+		request.ID = uuid.New().String()
+	}
+	request.Producer = &shared.Producer{Kind: shared.ProducerServiceAccount, ID: producerID}
+	return request
+}
@@ -0,0 +1,292 @@
+// Command loadgen enqueues synthetic notification requests against a deployed environment and
+// reports end-to-end latency and throughput read back from the history table.
+//
+// It reads the same environment variables as the Lambdas (REGION, NOTIFICATION_QUEUE_URL,
+// HISTORY_TABLE); the flags override them.
+//
+//	go run ./cmd/loadgen -recipients user-1,user-2 -count 500 -types report,alert -var-size 512
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/rand"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pollInterval is the wait between two reads of the pending history records
+const pollInterval = 2 * time.Second
+
+type options struct {
+	region               string
+	queueURL             string
+	historyTable         string
+	recipients           []string
+	recipientsPerRequest int
+	types                []string
+	count                int
+	rate                 int
+	varSize              int
+	concurrency          int
+	timeout              time.Duration
+}
+
+// sample is the outcome of one request read back from its history record
+type sample struct {
+	latency      time.Duration
+	processedAt  time.Time
+	successCount int
+	failureCount int
+}
+
+func main() {
+	opts := parseFlags()
+
+	if opts.region != "" {
+		os.Setenv("REGION", opts.region)
+	}
+	shared.InitAWS()
+	if opts.queueURL != "" {
+		shared.NotificationQueueURL = opts.queueURL
+	}
+	if opts.historyTable != "" {
+		shared.HistoryTable = opts.historyTable
+	}
+	if shared.NotificationQueueURL == "" || shared.HistoryTable == "" {
+		fail("queue URL and history table are required, set -queue-url and -history-table or their env variables")
+	}
+
+	ctx := context.Background()
+	runID := fmt.Sprintf("loadgen-%d", time.Now().Unix())
+
+	enqueuedAt, sendDuration := enqueue(ctx, opts, runID)
+	fmt.Printf("Enqueued %d requests in %s (%.1f req/s)\n", len(enqueuedAt), sendDuration.Round(time.Millisecond),
+		float64(len(enqueuedAt))/sendDuration.Seconds())
+
+	samples := collect(ctx, opts, enqueuedAt)
+	report(enqueuedAt, samples)
+}
+
+func parseFlags() options {
+	var opts options
+	var recipients, types string
+
+	flag.StringVar(&opts.region, "region", "", "AWS region (default $REGION)")
+	flag.StringVar(&opts.queueURL, "queue-url", "", "notification queue URL (default $NOTIFICATION_QUEUE_URL)")
+	flag.StringVar(&opts.historyTable, "history-table", "", "history table name (default $HISTORY_TABLE)")
+	flag.StringVar(&recipients, "recipients", "", "comma separated user IDs to pick recipients from (required)")
+	flag.IntVar(&opts.recipientsPerRequest, "recipients-per-request", 1, "recipients per request")
+	flag.StringVar(&types, "types", shared.NotificationTypeReport, "comma separated notification types to pick from")
+	flag.IntVar(&opts.count, "count", 100, "number of requests to enqueue")
+	flag.IntVar(&opts.rate, "rate", 0, "requests per second, 0 sends as fast as possible")
+	flag.IntVar(&opts.varSize, "var-size", 64, "size in bytes of the synthetic payload variable")
+	flag.IntVar(&opts.concurrency, "concurrency", 10, "concurrent history reads")
+	flag.DurationVar(&opts.timeout, "timeout", 5*time.Minute, "how long to wait for the requests to be processed")
+	flag.Parse()
+
+	opts.recipients = splitList(recipients)
+	opts.types = splitList(types)
+	if len(opts.recipients) == 0 {
+		fail("-recipients is required")
+	}
+	for _, notificationType := range opts.types {
+		if !shared.ValidateNotificationType(notificationType) {
+			fail("invalid notification type " + notificationType)
+		}
+	}
+	if opts.count <= 0 || opts.recipientsPerRequest <= 0 || opts.concurrency <= 0 {
+		fail("-count, -recipients-per-request and -concurrency must be positive")
+	}
+	return opts
+}
+
+// enqueue sends the requests in SQS batches, paced by the rate when one is set. It returns the
+// enqueue time of every request ID and the total send duration
+func enqueue(ctx context.Context, opts options, runID string) (map[string]time.Time, time.Duration) {
+	batchSize := 10
+	var interval time.Duration
+	if opts.rate > 0 {
+		batchSize = min(batchSize, opts.rate)
+		interval = time.Second * time.Duration(batchSize) / time.Duration(opts.rate)
+	}
+
+	payload := strings.Repeat("x", opts.varSize)
+	enqueuedAt := make(map[string]time.Time, opts.count)
+	start := time.Now()
+
+	for sent := 0; sent < opts.count; sent += batchSize {
+		batchStart := time.Now()
+		end := min(sent+batchSize, opts.count)
+
+		ids := make([]string, 0, end-sent)
+		bodies := make([]string, 0, end-sent)
+		for i := sent; i < end; i++ {
+			request := shared.NotificationRequest{
+				ID:         fmt.Sprintf("%s-%d", runID, i),
+				Type:       opts.types[rand.Intn(len(opts.types))],
+				Recipients: pickRecipients(opts.recipients, opts.recipientsPerRequest),
+				Variables: map[string]any{
+					"title":   "Load test " + runID,
+					"message": "Synthetic notification",
+					"payload": payload,
+				},
+			}
+			body, err := json.Marshal(request)
+			if err != nil {
+				fail(err.Error())
+			}
+			ids = append(ids, request.ID)
+			bodies = append(bodies, string(body))
+		}
+
+		if err := services.SqsSendMessages(ctx, shared.NotificationQueueURL, bodies); err != nil {
+			fail(fmt.Sprintf("failed to enqueue requests: %v", err))
+		}
+		now := time.Now()
+		for _, id := range ids {
+			enqueuedAt[id] = now
+		}
+
+		if wait := interval - time.Since(batchStart); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+
+	return enqueuedAt, time.Since(start)
+}
+
+// pickRecipients returns n distinct recipients, or all of them when there are fewer
+func pickRecipients(recipients []string, n int) []string {
+	if n >= len(recipients) {
+		return slices.Clone(recipients)
+	}
+	picked := make([]string, 0, n)
+	for _, i := range rand.Perm(len(recipients))[:n] {
+		picked = append(picked, recipients[i])
+	}
+	return picked
+}
+
+// collect polls the history table until every request has a record or the timeout expires
+func collect(ctx context.Context, opts options, enqueuedAt map[string]time.Time) map[string]sample {
+	samples := make(map[string]sample, len(enqueuedAt))
+	deadline := time.Now().Add(opts.timeout)
+
+	for len(samples) < len(enqueuedAt) && time.Now().Before(deadline) {
+		var pending []string
+		for id := range enqueuedAt {
+			if _, done := samples[id]; !done {
+				pending = append(pending, id)
+			}
+		}
+
+		for id, s := range readHistories(ctx, pending, opts.concurrency) {
+			s.latency = s.processedAt.Sub(enqueuedAt[id])
+			samples[id] = s
+		}
+		fmt.Printf("Processed %d/%d\n", len(samples), len(enqueuedAt))
+
+		if len(samples) < len(enqueuedAt) {
+			time.Sleep(pollInterval)
+		}
+	}
+	return samples
+}
+
+// readHistories reads the history records of the IDs with a bounded number of concurrent reads.
+// IDs without a record yet are left out of the result
+func readHistories(ctx context.Context, ids []string, concurrency int) map[string]sample {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	found := make(map[string]sample)
+	queue := make(chan string)
+
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range queue {
+				history, err := db.GetNotificationHistory(ctx, id)
+				if err != nil || history.ID == "" || history.CreatedAt == nil {
+					continue
+				}
+				mu.Lock()
+				found[id] = sample{
+					processedAt:  *history.CreatedAt,
+					successCount: history.SuccessCount,
+					failureCount: history.FailureCount,
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, id := range ids {
+		queue <- id
+	}
+	close(queue)
+	wg.Wait()
+	return found
+}
+
+func report(enqueuedAt map[string]time.Time, samples map[string]sample) {
+	if len(samples) == 0 {
+		fmt.Println("No requests were processed before the timeout")
+		return
+	}
+
+	latencies := make([]time.Duration, 0, len(samples))
+	var firstEnqueue, lastProcessed time.Time
+	var deliveries, failures int
+	for id, s := range samples {
+		latencies = append(latencies, s.latency)
+		if firstEnqueue.IsZero() || enqueuedAt[id].Before(firstEnqueue) {
+			firstEnqueue = enqueuedAt[id]
+		}
+		if s.processedAt.After(lastProcessed) {
+			lastProcessed = s.processedAt
+		}
+		deliveries += s.successCount
+		failures += s.failureCount
+	}
+	slices.Sort(latencies)
+
+	elapsed := lastProcessed.Sub(firstEnqueue)
+	fmt.Printf("\nRequests:   %d/%d processed\n", len(samples), len(enqueuedAt))
+	fmt.Printf("Deliveries: %d succeeded, %d failed\n", deliveries, failures)
+	fmt.Printf("Latency:    p50 %s  p95 %s  p99 %s  max %s\n",
+		percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99), latencies[len(latencies)-1])
+	if elapsed > 0 {
+		fmt.Printf("Throughput: %.1f req/s end to end\n", float64(len(samples))/elapsed.Seconds())
+	}
+}
+
+// percentile returns the p-th percentile of sorted latencies, rounded to the millisecond
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p+99)/100 - 1
+	return sorted[max(index, 0)].Round(time.Millisecond)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func fail(message string) {
+	fmt.Fprintln(os.Stderr, "loadgen: "+message)
+	os.Exit(1)
+}
@@ -0,0 +1,540 @@
+// Command notifyctl operates a deployed notification service from a terminal or a CI pipeline. It sends
+// notifications, manages schedules, templates and system configs, and simulates which channels and
+// content a notification would reach a user with, all through the notificationclient SDK.
+//
+// The environment is read from NOTIFYCTL_API_URL, NOTIFYCTL_GRPC_ENDPOINT, NOTIFYCTL_TOKEN (a Cognito
+// ID token) and NOTIFYCTL_PRODUCER_TOKEN (the producer token of gRPC calls), or with -env <name> from
+// NOTIFYCTL_<NAME>_API_URL and so on; the flags override them. Results are printed as JSON.
+//
+//	notifyctl -env staging send -type alert -to user-1,user-2 -var title=Disk -var usage=91
+//	notifyctl schedule create -type report -cron "0 9 ? * MON *" -vars report.json
+//	notifyctl template push -context '*' -id alert#email -file alert-email.json
+//	notifyctl simulate -type alert -to user-1 -vars alert.json
+//	GRPC_PRODUCER_SECRET=... notifyctl producer-token -id billing -ttl 8760h
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"notification-service/functions/shared"
+	"notification-service/notificationclient"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage: notifyctl [-env name] [-api-url url] [-grpc-endpoint host:port] [-grpc-tls] [-token token] [-producer-token token] <command> [flags]
+
+commands:
+  send                        queue a notification through the gRPC API
+  schedule create|list|clone|pause|resume|next-runs
+  template push|pull|activate|deactivate
+  config get|set
+  simulate                    show the channels and rendered content a notification would reach a user with
+  producer-token              issue the token a service sends through the gRPC API with, signed with $GRPC_PRODUCER_SECRET
+`
+
+// defaultTimeout bounds a whole command
+const defaultTimeout = 30 * time.Second
+
+// environment is where the commands are run against
+type environment struct {
+	apiURL        string
+	grpcEndpoint  string
+	grpcTLS       bool
+	token         string
+	producerToken string
+	timeout       time.Duration
+}
+
+func main() {
+	var env environment
+	var name string
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.StringVar(&name, "env", "", "environment name, reads NOTIFYCTL_<NAME>_* instead of NOTIFYCTL_*")
+	flag.StringVar(&env.apiURL, "api-url", "", "REST API stage URL (default $NOTIFYCTL_API_URL)")
+	flag.StringVar(&env.grpcEndpoint, "grpc-endpoint", "", "gRPC API host:port, required by send (default $NOTIFYCTL_GRPC_ENDPOINT)")
+	flag.BoolVar(&env.grpcTLS, "grpc-tls", false, "connect to the gRPC API over TLS")
+	flag.StringVar(&env.token, "token", "", "Cognito ID token (default $NOTIFYCTL_TOKEN)")
+	flag.StringVar(&env.producerToken, "producer-token", "", "producer token, required by send (default $NOTIFYCTL_PRODUCER_TOKEN)")
+	flag.DurationVar(&env.timeout, "timeout", defaultTimeout, "timeout of the command")
+	flag.Parse()
+
+	env.apiURL = firstNonEmpty(env.apiURL, envValue(name, "API_URL"))
+	env.grpcEndpoint = firstNonEmpty(env.grpcEndpoint, envValue(name, "GRPC_ENDPOINT"))
+	env.token = firstNonEmpty(env.token, envValue(name, "TOKEN"))
+	env.producerToken = firstNonEmpty(env.producerToken, envValue(name, "PRODUCER_TOKEN"))
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	// Tokens are signed locally, no environment is needed
+	if args[0] == "producer-token" {
+		if err := producerToken(args[1:]); err != nil {
+			fail(err.Error())
+		}
+		return
+	}
+	if env.apiURL == "" {
+		fail("the API URL is required, set -api-url or NOTIFYCTL_API_URL")
+	}
+	opts := []notificationclient.Option{
+		notificationclient.WithTokenSource(notificationclient.StaticToken(env.token)),
+		notificationclient.WithGRPCEndpoint(env.grpcEndpoint),
+		notificationclient.WithProducerToken(env.producerToken),
+	}
+	if env.grpcTLS {
+		opts = append(opts, notificationclient.WithGRPCTLS(nil))
+	}
+	client := notificationclient.New(env.apiURL, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), env.timeout)
+	defer cancel()
+
+	var err error
+	switch args[0] {
+	case "send":
+		err = send(ctx, client, args[1:])
+	case "schedule":
+		err = schedule(ctx, client, args[1:])
+	case "template":
+		err = template(ctx, client, args[1:])
+	case "config":
+		err = config(ctx, client, args[1:])
+	case "simulate":
+		err = simulate(ctx, client, args[1:])
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail(err.Error())
+	}
+}
+
+func send(ctx context.Context, client *notificationclient.Client, args []string) error {
+	flags := flag.NewFlagSet("send", flag.ExitOnError)
+	var request notificationclient.NotificationRequest
+	var recipients, channels string
+	variables := variablesFlag{}
+	flags.StringVar(&request.ID, "id", "", "request ID, generated when empty")
+	flags.StringVar(&request.Type, "type", "", "notification type (required)")
+	flags.StringVar(&recipients, "to", "", "comma separated recipient user or team IDs")
+	flags.StringVar(&request.Segment, "segment", "", "segment ID to send to instead of recipients")
+	flags.StringVar(&channels, "channels", "", "comma separated channels to restrict delivery to")
+	flags.StringVar(&request.Priority, "priority", "", "priority, critical also reaches critical contacts")
+	flags.StringVar(&request.Category, "category", "", "category overriding the type's")
+	flags.StringVar(&request.DedupKey, "dedup-key", "", "key suppressing repeated requests within an hour")
+	flags.StringVar(&request.CorrelationKey, "correlation-key", "", "key threading the emails of related requests")
+	variables.register(flags)
+	flags.Parse(args)
+
+	request.Recipients = splitList(recipients)
+	request.Channels = splitList(channels)
+	request.Variables = variables
+	if request.Type == "" || (len(request.Recipients) == 0 && request.Segment == "") {
+		return fmt.Errorf("send needs -type and -to or -segment")
+	}
+
+	result, err := client.SendNotification(ctx, request)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+// producerToken prints a producer token for a service, signed with the gRPC server's secret
+func producerToken(args []string) error {
+	flags := flag.NewFlagSet("producer-token", flag.ExitOnError)
+	var producerID string
+	var ttl time.Duration
+	flags.StringVar(&producerID, "id", "", "producer ID recorded on the service's notifications (required)")
+	flags.DurationVar(&ttl, "ttl", 0, "how long the token is valid (default no expiry)")
+	flags.Parse(args)
+
+	secret := os.Getenv("GRPC_PRODUCER_SECRET")
+	if producerID == "" || secret == "" {
+		return fmt.Errorf("producer-token needs -id and GRPC_PRODUCER_SECRET, the gRPC server's secret")
+	}
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	token, err := shared.SignProducerToken(secret, producerID, expiresAt)
+	if err != nil {
+		return err
+	}
+	var expires *time.Time
+	if !expiresAt.IsZero() {
+		expires = &expiresAt
+	}
+	return printJSON(map[string]any{"producerId": producerID, "token": token, "expiresAt": expires})
+}
+
+func schedule(ctx context.Context, client *notificationclient.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: notifyctl schedule create|list|clone|pause|resume|next-runs [flags]")
+	}
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("schedule create", flag.ExitOnError)
+		var request notificationclient.CreateScheduleRequest
+		var endDate, tags, recipients string
+		variables := variablesFlag{}
+		flags.StringVar(&request.Type, "type", "", "notification type (required)")
+		flags.StringVar(&request.Schedule.Expression, "cron", "", "EventBridge cron expression (required)")
+		flags.StringVar(&recipients, "to", "", "comma separated recipient user IDs or team:/oncall: references, super admins only (default yourself)")
+		flags.StringVar(&request.Segment, "segment", "", "segment ID whose users are notified, super admins only")
+		flags.StringVar(&endDate, "end", "", "RFC 3339 time after which the schedule stops firing")
+		flags.StringVar(&request.Schedule.Timezone, "timezone", "", "IANA timezone the cron expression is evaluated in (default the user's preferred one)")
+		flags.IntVar(&request.Schedule.MaxOccurrences, "max-occurrences", 0, "occurrences after which the schedule is cancelled (default unlimited)")
+		flags.BoolVar(&request.DryRun, "dry-run", false, "render and record each occurrence without delivering it")
+		flags.StringVar(&tags, "tags", "", "comma separated tags, e.g. team:payments,env:prod")
+		variables.register(flags)
+		flags.Parse(args[1:])
+
+		if request.Type == "" || request.Schedule.Expression == "" {
+			return fmt.Errorf("schedule create needs -type and -cron")
+		}
+		request.Schedule.Type = shared.ScheduleTypeCron
+		request.Variables = variables
+		request.Recipients = splitList(recipients)
+		if tags != "" {
+			request.Tags = strings.Split(tags, ",")
+		}
+		if endDate != "" {
+			end, err := time.Parse(time.RFC3339, endDate)
+			if err != nil {
+				return fmt.Errorf("invalid -end: %w", err)
+			}
+			request.Schedule.EndDate = &end
+		}
+
+		created, err := client.CreateSchedule(ctx, request)
+		if err != nil {
+			return err
+		}
+		return printJSON(created)
+
+	case "list":
+		flags := flag.NewFlagSet("schedule list", flag.ExitOnError)
+		tags := flags.String("tag", "", "only schedules carrying every one of these comma separated tags")
+		flags.Parse(args[1:])
+
+		var tagFilter []string
+		if *tags != "" {
+			tagFilter = strings.Split(*tags, ",")
+		}
+		schedules := make([]notificationclient.ScheduledNotification, 0)
+		var nextToken string
+		for {
+			page, next, err := client.ListSchedules(ctx, nextToken, tagFilter...)
+			if err != nil {
+				return err
+			}
+			schedules = append(schedules, page...)
+			if next == "" {
+				return printJSON(schedules)
+			}
+			nextToken = next
+		}
+
+	case "clone":
+		flags := flag.NewFlagSet("schedule clone", flag.ExitOnError)
+		scheduleID := flags.String("id", "", "schedule ID to copy (required)")
+		variables := variablesFlag{}
+		variables.register(flags)
+		flags.Parse(args[1:])
+		if *scheduleID == "" {
+			return fmt.Errorf("schedule clone needs -id")
+		}
+
+		var request notificationclient.CloneScheduleRequest
+		if len(variables) > 0 {
+			request.Variables = variables
+		}
+		cloned, err := client.CloneSchedule(ctx, *scheduleID, request)
+		if err != nil {
+			return err
+		}
+		return printJSON(cloned)
+
+	case "pause", "resume":
+		flags := flag.NewFlagSet("schedule "+args[0], flag.ExitOnError)
+		scheduleID := flags.String("id", "", "schedule ID (required)")
+		flags.Parse(args[1:])
+		if *scheduleID == "" {
+			return fmt.Errorf("schedule %s needs -id", args[0])
+		}
+
+		status := shared.StatusPaused
+		if args[0] == "resume" {
+			status = shared.StatusActive
+		}
+		updated, err := client.UpdateSchedule(ctx, *scheduleID, notificationclient.UpdateScheduleRequest{Status: status})
+		if err != nil {
+			return err
+		}
+		return printJSON(updated)
+
+	case "next-runs":
+		flags := flag.NewFlagSet("schedule next-runs", flag.ExitOnError)
+		scheduleID := flags.String("id", "", "schedule ID")
+		expression := flags.String("cron", "", "cron or rate expression to try out instead of a schedule")
+		timezone := flags.String("timezone", "", "-cron: IANA timezone (default the user's preferred one)")
+		count := flags.Int("count", 0, "number of runs (default 5)")
+		flags.Parse(args[1:])
+		if (*scheduleID == "") == (*expression == "") {
+			return fmt.Errorf("schedule next-runs needs -id or -cron")
+		}
+
+		var runs notificationclient.ScheduleNextRuns
+		var err error
+		if *scheduleID != "" {
+			runs, err = client.GetScheduleNextRuns(ctx, *scheduleID, *count)
+		} else {
+			runs, err = client.PreviewScheduleRuns(ctx, *expression, *timezone, *count)
+		}
+		if err != nil {
+			return err
+		}
+		return printJSON(runs)
+
+	default:
+		return fmt.Errorf("unknown schedule command %q", args[0])
+	}
+}
+
+func template(ctx context.Context, client *notificationclient.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: notifyctl template push|pull|activate|deactivate [flags]")
+	}
+	if args[0] == "activate" || args[0] == "deactivate" {
+		return setTemplatesActive(ctx, client, args)
+	}
+	flags := flag.NewFlagSet("template "+args[0], flag.ExitOnError)
+	templateContext := flags.String("context", "", "template context, * for global (default the calling user)")
+	templateID := flags.String("id", "", "template ID, type#channel or type#channel#language (required)")
+	file := flags.String("file", "", "file holding the template content, pull writes to stdout without it")
+	format := flags.String("format", "", "push: template format, text or markdown")
+	flags.Parse(args[1:])
+	if *templateID == "" {
+		return fmt.Errorf("template %s needs -id", args[0])
+	}
+
+	switch args[0] {
+	case "push":
+		if *file == "" {
+			return fmt.Errorf("template push needs -file")
+		}
+		content, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		request := notificationclient.SaveTemplateRequest{Context: *templateContext, Content: string(content), Format: *format}
+
+		// Pushing creates the template the first time and replaces its content afterwards
+		saved, err := client.UpdateTemplate(ctx, *templateID, request)
+		if isStatus(err, http.StatusNotFound) {
+			request.Type, request.Channel, request.Language = shared.ParseTemplateKey(*templateID)
+			saved, err = client.CreateTemplate(ctx, request)
+		}
+		if err != nil {
+			return err
+		}
+		return printJSON(saved)
+
+	case "pull":
+		pulled, err := client.GetTemplate(ctx, *templateContext, *templateID)
+		if err != nil {
+			return err
+		}
+		if *file == "" {
+			_, err := fmt.Println(pulled.Content)
+			return err
+		}
+		return os.WriteFile(*file, []byte(pulled.Content), 0o644)
+
+	default:
+		return fmt.Errorf("unknown template command %q", args[0])
+	}
+}
+
+// setTemplatesActive activates or deactivates the templates carrying every tag of -tag
+func setTemplatesActive(ctx context.Context, client *notificationclient.Client, args []string) error {
+	flags := flag.NewFlagSet("template "+args[0], flag.ExitOnError)
+	templateContext := flags.String("context", "", "template context, * for global (default the calling user)")
+	tags := flags.String("tag", "", "comma separated tags the templates all carry (required)")
+	dryRun := flags.Bool("dry-run", false, "only list the templates that would change")
+	flags.Parse(args[1:])
+	if *tags == "" {
+		return fmt.Errorf("template %s needs -tag", args[0])
+	}
+
+	result, err := client.SetTemplatesActive(ctx, *templateContext, strings.Split(*tags, ","), args[0] == "activate", *dryRun)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+func config(ctx context.Context, client *notificationclient.Client, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: notifyctl config get|set [flags]")
+	}
+	flags := flag.NewFlagSet("config "+args[0], flag.ExitOnError)
+	configContext := flags.String("context", "", "config context, * for global (default the calling user)")
+	reveal := flags.Bool("reveal", false, "get: show secrets unmasked, super admins only")
+	file := flags.String("file", "", "set: JSON file of the settings to change (required)")
+	description := flags.String("description", "", "set: config description")
+	flags.Parse(args[1:])
+
+	switch args[0] {
+	case "get":
+		systemConfig, err := client.GetConfig(ctx, *configContext, *reveal)
+		if err != nil {
+			return err
+		}
+		return printJSON(systemConfig)
+
+	case "set":
+		if *file == "" {
+			return fmt.Errorf("config set needs -file")
+		}
+		data, err := os.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		var settings notificationclient.SystemSettings
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("invalid settings in %s: %w", *file, err)
+		}
+		updated, err := client.UpdateConfig(ctx, notificationclient.SystemConfig{
+			Context:     *configContext,
+			Config:      &settings,
+			Description: *description,
+		})
+		if err != nil {
+			return err
+		}
+		return printJSON(updated)
+
+	default:
+		return fmt.Errorf("unknown config command %q", args[0])
+	}
+}
+
+// simulate renders the templates of each channel the type would be delivered on to the user, through the
+// service's engine as the processor does. Nothing is queued or sent. Routing rules, quiet hours and daily caps
+// are not applied
+func simulate(ctx context.Context, client *notificationclient.Client, args []string) error {
+	flags := flag.NewFlagSet("simulate", flag.ExitOnError)
+	notificationType := flags.String("type", "", "notification type (required)")
+	recipientID := flags.String("to", "", "recipient user ID (required)")
+	language := flags.String("language", "", "language whose template variants are tried first")
+	channels := flags.String("channels", "", "comma-separated channels to simulate, default every channel")
+	variables := variablesFlag{}
+	variables.register(flags)
+	flags.Parse(args)
+	if *notificationType == "" || *recipientID == "" {
+		return fmt.Errorf("simulate needs -type and -to")
+	}
+
+	request := notificationclient.SimulationRequest{
+		Type:        *notificationType,
+		RecipientID: *recipientID,
+		Variables:   variables,
+		Language:    *language,
+	}
+	if *channels != "" {
+		request.Channels = strings.Split(*channels, ",")
+	}
+	result, err := client.Simulate(ctx, request)
+	if err != nil {
+		return err
+	}
+	return printJSON(result)
+}
+
+// variablesFlag collects notification variables from -var name=value flags and -vars JSON files. Values
+// that parse as JSON keep their type, e.g. numbers and booleans, the others are strings
+type variablesFlag map[string]any
+
+func (v variablesFlag) register(flags *flag.FlagSet) {
+	flags.Var(v, "var", "variable name=value, repeatable")
+	flags.Func("vars", "JSON file of variables", func(file string) error {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, (*map[string]any)(&v))
+	})
+}
+
+func (v variablesFlag) String() string {
+	return ""
+}
+
+func (v variablesFlag) Set(value string) error {
+	name, raw, ok := strings.Cut(value, "=")
+	if !ok || name == "" {
+		return fmt.Errorf("variables are name=value, got %q", value)
+	}
+	var parsed any
+	if err := json.Unmarshal([]byte(raw), &parsed); err != nil {
+		parsed = raw
+	}
+	v[name] = parsed
+	return nil
+}
+
+// isStatus reports whether err is an API error response with the status code
+func isStatus(err error, statusCode int) bool {
+	var apiErr *notificationclient.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == statusCode
+}
+
+// envValue reads NOTIFYCTL_<KEY>, or NOTIFYCTL_<ENV>_<KEY> when an environment is named
+func envValue(env, key string) string {
+	if env == "" {
+		return os.Getenv("NOTIFYCTL_" + key)
+	}
+	name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(env))
+	return os.Getenv("NOTIFYCTL_" + name + "_" + key)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func printJSON(value any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func fail(message string) {
+	fmt.Fprintln(os.Stderr, "notifyctl: "+message)
+	os.Exit(1)
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColAckNotificationID = "notificationId"
+	ColAckUserID         = "userId"
+	ColAckDate           = "ackDate"
+	ColAcknowledgedAt    = "acknowledgedAt"
+)
+
+// CreateAcknowledgment stores the acknowledgment. It returns false if the user already acknowledged the notification
+func CreateAcknowledgment(ctx context.Context, ack shared.Acknowledgment) (bool, error) {
+	if ack.AcknowledgedAt != nil {
+		// Set TTL, acknowledgments are kept forever unless the audit retention policy says otherwise
+		ack.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionAudit, *ack.AcknowledgedAt)
+	}
+
+	condition := expression.Name(ColAckNotificationID).AttributeNotExists()
+	err := services.DbPutItemWithCondition(ctx, shared.AcknowledgmentsTable, ack, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func GetAcknowledgment(ctx context.Context, notificationID, userID string) (shared.Acknowledgment, error) {
+	var ack shared.Acknowledgment
+	err := services.DbGetItem(ctx, shared.AcknowledgmentsTable, shared.Acknowledgment{
+		NotificationID: notificationID,
+		UserID:         userID,
+	}, &ack)
+	if err != nil {
+		return shared.Acknowledgment{}, err
+	}
+	return ack, nil
+}
+
+// GetAcknowledgmentsByDate returns a page of acknowledgments made on the given day (YYYY-MM-DD)
+func GetAcknowledgmentsByDate(ctx context.Context, date string, limit int, startKey map[string]types.AttributeValue) ([]shared.Acknowledgment, map[string]types.AttributeValue, error) {
+	keyCondition := expression.Key(ColAckDate).Equal(expression.Value(date))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var items []shared.Acknowledgment
+	lastEvaluatedKey, err := services.DbQuery(ctx, shared.AcknowledgmentsTable, "AckDateIndex", limit, startKey, expr, &items, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, lastEvaluatedKey, nil
+}
+
+// GetAllAcknowledgmentsByDate pages through every acknowledgment made on the given day
+func GetAllAcknowledgmentsByDate(ctx context.Context, date string) ([]shared.Acknowledgment, error) {
+	var all []shared.Acknowledgment
+	var startKey map[string]types.AttributeValue
+	for {
+		items, lastEvaluatedKey, err := GetAcknowledgmentsByDate(ctx, date, 1000, startKey)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if lastEvaluatedKey == nil {
+			return all, nil
+		}
+		startKey = lastEvaluatedKey
+	}
+}
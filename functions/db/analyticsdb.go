@@ -0,0 +1,38 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColAnalyticsMetricKey = "metricKey"
+	ColAnalyticsDate      = "date"
+)
+
+func PutAnalyticsRollup(ctx context.Context, rollup shared.AnalyticsRollup) error {
+	now := shared.GetCurrentTime()
+	rollup.CreatedAt = &now
+
+	return services.DbPutItem(ctx, shared.AnalyticsTable, rollup)
+}
+
+// GetAnalyticsRollups returns the rollups of a metric key between two dates (inclusive, YYYY-MM-DD)
+func GetAnalyticsRollups(ctx context.Context, metricKey, fromDate, toDate string) ([]shared.AnalyticsRollup, error) {
+	keyCondition := expression.Key(ColAnalyticsMetricKey).Equal(expression.Value(metricKey)).
+		And(expression.Key(ColAnalyticsDate).Between(expression.Value(fromDate), expression.Value(toDate)))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []shared.AnalyticsRollup
+	_, err = services.DbQuery(ctx, shared.AnalyticsTable, "", 0, nil, expr, &items, nil)
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColDedupKey       = "dedupKey"
+	ColDedupExpiresAt = "expiresAt"
+	ColDedupCount     = "count"
+	ColDedupRequestID = "requestId"
+)
+
+// BuildContentDedupKey creates the dedup key for identical content sent to a recipient on a channel
+func BuildContentDedupKey(recipientID, channel, contentHash string) string {
+	return "content#" + recipientID + "#" + channel + "#" + contentHash
+}
+
+// ClaimDedupKey records the key for the given window. It returns false when the key was
+// already claimed within the window. Expired rows are reclaimed because TTL deletion is lazy.
+func ClaimDedupKey(ctx context.Context, dedupKey string, window time.Duration) (bool, error) {
+	now := shared.GetCurrentTime()
+	record := shared.DedupRecord{
+		DedupKey:  dedupKey,
+		CreatedAt: &now,
+		ExpiresAt: int(now.Add(window).Unix()),
+	}
+
+	condition := expression.Name(ColDedupKey).AttributeNotExists().
+		Or(expression.Name(ColDedupExpiresAt).LessThan(expression.Value(int(now.Unix()))))
+
+	err := services.DbPutItemWithCondition(ctx, shared.DedupTable, record, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ReleaseDedupKey removes a claimed key, so content that failed to deliver is not suppressed when it is retried
+func ReleaseDedupKey(ctx context.Context, dedupKey string) error {
+	return services.DbDeleteItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: dedupKey})
+}
+
+// BuildRequestDedupKey creates the dedup key a producer's request dedup key is claimed under
+func BuildRequestDedupKey(dedupKey string) string {
+	return "request#" + dedupKey
+}
+
+// ClaimRequestDedupKey claims a producer's dedup key for the request over the window and returns the ID of
+// the request holding it: requestID when the claim succeeded, another request's when that one claimed the key
+// within its window. A request may claim a key it already holds, so a retried request is not its own duplicate
+func ClaimRequestDedupKey(ctx context.Context, dedupKey, requestID string, window time.Duration) (string, error) {
+	now := shared.GetCurrentTime()
+	key := BuildRequestDedupKey(dedupKey)
+	record := shared.DedupRecord{
+		DedupKey:  key,
+		RequestID: requestID,
+		CreatedAt: &now,
+		ExpiresAt: int(now.Add(window).Unix()),
+	}
+
+	condition := expression.Name(ColDedupKey).AttributeNotExists().
+		Or(expression.Name(ColDedupExpiresAt).LessThan(expression.Value(int(now.Unix())))).
+		Or(expression.Name(ColDedupRequestID).Equal(expression.Value(requestID)))
+
+	err := services.DbPutItemWithCondition(ctx, shared.DedupTable, record, condition)
+	if err == nil {
+		return requestID, nil
+	}
+	if !services.IsConditionalCheckFailed(err) {
+		return "", err
+	}
+
+	var holder shared.DedupRecord
+	if err := services.DbGetItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: key}, &holder); err != nil {
+		return "", err
+	}
+	if holder.RequestID == "" {
+		return "", fmt.Errorf("dedup key %s was released while it was claimed", dedupKey)
+	}
+	return holder.RequestID, nil
+}
+
+// ReleaseRequestDedupKey gives up the request's claim on a producer's dedup key, so the request can be sent
+// again when it was not delivered. A key held by another request is left alone
+func ReleaseRequestDedupKey(ctx context.Context, dedupKey, requestID string) error {
+	// Expiring the claim instead of deleting it keeps the release conditional on the holder, TTL removes it
+	expired := int(shared.GetCurrentTime().Unix()) - 1
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.DedupTable,
+		Update:    expression.Set(expression.Name(ColDedupExpiresAt), expression.Value(expired)),
+		Query:     shared.DedupRecord{DedupKey: BuildRequestDedupKey(dedupKey)},
+		Condition: expression.Name(ColDedupRequestID).Equal(expression.Value(requestID)),
+	})
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// BuildDailyCapKey creates the key counting a recipient's notifications on a channel for a day
+func BuildDailyCapKey(recipientID, channel, day string) string {
+	return "cap#" + recipientID + "#" + channel + "#" + day
+}
+
+// BuildWarmUpKey builds the counter key of the emails sent from a warming up domain on a UTC day
+func BuildWarmUpKey(domain, day string) string {
+	return "warmup#" + domain + "#" + day
+}
+
+// IncrementDailyCount adds one to the counter and returns the new count. The counter expires
+// two days after it is created, well after the day it counts has ended in every timezone
+func IncrementDailyCount(ctx context.Context, key string) (int, error) {
+	expiresAt := int(shared.GetCurrentTime().AddDate(0, 0, 2).Unix())
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.DedupTable,
+		Update: expression.Add(expression.Name(ColDedupCount), expression.Value(1)).
+			Set(expression.Name(ColDedupExpiresAt), expression.IfNotExists(expression.Name(ColDedupExpiresAt), expression.Value(expiresAt))),
+		Query: shared.DedupRecord{DedupKey: key},
+		Condition: expression.Name(ColDedupKey).AttributeNotExists().
+			Or(expression.Name(ColDedupKey).Equal(expression.Value(key))),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	var record shared.DedupRecord
+	if err := attributevalue.UnmarshalMap(out.Attributes, &record); err != nil {
+		return 0, err
+	}
+	return record.Count, nil
+}
+
+// GetDailyCount returns the counter's value, 0 when nothing was counted
+func GetDailyCount(ctx context.Context, key string) (int, error) {
+	var record shared.DedupRecord
+	err := services.DbGetItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: key}, &record)
+	if err != nil {
+		return 0, err
+	}
+	return record.Count, nil
+}
+
+// BuildLinkPreviewKey builds the cache key of a link's preview
+func BuildLinkPreviewKey(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return "preview#" + hex.EncodeToString(sum[:])
+}
+
+// GetCachedLinkPreview returns the cached preview of a link. found is false when the link was not fetched
+// within the cache window; a found nil preview means the link has none
+func GetCachedLinkPreview(ctx context.Context, link string) (preview *shared.LinkPreview, found bool, err error) {
+	var record shared.DedupRecord
+	err = services.DbGetItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: BuildLinkPreviewKey(link)}, &record)
+	if err != nil {
+		return nil, false, err
+	}
+	// TTL deletion is lazy, expired rows are treated as missing
+	if record.DedupKey == "" || record.ExpiresAt < int(shared.GetCurrentTime().Unix()) {
+		return nil, false, nil
+	}
+	return record.Preview, true, nil
+}
+
+// CacheLinkPreview stores a link's preview, or the fact that it has none, for the given window
+func CacheLinkPreview(ctx context.Context, link string, preview *shared.LinkPreview, window time.Duration) error {
+	now := shared.GetCurrentTime()
+	return services.DbPutItem(ctx, shared.DedupTable, shared.DedupRecord{
+		DedupKey:  BuildLinkPreviewKey(link),
+		CreatedAt: &now,
+		ExpiresAt: int(now.Add(window).Unix()),
+		Preview:   preview,
+	})
+}
+
+// BuildEmailThreadKey builds the key of a recipient's email thread for a correlation key
+func BuildEmailThreadKey(recipientID, correlationKey string) string {
+	return "thread#" + recipientID + "#" + correlationKey
+}
+
+// GetEmailThread returns the Message-ID of the thread's original email, empty when no email started the
+// thread within its window
+func GetEmailThread(ctx context.Context, threadKey string) (string, error) {
+	var record shared.DedupRecord
+	err := services.DbGetItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: threadKey}, &record)
+	if err != nil {
+		return "", err
+	}
+	// TTL deletion is lazy, expired rows are treated as missing
+	if record.DedupKey == "" || record.ExpiresAt < int(shared.GetCurrentTime().Unix()) {
+		return "", nil
+	}
+	return record.MessageID, nil
+}
+
+// StartEmailThread records the email as the thread's original for the window. It returns false when another
+// email started the thread first
+func StartEmailThread(ctx context.Context, threadKey, messageID string, window time.Duration) (bool, error) {
+	now := shared.GetCurrentTime()
+	record := shared.DedupRecord{
+		DedupKey:  threadKey,
+		MessageID: messageID,
+		CreatedAt: &now,
+		ExpiresAt: int(now.Add(window).Unix()),
+	}
+
+	condition := expression.Name(ColDedupKey).AttributeNotExists().
+		Or(expression.Name(ColDedupExpiresAt).LessThan(expression.Value(int(now.Unix()))))
+
+	err := services.DbPutItemWithCondition(ctx, shared.DedupTable, record, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
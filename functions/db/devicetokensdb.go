@@ -0,0 +1,78 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColDeviceUserID   = "userId"
+	ColDeviceDeviceID = "deviceId"
+)
+
+// PutDeviceToken registers a device, registering the same token again refreshes its entry
+func PutDeviceToken(ctx context.Context, device shared.DeviceToken) (shared.DeviceToken, error) {
+	now := shared.GetCurrentTime()
+	existing, err := GetDeviceToken(ctx, device.UserID, device.DeviceID)
+	if err != nil {
+		return shared.DeviceToken{}, err
+	}
+	device.CreatedAt = &now
+	if existing.CreatedAt != nil {
+		device.CreatedAt = existing.CreatedAt
+	}
+	device.UpdatedAt = &now
+
+	if err := services.DbPutItem(ctx, shared.DeviceTokensTable, device); err != nil {
+		return shared.DeviceToken{}, err
+	}
+	return device, nil
+}
+
+func GetDeviceToken(ctx context.Context, userID, deviceID string) (shared.DeviceToken, error) {
+	var device shared.DeviceToken
+	err := services.DbGetItem(ctx, shared.DeviceTokensTable, shared.DeviceToken{
+		UserID:   userID,
+		DeviceID: deviceID,
+	}, &device)
+	if err != nil {
+		return shared.DeviceToken{}, err
+	}
+	return device, nil
+}
+
+// GetDeviceTokens returns every device the user registered. Users have at most shared.MaxDevicesPerUser
+// devices, so they are read in one go
+func GetDeviceTokens(ctx context.Context, userID string) ([]shared.DeviceToken, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(ColDeviceUserID).Equal(expression.Value(userID))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []shared.DeviceToken
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var devices []shared.DeviceToken
+		lastEvaluatedKey, err = services.DbQuery(ctx, shared.DeviceTokensTable, "", 0, lastEvaluatedKey, expr, &devices, nil)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, devices...)
+		if lastEvaluatedKey == nil {
+			return all, nil
+		}
+	}
+}
+
+func DeleteDeviceToken(ctx context.Context, userID, deviceID string) error {
+	return services.DbDeleteItem(ctx, shared.DeviceTokensTable, shared.DeviceToken{
+		UserID:   userID,
+		DeviceID: deviceID,
+	})
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColDigestUserID  = "userId"
+	ColDigestItemKey = "itemKey"
+)
+
+// DigestRetentionDays is how long a held notification waits for a digest before it expires
+const DigestRetentionDays = 7
+
+func CreateDigestItem(ctx context.Context, item shared.DigestItem) error {
+	now := shared.GetCurrentTime()
+	item.CreatedAt = &now
+	item.ItemKey = now.Format("2006-01-02T15:04:05.000000Z07:00") + "#" + item.RequestID
+	if item.Channel != "" {
+		item.ItemKey += "#" + item.Channel
+	}
+
+	// Set TTL
+	item.ExpiresAt = int(now.AddDate(0, 0, DigestRetentionDays).Unix())
+
+	return services.DbPutItem(ctx, shared.DigestTable, item)
+}
+
+// GetDigestItems returns every notification held for the user, oldest first
+func GetDigestItems(ctx context.Context, userID string) ([]shared.DigestItem, error) {
+	keyCondition := expression.Key(ColDigestUserID).Equal(expression.Value(userID))
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []shared.DigestItem
+	var startKey map[string]types.AttributeValue
+	for {
+		var items []shared.DigestItem
+		lastEvaluatedKey, err := services.DbQuery(ctx, shared.DigestTable, "", 0, startKey, expr, &items, nil)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if lastEvaluatedKey == nil {
+			return all, nil
+		}
+		startKey = lastEvaluatedKey
+	}
+}
+
+func DeleteDigestItem(ctx context.Context, userID, itemKey string) error {
+	return services.DbDeleteItem(ctx, shared.DigestTable, shared.DigestItem{
+		UserID:  userID,
+		ItemKey: itemKey,
+	})
+}
@@ -0,0 +1,57 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColEmailMessageID        = "messageId"
+	ColEmailMessageBounce    = "bounce"
+	ColEmailMessageBouncedAt = "bouncedAt"
+)
+
+// emailMessageTTL is how long an email can still bounce after it was sent. SES reports most bounces within
+// minutes, receiving servers that defer delivery can take a few days
+const emailMessageTTL = 7 * 24 * time.Hour
+
+// CreateEmailMessage records an email sent through SES, so a bounce can be traced back to its delivery
+func CreateEmailMessage(ctx context.Context, message shared.EmailMessage) error {
+	now := shared.GetCurrentTime()
+	message.SentAt = &now
+	message.ExpiresAt = int(now.Add(emailMessageTTL).Unix())
+
+	return services.DbPutItem(ctx, shared.EmailMessagesTable, message)
+}
+
+// GetEmailMessage returns the email sent under the SES message ID, nil when it is unknown or expired
+func GetEmailMessage(ctx context.Context, messageID string) (*shared.EmailMessage, error) {
+	var message shared.EmailMessage
+	err := services.DbGetItem(ctx, shared.EmailMessagesTable, shared.EmailMessage{
+		MessageID: messageID,
+	}, &message)
+	if err != nil {
+		return nil, err
+	}
+	if message.MessageID == "" {
+		return nil, nil
+	}
+	return &message, nil
+}
+
+// RecordEmailBounce marks the email as bounced, "hard", "soft" or "undetermined"
+func RecordEmailBounce(ctx context.Context, messageID, bounce string) error {
+	now := shared.GetCurrentTime()
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.EmailMessagesTable,
+		Update: expression.Set(expression.Name(ColEmailMessageBounce), expression.Value(bounce)).
+			Set(expression.Name(ColEmailMessageBouncedAt), expression.Value(now)),
+		Query:     shared.EmailMessage{MessageID: messageID},
+		Condition: expression.Name(ColEmailMessageID).AttributeExists(),
+	})
+	return err
+}
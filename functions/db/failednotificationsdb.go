@@ -0,0 +1,24 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+)
+
+var (
+	ColFailedMessageID = "messageId"
+	ColFailedAt        = "failedAt"
+)
+
+// CreateFailedNotification records a queue message rejected by validation. Failed notifications are kept
+// as long as quarantined messages
+func CreateFailedNotification(ctx context.Context, failed shared.FailedNotification) error {
+	now := shared.GetCurrentTime()
+	failed.FailedAt = &now
+
+	// Set TTL
+	failed.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionQuarantine, now)
+
+	return services.DbPutItem(ctx, shared.FailedNotificationsTable, failed)
+}
@@ -0,0 +1,145 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColInboxUserID         = "userId"
+	ColInboxNotificationID = "notificationId"
+	ColInboxRead           = "read"
+	ColInboxReadAt         = "readAt"
+	ColInboxCreatedAt      = "createdAt"
+	ColInboxPreviews       = "previews"
+)
+
+// InboxCreatedAtIndex lists a user's inbox by arrival time
+const InboxCreatedAtIndex = "CreatedAtIndex"
+
+// InboxRetentionDays is how long an in-app notification stays in the inbox
+var InboxRetentionDays = shared.GetEnvInt("INBOX_RETENTION_DAYS", 90)
+
+// CreateInboxItem stores an in-app notification. Redelivering a request overwrites its item instead of
+// adding a second one
+func CreateInboxItem(ctx context.Context, item shared.InboxItem) error {
+	now := shared.GetCurrentTime()
+	item.CreatedAt = &now
+
+	// Set TTL
+	item.ExpiresAt = int(now.AddDate(0, 0, InboxRetentionDays).Unix())
+
+	return services.DbPutItem(ctx, shared.InboxTable, item)
+}
+
+func GetInboxItem(ctx context.Context, userID, notificationID string) (shared.InboxItem, error) {
+	var item shared.InboxItem
+	err := services.DbGetItem(ctx, shared.InboxTable, shared.InboxItem{
+		UserID:         userID,
+		NotificationID: notificationID,
+	}, &item)
+	if err != nil {
+		return shared.InboxItem{}, err
+	}
+	return item, nil
+}
+
+// GetInboxItems lists the user's inbox newest first, only the unread items when unreadOnly is set.
+// The page token is the createdAt and notificationId of the last item, joined by '#'
+func GetInboxItems(ctx context.Context, userID string, unreadOnly bool, limit int, startKey string) ([]shared.InboxItem, string, error) {
+	var lastEvaluatedKey map[string]types.AttributeValue
+	var err error
+	if startKey != "" {
+		createdAt, notificationID, _ := strings.Cut(startKey, "#")
+		lastEvaluatedKey, err = attributevalue.MarshalMap(map[string]any{
+			ColInboxUserID:         userID,
+			ColInboxNotificationID: notificationID,
+			ColInboxCreatedAt:      createdAt,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	builder := expression.NewBuilder().WithKeyCondition(expression.Key(ColInboxUserID).Equal(expression.Value(userID)))
+	if unreadOnly {
+		// Unread items are stored without the read attribute
+		builder = builder.WithFilter(expression.Name(ColInboxRead).AttributeNotExists().
+			Or(expression.Name(ColInboxRead).Equal(expression.Value(false))))
+	}
+	expr, err := builder.Build()
+	if err != nil {
+		return nil, "", err
+	}
+
+	newestFirst := false
+	var items []shared.InboxItem
+	lastEvaluatedKey, err = services.DbQuery(ctx, shared.InboxTable, InboxCreatedAtIndex, limit, lastEvaluatedKey, expr, &items, &newestFirst)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var nextToken string
+	if lastEvaluatedKey != nil && lastEvaluatedKey[ColInboxCreatedAt] != nil && lastEvaluatedKey[ColInboxNotificationID] != nil {
+		nextToken = lastEvaluatedKey[ColInboxCreatedAt].(*types.AttributeValueMemberS).Value + "#" +
+			lastEvaluatedKey[ColInboxNotificationID].(*types.AttributeValueMemberS).Value
+	}
+
+	return items, nextToken, nil
+}
+
+// MarkInboxItemRead marks an in-app notification as read. It fails the condition check when the
+// notification is not in the user's inbox
+func MarkInboxItemRead(ctx context.Context, userID, notificationID string) (shared.InboxItem, error) {
+	update := expression.Set(expression.Name(ColInboxRead), expression.Value(true)).
+		Set(expression.Name(ColInboxReadAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.InboxTable,
+		Update:    update,
+		Query: shared.InboxItem{
+			UserID:         userID,
+			NotificationID: notificationID,
+		},
+		Condition: expression.Name(ColInboxNotificationID).Equal(expression.Value(notificationID)),
+	})
+	if err != nil {
+		return shared.InboxItem{}, err
+	}
+
+	var item shared.InboxItem
+	err = attributevalue.UnmarshalMap(out.Attributes, &item)
+	if err != nil {
+		return shared.InboxItem{}, err
+	}
+
+	return item, nil
+}
+
+// SetInboxItemPreviews attaches link previews to an in-app notification. It fails the condition check
+// when the notification was deleted in the meantime
+func SetInboxItemPreviews(ctx context.Context, userID, notificationID string, previews []shared.LinkPreview) error {
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.InboxTable,
+		Update:    expression.Set(expression.Name(ColInboxPreviews), expression.Value(previews)),
+		Query: shared.InboxItem{
+			UserID:         userID,
+			NotificationID: notificationID,
+		},
+		Condition: expression.Name(ColInboxNotificationID).Equal(expression.Value(notificationID)),
+	})
+	return err
+}
+
+func DeleteInboxItem(ctx context.Context, userID, notificationID string) error {
+	return services.DbDeleteItem(ctx, shared.InboxTable, shared.InboxItem{
+		UserID:         userID,
+		NotificationID: notificationID,
+	})
+}
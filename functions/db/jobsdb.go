@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColJobID              = "jobId"
+	ColJobStatus          = "status"
+	ColJobTotalChunks     = "totalChunks"
+	ColJobChunksProcessed = "chunksProcessed"
+	ColJobProcessed       = "processed"
+	ColJobSucceeded       = "succeeded"
+	ColJobFailed          = "failed"
+	ColJobDoneChunks      = "doneChunks"
+	ColJobUpdatedAt       = "updatedAt"
+	ColJobCompletedAt     = "completedAt"
+)
+
+// jobKey is the primary key of a job
+type jobKey struct {
+	JobID string `dynamodbav:"jobId"`
+}
+
+// StartJob records a running job before its chunks are queued. A job that is still running is kept, so a
+// retried split does not reset the progress of the chunks already processed; a completed one is restarted,
+// as when a schedule fires again. It reports whether the job was started
+func StartJob(ctx context.Context, job shared.Job) (bool, error) {
+	now := shared.GetCurrentTime()
+	job.Status = shared.JobStatusRunning
+	if job.TotalChunks == 0 {
+		// Nothing to wait for, e.g. an empty segment
+		job.Status = shared.JobStatusCompleted
+		job.CompletedAt = &now
+	}
+	job.CreatedAt = &now
+	job.UpdatedAt = &now
+	job.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionHistory, now)
+
+	condition := expression.Name(ColJobID).AttributeNotExists().
+		Or(expression.Name(ColJobStatus).Equal(expression.Value(shared.JobStatusCompleted)))
+	err := services.DbPutItemWithCondition(ctx, shared.JobsTable, job, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func GetJob(ctx context.Context, jobID string) (shared.Job, error) {
+	var job shared.Job
+	err := services.DbGetItem(ctx, shared.JobsTable, jobKey{JobID: jobID}, &job)
+	if err != nil {
+		return shared.Job{}, err
+	}
+	return job, nil
+}
+
+// RecordJobChunk adds the outcome of a processed chunk to its job's counts in one update, and completes the
+// job once every chunk is counted. A chunk already counted, such as a redelivered message, is ignored
+func RecordJobChunk(ctx context.Context, ref shared.JobChunkRef, processed, succeeded, failed int) error {
+	now := shared.GetCurrentTime()
+	chunk := &types.AttributeValueMemberNS{Value: []string{strconv.Itoa(ref.Chunk)}}
+
+	update := expression.Add(expression.Name(ColJobChunksProcessed), expression.Value(1)).
+		Add(expression.Name(ColJobProcessed), expression.Value(processed)).
+		Add(expression.Name(ColJobSucceeded), expression.Value(succeeded)).
+		Add(expression.Name(ColJobFailed), expression.Value(failed)).
+		Add(expression.Name(ColJobDoneChunks), expression.Value(chunk)).
+		Set(expression.Name(ColJobUpdatedAt), expression.Value(now))
+	condition := expression.Name(ColJobID).Equal(expression.Value(ref.JobID)).
+		And(expression.Not(expression.Contains(expression.Name(ColJobDoneChunks), ref.Chunk)))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.JobsTable,
+		Update:    update,
+		Query:     jobKey{JobID: ref.JobID},
+		Condition: condition,
+	})
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var job shared.Job
+	if err := attributevalue.UnmarshalMap(out.Attributes, &job); err != nil {
+		return err
+	}
+	if job.ChunksProcessed < job.TotalChunks {
+		return nil
+	}
+
+	_, err = services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.JobsTable,
+		Update: expression.Set(expression.Name(ColJobStatus), expression.Value(shared.JobStatusCompleted)).
+			Set(expression.Name(ColJobCompletedAt), expression.Value(now)),
+		Query: jobKey{JobID: ref.JobID},
+		Condition: expression.Name(ColJobStatus).Equal(expression.Value(shared.JobStatusRunning)).
+			And(expression.Name(ColJobChunksProcessed).GreaterThanEqual(expression.Name(ColJobTotalChunks))),
+	})
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ListedTables returns the tables whose lists are read through their ListIndex GSI
+func ListedTables() []services.ListedTable {
+	return []services.ListedTable{
+		{TableName: shared.SchedulesTable, Key: ColScheduleID, SortKey: ColScheduleCreatedAt},
+		{TableName: shared.PreferencesTable, Key: ColPreferencesContext, SortKey: ColListCreatedAt},
+		{TableName: shared.ConfigTable, Key: ColConfigContext, SortKey: ColConfigCreatedAt},
+		{TableName: shared.TeamsTable, Key: ColTeamID, SortKey: ColListCreatedAt},
+		{TableName: shared.SegmentsTable, Key: ColSegmentID, SortKey: ColListCreatedAt},
+		{TableName: shared.SequencesTable, Key: ColSequenceID, SortKey: ColListCreatedAt},
+		{TableName: shared.RulesTable, Key: ColRuleID, SortKey: ColRuleOrder},
+		{TableName: shared.OnCallTable, Key: ColRotationID, SortKey: ColListCreatedAt},
+		{TableName: shared.QuarantineTable, Key: ColQuarantineMessageID, SortKey: ColQuarantineQuarantinedAt},
+		{TableName: shared.UsersTable, Key: ColUserID, SortKey: ColUserID},
+		{TableName: shared.HistoryTable, Key: ColHistoryID, SortKey: ColHistoryCreatedAt, Dated: true},
+	}
+}
+
+// ColListCreatedAt is the creation time most listed tables are sorted by
+const ColListCreatedAt = "createdAt"
+
+// listedTable returns the listed table with the given name
+func listedTable(tableName string) services.ListedTable {
+	for _, table := range ListedTables() {
+		if table.TableName == tableName {
+			return table
+		}
+	}
+	panic("table is not listed: " + tableName)
+}
+
+// ScanUnlistedKeys returns a page of the keys of a listed table's rows stored without a list key, or with the
+// former single one. The keys of dated tables come with their sort key
+func ScanUnlistedKeys(ctx context.Context, table services.ListedTable, startKey map[string]types.AttributeValue) ([]map[string]any, map[string]types.AttributeValue, error) {
+	filter := expression.Name(services.ListKeyAttribute).AttributeNotExists().
+		Or(expression.Name(services.ListKeyAttribute).Equal(expression.Value(services.ListKeyAll)))
+	projection := expression.NamesList(expression.Name(table.Key))
+	if table.Dated {
+		projection = projection.AddNames(expression.Name(table.SortKey))
+	}
+
+	var keys []map[string]any
+	nextKey, err := services.DbScanItems(ctx, table.TableName, &filter, &projection, startKey, 0, &keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, nextKey, nil
+}
+
+// SetRowListKey adds the row with the given key to its table's list. It fails the condition check when the
+// row was deleted in the meantime
+func SetRowListKey(ctx context.Context, table services.ListedTable, key map[string]any) error {
+	keyValue, _ := key[table.Key].(string)
+	sortKeyValue, _ := key[table.SortKey].(string)
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: table.TableName,
+		Update:    expression.Set(expression.Name(services.ListKeyAttribute), expression.Value(table.ListKey(keyValue, sortKeyValue))),
+		Query:     map[string]any{table.Key: key[table.Key]},
+		Condition: expression.Name(table.Key).AttributeExists(),
+	})
+	return err
+}
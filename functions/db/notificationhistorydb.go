@@ -0,0 +1,88 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColHistoryID        = "id"
+	ColHistoryType      = "type"
+	ColHistoryCreatedAt = "createdAt"
+	ColHistoryExpiresAt = "expiresAt"
+	ColHistoryProducer  = "producer"
+)
+
+func CreateNotificationHistory(ctx context.Context, history shared.NotificationHistory) error {
+	now := shared.GetCurrentTime()
+	history.CreatedAt = &now
+
+	// Set TTL
+	history.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionHistory, now)
+
+	return services.DbPutListedItem(ctx, listedTable(shared.HistoryTable), history)
+}
+
+func GetNotificationHistory(ctx context.Context, id string) (shared.NotificationHistory, error) {
+	var history shared.NotificationHistory
+	err := services.DbGetItem(ctx, shared.HistoryTable, shared.NotificationHistory{
+		ID: id,
+	}, &history)
+	if err != nil {
+		return shared.NotificationHistory{}, err
+	}
+	return history, nil
+}
+
+// GetNotificationHistoryBetween scans every history record created in [from, to)
+func GetNotificationHistoryBetween(ctx context.Context, from, to time.Time) ([]shared.NotificationHistory, error) {
+	filter := expression.Name(ColHistoryCreatedAt).GreaterThanEqual(expression.Value(from)).
+		And(expression.Name(ColHistoryCreatedAt).LessThan(expression.Value(to)))
+
+	var all []shared.NotificationHistory
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.NotificationHistory
+		nextKey, err := services.DbScanItems(ctx, shared.HistoryTable, &filter, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
+}
+
+// GetNotificationHistoryList returns a page of the history records created in [from, to) oldest first, optionally
+// only those of a producer kind and ID. Records are returned without their request and deliveries
+func GetNotificationHistoryList(ctx context.Context, from, to time.Time, producerKind, producerID string, limit int, startKey string) ([]shared.NotificationHistory, string, error) {
+	var filter expression.ConditionBuilder
+	if producerKind != "" {
+		filter = expression.Name(fmt.Sprintf("%s.kind", ColHistoryProducer)).Equal(expression.Value(producerKind))
+	}
+	if producerID != "" {
+		condition := expression.Name(fmt.Sprintf("%s.id", ColHistoryProducer)).Equal(expression.Value(producerID))
+		if filter.IsSet() {
+			condition = filter.And(condition)
+		}
+		filter = condition
+	}
+	projection := expression.NamesList(expression.Name(ColHistoryID), expression.Name(ColHistoryType), expression.Name(ColHistoryProducer),
+		expression.Name("totalRecipients"), expression.Name("successCount"), expression.Name("failureCount"),
+		expression.Name("enqueuedAt"), expression.Name(ColHistoryCreatedAt))
+
+	var items []shared.NotificationHistory
+	nextToken, err := services.DbQueryListBetween(ctx, listedTable(shared.HistoryTable), from, to, limit, startKey, filter, &projection, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColNotificationType = "type"
+)
+
+// notificationTypeKey is the primary key of the notification types table
+type notificationTypeKey struct {
+	Type string `dynamodbav:"type"`
+}
+
+// CreateNotificationType registers a custom notification type. It reports false when the type already exists
+func CreateNotificationType(ctx context.Context, notificationType shared.NotificationType) (bool, error) {
+	now := shared.GetCurrentTime()
+	notificationType.CreatedAt = &now
+	notificationType.UpdatedAt = &now
+
+	err := services.DbPutItemWithCondition(ctx, shared.NotificationTypesTable, notificationType,
+		expression.Name(ColNotificationType).AttributeNotExists())
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func GetNotificationType(ctx context.Context, notificationType string) (shared.NotificationType, error) {
+	var item shared.NotificationType
+	err := services.DbGetItem(ctx, shared.NotificationTypesTable, notificationTypeKey{Type: notificationType}, &item)
+	if err != nil {
+		return shared.NotificationType{}, err
+	}
+	return item, nil
+}
+
+// PutNotificationType replaces a registered notification type, keeping when it was created
+func PutNotificationType(ctx context.Context, notificationType shared.NotificationType) (shared.NotificationType, error) {
+	now := shared.GetCurrentTime()
+	notificationType.UpdatedAt = &now
+
+	err := services.DbPutItemWithCondition(ctx, shared.NotificationTypesTable, notificationType,
+		expression.Name(ColNotificationType).AttributeExists())
+	if err != nil {
+		return shared.NotificationType{}, err
+	}
+	return notificationType, nil
+}
+
+// GetNotificationTypes returns every registered notification type
+func GetNotificationTypes(ctx context.Context) ([]shared.NotificationType, error) {
+	var notificationTypes []shared.NotificationType
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var page []shared.NotificationType
+		var err error
+		lastEvaluatedKey, err = services.DbScanItems(ctx, shared.NotificationTypesTable, nil, nil, lastEvaluatedKey, 0, &page)
+		if err != nil {
+			return nil, err
+		}
+		notificationTypes = append(notificationTypes, page...)
+		if lastEvaluatedKey == nil {
+			return notificationTypes, nil
+		}
+	}
+}
+
+func DeleteNotificationType(ctx context.Context, notificationType string) error {
+	return services.DbDeleteItem(ctx, shared.NotificationTypesTable, notificationTypeKey{Type: notificationType})
+}
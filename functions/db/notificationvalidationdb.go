@@ -19,8 +19,8 @@ func CreateNotificationValidation(ctx context.Context, validation shared.Notific
 	now := shared.GetCurrentTime()
 	validation.CreatedAt = &now
 
-	// Set TTL (1 day from now)
-	validation.ExpiresAt = int(now.AddDate(0, 0, 1).Unix())
+	// Set TTL
+	validation.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionResults, now)
 
 	return services.DbPutItem(ctx, shared.NotificationValidationTable, validation)
 }
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColRotationID         = "rotationId"
+	ColRotationName       = "name"
+	ColRotationMembers    = "members"
+	ColRotationStartAt    = "startAt"
+	ColRotationShiftHours = "shiftHours"
+	ColRotationOverrides  = "overrides"
+	ColRotationUpdatedAt  = "updatedAt"
+)
+
+func CreateOnCallRotation(ctx context.Context, rotation shared.OnCallRotation) error {
+	now := shared.GetCurrentTime()
+	rotation.CreatedAt = &now
+	rotation.UpdatedAt = &now
+
+	return services.DbPutListedItem(ctx, listedTable(shared.OnCallTable), rotation)
+}
+
+func GetOnCallRotation(ctx context.Context, rotationID string) (shared.OnCallRotation, error) {
+	var rotation shared.OnCallRotation
+	err := services.DbGetItem(ctx, shared.OnCallTable, shared.OnCallRotation{
+		RotationID: rotationID,
+	}, &rotation)
+	if err != nil {
+		return shared.OnCallRotation{}, err
+	}
+	return rotation, nil
+}
+
+func UpdateOnCallRotation(ctx context.Context, rotation shared.OnCallRotation) (shared.OnCallRotation, error) {
+	var update expression.UpdateBuilder
+
+	if rotation.Name != "" {
+		update = update.Set(expression.Name(ColRotationName), expression.Value(rotation.Name))
+	}
+	if rotation.Members != nil {
+		update = update.Set(expression.Name(ColRotationMembers), expression.Value(rotation.Members))
+	}
+	if rotation.StartAt != nil {
+		update = update.Set(expression.Name(ColRotationStartAt), expression.Value(rotation.StartAt))
+	}
+	if rotation.ShiftHours > 0 {
+		update = update.Set(expression.Name(ColRotationShiftHours), expression.Value(rotation.ShiftHours))
+	}
+	if rotation.Overrides != nil {
+		update = update.Set(expression.Name(ColRotationOverrides), expression.Value(rotation.Overrides))
+	}
+
+	update = update.Set(expression.Name(ColRotationUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.OnCallTable,
+		Update:    update,
+		Query: shared.OnCallRotation{
+			RotationID: rotation.RotationID,
+		},
+		Condition: expression.Name(ColRotationID).Equal(expression.Value(rotation.RotationID)),
+	})
+	if err != nil {
+		return shared.OnCallRotation{}, err
+	}
+
+	var updatedRotation shared.OnCallRotation
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedRotation)
+	if err != nil {
+		return shared.OnCallRotation{}, err
+	}
+
+	return updatedRotation, nil
+}
+
+// GetOnCallRotationsList returns a page of the on-call rotations, oldest first
+func GetOnCallRotationsList(ctx context.Context, limit int, startKey string) ([]shared.OnCallRotation, string, error) {
+	var items []shared.OnCallRotation
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.OnCallTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
+
+func DeleteOnCallRotation(ctx context.Context, rotationID string) error {
+	return services.DbDeleteItem(ctx, shared.OnCallTable, shared.OnCallRotation{
+		RotationID: rotationID,
+	})
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColQuarantineMessageID     = "messageId"
+	ColQuarantineQuarantinedAt = "quarantinedAt"
+)
+
+func CreateQuarantinedMessage(ctx context.Context, message shared.QuarantinedMessage) error {
+	now := shared.GetCurrentTime()
+	message.QuarantinedAt = &now
+
+	// Set TTL
+	message.ExpiresAt = retentionExpiresAt(ctx, shared.RetentionQuarantine, now)
+
+	return services.DbPutListedItem(ctx, listedTable(shared.QuarantineTable), message)
+}
+
+func GetQuarantinedMessage(ctx context.Context, messageID string) (shared.QuarantinedMessage, error) {
+	var message shared.QuarantinedMessage
+	err := services.DbGetItem(ctx, shared.QuarantineTable, shared.QuarantinedMessage{
+		MessageID: messageID,
+	}, &message)
+	if err != nil {
+		return shared.QuarantinedMessage{}, err
+	}
+	return message, nil
+}
+
+// GetQuarantinedMessagesList returns a page of the quarantined messages, oldest first
+func GetQuarantinedMessagesList(ctx context.Context, limit int, startKey string) ([]shared.QuarantinedMessage, string, error) {
+	var items []shared.QuarantinedMessage
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.QuarantineTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
+
+func DeleteQuarantinedMessage(ctx context.Context, messageID string) error {
+	return services.DbDeleteItem(ctx, shared.QuarantineTable, shared.QuarantinedMessage{
+		MessageID: messageID,
+	})
+}
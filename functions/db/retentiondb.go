@@ -0,0 +1,81 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ColExpiresAt is the TTL attribute of every table under a retention policy
+var ColExpiresAt = "expiresAt"
+
+// retentionCache keeps the global retention policy between writes, a policy change reaches new rows
+// within the cache TTL and existing rows on the janitor's next run
+var retentionCache = shared.NewTTLCache[shared.RetentionSettings](5 * time.Minute)
+
+// GetRetentionSettings returns the global retention policy, the defaults when it cannot be read
+func GetRetentionSettings(ctx context.Context) shared.RetentionSettings {
+	if settings, ok := retentionCache.Get("*"); ok {
+		return settings
+	}
+
+	globalConfig, err := getStoredSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config, using default retention")
+		return shared.RetentionSettings{}
+	}
+	var settings shared.RetentionSettings
+	if globalConfig.Config != nil {
+		settings = globalConfig.Config.Retention
+	}
+	retentionCache.Set("*", settings)
+	return settings
+}
+
+// retentionExpiresAt returns the TTL of a new row of the table under the current retention policy
+func retentionExpiresAt(ctx context.Context, table string, createdAt time.Time) int {
+	return GetRetentionSettings(ctx).ExpiresAt(table, createdAt)
+}
+
+// ScanRetentionRows returns a page of a table's rows with only the given attributes, for the retention janitor
+func ScanRetentionRows(ctx context.Context, tableName string, attributes []string, startKey map[string]types.AttributeValue) ([]map[string]any, map[string]types.AttributeValue, error) {
+	projection := expression.NamesList(expression.Name(attributes[0]))
+	for _, attribute := range attributes[1:] {
+		projection = projection.AddNames(expression.Name(attribute))
+	}
+
+	var rows []map[string]any
+	nextKey, err := services.DbScanItems(ctx, tableName, nil, &projection, startKey, 0, &rows)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rows, nextKey, nil
+}
+
+// SetRowExpiresAt sets the TTL of the row with the given key, 0 removes it so the row is kept forever.
+// It fails the condition check when the row was deleted in the meantime
+func SetRowExpiresAt(ctx context.Context, tableName string, key map[string]any, keyAttribute string, expiresAt int) error {
+	var update expression.UpdateBuilder
+	if expiresAt == 0 {
+		update = update.Remove(expression.Name(ColExpiresAt))
+	} else {
+		update = update.Set(expression.Name(ColExpiresAt), expression.Value(expiresAt))
+	}
+
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: tableName,
+		Update:    update,
+		Query:     key,
+		Condition: expression.Name(keyAttribute).AttributeExists(),
+	})
+	return err
+}
+
+// DeleteRow deletes the row with the given key
+func DeleteRow(ctx context.Context, tableName string, key map[string]any) error {
+	return services.DbDeleteItem(ctx, tableName, key)
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColRuleID         = "ruleId"
+	ColRuleName       = "name"
+	ColRuleOrder      = "order"
+	ColRuleEnabled    = "enabled"
+	ColRuleConditions = "conditions"
+	ColRuleActions    = "actions"
+	ColRuleTemporary  = "temporaryUntil"
+	ColRuleUpdatedAt  = "updatedAt"
+)
+
+func CreateRule(ctx context.Context, rule shared.Rule) (shared.Rule, error) {
+	now := shared.GetCurrentTime()
+	rule.CreatedAt = &now
+	rule.UpdatedAt = &now
+
+	if err := services.DbPutListedItem(ctx, listedTable(shared.RulesTable), rule); err != nil {
+		return shared.Rule{}, err
+	}
+	return rule, nil
+}
+
+func GetRule(ctx context.Context, ruleID string) (shared.Rule, error) {
+	var rule shared.Rule
+	err := services.DbGetItem(ctx, shared.RulesTable, shared.Rule{
+		RuleID: ruleID,
+	}, &rule)
+	if err != nil {
+		return shared.Rule{}, err
+	}
+	return rule, nil
+}
+
+// UpdateRule replaces the name, order, enabled flag, expiry, conditions and actions of an existing rule
+func UpdateRule(ctx context.Context, rule shared.Rule) (shared.Rule, error) {
+	update := expression.Set(expression.Name(ColRuleOrder), expression.Value(rule.Order)).
+		Set(expression.Name(ColRuleConditions), expression.Value(rule.Conditions)).
+		Set(expression.Name(ColRuleActions), expression.Value(rule.Actions)).
+		Set(expression.Name(ColRuleUpdatedAt), expression.Value(shared.GetCurrentTime()))
+	if rule.Name != "" {
+		update = update.Set(expression.Name(ColRuleName), expression.Value(rule.Name))
+	}
+	if rule.Enabled != nil {
+		update = update.Set(expression.Name(ColRuleEnabled), expression.Value(*rule.Enabled))
+	}
+	if rule.TemporaryUntil != nil {
+		update = update.Set(expression.Name(ColRuleTemporary), expression.Value(rule.TemporaryUntil))
+	}
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.RulesTable,
+		Update:    update,
+		Query: shared.Rule{
+			RuleID: rule.RuleID,
+		},
+		Condition: expression.Name(ColRuleID).Equal(expression.Value(rule.RuleID)),
+	})
+	if err != nil {
+		return shared.Rule{}, err
+	}
+
+	var updatedRule shared.Rule
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedRule)
+	if err != nil {
+		return shared.Rule{}, err
+	}
+
+	return updatedRule, nil
+}
+
+// GetRulesList returns a page of the rules in evaluation order
+func GetRulesList(ctx context.Context, limit int, startKey string) ([]shared.Rule, string, error) {
+	var items []shared.Rule
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.RulesTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
+
+// GetAllRules scans every rule and returns them in evaluation order
+func GetAllRules(ctx context.Context) ([]shared.Rule, error) {
+	var all []shared.Rule
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.Rule
+		nextKey, err := services.DbScanItems(ctx, shared.RulesTable, nil, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			shared.SortRules(all)
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
+}
+
+func DeleteRule(ctx context.Context, ruleID string) error {
+	return services.DbDeleteItem(ctx, shared.RulesTable, shared.Rule{
+		RuleID: ruleID,
+	})
+}
@@ -11,14 +11,18 @@ import (
 )
 
 var (
-	ColScheduleID        = "scheduleId"
-	ColScheduleUserID    = "userId"
-	ColScheduleType      = "type"
-	ColScheduleVariables = "variables"
-	ColScheduleConfig    = "schedule"
-	ColScheduleStatus    = "status"
-	ColScheduleCreatedAt = "createdAt"
-	ColScheduleUpdatedAt = "updatedAt"
+	ColScheduleID          = "scheduleId"
+	ColScheduleUserID      = "userId"
+	ColScheduleType        = "type"
+	ColScheduleVariables   = "variables"
+	ColScheduleConfig      = "schedule"
+	ColScheduleEndDate     = "endDate"
+	ColScheduleStatus      = "status"
+	ColScheduleDryRun      = "dryRun"
+	ColScheduleOccurrences = "occurrences"
+	ColScheduleTags        = "tags"
+	ColScheduleCreatedAt   = "createdAt"
+	ColScheduleUpdatedAt   = "updatedAt"
 )
 
 func CreateScheduledNotification(ctx context.Context, notification shared.ScheduledNotification) error {
@@ -27,7 +31,7 @@ func CreateScheduledNotification(ctx context.Context, notification shared.Schedu
 	notification.UpdatedAt = &now
 	notification.Status = shared.StatusActive
 
-	return services.DbPutItem(ctx, shared.SchedulesTable, notification)
+	return services.DbPutListedItem(ctx, listedTable(shared.SchedulesTable), notification)
 }
 
 func GetScheduledNotification(ctx context.Context, scheduleID string) (shared.ScheduledNotification, error) {
@@ -41,22 +45,131 @@ func GetScheduledNotification(ctx context.Context, scheduleID string) (shared.Sc
 	return notification, nil
 }
 
-func GetUserScheduledNotifications(ctx context.Context, userID string, limit int, startKey string) ([]shared.ScheduledNotification, string, error) {
+// GetUserScheduledNotifications returns a page of a user's schedules, only those carrying every tag when tags are given
+func GetUserScheduledNotifications(ctx context.Context, userID string, tags []string, limit int, startKey string) ([]shared.ScheduledNotification, string, error) {
+	return queryUserSchedules(ctx, userID, withTagsFilter(expression.ConditionBuilder{}, ColScheduleTags, tags), limit, startKey)
+}
+
+// CountUserScheduledNotifications counts a user's active and paused schedules, cancelled ones are left out
+func CountUserScheduledNotifications(ctx context.Context, userID string) (int, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(ColScheduleUserID).Equal(expression.Value(userID))).
+		WithFilter(expression.Name(ColScheduleStatus).NotEqual(expression.Value(shared.StatusCancelled))).
+		WithProjection(expression.NamesList(expression.Name(ColScheduleID))).
+		Build()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
 	var lastEvaluatedKey map[string]types.AttributeValue
-	var err error
-	if startKey != "" {
-		lastEvaluatedKey, err = attributevalue.MarshalMap(map[string]any{
-			ColScheduleUserID:    userID,
-			ColScheduleCreatedAt: startKey,
-		})
+	for {
+		var items []shared.ScheduledNotification
+		lastEvaluatedKey, err = services.DbQuery(ctx, shared.SchedulesTable, "UserIndex", 0, lastEvaluatedKey, expr, &items, nil)
 		if err != nil {
-			return nil, "", err
+			return 0, err
+		}
+		count += len(items)
+		if lastEvaluatedKey == nil {
+			return count, nil
+		}
+	}
+}
+
+// BuildScheduleQuotaKey builds the key counting a user's active and paused schedules
+func BuildScheduleQuotaKey(userID string) string {
+	return "schedules#" + userID
+}
+
+// ClaimScheduleSlot counts one more schedule for the user unless they already hold limit of them, and returns
+// the count held when the limit is reached. The counter is seeded from the user's stored schedules the first
+// time; afterwards the conditional increment keeps concurrent creates from going over the limit
+func ClaimScheduleSlot(ctx context.Context, userID string, limit int) (int, bool, error) {
+	key := BuildScheduleQuotaKey(userID)
+	for seeded := false; ; seeded = true {
+		_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+			TableName: shared.DedupTable,
+			Update:    expression.Add(expression.Name(ColDedupCount), expression.Value(1)),
+			Query:     shared.DedupRecord{DedupKey: key},
+			Condition: expression.Name(ColDedupKey).AttributeExists().
+				And(expression.Name(ColDedupCount).AttributeNotExists().Or(expression.Name(ColDedupCount).LessThan(expression.Value(limit)))),
+		})
+		if err == nil {
+			return 0, true, nil
+		}
+		if !services.IsConditionalCheckFailed(err) {
+			return 0, false, err
+		}
+
+		var record shared.DedupRecord
+		if err := services.DbGetItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: key}, &record); err != nil {
+			return 0, false, err
+		}
+		if record.DedupKey != "" || seeded {
+			return record.Count, false, nil
+		}
+		if err := seedScheduleQuota(ctx, userID, key); err != nil {
+			return 0, false, err
 		}
 	}
+}
+
+// seedScheduleQuota starts the user's schedule counter at the schedules they hold. A counter seeded
+// concurrently by another create is kept
+func seedScheduleQuota(ctx context.Context, userID, key string) error {
+	count, err := CountUserScheduledNotifications(ctx, userID)
+	if err != nil {
+		return err
+	}
+	now := shared.GetCurrentTime()
+	err = services.DbPutItemWithCondition(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: key, CreatedAt: &now, Count: count},
+		expression.Name(ColDedupKey).AttributeNotExists())
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// ReleaseScheduleSlot gives back a slot claimed for the user, once a schedule is deleted or cancelled or
+// could not be created. The counter never goes below zero
+func ReleaseScheduleSlot(ctx context.Context, userID string) error {
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.DedupTable,
+		Update:    expression.Add(expression.Name(ColDedupCount), expression.Value(-1)),
+		Query:     shared.DedupRecord{DedupKey: BuildScheduleQuotaKey(userID)},
+		Condition: expression.Name(ColDedupCount).GreaterThan(expression.Value(0)),
+	})
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// withTagsFilter adds to filter that the item's tags attribute holds every tag
+func withTagsFilter(filter expression.ConditionBuilder, attribute string, tags []string) expression.ConditionBuilder {
+	for _, tag := range tags {
+		condition := expression.Name(attribute).Contains(tag)
+		if filter.IsSet() {
+			condition = filter.And(condition)
+		}
+		filter = condition
+	}
+	return filter
+}
+
+// queryUserSchedules reads a page of a user's schedules from the UserIndex GSI, oldest first
+func queryUserSchedules(ctx context.Context, userID string, filter expression.ConditionBuilder, limit int, startKey string) ([]shared.ScheduledNotification, string, error) {
+	lastEvaluatedKey, err := services.DecodePageToken(startKey)
+	if err != nil {
+		return nil, "", err
+	}
 
 	// Create key condition for UserIndex GSI
-	keyCondition := expression.Key(ColScheduleUserID).Equal(expression.Value(userID))
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	builder := expression.NewBuilder().WithKeyCondition(expression.Key(ColScheduleUserID).Equal(expression.Value(userID)))
+	if filter.IsSet() {
+		builder = builder.WithFilter(filter)
+	}
+	expr, err := builder.Build()
 	if err != nil {
 		return nil, "", err
 	}
@@ -67,14 +180,15 @@ func GetUserScheduledNotifications(ctx context.Context, userID string, limit int
 		return nil, "", err
 	}
 
-	var nextToken string
-	if lastEvaluatedKey != nil && lastEvaluatedKey[ColScheduleCreatedAt] != nil {
-		nextToken = lastEvaluatedKey[ColScheduleCreatedAt].(*types.AttributeValueMemberS).Value
+	nextToken, err := services.EncodePageToken(lastEvaluatedKey)
+	if err != nil {
+		return nil, "", err
 	}
-
 	return items, nextToken, nil
 }
 
+// UpdateScheduledNotification writes the set fields of the schedule. Cancelling fails the condition when the
+// schedule is already cancelled, so only one caller gives back its slot
 func UpdateScheduledNotification(ctx context.Context, notification shared.ScheduledNotification) (shared.ScheduledNotification, error) {
 	var update expression.UpdateBuilder
 
@@ -84,19 +198,31 @@ func UpdateScheduledNotification(ctx context.Context, notification shared.Schedu
 	if notification.Variables != nil {
 		update = update.Set(expression.Name(ColScheduleVariables), expression.Value(notification.Variables))
 	}
-	if notification.Schedule.Type != "" {
+	if notification.Schedule != nil && notification.Schedule.Type != "" {
 		update = update.Set(expression.Name(ColScheduleConfig), expression.Value(notification.Schedule))
 	}
+	if len(notification.Tags) > 0 {
+		update = update.Set(expression.Name(ColScheduleTags), expression.Value(notification.Tags))
+	} else if notification.Tags != nil {
+		update = update.Remove(expression.Name(ColScheduleTags))
+	}
+	// DryRun is always written, false takes the schedule live
+	update = update.Set(expression.Name(ColScheduleDryRun), expression.Value(notification.DryRun))
 
 	update = update.Set(expression.Name(ColScheduleUpdatedAt), expression.Value(shared.GetCurrentTime()))
 
+	condition := expression.Name(ColScheduleID).Equal(expression.Value(notification.ScheduleID))
+	if notification.Status == shared.StatusCancelled {
+		condition = condition.And(expression.Name(ColScheduleStatus).NotEqual(expression.Value(shared.StatusCancelled)))
+	}
+
 	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
 		TableName: shared.SchedulesTable,
 		Update:    update,
 		Query: shared.ScheduledNotification{
 			ScheduleID: notification.ScheduleID,
 		},
-		Condition: expression.Name(ColScheduleID).Equal(expression.Value(notification.ScheduleID)),
+		Condition: condition,
 	})
 	if err != nil {
 		return shared.ScheduledNotification{}, err
@@ -111,36 +237,99 @@ func UpdateScheduledNotification(ctx context.Context, notification shared.Schedu
 	return updatedNotification, nil
 }
 
+// RecordScheduleOccurrence counts an occurrence of the schedule and returns the schedule with its new count.
+// The condition fails when the schedule is gone
+func RecordScheduleOccurrence(ctx context.Context, scheduleID string) (shared.ScheduledNotification, error) {
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.SchedulesTable,
+		Update:    expression.Add(expression.Name(ColScheduleOccurrences), expression.Value(1)),
+		Query: shared.ScheduledNotification{
+			ScheduleID: scheduleID,
+		},
+		Condition: expression.Name(ColScheduleID).AttributeExists(),
+	})
+	if err != nil {
+		return shared.ScheduledNotification{}, err
+	}
+
+	var schedule shared.ScheduledNotification
+	if err := attributevalue.UnmarshalMap(out.Attributes, &schedule); err != nil {
+		return shared.ScheduledNotification{}, err
+	}
+	return schedule, nil
+}
+
 func DeleteScheduledNotification(ctx context.Context, scheduleID string) error {
 	return services.DbDeleteItem(ctx, shared.SchedulesTable, shared.ScheduledNotification{
 		ScheduleID: scheduleID,
 	})
 }
 
-func GetScheduledNotificationsList(ctx context.Context, limit int, startKey string) ([]shared.ScheduledNotification, string, error) {
-	var lastEvaluatedKey map[string]types.AttributeValue
-	var err error
-	if startKey != "" {
-		lastEvaluatedKey, err = attributevalue.MarshalMap(map[string]any{
-			ColScheduleID: startKey,
-		})
-		if err != nil {
-			return nil, "", err
+// GetScheduledNotificationsList returns a page of the schedules of every user, or of userID when it is set,
+// oldest first, with the given status and type when they are set and carrying every tag when tags are given
+func GetScheduledNotificationsList(ctx context.Context, userID, status, notificationType string, tags []string, limit int, startKey string) ([]shared.ScheduledNotification, string, error) {
+	var filter expression.ConditionBuilder
+	if status != "" {
+		filter = expression.Name(ColScheduleStatus).Equal(expression.Value(status))
+	}
+	if notificationType != "" {
+		condition := expression.Name(ColScheduleType).Equal(expression.Value(notificationType))
+		if filter.IsSet() {
+			condition = filter.And(condition)
 		}
+		filter = condition
+	}
+	filter = withTagsFilter(filter, ColScheduleTags, tags)
+
+	if userID != "" {
+		return queryUserSchedules(ctx, userID, filter, limit, startKey)
 	}
 
 	var items []shared.ScheduledNotification
-	lastEvaluatedKey, err = services.DbScanItems(ctx, shared.SchedulesTable, nil, nil, lastEvaluatedKey, limit, &items)
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.SchedulesTable), limit, startKey, filter, &items)
 	if err != nil {
 		return nil, "", err
 	}
+	return items, nextToken, nil
+}
 
-	var nextToken string
-	if lastEvaluatedKey != nil && lastEvaluatedKey[ColScheduleID] != nil {
-		nextToken = lastEvaluatedKey[ColScheduleID].(*types.AttributeValueMemberS).Value
+// GetAllScheduledNotifications scans every schedule regardless of list order, including those stored before listing
+func GetAllScheduledNotifications(ctx context.Context) ([]shared.ScheduledNotification, error) {
+	var all []shared.ScheduledNotification
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.ScheduledNotification
+		nextKey, err := services.DbScanItems(ctx, shared.SchedulesTable, nil, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
 	}
+}
 
-	return items, nextToken, nil
+// GetActiveSchedulesWithEndDate scans every active schedule that has an end date
+func GetActiveSchedulesWithEndDate(ctx context.Context) ([]shared.ScheduledNotification, error) {
+	filter := expression.Name(ColScheduleStatus).Equal(expression.Value(shared.StatusActive)).
+		And(expression.Name(ColScheduleConfig + "." + ColScheduleEndDate).AttributeExists())
+
+	var all []shared.ScheduledNotification
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.ScheduledNotification
+		nextKey, err := services.DbScanItems(ctx, shared.SchedulesTable, &filter, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
 }
 
 // GetActiveSchedulesCount gets count of active scheduled notifications for monitoring
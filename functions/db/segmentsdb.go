@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColSegmentID        = "segmentId"
+	ColSegmentName      = "name"
+	ColSegmentCriteria  = "criteria"
+	ColSegmentUpdatedAt = "updatedAt"
+)
+
+func CreateSegment(ctx context.Context, segment shared.Segment) error {
+	now := shared.GetCurrentTime()
+	segment.CreatedAt = &now
+	segment.UpdatedAt = &now
+
+	return services.DbPutListedItem(ctx, listedTable(shared.SegmentsTable), segment)
+}
+
+func GetSegment(ctx context.Context, segmentID string) (shared.Segment, error) {
+	var segment shared.Segment
+	err := services.DbGetItem(ctx, shared.SegmentsTable, shared.Segment{
+		SegmentID: segmentID,
+	}, &segment)
+	if err != nil {
+		return shared.Segment{}, err
+	}
+	return segment, nil
+}
+
+func UpdateSegment(ctx context.Context, segment shared.Segment) (shared.Segment, error) {
+	var update expression.UpdateBuilder
+
+	if segment.Name != "" {
+		update = update.Set(expression.Name(ColSegmentName), expression.Value(segment.Name))
+	}
+	if !segment.Criteria.IsEmpty() {
+		update = update.Set(expression.Name(ColSegmentCriteria), expression.Value(segment.Criteria))
+	}
+
+	update = update.Set(expression.Name(ColSegmentUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.SegmentsTable,
+		Update:    update,
+		Query: shared.Segment{
+			SegmentID: segment.SegmentID,
+		},
+		Condition: expression.Name(ColSegmentID).Equal(expression.Value(segment.SegmentID)),
+	})
+	if err != nil {
+		return shared.Segment{}, err
+	}
+
+	var updatedSegment shared.Segment
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedSegment)
+	if err != nil {
+		return shared.Segment{}, err
+	}
+
+	return updatedSegment, nil
+}
+
+// GetSegmentsList returns a page of the segments, oldest first
+func GetSegmentsList(ctx context.Context, limit int, startKey string) ([]shared.Segment, string, error) {
+	var items []shared.Segment
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.SegmentsTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
+
+func DeleteSegment(ctx context.Context, segmentID string) error {
+	return services.DbDeleteItem(ctx, shared.SegmentsTable, shared.Segment{
+		SegmentID: segmentID,
+	})
+}
@@ -0,0 +1,271 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+var (
+	ColSequenceID          = "sequenceId"
+	ColSequenceName        = "name"
+	ColSequenceDescription = "description"
+	ColSequenceSteps       = "steps"
+	ColSequenceUpdatedAt   = "updatedAt"
+
+	ColEnrollmentUserID      = "userId"
+	ColEnrollmentSequenceID  = "sequenceId"
+	ColEnrollmentRunID       = "runId"
+	ColEnrollmentStatus      = "status"
+	ColEnrollmentCurrentStep = "currentStep"
+)
+
+// ErrEnrollmentActive is returned when starting a sequence the user is still enrolled in
+var ErrEnrollmentActive = errors.New("user is already enrolled in the sequence")
+
+// ErrEnrollmentChanged is returned when an enrollment moved on, or ended, since it was read
+var ErrEnrollmentChanged = errors.New("sequence enrollment changed")
+
+// sequenceKey is the primary key of the sequences table
+type sequenceKey struct {
+	SequenceID string `dynamodbav:"sequenceId"`
+}
+
+// enrollmentKey is the primary key of the sequence enrollments table
+type enrollmentKey struct {
+	UserID     string `dynamodbav:"userId"`
+	SequenceID string `dynamodbav:"sequenceId"`
+}
+
+func CreateSequence(ctx context.Context, sequence shared.Sequence) error {
+	now := shared.GetCurrentTime()
+	sequence.CreatedAt = &now
+	sequence.UpdatedAt = &now
+
+	return services.DbPutListedItem(ctx, listedTable(shared.SequencesTable), sequence)
+}
+
+func GetSequence(ctx context.Context, sequenceID string) (shared.Sequence, error) {
+	var sequence shared.Sequence
+	err := services.DbGetItem(ctx, shared.SequencesTable, sequenceKey{SequenceID: sequenceID}, &sequence)
+	if err != nil {
+		return shared.Sequence{}, err
+	}
+	return sequence, nil
+}
+
+// UpdateSequence changes the set fields of a sequence. Steps are replaced as a whole, enrollments in
+// progress continue with the new steps from their current index
+func UpdateSequence(ctx context.Context, sequence shared.Sequence) (shared.Sequence, error) {
+	var update expression.UpdateBuilder
+
+	if sequence.Name != "" {
+		update = update.Set(expression.Name(ColSequenceName), expression.Value(sequence.Name))
+	}
+	if sequence.Description != "" {
+		update = update.Set(expression.Name(ColSequenceDescription), expression.Value(sequence.Description))
+	}
+	if len(sequence.Steps) > 0 {
+		update = update.Set(expression.Name(ColSequenceSteps), expression.Value(sequence.Steps))
+	}
+
+	update = update.Set(expression.Name(ColSequenceUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.SequencesTable,
+		Update:    update,
+		Query:     sequenceKey{SequenceID: sequence.SequenceID},
+		Condition: expression.Name(ColSequenceID).Equal(expression.Value(sequence.SequenceID)),
+	})
+	if err != nil {
+		return shared.Sequence{}, err
+	}
+
+	var updatedSequence shared.Sequence
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedSequence)
+	if err != nil {
+		return shared.Sequence{}, err
+	}
+
+	return updatedSequence, nil
+}
+
+// GetSequencesList returns a page of the sequences, oldest first
+func GetSequencesList(ctx context.Context, limit int, startKey string) ([]shared.Sequence, string, error) {
+	var items []shared.Sequence
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.SequencesTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	return items, nextToken, nil
+}
+
+// DeleteSequence removes a sequence definition. Steps already scheduled for its enrollments are dropped
+// by the processor once they find no sequence
+func DeleteSequence(ctx context.Context, sequenceID string) error {
+	return services.DbDeleteItem(ctx, shared.SequencesTable, sequenceKey{SequenceID: sequenceID})
+}
+
+func GetSequenceEnrollment(ctx context.Context, userID, sequenceID string) (shared.SequenceEnrollment, error) {
+	var enrollment shared.SequenceEnrollment
+	err := services.DbGetItem(ctx, shared.SequenceEnrollmentsTable, enrollmentKey{UserID: userID, SequenceID: sequenceID}, &enrollment)
+	if err != nil {
+		return shared.SequenceEnrollment{}, err
+	}
+	return enrollment, nil
+}
+
+// GetUserSequenceEnrollments lists every enrollment of a user, active or ended
+func GetUserSequenceEnrollments(ctx context.Context, userID string) ([]shared.SequenceEnrollment, error) {
+	expr, err := expression.NewBuilder().
+		WithKeyCondition(expression.Key(ColEnrollmentUserID).Equal(expression.Value(userID))).
+		Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var enrollments []shared.SequenceEnrollment
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var page []shared.SequenceEnrollment
+		lastEvaluatedKey, err = services.DbQuery(ctx, shared.SequenceEnrollmentsTable, "", 0, lastEvaluatedKey, expr, &page, nil)
+		if err != nil {
+			return nil, err
+		}
+		enrollments = append(enrollments, page...)
+		if lastEvaluatedKey == nil {
+			return enrollments, nil
+		}
+	}
+}
+
+// StartSequenceEnrollment enrolls the user in the sequence and sends or schedules its first step. It fails
+// with ErrEnrollmentActive while an earlier enrollment is still active
+func StartSequenceEnrollment(ctx context.Context, sequence shared.Sequence, userID string, variables map[string]any) (shared.SequenceEnrollment, error) {
+	now := shared.GetCurrentTime()
+	firstStepAt := sequence.StepDueAt(0, now)
+	enrollment := shared.SequenceEnrollment{
+		UserID:      userID,
+		SequenceID:  sequence.SequenceID,
+		RunID:       uuid.New().String(),
+		Status:      shared.SequenceEnrollmentActive,
+		CurrentStep: 0,
+		NextStepAt:  &firstStepAt,
+		Variables:   variables,
+		StartedAt:   &now,
+		UpdatedAt:   &now,
+	}
+
+	// The enrollment is stored before the step is sent, an immediate step must find it
+	condition := expression.Name(ColEnrollmentUserID).AttributeNotExists().
+		Or(expression.Name(ColEnrollmentStatus).NotEqual(expression.Value(shared.SequenceEnrollmentActive)))
+	if err := services.DbPutItemWithCondition(ctx, shared.SequenceEnrollmentsTable, enrollment, condition); err != nil {
+		if services.IsConditionalCheckFailed(err) {
+			return shared.SequenceEnrollment{}, ErrEnrollmentActive
+		}
+		return shared.SequenceEnrollment{}, err
+	}
+
+	if err := sendSequenceStep(ctx, sequence, enrollment); err != nil {
+		// Without its first step the enrollment would stay active forever
+		if deleteErr := services.DbDeleteItem(ctx, shared.SequenceEnrollmentsTable, enrollmentKey{UserID: userID, SequenceID: sequence.SequenceID}); deleteErr != nil {
+			shared.LogError(ctx).Err(deleteErr).Str("userId", userID).Str("sequenceId", sequence.SequenceID).Msg("Failed to remove enrollment without a first step")
+		}
+		return shared.SequenceEnrollment{}, err
+	}
+	return enrollment, nil
+}
+
+// AdvanceSequenceEnrollment records the outcome of the enrollment's current step, then sends or schedules
+// the next step, or completes the enrollment after the last one. It fails with ErrEnrollmentChanged when
+// the enrollment is no longer waiting for that step
+func AdvanceSequenceEnrollment(ctx context.Context, sequence shared.Sequence, enrollment shared.SequenceEnrollment, outcome, requestID string) (shared.SequenceEnrollment, error) {
+	now := shared.GetCurrentTime()
+	advanced := enrollment
+	advanced.Steps = append(append([]shared.SequenceStepOutcome(nil), enrollment.Steps...), shared.SequenceStepOutcome{
+		Step:      enrollment.CurrentStep,
+		Outcome:   outcome,
+		RequestID: requestID,
+		At:        &now,
+	})
+	advanced.CurrentStep++
+	advanced.UpdatedAt = &now
+	if advanced.CurrentStep >= len(sequence.Steps) {
+		advanced.Status = shared.SequenceEnrollmentCompleted
+		advanced.NextStepAt = nil
+	} else {
+		nextStepAt := sequence.StepDueAt(advanced.CurrentStep, now)
+		advanced.NextStepAt = &nextStepAt
+	}
+
+	// The new state is stored before the next step is sent, an immediate step must find it
+	if err := putEnrollmentIfUnchanged(ctx, advanced, enrollment); err != nil {
+		return shared.SequenceEnrollment{}, err
+	}
+	if advanced.Status != shared.SequenceEnrollmentActive {
+		return advanced, nil
+	}
+
+	if err := sendSequenceStep(ctx, sequence, advanced); err != nil {
+		// Put the step back, so the step being advanced can be retried
+		if revertErr := putEnrollmentIfUnchanged(ctx, enrollment, advanced); revertErr != nil {
+			shared.LogError(ctx).Err(revertErr).Str("userId", enrollment.UserID).Str("sequenceId", sequence.SequenceID).Msg("Failed to revert enrollment")
+		}
+		return shared.SequenceEnrollment{}, err
+	}
+	return advanced, nil
+}
+
+// CancelSequenceEnrollment ends an active enrollment and deletes the schedule of its pending step. A step
+// that fires anyway is dropped by the processor
+func CancelSequenceEnrollment(ctx context.Context, enrollment shared.SequenceEnrollment) (shared.SequenceEnrollment, error) {
+	now := shared.GetCurrentTime()
+	cancelled := enrollment
+	cancelled.Status = shared.SequenceEnrollmentCancelled
+	cancelled.NextStepAt = nil
+	cancelled.UpdatedAt = &now
+	if err := putEnrollmentIfUnchanged(ctx, cancelled, enrollment); err != nil {
+		return shared.SequenceEnrollment{}, err
+	}
+
+	DeleteSequenceStepSchedule(ctx, enrollment)
+	return cancelled, nil
+}
+
+// DeleteSequenceStepSchedule deletes the schedule of the enrollment's pending step. Immediate steps have
+// none, and a schedule that already fired deleted itself
+func DeleteSequenceStepSchedule(ctx context.Context, enrollment shared.SequenceEnrollment) {
+	scheduleID := shared.SequenceStepScheduleID(enrollment.RunID, enrollment.CurrentStep)
+	if err := shared.DeleteEventBridgeSchedule(ctx, enrollment.UserID, scheduleID); err != nil && !shared.IsScheduleNotFound(err) {
+		shared.LogError(ctx).Err(err).Str("scheduleId", scheduleID).Msg("Failed to delete sequence step schedule")
+	}
+}
+
+// sendSequenceStep queues the enrollment's current step when it is due, otherwise schedules it
+func sendSequenceStep(ctx context.Context, sequence shared.Sequence, enrollment shared.SequenceEnrollment) error {
+	request := shared.SequenceStepRequest(sequence, enrollment)
+	scheduleID := shared.SequenceStepScheduleID(enrollment.RunID, enrollment.CurrentStep)
+	if err := services.SendNotificationAt(ctx, enrollment.UserID, scheduleID, *enrollment.NextStepAt, request); err != nil {
+		return fmt.Errorf("failed to send sequence step %d: %w", enrollment.CurrentStep, err)
+	}
+	return nil
+}
+
+// putEnrollmentIfUnchanged stores the enrollment if the stored one is still active on the expected run and step
+func putEnrollmentIfUnchanged(ctx context.Context, enrollment, expected shared.SequenceEnrollment) error {
+	condition := expression.Name(ColEnrollmentRunID).Equal(expression.Value(expected.RunID)).
+		And(expression.Name(ColEnrollmentStatus).Equal(expression.Value(expected.Status))).
+		And(expression.Name(ColEnrollmentCurrentStep).Equal(expression.Value(expected.CurrentStep)))
+	err := services.DbPutItemWithCondition(ctx, shared.SequenceEnrollmentsTable, enrollment, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return ErrEnrollmentChanged
+	}
+	return err
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"notification-service/functions/services"
 	"notification-service/functions/shared"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
@@ -18,15 +20,121 @@ var (
 	ColConfigCreatedAt   = "createdAt"
 )
 
+// withEncryptedSecrets returns a copy of the config with its secrets encrypted for storage
+func withEncryptedSecrets(systemConfig shared.SystemConfig) (shared.SystemConfig, error) {
+	if systemConfig.Config == nil {
+		return systemConfig, nil
+	}
+	settings := *systemConfig.Config
+	webhookURL, err := shared.EncryptSecret(settings.SlackSettings.WebhookURL)
+	if err != nil {
+		return shared.SystemConfig{}, err
+	}
+	settings.SlackSettings.WebhookURL = webhookURL
+	if settings.SlackSettings.WebhookURLByType != nil {
+		encrypted := make(map[string]string, len(settings.SlackSettings.WebhookURLByType))
+		for notificationType, typeWebhookURL := range settings.SlackSettings.WebhookURLByType {
+			if encrypted[notificationType], err = shared.EncryptSecret(typeWebhookURL); err != nil {
+				return shared.SystemConfig{}, err
+			}
+		}
+		settings.SlackSettings.WebhookURLByType = encrypted
+	}
+	if settings.WebhookSettings.URL, err = shared.EncryptSecret(settings.WebhookSettings.URL); err != nil {
+		return shared.SystemConfig{}, err
+	}
+	if settings.WebhookSettings.Secret, err = shared.EncryptSecret(settings.WebhookSettings.Secret); err != nil {
+		return shared.SystemConfig{}, err
+	}
+	if settings.WebhookSettings.EndpointsByType != nil {
+		encrypted := make(map[string]shared.WebhookEndpointSettings, len(settings.WebhookSettings.EndpointsByType))
+		for notificationType, endpoint := range settings.WebhookSettings.EndpointsByType {
+			if endpoint.URL, err = shared.EncryptSecret(endpoint.URL); err != nil {
+				return shared.SystemConfig{}, err
+			}
+			if endpoint.Secret, err = shared.EncryptSecret(endpoint.Secret); err != nil {
+				return shared.SystemConfig{}, err
+			}
+			encrypted[notificationType] = endpoint
+		}
+		settings.WebhookSettings.EndpointsByType = encrypted
+	}
+	if settings.TeamsSettings.WebhookURL, err = shared.EncryptSecret(settings.TeamsSettings.WebhookURL); err != nil {
+		return shared.SystemConfig{}, err
+	}
+	if settings.EmailSettings.SendGridAPIKey, err = shared.EncryptSecret(settings.EmailSettings.SendGridAPIKey); err != nil {
+		return shared.SystemConfig{}, err
+	}
+	systemConfig.Config = &settings
+	return systemConfig, nil
+}
+
+// decryptSecrets decrypts the secrets of a config read from storage in place
+func decryptSecrets(systemConfig *shared.SystemConfig) error {
+	if systemConfig.Config == nil {
+		return nil
+	}
+	webhookURL, err := shared.DecryptSecret(systemConfig.Config.SlackSettings.WebhookURL)
+	if err != nil {
+		return err
+	}
+	systemConfig.Config.SlackSettings.WebhookURL = webhookURL
+	for notificationType, typeWebhookURL := range systemConfig.Config.SlackSettings.WebhookURLByType {
+		if systemConfig.Config.SlackSettings.WebhookURLByType[notificationType], err = shared.DecryptSecret(typeWebhookURL); err != nil {
+			return err
+		}
+	}
+	if systemConfig.Config.WebhookSettings.URL, err = shared.DecryptSecret(systemConfig.Config.WebhookSettings.URL); err != nil {
+		return err
+	}
+	if systemConfig.Config.WebhookSettings.Secret, err = shared.DecryptSecret(systemConfig.Config.WebhookSettings.Secret); err != nil {
+		return err
+	}
+	for notificationType, endpoint := range systemConfig.Config.WebhookSettings.EndpointsByType {
+		if endpoint.URL, err = shared.DecryptSecret(endpoint.URL); err != nil {
+			return err
+		}
+		if endpoint.Secret, err = shared.DecryptSecret(endpoint.Secret); err != nil {
+			return err
+		}
+		systemConfig.Config.WebhookSettings.EndpointsByType[notificationType] = endpoint
+	}
+	if systemConfig.Config.TeamsSettings.WebhookURL, err = shared.DecryptSecret(systemConfig.Config.TeamsSettings.WebhookURL); err != nil {
+		return err
+	}
+	if systemConfig.Config.EmailSettings.SendGridAPIKey, err = shared.DecryptSecret(systemConfig.Config.EmailSettings.SendGridAPIKey); err != nil {
+		return err
+	}
+	return nil
+}
+
 func CreateSystemConfig(ctx context.Context, systemConfig shared.SystemConfig) error {
 	now := shared.GetCurrentTime()
 	systemConfig.CreatedAt = &now
 	systemConfig.UpdatedAt = &now
 
-	return services.DbPutItem(ctx, shared.ConfigTable, systemConfig)
+	systemConfig, err := withEncryptedSecrets(systemConfig)
+	if err != nil {
+		return err
+	}
+
+	return services.DbPutListedItem(ctx, listedTable(shared.ConfigTable), systemConfig)
 }
 
 func GetSystemConfig(ctx context.Context, context string) (shared.SystemConfig, error) {
+	systemConfig, err := getStoredSystemConfig(ctx, context)
+	if err != nil {
+		return shared.SystemConfig{}, err
+	}
+	if err := decryptSecrets(&systemConfig); err != nil {
+		return shared.SystemConfig{}, err
+	}
+	return systemConfig, nil
+}
+
+// getStoredSystemConfig returns the config as stored, its secrets still encrypted. Readers of the global
+// settings sections use it, so only the functions that deliver or manage secrets need the encryption key
+func getStoredSystemConfig(ctx context.Context, context string) (shared.SystemConfig, error) {
 	var systemConfig shared.SystemConfig
 	err := services.DbGetItem(ctx, shared.ConfigTable, shared.SystemConfig{
 		Context: context,
@@ -37,17 +145,34 @@ func GetSystemConfig(ctx context.Context, context string) (shared.SystemConfig,
 	return systemConfig, nil
 }
 
-func UpdateSystemConfig(ctx context.Context, systemConfig shared.SystemConfig) (shared.SystemConfig, error) {
+// UpdateSystemConfig sets the given fields of the config and removes the cleared attributes. Cleared settings
+// sections (config.<section>) are only removed when no section is set, the config is otherwise stored whole
+func UpdateSystemConfig(ctx context.Context, systemConfig shared.SystemConfig, cleared ...string) (shared.SystemConfig, error) {
 	var update expression.UpdateBuilder
 
+	systemConfig, err := withEncryptedSecrets(systemConfig)
+	if err != nil {
+		return shared.SystemConfig{}, err
+	}
+
 	// Check if any config field has values to update
-	hasConfigUpdate := systemConfig.Config.SlackSettings.WebhookURL != "" ||
-		systemConfig.Config.SlackSettings.Enabled != nil ||
-		systemConfig.Config.EmailSettings.FromAddress != "" ||
-		systemConfig.Config.EmailSettings.ReplyToAddress != "" ||
-		systemConfig.Config.EmailSettings.Enabled != nil ||
+	hasConfigUpdate := !systemConfig.Config.SlackSettings.IsEmpty() ||
+		!systemConfig.Config.EmailSettings.IsEmpty() ||
 		len(systemConfig.Config.InAppSettings.PlatformAppIDs) > 0 ||
-		systemConfig.Config.InAppSettings.Enabled != nil
+		systemConfig.Config.InAppSettings.Enabled != nil ||
+		!systemConfig.Config.SmsSettings.IsEmpty() ||
+		!systemConfig.Config.PushSettings.IsEmpty() ||
+		!systemConfig.Config.WebhookSettings.IsEmpty() ||
+		!systemConfig.Config.TeamsSettings.IsEmpty() ||
+		!systemConfig.Config.Calendar.IsEmpty() ||
+		!systemConfig.Config.Localization.IsEmpty() ||
+		!systemConfig.Config.EmailWarmUp.IsEmpty() ||
+		!systemConfig.Config.EnvironmentBanner.IsEmpty() ||
+		!systemConfig.Config.Retention.IsEmpty() ||
+		!systemConfig.Config.Processor.IsEmpty() ||
+		!systemConfig.Config.Fallback.IsEmpty() ||
+		!systemConfig.Config.Schedules.IsEmpty() ||
+		!systemConfig.Config.EmailBounces.IsEmpty()
 
 	if hasConfigUpdate {
 		update = update.Set(expression.Name(ColConfig), expression.Value(systemConfig.Config))
@@ -55,6 +180,12 @@ func UpdateSystemConfig(ctx context.Context, systemConfig shared.SystemConfig) (
 	if systemConfig.Description != "" {
 		update = update.Set(expression.Name(ColConfigDescription), expression.Value(systemConfig.Description))
 	}
+	for _, name := range cleared {
+		if hasConfigUpdate && strings.HasPrefix(name, ColConfig+".") {
+			continue
+		}
+		update = update.Remove(expression.Name(name))
+	}
 
 	update = update.Set(expression.Name(ColConfigUpdatedAt), expression.Value(shared.GetCurrentTime()))
 
@@ -75,34 +206,39 @@ func UpdateSystemConfig(ctx context.Context, systemConfig shared.SystemConfig) (
 	if err != nil {
 		return shared.SystemConfig{}, err
 	}
+	if err := decryptSecrets(&updatedSystemConfig); err != nil {
+		return shared.SystemConfig{}, err
+	}
 
 	return updatedSystemConfig, nil
 }
 
+// GetSystemConfigList returns a page of the configs, oldest first
 func GetSystemConfigList(ctx context.Context, limit int, startKey string) ([]shared.SystemConfig, string, error) {
-	var lastEvaluatedKey map[string]types.AttributeValue
-	var err error
-	if startKey != "" {
-		lastEvaluatedKey, err = attributevalue.MarshalMap(map[string]any{
-			ColConfigContext: startKey,
-		})
-		if err != nil {
-			return nil, "", err
-		}
-	}
-
 	var items []shared.SystemConfig
-	lastEvaluatedKey, err = services.DbScanItems(ctx, shared.ConfigTable, nil, nil, lastEvaluatedKey, limit, &items)
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.ConfigTable), limit, startKey, expression.ConditionBuilder{}, &items)
 	if err != nil {
 		return nil, "", err
 	}
+	return items, nextToken, nil
+}
 
-	var nextToken string
-	if lastEvaluatedKey != nil && lastEvaluatedKey[ColConfigContext] != nil {
-		nextToken = lastEvaluatedKey[ColConfigContext].(*types.AttributeValueMemberS).Value
+// GetAllSystemConfigs scans every config regardless of list order, including those stored before listing
+func GetAllSystemConfigs(ctx context.Context) ([]shared.SystemConfig, error) {
+	var all []shared.SystemConfig
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.SystemConfig
+		nextKey, err := services.DbScanItems(ctx, shared.ConfigTable, nil, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
 	}
-
-	return items, nextToken, nil
 }
 
 func DeleteSystemConfig(ctx context.Context, context string) error {
@@ -110,3 +246,72 @@ func DeleteSystemConfig(ctx context.Context, context string) error {
 		Context: context,
 	})
 }
+
+// processorSettingsCache keeps the processor's tuning knobs between requests, a change made through the
+// config API reaches warm processors within PROCESSOR_SETTINGS_TTL without a redeploy
+var processorSettingsCache = shared.NewTTLCache[shared.ProcessorSettings](shared.GetEnvDuration("PROCESSOR_SETTINGS_TTL", time.Minute))
+
+// GetProcessorSettings returns the global processor settings, the defaults when they cannot be read
+func GetProcessorSettings(ctx context.Context) shared.ProcessorSettings {
+	if settings, ok := processorSettingsCache.Get("*"); ok {
+		return settings
+	}
+
+	globalConfig, err := getStoredSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config, using default processor settings")
+		return shared.ProcessorSettings{}
+	}
+	var settings shared.ProcessorSettings
+	if globalConfig.Config != nil {
+		settings = globalConfig.Config.Processor
+	}
+	processorSettingsCache.Set("*", settings)
+	return settings
+}
+
+// fallbackSettingsCache keeps the global fallback policies between requests, a change made through the config
+// API is applied within FALLBACK_SETTINGS_TTL
+var fallbackSettingsCache = shared.NewTTLCache[shared.FallbackSettings](shared.GetEnvDuration("FALLBACK_SETTINGS_TTL", time.Minute))
+
+// GetFallbackSettings returns the global fallback policies, the defaults when they cannot be read
+func GetFallbackSettings(ctx context.Context) shared.FallbackSettings {
+	if settings, ok := fallbackSettingsCache.Get("*"); ok {
+		return settings
+	}
+
+	globalConfig, err := getStoredSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config, using default fallback settings")
+		return shared.FallbackSettings{}
+	}
+	var settings shared.FallbackSettings
+	if globalConfig.Config != nil {
+		settings = globalConfig.Config.Fallback
+	}
+	fallbackSettingsCache.Set("*", settings)
+	return settings
+}
+
+// scheduleSettingsCache keeps the global schedule limits between requests, a change made through the config
+// API is applied within SCHEDULE_SETTINGS_TTL
+var scheduleSettingsCache = shared.NewTTLCache[shared.ScheduleSettings](shared.GetEnvDuration("SCHEDULE_SETTINGS_TTL", time.Minute))
+
+// GetScheduleSettings returns the global schedule limits, the defaults when they cannot be read
+func GetScheduleSettings(ctx context.Context) shared.ScheduleSettings {
+	if settings, ok := scheduleSettingsCache.Get("*"); ok {
+		return settings
+	}
+
+	globalConfig, err := getStoredSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config, using default schedule settings")
+		return shared.ScheduleSettings{}
+	}
+	var settings shared.ScheduleSettings
+	if globalConfig.Config != nil {
+		settings = globalConfig.Config.Schedules
+	}
+	scheduleSettingsCache.Set("*", settings)
+	return settings
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+)
+
+var (
+	ColTeamID              = "teamId"
+	ColTeamName            = "name"
+	ColTeamMembers         = "members"
+	ColTeamPreferences     = "preferences"
+	ColTeamSlackWebhookURL = "slackWebhookUrl"
+	ColTeamPolicy          = "policy"
+	ColTeamRotationID      = "rotationId"
+	ColTeamUpdatedAt       = "updatedAt"
+)
+
+// CreateTeam stores a new team, its Slack webhook encrypted
+func CreateTeam(ctx context.Context, team shared.Team) error {
+	now := shared.GetCurrentTime()
+	team.CreatedAt = &now
+	team.UpdatedAt = &now
+
+	webhookURL, err := shared.EncryptSecret(team.SlackWebhookURL)
+	if err != nil {
+		return err
+	}
+	team.SlackWebhookURL = webhookURL
+
+	return services.DbPutListedItem(ctx, listedTable(shared.TeamsTable), team)
+}
+
+// GetTeam returns the team with its Slack webhook decrypted, an empty team when it does not exist
+func GetTeam(ctx context.Context, teamID string) (shared.Team, error) {
+	var team shared.Team
+	err := services.DbGetItem(ctx, shared.TeamsTable, shared.Team{
+		TeamID: teamID,
+	}, &team)
+	if err != nil {
+		return shared.Team{}, err
+	}
+	if team.SlackWebhookURL, err = shared.DecryptSecret(team.SlackWebhookURL); err != nil {
+		return shared.Team{}, err
+	}
+	return team, nil
+}
+
+func UpdateTeam(ctx context.Context, team shared.Team) (shared.Team, error) {
+	var update expression.UpdateBuilder
+
+	if team.Name != "" {
+		update = update.Set(expression.Name(ColTeamName), expression.Value(team.Name))
+	}
+	if team.Members != nil {
+		update = update.Set(expression.Name(ColTeamMembers), expression.Value(team.Members))
+	}
+	if team.Preferences != nil {
+		update = update.Set(expression.Name(ColTeamPreferences), expression.Value(team.Preferences))
+	}
+	if team.SlackWebhookURL != "" {
+		webhookURL, err := shared.EncryptSecret(team.SlackWebhookURL)
+		if err != nil {
+			return shared.Team{}, err
+		}
+		update = update.Set(expression.Name(ColTeamSlackWebhookURL), expression.Value(webhookURL))
+	}
+	if team.Policy != "" {
+		update = update.Set(expression.Name(ColTeamPolicy), expression.Value(team.Policy))
+	}
+	if team.RotationID != "" {
+		update = update.Set(expression.Name(ColTeamRotationID), expression.Value(team.RotationID))
+	}
+
+	update = update.Set(expression.Name(ColTeamUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.TeamsTable,
+		Update:    update,
+		Query: shared.Team{
+			TeamID: team.TeamID,
+		},
+		Condition: expression.Name(ColTeamID).Equal(expression.Value(team.TeamID)),
+	})
+	if err != nil {
+		return shared.Team{}, err
+	}
+
+	var updatedTeam shared.Team
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedTeam)
+	if err != nil {
+		return shared.Team{}, err
+	}
+	if updatedTeam.SlackWebhookURL, err = shared.DecryptSecret(updatedTeam.SlackWebhookURL); err != nil {
+		return shared.Team{}, err
+	}
+
+	return updatedTeam, nil
+}
+
+// GetTeamsList returns a page of the teams, oldest first, with their Slack webhooks decrypted
+func GetTeamsList(ctx context.Context, limit int, startKey string) ([]shared.Team, string, error) {
+	var items []shared.Team
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.TeamsTable), limit, startKey, expression.ConditionBuilder{}, &items)
+	if err != nil {
+		return nil, "", err
+	}
+	for i := range items {
+		if items[i].SlackWebhookURL, err = shared.DecryptSecret(items[i].SlackWebhookURL); err != nil {
+			return nil, "", err
+		}
+	}
+	return items, nextToken, nil
+}
+
+func DeleteTeam(ctx context.Context, teamID string) error {
+	return services.DbDeleteItem(ctx, shared.TeamsTable, shared.Team{
+		TeamID: teamID,
+	})
+}
@@ -17,16 +17,68 @@ var (
 	ColUpdatedAt   = "updatedAt"
 	ColContent     = "content"
 	ColIsActive    = "isActive"
+	ColCompiled    = "compiled"
+	ColTemporary   = "temporaryUntil"
+	ColSharedWith  = "sharedWith"
+	ColFormat      = "format"
+	ColTags        = "tags"
 )
 
+// withCompiledContent returns the template with its content compiled, unless the caller already compiled it.
+// Partials and templates including them are stored without a compiled form
+func withCompiledContent(template shared.Template) (shared.Template, error) {
+	if template.Content == "" || template.Compiled.IsCurrent() {
+		return template, nil
+	}
+	if !template.Precompiled() {
+		template.Compiled = nil
+		return template, nil
+	}
+	_, channel := shared.ParseTypeChannel(template.TypeChannel)
+	compiled, err := shared.CompileTemplate(channel, template.Content)
+	if err != nil {
+		return shared.Template{}, err
+	}
+	template.Compiled = compiled
+	return template, nil
+}
+
 func CreateTemplate(ctx context.Context, template shared.Template) error {
 	now := shared.GetCurrentTime()
 	template.CreatedAt = &now
 	template.UpdatedAt = &now
 
+	template, err := withCompiledContent(template)
+	if err != nil {
+		return err
+	}
+
 	return services.DbPutItem(ctx, shared.TemplatesTable, template)
 }
 
+// CreateTemplateIfNotExists stores the template unless one already exists for its context and type#channel.
+// It returns false when the template already existed
+func CreateTemplateIfNotExists(ctx context.Context, template shared.Template) (bool, error) {
+	now := shared.GetCurrentTime()
+	template.CreatedAt = &now
+	template.UpdatedAt = &now
+
+	template, err := withCompiledContent(template)
+	if err != nil {
+		return false, err
+	}
+
+	condition := expression.Name(ColContext).AttributeNotExists()
+	err = services.DbPutItemWithCondition(ctx, shared.TemplatesTable, template, condition)
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func GetTemplateByTypeChannel(ctx context.Context, context, typeChannel string) (shared.Template, error) {
 	var template shared.Template
 	err := services.DbGetItem(ctx, shared.TemplatesTable, shared.Template{
@@ -39,16 +91,48 @@ func GetTemplateByTypeChannel(ctx context.Context, context, typeChannel string)
 	return template, nil
 }
 
-func UpdateTemplate(ctx context.Context, template shared.Template) (shared.Template, error) {
+// UpdateTemplate sets the given fields of the template and removes the cleared attributes
+func UpdateTemplate(ctx context.Context, template shared.Template, cleared ...string) (shared.Template, error) {
 
 	var update expression.UpdateBuilder
 
+	template, err := withCompiledContent(template)
+	if err != nil {
+		return shared.Template{}, err
+	}
+
 	if template.Content != "" {
 		update = update.Set(expression.Name(ColContent), expression.Value(template.Content))
+		update = update.Set(expression.Name(ColCompiled), expression.Value(template.Compiled))
+	}
+	if template.Format != "" {
+		update = update.Set(expression.Name(ColFormat), expression.Value(template.Format))
 	}
 	if template.IsActive != nil {
 		update = update.Set(expression.Name(ColIsActive), expression.Value(template.IsActive))
 	}
+	if template.TemporaryUntil != nil {
+		update = update.Set(expression.Name(ColTemporary), expression.Value(template.TemporaryUntil))
+	}
+	if template.Tags != nil {
+		// An empty list removes the tags
+		if len(template.Tags) == 0 {
+			update = update.Remove(expression.Name(ColTags))
+		} else {
+			update = update.Set(expression.Name(ColTags), expression.Value(template.Tags))
+		}
+	}
+	if template.SharedWith != nil {
+		// An empty list stops sharing the template
+		if len(template.SharedWith) == 0 {
+			update = update.Remove(expression.Name(ColSharedWith))
+		} else {
+			update = update.Set(expression.Name(ColSharedWith), expression.Value(template.SharedWith))
+		}
+	}
+	for _, name := range cleared {
+		update = update.Remove(expression.Name(name))
+	}
 
 	update = update.Set(expression.Name(ColUpdatedAt), expression.Value(shared.GetCurrentTime()))
 
@@ -75,13 +159,34 @@ func UpdateTemplate(ctx context.Context, template shared.Template) (shared.Templ
 	return updatedTemplate, nil
 }
 
-func GetTemplatesList(ctx context.Context, context string, limit int, startKey string) ([]shared.Template, string, error) {
+// SaveCompiledTemplate stores the compiled form of a template without touching its content or updatedAt.
+// It is skipped when the content changed since the template was read
+func SaveCompiledTemplate(ctx context.Context, template shared.Template) error {
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.TemplatesTable,
+		Update:    expression.Set(expression.Name(ColCompiled), expression.Value(template.Compiled)),
+		Query: shared.Template{
+			Context:     template.Context,
+			TypeChannel: template.TypeChannel,
+		},
+		Condition: expression.Name(ColContent).Equal(expression.Value(template.Content)),
+	})
+	if services.IsConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// GetTemplatesList returns a page of the templates of a context, only those carrying every tag when tags are given
+func GetTemplatesList(ctx context.Context, context string, tags []string, limit int, startKey string) ([]shared.Template, string, error) {
 
 	keyCondition := expression.KeyEqual(expression.Key("context"), expression.Value(context))
 
-	expr, errExpressionBuilder := expression.NewBuilder().
-		WithKeyCondition(keyCondition).
-		Build()
+	builder := expression.NewBuilder().WithKeyCondition(keyCondition)
+	if filter := withTagsFilter(expression.ConditionBuilder{}, ColTags, tags); filter.IsSet() {
+		builder = builder.WithFilter(filter)
+	}
+	expr, errExpressionBuilder := builder.Build()
 	if errExpressionBuilder != nil {
 		return nil, "", errExpressionBuilder
 	}
@@ -111,9 +216,118 @@ func GetTemplatesList(ctx context.Context, context string, limit int, startKey s
 	return items, nextToken, nil
 }
 
+// GetAllTemplates scans every template across all contexts
+func GetAllTemplates(ctx context.Context) ([]shared.Template, error) {
+	filter := expression.Name(ColContext).NotEqual(expression.Value(TemplatesMetaContext))
+
+	var all []shared.Template
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.Template
+		nextKey, err := services.DbScanItems(ctx, shared.TemplatesTable, &filter, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
+}
+
+// GetSharedTemplates scans the templates shared with at least one user or team
+func GetSharedTemplates(ctx context.Context) ([]shared.Template, error) {
+	filter := expression.Name(ColSharedWith).AttributeExists()
+
+	var all []shared.Template
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.Template
+		nextKey, err := services.DbScanItems(ctx, shared.TemplatesTable, &filter, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
+}
+
 func DeleteTemplate(ctx context.Context, context, typeChannel string) error {
 	return services.DbDeleteItem(ctx, shared.TemplatesTable, shared.Template{
 		Context:     context,
 		TypeChannel: typeChannel,
 	})
 }
+
+// templatesVersion is a reserved item in the templates table whose counter is bumped on every
+// template change, letting processors invalidate their template cache with a single read
+type templatesVersion struct {
+	Context     string `dynamodbav:"context"`
+	TypeChannel string `dynamodbav:"type#channel"`
+	Version     int64  `dynamodbav:"version,omitempty"`
+}
+
+const (
+	TemplatesMetaContext = "#meta"
+	TemplatesVersionKey  = "version"
+	ColTemplatesVersion  = "version"
+)
+
+// GetTemplatesVersion returns the current templates version counter
+func GetTemplatesVersion(ctx context.Context) (int64, error) {
+	var version templatesVersion
+	err := services.DbGetItem(ctx, shared.TemplatesTable, templatesVersion{
+		Context:     TemplatesMetaContext,
+		TypeChannel: TemplatesVersionKey,
+	}, &version)
+	if err != nil {
+		return 0, err
+	}
+	return version.Version, nil
+}
+
+// BumpTemplatesVersion increments the templates version counter, creating it if needed
+func BumpTemplatesVersion(ctx context.Context) error {
+	_, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.TemplatesTable,
+		Update:    expression.Add(expression.Name(ColTemplatesVersion), expression.Value(1)),
+		Query: templatesVersion{
+			Context:     TemplatesMetaContext,
+			TypeChannel: TemplatesVersionKey,
+		},
+		Condition: expression.Name(ColContext).AttributeNotExists().
+			Or(expression.Name(ColContext).Equal(expression.Value(TemplatesMetaContext))),
+	})
+	return err
+}
+
+// typeVariables is a reserved item in the templates table holding the variables allowed for a notification
+// type. It predates variable schemas and is only read for types without one
+type typeVariables struct {
+	Context     string   `dynamodbav:"context"`
+	TypeChannel string   `dynamodbav:"type#channel"`
+	Variables   []string `dynamodbav:"variables"`
+}
+
+const TemplatesVariablesKeyPrefix = "variables#"
+
+// getLegacyTypeVariables returns the variables registered for the notification type with the templates,
+// nil when there is no entry
+func getLegacyTypeVariables(ctx context.Context, notificationType string) ([]string, error) {
+	var variables typeVariables
+	err := services.DbGetItem(ctx, shared.TemplatesTable, typeVariables{
+		Context:     TemplatesMetaContext,
+		TypeChannel: TemplatesVariablesKeyPrefix + notificationType,
+	}, &variables)
+	if err != nil {
+		return nil, err
+	}
+	if variables.TypeChannel == "" {
+		return nil, nil
+	}
+	return variables.Variables, nil
+}
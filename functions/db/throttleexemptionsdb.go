@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColExemptionID = "exemptionId"
+)
+
+// throttleExemptionKey is the primary key of the throttle exemptions table
+type throttleExemptionKey struct {
+	ExemptionID string `dynamodbav:"exemptionId"`
+}
+
+// CreateThrottleExemption stores an exemption. It reports false when its subject is already exempt
+func CreateThrottleExemption(ctx context.Context, exemption shared.ThrottleExemption) (bool, error) {
+	now := shared.GetCurrentTime()
+	exemption.CreatedAt = &now
+
+	err := services.DbPutItemWithCondition(ctx, shared.ThrottleExemptionsTable, exemption,
+		expression.Name(ColExemptionID).AttributeNotExists())
+	if services.IsConditionalCheckFailed(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetThrottleExemption gets an exemption, empty when there is none with the ID
+func GetThrottleExemption(ctx context.Context, exemptionID string) (shared.ThrottleExemption, error) {
+	var item shared.ThrottleExemption
+	err := services.DbGetItem(ctx, shared.ThrottleExemptionsTable, throttleExemptionKey{ExemptionID: exemptionID}, &item)
+	if err != nil {
+		return shared.ThrottleExemption{}, err
+	}
+	return item, nil
+}
+
+// GetThrottleExemptions returns every exemption
+func GetThrottleExemptions(ctx context.Context) ([]shared.ThrottleExemption, error) {
+	var exemptions []shared.ThrottleExemption
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var page []shared.ThrottleExemption
+		var err error
+		lastEvaluatedKey, err = services.DbScanItems(ctx, shared.ThrottleExemptionsTable, nil, nil, lastEvaluatedKey, 0, &page)
+		if err != nil {
+			return nil, err
+		}
+		exemptions = append(exemptions, page...)
+		if lastEvaluatedKey == nil {
+			return exemptions, nil
+		}
+	}
+}
+
+func DeleteThrottleExemption(ctx context.Context, exemptionID string) error {
+	return services.DbDeleteItem(ctx, shared.ThrottleExemptionsTable, throttleExemptionKey{ExemptionID: exemptionID})
+}
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+var (
+	ColUsageDate = "date"
+	ColUsageKey  = "usageKey"
+)
+
+// GetAPIUsage returns the usage counters of a day (YYYY-MM-DD), only the caller's when userID is set
+func GetAPIUsage(ctx context.Context, date, userID string) ([]shared.APIUsage, error) {
+	keyCondition := expression.Key(ColUsageDate).Equal(expression.Value(date))
+	if userID != "" {
+		keyCondition = keyCondition.And(expression.Key(ColUsageKey).BeginsWith(shared.BuildUsageKey(userID, "")))
+	}
+	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	var all []shared.APIUsage
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.APIUsage
+		nextKey, err := services.DbQuery(ctx, shared.UsageTable, "", 0, lastEvaluatedKey, expr, &items, nil)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
+	}
+}
@@ -5,41 +5,27 @@ import (
 	"notification-service/functions/services"
 	"notification-service/functions/shared"
 
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 )
 
 const (
-	ColUserID = "userId"
+	ColUserID         = "userId"
+	ColUserAttributes = "attributes"
+	ColUserPhone      = "phoneNumber"
+	ColUserCritical   = "criticalContact"
+	ColUserUpdatedAt  = "updatedAt"
 )
 
+// GetUsersList returns a page of the users ordered by user ID
 func GetUsersList(ctx context.Context, limit int, startKey string) ([]shared.User, string, error) {
-	// Handle pagination
-	var lastEvaluatedKey map[string]types.AttributeValue
-	if startKey != "" {
-		lastEvaluatedKey = map[string]types.AttributeValue{
-			ColUserID: &types.AttributeValueMemberS{
-				Value: startKey,
-			},
-		}
-	}
-
 	var users []shared.User
-	lastEvaluatedKey, err := services.DbScanItems(ctx, shared.UsersTable, nil, nil, lastEvaluatedKey, limit, &users)
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.UsersTable), limit, startKey, expression.ConditionBuilder{}, &users)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to scan users table")
+		shared.LogError(ctx).Err(err).Msg("Failed to list users")
 		return nil, "", err
 	}
-
-	var nextKey string
-	if lastEvaluatedKey != nil {
-		if userID, ok := lastEvaluatedKey[ColUserID]; ok {
-			if userIDVal, ok := userID.(*types.AttributeValueMemberS); ok {
-				nextKey = userIDVal.Value
-			}
-		}
-	}
-
-	return users, nextKey, nil
+	return users, nextToken, nil
 }
 
 func GetUserByID(ctx context.Context, userID string) (*shared.User, error) {
@@ -47,7 +33,7 @@ func GetUserByID(ctx context.Context, userID string) (*shared.User, error) {
 	var result shared.User
 	err := services.DbGetItem(ctx, shared.UsersTable, shared.User{UserID: userID}, &result)
 	if err != nil {
-		shared.LogError().Err(err).Str("userId", userID).Msg("Failed to get user")
+		shared.LogError(ctx).Err(err).Str("targetUserId", userID).Msg("Failed to get user")
 		return nil, err
 	}
 
@@ -57,3 +43,101 @@ func GetUserByID(ctx context.Context, userID string) (*shared.User, error) {
 
 	return &result, nil
 }
+
+// UpdateUser replaces the user's attributes and phone number. A nil value leaves the field unchanged,
+// an empty one removes it
+func UpdateUser(ctx context.Context, userID string, attributes map[string]string, phoneNumber *string) (shared.User, error) {
+	var update expression.UpdateBuilder
+	if attributes != nil && len(attributes) == 0 {
+		update = update.Remove(expression.Name(ColUserAttributes))
+	} else if attributes != nil {
+		update = update.Set(expression.Name(ColUserAttributes), expression.Value(attributes))
+	}
+	if phoneNumber != nil && *phoneNumber == "" {
+		update = update.Remove(expression.Name(ColUserPhone))
+	} else if phoneNumber != nil {
+		update = update.Set(expression.Name(ColUserPhone), expression.Value(*phoneNumber))
+	}
+	update = update.Set(expression.Name(ColUserUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.UsersTable,
+		Update:    update,
+		Query:     shared.User{UserID: userID},
+		Condition: expression.Name(ColUserID).Equal(expression.Value(userID)),
+	})
+	if err != nil {
+		return shared.User{}, err
+	}
+
+	var updatedUser shared.User
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedUser)
+	if err != nil {
+		return shared.User{}, err
+	}
+
+	return updatedUser, nil
+}
+
+// SetCriticalContact replaces the user's critical contact, nil removes it
+func SetCriticalContact(ctx context.Context, userID string, contact *shared.CriticalContact) (shared.User, error) {
+	var update expression.UpdateBuilder
+	if contact == nil {
+		update = update.Remove(expression.Name(ColUserCritical))
+	} else {
+		update = update.Set(expression.Name(ColUserCritical), expression.Value(contact))
+	}
+	update = update.Set(expression.Name(ColUserUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.UsersTable,
+		Update:    update,
+		Query:     shared.User{UserID: userID},
+		Condition: expression.Name(ColUserID).Equal(expression.Value(userID)),
+	})
+	if err != nil {
+		return shared.User{}, err
+	}
+
+	var user shared.User
+	if err := attributevalue.UnmarshalMap(out.Attributes, &user); err != nil {
+		return shared.User{}, err
+	}
+	return user, nil
+}
+
+// DeleteUserResources deletes the user's templates, scheduled notifications and preferences in a single
+// transaction. Deleting every schedule of the user also deletes their schedule quota counter, which is seeded
+// again from the schedules they hold on their next create. The caller keeps the items, the counter included,
+// under services.MaxTransactItems
+func DeleteUserResources(ctx context.Context, userID string, templates []shared.Template, schedules []shared.ScheduledNotification, preferences bool) error {
+	keys := make([]services.DbDeleteKey, 0, len(templates)+len(schedules)+2)
+	for _, template := range templates {
+		keys = append(keys, services.DbDeleteKey{
+			TableName: shared.TemplatesTable,
+			Key:       shared.Template{Context: template.Context, TypeChannel: template.TypeChannel},
+		})
+	}
+	for _, schedule := range schedules {
+		keys = append(keys, services.DbDeleteKey{
+			TableName: shared.SchedulesTable,
+			Key:       shared.ScheduledNotification{ScheduleID: schedule.ScheduleID},
+		})
+	}
+	if len(schedules) > 0 {
+		keys = append(keys, services.DbDeleteKey{
+			TableName: shared.DedupTable,
+			Key:       shared.DedupRecord{DedupKey: BuildScheduleQuotaKey(userID)},
+		})
+	}
+	if preferences {
+		keys = append(keys, services.DbDeleteKey{
+			TableName: shared.PreferencesTable,
+			Key:       shared.UserPreferences{Context: userID},
+		})
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	return services.DbTransactDeleteItems(ctx, keys)
+}
@@ -0,0 +1,207 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeDynamoDB serves DynamoDB calls from memory, with items kept in their wire format. Conditions are not
+// evaluated, except that an update of a missing item fails like the conditions of the counters do; updates
+// only support ADD of a number and queries only an equality key condition
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	keys  map[string][]string
+	items map[string][]map[string]any
+}
+
+// newFakeDynamoDB points the DynamoDB client at an empty fake for the duration of the test
+func newFakeDynamoDB(t *testing.T) *fakeDynamoDB {
+	t.Helper()
+	shared.DedupTable, shared.SchedulesTable, shared.TemplatesTable, shared.PreferencesTable = "dedup", "schedules", "templates", "preferences"
+	fake := &fakeDynamoDB{
+		keys: map[string][]string{
+			"dedup":       {"dedupKey"},
+			"schedules":   {"scheduleId"},
+			"templates":   {"context", "type#channel"},
+			"preferences": {"context"},
+		},
+		items: make(map[string][]map[string]any),
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	previous := shared.DynamoDBClient
+	shared.DynamoDBClient = dynamodb.New(dynamodb.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	t.Cleanup(func() { shared.DynamoDBClient = previous })
+	return fake
+}
+
+var (
+	addExpression   = regexp.MustCompile(`ADD (#\w+) (:\w+)`)
+	equalExpression = regexp.MustCompile(`(#\w+) = (:\w+)`)
+)
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TableName                 string
+		Key                       map[string]any
+		Item                      map[string]any
+		UpdateExpression          string
+		KeyConditionExpression    string
+		ExpressionAttributeNames  map[string]string
+		ExpressionAttributeValues map[string]any
+		TransactItems             []struct {
+			Delete struct {
+				TableName string
+				Key       map[string]any
+			}
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	output := map[string]any{}
+	switch operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."); operation {
+	case "GetItem":
+		if item := f.find(input.TableName, input.Key); item != nil {
+			output["Item"] = item
+		}
+	case "PutItem":
+		key := make(map[string]any)
+		for _, name := range f.keys[input.TableName] {
+			key[name] = input.Item[name]
+		}
+		f.delete(input.TableName, key)
+		f.items[input.TableName] = append(f.items[input.TableName], input.Item)
+	case "UpdateItem":
+		item := f.find(input.TableName, input.Key)
+		match := addExpression.FindStringSubmatch(input.UpdateExpression)
+		if item == nil || match == nil {
+			f.fail(w, "ConditionalCheckFailedException")
+			return
+		}
+		name := input.ExpressionAttributeNames[match[1]]
+		current, _ := strconv.Atoi(attributeNumber(item[name]))
+		delta, _ := strconv.Atoi(attributeNumber(input.ExpressionAttributeValues[match[2]]))
+		item[name] = map[string]any{"N": strconv.Itoa(current + delta)}
+		output["Attributes"] = item
+	case "Query":
+		match := equalExpression.FindStringSubmatch(input.KeyConditionExpression)
+		key := map[string]any{input.ExpressionAttributeNames[match[1]]: input.ExpressionAttributeValues[match[2]]}
+		items := []map[string]any{}
+		for _, item := range f.items[input.TableName] {
+			if matches(item, key) {
+				items = append(items, item)
+			}
+		}
+		output["Items"], output["Count"] = items, len(items)
+	case "TransactWriteItems":
+		for _, transactItem := range input.TransactItems {
+			f.delete(transactItem.Delete.TableName, transactItem.Delete.Key)
+		}
+	default:
+		f.fail(w, "UnknownOperationException")
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(output)
+}
+
+func (f *fakeDynamoDB) find(tableName string, key map[string]any) map[string]any {
+	for _, item := range f.items[tableName] {
+		if matches(item, key) {
+			return item
+		}
+	}
+	return nil
+}
+
+func (f *fakeDynamoDB) delete(tableName string, key map[string]any) {
+	f.items[tableName] = slices.DeleteFunc(f.items[tableName], func(item map[string]any) bool {
+		return matches(item, key)
+	})
+}
+
+func (f *fakeDynamoDB) fail(w http.ResponseWriter, errorType string) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#" + errorType, "message": errorType})
+}
+
+// matches reports whether the item has every attribute of the key
+func matches(item, key map[string]any) bool {
+	for name, value := range key {
+		if !reflect.DeepEqual(item[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeNumber returns the number of an attribute value in its wire format, "" when it is not one
+func attributeNumber(value any) string {
+	attribute, _ := value.(map[string]any)
+	number, _ := attribute["N"].(string)
+	return number
+}
+
+func TestDeleteUserResourcesResetsScheduleQuota(t *testing.T) {
+	newFakeDynamoDB(t)
+	ctx := context.Background()
+	schedules := []shared.ScheduledNotification{
+		{ScheduleID: "schedule-1", UserID: "user-1", Status: shared.StatusActive},
+		{ScheduleID: "schedule-2", UserID: "user-1", Status: shared.StatusPaused},
+	}
+	for _, schedule := range schedules {
+		if err := services.DbPutItem(ctx, shared.SchedulesTable, schedule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := services.DbPutItem(ctx, shared.DedupTable, shared.DedupRecord{DedupKey: BuildScheduleQuotaKey("user-1"), Count: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteUserResources(ctx, "user-1", nil, schedules, false); err != nil {
+		t.Fatalf("DeleteUserResources() error = %v", err)
+	}
+
+	count, err := GetDailyCount(ctx, BuildScheduleQuotaKey("user-1"))
+	if err != nil || count != 0 {
+		t.Fatalf("schedule quota counter after deletion = %d, %v, want 0", count, err)
+	}
+	if held, err := CountUserScheduledNotifications(ctx, "user-1"); err != nil || held != 0 {
+		t.Fatalf("schedules after deletion = %d, %v, want 0", held, err)
+	}
+
+	// With the limit the user held before, a new schedule fits again
+	count, ok, err := ClaimScheduleSlot(ctx, "user-1", 2)
+	if err != nil || !ok {
+		t.Fatalf("ClaimScheduleSlot() = %d, %v, %v, want a slot", count, ok, err)
+	}
+	if count, err := GetDailyCount(ctx, BuildScheduleQuotaKey("user-1")); err != nil || count != 1 {
+		t.Fatalf("schedule quota counter after a claim = %d, %v, want 1", count, err)
+	}
+}
@@ -15,6 +15,11 @@ var (
 	ColPreferences          = "preferences"
 	ColTimezone             = "timezone"
 	ColLanguage             = "language"
+	ColDigestTime           = "digestTime"
+	ColMissedSummary        = "missedSummary"
+	ColDailyCaps            = "dailyCaps"
+	ColConsent              = "consent"
+	ColOverrides            = "overrides"
 	ColPreferencesUpdatedAt = "updatedAt"
 )
 
@@ -23,7 +28,7 @@ func CreateUserPreferences(ctx context.Context, userPreferences shared.UserPrefe
 	userPreferences.CreatedAt = &now
 	userPreferences.UpdatedAt = &now
 
-	return services.DbPutItem(ctx, shared.PreferencesTable, userPreferences)
+	return services.DbPutListedItem(ctx, listedTable(shared.PreferencesTable), userPreferences)
 }
 
 func GetUserPreferences(ctx context.Context, context string) (shared.UserPreferences, error) {
@@ -37,7 +42,8 @@ func GetUserPreferences(ctx context.Context, context string) (shared.UserPrefere
 	return userPreferences, nil
 }
 
-func UpdateUserPreferences(ctx context.Context, userPreferences shared.UserPreferences) (shared.UserPreferences, error) {
+// UpdateUserPreferences sets the given fields of the preferences and removes the cleared attributes
+func UpdateUserPreferences(ctx context.Context, userPreferences shared.UserPreferences, cleared ...string) (shared.UserPreferences, error) {
 	var update expression.UpdateBuilder
 
 	if userPreferences.Preferences != nil {
@@ -49,6 +55,27 @@ func UpdateUserPreferences(ctx context.Context, userPreferences shared.UserPrefe
 	if userPreferences.Language != "" {
 		update = update.Set(expression.Name(ColLanguage), expression.Value(userPreferences.Language))
 	}
+	if userPreferences.DigestTime != "" {
+		update = update.Set(expression.Name(ColDigestTime), expression.Value(userPreferences.DigestTime))
+	}
+	if userPreferences.MissedSummary != nil {
+		update = update.Set(expression.Name(ColMissedSummary), expression.Value(userPreferences.MissedSummary))
+	}
+	if userPreferences.DailyCaps != nil {
+		// An empty map removes every cap
+		if len(userPreferences.DailyCaps) == 0 {
+			update = update.Remove(expression.Name(ColDailyCaps))
+		} else {
+			update = update.Set(expression.Name(ColDailyCaps), expression.Value(userPreferences.DailyCaps))
+		}
+	}
+
+	if userPreferences.Consent != nil {
+		update = update.Set(expression.Name(ColConsent), expression.Value(userPreferences.Consent))
+	}
+	for _, name := range cleared {
+		update = update.Remove(expression.Name(name))
+	}
 
 	update = update.Set(expression.Name(ColPreferencesUpdatedAt), expression.Value(shared.GetCurrentTime()))
 
@@ -73,30 +100,32 @@ func UpdateUserPreferences(ctx context.Context, userPreferences shared.UserPrefe
 	return updatedUserPreferences, nil
 }
 
+// GetUserPreferencesList returns a page of the preference sets, oldest first
 func GetUserPreferencesList(ctx context.Context, limit int, startKey string) ([]shared.UserPreferences, string, error) {
-	var lastEvaluatedKey map[string]types.AttributeValue
-	var err error
-	if startKey != "" {
-		lastEvaluatedKey, err = attributevalue.MarshalMap(map[string]any{
-			ColPreferencesContext: startKey,
-		})
-		if err != nil {
-			return nil, "", err
-		}
-	}
-
 	var items []shared.UserPreferences
-	lastEvaluatedKey, err = services.DbScanItems(ctx, shared.PreferencesTable, nil, nil, lastEvaluatedKey, limit, &items)
+	nextToken, err := services.DbQueryList(ctx, listedTable(shared.PreferencesTable), limit, startKey, expression.ConditionBuilder{}, &items)
 	if err != nil {
 		return nil, "", err
 	}
+	return items, nextToken, nil
+}
 
-	var nextToken string
-	if lastEvaluatedKey != nil && lastEvaluatedKey[ColPreferencesContext] != nil {
-		nextToken = lastEvaluatedKey[ColPreferencesContext].(*types.AttributeValueMemberS).Value
+// GetAllUserPreferences scans every preference set regardless of list order, including those stored before listing
+func GetAllUserPreferences(ctx context.Context) ([]shared.UserPreferences, error) {
+	var all []shared.UserPreferences
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var items []shared.UserPreferences
+		nextKey, err := services.DbScanItems(ctx, shared.PreferencesTable, nil, nil, lastEvaluatedKey, 0, &items)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if nextKey == nil {
+			return all, nil
+		}
+		lastEvaluatedKey = nextKey
 	}
-
-	return items, nextToken, nil
 }
 
 func DeleteUserPreferences(ctx context.Context, context string) error {
@@ -104,3 +133,62 @@ func DeleteUserPreferences(ctx context.Context, context string) error {
 		Context: context,
 	})
 }
+
+// SetPreferenceOverrides replaces the overrides of a preference set, removing them when empty. It fails
+// with a conditional check failure when the stored overrides are no longer previous
+func SetPreferenceOverrides(ctx context.Context, context string, overrides, previous []shared.PreferenceOverride) (shared.UserPreferences, error) {
+	var update expression.UpdateBuilder
+	if len(overrides) == 0 {
+		update = update.Remove(expression.Name(ColOverrides))
+	} else {
+		update = update.Set(expression.Name(ColOverrides), expression.Value(overrides))
+	}
+	update = update.Set(expression.Name(ColPreferencesUpdatedAt), expression.Value(shared.GetCurrentTime()))
+
+	condition := expression.Name(ColPreferencesContext).Equal(expression.Value(context))
+	if len(previous) == 0 {
+		condition = condition.And(expression.Name(ColOverrides).AttributeNotExists())
+	} else {
+		condition = condition.And(expression.Name(ColOverrides).Equal(expression.Value(previous)))
+	}
+
+	out, err := services.DbUpdateItem(ctx, services.DbUpdateItemInput{
+		TableName: shared.PreferencesTable,
+		Update:    update,
+		Query: shared.UserPreferences{
+			Context: context,
+		},
+		Condition: condition,
+	})
+	if err != nil {
+		return shared.UserPreferences{}, err
+	}
+
+	var updatedUserPreferences shared.UserPreferences
+	err = attributevalue.UnmarshalMap(out.Attributes, &updatedUserPreferences)
+	if err != nil {
+		return shared.UserPreferences{}, err
+	}
+
+	return updatedUserPreferences, nil
+}
+
+// GetPreferencesWithOverrides returns every preference set that has overrides, expired or not
+func GetPreferencesWithOverrides(ctx context.Context) ([]shared.UserPreferences, error) {
+	filter := expression.Name(ColOverrides).AttributeExists()
+
+	var preferences []shared.UserPreferences
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var page []shared.UserPreferences
+		var err error
+		lastEvaluatedKey, err = services.DbScanItems(ctx, shared.PreferencesTable, &filter, nil, lastEvaluatedKey, 0, &page)
+		if err != nil {
+			return nil, err
+		}
+		preferences = append(preferences, page...)
+		if lastEvaluatedKey == nil {
+			return preferences, nil
+		}
+	}
+}
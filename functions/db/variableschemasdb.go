@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// variableSchemaKey is the primary key of the variable schemas table
+type variableSchemaKey struct {
+	Type string `dynamodbav:"type"`
+}
+
+// GetVariableSchema returns the variable schema of a notification type. Types without a stored schema fall
+// back to the variables registered with the templates, then to the built-in defaults, every variable
+// optional and untyped. Only stored schemas have CreatedAt set
+func GetVariableSchema(ctx context.Context, notificationType string) (shared.VariableSchema, error) {
+	var schema shared.VariableSchema
+	err := services.DbGetItem(ctx, shared.VariableSchemasTable, variableSchemaKey{Type: notificationType}, &schema)
+	if err != nil {
+		return shared.VariableSchema{}, err
+	}
+	if schema.Type != "" {
+		return schema, nil
+	}
+
+	legacy, err := getLegacyTypeVariables(ctx, notificationType)
+	if err != nil {
+		return shared.VariableSchema{}, err
+	}
+	if legacy == nil {
+		return shared.DefaultVariableSchema(notificationType), nil
+	}
+	schema = shared.VariableSchema{Type: notificationType}
+	for _, name := range legacy {
+		schema.Variables = append(schema.Variables, shared.VariableDefinition{Name: name})
+	}
+	return schema, nil
+}
+
+// GetTypeVariables returns the names of the variables declared for the notification type. It returns nil for
+// types that declare none
+func GetTypeVariables(ctx context.Context, notificationType string) ([]string, error) {
+	schema, err := GetVariableSchema(ctx, notificationType)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Variables) == 0 {
+		return nil, nil
+	}
+	return schema.Names(), nil
+}
+
+// PutVariableSchema stores the variable schema of a notification type, replacing the previous one
+func PutVariableSchema(ctx context.Context, schema shared.VariableSchema) (shared.VariableSchema, error) {
+	now := shared.GetCurrentTime()
+	if schema.CreatedAt == nil {
+		schema.CreatedAt = &now
+	}
+	schema.UpdatedAt = &now
+
+	if err := services.DbPutItem(ctx, shared.VariableSchemasTable, schema); err != nil {
+		return shared.VariableSchema{}, err
+	}
+	return schema, nil
+}
+
+// GetVariableSchemas returns every stored variable schema
+func GetVariableSchemas(ctx context.Context) ([]shared.VariableSchema, error) {
+	var schemas []shared.VariableSchema
+	var lastEvaluatedKey map[string]types.AttributeValue
+	for {
+		var page []shared.VariableSchema
+		var err error
+		lastEvaluatedKey, err = services.DbScanItems(ctx, shared.VariableSchemasTable, nil, nil, lastEvaluatedKey, 0, &page)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, page...)
+		if lastEvaluatedKey == nil {
+			return schemas, nil
+		}
+	}
+}
+
+// DeleteVariableSchema removes the stored schema of a notification type, which falls back to its defaults
+func DeleteVariableSchema(ctx context.Context, notificationType string) error {
+	return services.DbDeleteItem(ctx, shared.VariableSchemasTable, variableSchemaKey{Type: notificationType})
+}
@@ -0,0 +1,408 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"strings"
+)
+
+// Delivery identifies what a channel delivered. Each channel sets the fields it reports
+type Delivery struct {
+	Provider          string // Email provider the email went through
+	Recipient         string // Email address or phone number delivered to, the recipient's ID for push and in-app
+	Devices           int    // Push devices delivered to
+	ProviderMessageID string // e.g. the SES or SNS message ID
+	EmailMessageID    string // Message-ID header of the email
+	ThreadMessageID   string // Message-ID of the thread's original email, empty when the email started or has no thread
+	ResponseStatus    int    // HTTP status of the webhook endpoint
+	ResponseBody      string // Truncated response of the webhook endpoint
+}
+
+// Deliver sends content rendered for a channel to the recipient. Critical contact deliveries take the rendered
+// email content. Only the provider calls run behind their channel's timeout and circuit breaker, recipient
+// problems do not trip them
+func (e *Engine) Deliver(ctx context.Context, recipient Recipient, request shared.NotificationRequest, channel, content string) (Delivery, error) {
+	var delivery Delivery
+	var err error
+	switch channel {
+	case shared.ChannelEmail:
+		delivery, err = sendEmail(ctx, recipient.ID, request, content, recipient.Config)
+	case shared.ChannelSlack:
+		err = sendSlack(ctx, recipient, request.Type, content)
+	case shared.ChannelInApp:
+		delivery.Recipient = recipient.ID
+		err = deliverToInbox(ctx, recipient.ID, request, content)
+	case shared.ChannelSMS:
+		delivery, err = sendSMS(ctx, recipient.ID, content, recipient.Config)
+	case shared.ChannelPush:
+		delivery, err = sendPush(ctx, recipient.ID, request.Type, content, recipient.Config)
+	case shared.ChannelWebhook:
+		var response shared.WebhookResponse
+		response, err = sendWebhook(ctx, recipient.ID, request, content, recipient.Config)
+		delivery.ResponseStatus, delivery.ResponseBody = response.StatusCode, response.Body
+	case shared.ChannelTeams:
+		err = sendTeams(ctx, recipient.ID, content, recipient.Config)
+	case shared.ChannelCriticalContact:
+		delivery.ProviderMessageID, err = sendToCriticalContact(ctx, recipient.ID, request, content, recipient.Config)
+	default:
+		err = fmt.Errorf("unsupported channel: %s", channel)
+	}
+	return delivery, err
+}
+
+// resolveEmailSettings returns the effective email settings. Only a recipient's config with its own email
+// provider sets from and reply-to addresses, missing ones and the provider are taken from the global config
+func resolveEmailSettings(ctx context.Context, config shared.SystemConfig) shared.EmailSettings {
+	var settings shared.EmailSettings
+	if config.Config != nil {
+		settings = config.Config.EmailSettings
+	}
+	if settings.NeedsGlobalDefaults() {
+		settings = settings.WithGlobalDefaults(GlobalSettings(ctx, config).EmailSettings)
+	}
+	return settings
+}
+
+// callEmailProvider runs fn behind the email channel's timeout and circuit breaker. A recipient's own provider
+// gets a breaker of its own, so one tenant's provider outage does not stop everyone else's email
+func callEmailProvider(ctx context.Context, provider services.EmailProvider, config shared.SystemConfig, fn func(ctx context.Context) error) error {
+	if config.Context != "*" && config.Config != nil && config.Config.EmailSettings.HasOwnProvider() {
+		return shared.CallChannelEndpoint(ctx, shared.ChannelEmail, provider.Name()+"#"+config.Context, fn)
+	}
+	return shared.CallChannel(ctx, shared.ChannelEmail, fn)
+}
+
+// sendEmail sends rendered email content to the recipient's address through the effective email provider. An email
+// of a request with a correlation key replies to the first email the recipient got for the key, so email clients
+// thread them
+func sendEmail(ctx context.Context, recipientID string, request shared.NotificationRequest, content string, config shared.SystemConfig) (Delivery, error) {
+	email, err := shared.ParseEmailContent(content)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("invalid processed email template: %w", err)
+	}
+
+	user, err := db.GetUserByID(ctx, recipientID)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if user == nil || user.Email == "" {
+		return Delivery{}, fmt.Errorf("recipient %s has no email address", recipientID)
+	}
+
+	settings := resolveEmailSettings(ctx, config)
+	fromAddress := settings.FromAddressFor(request.Type)
+	if fromAddress == "" {
+		return Delivery{}, fmt.Errorf("no email from address configured")
+	}
+
+	provider, err := services.NewEmailProvider(settings)
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	prefix, banner := environmentBanner(ctx, config)
+	htmlBody, textBody := email.Bodies()
+	message := services.Email{
+		From:      fromAddress,
+		To:        user.Email,
+		ReplyTo:   settings.ReplyToAddress,
+		Subject:   shared.ApplySubjectPrefix(prefix, email.Subject),
+		HTMLBody:  shared.ApplyPreheader(email.Preheader, shared.ApplyHTMLBanner(banner, htmlBody)),
+		TextBody:  shared.ApplyTextBanner(banner, textBody),
+		Headers:   email.Headers,
+		MessageID: shared.NewEmailMessageID(fromAddress),
+	}
+
+	// Threading is best effort, an email whose thread cannot be read is sent on its own
+	var threadKey string
+	sent := Delivery{Provider: provider.Name(), Recipient: user.Email}
+	if request.CorrelationKey != "" {
+		threadKey = db.BuildEmailThreadKey(recipientID, request.CorrelationKey)
+		sent.ThreadMessageID, err = db.GetEmailThread(ctx, threadKey)
+		if err != nil {
+			shared.LogWarn(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to get email thread, sending unthreaded")
+			threadKey = ""
+		}
+	}
+	if sent.ThreadMessageID != "" {
+		message.InReplyTo = sent.ThreadMessageID
+		message.References = []string{sent.ThreadMessageID}
+	}
+
+	err = callEmailProvider(ctx, provider, config, func(ctx context.Context) error {
+		var sendErr error
+		sent.ProviderMessageID, sendErr = provider.Send(ctx, message)
+		return sendErr
+	})
+	if err != nil {
+		return Delivery{Provider: sent.Provider, Recipient: sent.Recipient}, err
+	}
+	sent.EmailMessageID = provider.MessageIDHeader(message, sent.ProviderMessageID)
+
+	if threadKey != "" && sent.ThreadMessageID == "" && sent.EmailMessageID != "" {
+		if _, err := db.StartEmailThread(ctx, threadKey, sent.EmailMessageID, shared.EmailThreadWindow()); err != nil {
+			shared.LogWarn(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to start email thread")
+		}
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("messageId", sent.ProviderMessageID).Str("threadMessageId", sent.ThreadMessageID).Msg("Email sent")
+	return sent, nil
+}
+
+// sendToCriticalContact sends rendered email content to the recipient's verified critical contact and returns
+// the provider's message ID
+func sendToCriticalContact(ctx context.Context, recipientID string, request shared.NotificationRequest, content string, config shared.SystemConfig) (string, error) {
+	user, err := db.GetUserByID(ctx, recipientID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if user == nil || user.CriticalContact == nil || !user.CriticalContact.Verified {
+		return "", fmt.Errorf("recipient %s has no verified critical contact", recipientID)
+	}
+	contact := *user.CriticalContact
+
+	email, err := shared.ParseEmailContent(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid processed email template: %w", err)
+	}
+
+	emailSettings := resolveEmailSettings(ctx, config)
+	fromAddress := emailSettings.FromAddressFor(request.Type)
+	provider, err := services.NewEmailProvider(emailSettings)
+	if err != nil && contact.Type == shared.CriticalContactEmail {
+		return "", err
+	}
+	prefix, banner := environmentBanner(ctx, config)
+	htmlBody, textBody := email.Bodies()
+	subject := shared.ApplySubjectPrefix(prefix, email.Subject)
+	senderID := resolveSmsSettings(ctx, config).SenderID
+	messageID, err := services.SendToCriticalContact(ctx, contact, provider, fromAddress, senderID, subject,
+		shared.ApplyPreheader(email.Preheader, shared.ApplyHTMLBanner(banner, htmlBody)), shared.ApplyTextBanner(banner, textBody))
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("contactType", contact.Type).Msg("Failed to deliver to critical contact")
+		return "", err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("contactType", contact.Type).Msg("Critical alert delivered to critical contact")
+	return messageID, nil
+}
+
+// sendSlack posts rendered Slack content to the recipient's webhook: a team notified as a unit uses its shared
+// channel's webhook, everyone else the effective config's webhook for the notification type
+func sendSlack(ctx context.Context, recipient Recipient, notificationType, content string) error {
+	webhookURL := recipient.Config.Config.SlackSettings.WebhookURLFor(notificationType)
+	if recipient.IsTeamUnit() {
+		webhookURL = recipient.Team.SlackWebhookURL
+	}
+	if webhookURL == "" {
+		return fmt.Errorf("no Slack webhook configured")
+	}
+	// Webhooks stored before they were validated are checked before anything is posted to them
+	if err := shared.ValidateSlackWebhookURL(webhookURL); err != nil {
+		return fmt.Errorf("invalid Slack webhook: %w", err)
+	}
+	prefix, _ := environmentBanner(ctx, recipient.Config)
+	content = shared.ApplySubjectPrefix(prefix, content)
+
+	err := shared.CallChannel(ctx, shared.ChannelSlack, func(ctx context.Context) error {
+		return shared.PostSlackMessageWithRetry(ctx, webhookURL, content)
+	})
+	if err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipient.ID).Msg("Slack message sent")
+	return nil
+}
+
+// sendTeams posts rendered Teams content to the effective config's webhook as an Adaptive Card
+func sendTeams(ctx context.Context, recipientID, content string, config shared.SystemConfig) error {
+	webhookURL := config.Config.TeamsSettings.WebhookURL
+	if webhookURL == "" {
+		return fmt.Errorf("no Teams webhook configured")
+	}
+	message := shared.ParseTeamsMessage(content)
+	prefix, _ := environmentBanner(ctx, config)
+	if message.Title != "" {
+		message.Title = shared.ApplySubjectPrefix(prefix, message.Title)
+	} else {
+		message.Text = shared.ApplySubjectPrefix(prefix, message.Text)
+	}
+	payload, err := shared.BuildTeamsCard(message)
+	if err != nil {
+		return fmt.Errorf("failed to build Teams card: %w", err)
+	}
+
+	err = shared.CallChannel(ctx, shared.ChannelTeams, func(ctx context.Context) error {
+		return shared.PostTeamsMessageWithRetry(ctx, webhookURL, payload)
+	})
+	if err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("Teams message sent")
+	return nil
+}
+
+// resolveSmsSettings returns the effective SMS settings, taking the sender ID from the global config
+// when the recipient's config has none
+func resolveSmsSettings(ctx context.Context, config shared.SystemConfig) shared.SmsSettings {
+	var settings shared.SmsSettings
+	if config.Config != nil {
+		settings = config.Config.SmsSettings
+	}
+	if settings.SenderID == "" {
+		settings.SenderID = GlobalSettings(ctx, config).SmsSettings.SenderID
+	}
+	return settings
+}
+
+// sendSMS sends rendered SMS content to the phone number on the recipient's user record through SNS and
+// returns the SNS message ID
+func sendSMS(ctx context.Context, recipientID, content string, config shared.SystemConfig) (Delivery, error) {
+	user, err := db.GetUserByID(ctx, recipientID)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to get recipient: %w", err)
+	}
+	if user == nil || user.PhoneNumber == "" {
+		return Delivery{}, fmt.Errorf("recipient %s has no phone number", recipientID)
+	}
+
+	senderID := resolveSmsSettings(ctx, config).SenderID
+	prefix, _ := environmentBanner(ctx, config)
+	message := shared.ApplySubjectPrefix(prefix, content)
+
+	sent := Delivery{Recipient: user.PhoneNumber}
+	err = shared.CallChannel(ctx, shared.ChannelSMS, func(ctx context.Context) error {
+		var sendErr error
+		sent.ProviderMessageID, sendErr = services.SnsSendSMS(ctx, user.PhoneNumber, senderID, message)
+		return sendErr
+	})
+	if err != nil {
+		return Delivery{Recipient: sent.Recipient}, err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("messageId", sent.ProviderMessageID).Msg("SMS sent")
+	return sent, nil
+}
+
+// sendPush fans rendered push content out to every device the recipient registered and returns the SNS
+// message ID of the first delivery and the number of devices delivered to. Devices whose token the platform
+// no longer accepts are unregistered. The push fails when no device received it
+func sendPush(ctx context.Context, recipientID, notificationType, content string, config shared.SystemConfig) (Delivery, error) {
+	devices, err := db.GetDeviceTokens(ctx, recipientID)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to get devices: %w", err)
+	}
+	if len(devices) == 0 {
+		return Delivery{}, fmt.Errorf("recipient %s has no registered devices", recipientID)
+	}
+
+	prefix, _ := environmentBanner(ctx, config)
+	title := shared.ApplySubjectPrefix(prefix, strings.ToUpper(notificationType[:1])+notificationType[1:])
+	message, err := shared.BuildPushMessage(title, content)
+	if err != nil {
+		return Delivery{}, fmt.Errorf("failed to build push message: %w", err)
+	}
+
+	var messageID string
+	delivered := 0
+	err = shared.CallChannel(ctx, shared.ChannelPush, func(ctx context.Context) error {
+		var lastErr error
+		for _, device := range devices {
+			id, publishErr := services.SnsPublishToEndpoint(ctx, device.EndpointARN, message)
+			if services.IsStaleEndpoint(publishErr) {
+				removeStaleDevice(ctx, device)
+				continue
+			}
+			if publishErr != nil {
+				shared.LogWarn(ctx).Err(publishErr).Str("recipientId", recipientID).Str("deviceId", device.DeviceID).Msg("Failed to push to device")
+				lastErr = publishErr
+				continue
+			}
+			if messageID == "" {
+				messageID = id
+			}
+			delivered++
+		}
+		if delivered > 0 {
+			return nil
+		}
+		if lastErr != nil {
+			return lastErr
+		}
+		return fmt.Errorf("no device of recipient %s accepts push notifications", recipientID)
+	})
+	if err != nil {
+		return Delivery{Recipient: recipientID}, err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Int("devices", len(devices)).Int("delivered", delivered).Str("messageId", messageID).Msg("Push sent")
+	return Delivery{Recipient: recipientID, Devices: delivered, ProviderMessageID: messageID}, nil
+}
+
+// removeStaleDevice unregisters a device whose token the push platform rejected, so it is not tried again
+func removeStaleDevice(ctx context.Context, device shared.DeviceToken) {
+	shared.LogInfo(ctx).Str("recipientId", device.UserID).Str("deviceId", device.DeviceID).Msg("Removing stale push device")
+	if err := services.SnsDeleteEndpoint(ctx, device.EndpointARN); err != nil {
+		shared.LogError(ctx).Err(err).Str("deviceId", device.DeviceID).Msg("Failed to delete stale platform endpoint")
+	}
+	if err := db.DeleteDeviceToken(ctx, device.UserID, device.DeviceID); err != nil {
+		shared.LogError(ctx).Err(err).Str("deviceId", device.DeviceID).Msg("Failed to delete stale device")
+	}
+}
+
+// sendWebhook posts rendered webhook content to the recipient's endpoint for the notification type, signed with
+// its secret, and returns the endpoint's response. The post runs behind the endpoint's circuit breaker
+func sendWebhook(ctx context.Context, recipientID string, request shared.NotificationRequest, content string, config shared.SystemConfig) (shared.WebhookResponse, error) {
+	endpoint := config.Config.WebhookSettings.EndpointFor(request.Type)
+	if endpoint.URL == "" || endpoint.Secret == "" {
+		return shared.WebhookResponse{}, fmt.Errorf("no webhook configured")
+	}
+	prefix, _ := environmentBanner(ctx, config)
+
+	body, err := json.Marshal(shared.WebhookPayload{
+		ID:          request.ID,
+		Type:        request.Type,
+		RecipientID: recipientID,
+		Content:     shared.ApplySubjectPrefix(prefix, content),
+		Test:        request.Test,
+		SentAt:      shared.GetCurrentTime(),
+	})
+	if err != nil {
+		return shared.WebhookResponse{}, fmt.Errorf("failed to build webhook payload: %w", err)
+	}
+
+	var response shared.WebhookResponse
+	err = shared.CallChannelEndpoint(ctx, shared.ChannelWebhook, shared.WebhookEndpoint(endpoint.URL), func(ctx context.Context) error {
+		var postErr error
+		response, postErr = shared.PostWebhookWithRetry(ctx, endpoint, request.ID, body)
+		return postErr
+	})
+	if err != nil {
+		return response, err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Int("status", response.StatusCode).Msg("Webhook delivered")
+	return response, nil
+}
+
+// deliverToInbox stores rendered in-app content in the recipient's inbox, keyed by the request ID
+func deliverToInbox(ctx context.Context, recipientID string, request shared.NotificationRequest, content string) error {
+	err := db.CreateInboxItem(ctx, shared.InboxItem{
+		UserID:         recipientID,
+		NotificationID: request.ID,
+		Type:           request.Type,
+		Content:        content,
+	})
+	if err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("In-app notification added to inbox")
+	return nil
+}
@@ -0,0 +1,42 @@
+package engine
+
+import (
+	"fmt"
+	"notification-service/functions/shared"
+	"strings"
+)
+
+// BuildDigest fills a digest request with a summary of the notifications held for its recipient and returns
+// the held items it summarizes. Overflow digests only take the items held for their channel, daily digests
+// the items held without one
+func BuildDigest(request *shared.NotificationRequest, held []shared.DigestItem) ([]shared.DigestItem, error) {
+	if len(request.Recipients) != 1 {
+		return nil, fmt.Errorf("digest request must have exactly one recipient, got %d", len(request.Recipients))
+	}
+	if request.Overflow && len(request.Channels) != 1 {
+		return nil, fmt.Errorf("overflow digest request must have exactly one channel, got %d", len(request.Channels))
+	}
+
+	var items []shared.DigestItem
+	for _, item := range held {
+		if (request.Overflow && item.Channel == request.Channels[0]) || (!request.Overflow && item.Channel == "") {
+			items = append(items, item)
+		}
+	}
+
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, shared.SummarizeNotification(item.Type, item.Variables))
+	}
+
+	title := fmt.Sprintf("Your daily digest (%d)", len(items))
+	if request.Overflow {
+		title = fmt.Sprintf("Held after your daily limit (%d)", len(items))
+	}
+	request.Variables = map[string]any{
+		"title":     title,
+		"message":   strings.Join(lines, "\n"),
+		"actionUrl": "",
+	}
+	return items, nil
+}
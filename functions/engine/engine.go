@@ -0,0 +1,287 @@
+// Package engine is the notification pipeline for a single recipient: resolving the preferences and config a
+// notification is decided with, rendering its templates for each channel and delivering the rendered content.
+// The processor runs it for every recipient of a request, anything that previews or sends a notification reuses it
+package engine
+
+import (
+	"context"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"slices"
+	"time"
+)
+
+// Engine resolves, renders and delivers notifications. It caches the global preferences and templates,
+// a process should share one Engine
+type Engine struct {
+	// globalPreferences holds the global preferences merged under every recipient's, empty when there are none
+	globalPreferences *shared.TTLCache[shared.UserPreferences]
+	templates         *templateCache
+}
+
+// New returns an Engine with empty caches
+func New() *Engine {
+	return &Engine{
+		globalPreferences: shared.NewTTLCache[shared.UserPreferences](shared.GetEnvDuration("GLOBAL_PREFERENCES_CACHE_TTL", time.Minute)),
+		templates:         newTemplateCache(),
+	}
+}
+
+// Recipient is a resolved recipient: the preferences and config its notifications are decided with and the
+// languages its templates are looked up in
+type Recipient struct {
+	ID          string
+	Team        *shared.Team // set when the recipient was resolved from a team
+	Preferences shared.UserPreferences
+	Config      shared.SystemConfig
+	Languages   []string // most specific first
+}
+
+// IsTeamUnit reports whether the recipient is a team notified as a unit
+func (r Recipient) IsTeamUnit() bool {
+	return r.Team != nil && r.ID == shared.RecipientPrefixTeam+r.Team.TeamID
+}
+
+// WithLanguage returns the recipient with the variants of a language tried before its own languages
+func (r Recipient) WithLanguage(lang string) Recipient {
+	canonical := shared.CanonicalLanguage(lang)
+	if canonical == "" {
+		return r
+	}
+	r.Languages = append([]string{canonical}, slices.DeleteFunc(slices.Clone(r.Languages), func(language string) bool {
+		return language == canonical
+	})...)
+	return r
+}
+
+// Resolve gets the effective preferences (user-specific → team → global fallback) and config (user-specific →
+// global fallback) of a recipient. team is set when the recipient was resolved from a team
+func (e *Engine) Resolve(ctx context.Context, recipientID string, team *shared.Team) (Recipient, error) {
+	preferences, err := e.effectivePreferences(ctx, recipientID, team)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("failed to get effective preferences: %w", err)
+	}
+	config, err := effectiveConfig(ctx, recipientID)
+	if err != nil {
+		return Recipient{}, fmt.Errorf("failed to get effective config: %w", err)
+	}
+
+	// Templates are picked in the recipient's language, falling back through the global language chain
+	return Recipient{
+		ID:          recipientID,
+		Team:        team,
+		Preferences: preferences,
+		Config:      config,
+		Languages:   templateLanguages(ctx, config, preferences.Language),
+	}, nil
+}
+
+// Channels returns the channels the request is delivered on to the recipient. Built-in templates are email only
+// and have their own opt-out, overflow digests go to the capped channel the notifications were held for, and
+// replays only to the channels that failed. A team notified as a unit only receives messages on its shared
+// Slack channel
+func (e *Engine) Channels(ctx context.Context, recipient Recipient, request shared.NotificationRequest, ruleChannels []string) []string {
+	enabledChannels := filterEnabledChannels(ctx, recipient.Preferences, recipient.Config, request.Type, ruleChannels)
+	if request.SystemTemplate != "" {
+		enabledChannels = nil
+		if isChannelEnabledInConfig(recipient.Config, shared.ChannelEmail) {
+			enabledChannels = []string{shared.ChannelEmail}
+		}
+	}
+	if request.Overflow {
+		enabledChannels = slices.DeleteFunc(slices.Clone(request.Channels), func(channel string) bool {
+			return !isChannelEnabledInConfig(recipient.Config, channel)
+		})
+	}
+	if len(request.Channels) > 0 {
+		enabledChannels = slices.DeleteFunc(enabledChannels, func(channel string) bool {
+			return !slices.Contains(request.Channels, channel)
+		})
+	}
+
+	if recipient.IsTeamUnit() {
+		enabledChannels = filterTeamChannels(enabledChannels)
+	}
+	return enabledChannels
+}
+
+// LocalizeVariables returns the request's variables for rendering to the recipient. Report data is formatted
+// for the recipient's language and timezone
+func (e *Engine) LocalizeVariables(ctx context.Context, recipient Recipient, request shared.NotificationRequest) map[string]any {
+	preferences := recipient.Preferences
+	if request.Type != shared.NotificationTypeReport || (preferences.Language == "" && preferences.Timezone == "") {
+		return request.Variables
+	}
+	language := preferences.Language
+	if language != "" {
+		language = resolveLanguage(ctx, recipient.Config, language)
+	}
+	return shared.NewLocaleFormatter(language, preferences.Timezone).LocalizeVariables(request.Variables)
+}
+
+// effectivePreferences gets user preferences with team and global fallback. User and team preferences are
+// merged over the global ones unless the fallback policy replaces them. Active overrides of the preferences
+// found are applied
+func (e *Engine) effectivePreferences(ctx context.Context, recipientID string, team *shared.Team) (shared.UserPreferences, error) {
+	now := shared.GetCurrentTime()
+
+	// Try user-specific preferences first
+	userPrefs, err := db.GetUserPreferences(ctx, recipientID)
+	if err == nil && userPrefs.Context != "" {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("Using user-specific preferences")
+		return e.mergeGlobalPreferences(ctx, userPrefs).WithOverrides(now), nil
+	}
+
+	// Fallback to the team's shared preferences
+	if team != nil && len(team.Preferences) > 0 {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Str("teamId", team.TeamID).Msg("Using team preferences")
+		return e.mergeGlobalPreferences(ctx, shared.UserPreferences{
+			Context:     shared.RecipientPrefixTeam + team.TeamID,
+			Preferences: team.Preferences,
+		}), nil
+	}
+
+	// Fallback to global preferences
+	globalPrefs, err := db.GetUserPreferences(ctx, "*")
+	if err == nil && globalPrefs.Context != "" {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("Using global preferences fallback")
+		return globalPrefs.WithOverrides(now), nil
+	}
+
+	// Return error if neither exists
+	return shared.UserPreferences{}, fmt.Errorf("no preferences found for recipient %s", recipientID)
+}
+
+// mergeGlobalPreferences layers preferences over the global ones unless the fallback policy replaces them. A global
+// preferences outage delivers with the preferences alone, as the replace policy would
+func (e *Engine) mergeGlobalPreferences(ctx context.Context, preferences shared.UserPreferences) shared.UserPreferences {
+	if !db.GetFallbackSettings(ctx).MergesPreferences() {
+		return preferences
+	}
+	globalPrefs, ok := e.globalPreferences.Get("*")
+	if !ok {
+		var err error
+		globalPrefs, err = db.GetUserPreferences(ctx, "*")
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get global preferences, using preferences without merging")
+			return preferences
+		}
+		e.globalPreferences.Set("*", globalPrefs)
+	}
+	return preferences.MergeOver(globalPrefs)
+}
+
+// effectiveConfig gets system config with global fallback
+func effectiveConfig(ctx context.Context, recipientID string) (shared.SystemConfig, error) {
+	// Try user-specific config first
+	userConfig, err := db.GetSystemConfig(ctx, recipientID)
+	if err == nil && userConfig.Context != "" {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("Using user-specific config")
+		return userConfig, nil
+	}
+
+	// Fallback to global config
+	globalConfig, err := db.GetSystemConfig(ctx, "*")
+	if err == nil && globalConfig.Context != "" {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("Using global config fallback")
+		return globalConfig, nil
+	}
+
+	// Return error if neither exists
+	return shared.SystemConfig{}, fmt.Errorf("no config found for recipient %s", recipientID)
+}
+
+// GlobalSettings returns the global settings, reusing the effective config when it is the global one.
+// Settings that are only configured globally (localization, from address, email warm-up) are read from it
+func GlobalSettings(ctx context.Context, config shared.SystemConfig) shared.SystemSettings {
+	if config.Context != "*" {
+		globalConfig, err := db.GetSystemConfig(ctx, "*")
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get global config")
+		}
+		config = globalConfig
+	}
+	if config.Config == nil {
+		return shared.SystemSettings{}
+	}
+	return *config.Config
+}
+
+// environmentBanner returns the subject prefix and email banner that mark notifications sent from a
+// non-production environment, both empty in production or when the global config turns the banner off
+func environmentBanner(ctx context.Context, config shared.SystemConfig) (string, string) {
+	return GlobalSettings(ctx, config).EnvironmentBanner.Resolve(shared.Environment)
+}
+
+// resolveLanguage walks the global language fallback chain for lang and returns the first supported language
+func resolveLanguage(ctx context.Context, config shared.SystemConfig, lang string) string {
+	chain := GlobalSettings(ctx, config).Localization.LanguageChain(lang)
+	for _, candidate := range chain {
+		if shared.IsSupportedLocale(candidate) {
+			return candidate
+		}
+	}
+	return chain[len(chain)-1]
+}
+
+// templateLanguages returns the languages a recipient's templates are looked up in, most specific first: the
+// recipient's language, its fallbacks and the default language, in canonical form
+func templateLanguages(ctx context.Context, config shared.SystemConfig, lang string) []string {
+	var languages []string
+	for _, candidate := range GlobalSettings(ctx, config).Localization.LanguageChain(lang) {
+		if canonical := shared.CanonicalLanguage(candidate); canonical != "" && !slices.Contains(languages, canonical) {
+			languages = append(languages, canonical)
+		}
+	}
+	return languages
+}
+
+// filterEnabledChannels filters channels based on preferences, config, and template availability.
+// Channels added by rules join the preferred ones when the recipient receives the type at all
+func filterEnabledChannels(ctx context.Context, preferences shared.UserPreferences, config shared.SystemConfig, notificationType string, ruleChannels []string) []string {
+	enabledChannels := make([]string, 0)
+
+	// Get preference for this notification type
+	prefItem, hasPref := preferences.Preferences[notificationType]
+	if !hasPref || prefItem.Enabled == nil || !*prefItem.Enabled {
+		shared.LogInfo(ctx).Str("type", notificationType).Msg("Notification type disabled in preferences")
+		return enabledChannels
+	}
+
+	channels := slices.Clone(prefItem.Channels)
+	for _, channel := range ruleChannels {
+		if !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+
+	// Check each preferred channel
+	for _, channel := range channels {
+		// Check if channel is enabled in system config
+		if !isChannelEnabledInConfig(config, channel) {
+			shared.LogInfo(ctx).Str("channel", channel).Msg("Channel disabled in system config")
+			continue
+		}
+
+		enabledChannels = append(enabledChannels, channel)
+	}
+
+	return enabledChannels
+}
+
+// filterTeamChannels keeps only the channels a team can receive as a unit
+func filterTeamChannels(channels []string) []string {
+	teamChannels := make([]string, 0, 1)
+	for _, channel := range channels {
+		if channel == shared.ChannelSlack {
+			teamChannels = append(teamChannels, channel)
+		}
+	}
+	return teamChannels
+}
+
+// isChannelEnabledInConfig checks if a channel is enabled in system config
+func isChannelEnabledInConfig(config shared.SystemConfig, channel string) bool {
+	return config.Config != nil && config.Config.ChannelEnabled(channel)
+}
@@ -0,0 +1,666 @@
+package engine
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// fakeDynamoDB serves the DynamoDB calls of the engine from memory. GetItem and PutItem work on the items of
+// each table by its key, UpdateItem only acknowledges the recompiled templates the engine writes back
+type fakeDynamoDB struct {
+	mu    sync.Mutex
+	keys  map[string][]string
+	items map[string][]map[string]any
+}
+
+// newFakeDynamoDB points the DynamoDB client at an empty fake for the duration of the test
+func newFakeDynamoDB(t *testing.T) *fakeDynamoDB {
+	t.Helper()
+	shared.PreferencesTable, shared.ConfigTable, shared.TemplatesTable = "preferences", "config", "templates"
+	shared.UsersTable, shared.InboxTable = "users", "inbox"
+	fake := &fakeDynamoDB{
+		keys: map[string][]string{
+			"preferences": {"context"},
+			"config":      {"context"},
+			"templates":   {"context", "type#channel"},
+			"users":       {"userId"},
+			"inbox":       {"userId", "notificationId"},
+		},
+		items: make(map[string][]map[string]any),
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	previous := shared.DynamoDBClient
+	shared.DynamoDBClient = dynamodb.New(dynamodb.Options{
+		Region:           "us-east-1",
+		BaseEndpoint:     aws.String(server.URL),
+		Credentials:      aws.AnonymousCredentials{},
+		RetryMaxAttempts: 1,
+	})
+	t.Cleanup(func() { shared.DynamoDBClient = previous })
+	return fake
+}
+
+func (f *fakeDynamoDB) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TableName string
+		Key       map[string]any
+		Item      map[string]any
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	output := map[string]any{}
+	switch operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810."); operation {
+	case "GetItem":
+		for _, item := range f.items[input.TableName] {
+			if matches(item, input.Key) {
+				output["Item"] = item
+			}
+		}
+	case "PutItem":
+		key := make(map[string]any)
+		for _, name := range f.keys[input.TableName] {
+			key[name] = input.Item[name]
+		}
+		f.items[input.TableName] = append(slices.DeleteFunc(f.items[input.TableName], func(item map[string]any) bool {
+			return matches(item, key)
+		}), input.Item)
+	case "UpdateItem":
+	default:
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.dynamodb.v20120810#UnknownOperationException", "message": operation})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	json.NewEncoder(w).Encode(output)
+}
+
+// matches reports whether the item has every attribute of the key
+func matches(item, key map[string]any) bool {
+	for name, value := range key {
+		if !reflect.DeepEqual(item[name], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// put stores an item in a table of the fake
+func put(t *testing.T, tableName string, item any) {
+	t.Helper()
+	if err := services.DbPutItem(context.Background(), tableName, item); err != nil {
+		t.Fatalf("put %s: %v", tableName, err)
+	}
+}
+
+func enabled(value bool) *bool {
+	return &value
+}
+
+// testGlobalConfig is a global config enabling email, Slack and in-app
+func testGlobalConfig() shared.SystemConfig {
+	return shared.SystemConfig{
+		Context: "*",
+		Config: &shared.SystemSettings{
+			EmailSettings: shared.EmailSettings{Enabled: enabled(true), FromAddress: "noreply@example.com"},
+			SlackSettings: shared.SlackSettings{Enabled: enabled(true)},
+			InAppSettings: shared.InAppSettings{Enabled: enabled(true)},
+		},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	newFakeDynamoDB(t)
+	put(t, shared.ConfigTable, testGlobalConfig())
+	put(t, shared.ConfigTable, shared.SystemConfig{
+		Context: "user-2",
+		Config:  &shared.SystemSettings{SmsSettings: shared.SmsSettings{Enabled: enabled(true)}},
+	})
+	put(t, shared.PreferencesTable, shared.UserPreferences{
+		Context: "*",
+		Preferences: map[string]shared.PreferenceItem{
+			"alert":  {Channels: []string{"email"}, Enabled: enabled(true)},
+			"report": {Channels: []string{"email", "slack"}, Enabled: enabled(true)},
+		},
+	})
+	put(t, shared.PreferencesTable, shared.UserPreferences{
+		Context:     "user-1",
+		Preferences: map[string]shared.PreferenceItem{"alert": {Enabled: enabled(false)}},
+		Language:    "fr-CA",
+	})
+	team := &shared.Team{
+		TeamID:      "team-1",
+		Preferences: map[string]shared.PreferenceItem{"alert": {Channels: []string{"slack"}, Enabled: enabled(true)}},
+	}
+
+	tests := []struct {
+		name              string
+		recipientID       string
+		team              *shared.Team
+		preferenceContext string
+		configContext     string
+		alert             shared.PreferenceItem
+		report            shared.PreferenceItem
+		languages         []string
+	}{
+		{
+			name:              "user preferences merged over the global ones",
+			recipientID:       "user-1",
+			preferenceContext: "user-1",
+			configContext:     "*",
+			alert:             shared.PreferenceItem{Channels: []string{"email"}, Enabled: enabled(false)},
+			report:            shared.PreferenceItem{Channels: []string{"email", "slack"}, Enabled: enabled(true)},
+			languages:         []string{"fr-CA", "fr", "en"},
+		},
+		{
+			name:              "user config",
+			recipientID:       "user-2",
+			preferenceContext: "*",
+			configContext:     "user-2",
+			alert:             shared.PreferenceItem{Channels: []string{"email"}, Enabled: enabled(true)},
+			report:            shared.PreferenceItem{Channels: []string{"email", "slack"}, Enabled: enabled(true)},
+			languages:         []string{"en"},
+		},
+		{
+			name:              "team preferences without user preferences",
+			recipientID:       "user-3",
+			team:              team,
+			preferenceContext: "team:team-1",
+			configContext:     "*",
+			alert:             shared.PreferenceItem{Channels: []string{"slack"}, Enabled: enabled(true)},
+			report:            shared.PreferenceItem{Channels: []string{"email", "slack"}, Enabled: enabled(true)},
+			languages:         []string{"en"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recipient, err := New().Resolve(context.Background(), test.recipientID, test.team)
+			if err != nil {
+				t.Fatalf("Resolve: %v", err)
+			}
+			if recipient.ID != test.recipientID || recipient.Team != test.team {
+				t.Errorf("recipient = %s of %v, want %s of %v", recipient.ID, recipient.Team, test.recipientID, test.team)
+			}
+			if recipient.Preferences.Context != test.preferenceContext {
+				t.Errorf("preferences context = %q, want %q", recipient.Preferences.Context, test.preferenceContext)
+			}
+			if recipient.Config.Context != test.configContext {
+				t.Errorf("config context = %q, want %q", recipient.Config.Context, test.configContext)
+			}
+			if got := recipient.Preferences.Preferences["alert"]; !reflect.DeepEqual(got, test.alert) {
+				t.Errorf("alert preference = %+v, want %+v", got, test.alert)
+			}
+			if got := recipient.Preferences.Preferences["report"]; !reflect.DeepEqual(got, test.report) {
+				t.Errorf("report preference = %+v, want %+v", got, test.report)
+			}
+			if !slices.Equal(recipient.Languages, test.languages) {
+				t.Errorf("languages = %v, want %v", recipient.Languages, test.languages)
+			}
+		})
+	}
+}
+
+func TestResolveWithoutPreferences(t *testing.T) {
+	newFakeDynamoDB(t)
+	put(t, shared.ConfigTable, testGlobalConfig())
+
+	if _, err := New().Resolve(context.Background(), "user-1", nil); err == nil {
+		t.Error("Resolve succeeded without any preferences, want an error")
+	}
+}
+
+func TestChannels(t *testing.T) {
+	preferences := shared.UserPreferences{
+		Context: "user-1",
+		Preferences: map[string]shared.PreferenceItem{
+			"alert":  {Channels: []string{"email", "slack", "sms"}, Enabled: enabled(true)},
+			"report": {Channels: []string{"email"}, Enabled: enabled(false)},
+		},
+	}
+	user := Recipient{ID: "user-1", Preferences: preferences, Config: testGlobalConfig()}
+	team := Recipient{ID: "team:team-1", Team: &shared.Team{TeamID: "team-1"}, Preferences: preferences, Config: testGlobalConfig()}
+	member := Recipient{ID: "user-1", Team: &shared.Team{TeamID: "team-1"}, Preferences: preferences, Config: testGlobalConfig()}
+
+	tests := []struct {
+		name         string
+		recipient    Recipient
+		request      shared.NotificationRequest
+		ruleChannels []string
+		want         []string
+	}{
+		{
+			name:      "preferred channels the config enables",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "alert"},
+			want:      []string{"email", "slack"},
+		},
+		{
+			name:      "type disabled in preferences",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "report"},
+			want:      []string{},
+		},
+		{
+			name:      "type without preferences",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "notification"},
+			want:      []string{},
+		},
+		{
+			name:         "channels added by rules",
+			recipient:    user,
+			request:      shared.NotificationRequest{Type: "alert"},
+			ruleChannels: []string{"in_app", "push"},
+			want:         []string{"email", "slack", "in_app"},
+		},
+		{
+			name:      "restricted to the request's channels",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "alert", Channels: []string{"slack", "in_app"}},
+			want:      []string{"slack"},
+		},
+		{
+			name:      "built-in templates are email only",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "notification", SystemTemplate: shared.SystemTemplateMissedSummary},
+			want:      []string{"email"},
+		},
+		{
+			name:      "overflow digest on its held channel",
+			recipient: user,
+			request:   shared.NotificationRequest{Type: "notification", Overflow: true, Channels: []string{"in_app"}},
+			want:      []string{"in_app"},
+		},
+		{
+			name:      "team notified as a unit",
+			recipient: team,
+			request:   shared.NotificationRequest{Type: "alert"},
+			want:      []string{"slack"},
+		},
+		{
+			name:      "member of a team",
+			recipient: member,
+			request:   shared.NotificationRequest{Type: "alert"},
+			want:      []string{"email", "slack"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := New().Channels(context.Background(), test.recipient, test.request, test.ruleChannels)
+			if !slices.Equal(got, test.want) {
+				t.Errorf("Channels = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	newFakeDynamoDB(t)
+	put(t, shared.ConfigTable, testGlobalConfig())
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: "alert#slack", Content: "global alert"})
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: "alert#slack#fr", Content: "alerte globale"})
+	put(t, shared.TemplatesTable, shared.Template{Context: "user-1", TypeChannel: "alert#slack", Content: "user alert"})
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: "report#slack", Content: "global report"})
+	put(t, shared.TemplatesTable, shared.Template{Context: "user-1", TypeChannel: "report#slack", Content: "inactive report", IsActive: enabled(false)})
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: "alert#email", Content: `{"subject": "{{title}}", "body": "Hi {{> signature}}"}`})
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: shared.PartialTypeChannel("signature"), Content: "the team"})
+
+	tests := []struct {
+		name        string
+		recipient   Recipient
+		request     shared.NotificationRequest
+		channel     string
+		wantContext string
+		wantContent string
+	}{
+		{
+			name:        "user template before the global one",
+			recipient:   Recipient{ID: "user-1", Languages: []string{"en"}},
+			request:     shared.NotificationRequest{Type: "alert"},
+			channel:     "slack",
+			wantContext: "user-1",
+			wantContent: "user alert",
+		},
+		{
+			name:        "global template in the recipient's language",
+			recipient:   Recipient{ID: "user-2", Languages: []string{"fr", "en"}},
+			request:     shared.NotificationRequest{Type: "alert"},
+			channel:     "slack",
+			wantContext: "*",
+			wantContent: "alerte globale",
+		},
+		{
+			name:        "user template in the default language before a global translation",
+			recipient:   Recipient{ID: "user-1", Languages: []string{"fr", "en"}},
+			request:     shared.NotificationRequest{Type: "alert"},
+			channel:     "slack",
+			wantContext: "user-1",
+			wantContent: "user alert",
+		},
+		{
+			name:        "inactive user template skipped",
+			recipient:   Recipient{ID: "user-1", Languages: []string{"en"}},
+			request:     shared.NotificationRequest{Type: "report"},
+			channel:     "slack",
+			wantContext: "*",
+			wantContent: "global report",
+		},
+		{
+			name:        "partials inlined",
+			recipient:   Recipient{ID: "user-1", Languages: []string{"en"}},
+			request:     shared.NotificationRequest{Type: "alert"},
+			channel:     "email",
+			wantContext: "*",
+			wantContent: `{"body":"Hi the team","subject":"{{title}}"}`,
+		},
+		{
+			name:        "built-in template",
+			recipient:   Recipient{ID: "user-1", Languages: []string{"en"}},
+			request:     shared.NotificationRequest{Type: "notification", SystemTemplate: shared.SystemTemplateMissedSummary},
+			channel:     "email",
+			wantContext: "*",
+			wantContent: shared.SystemTemplates[shared.SystemTemplateMissedSummary],
+		},
+	}
+
+	engine := New()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			template, err := engine.Template(context.Background(), test.recipient, test.request, test.channel)
+			if err != nil {
+				t.Fatalf("Template: %v", err)
+			}
+			if template.Context != test.wantContext || template.Content != test.wantContent {
+				t.Errorf("Template = %q in %q, want %q in %q", template.Content, template.Context, test.wantContent, test.wantContext)
+			}
+		})
+	}
+
+	if _, err := engine.Template(context.Background(), Recipient{ID: "user-1"}, shared.NotificationRequest{Type: "report"}, "email"); err == nil {
+		t.Error("Template found a template for report#email, want an error")
+	}
+}
+
+func TestRender(t *testing.T) {
+	variables := map[string]any{"title": "Disk full", "server": "db-1", "count": 3}
+
+	tests := []struct {
+		name     string
+		template shared.Template
+		channel  string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "placeholders",
+			template: shared.Template{Content: "{{title}} on {{server}} ({{count}})"},
+			channel:  "slack",
+			want:     "Disk full on db-1 (3)",
+		},
+		{
+			name:     "missing variables render empty",
+			template: shared.Template{Content: "{{title}}{{missing}}!"},
+			channel:  "in_app",
+			want:     "Disk full!",
+		},
+		{
+			name:     "template syntax",
+			template: shared.Template{Content: "{{if gt .count 2}}many{{else}}few{{end}} {{.owner | default \"nobody\"}}"},
+			channel:  "push",
+			want:     "many nobody",
+		},
+		{
+			name:     "email",
+			template: shared.Template{Content: `{"subject": "{{title}}", "body": "<p>{{server}}</p>"}`},
+			channel:  "email",
+			want:     `{"subject":"Disk full","body":"\u003cp\u003edb-1\u003c/p\u003e"}`,
+		},
+		{
+			name:     "markdown email",
+			template: shared.Template{Content: `{"subject": "**{{title}}**", "body": "On **{{server}}**"}`, Format: shared.TemplateFormatMarkdown},
+			channel:  "email",
+			want:     `{"subject":"Disk full","body":"On db-1","htmlBody":"\u003cp\u003eOn \u003cstrong\u003edb-1\u003c/strong\u003e\u003c/p\u003e"}`,
+		},
+		{
+			name:     "markdown for Slack",
+			template: shared.Template{Content: "**{{title}}** on [{{server}}](https://example.com)", Format: shared.TemplateFormatMarkdown},
+			channel:  "slack",
+			want:     "*Disk full* on <https://example.com|db-1>",
+		},
+		{
+			name:     "Teams card",
+			template: shared.Template{Content: `{"title": "{{title}}", "text": "On {{server}}"}`},
+			channel:  "teams",
+			want:     `{"title":"Disk full","text":"On db-1"}`,
+		},
+		{
+			name:     "SMS too long",
+			template: shared.Template{Content: strings.Repeat("{{title}} ", 200)},
+			channel:  "sms",
+			wantErr:  true,
+		},
+		{
+			name:     "empty template",
+			template: shared.Template{},
+			channel:  "slack",
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported channel",
+			template: shared.Template{Content: "{{title}}"},
+			channel:  "fax",
+			wantErr:  true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := New().Render(context.Background(), test.template, test.channel, variables)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("Render = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Render: %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Render = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	newFakeDynamoDB(t)
+	put(t, shared.ConfigTable, testGlobalConfig())
+	put(t, shared.UsersTable, shared.User{UserID: "user-1"})
+	recipient := Recipient{ID: "user-1", Config: testGlobalConfig()}
+	request := shared.NotificationRequest{ID: "request-1", Type: "alert"}
+
+	t.Run("in-app content goes to the inbox", func(t *testing.T) {
+		delivery, err := New().Deliver(context.Background(), recipient, request, shared.ChannelInApp, "Disk full")
+		if err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+		if delivery.Recipient != "user-1" {
+			t.Errorf("delivery recipient = %q, want user-1", delivery.Recipient)
+		}
+		item, err := db.GetInboxItem(context.Background(), "user-1", "request-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Content != "Disk full" || item.Type != "alert" {
+			t.Errorf("inbox item = %+v, want the alert's content", item)
+		}
+	})
+
+	failures := []struct {
+		name      string
+		recipient Recipient
+		channel   string
+		content   string
+		wantErr   string
+	}{
+		{
+			name:      "Slack without a webhook",
+			recipient: recipient,
+			channel:   shared.ChannelSlack,
+			wantErr:   "no Slack webhook configured",
+		},
+		{
+			name: "Slack webhook that is not Slack's",
+			recipient: Recipient{ID: "user-1", Config: shared.SystemConfig{Context: "user-1", Config: &shared.SystemSettings{
+				SlackSettings: shared.SlackSettings{WebhookURL: "https://169.254.169.254/latest/meta-data"},
+			}}},
+			channel: shared.ChannelSlack,
+			wantErr: "invalid Slack webhook",
+		},
+		{
+			name:      "team Slack webhook that is not Slack's",
+			recipient: Recipient{ID: "team:team-1", Team: &shared.Team{TeamID: "team-1", SlackWebhookURL: "http://hooks.slack.com/services/T/B/x"}, Config: testGlobalConfig()},
+			channel:   shared.ChannelSlack,
+			wantErr:   "invalid Slack webhook",
+		},
+		{
+			name:      "Teams without a webhook",
+			recipient: recipient,
+			channel:   shared.ChannelTeams,
+			wantErr:   "no Teams webhook configured",
+		},
+		{
+			name:      "email without an address",
+			recipient: recipient,
+			channel:   shared.ChannelEmail,
+			content:   `{"subject": "Disk full", "body": "On db-1"}`,
+			wantErr:   "has no email address",
+		},
+		{
+			name:      "SMS without a phone number",
+			recipient: recipient,
+			channel:   shared.ChannelSMS,
+			wantErr:   "has no phone number",
+		},
+		{
+			name:      "webhook without an endpoint",
+			recipient: recipient,
+			channel:   shared.ChannelWebhook,
+			wantErr:   "no webhook configured",
+		},
+		{
+			name:      "unsupported channel",
+			recipient: recipient,
+			channel:   "fax",
+			wantErr:   "unsupported channel",
+		},
+	}
+	for _, test := range failures {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := New().Deliver(context.Background(), test.recipient, request, test.channel, cmp.Or(test.content, "Disk full"))
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Deliver error = %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	newFakeDynamoDB(t)
+	put(t, shared.ConfigTable, testGlobalConfig())
+	put(t, shared.TemplatesTable, shared.Template{Context: "*", TypeChannel: "alert#email", Content: `{"subject": "{{title}}", "body": "On {{server}}"}`})
+	recipient := Recipient{
+		ID: "user-1",
+		Preferences: shared.UserPreferences{Context: "user-1", Preferences: map[string]shared.PreferenceItem{
+			"alert": {Channels: []string{"email", "slack"}, Enabled: enabled(true)},
+		}},
+		Config:    testGlobalConfig(),
+		Languages: []string{"en"},
+	}
+
+	simulation := New().Simulate(context.Background(), recipient, shared.NotificationRequest{
+		Type:      "alert",
+		Variables: map[string]any{"title": "Disk full"},
+	})
+	want := shared.Simulation{
+		RecipientID: "user-1",
+		Type:        "alert",
+		Channels: []shared.ChannelSimulation{
+			{Channel: "email", Template: "*/alert#email", Subject: "Disk full", Body: "On ", MissingVariables: []string{"server"}},
+			{Channel: "slack", Skipped: "no template"},
+		},
+	}
+	if !reflect.DeepEqual(simulation, want) {
+		t.Errorf("Simulate = %+v, want %+v", simulation, want)
+	}
+
+	simulation = New().Simulate(context.Background(), recipient, shared.NotificationRequest{Type: "report"})
+	if simulation.Skipped == "" || len(simulation.Channels) > 0 {
+		t.Errorf("Simulate of a type without channels = %+v, want it skipped", simulation)
+	}
+}
+
+func TestBuildDigest(t *testing.T) {
+	held := []shared.DigestItem{
+		{UserID: "user-1", ItemKey: "1", Type: "alert", Variables: map[string]any{"title": "Disk full"}},
+		{UserID: "user-1", ItemKey: "2", Type: "report", Channel: "email", Variables: map[string]any{"title": "Weekly report"}},
+		{UserID: "user-1", ItemKey: "3", Type: "notification", Variables: map[string]any{"title": "Welcome"}},
+	}
+
+	daily := shared.NotificationRequest{Recipients: []string{"user-1"}, Digest: true}
+	items, err := BuildDigest(&daily, held)
+	if err != nil {
+		t.Fatalf("BuildDigest: %v", err)
+	}
+	if len(items) != 2 || items[0].ItemKey != "1" || items[1].ItemKey != "3" {
+		t.Errorf("daily digest items = %+v, want the items held without a channel", items)
+	}
+	if daily.Variables["title"] != "Your daily digest (2)" {
+		t.Errorf("daily digest title = %v", daily.Variables["title"])
+	}
+	message, _ := daily.Variables["message"].(string)
+	if lines := strings.Split(message, "\n"); len(lines) != 2 || !strings.HasPrefix(lines[0], "[alert]") || !strings.Contains(lines[1], "Welcome") {
+		t.Errorf("daily digest message = %q, want a line per held item", message)
+	}
+
+	overflow := shared.NotificationRequest{Recipients: []string{"user-1"}, Digest: true, Overflow: true, Channels: []string{"email"}}
+	items, err = BuildDigest(&overflow, held)
+	if err != nil {
+		t.Fatalf("BuildDigest: %v", err)
+	}
+	if len(items) != 1 || items[0].ItemKey != "2" || overflow.Variables["title"] != "Held after your daily limit (1)" {
+		t.Errorf("overflow digest = %+v with %v, want the item held for email", items, overflow.Variables)
+	}
+
+	for _, request := range []shared.NotificationRequest{
+		{Recipients: []string{"user-1", "user-2"}, Digest: true},
+		{Recipients: []string{"user-1"}, Digest: true, Overflow: true},
+	} {
+		if _, err := BuildDigest(&request, held); err == nil {
+			t.Errorf("BuildDigest(%+v) succeeded, want an error", request)
+		}
+	}
+}
@@ -0,0 +1,363 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"slices"
+	"sync"
+	"time"
+)
+
+// templateCache holds templates (including misses) keyed by context and type#channel. It is cleared when the
+// templates version changes
+type templateCache struct {
+	templates *shared.TTLCache[shared.Template]
+	// checkInterval bounds how stale a cached template can be after an update
+	checkInterval time.Duration
+
+	mu      sync.Mutex
+	version int64
+	checked time.Time
+}
+
+func newTemplateCache() *templateCache {
+	return &templateCache{
+		templates:     shared.NewTTLCache[shared.Template](shared.GetEnvDuration("TEMPLATE_CACHE_TTL", 5*time.Minute)),
+		checkInterval: shared.GetEnvDuration("TEMPLATE_VERSION_CHECK_INTERVAL", 30*time.Second),
+	}
+}
+
+// refresh clears the template cache when the templates version has changed
+func (c *templateCache) refresh(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checked) < c.checkInterval {
+		return
+	}
+
+	version, err := db.GetTemplatesVersion(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to check templates version")
+		return
+	}
+	if version != c.version {
+		shared.LogInfo(ctx).Int64("oldVersion", c.version).Int64("newVersion", version).Msg("Templates changed, clearing template cache")
+		c.templates.Clear()
+		c.version = version
+	}
+	c.checked = time.Now()
+}
+
+// get gets a template through the template cache
+func (c *templateCache) get(ctx context.Context, context, typeChannel string) (shared.Template, error) {
+	c.refresh(ctx)
+
+	cacheKey := context + "|" + typeChannel
+	if template, ok := c.templates.Get(cacheKey); ok {
+		return template, nil
+	}
+
+	template, err := db.GetTemplateByTypeChannel(ctx, context, typeChannel)
+	if err != nil {
+		return shared.Template{}, err
+	}
+	template = withCurrentCompiledForm(ctx, template)
+	c.templates.Set(cacheKey, template)
+	return template, nil
+}
+
+// Template gets the template the request is rendered with for the recipient on a channel: the built-in template
+// of the request, or the recipient's template (user-specific → global → error)
+func (e *Engine) Template(ctx context.Context, recipient Recipient, request shared.NotificationRequest, channel string) (shared.Template, error) {
+	if request.SystemTemplate != "" {
+		return getSystemTemplate(request.SystemTemplate)
+	}
+	return e.requiredTemplate(ctx, recipient.ID, request.Type, channel, recipient.Languages)
+}
+
+// Render renders a template for a channel. Stored templates carry their compiled form; templates without
+// a current one (derived fallbacks, system templates) are compiled here
+func (e *Engine) Render(ctx context.Context, template shared.Template, channel string, variables map[string]any) (string, error) {
+	return processTemplateForChannel(ctx, template, channel, variables)
+}
+
+// MarkTestContent prefixes rendered content with the test marker, the subject for email and the title for Teams
+func MarkTestContent(channel, content string) string {
+	if channel == shared.ChannelTeams {
+		message := shared.ParseTeamsMessage(content)
+		if message.Title != "" {
+			message.Title = shared.ApplySubjectPrefix(shared.TestNotificationPrefix, message.Title)
+		} else {
+			message.Text = shared.ApplySubjectPrefix(shared.TestNotificationPrefix, message.Text)
+		}
+		marked, err := json.Marshal(message)
+		if err != nil {
+			return content
+		}
+		return string(marked)
+	}
+	if channel != shared.ChannelEmail {
+		return shared.ApplySubjectPrefix(shared.TestNotificationPrefix, content)
+	}
+	email, err := shared.ParseEmailContent(content)
+	if err != nil {
+		return content
+	}
+	email.Subject = shared.ApplySubjectPrefix(shared.TestNotificationPrefix, email.Subject)
+	marked, err := json.Marshal(email)
+	if err != nil {
+		return content
+	}
+	return string(marked)
+}
+
+// withCurrentCompiledForm recompiles a stored template that was compiled by another engine version (or
+// saved before templates were compiled) and writes the new form back, so the next load can use it
+func withCurrentCompiledForm(ctx context.Context, template shared.Template) shared.Template {
+	if template.Content == "" || template.Compiled.IsCurrent() || !template.Precompiled() {
+		return template
+	}
+
+	_, channel := shared.ParseTypeChannel(template.TypeChannel)
+	compiled, err := shared.CompileTemplate(channel, template.Content)
+	if err != nil {
+		// Left uncompiled, rendering reports the error for the channel
+		return template
+	}
+	template.Compiled = compiled
+
+	if err := db.SaveCompiledTemplate(ctx, template); err != nil {
+		shared.LogWarn(ctx).Err(err).Str("context", template.Context).Str("typeChannel", template.TypeChannel).Msg("Failed to store recompiled template")
+	} else {
+		shared.LogInfo(ctx).Str("context", template.Context).Str("typeChannel", template.TypeChannel).Int("engineVersion", shared.TemplateEngineVersion).Msg("Template recompiled")
+	}
+	return template
+}
+
+// requiredTemplate gets template with user → global fallback, each in the first of languages it exists in,
+// error if none found. With TEMPLATE_TEXT_FALLBACK enabled, Slack and in-app content is derived from the email
+// template when missing
+func (e *Engine) requiredTemplate(ctx context.Context, recipientID, notificationType, channel string, languages []string) (shared.Template, error) {
+	template, found := e.findTemplate(ctx, recipientID, notificationType, channel, languages)
+	if found {
+		return e.withPartials(ctx, recipientID, template), nil
+	}
+
+	if channel != shared.ChannelEmail && shared.GetEnvBool("TEMPLATE_TEXT_FALLBACK", false) {
+		emailTemplate, found := e.findTemplate(ctx, recipientID, notificationType, shared.ChannelEmail, languages)
+		if found {
+			emailTemplate = e.withPartials(ctx, recipientID, emailTemplate)
+			content, err := shared.DerivePlainTextTemplate(emailTemplate.Content)
+			if err == nil {
+				shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", notificationType).Str("channel", channel).Msg("Using plain-text fallback derived from email template")
+				return shared.Template{
+					Context:     emailTemplate.Context,
+					TypeChannel: shared.BuildTypeChannel(notificationType, channel),
+					Content:     content,
+					Format:      emailTemplate.Format,
+					IsActive:    emailTemplate.IsActive,
+				}, nil
+			}
+			shared.LogWarn(ctx).Err(err).Str("type", notificationType).Msg("Failed to derive plain-text fallback template")
+		}
+	}
+
+	// Fatal error if no template found
+	return shared.Template{}, fmt.Errorf("no template found for type %s (fatal error)", notificationType)
+}
+
+// withPartials inlines the partials a template includes, each resolved with user → global fallback. Partials
+// are shared by every language. The
+// template is compiled when rendered, with its partials' current content. Missing partials render empty
+func (e *Engine) withPartials(ctx context.Context, recipientID string, template shared.Template) shared.Template {
+	names := shared.PartialNames(template.Content)
+	if len(names) == 0 {
+		return template
+	}
+
+	partials := make(map[string]string, len(names))
+	for _, name := range names {
+		partial, found := e.findTemplate(ctx, recipientID, shared.PartialType, name, nil)
+		if !found {
+			shared.LogWarn(ctx).Str("recipientId", recipientID).Str("typeChannel", template.TypeChannel).Str("partial", name).Msg("Partial not found, rendering without it")
+			continue
+		}
+		partials[name] = partial.Content
+	}
+
+	template.Content = shared.InlinePartials(template.Content, partials)
+	template.Compiled = nil
+	return template
+}
+
+// getSystemTemplate returns a built-in email template
+func getSystemTemplate(name string) (shared.Template, error) {
+	content, ok := shared.SystemTemplates[name]
+	if !ok {
+		return shared.Template{}, fmt.Errorf("unknown system template: %s", name)
+	}
+	return shared.Template{
+		Context:     "*",
+		TypeChannel: shared.BuildTypeChannel(name, shared.ChannelEmail),
+		Content:     content,
+	}, nil
+}
+
+// findTemplate looks up a template with user → global fallback. In each context the variants in languages are
+// tried in order, then the default template
+func (e *Engine) findTemplate(ctx context.Context, recipientID, notificationType, channel string, languages []string) (shared.Template, bool) {
+	// Deactivated templates and temporary ones past their expiry are skipped, as if they had been deleted
+	now := shared.GetCurrentTime()
+	candidates := append(slices.Clone(languages), "")
+
+	// Try user-specific templates first
+	for _, lang := range candidates {
+		userTemplate, err := e.templates.get(ctx, recipientID, shared.BuildTemplateKey(notificationType, channel, lang))
+		if err == nil && userTemplate.Context != "" && !userTemplate.IsExpired(now) && userTemplate.Active() {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", notificationType).Str("language", lang).Msg("Using user-specific template")
+			return userTemplate, true
+		}
+	}
+
+	// Fallback to global templates
+	for _, lang := range candidates {
+		globalTemplate, err := e.templates.get(ctx, "*", shared.BuildTemplateKey(notificationType, channel, lang))
+		if err == nil && globalTemplate.Context != "" && !globalTemplate.IsExpired(now) && globalTemplate.Active() {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", notificationType).Str("language", lang).Msg("Using global template fallback")
+			return globalTemplate, true
+		}
+	}
+
+	return shared.Template{}, false
+}
+
+// processTemplateForChannel renders a template for a specific channel
+func processTemplateForChannel(ctx context.Context, template shared.Template, channel string, variables map[string]any) (string, error) {
+	if template.Content == "" {
+		return "", fmt.Errorf("template content is empty")
+	}
+
+	shared.LogInfo(ctx).Str("channel", channel).Msg("Processing template for channel")
+
+	compiled := template.Compiled
+	if !compiled.IsCurrent() {
+		var err error
+		compiled, err = shared.CompileTemplate(channel, template.Content)
+		if err != nil {
+			return "", fmt.Errorf("failed to process template for channel %s: %w", channel, err)
+		}
+	}
+
+	// Parse template content based on channel
+	var processedContent string
+	var err error
+
+	// Markdown templates are converted for the channel once their variables are substituted
+	switch channel {
+	case shared.ChannelEmail:
+		processedContent, err = processEmailTemplate(ctx, compiled, variables, template.Format)
+	case shared.ChannelTeams:
+		processedContent, err = processTeamsTemplate(ctx, compiled, variables)
+	case shared.ChannelSlack, shared.ChannelInApp, shared.ChannelPush, shared.ChannelWebhook:
+		processedContent, err = renderTemplateParts(ctx, compiled.Body, variables)
+		processedContent = shared.ConvertMarkdown(template.Format, channel, processedContent)
+	case shared.ChannelSMS:
+		processedContent, err = renderTemplateParts(ctx, compiled.Body, variables)
+		processedContent = shared.ConvertMarkdown(template.Format, channel, processedContent)
+		if err == nil {
+			err = shared.CheckSMSLength(processedContent)
+		}
+	default:
+		return "", fmt.Errorf("unsupported channel: %s", channel)
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to process template for channel %s: %w", channel, err)
+	}
+
+	return processedContent, nil
+}
+
+// processEmailTemplate renders the subject, body, HTML body, preheader and headers of a compiled email template.
+// The body of a Markdown template becomes the HTML body and its plain-text alternative
+func processEmailTemplate(ctx context.Context, compiled *shared.CompiledTemplate, variables map[string]any, format string) (string, error) {
+	subject, err := renderTemplateParts(ctx, compiled.Subject, variables)
+	if err != nil {
+		return "", err
+	}
+	body, err := renderTemplateParts(ctx, compiled.Body, variables)
+	if err != nil {
+		return "", err
+	}
+
+	// Return as JSON
+	result := shared.EmailContent{
+		Subject: subject,
+		Body:    body,
+	}
+	if compiled.HTMLBody != nil {
+		if result.HTMLBody, err = renderTemplateParts(ctx, compiled.HTMLBody, variables); err != nil {
+			return "", err
+		}
+	}
+	if compiled.Preheader != nil {
+		if result.Preheader, err = renderTemplateParts(ctx, compiled.Preheader, variables); err != nil {
+			return "", err
+		}
+	}
+	for name, parts := range compiled.Headers {
+		value, err := renderTemplateParts(ctx, parts, variables)
+		if err != nil {
+			return "", err
+		}
+		if result.Headers == nil {
+			result.Headers = make(map[string]string, len(compiled.Headers))
+		}
+		result.Headers[name] = value
+	}
+	if format == shared.TemplateFormatMarkdown {
+		result.Subject = shared.MarkdownToText(subject)
+		result.HTMLBody = shared.MarkdownToHTML(body)
+		result.Body = shared.MarkdownToText(body)
+		result.Preheader = shared.MarkdownToText(result.Preheader)
+	}
+
+	resultBytes, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal processed email template: %w", err)
+	}
+
+	return string(resultBytes), nil
+}
+
+// processTeamsTemplate renders the title and text of a compiled Teams template
+func processTeamsTemplate(ctx context.Context, compiled *shared.CompiledTemplate, variables map[string]any) (string, error) {
+	title, err := renderTemplateParts(ctx, compiled.Subject, variables)
+	if err != nil {
+		return "", err
+	}
+	text, err := renderTemplateParts(ctx, compiled.Body, variables)
+	if err != nil {
+		return "", err
+	}
+	message := shared.TeamsMessage{Title: title, Text: text}
+
+	resultBytes, err := json.Marshal(message)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal processed Teams template: %w", err)
+	}
+
+	return string(resultBytes), nil
+}
+
+// renderTemplateParts substitutes template variables in compiled parts
+func renderTemplateParts(ctx context.Context, parts []shared.TemplatePart, variables map[string]any) (string, error) {
+	return shared.RenderTemplateParts(parts, variables, func(name string) {
+		// Replace missing variables with empty string as per requirements
+		shared.LogInfo(ctx).Str("variable", name).Msg("Template variable not found, replacing with empty string")
+	})
+}
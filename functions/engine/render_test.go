@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"context"
+	"notification-service/functions/shared"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func init() {
+	// Rendering logs every call at info level, keep the benchmark output readable
+	zerolog.SetGlobalLevel(zerolog.WarnLevel)
+}
+
+var benchVariables = map[string]any{
+	"title":     "Weekly usage report",
+	"message":   "Your team sent 1,204 notifications this week",
+	"userName":  "Ada",
+	"count":     1204,
+	"actionUrl": "https://example.com/reports/weekly",
+}
+
+const benchTextTemplate = "Hi {{userName}}, {{title}}: {{message}}. See {{actionUrl}} ({{count}} total)"
+
+const benchEmailTemplate = `{"subject":"{{title}}","body":"<p>Hi {{userName}},</p><p>{{message}}</p><p><a href=\"{{actionUrl}}\">Open the report</a></p>"}`
+
+const benchMarkdownEmailTemplate = `{"subject":"{{title}}","body":"Hi **{{userName}}**,\n\n{{message}}\n\n- Sent: {{count}}\n- [Open the report]({{actionUrl}})"}`
+
+func BenchmarkCompileTemplate(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := shared.CompileTemplate(shared.ChannelEmail, benchEmailTemplate); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRenderTemplateParts(b *testing.B) {
+	ctx := context.Background()
+	compiled, _ := shared.CompileTemplate(shared.ChannelSlack, benchTextTemplate)
+	b.ReportAllocs()
+	for b.Loop() {
+		renderTemplateParts(ctx, compiled.Body, benchVariables)
+	}
+}
+
+func BenchmarkRenderTemplatePartsLarge(b *testing.B) {
+	ctx := context.Background()
+	compiled, _ := shared.CompileTemplate(shared.ChannelSlack, strings.Repeat(benchTextTemplate+"\n", 100))
+	b.ReportAllocs()
+	for b.Loop() {
+		renderTemplateParts(ctx, compiled.Body, benchVariables)
+	}
+}
+
+func BenchmarkProcessEmailTemplate(b *testing.B) {
+	ctx := context.Background()
+	compiled, _ := shared.CompileTemplate(shared.ChannelEmail, benchEmailTemplate)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := processEmailTemplate(ctx, compiled, benchVariables, ""); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkProcessMarkdownEmailTemplate converts the rendered Markdown body to HTML and text on every render
+func BenchmarkProcessMarkdownEmailTemplate(b *testing.B) {
+	ctx := context.Background()
+	compiled, _ := shared.CompileTemplate(shared.ChannelEmail, benchMarkdownEmailTemplate)
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := processEmailTemplate(ctx, compiled, benchVariables, shared.TemplateFormatMarkdown); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkProcessTemplateForChannel renders stored templates, which carry their compiled form,
+// and templates that are compiled on every render
+func BenchmarkProcessTemplateForChannel(b *testing.B) {
+	ctx := context.Background()
+	templates := map[string]string{
+		shared.ChannelEmail: benchEmailTemplate,
+		shared.ChannelSlack: benchTextTemplate,
+		shared.ChannelInApp: benchTextTemplate,
+	}
+	for channel, content := range templates {
+		compiled, _ := shared.CompileTemplate(channel, content)
+		variants := map[string]shared.Template{
+			"compiled":   {Content: content, Compiled: compiled},
+			"uncompiled": {Content: content},
+		}
+		for variant, template := range variants {
+			b.Run(channel+"/"+variant, func(b *testing.B) {
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := processTemplateForChannel(ctx, template, channel, benchVariables); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
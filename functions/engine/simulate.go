@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"notification-service/functions/shared"
+	"slices"
+	"strings"
+)
+
+// Simulate renders the request for the recipient on each channel it would be delivered on, without sending
+// anything. Routing rules, quiet hours, daily caps and digests are not applied
+func (e *Engine) Simulate(ctx context.Context, recipient Recipient, request shared.NotificationRequest) shared.Simulation {
+	simulation := shared.Simulation{RecipientID: recipient.ID, Type: request.Type}
+	channels := e.Channels(ctx, recipient, request, nil)
+	if len(channels) == 0 {
+		simulation.Skipped = "no channel enabled for the type"
+		return simulation
+	}
+
+	variables := e.LocalizeVariables(ctx, recipient, request)
+	for _, channel := range channels {
+		simulation.Channels = append(simulation.Channels, e.simulateChannel(ctx, recipient, request, channel, variables))
+	}
+	return simulation
+}
+
+// simulateChannel renders the request for one channel, splitting email and Teams content into their parts
+func (e *Engine) simulateChannel(ctx context.Context, recipient Recipient, request shared.NotificationRequest, channel string, variables map[string]any) shared.ChannelSimulation {
+	result := shared.ChannelSimulation{Channel: channel}
+	template, err := e.Template(ctx, recipient, request, channel)
+	if err != nil {
+		result.Skipped = "no template"
+		return result
+	}
+	result.Template = template.Context + "/" + template.TypeChannel
+	result.MissingVariables = missingVariables(template.Content, variables)
+
+	content, err := e.Render(ctx, template, channel, variables)
+	if err != nil {
+		result.Skipped = "template failed to render: " + err.Error()
+		return result
+	}
+	switch channel {
+	case shared.ChannelEmail:
+		email, err := shared.ParseEmailContent(content)
+		if err != nil {
+			result.Skipped = "template failed to render: " + err.Error()
+			return result
+		}
+		result.Subject, result.Body, result.HTMLBody = email.Subject, email.Body, email.HTMLBody
+	case shared.ChannelTeams:
+		message := shared.ParseTeamsMessage(content)
+		result.Subject, result.Body = message.Title, message.Text
+	default:
+		result.Body = content
+	}
+	return result
+}
+
+// missingVariables returns the variables template content reads that are not set, each once
+func missingVariables(content string, variables map[string]any) []string {
+	var missing []string
+	for _, name := range shared.ExtractVariablesFromContent(content) {
+		root, _, _ := strings.Cut(name, ".")
+		if _, ok := variables[root]; !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
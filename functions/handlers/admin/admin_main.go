@@ -0,0 +1,1584 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/scheduler/types"
+	sestypes "github.com/aws/aws-sdk-go-v2/service/ses/types"
+	"github.com/google/uuid"
+)
+
+// Constants for consistency finding severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Constants for consistency finding categories
+const (
+	CategoryMissingTemplate    = "missing_template"
+	CategoryChannelSettings    = "channel_settings"
+	CategoryScheduleType       = "schedule_disabled_type"
+	CategoryUnregisteredTarget = "unregistered_template"
+	CategoryMissingPartial     = "missing_partial"
+	CategoryScheduleSync       = "schedule_sync"
+)
+
+const (
+	RequestIDPathParam     = "requestId"
+	UserIDPathParam        = "userId"
+	MessageIDPathParam     = "messageId"
+	LimitQueryParam        = "limit"
+	NextTokenQueryParam    = "nextToken"
+	CategoryQueryParam     = "category"
+	FromQueryParam         = "from"
+	ToQueryParam           = "to"
+	UserIDQueryParam       = "userId"
+	ContextQueryParam      = "context"
+	ProducerKindQueryParam = "producerKind"
+	ProducerIDQueryParam   = "producerId"
+	TypePathParam          = "type"
+	ExemptionIDPathParam   = "exemptionId"
+	StatusQueryParam       = "status"
+	TypeQueryParam         = "type"
+	TagQueryParam          = "tag"
+)
+
+// scheduleStateConcurrency bounds the EventBridge lookups of a schedule list page
+const scheduleStateConcurrency = 10
+
+// EventBridgeStateMissing is the EventBridge state of a schedule whose EventBridge schedule does not exist
+const EventBridgeStateMissing = "MISSING"
+
+// maxReportDays bounds the date range of usage and history reports
+const maxReportDays = 31
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Admin handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can access admin endpoints", nil), nil
+	}
+
+	switch {
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/consistency"):
+		return checkConsistency(ctx)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/notifications"):
+		return listNotificationHistory(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/admin/notifications/{requestId}/replay"):
+		return replayNotification(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/notifications/{requestId}/artifacts"):
+		return getNotificationArtifacts(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/admin/templates/rename-variable"):
+		return renameTemplateVariable(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/variable-schemas"):
+		return listVariableSchemas(ctx)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/variable-schemas/{type}"):
+		return getVariableSchema(ctx, event)
+	case event.HTTPMethod == http.MethodPut && strings.HasSuffix(event.Resource, "/admin/variable-schemas/{type}"):
+		return putVariableSchema(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodDelete && strings.HasSuffix(event.Resource, "/admin/variable-schemas/{type}"):
+		return deleteVariableSchema(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/schedules"):
+		return listSchedules(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/quarantine"):
+		return listQuarantinedMessages(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/quarantine/{messageId}"):
+		return getQuarantinedMessage(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/admin/quarantine/{messageId}/reprocess"):
+		return reprocessQuarantinedMessage(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/consent-report"):
+		return getConsentReport(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/usage"):
+		return getAPIUsage(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/email/provider-status"):
+		return getEmailProviderStatus(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/email/domain-status"):
+		return getEmailDomainStatus(ctx)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/throttle-exemptions"):
+		return listThrottleExemptions(ctx)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/admin/throttle-exemptions"):
+		return createThrottleExemption(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/admin/throttle-exemptions/{exemptionId}"):
+		return getThrottleExemption(ctx, event)
+	case event.HTTPMethod == http.MethodDelete && strings.HasSuffix(event.Resource, "/admin/throttle-exemptions/{exemptionId}"):
+		return deleteThrottleExemption(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/admin/users/{userId}/test-notification"):
+		return sendTestNotification(ctx, event, userContext)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+// ConsistencyFinding describes a configuration smell
+type ConsistencyFinding struct {
+	Severity string `json:"severity"`
+	Category string `json:"category"`
+	Resource string `json:"resource"`
+	Message  string `json:"message"`
+}
+
+// ConsistencyReport lists findings with a count per severity
+type ConsistencyReport struct {
+	Findings []ConsistencyFinding `json:"findings"`
+	Summary  map[string]int       `json:"summary"`
+	Count    int                  `json:"count"`
+}
+
+func (r *ConsistencyReport) add(severity, category, resource, message string) {
+	r.Findings = append(r.Findings, ConsistencyFinding{
+		Severity: severity,
+		Category: category,
+		Resource: resource,
+		Message:  message,
+	})
+	r.Summary[severity]++
+	r.Count++
+}
+
+func checkConsistency(ctx context.Context) (shared.APIResponse, error) {
+	templates, err := db.GetAllTemplates(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan templates")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve templates", nil), nil
+	}
+
+	preferences, err := db.GetAllUserPreferences(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan preferences")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
+	}
+
+	configs, err := db.GetAllSystemConfigs(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan configs")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve configs", nil), nil
+	}
+
+	schedules, err := db.GetAllScheduledNotifications(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan schedules")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve schedules", nil), nil
+	}
+
+	eventBridgeSchedules, err := shared.ListEventBridgeSchedules(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to list EventBridge schedules")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve EventBridge schedules", nil), nil
+	}
+
+	report := &ConsistencyReport{
+		Findings: make([]ConsistencyFinding, 0),
+		Summary:  map[string]int{SeverityError: 0, SeverityWarning: 0, SeverityInfo: 0},
+	}
+
+	checkPreferenceTemplates(report, preferences, templates)
+	checkConfigSettings(report, configs)
+	checkScheduleTypes(report, schedules, preferences)
+	checkTemplateTargets(report, templates)
+	checkScheduleSync(report, schedules, eventBridgeSchedules)
+
+	shared.LogInfo(ctx).Int("findings", report.Count).Int("errors", report.Summary[SeverityError]).Msg("Consistency check completed")
+
+	return shared.CreateAPIResponse(http.StatusOK, report), nil
+}
+
+// checkPreferenceTemplates reports enabled type/channel combinations with neither a context nor a global template
+func checkPreferenceTemplates(report *ConsistencyReport, preferences []shared.UserPreferences, templates []shared.Template) {
+	existing := make(map[string]bool, len(templates))
+	for _, template := range templates {
+		existing[template.Context+"|"+template.TypeChannel] = true
+	}
+
+	for _, prefs := range preferences {
+		for notificationType, prefItem := range prefs.Preferences {
+			if prefItem.Enabled == nil || !*prefItem.Enabled {
+				continue
+			}
+			for _, channel := range prefItem.Channels {
+				typeChannel := shared.BuildTypeChannel(notificationType, channel)
+				if existing[prefs.Context+"|"+typeChannel] || existing["*|"+typeChannel] {
+					continue
+				}
+
+				// A missing global template affects everyone falling back to global preferences
+				severity := SeverityWarning
+				if prefs.Context == "*" {
+					severity = SeverityError
+				}
+				report.add(severity, CategoryMissingTemplate, "preferences/"+prefs.Context,
+					fmt.Sprintf("%s is enabled but no template exists for it", typeChannel))
+			}
+		}
+	}
+}
+
+// checkConfigSettings reports channels enabled in config without the settings needed to deliver
+func checkConfigSettings(report *ConsistencyReport, configs []shared.SystemConfig) {
+	for _, config := range configs {
+		if config.Config == nil {
+			continue
+		}
+		settings := config.Config
+		resource := "config/" + config.Context
+
+		if isEnabled(settings.EmailSettings.Enabled) && config.Context == "*" && settings.EmailSettings.FromAddress == "" {
+			report.add(SeverityError, CategoryChannelSettings, resource, "email is enabled but no fromAddress is configured")
+		}
+		if isEnabled(settings.PushSettings.Enabled) && config.Context == "*" && len(settings.PushSettings.PlatformApplicationARNs) == 0 {
+			report.add(SeverityError, CategoryChannelSettings, resource, "push is enabled but no platformApplicationArns are configured")
+		}
+		// Slack and Teams webhooks, customer webhooks and in-app app IDs are per user, the global config cannot set them
+		if config.Context != "*" {
+			if isEnabled(settings.SlackSettings.Enabled) && settings.SlackSettings.WebhookURL == "" {
+				report.add(SeverityWarning, CategoryChannelSettings, resource, "slack is enabled but no webhookUrl is configured")
+			}
+			if isEnabled(settings.WebhookSettings.Enabled) && settings.WebhookSettings.URL == "" {
+				report.add(SeverityWarning, CategoryChannelSettings, resource, "webhook is enabled but no url is configured")
+			}
+			if isEnabled(settings.TeamsSettings.Enabled) && settings.TeamsSettings.WebhookURL == "" {
+				report.add(SeverityWarning, CategoryChannelSettings, resource, "teams is enabled but no webhookUrl is configured")
+			}
+			if isEnabled(settings.InAppSettings.Enabled) && len(settings.InAppSettings.PlatformAppIDs) == 0 {
+				report.add(SeverityInfo, CategoryChannelSettings, resource, "in_app is enabled but no platformAppIds are configured")
+			}
+		}
+	}
+}
+
+// checkScheduleTypes reports active schedules whose type is disabled in the owner's effective preferences
+func checkScheduleTypes(report *ConsistencyReport, schedules []shared.ScheduledNotification, preferences []shared.UserPreferences) {
+	byContext := make(map[string]shared.UserPreferences, len(preferences))
+	for _, prefs := range preferences {
+		byContext[prefs.Context] = prefs
+	}
+
+	for _, schedule := range schedules {
+		// Schedules for other recipients are not checked against the owner's preferences
+		if schedule.Status != shared.StatusActive || len(schedule.Recipients) > 0 || schedule.Segment != "" {
+			continue
+		}
+
+		prefs, ok := byContext[schedule.UserID]
+		if !ok {
+			prefs = byContext["*"]
+		}
+		prefItem, hasPref := prefs.Preferences[schedule.Type]
+		if !hasPref || !isEnabled(prefItem.Enabled) {
+			report.add(SeverityWarning, CategoryScheduleType, "schedules/"+schedule.ScheduleID,
+				fmt.Sprintf("active schedule sends %s notifications, which are disabled for user %s", schedule.Type, schedule.UserID))
+		}
+	}
+}
+
+// checkTemplateTargets reports templates for notification types or channels the service does not know, and
+// templates including partials that do not exist
+func checkTemplateTargets(report *ConsistencyReport, templates []shared.Template) {
+	existing := make(map[string]bool, len(templates))
+	for _, template := range templates {
+		existing[template.Context+"|"+template.TypeChannel] = true
+	}
+
+	for _, template := range templates {
+		notificationType, channel := shared.ParseTypeChannel(template.TypeChannel)
+		resource := "templates/" + template.Context + "/" + template.TypeChannel
+
+		// Partials included by the template must exist in its context or globally, or render empty
+		for _, name := range shared.PartialNames(template.Content) {
+			typeChannel := shared.PartialTypeChannel(name)
+			if !existing[template.Context+"|"+typeChannel] && !existing["*|"+typeChannel] {
+				report.add(SeverityWarning, CategoryMissingPartial, resource, fmt.Sprintf("template includes missing partial %q", name))
+			}
+		}
+
+		if template.IsPartial() {
+			continue
+		}
+		if !shared.ValidateNotificationType(notificationType) {
+			report.add(SeverityInfo, CategoryUnregisteredTarget, resource, fmt.Sprintf("template is for unregistered type %q", notificationType))
+		} else if !shared.ValidateChannel(channel) {
+			report.add(SeverityInfo, CategoryUnregisteredTarget, resource, fmt.Sprintf("template is for unregistered channel %q", channel))
+		}
+	}
+}
+
+// checkScheduleSync reconciles stored schedules with the EventBridge schedules in the service's groups
+func checkScheduleSync(report *ConsistencyReport, schedules []shared.ScheduledNotification, eventBridgeSchedules map[string]types.ScheduleSummary) {
+	stored := make(map[string]bool, len(schedules))
+	for _, schedule := range schedules {
+		stored[schedule.ScheduleID] = true
+		resource := "schedules/" + schedule.ScheduleID
+
+		summary, exists := eventBridgeSchedules[schedule.ScheduleID]
+		switch {
+		case schedule.Status == shared.StatusCancelled:
+			continue
+		case !exists:
+			report.add(SeverityError, CategoryScheduleSync, resource, fmt.Sprintf("%s schedule has no EventBridge schedule", schedule.Status))
+		case schedule.Status == shared.StatusActive && summary.State != types.ScheduleStateEnabled:
+			report.add(SeverityWarning, CategoryScheduleSync, resource, "active schedule is disabled in EventBridge")
+		case schedule.Status == shared.StatusPaused && summary.State == types.ScheduleStateEnabled:
+			report.add(SeverityWarning, CategoryScheduleSync, resource, "paused schedule is still enabled in EventBridge")
+		}
+	}
+
+	for scheduleID, summary := range eventBridgeSchedules {
+		// Digest, deferral, overflow and bounce retry schedules are managed by the service and have no stored record
+		if stored[scheduleID] || strings.HasPrefix(scheduleID, shared.DigestScheduleIDPrefix) || strings.HasPrefix(scheduleID, shared.DeferredScheduleIDPrefix) ||
+			strings.HasPrefix(scheduleID, shared.OverflowScheduleIDPrefix) || strings.HasPrefix(scheduleID, shared.BounceRetryScheduleIDPrefix) {
+			continue
+		}
+		report.add(SeverityWarning, CategoryScheduleSync, "eventbridge/"+aws.ToString(summary.Name), "EventBridge schedule has no stored schedule")
+	}
+}
+
+// ArtifactBundle collects everything recorded about a processed request
+type ArtifactBundle struct {
+	RequestID       string                      `json:"requestId"`
+	Request         *shared.NotificationRequest `json:"request,omitempty"`
+	TotalRecipients int                         `json:"totalRecipients"`
+	SuccessCount    int                         `json:"successCount"`
+	FailureCount    int                         `json:"failureCount"`
+	Decisions       []shared.DeliveryResult     `json:"decisions"`
+	Payloads        []RenderedPayload           `json:"payloads"`
+	ProcessedAt     *time.Time                  `json:"processedAt,omitempty"`
+}
+
+// RenderedPayload is the content rendered for one recipient and channel along with the delivery outcome
+type RenderedPayload struct {
+	RecipientID       string     `json:"recipientId"`
+	Channel           string     `json:"channel,omitempty"`
+	Content           string     `json:"content,omitempty"`
+	ContentHash       string     `json:"contentHash,omitempty"`
+	Suppressed        bool       `json:"suppressed,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	CreatedAt         *time.Time `json:"createdAt,omitempty"`
+	ProviderMessageID string     `json:"providerMessageId,omitempty"`
+	ResponseStatus    int        `json:"responseStatus,omitempty"`
+	ResponseBody      string     `json:"responseBody,omitempty"`
+}
+
+// getNotificationArtifacts returns the stored request, the per recipient and channel decisions and the rendered
+// payloads as one bundle. Payloads come from the validation table and are only available until it expires them
+func getNotificationArtifacts(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	requestID := event.PathParameters[RequestIDPathParam]
+	if requestID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Request ID is required", nil), nil
+	}
+
+	history, err := db.GetNotificationHistory(ctx, requestID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationRequestId", requestID).Msg("Failed to get notification history")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification history", nil), nil
+	}
+	if history.ID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification not found", nil), nil
+	}
+
+	bundle := ArtifactBundle{
+		RequestID:       history.ID,
+		Request:         history.Request,
+		TotalRecipients: history.TotalRecipients,
+		SuccessCount:    history.SuccessCount,
+		FailureCount:    history.FailureCount,
+		Decisions:       history.Deliveries,
+		Payloads:        make([]RenderedPayload, 0, len(history.Deliveries)),
+		ProcessedAt:     history.CreatedAt,
+	}
+	if bundle.Decisions == nil {
+		bundle.Decisions = []shared.DeliveryResult{}
+	}
+
+	notificationType := history.Type
+	if notificationType == "" && history.Request != nil {
+		notificationType = history.Request.Type
+	}
+	for _, delivery := range history.Deliveries {
+		validation, err := db.GetNotificationValidation(ctx, shared.BuildIDUserIDTypeChannel(history.ID, delivery.RecipientID, notificationType, delivery.Channel))
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("notificationRequestId", requestID).Str("recipientId", delivery.RecipientID).Msg("Failed to get notification validation")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve rendered payloads", nil), nil
+		}
+		if validation.IDUserIDTypeChannel == "" {
+			continue
+		}
+		bundle.Payloads = append(bundle.Payloads, RenderedPayload{
+			RecipientID:       delivery.RecipientID,
+			Channel:           delivery.Channel,
+			Content:           validation.Content,
+			ContentHash:       validation.ContentHash,
+			Suppressed:        validation.Suppressed,
+			Error:             validation.Error,
+			CreatedAt:         validation.CreatedAt,
+			ProviderMessageID: validation.ProviderMessageID,
+			ResponseStatus:    validation.ResponseStatus,
+			ResponseBody:      validation.ResponseBody,
+		})
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, bundle), nil
+}
+
+type ReplayRequest struct {
+	FailedOnly bool `json:"failedOnly,omitempty"` // Only replay the recipients and channels that failed
+}
+
+type ReplayResponse struct {
+	RequestIDs []string `json:"requestIds"`
+	Recipients int      `json:"recipients"`
+}
+
+// listNotificationHistory lists the processed requests created between from and to oldest first, optionally only those of a
+// producerKind and producerId, with their outcome counts but without their request and deliveries
+func listNotificationHistory(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	fromDate, toDate, errResponse := parseDateRange(event)
+	if errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	producerKind := event.QueryStringParameters[ProducerKindQueryParam]
+	if producerKind != "" && !shared.ValidateProducerKind(producerKind) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid producer kind", nil), nil
+	}
+	producerID := event.QueryStringParameters[ProducerIDQueryParam]
+	if producerID != "" && producerKind == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Producer kind is required with a producer ID", nil), nil
+	}
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	histories, nextKey, err := db.GetNotificationHistoryList(ctx, fromDate, toDate.AddDate(0, 0, 1), producerKind, producerID, limit, event.QueryStringParameters[NextTokenQueryParam])
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get notification history")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification history", nil), nil
+	}
+
+	response := shared.PaginatedResponse{
+		Items:     histories,
+		Count:     len(histories),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+// AdminSchedule is a stored schedule with the state of its EventBridge schedule
+type AdminSchedule struct {
+	shared.ScheduledNotification
+	EventBridgeState string `json:"eventBridgeState,omitempty"` // "ENABLED" | "DISABLED" | "MISSING", not looked up for cancelled schedules
+}
+
+// listSchedules lists the schedules of every user, optionally filtered by status, type, user and tags
+func listSchedules(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	status := event.QueryStringParameters[StatusQueryParam]
+	if status != "" && status != shared.StatusActive && status != shared.StatusPaused && status != shared.StatusCancelled {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid status", nil), nil
+	}
+	notificationType := event.QueryStringParameters[TypeQueryParam]
+	if notificationType != "" && !shared.ValidateNotificationType(notificationType) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type", nil), nil
+	}
+	tags, err := shared.ParseTagFilter(event.QueryStringParameters[TagQueryParam])
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	schedules, nextKey, err := db.GetScheduledNotificationsList(ctx, event.QueryStringParameters[UserIDQueryParam], status, notificationType,
+		tags, limit, event.QueryStringParameters[NextTokenQueryParam])
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get schedules")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve schedules", nil), nil
+	}
+
+	// Cancelled schedules have no EventBridge schedule left, the others are looked up concurrently
+	items := make([]AdminSchedule, len(schedules))
+	slots := make(chan struct{}, scheduleStateConcurrency)
+	var wg sync.WaitGroup
+	for i, schedule := range schedules {
+		items[i].ScheduledNotification = schedule
+		if schedule.Status == shared.StatusCancelled {
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			state, err := shared.GetEventBridgeScheduleState(ctx, schedule.UserID, schedule.ScheduleID)
+			if err != nil {
+				shared.LogWarn(ctx).Err(err).Str("scheduleID", schedule.ScheduleID).Msg("Failed to get EventBridge schedule state")
+				return
+			}
+			items[i].EventBridgeState = cmp.Or(string(state), EventBridgeStateMissing)
+		}()
+	}
+	wg.Wait()
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items:     items,
+		Count:     len(items),
+		NextToken: nextKey,
+	}), nil
+}
+
+// replayNotification re-enqueues a processed request from its history record. With failedOnly each
+// failed recipient is replayed on its own, restricted to the channels that failed for it
+func replayNotification(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	requestID := event.PathParameters[RequestIDPathParam]
+	if requestID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Request ID is required", nil), nil
+	}
+
+	var request ReplayRequest
+	if event.Body != "" {
+		if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+		}
+	}
+
+	history, err := db.GetNotificationHistory(ctx, requestID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationRequestId", requestID).Msg("Failed to get notification history")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification history", nil), nil
+	}
+	if history.ID == "" || history.Request == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification not found", nil), nil
+	}
+
+	replayID := fmt.Sprintf("%s-replay-%d", requestID, shared.GetCurrentTime().Unix())
+	var replays []shared.NotificationRequest
+	if request.FailedOnly {
+		replays = buildFailedReplays(*history.Request, history.Deliveries, replayID)
+		if len(replays) == 0 {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Notification has no failed deliveries", nil), nil
+		}
+	} else {
+		replay := *history.Request
+		replay.ID = replayID
+		replay.ReplayOf = requestID
+		replays = []shared.NotificationRequest{replay}
+	}
+
+	response := ReplayResponse{RequestIDs: make([]string, 0, len(replays))}
+	for i := range replays {
+		replays[i].Producer = &shared.Producer{Kind: shared.ProducerAPIUser, ID: userContext.UserID}
+		// A replay is sent on purpose, the producer's dedup key would suppress it
+		replays[i].DedupKey, replays[i].DedupWindowSeconds = "", 0
+		response.RequestIDs = append(response.RequestIDs, replays[i].ID)
+		response.Recipients += len(replays[i].Recipients)
+	}
+
+	if err := services.EnqueueNotificationRequests(ctx, replays); err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationRequestId", requestID).Msg("Failed to queue replay")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to queue replay", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("notificationRequestId", requestID).Str("adminId", userContext.UserID).Bool("failedOnly", request.FailedOnly).Int("replays", len(replays)).Msg("Notification replayed")
+
+	return shared.CreateAPIResponse(http.StatusAccepted, response), nil
+}
+
+// buildFailedReplays creates one request per recipient with failed deliveries. A recipient that failed
+// before any channel was attempted is replayed on all channels
+func buildFailedReplays(original shared.NotificationRequest, deliveries []shared.DeliveryResult, replayID string) []shared.NotificationRequest {
+	var recipients []string
+	failedChannels := make(map[string][]string)
+	allChannels := make(map[string]bool)
+	for _, delivery := range deliveries {
+		if delivery.Success {
+			continue
+		}
+		if _, seen := failedChannels[delivery.RecipientID]; !seen {
+			recipients = append(recipients, delivery.RecipientID)
+			failedChannels[delivery.RecipientID] = nil
+		}
+		if delivery.Channel == "" {
+			allChannels[delivery.RecipientID] = true
+			continue
+		}
+		failedChannels[delivery.RecipientID] = append(failedChannels[delivery.RecipientID], delivery.Channel)
+	}
+
+	replays := make([]shared.NotificationRequest, 0, len(recipients))
+	for i, recipientID := range recipients {
+		replay := original
+		replay.ID = fmt.Sprintf("%s-%d", replayID, i+1)
+		replay.ReplayOf = original.ID
+		replay.Recipients = []string{recipientID}
+		replay.Segment = ""
+		replay.Channels = nil
+		if !allChannels[recipientID] {
+			replay.Channels = failedChannels[recipientID]
+		}
+		replays = append(replays, replay)
+	}
+	return replays
+}
+
+type TestNotificationRequest struct {
+	Type      string         `json:"type"`
+	Variables map[string]any `json:"variables,omitempty"` // Override the sample values
+	Channels  []string       `json:"channels,omitempty"`  // Restricts the test to these channels
+}
+
+type TestNotificationResponse struct {
+	RequestID string         `json:"requestId"`
+	UserID    string         `json:"userId"`
+	Type      string         `json:"type"`
+	Variables map[string]any `json:"variables"`
+}
+
+// sendTestNotification sends a notification type to one user through the full pipeline with sample variables,
+// so support can check the user's channel wiring end to end. The user's preferences and config decide the
+// channels as for any notification; the delivery is marked as a test and is never held, deferred or deduplicated.
+// The outcome is in the request's history and artifacts like any other request
+func sendTestNotification(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	targetUserID := event.PathParameters[UserIDPathParam]
+	if targetUserID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "User ID is required", nil), nil
+	}
+
+	var request TestNotificationRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if !shared.ValidateNotificationType(request.Type) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type", nil), nil
+	}
+	for _, channel := range request.Channels {
+		if !shared.ValidateChannel(channel) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid channel: "+channel, nil), nil
+		}
+	}
+
+	user, err := db.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+	}
+	if user == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+	}
+
+	schema, err := db.GetVariableSchema(ctx, request.Type)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", request.Type).Msg("Failed to get variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template variables", nil), nil
+	}
+	variables := shared.SampleVariables(schema)
+	maps.Copy(variables, request.Variables)
+
+	notification := shared.NotificationRequest{
+		ID:         shared.TestRequestIDPrefix + uuid.New().String(),
+		Type:       request.Type,
+		Recipients: []string{targetUserID},
+		Variables:  variables,
+		Channels:   request.Channels,
+		Test:       true,
+		Producer:   &shared.Producer{Kind: shared.ProducerAPIUser, ID: userContext.UserID},
+	}
+	if err := services.EnqueueNotificationRequests(ctx, []shared.NotificationRequest{notification}); err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to queue test notification")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to queue test notification", nil), nil
+	}
+
+	shared.LogAudit(ctx, "test_notification").Str("targetUserId", targetUserID).Str("type", request.Type).
+		Str("notificationRequestId", notification.ID).Msg("Test notification sent")
+
+	return shared.CreateAPIResponse(http.StatusAccepted, TestNotificationResponse{
+		RequestID: notification.ID,
+		UserID:    targetUserID,
+		Type:      request.Type,
+		Variables: variables,
+	}), nil
+}
+
+// VariableSchemaRequest replaces the variables declared for a notification type
+type VariableSchemaRequest struct {
+	Variables []shared.VariableDefinition `json:"variables"`
+}
+
+// listVariableSchemas returns the variable schema of every notification type, stored or default
+func listVariableSchemas(ctx context.Context) (shared.APIResponse, error) {
+	notificationTypes := shared.NotificationTypeNames()
+	schemas := make([]shared.VariableSchema, 0, len(notificationTypes))
+	for _, notificationType := range notificationTypes {
+		schema, err := db.GetVariableSchema(ctx, notificationType)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("type", notificationType).Msg("Failed to get variable schema")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve variable schemas", nil), nil
+		}
+		schemas = append(schemas, schema)
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items: schemas,
+		Count: len(schemas),
+	}), nil
+}
+
+func getVariableSchema(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	notificationType := event.PathParameters[TypePathParam]
+	if !shared.ValidateNotificationType(notificationType) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	schema, err := db.GetVariableSchema(ctx, notificationType)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", notificationType).Msg("Failed to get variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve variable schema", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, schema), nil
+}
+
+// putVariableSchema replaces the variables declared for a notification type. Templates are checked against
+// the new schema when they are next saved, and requests as soon as processors refresh their cache
+func putVariableSchema(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	notificationType := event.PathParameters[TypePathParam]
+	if !shared.ValidateNotificationType(notificationType) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	var request VariableSchemaRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if request.Variables == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "variables is required", nil), nil
+	}
+
+	existing, err := db.GetVariableSchema(ctx, notificationType)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", notificationType).Msg("Failed to get variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve variable schema", nil), nil
+	}
+
+	schema := shared.VariableSchema{
+		Type:      notificationType,
+		Variables: request.Variables,
+		UpdatedBy: userContext.UserID,
+		CreatedAt: existing.CreatedAt,
+	}
+	if err := schema.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid variable schema: "+err.Error(), nil), nil
+	}
+
+	schema, err = db.PutVariableSchema(ctx, schema)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", notificationType).Msg("Failed to store variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to store variable schema", nil), nil
+	}
+
+	shared.LogAudit(ctx, "variable_schema.update").Str("type", notificationType).Int("variables", len(schema.Variables)).Msg("Variable schema updated")
+
+	return shared.CreateAPIResponse(http.StatusOK, schema), nil
+}
+
+// deleteVariableSchema removes the stored schema of a notification type, which goes back to its defaults
+func deleteVariableSchema(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	notificationType := event.PathParameters[TypePathParam]
+	if !shared.ValidateNotificationType(notificationType) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	if err := db.DeleteVariableSchema(ctx, notificationType); err != nil {
+		shared.LogError(ctx).Err(err).Str("type", notificationType).Msg("Failed to delete variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete variable schema", nil), nil
+	}
+
+	shared.LogAudit(ctx, "variable_schema.delete").Str("type", notificationType).Msg("Variable schema deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Variable schema deleted successfully"}), nil
+}
+
+type ThrottleExemptionRequest struct {
+	Scope        string `json:"scope"`
+	UserID       string `json:"userId,omitempty"`
+	ProducerKind string `json:"producerKind,omitempty"`
+	ProducerID   string `json:"producerId,omitempty"`
+	Reason       string `json:"reason"`
+}
+
+// listThrottleExemptions returns every throttle exemption
+func listThrottleExemptions(ctx context.Context) (shared.APIResponse, error) {
+	exemptions, err := db.GetThrottleExemptions(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get throttle exemptions")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve throttle exemptions", nil), nil
+	}
+	if exemptions == nil {
+		exemptions = []shared.ThrottleExemption{}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items: exemptions,
+		Count: len(exemptions),
+	}), nil
+}
+
+// createThrottleExemption exempts a user or a producer from daily caps, the email warm-up limit and content
+// dedup. The processor picks it up within THROTTLE_EXEMPTIONS_CACHE_TTL
+func createThrottleExemption(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request ThrottleExemptionRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	exemption := shared.ThrottleExemption{
+		Scope:        request.Scope,
+		UserID:       request.UserID,
+		ProducerKind: request.ProducerKind,
+		ProducerID:   request.ProducerID,
+		Reason:       request.Reason,
+		CreatedBy:    userContext.UserID,
+	}
+	if err := exemption.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid throttle exemption: "+err.Error(), nil), nil
+	}
+
+	if exemption.Scope == shared.ExemptionScopeUser {
+		user, err := db.GetUserByID(ctx, exemption.UserID)
+		if err != nil {
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+		}
+		if user == nil {
+			return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+		}
+	}
+
+	created, err := db.CreateThrottleExemption(ctx, exemption)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("subject", exemption.Subject()).Msg("Failed to create throttle exemption")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create throttle exemption", nil), nil
+	}
+	if !created {
+		return shared.CreateErrorResponse(http.StatusConflict, "Throttle exemption already exists", map[string]any{
+			"exemptionId": exemption.ExemptionID,
+		}), nil
+	}
+
+	shared.LogAudit(ctx, "throttle_exemption.create").Str("exemptionId", exemption.ExemptionID).
+		Str("subject", exemption.Subject()).Str("reason", exemption.Reason).Msg("Throttle exemption created")
+
+	return shared.CreateAPIResponse(http.StatusCreated, exemption), nil
+}
+
+func getThrottleExemption(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	exemptionID := event.PathParameters[ExemptionIDPathParam]
+	exemption, err := db.GetThrottleExemption(ctx, exemptionID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("exemptionId", exemptionID).Msg("Failed to get throttle exemption")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve throttle exemption", nil), nil
+	}
+	if exemption.ExemptionID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Throttle exemption not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, exemption), nil
+}
+
+func deleteThrottleExemption(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	exemptionID := event.PathParameters[ExemptionIDPathParam]
+	exemption, err := db.GetThrottleExemption(ctx, exemptionID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("exemptionId", exemptionID).Msg("Failed to get throttle exemption")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve throttle exemption", nil), nil
+	}
+	if exemption.ExemptionID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Throttle exemption not found", nil), nil
+	}
+
+	if err := db.DeleteThrottleExemption(ctx, exemptionID); err != nil {
+		shared.LogError(ctx).Err(err).Str("exemptionId", exemptionID).Msg("Failed to delete throttle exemption")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete throttle exemption", nil), nil
+	}
+
+	shared.LogAudit(ctx, "throttle_exemption.delete").Str("exemptionId", exemptionID).
+		Str("subject", exemption.Subject()).Msg("Throttle exemption deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Throttle exemption deleted successfully"}), nil
+}
+
+type RenameVariableRequest struct {
+	Type   string `json:"type"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	DryRun bool   `json:"dryRun,omitempty"`
+}
+
+// TemplateChange describes the rewrite of one template. Diff lists the changed lines prefixed with - and +
+type TemplateChange struct {
+	Context     string   `json:"context"`
+	TypeChannel string   `json:"typeChannel"`
+	Diff        []string `json:"diff"`
+}
+
+type RenameVariableResponse struct {
+	Type      string           `json:"type"`
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	DryRun    bool             `json:"dryRun"`
+	Changes   []TemplateChange `json:"changes"`
+	Variables []string         `json:"variables"` // Allowed variables for the type after the rename
+}
+
+// renameTemplateVariable rewrites {{from}} to {{to}} in every template of the type and renames the variable in
+// the type's registry. Templates are rewritten before the registry so a failed run can simply be repeated
+func renameTemplateVariable(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request RenameVariableRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if !shared.ValidateNotificationType(request.Type) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid notification type is required", nil), nil
+	}
+	if request.From == "" || request.To == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Both from and to are required", nil), nil
+	}
+	if request.From == request.To {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "from and to must differ", nil), nil
+	}
+	if !shared.ValidVariableName(request.To) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid variable name: "+request.To, nil), nil
+	}
+
+	schema, err := db.GetVariableSchema(ctx, request.Type)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", request.Type).Msg("Failed to get variable schema")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve allowed variables", nil), nil
+	}
+	variables := schema.Names()
+	if !slices.Contains(variables, request.From) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Variable %s is not registered for type %s", request.From, request.Type), nil), nil
+	}
+	if slices.Contains(variables, request.To) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Variable %s is already registered for type %s", request.To, request.Type), nil), nil
+	}
+
+	templates, err := db.GetAllTemplates(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get templates")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve templates", nil), nil
+	}
+
+	renamed := slices.Clone(variables)
+	renamed[slices.Index(renamed, request.From)] = request.To
+
+	response := RenameVariableResponse{
+		Type:      request.Type,
+		From:      request.From,
+		To:        request.To,
+		DryRun:    request.DryRun,
+		Changes:   make([]TemplateChange, 0),
+		Variables: renamed,
+	}
+
+	placeholder := "{{" + request.From + "}}"
+	for _, template := range templates {
+		notificationType, _ := shared.ParseTypeChannel(template.TypeChannel)
+		if notificationType != request.Type || !strings.Contains(template.Content, placeholder) {
+			continue
+		}
+		content := strings.ReplaceAll(template.Content, placeholder, "{{"+request.To+"}}")
+		response.Changes = append(response.Changes, TemplateChange{
+			Context:     template.Context,
+			TypeChannel: template.TypeChannel,
+			Diff:        diffLines(template.Content, content),
+		})
+		if request.DryRun {
+			continue
+		}
+		if _, err := db.UpdateTemplate(ctx, shared.Template{
+			Context:     template.Context,
+			TypeChannel: template.TypeChannel,
+			Content:     content,
+		}); err != nil {
+			shared.LogError(ctx).Err(err).Str("context", template.Context).Str("typeChannel", template.TypeChannel).Msg("Failed to rewrite template")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to rewrite templates, the rename can be retried", nil), nil
+		}
+	}
+
+	if request.DryRun {
+		return shared.CreateAPIResponse(http.StatusOK, response), nil
+	}
+
+	// The renamed variable keeps its type and whether it is required
+	for i := range schema.Variables {
+		if schema.Variables[i].Name == request.From {
+			schema.Variables[i].Name = request.To
+		}
+	}
+	schema.UpdatedBy = userContext.UserID
+	if _, err := db.PutVariableSchema(ctx, schema); err != nil {
+		shared.LogError(ctx).Err(err).Str("type", request.Type).Msg("Failed to update allowed variables")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update allowed variables, the rename can be retried", nil), nil
+	}
+	if err := db.BumpTemplatesVersion(ctx); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to bump templates version, processor caches will refresh on TTL")
+	}
+
+	shared.LogInfo(ctx).Str("type", request.Type).Str("from", request.From).Str("to", request.To).Str("adminId", userContext.UserID).Int("templates", len(response.Changes)).Msg("Template variable renamed")
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+// diffLines lists the lines that differ between two versions with the same number of lines
+func diffLines(before, after string) []string {
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+	var diff []string
+	for i := range beforeLines {
+		if beforeLines[i] != afterLines[i] {
+			diff = append(diff, "- "+beforeLines[i], "+ "+afterLines[i])
+		}
+	}
+	return diff
+}
+
+func isEnabled(enabled *bool) bool {
+	return enabled != nil && *enabled
+}
+
+func listQuarantinedMessages(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	messages, nextKey, err := db.GetQuarantinedMessagesList(ctx, limit, event.QueryStringParameters[NextTokenQueryParam])
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get quarantined messages")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve quarantined messages", nil), nil
+	}
+
+	response := shared.PaginatedResponse{
+		Items:     messages,
+		Count:     len(messages),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func getQuarantinedMessage(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	messageID := event.PathParameters[MessageIDPathParam]
+	if messageID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Message ID is required", nil), nil
+	}
+
+	message, err := db.GetQuarantinedMessage(ctx, messageID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", messageID).Msg("Failed to get quarantined message")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve quarantined message", nil), nil
+	}
+	if message.MessageID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Quarantined message not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, message), nil
+}
+
+// reprocessQuarantinedMessage puts the message body back on the notification queue, where it arrives
+// as a new message with a fresh receive count, and removes it from quarantine
+func reprocessQuarantinedMessage(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	messageID := event.PathParameters[MessageIDPathParam]
+	if messageID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Message ID is required", nil), nil
+	}
+
+	message, err := db.GetQuarantinedMessage(ctx, messageID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", messageID).Msg("Failed to get quarantined message")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve quarantined message", nil), nil
+	}
+	if message.MessageID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Quarantined message not found", nil), nil
+	}
+
+	if err := services.SqsSendMessages(ctx, shared.NotificationQueueURL, []string{message.Body}); err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", messageID).Msg("Failed to requeue quarantined message")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to requeue message", nil), nil
+	}
+
+	if err := db.DeleteQuarantinedMessage(ctx, messageID); err != nil {
+		// The message is already requeued, a leftover entry only risks a second reprocess
+		shared.LogError(ctx).Err(err).Str("messageId", messageID).Msg("Failed to remove message from quarantine")
+	}
+
+	shared.LogInfo(ctx).Str("messageId", messageID).Str("adminId", userContext.UserID).Msg("Quarantined message reprocessed")
+
+	return shared.CreateAPIResponse(http.StatusAccepted, shared.SuccessResponse{Message: "Message requeued"}), nil
+}
+
+// ConsentReportEntry is one user's recorded consent for a category
+type ConsentReportEntry struct {
+	UserID    string     `json:"userId"`
+	Category  string     `json:"category"`
+	Status    string     `json:"status"` // "granted" | "revoked"
+	GrantedAt *time.Time `json:"grantedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// ConsentReport lists every recorded consent with the number of users per category and status
+type ConsentReport struct {
+	GeneratedAt time.Time                 `json:"generatedAt"`
+	Entries     []ConsentReportEntry      `json:"entries"`
+	Summary     map[string]map[string]int `json:"summary"`
+	Count       int                       `json:"count"`
+}
+
+// getConsentReport reports the consent recorded in user preferences, optionally for one category.
+// Users without a record are left out: they never received marketing and still receive product updates
+func getConsentReport(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	category := event.QueryStringParameters[CategoryQueryParam]
+	if category != "" && !shared.ValidateCategory(category) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid category: "+category, nil), nil
+	}
+
+	preferences, err := db.GetAllUserPreferences(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan preferences")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
+	}
+
+	report := ConsentReport{
+		GeneratedAt: shared.GetCurrentTime(),
+		Entries:     []ConsentReportEntry{},
+		Summary:     make(map[string]map[string]int),
+	}
+	for _, pref := range preferences {
+		for _, consentCategory := range slices.Sorted(maps.Keys(pref.Consent)) {
+			if category != "" && consentCategory != category {
+				continue
+			}
+			consent := pref.Consent[consentCategory]
+			status := shared.ConsentRevoked
+			if consent.Granted {
+				status = shared.ConsentGranted
+			}
+			report.Entries = append(report.Entries, ConsentReportEntry{
+				UserID:    pref.Context,
+				Category:  consentCategory,
+				Status:    status,
+				GrantedAt: consent.GrantedAt,
+				RevokedAt: consent.RevokedAt,
+			})
+			if report.Summary[consentCategory] == nil {
+				report.Summary[consentCategory] = make(map[string]int)
+			}
+			report.Summary[consentCategory][status]++
+		}
+	}
+	slices.SortStableFunc(report.Entries, func(a, b ConsentReportEntry) int {
+		return strings.Compare(a.UserID, b.UserID)
+	})
+	report.Count = len(report.Entries)
+
+	shared.LogAudit(ctx, "consent_report").Str("category", category).Int("count", report.Count).Msg("Consent report generated")
+
+	return shared.CreateAPIResponse(http.StatusOK, report), nil
+}
+
+// EndpointUsage counts the calls to one endpoint
+type EndpointUsage struct {
+	Endpoint   string `json:"endpoint"`
+	Count      int    `json:"count"`
+	ErrorCount int    `json:"errorCount"`
+}
+
+// CallerUsage is one caller's API usage over the report's range
+type CallerUsage struct {
+	UserID     string          `json:"userId"`
+	Count      int             `json:"count"`
+	ErrorCount int             `json:"errorCount"`
+	Days       map[string]int  `json:"days"`      // Calls per day, a burst stands out against the caller's usual volume
+	Endpoints  []EndpointUsage `json:"endpoints"` // Busiest first
+}
+
+// UsageReport is the API usage of every caller, or of one, between two dates
+type UsageReport struct {
+	From       string        `json:"from"`
+	To         string        `json:"to"`
+	Count      int           `json:"count"`
+	ErrorCount int           `json:"errorCount"`
+	Callers    []CallerUsage `json:"callers"` // Busiest first
+}
+
+// parseDateRange reads the from and to query parameters (YYYY-MM-DD, inclusive, the last 7 days by default)
+// of a report spanning at most maxReportDays
+func parseDateRange(event events.APIGatewayProxyRequest) (time.Time, time.Time, shared.APIResponse) {
+	now := shared.GetCurrentTime()
+	from := event.QueryStringParameters[FromQueryParam]
+	to := event.QueryStringParameters[ToQueryParam]
+	if to == "" {
+		to = now.Format(shared.DateFormat)
+	}
+	if from == "" {
+		from = now.AddDate(0, 0, -6).Format(shared.DateFormat)
+	}
+	fromDate, err := time.Parse(shared.DateFormat, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, shared.CreateErrorResponse(http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD", nil)
+	}
+	toDate, err := time.Parse(shared.DateFormat, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, shared.CreateErrorResponse(http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD", nil)
+	}
+	if fromDate.After(toDate) {
+		return time.Time{}, time.Time{}, shared.CreateErrorResponse(http.StatusBadRequest, "From date must not be after to date", nil)
+	}
+	if toDate.Sub(fromDate) >= maxReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Date range must not exceed %d days", maxReportDays), nil)
+	}
+	return fromDate, toDate, shared.APIResponse{}
+}
+
+// getAPIUsage reports the API calls per caller and endpoint between from and to, optionally for a single userId
+func getAPIUsage(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	fromDate, toDate, errResponse := parseDateRange(event)
+	if errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	userID := event.QueryStringParameters[UserIDQueryParam]
+
+	callers := make(map[string]*CallerUsage)
+	endpoints := make(map[string]map[string]*EndpointUsage)
+	report := UsageReport{From: fromDate.Format(shared.DateFormat), To: toDate.Format(shared.DateFormat), Callers: []CallerUsage{}}
+	for day := fromDate; !day.After(toDate); day = day.AddDate(0, 0, 1) {
+		date := day.Format(shared.DateFormat)
+		usage, err := db.GetAPIUsage(ctx, date, userID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("date", date).Msg("Failed to get API usage")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve API usage", nil), nil
+		}
+		for _, counter := range usage {
+			caller, ok := callers[counter.UserID]
+			if !ok {
+				caller = &CallerUsage{UserID: counter.UserID, Days: make(map[string]int)}
+				callers[counter.UserID] = caller
+				endpoints[counter.UserID] = make(map[string]*EndpointUsage)
+			}
+			caller.Count += counter.Count
+			caller.ErrorCount += counter.ErrorCount
+			caller.Days[date] += counter.Count
+
+			endpoint, ok := endpoints[counter.UserID][counter.Endpoint]
+			if !ok {
+				endpoint = &EndpointUsage{Endpoint: counter.Endpoint}
+				endpoints[counter.UserID][counter.Endpoint] = endpoint
+			}
+			endpoint.Count += counter.Count
+			endpoint.ErrorCount += counter.ErrorCount
+
+			report.Count += counter.Count
+			report.ErrorCount += counter.ErrorCount
+		}
+	}
+
+	for id, caller := range callers {
+		caller.Endpoints = make([]EndpointUsage, 0, len(endpoints[id]))
+		for _, endpoint := range endpoints[id] {
+			caller.Endpoints = append(caller.Endpoints, *endpoint)
+		}
+		slices.SortFunc(caller.Endpoints, func(a, b EndpointUsage) int {
+			if a.Count != b.Count {
+				return b.Count - a.Count
+			}
+			return strings.Compare(a.Endpoint, b.Endpoint)
+		})
+		report.Callers = append(report.Callers, *caller)
+	}
+	slices.SortFunc(report.Callers, func(a, b CallerUsage) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.UserID, b.UserID)
+	})
+
+	return shared.CreateAPIResponse(http.StatusOK, report), nil
+}
+
+// DomainProblem is something wrong with a sending domain and how to fix it
+type DomainProblem struct {
+	Severity string `json:"severity"` // "error" | "warning" | "info"
+	Message  string `json:"message"`
+}
+
+// EmailDomainStatus is the SES state of a From domain used by the configs
+type EmailDomainStatus struct {
+	Domain          string          `json:"domain"`
+	FromAddresses   []string        `json:"fromAddresses"`
+	Verification    string          `json:"verification"`                // SES status of the domain identity, "NotFound" when it was never added
+	VerifiedAddress []string        `json:"verifiedAddresses,omitempty"` // From addresses verified on their own
+	DkimEnabled     bool            `json:"dkimEnabled"`
+	DkimStatus      string          `json:"dkimStatus,omitempty"`
+	MailFromDomain  string          `json:"mailFromDomain,omitempty"` // Custom MAIL FROM domain, aligns SPF with the From domain
+	MailFromStatus  string          `json:"mailFromStatus,omitempty"`
+	Problems        []DomainProblem `json:"problems"`
+	Healthy         bool            `json:"healthy"` // No error level problem
+}
+
+// EmailDomainStatusReport lists the status of every configured From domain
+type EmailDomainStatusReport struct {
+	Domains  []EmailDomainStatus `json:"domains"`
+	Problems []DomainProblem     `json:"problems"`
+	Healthy  bool                `json:"healthy"`
+}
+
+// identityNotFound is reported for identities that were never added to SES
+const identityNotFound = "NotFound"
+
+// getEmailDomainStatus checks the SES identity, DKIM and MAIL FROM setup of the From domains in the configs
+func getEmailDomainStatus(ctx context.Context) (shared.APIResponse, error) {
+	configs, err := db.GetAllSystemConfigs(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan configs")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve configs", nil), nil
+	}
+
+	report := EmailDomainStatusReport{Domains: []EmailDomainStatus{}, Problems: []DomainProblem{}}
+	addressesByDomain := make(map[string][]string)
+	for _, config := range configs {
+		// Addresses of configs with their own provider are checked by provider-status, not in SES
+		if config.Config == nil || config.Config.EmailSettings.HasOwnProvider() {
+			continue
+		}
+		addresses := slices.Sorted(maps.Values(config.Config.EmailSettings.FromAddressByType))
+		if config.Config.EmailSettings.FromAddress != "" {
+			addresses = append([]string{config.Config.EmailSettings.FromAddress}, addresses...)
+		}
+		for _, address := range addresses {
+			domain := shared.EmailDomain(address)
+			if domain == "" {
+				report.Problems = append(report.Problems, DomainProblem{
+					Severity: SeverityError,
+					Message:  fmt.Sprintf("From address of config %q is not a valid email address", config.Context),
+				})
+				continue
+			}
+			if !slices.Contains(addressesByDomain[domain], address) {
+				addressesByDomain[domain] = append(addressesByDomain[domain], address)
+			}
+		}
+	}
+	if len(addressesByDomain) == 0 {
+		report.Problems = append(report.Problems, DomainProblem{
+			Severity: SeverityError,
+			Message:  "No from address is configured, set email.fromAddress in the global config",
+		})
+	}
+
+	domains := slices.Sorted(maps.Keys(addressesByDomain))
+	identities := slices.Clone(domains)
+	for _, domain := range domains {
+		identities = append(identities, addressesByDomain[domain]...)
+	}
+
+	var verification map[string]sestypes.IdentityVerificationAttributes
+	var dkim map[string]sestypes.IdentityDkimAttributes
+	var mailFrom map[string]sestypes.IdentityMailFromDomainAttributes
+	if len(identities) > 0 {
+		verification, err = services.SesGetIdentityVerification(ctx, identities)
+		if err == nil {
+			dkim, err = services.SesGetIdentityDkim(ctx, domains)
+		}
+		if err == nil {
+			mailFrom, err = services.SesGetIdentityMailFrom(ctx, domains)
+		}
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to query SES identities")
+			return shared.CreateErrorResponse(http.StatusBadGateway, "Failed to query SES", nil), nil
+		}
+	}
+
+	for _, domain := range domains {
+		report.Domains = append(report.Domains, checkEmailDomain(domain, addressesByDomain[domain], verification, dkim[domain], mailFrom[domain]))
+	}
+
+	report.Healthy = !slices.ContainsFunc(report.Problems, isErrorProblem)
+	for _, domain := range report.Domains {
+		report.Healthy = report.Healthy && domain.Healthy
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, report), nil
+}
+
+// checkEmailDomain derives the status of a domain and the problems to fix from its SES attributes
+func checkEmailDomain(domain string, addresses []string, verification map[string]sestypes.IdentityVerificationAttributes, dkim sestypes.IdentityDkimAttributes, mailFrom sestypes.IdentityMailFromDomainAttributes) EmailDomainStatus {
+	status := EmailDomainStatus{
+		Domain:        domain,
+		FromAddresses: addresses,
+		Verification:  identityNotFound,
+		Problems:      []DomainProblem{},
+	}
+	add := func(severity, message string) {
+		status.Problems = append(status.Problems, DomainProblem{Severity: severity, Message: message})
+	}
+
+	if attributes, ok := verification[domain]; ok {
+		status.Verification = string(attributes.VerificationStatus)
+	}
+	for _, address := range addresses {
+		if verification[address].VerificationStatus == sestypes.VerificationStatusSuccess {
+			status.VerifiedAddress = append(status.VerifiedAddress, address)
+		}
+	}
+	allAddressesVerified := len(status.VerifiedAddress) == len(addresses)
+
+	switch sestypes.VerificationStatus(status.Verification) {
+	case sestypes.VerificationStatusSuccess:
+	case sestypes.VerificationStatusPending:
+		add(SeverityWarning, fmt.Sprintf("Domain verification is pending, publish the TXT record _amazonses.%s with the verification token", domain))
+	case sestypes.VerificationStatusFailed, sestypes.VerificationStatusTemporaryFailure:
+		add(SeverityError, fmt.Sprintf("Domain verification failed (%s), check the _amazonses.%s TXT record and verify the domain again", status.Verification, domain))
+	default:
+		if allAddressesVerified {
+			add(SeverityWarning, "Only the from addresses are verified, verify the domain in SES to sign emails with DKIM")
+		} else {
+			add(SeverityError, fmt.Sprintf("Neither %s nor its from addresses are verified in SES, emails from it are rejected", domain))
+		}
+	}
+
+	status.DkimEnabled = dkim.DkimEnabled
+	status.DkimStatus = string(dkim.DkimVerificationStatus)
+	if status.Verification != identityNotFound {
+		switch {
+		case !dkim.DkimEnabled:
+			add(SeverityWarning, "DKIM signing is disabled, enable Easy DKIM and publish its three CNAME records")
+		case dkim.DkimVerificationStatus == sestypes.VerificationStatusPending:
+			add(SeverityWarning, fmt.Sprintf("DKIM verification is pending, publish the CNAME records under _domainkey.%s", domain))
+		case dkim.DkimVerificationStatus != sestypes.VerificationStatusSuccess:
+			add(SeverityError, fmt.Sprintf("DKIM verification is %s, check the CNAME records under _domainkey.%s", status.DkimStatus, domain))
+		}
+	}
+
+	status.MailFromDomain = aws.ToString(mailFrom.MailFromDomain)
+	status.MailFromStatus = string(mailFrom.MailFromDomainStatus)
+	switch {
+	case status.MailFromDomain == "":
+		add(SeverityInfo, "No custom MAIL FROM domain, SPF passes for amazonses.com but is not aligned with "+domain+" for DMARC")
+	case mailFrom.MailFromDomainStatus == sestypes.CustomMailFromStatusPending:
+		add(SeverityWarning, fmt.Sprintf("MAIL FROM domain %s is pending, publish its MX record and the SPF TXT record \"v=spf1 include:amazonses.com ~all\"", status.MailFromDomain))
+	case mailFrom.MailFromDomainStatus != sestypes.CustomMailFromStatusSuccess:
+		add(SeverityError, fmt.Sprintf("MAIL FROM domain %s is %s, check its MX and SPF TXT records", status.MailFromDomain, status.MailFromStatus))
+	}
+
+	status.Healthy = !slices.ContainsFunc(status.Problems, isErrorProblem)
+	return status
+}
+
+func isErrorProblem(problem DomainProblem) bool {
+	return problem.Severity == SeverityError
+}
+
+// EmailProviderStatus is the email provider of a config, its quota and whether it may send from the config's addresses
+type EmailProviderStatus struct {
+	Context    string                        `json:"context"`
+	Provider   string                        `json:"provider"`
+	Quota      *services.EmailQuota          `json:"quota,omitempty"`
+	QuotaError string                        `json:"quotaError,omitempty"`
+	Identities []EmailProviderIdentityStatus `json:"identities"`
+}
+
+// EmailProviderIdentityStatus is the verification of one from or reply-to address with the provider
+type EmailProviderIdentityStatus struct {
+	services.IdentityVerification
+	Error string `json:"error,omitempty"`
+}
+
+// getEmailProviderStatus reports the provider the context's email goes through (the global config by default),
+// its sending quota and the verification of every from address. Provider errors are reported, not returned
+func getEmailProviderStatus(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	configContext := event.QueryStringParameters[ContextQueryParam]
+	if configContext == "" {
+		configContext = "*"
+	}
+
+	config, err := db.GetSystemConfig(ctx, configContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("context", configContext).Msg("Failed to get config")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve config", nil), nil
+	}
+	if config.Context == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "System config not found", nil), nil
+	}
+
+	// A user config without its own provider sends through the global one
+	var settings shared.EmailSettings
+	if config.Config != nil {
+		settings = config.Config.EmailSettings
+	}
+	if configContext != "*" && !settings.HasOwnProvider() {
+		global, err := db.GetSystemConfig(ctx, "*")
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get global config")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve config", nil), nil
+		}
+		if global.Config != nil {
+			settings = global.Config.EmailSettings
+		}
+	}
+
+	provider, err := services.NewEmailProvider(settings)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusUnprocessableEntity, "Invalid email provider: "+err.Error(), nil), nil
+	}
+	status := EmailProviderStatus{Context: configContext, Provider: provider.Name(), Identities: []EmailProviderIdentityStatus{}}
+
+	quota, err := provider.Quota(ctx)
+	if err != nil {
+		shared.LogWarn(ctx).Err(err).Str("provider", provider.Name()).Msg("Failed to get email quota")
+		status.QuotaError = err.Error()
+	} else {
+		status.Quota = &quota
+	}
+
+	addresses := slices.Sorted(maps.Values(settings.FromAddressByType))
+	if settings.FromAddress != "" {
+		addresses = append([]string{settings.FromAddress}, addresses...)
+	}
+	if settings.ReplyToAddress != "" {
+		addresses = append(addresses, settings.ReplyToAddress)
+	}
+	for _, address := range slices.Compact(addresses) {
+		verification, err := provider.VerifyIdentity(ctx, address)
+		identity := EmailProviderIdentityStatus{IdentityVerification: verification}
+		if err != nil {
+			shared.LogWarn(ctx).Err(err).Str("provider", provider.Name()).Msg("Failed to verify email identity")
+			identity.Identity = address
+			identity.Error = err.Error()
+		}
+		status.Identities = append(status.Identities, identity)
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, status), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("admin", handler))
+}
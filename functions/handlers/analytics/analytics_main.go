@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	TypeQueryParam     = "type"
+	ChannelQueryParam  = "channel"
+	FromQueryParam     = "from"
+	ToQueryParam       = "to"
+	ProducerQueryParam = "producer"
+	TagQueryParam      = "tag"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Analytics handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Analytics are operational reports for super admins
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can view analytics", nil), nil
+	}
+
+	switch {
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/analytics/sla"):
+		return getDeliverySLA(ctx, event)
+	case event.HTTPMethod == http.MethodGet:
+		return getAckSLA(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+// parseDateRange reads from/to query parameters, defaulting to the last 7 days
+func parseDateRange(event events.APIGatewayProxyRequest) (string, string, shared.APIResponse) {
+	now := shared.GetCurrentTime()
+	from := event.QueryStringParameters[FromQueryParam]
+	to := event.QueryStringParameters[ToQueryParam]
+	if to == "" {
+		to = now.Format(shared.DateFormat)
+	}
+	if from == "" {
+		from = now.AddDate(0, 0, -7).Format(shared.DateFormat)
+	}
+
+	if _, err := time.Parse(shared.DateFormat, from); err != nil {
+		return "", "", shared.CreateErrorResponse(http.StatusBadRequest, "Invalid from date, expected YYYY-MM-DD", nil)
+	}
+	if _, err := time.Parse(shared.DateFormat, to); err != nil {
+		return "", "", shared.CreateErrorResponse(http.StatusBadRequest, "Invalid to date, expected YYYY-MM-DD", nil)
+	}
+	if from > to {
+		return "", "", shared.CreateErrorResponse(http.StatusBadRequest, "From date must not be after to date", nil)
+	}
+	return from, to, shared.APIResponse{}
+}
+
+func getAckSLA(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	notificationType := event.QueryStringParameters[TypeQueryParam]
+	if notificationType == "" || !shared.ValidateNotificationType(notificationType) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid notification type is required", nil), nil
+	}
+
+	from, to, errResponse := parseDateRange(event)
+	if from == "" {
+		return errResponse, nil
+	}
+
+	rollups, err := db.GetAnalyticsRollups(ctx, shared.BuildMetricKey(shared.MetricAckSLA, notificationType), from, to)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get acknowledgment SLA rollups")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve acknowledgment SLA", nil), nil
+	}
+
+	response := shared.PaginatedResponse{
+		Items: rollups,
+		Count: len(rollups),
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+// ChannelSLA holds the daily delivery latency rollups of one channel
+type ChannelSLA struct {
+	Channel string                   `json:"channel"`
+	Days    []shared.AnalyticsRollup `json:"days"`
+}
+
+// getDeliverySLA returns the daily end-to-end delivery latency percentiles (seconds from enqueue to
+// delivery) per channel, for all channels unless one is given, and only of one producer kind or of the requests
+// of one tag when one is given
+func getDeliverySLA(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	channels := []string{shared.ChannelEmail, shared.ChannelSlack, shared.ChannelInApp, shared.ChannelSMS, shared.ChannelPush, shared.ChannelWebhook, shared.ChannelTeams}
+	if channel := event.QueryStringParameters[ChannelQueryParam]; channel != "" {
+		if !shared.ValidateChannel(channel) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid channel", nil), nil
+		}
+		channels = []string{channel}
+	}
+
+	producerKind := event.QueryStringParameters[ProducerQueryParam]
+	if producerKind != "" && !shared.ValidateProducerKind(producerKind) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid producer kind", nil), nil
+	}
+
+	tag := event.QueryStringParameters[TagQueryParam]
+	if tag != "" {
+		tags, err := shared.NormalizeTags([]string{tag})
+		if err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		tag = tags[0]
+	}
+	if producerKind != "" && tag != "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Filter by producer or by tag, not both", nil), nil
+	}
+
+	from, to, errResponse := parseDateRange(event)
+	if from == "" {
+		return errResponse, nil
+	}
+
+	items := make([]ChannelSLA, 0, len(channels))
+	for _, channel := range channels {
+		metricKey := shared.BuildMetricKey(shared.MetricDeliverySLA, channel)
+		if producerKind != "" {
+			metricKey = shared.BuildMetricKey(metricKey, producerKind)
+		}
+		if tag != "" {
+			metricKey = shared.BuildMetricKey(metricKey, shared.TagMetricPrefix+tag)
+		}
+		rollups, err := db.GetAnalyticsRollups(ctx, metricKey, from, to)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("channel", channel).Msg("Failed to get delivery SLA rollups")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve delivery SLA", nil), nil
+		}
+		items = append(items, ChannelSLA{Channel: channel, Days: rollups})
+	}
+
+	response := shared.PaginatedResponse{
+		Items: items,
+		Count: len(items),
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("analytics", handler))
+}
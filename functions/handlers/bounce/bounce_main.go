@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// sesEventBounce is the type of the SES events this handler acts on, the configuration set only publishes bounces
+const sesEventBounce = "Bounce"
+
+func init() {
+	shared.InitAWS()
+}
+
+// handler receives the bounces SES publishes to the bounce topic. Hard bounces are recorded, soft bounces
+// are also redelivered later with increasing delays until the global retry limit is reached. An error
+// makes Lambda invoke the handler again, so every step is safe to repeat
+func handler(ctx context.Context, event events.SNSEvent) error {
+	var errs []error
+	for _, record := range event.Records {
+		var notification shared.SESNotification
+		if err := json.Unmarshal([]byte(record.SNS.Message), &notification); err != nil {
+			shared.LogError(ctx).Err(err).Str("snsMessageId", record.SNS.MessageID).Msg("Failed to parse SES notification")
+			continue
+		}
+		if notification.Type() != sesEventBounce || notification.Bounce == nil {
+			continue
+		}
+		if err := handleBounce(ctx, notification); err != nil {
+			shared.LogError(ctx).Err(err).Str("messageId", notification.Mail.MessageID).Msg("Failed to handle bounce")
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// handleBounce records the bounce of one email and schedules its redelivery when it is soft
+func handleBounce(ctx context.Context, notification shared.SESNotification) error {
+	messageID := notification.Mail.MessageID
+	bounce := *notification.Bounce
+
+	message, err := db.GetEmailMessage(ctx, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to get email message: %w", err)
+	}
+	if message == nil {
+		// Sent by another part of the account, such as a critical contact code, or expired
+		shared.LogInfo(ctx).Str("messageId", messageID).Str("bounceType", bounce.BounceType).Msg("Bounce of an unknown email, ignoring")
+		return nil
+	}
+	if message.Bounce != "" {
+		shared.LogInfo(ctx).Str("messageId", messageID).Msg("Bounce already handled")
+		return nil
+	}
+	shared.LogInfo(ctx).Str("messageId", messageID).Str("notificationRequestId", message.RequestID).Str("recipientId", message.RecipientID).
+		Str("bounceType", bounce.BounceType).Str("bounceSubType", bounce.BounceSubType).Str("bounce", bounce.Classification()).Msg("Email bounced")
+
+	// Hard and undetermined bounces are only recorded, redelivering to the address would bounce again
+	if bounce.IsSoft() {
+		if err := scheduleRetry(ctx, *message); err != nil {
+			return err
+		}
+	}
+
+	return db.RecordEmailBounce(ctx, messageID, bounce.Classification())
+}
+
+// scheduleRetry redelivers a soft-bounced email through a one-time schedule, unless the email already used
+// up its retries. Its schedule ID comes from the message ID, so a repeated bounce schedules one redelivery
+func scheduleRetry(ctx context.Context, message shared.EmailMessage) error {
+	globalConfig, err := db.GetSystemConfig(ctx, "*")
+	if err != nil {
+		return fmt.Errorf("failed to get global config: %w", err)
+	}
+	var settings shared.EmailBounceSettings
+	if globalConfig.Config != nil {
+		settings = globalConfig.Config.EmailBounces
+	}
+
+	attempt := message.Attempt + 1
+	if attempt > settings.RetryLimit() {
+		shared.LogWarn(ctx).Str("messageId", message.MessageID).Str("notificationRequestId", message.RequestID).Str("recipientId", message.RecipientID).Int("retries", message.Attempt).Msg("Email soft-bounced after its last retry, giving up")
+		return nil
+	}
+
+	history, err := db.GetNotificationHistory(ctx, message.RequestID)
+	if err != nil {
+		return fmt.Errorf("failed to get notification history: %w", err)
+	}
+	if history.Request == nil {
+		shared.LogWarn(ctx).Str("messageId", message.MessageID).Str("notificationRequestId", message.RequestID).Msg("Bounced request has no history, cannot redeliver")
+		return nil
+	}
+
+	retry := shared.BounceRetryRequest(*history.Request, message.RecipientID, attempt)
+	deliverAt := shared.GetCurrentTime().Add(settings.RetryDelay(attempt))
+	err = shared.CreateOneTimeEventBridgeSchedule(ctx, message.RecipientID, shared.BounceRetryScheduleID(message.MessageID), deliverAt, retry)
+	if shared.IsScheduleConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("messageId", message.MessageID).Str("notificationRequestId", retry.ID).Str("recipientId", message.RecipientID).Int("attempt", attempt).Time("deliverAt", deliverAt).Msg("Soft-bounced email redelivery scheduled")
+	return nil
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("bounce", handler))
+}
@@ -2,36 +2,52 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"maps"
 	"net/http"
 	"notification-service/functions/db"
+	"notification-service/functions/engine"
 	"notification-service/functions/shared"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
 )
 
 const (
 	LimitQueryParam     = "limit"
 	NextTokenQueryParam = "nextToken"
 	ContextQueryParam   = "context"
+	RevealQueryParam    = "reveal"
 )
 
+var notificationEngine = engine.New()
+
 func init() {
 	shared.InitAWS()
 }
 
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
-	shared.LogInfo().Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Config handler invoked")
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Config handler invoked")
 
 	// Extract user info from context
 	userContext, err := shared.GetUserContext(event.RequestContext)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user ID from context")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
 		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
 	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
 
 	switch event.HTTPMethod {
 	case http.MethodPost:
+		if strings.HasSuffix(event.Resource, "/slack/test") {
+			return testSlackWebhook(ctx, event, userContext)
+		}
+		if strings.HasSuffix(event.Resource, "/test-channel") {
+			return testChannel(ctx, event, userContext)
+		}
 		return createSystemConfig(ctx, event, userContext)
 	case http.MethodPut:
 		return updateSystemConfig(ctx, event, userContext)
@@ -54,22 +70,151 @@ type SystemConfigRequest struct {
 	Description string                `json:"description,omitempty"`
 }
 
+// clearConfigSection resets the settings section with the given JSON name. It returns whether the section
+// is global only, and false for ok when there is no such section
+func clearConfigSection(config *shared.SystemSettings, section string) (global bool, ok bool) {
+	switch section {
+	case "slack":
+		config.SlackSettings = shared.SlackSettings{}
+	case "email":
+		config.EmailSettings = shared.EmailSettings{}
+	case "inApp":
+		config.InAppSettings = shared.InAppSettings{}
+	case "sms":
+		config.SmsSettings = shared.SmsSettings{}
+	case "push":
+		config.PushSettings = shared.PushSettings{}
+	case "webhook":
+		config.WebhookSettings = shared.WebhookSettings{}
+	case "teams":
+		config.TeamsSettings = shared.TeamsSettings{}
+	case "calendar":
+		config.Calendar = shared.CalendarSettings{}
+	case "localization":
+		config.Localization = shared.LocalizationSettings{}
+	case "emailWarmUp":
+		config.EmailWarmUp = shared.EmailWarmUpSettings{}
+	case "environmentBanner":
+		config.EnvironmentBanner = shared.EnvironmentBannerSettings{}
+	case "retention":
+		config.Retention = shared.RetentionSettings{}
+	case "processor":
+		config.Processor = shared.ProcessorSettings{}
+	case "fallback":
+		config.Fallback = shared.FallbackSettings{}
+	case "schedules":
+		config.Schedules = shared.ScheduleSettings{}
+	case "emailBounces":
+		config.EmailBounces = shared.EmailBounceSettings{}
+	default:
+		return false, false
+	}
+	switch section {
+	case "localization", "emailWarmUp", "environmentBanner", "retention", "processor", "fallback", "schedules", "emailBounces":
+		return true, true
+	}
+	return false, true
+}
+
 func validateUserConfigPermissions(config shared.SystemSettings, context string) shared.APIResponse {
 	// Users can only modify specific fields
 	if context != "*" {
 		// Check if user is trying to modify forbidden fields
-		if config.EmailSettings.FromAddress != "" || config.EmailSettings.ReplyToAddress != "" {
-			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email addresses", nil)
+		// The service's SES account only sends from the global addresses, users bringing their own provider set their own
+		if !config.EmailSettings.HasOwnProvider() && (config.EmailSettings.FromAddress != "" || len(config.EmailSettings.FromAddressByType) != 0 || config.EmailSettings.ReplyToAddress != "") {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email addresses without their own email provider", nil)
+		}
+		if config.SmsSettings.SenderID != "" {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify the SMS sender ID", nil)
+		}
+		if len(config.PushSettings.PlatformApplicationARNs) != 0 {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify push platform applications", nil)
+		}
+		if !config.Localization.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify localization settings", nil)
+		}
+		if !config.EmailWarmUp.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email warm-up settings", nil)
+		}
+		if !config.EnvironmentBanner.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify environment banner settings", nil)
+		}
+		if !config.Retention.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify retention settings", nil)
+		}
+		if !config.Processor.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify processor settings", nil)
+		}
+		if !config.Fallback.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify fallback settings", nil)
+		}
+		if !config.Schedules.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify schedule limits", nil)
+		}
+		if !config.EmailBounces.IsEmpty() {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email bounce settings", nil)
 		}
 	} else {
 		// Super admins
-		if config.SlackSettings.WebhookURL != "" || len(config.InAppSettings.PlatformAppIDs) != 0 {
+		if config.SlackSettings.WebhookURL != "" || len(config.SlackSettings.WebhookURLByType) != 0 || len(config.InAppSettings.PlatformAppIDs) != 0 {
 			return shared.CreateErrorResponse(http.StatusForbidden, "Super admins cannot modify slack webhook url or in app platform app ids", nil)
 		}
+		if webhook := config.WebhookSettings; webhook.URL != "" || webhook.Secret != "" || len(webhook.ExpectedStatuses) != 0 || webhook.ExpectedBody != "" || len(webhook.EndpointsByType) != 0 {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Super admins cannot modify webhook endpoints", nil)
+		}
+		if config.TeamsSettings.WebhookURL != "" {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Super admins cannot modify teams webhook url", nil)
+		}
+	}
+	return shared.APIResponse{}
+}
+
+// validateSlackWebhook checks the webhook URL when one is provided
+func validateSlackWebhook(config shared.SystemSettings) shared.APIResponse {
+	if config.SlackSettings.WebhookURL == "" {
+		return shared.APIResponse{}
+	}
+	if err := shared.ValidateSlackWebhookURL(config.SlackSettings.WebhookURL); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid Slack webhook URL: "+err.Error(), nil)
+	}
+	return shared.APIResponse{}
+}
+
+// validateWebhookSecret checks that a webhook URL comes with the secret its deliveries are signed with
+func validateWebhookSecret(config shared.SystemSettings) shared.APIResponse {
+	if config.WebhookSettings.URL != "" && config.WebhookSettings.Secret == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Webhook secret is required with the webhook URL", nil)
 	}
 	return shared.APIResponse{}
 }
 
+// maskConfig hides the webhook URLs, webhook secret and email addresses in responses, showing only their last 4 characters
+func maskConfig(config shared.SystemConfig) shared.SystemConfig {
+	if config.Config == nil {
+		return config
+	}
+	settings := shared.MaskSettings(*config.Config)
+	config.Config = &settings
+	return config
+}
+
+// checkReveal reports whether the GET asked for unmasked secrets with ?reveal=true. Only super admins
+// may reveal, and every reveal is audited
+func checkReveal(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (bool, shared.APIResponse) {
+	if event.QueryStringParameters[RevealQueryParam] != "true" {
+		return false, shared.APIResponse{}
+	}
+	if userContext.Role != shared.RoleSuperAdmin {
+		return false, shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can reveal config secrets", nil)
+	}
+	shared.LogAudit(ctx, "config.reveal").
+		Str("adminId", userContext.UserID).
+		Str("context", event.QueryStringParameters[ContextQueryParam]).
+		Str("sourceIp", event.RequestContext.Identity.SourceIP).
+		Msg("Config secrets revealed")
+	return true, shared.APIResponse{}
+}
+
 func createSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
 	var request SystemConfigRequest
 	err := shared.ParseRequestBody(event.Body, &request)
@@ -84,23 +229,93 @@ func createSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 	request.Context = context
 
 	// Cannot compare struct with slices directly; check if all config fields are empty
-	isSlackEmpty := request.Config.SlackSettings == (shared.SlackSettings{})
-	isEmailEmpty := request.Config.EmailSettings == (shared.EmailSettings{})
+	isSlackEmpty := request.Config.SlackSettings.IsEmpty()
+	isEmailEmpty := request.Config.EmailSettings.IsEmpty()
 	isInAppEmpty := request.Config.InAppSettings.Enabled == nil && len(request.Config.InAppSettings.PlatformAppIDs) == 0
-
-	if isSlackEmpty && isEmailEmpty && isInAppEmpty {
+	isSmsEmpty := request.Config.SmsSettings.IsEmpty()
+	isPushEmpty := request.Config.PushSettings.IsEmpty()
+	isWebhookEmpty := request.Config.WebhookSettings.IsEmpty()
+	isTeamsEmpty := request.Config.TeamsSettings.IsEmpty()
+	isCalendarEmpty := request.Config.Calendar.IsEmpty()
+	isLocalizationEmpty := request.Config.Localization.IsEmpty()
+	isWarmUpEmpty := request.Config.EmailWarmUp.IsEmpty()
+	isBannerEmpty := request.Config.EnvironmentBanner.IsEmpty()
+	isRetentionEmpty := request.Config.Retention.IsEmpty()
+	isProcessorEmpty := request.Config.Processor.IsEmpty()
+	isFallbackEmpty := request.Config.Fallback.IsEmpty()
+	isSchedulesEmpty := request.Config.Schedules.IsEmpty()
+	isBouncesEmpty := request.Config.EmailBounces.IsEmpty()
+
+	if isSlackEmpty && isEmailEmpty && isInAppEmpty && isSmsEmpty && isPushEmpty && isWebhookEmpty && isTeamsEmpty && isCalendarEmpty && isLocalizationEmpty && isWarmUpEmpty && isBannerEmpty && isRetentionEmpty && isProcessorEmpty && isFallbackEmpty && isSchedulesEmpty && isBouncesEmpty {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Config is required", nil), nil
 	}
 
+	// Nothing is stored yet for masked values to stand for
+	if err := shared.RestoreMaskedSettings(&request.Config, shared.SystemSettings{}); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid config: "+err.Error(), nil), nil
+	}
+
+	if err := request.Config.Calendar.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid calendar: "+err.Error(), nil), nil
+	}
+	if err := request.Config.SmsSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid SMS settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.PushSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid push settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.WebhookSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid webhook settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.TeamsSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid Teams settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EmailSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Localization.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid localization: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EmailWarmUp.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email warm-up: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EnvironmentBanner.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid environment banner: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Retention.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid retention: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Processor.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid processor settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Fallback.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid fallback settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Schedules.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid schedule limits: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EmailBounces.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email bounce settings: "+err.Error(), nil), nil
+	}
+	if err := shared.ValidateSenderOverrides(request.Config); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid sender override: "+err.Error(), nil), nil
+	}
+
 	// Validate user permissions for config fields
 	if errResponse := validateUserConfigPermissions(request.Config, context); errResponse.StatusCode != 0 {
 		return errResponse, nil
 	}
+	if errResponse := validateSlackWebhook(request.Config); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	if errResponse := validateWebhookSecret(request.Config); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
 
 	// Check if config already exists
 	existing, err := db.GetSystemConfig(ctx, request.Context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to check existing config")
+		shared.LogError(ctx).Err(err).Msg("Failed to check existing config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to check existing config", nil), nil
 	}
 	if existing.Context != "" {
@@ -116,13 +331,13 @@ func createSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 
 	err = db.CreateSystemConfig(ctx, systemConfig)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to create system config")
+		shared.LogError(ctx).Err(err).Msg("Failed to create system config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create system config", nil), nil
 	}
 
-	shared.LogInfo().Str("context", systemConfig.Context).Msg("System config created successfully")
+	shared.LogInfo(ctx).Str("context", systemConfig.Context).Msg("System config created successfully")
 
-	return shared.CreateAPIResponse(http.StatusCreated, systemConfig), nil
+	return shared.CreateAPIResponse(http.StatusCreated, maskConfig(systemConfig)), nil
 }
 
 func updateSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -139,24 +354,133 @@ func updateSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 	request.Context = context
 
 	// Cannot compare struct with slices directly; check if all config fields are empty
-	isSlackEmpty := request.Config.SlackSettings == (shared.SlackSettings{})
-	isEmailEmpty := request.Config.EmailSettings == (shared.EmailSettings{})
+	isSlackEmpty := request.Config.SlackSettings.IsEmpty()
+	isEmailEmpty := request.Config.EmailSettings.IsEmpty()
 	isInAppEmpty := request.Config.InAppSettings.Enabled == nil && len(request.Config.InAppSettings.PlatformAppIDs) == 0
+	isSmsEmpty := request.Config.SmsSettings.IsEmpty()
+	isPushEmpty := request.Config.PushSettings.IsEmpty()
+	isWebhookEmpty := request.Config.WebhookSettings.IsEmpty()
+	isTeamsEmpty := request.Config.TeamsSettings.IsEmpty()
+	isCalendarEmpty := request.Config.Calendar.IsEmpty()
+	isLocalizationEmpty := request.Config.Localization.IsEmpty()
+	isWarmUpEmpty := request.Config.EmailWarmUp.IsEmpty()
+	isBannerEmpty := request.Config.EnvironmentBanner.IsEmpty()
+	isRetentionEmpty := request.Config.Retention.IsEmpty()
+	isProcessorEmpty := request.Config.Processor.IsEmpty()
+	isFallbackEmpty := request.Config.Fallback.IsEmpty()
+	isSchedulesEmpty := request.Config.Schedules.IsEmpty()
+	isBouncesEmpty := request.Config.EmailBounces.IsEmpty()
+
+	// Settings sections and the description sent as null are cleared
+	nulls := shared.NullFields(event.Body)
+	if nulls["config"] {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "The config cannot be cleared as a whole, clear its sections instead", nil), nil
+	}
+	var cleared, clearedSections []string
+	if nulls[db.ColConfigDescription] {
+		cleared = append(cleared, db.ColConfigDescription)
+	}
+	for _, section := range slices.Sorted(maps.Keys(shared.NullFields(event.Body, "config"))) {
+		global, ok := clearConfigSection(&request.Config, section)
+		if !ok {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Unknown config section: "+section, nil), nil
+		}
+		if global && context != "*" {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot clear "+section+" settings", nil), nil
+		}
+		clearedSections = append(clearedSections, section)
+		cleared = append(cleared, db.ColConfig+"."+section)
+	}
 
-	if isSlackEmpty && isEmailEmpty && isInAppEmpty && request.Description == "" {
+	if isSlackEmpty && isEmailEmpty && isInAppEmpty && isSmsEmpty && isPushEmpty && isWebhookEmpty && isTeamsEmpty && isCalendarEmpty && isLocalizationEmpty && isWarmUpEmpty && isBannerEmpty && isRetentionEmpty && isProcessorEmpty && isFallbackEmpty && isSchedulesEmpty && isBouncesEmpty && request.Description == "" && len(cleared) == 0 {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided for update, config or description", nil), nil
 	}
 
 	// Get existing config to verify it exists
 	existing, err := db.GetSystemConfig(ctx, request.Context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get existing config")
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve config", nil), nil
 	}
 	if existing.Context == "" {
 		return shared.CreateErrorResponse(http.StatusNotFound, "System config not found", nil), nil
 	}
 
+	// Masked values read back from a GET keep what is stored
+	var stored shared.SystemSettings
+	if existing.Config != nil {
+		stored = *existing.Config
+	}
+	if err := shared.RestoreMaskedSettings(&request.Config, stored); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid config: "+err.Error(), nil), nil
+	}
+
+	if err := request.Config.Calendar.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid calendar: "+err.Error(), nil), nil
+	}
+	if err := request.Config.SmsSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid SMS settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.PushSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid push settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.WebhookSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid webhook settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.TeamsSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid Teams settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Localization.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid localization: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EmailWarmUp.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email warm-up: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EnvironmentBanner.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid environment banner: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Retention.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid retention: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Processor.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid processor settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Fallback.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid fallback settings: "+err.Error(), nil), nil
+	}
+	if err := request.Config.Schedules.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid schedule limits: "+err.Error(), nil), nil
+	}
+	if err := request.Config.EmailBounces.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email bounce settings: "+err.Error(), nil), nil
+	}
+	if err := shared.ValidateSenderOverrides(request.Config); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid sender override: "+err.Error(), nil), nil
+	}
+	if errResponse := validateSlackWebhook(request.Config); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	// Localization, email warm-up, the environment banner, fallback policies, schedule limits and bounce retries are global, the merge below would silently drop them
+	if context != "*" && !isLocalizationEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify localization settings", nil), nil
+	}
+	if context != "*" && !isWarmUpEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email warm-up settings", nil), nil
+	}
+	if context != "*" && !isBannerEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify environment banner settings", nil), nil
+	}
+	if context != "*" && !isFallbackEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify fallback settings", nil), nil
+	}
+	if context != "*" && !isSchedulesEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify schedule limits", nil), nil
+	}
+	if context != "*" && !isBouncesEmpty {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Users cannot modify email bounce settings", nil), nil
+	}
+
 	// For users, merge with existing config to preserve global settings
 	if context != "*" {
 		// Preserve existing config and only update allowed fields
@@ -166,41 +490,109 @@ func updateSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 		if request.Config.SlackSettings.WebhookURL != "" {
 			mergedConfig.SlackSettings.WebhookURL = request.Config.SlackSettings.WebhookURL
 		}
+		if request.Config.SlackSettings.WebhookURLByType != nil {
+			mergedConfig.SlackSettings.WebhookURLByType = request.Config.SlackSettings.WebhookURLByType
+		}
 		if request.Config.SlackSettings.Enabled != nil {
 			mergedConfig.SlackSettings.Enabled = request.Config.SlackSettings.Enabled
 		}
 		if request.Config.EmailSettings.Enabled != nil {
 			mergedConfig.EmailSettings.Enabled = request.Config.EmailSettings.Enabled
 		}
+		if request.Config.EmailSettings.Provider != "" {
+			mergedConfig.EmailSettings.Provider = request.Config.EmailSettings.Provider
+			// Going back to the service's SES account drops the own provider's credentials and addresses
+			if !mergedConfig.EmailSettings.HasOwnProvider() {
+				mergedConfig.EmailSettings.SendGridAPIKey = ""
+				mergedConfig.EmailSettings.FromAddress = ""
+				mergedConfig.EmailSettings.FromAddressByType = nil
+				mergedConfig.EmailSettings.ReplyToAddress = ""
+			}
+		}
+		if request.Config.EmailSettings.SendGridAPIKey != "" {
+			mergedConfig.EmailSettings.SendGridAPIKey = request.Config.EmailSettings.SendGridAPIKey
+		}
+		if request.Config.EmailSettings.FromAddress != "" {
+			mergedConfig.EmailSettings.FromAddress = request.Config.EmailSettings.FromAddress
+		}
+		if request.Config.EmailSettings.FromAddressByType != nil {
+			mergedConfig.EmailSettings.FromAddressByType = request.Config.EmailSettings.FromAddressByType
+		}
+		if request.Config.EmailSettings.ReplyToAddress != "" {
+			mergedConfig.EmailSettings.ReplyToAddress = request.Config.EmailSettings.ReplyToAddress
+		}
 		if len(request.Config.InAppSettings.PlatformAppIDs) > 0 {
 			mergedConfig.InAppSettings.PlatformAppIDs = request.Config.InAppSettings.PlatformAppIDs
 		}
 		if request.Config.InAppSettings.Enabled != nil {
 			mergedConfig.InAppSettings.Enabled = request.Config.InAppSettings.Enabled
 		}
+		if request.Config.SmsSettings.Enabled != nil {
+			mergedConfig.SmsSettings.Enabled = request.Config.SmsSettings.Enabled
+		}
+		if request.Config.PushSettings.Enabled != nil {
+			mergedConfig.PushSettings.Enabled = request.Config.PushSettings.Enabled
+		}
+		if request.Config.WebhookSettings.URL != "" {
+			mergedConfig.WebhookSettings.URL = request.Config.WebhookSettings.URL
+		}
+		if request.Config.WebhookSettings.Secret != "" {
+			mergedConfig.WebhookSettings.Secret = request.Config.WebhookSettings.Secret
+		}
+		if request.Config.WebhookSettings.ExpectedStatuses != nil {
+			mergedConfig.WebhookSettings.ExpectedStatuses = request.Config.WebhookSettings.ExpectedStatuses
+		}
+		if request.Config.WebhookSettings.ExpectedBody != "" {
+			mergedConfig.WebhookSettings.ExpectedBody = request.Config.WebhookSettings.ExpectedBody
+		}
+		if request.Config.WebhookSettings.EndpointsByType != nil {
+			mergedConfig.WebhookSettings.EndpointsByType = request.Config.WebhookSettings.EndpointsByType
+		}
+		if request.Config.WebhookSettings.Enabled != nil {
+			mergedConfig.WebhookSettings.Enabled = request.Config.WebhookSettings.Enabled
+		}
+		if request.Config.TeamsSettings.WebhookURL != "" {
+			mergedConfig.TeamsSettings.WebhookURL = request.Config.TeamsSettings.WebhookURL
+		}
+		if request.Config.TeamsSettings.Enabled != nil {
+			mergedConfig.TeamsSettings.Enabled = request.Config.TeamsSettings.Enabled
+		}
+		if !request.Config.Calendar.IsEmpty() {
+			mergedConfig.Calendar = request.Config.Calendar
+		}
+		for _, section := range clearedSections {
+			clearConfigSection(&mergedConfig, section)
+		}
 
 		request.Config = mergedConfig
 	}
 	// Else we replace the whole config with the new one provided by super admin for global config
 
+	if err := request.Config.EmailSettings.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid email settings: "+err.Error(), nil), nil
+	}
+
 	// Validate user permissions for config fields
 	if errResponse := validateUserConfigPermissions(request.Config, context); errResponse.StatusCode != 0 {
 		return errResponse, nil
 	}
+	if errResponse := validateWebhookSecret(request.Config); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
 
 	updatedConfig, err := db.UpdateSystemConfig(ctx, shared.SystemConfig{
 		Context:     request.Context,
 		Config:      &request.Config,
 		Description: request.Description,
-	})
+	}, cleared...)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to update system config")
+		shared.LogError(ctx).Err(err).Msg("Failed to update system config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update system config", nil), nil
 	}
 
-	shared.LogInfo().Str("context", request.Context).Msg("System config updated successfully")
+	shared.LogInfo(ctx).Str("context", request.Context).Msg("System config updated successfully")
 
-	return shared.CreateAPIResponse(http.StatusOK, updatedConfig), nil
+	return shared.CreateAPIResponse(http.StatusOK, maskConfig(updatedConfig)), nil
 }
 
 func getSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -209,9 +601,14 @@ func getSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest, u
 		return errResponse, nil
 	}
 
+	reveal, errResponse := checkReveal(ctx, event, userContext)
+	if errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
 	config, err := db.GetSystemConfig(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get system config")
+		shared.LogError(ctx).Err(err).Msg("Failed to get system config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve system config", nil), nil
 	}
 
@@ -219,7 +616,10 @@ func getSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest, u
 		return shared.CreateErrorResponse(http.StatusNotFound, "System config not found", nil), nil
 	}
 
-	return shared.CreateAPIResponse(http.StatusOK, config), nil
+	if reveal {
+		return shared.CreateAPIResponse(http.StatusOK, config), nil
+	}
+	return shared.CreateAPIResponse(http.StatusOK, maskConfig(config)), nil
 }
 
 func listSystemConfigs(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -228,6 +628,11 @@ func listSystemConfigs(ctx context.Context, event events.APIGatewayProxyRequest,
 		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can list all configs", nil), nil
 	}
 
+	reveal, errResponse := checkReveal(ctx, event, userContext)
+	if errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
 	// Parse query parameters
 	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
 
@@ -240,10 +645,16 @@ func listSystemConfigs(ctx context.Context, event events.APIGatewayProxyRequest,
 	// Get configs list
 	configs, nextKey, err := db.GetSystemConfigList(ctx, limit, startKey)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get system configs list")
+		shared.LogError(ctx).Err(err).Msg("Failed to get system configs list")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve configs list", nil), nil
 	}
 
+	if !reveal {
+		for i := range configs {
+			configs[i] = maskConfig(configs[i])
+		}
+	}
+
 	// Create response
 	response := shared.PaginatedResponse{
 		Items:     configs,
@@ -263,7 +674,7 @@ func deleteSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 	// Check if config exists before deleting
 	existing, err := db.GetSystemConfig(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to check existing config")
+		shared.LogError(ctx).Err(err).Msg("Failed to check existing config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to check existing config", nil), nil
 	}
 	if existing.Context == "" {
@@ -272,15 +683,153 @@ func deleteSystemConfig(ctx context.Context, event events.APIGatewayProxyRequest
 
 	err = db.DeleteSystemConfig(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to delete system config")
+		shared.LogError(ctx).Err(err).Msg("Failed to delete system config")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete system config", nil), nil
 	}
 
-	shared.LogInfo().Str("context", context).Msg("System config deleted successfully")
+	shared.LogInfo(ctx).Str("context", context).Msg("System config deleted successfully")
 
 	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "System config deleted successfully"}), nil
 }
 
+type SlackTestRequest struct {
+	Context string `json:"context,omitempty"`
+}
+
+// testSlackWebhook posts a test message to the Slack webhook stored in the caller's config
+func testSlackWebhook(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request SlackTestRequest
+	if event.Body != "" {
+		if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+		}
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+
+	config, err := db.GetSystemConfig(ctx, context)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get system config")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve system config", nil), nil
+	}
+	if config.Config == nil || config.Config.SlackSettings.WebhookURL == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "No Slack webhook configured", nil), nil
+	}
+
+	recipient := engine.Recipient{ID: userContext.UserID, Config: config}
+	_, err = notificationEngine.Deliver(shared.WithoutCircuitBreaker(ctx), recipient, channelTestRequest(userContext), shared.ChannelSlack, shared.ChannelTestMessage)
+	if err != nil {
+		shared.LogWarn(ctx).Err(err).Str("context", context).Msg("Slack webhook test failed")
+		return shared.CreateErrorResponse(http.StatusBadGateway, "Slack webhook test failed", map[string]any{
+			"error": err.Error(),
+		}), nil
+	}
+
+	shared.LogInfo(ctx).Str("context", context).Msg("Slack webhook test succeeded")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Test message sent"}), nil
+}
+
+type ChannelTestRequest struct {
+	Channel string `json:"channel"`
+	Context string `json:"context,omitempty"`
+}
+
+// testChannel sends a canned test message through a channel with the context's effective config, the context's
+// own config or else the global one, and returns the provider's response. Email, SMS, push and in-app tests go to
+// the caller. Tests bypass the channel circuit breakers, so a misconfigured channel does not trip them
+func testChannel(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request ChannelTestRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if !shared.ValidateChannel(request.Channel) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid channel", nil), nil
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+
+	config, err := db.GetSystemConfig(ctx, context)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get system config")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve system config", nil), nil
+	}
+	if config.Context == "" && context != "*" {
+		config, err = db.GetSystemConfig(ctx, "*")
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get global config")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve system config", nil), nil
+		}
+	}
+	if config.Context == "" || config.Config == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "No config found", nil), nil
+	}
+
+	result := shared.ChannelTestResult{
+		Channel: request.Channel,
+		Context: config.Context,
+		Enabled: config.Config.ChannelEnabled(request.Channel),
+	}
+	// The test goes to the caller, delivered by the engine like any notification but with the config under test
+	recipient := engine.Recipient{ID: userContext.UserID, Config: config}
+	delivery, err := notificationEngine.Deliver(shared.WithoutCircuitBreaker(ctx), recipient, channelTestRequest(userContext), request.Channel, channelTestContent(request.Channel))
+	result.Provider = delivery.Provider
+	result.Recipient = delivery.Recipient
+	result.MessageID = delivery.ProviderMessageID
+	result.StatusCode = delivery.ResponseStatus
+	result.Response = delivery.ResponseBody
+	result.Devices = delivery.Devices
+	if err != nil {
+		result.Error = err.Error()
+		shared.LogWarn(ctx).Err(err).Str("context", config.Context).Str("channel", request.Channel).Msg("Channel test failed")
+		return shared.CreateErrorResponse(http.StatusBadGateway, "Channel test failed", result), nil
+	}
+
+	shared.LogInfo(ctx).Str("context", config.Context).Str("channel", request.Channel).Msg("Channel test succeeded")
+
+	return shared.CreateAPIResponse(http.StatusOK, result), nil
+}
+
+// channelTestRequest is the notification a channel test is delivered as, a test notification to the caller
+func channelTestRequest(userContext shared.UserContext) shared.NotificationRequest {
+	return shared.NotificationRequest{
+		ID:         shared.TestRequestIDPrefix + uuid.New().String(),
+		Type:       shared.NotificationTypeNotification,
+		Recipients: []string{userContext.UserID},
+		Test:       true,
+		Producer:   &shared.Producer{Kind: shared.ProducerAPIUser, ID: userContext.UserID},
+	}
+}
+
+// channelTestContent returns the test message rendered for a channel: email and Teams content carry a subject
+// or title with it
+func channelTestContent(channel string) string {
+	var content any
+	switch channel {
+	case shared.ChannelEmail:
+		content = shared.EmailContent{
+			Subject:  shared.ChannelTestSubject,
+			Body:     shared.ChannelTestMessage,
+			HTMLBody: "<p>" + shared.ChannelTestMessage + "</p>",
+		}
+	case shared.ChannelTeams:
+		content = shared.TeamsMessage{Title: shared.ChannelTestSubject, Text: shared.ChannelTestMessage}
+	default:
+		return shared.ChannelTestMessage
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return shared.ChannelTestMessage
+	}
+	return string(data)
+}
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapAPIHandler("config", handler))
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// reminderWindow is the span of expiries each daily run covers, so every expiry is reminded once
+const reminderWindow = 24 * time.Hour
+
+// consequences tells owners what happens when each kind of resource expires
+var consequences = map[string]string{
+	shared.ExpiryKindSchedule: "The schedule stops sending notifications after that date. Update its endDate to keep it running.",
+	shared.ExpiryKindRule:     "The routing rule stops applying after that date. Update its temporaryUntil to keep it, or delete it once it is no longer needed.",
+	shared.ExpiryKindTemplate: "The template is no longer used after that date, notifications use the global template instead when there is one. Update its temporaryUntil to keep it, or delete it once it is no longer needed.",
+}
+
+func init() {
+	shared.InitAWS()
+}
+
+// expiring is a schedule, rule or template reaching its end date or temporary expiry
+type expiring struct {
+	Kind      string
+	ID        string
+	Name      string
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	days := shared.GetEnvInt("EXPIRY_REMINDER_DAYS", 3)
+	to := shared.GetCurrentTime().Add(time.Duration(days) * 24 * time.Hour)
+	from := to.Add(-reminderWindow)
+
+	shared.LogInfo(ctx).Time("from", from).Time("to", to).Msg("Expiry reminders started")
+
+	items, err := findExpiring(ctx, from, to)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to find expiring schedules, rules and templates")
+		return err
+	}
+
+	var bodies []string
+	for _, item := range items {
+		if item.Owner == "" {
+			shared.LogWarn(ctx).Str("kind", item.Kind).Str("id", item.ID).Msg("Expiring resource has no owner, skipping reminder")
+			continue
+		}
+		body, err := json.Marshal(buildReminderRequest(item, days))
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, string(body))
+	}
+
+	if err := services.SqsSendMessages(ctx, shared.NotificationQueueURL, bodies); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to queue expiry reminders")
+		return err
+	}
+
+	shared.LogInfo(ctx).Int("expiring", len(items)).Int("reminders", len(bodies)).Msg("Expiry reminders completed")
+	return nil
+}
+
+// findExpiring lists the active schedules, rules and templates expiring after from and up to to
+func findExpiring(ctx context.Context, from, to time.Time) ([]expiring, error) {
+	inWindow := func(expiry *time.Time) bool {
+		return expiry != nil && expiry.After(from) && !expiry.After(to)
+	}
+
+	var items []expiring
+
+	schedules, err := db.GetActiveSchedulesWithEndDate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan schedules: %w", err)
+	}
+	for _, schedule := range schedules {
+		if schedule.Schedule == nil || !inWindow(schedule.Schedule.EndDate) {
+			continue
+		}
+		items = append(items, expiring{
+			Kind:      shared.ExpiryKindSchedule,
+			ID:        schedule.ScheduleID,
+			Name:      fmt.Sprintf("%s (%s)", schedule.Type, schedule.ScheduleID),
+			Owner:     schedule.UserID,
+			ExpiresAt: *schedule.Schedule.EndDate,
+		})
+	}
+
+	rules, err := db.GetAllRules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan rules: %w", err)
+	}
+	for _, rule := range rules {
+		if !rule.IsEnabled() || !inWindow(rule.TemporaryUntil) {
+			continue
+		}
+		items = append(items, expiring{
+			Kind:      shared.ExpiryKindRule,
+			ID:        rule.RuleID,
+			Name:      rule.Name,
+			Owner:     rule.CreatedBy,
+			ExpiresAt: *rule.TemporaryUntil,
+		})
+	}
+
+	templates, err := db.GetAllTemplates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan templates: %w", err)
+	}
+	for _, template := range templates {
+		if !inWindow(template.TemporaryUntil) {
+			continue
+		}
+		items = append(items, expiring{
+			Kind:      shared.ExpiryKindTemplate,
+			ID:        template.Context + "/" + template.TypeChannel,
+			Name:      template.TypeChannel,
+			Owner:     template.Owner(),
+			ExpiresAt: *template.TemporaryUntil,
+		})
+	}
+
+	return items, nil
+}
+
+// buildReminderRequest builds the reminder of one expiring resource, rendered with the built-in template.
+// The ID names the resource and its expiry so the reminder can be found in the history
+func buildReminderRequest(item expiring, days int) shared.NotificationRequest {
+	expiresAt := item.ExpiresAt.UTC().Format(shared.DateFormat)
+	return shared.NotificationRequest{
+		ID:         fmt.Sprintf("expiry-reminder-%s-%s-%s", item.Kind, item.ID, expiresAt),
+		Type:       shared.NotificationTypeNotification,
+		Recipients: []string{item.Owner},
+		Variables: map[string]any{
+			"kind":        item.Kind,
+			"name":        item.Name,
+			"expiresAt":   expiresAt,
+			"days":        days,
+			"consequence": consequences[item.Kind],
+		},
+		SystemTemplate: shared.SystemTemplateExpiryReminder,
+		Producer:       &shared.Producer{Kind: shared.ProducerSystem, ID: "expiryreminder"},
+	}
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("expiryreminder", handler))
+}
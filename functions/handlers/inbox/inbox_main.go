@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	NotificationIDPathParam = "notificationId"
+	LimitQueryParam         = "limit"
+	NextTokenQueryParam     = "nextToken"
+	UnreadQueryParam        = "unread"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+// handler serves the caller's own in-app inbox, users can never read another user's notifications
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Inbox handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	notificationID := event.PathParameters[NotificationIDPathParam]
+
+	switch event.HTTPMethod {
+	case http.MethodGet:
+		if notificationID != "" {
+			return getInboxItem(ctx, userContext, notificationID)
+		}
+		return listInboxItems(ctx, event, userContext)
+	case http.MethodPost:
+		if notificationID != "" && strings.HasSuffix(event.Resource, "/read") {
+			return markInboxItemRead(ctx, userContext, notificationID)
+		}
+		return shared.CreateErrorResponse(http.StatusNotFound, "Not found", nil), nil
+	case http.MethodDelete:
+		if notificationID == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Notification ID is required", nil), nil
+		}
+		return deleteInboxItem(ctx, userContext, notificationID)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+func listInboxItems(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+	unreadOnly := event.QueryStringParameters[UnreadQueryParam] == "true"
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	items, nextKey, err := db.GetInboxItems(ctx, userContext.UserID, unreadOnly, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get inbox")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve inbox", nil), nil
+	}
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     items,
+		Count:     len(items),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func getInboxItem(ctx context.Context, userContext shared.UserContext, notificationID string) (shared.APIResponse, error) {
+	item, err := db.GetInboxItem(ctx, userContext.UserID, notificationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get inbox item")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification", nil), nil
+	}
+	if item.NotificationID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, item), nil
+}
+
+func markInboxItemRead(ctx context.Context, userContext shared.UserContext, notificationID string) (shared.APIResponse, error) {
+	item, err := db.MarkInboxItemRead(ctx, userContext.UserID, notificationID)
+	if err != nil {
+		if services.IsConditionalCheckFailed(err) {
+			return shared.CreateErrorResponse(http.StatusNotFound, "Notification not found", nil), nil
+		}
+		shared.LogError(ctx).Err(err).Msg("Failed to mark inbox item read")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to mark notification read", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("notificationId", notificationID).Msg("Inbox item marked read")
+
+	return shared.CreateAPIResponse(http.StatusOK, item), nil
+}
+
+func deleteInboxItem(ctx context.Context, userContext shared.UserContext, notificationID string) (shared.APIResponse, error) {
+	err := db.DeleteInboxItem(ctx, userContext.UserID, notificationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete inbox item")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete notification", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("notificationId", notificationID).Msg("Inbox item deleted successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Notification deleted successfully"}), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("inbox", handler))
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// stopBefore is how long before the Lambda deadline the janitor stops, the next run starts over
+const stopBefore = 30 * time.Second
+
+// managedTable is a table under a retention policy: its key and the timestamp its retention counts from
+type managedTable struct {
+	Policy    string
+	TableName string
+	Keys      []string
+	Timestamp string
+}
+
+// tableStats counts what the janitor did to one table
+type tableStats struct {
+	Scanned     int
+	Backfilled  int
+	Deleted     int
+	NoTimestamp int
+}
+
+func init() {
+	shared.InitAWS()
+}
+
+func managedTables() []managedTable {
+	return []managedTable{
+		{Policy: shared.RetentionHistory, TableName: shared.HistoryTable, Keys: []string{db.ColHistoryID}, Timestamp: db.ColHistoryCreatedAt},
+		{Policy: shared.RetentionAudit, TableName: shared.AcknowledgmentsTable, Keys: []string{db.ColAckNotificationID, db.ColAckUserID}, Timestamp: db.ColAcknowledgedAt},
+		{Policy: shared.RetentionResults, TableName: shared.NotificationValidationTable, Keys: []string{db.ColValidationIDUserIDTypeChannel}, Timestamp: db.ColValidationCreatedAt},
+		{Policy: shared.RetentionQuarantine, TableName: shared.QuarantineTable, Keys: []string{db.ColQuarantineMessageID}, Timestamp: db.ColQuarantineQuarantinedAt},
+		{Policy: shared.RetentionQuarantine, TableName: shared.FailedNotificationsTable, Keys: []string{db.ColFailedMessageID}, Timestamp: db.ColFailedAt},
+	}
+}
+
+// handler enforces the global retention policy on every managed table. Rows whose TTL does not match the
+// policy, including legacy rows written without one, get it backfilled; rows already past their retention
+// are deleted rather than left for DynamoDB's lazy TTL deletion
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	settings := db.GetRetentionSettings(ctx)
+	shared.LogInfo(ctx).Interface("retention", settings).Msg("Retention janitor started")
+
+	// The processor already ignores expired overrides, removing them is cleanup and never fails the run
+	sweepPreferenceOverrides(ctx)
+	// Rows stored before their table was listed are missing from its list until they get a list key
+	backfillListKeys(ctx)
+
+	for _, table := range managedTables() {
+		stats, err := enforceRetention(ctx, table, settings)
+		logEvent := shared.LogInfo(ctx)
+		if err != nil {
+			logEvent = shared.LogError(ctx).Err(err)
+		}
+		logEvent.Str("policy", table.Policy).Int("days", settings.Days(table.Policy)).
+			Int("scanned", stats.Scanned).Int("backfilled", stats.Backfilled).Int("deleted", stats.Deleted).
+			Int("noTimestamp", stats.NoTimestamp).Msg("Retention enforced")
+		if err != nil {
+			return err
+		}
+		if outOfTime(ctx) {
+			shared.LogWarn(ctx).Str("policy", table.Policy).Msg("Retention janitor ran out of time, the next run starts over")
+			return nil
+		}
+	}
+
+	shared.LogInfo(ctx).Msg("Retention janitor completed")
+	return nil
+}
+
+// enforceRetention walks a table and brings every row's TTL in line with the table's retention policy
+func enforceRetention(ctx context.Context, table managedTable, settings shared.RetentionSettings) (tableStats, error) {
+	var stats tableStats
+	now := shared.GetCurrentTime()
+	attributes := append(append([]string{}, table.Keys...), table.Timestamp, db.ColExpiresAt)
+
+	var startKey map[string]types.AttributeValue
+	for {
+		rows, nextKey, err := db.ScanRetentionRows(ctx, table.TableName, attributes, startKey)
+		if err != nil {
+			return stats, err
+		}
+
+		for _, row := range rows {
+			stats.Scanned++
+			key := make(map[string]any, len(table.Keys))
+			for _, name := range table.Keys {
+				key[name] = row[name]
+			}
+
+			timestamp, _ := row[table.Timestamp].(string)
+			createdAt, err := time.Parse(time.RFC3339Nano, timestamp)
+			if err != nil {
+				// Without a timestamp the row's age is unknown, it is left alone
+				stats.NoTimestamp++
+				continue
+			}
+
+			// 0 when the policy keeps rows forever
+			expiresAt := settings.ExpiresAt(table.Policy, createdAt)
+			if expiresAt != 0 && expiresAt <= int(now.Unix()) {
+				if err := db.DeleteRow(ctx, table.TableName, key); err != nil {
+					return stats, err
+				}
+				stats.Deleted++
+				continue
+			}
+
+			current, _ := row[db.ColExpiresAt].(float64)
+			if int(current) == expiresAt {
+				continue
+			}
+			err = db.SetRowExpiresAt(ctx, table.TableName, key, table.Keys[0], expiresAt)
+			if services.IsConditionalCheckFailed(err) {
+				continue
+			}
+			if err != nil {
+				return stats, err
+			}
+			stats.Backfilled++
+		}
+
+		if nextKey == nil || outOfTime(ctx) {
+			return stats, nil
+		}
+		startKey = nextKey
+	}
+}
+
+// sweepPreferenceOverrides removes expired overrides from every preference set, reverting them in storage
+func sweepPreferenceOverrides(ctx context.Context) {
+	preferences, err := db.GetPreferencesWithOverrides(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan preference overrides")
+		return
+	}
+
+	now := shared.GetCurrentTime()
+	reverted := 0
+	for _, prefs := range preferences {
+		active := prefs.ActiveOverrides(now)
+		if len(active) == len(prefs.Overrides) {
+			continue
+		}
+		// A set changed since the scan is swept on the next run
+		_, err := db.SetPreferenceOverrides(ctx, prefs.Context, active, prefs.Overrides)
+		if err != nil && !services.IsConditionalCheckFailed(err) {
+			shared.LogError(ctx).Err(err).Str("context", prefs.Context).Msg("Failed to remove expired preference overrides")
+			continue
+		}
+		if err == nil {
+			reverted += len(prefs.Overrides) - len(active)
+		}
+	}
+	shared.LogInfo(ctx).Int("preferenceSets", len(preferences)).Int("reverted", reverted).Msg("Expired preference overrides swept")
+}
+
+// backfillListKeys moves the rows of every listed table stored without a list key, or with the former single
+// one, to their list shard
+func backfillListKeys(ctx context.Context) {
+	for _, table := range db.ListedTables() {
+		backfilled := 0
+		var startKey map[string]types.AttributeValue
+		for {
+			keys, nextKey, err := db.ScanUnlistedKeys(ctx, table, startKey)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Str("table", table.TableName).Msg("Failed to scan rows without a list key")
+				break
+			}
+			for _, key := range keys {
+				err := db.SetRowListKey(ctx, table, key)
+				if err != nil && !services.IsConditionalCheckFailed(err) {
+					shared.LogError(ctx).Err(err).Str("table", table.TableName).Msg("Failed to backfill list key")
+					continue
+				}
+				if err == nil {
+					backfilled++
+				}
+			}
+			if nextKey == nil || outOfTime(ctx) {
+				break
+			}
+			startKey = nextKey
+		}
+		if backfilled > 0 {
+			shared.LogInfo(ctx).Str("table", table.TableName).Int("backfilled", backfilled).Msg("List keys backfilled")
+		}
+		if outOfTime(ctx) {
+			return
+		}
+	}
+}
+
+// outOfTime reports whether the Lambda is about to reach its deadline
+func outOfTime(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < stopBefore
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("janitor", handler))
+}
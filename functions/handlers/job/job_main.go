@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	JobIDPathParam = "jobId"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Job handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	switch event.HTTPMethod {
+	case http.MethodGet:
+		return getJob(ctx, event, userContext)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+func getJob(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	jobID := event.PathParameters[JobIDPathParam]
+	if jobID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Job ID is required", nil), nil
+	}
+
+	job, err := db.GetJob(ctx, jobID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("jobId", jobID).Msg("Failed to get job")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve job", nil), nil
+	}
+	if job.JobID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Job not found", nil), nil
+	}
+
+	// Users can only see the jobs they queued themselves or through their schedules
+	if userContext.Role != shared.RoleSuperAdmin {
+		owned, err := isJobOwner(ctx, job, userContext.UserID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("jobId", jobID).Msg("Failed to check job owner")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve job", nil), nil
+		}
+		if !owned {
+			return shared.CreateErrorResponse(http.StatusNotFound, "Job not found", nil), nil
+		}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, job), nil
+}
+
+// isJobOwner reports whether the user queued the job's request, through the API or one of their schedules
+func isJobOwner(ctx context.Context, job shared.Job, userID string) (bool, error) {
+	if job.Producer == nil {
+		return false, nil
+	}
+	switch job.Producer.Kind {
+	case shared.ProducerAPIUser:
+		return job.Producer.ID == userID, nil
+	case shared.ProducerSchedule:
+		schedule, err := db.GetScheduledNotification(ctx, job.Producer.ID)
+		if err != nil {
+			return false, err
+		}
+		return schedule.UserID == userID, nil
+	default:
+		return false, nil
+	}
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("job", handler))
+}
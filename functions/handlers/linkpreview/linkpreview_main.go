@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// Stream record attributes of an inbox item
+const (
+	attrUserID         = "userId"
+	attrNotificationID = "notificationId"
+	attrContent        = "content"
+	attrCreatedAt      = "createdAt"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+// handler attaches link previews to in-app notifications as they land in the inbox stream. Previews are
+// best effort: a link that cannot be fetched is left out and never fails the batch
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	cacheTTL := shared.GetEnvDuration("LINK_PREVIEW_CACHE_TTL", 24*time.Hour)
+
+	for _, record := range event.Records {
+		if !isDelivery(record) {
+			continue
+		}
+		image := record.Change.NewImage
+		userID := image[attrUserID].String()
+		notificationID := image[attrNotificationID].String()
+
+		links := shared.ExtractLinks(image[attrContent].String(), shared.MaxLinkPreviews)
+		if len(links) == 0 {
+			continue
+		}
+
+		var previews []shared.LinkPreview
+		for _, link := range links {
+			if preview := getLinkPreview(ctx, link, cacheTTL); preview != nil {
+				previews = append(previews, *preview)
+			}
+		}
+		if len(previews) == 0 {
+			continue
+		}
+
+		err := db.SetInboxItemPreviews(ctx, userID, notificationID, previews)
+		if services.IsConditionalCheckFailed(err) {
+			// The user deleted the notification before its previews were ready
+			continue
+		}
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("userId", userID).Str("notificationId", notificationID).Msg("Failed to attach link previews")
+			continue
+		}
+
+		shared.LogInfo(ctx).Str("userId", userID).Str("notificationId", notificationID).Int("previews", len(previews)).Msg("Link previews attached")
+	}
+	return nil
+}
+
+// isDelivery reports whether the record is an in-app notification being delivered: a new item, or an item
+// the processor stored again for a redelivered request. Marking read or attaching previews keeps createdAt
+func isDelivery(record events.DynamoDBEventRecord) bool {
+	switch events.DynamoDBOperationType(record.EventName) {
+	case events.DynamoDBOperationTypeInsert:
+		return true
+	case events.DynamoDBOperationTypeModify:
+		return record.Change.OldImage[attrCreatedAt].String() != record.Change.NewImage[attrCreatedAt].String()
+	default:
+		return false
+	}
+}
+
+// getLinkPreview returns a link's preview from the cache, fetching and caching it when it is not cached.
+// The absence of a preview is cached too, so a page without metadata is not fetched for every notification
+func getLinkPreview(ctx context.Context, link string, cacheTTL time.Duration) *shared.LinkPreview {
+	preview, found, err := db.GetCachedLinkPreview(ctx, link)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("url", link).Msg("Failed to read link preview cache")
+	}
+	if found {
+		return preview
+	}
+
+	preview, err = shared.FetchLinkPreview(ctx, link)
+	if err != nil {
+		// Not cached, the page may be back for the next notification
+		shared.LogWarn(ctx).Err(err).Str("url", link).Msg("Failed to fetch link preview")
+		return nil
+	}
+
+	if err := db.CacheLinkPreview(ctx, link, preview, cacheTTL); err != nil {
+		shared.LogError(ctx).Err(err).Str("url", link).Msg("Failed to cache link preview")
+	}
+	return preview
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("linkpreview", handler))
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+// summaryWindow is how far back each weekly run looks beyond the minimum age, so every
+// unread notification is reported once
+const summaryWindow = 7 * 24 * time.Hour
+
+// maxSummaryItems caps the items listed in one email
+const maxSummaryItems = 20
+
+func init() {
+	shared.InitAWS()
+}
+
+// missedItem is an in-app notification a user has not acknowledged
+type missedItem struct {
+	NotificationID string
+	Type           string
+	Variables      map[string]any
+	CreatedAt      time.Time
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	minAge := time.Duration(shared.GetEnvInt("MISSED_SUMMARY_MIN_AGE_DAYS", 3)) * 24 * time.Hour
+	to := shared.GetCurrentTime().Add(-minAge)
+	from := to.Add(-summaryWindow)
+
+	shared.LogInfo(ctx).Time("from", from).Time("to", to).Msg("Missed notifications summary started")
+
+	history, err := db.GetNotificationHistoryBetween(ctx, from, to)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to scan notification history")
+		return err
+	}
+
+	missed, err := findUnreadInApp(ctx, history)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to check acknowledgments")
+		return err
+	}
+
+	var bodies []string
+	date := shared.GetCurrentTime().Format(shared.DateFormat)
+	for userID, items := range missed {
+		enabled, err := isSummaryEnabled(ctx, userID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("userId", userID).Msg("Failed to get preferences, skipping user")
+			continue
+		}
+		if !enabled {
+			continue
+		}
+
+		body, err := json.Marshal(buildSummaryRequest(userID, date, items))
+		if err != nil {
+			return err
+		}
+		bodies = append(bodies, string(body))
+	}
+
+	if err := services.SqsSendMessages(ctx, shared.NotificationQueueURL, bodies); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to queue summaries")
+		return err
+	}
+
+	shared.LogInfo(ctx).Int("usersWithUnread", len(missed)).Int("summaries", len(bodies)).Msg("Missed notifications summary completed")
+	return nil
+}
+
+// findUnreadInApp groups the delivered in-app notifications without an acknowledgment by recipient
+func findUnreadInApp(ctx context.Context, history []shared.NotificationHistory) (map[string][]missedItem, error) {
+	missed := make(map[string][]missedItem)
+	for _, record := range history {
+		if record.Request == nil || record.Request.SystemTemplate != "" || record.CreatedAt == nil {
+			continue
+		}
+
+		for _, delivery := range record.Deliveries {
+			if delivery.Channel != shared.ChannelInApp || !delivery.Success || delivery.Suppressed || delivery.DryRun {
+				continue
+			}
+
+			ack, err := db.GetAcknowledgment(ctx, record.ID, delivery.RecipientID)
+			if err != nil {
+				return nil, err
+			}
+			if ack.NotificationID != "" {
+				continue
+			}
+
+			missed[delivery.RecipientID] = append(missed[delivery.RecipientID], missedItem{
+				NotificationID: record.ID,
+				Type:           record.Type,
+				Variables:      record.Request.Variables,
+				CreatedAt:      *record.CreatedAt,
+			})
+		}
+	}
+	return missed, nil
+}
+
+// isSummaryEnabled checks the user's opt-out, falling back to the global preferences
+func isSummaryEnabled(ctx context.Context, userID string) (bool, error) {
+	preferences, err := db.GetUserPreferences(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if preferences.Context == "" {
+		preferences, err = db.GetUserPreferences(ctx, "*")
+		if err != nil {
+			return false, err
+		}
+	}
+	return preferences.IsMissedSummaryEnabled(), nil
+}
+
+// buildSummaryRequest lists the oldest unread notifications in a request rendered with the built-in template
+func buildSummaryRequest(userID, date string, items []missedItem) shared.NotificationRequest {
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt.Before(items[j].CreatedAt)
+	})
+
+	lines := make([]string, 0, min(len(items), maxSummaryItems)+1)
+	for i, item := range items {
+		if i == maxSummaryItems {
+			lines = append(lines, fmt.Sprintf("... and %d more", len(items)-maxSummaryItems))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s %s", item.CreatedAt.Format(shared.DateFormat), shared.SummarizeNotification(item.Type, item.Variables)))
+	}
+
+	return shared.NotificationRequest{
+		ID:         fmt.Sprintf("missed-summary-%s-%s", userID, date),
+		Type:       shared.NotificationTypeNotification,
+		Recipients: []string{userID},
+		Variables: map[string]any{
+			"count":   len(items),
+			"message": strings.Join(lines, "\n"),
+		},
+		SystemTemplate: shared.SystemTemplateMissedSummary,
+		Producer:       &shared.Producer{Kind: shared.ProducerSystem, ID: "missedsummary"},
+	}
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("missedsummary", handler))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/engine"
+	"notification-service/functions/shared"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	NotificationIDPathParam = "notificationId"
+)
+
+var notificationEngine = engine.New()
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Notification handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		if strings.HasSuffix(event.Resource, "/simulate") {
+			return simulateNotification(ctx, event, userContext)
+		}
+		return acknowledgeNotification(ctx, event, userContext)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type AcknowledgeRequest struct {
+	Note string `json:"note,omitempty"`
+}
+
+func acknowledgeNotification(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	notificationID := event.PathParameters[NotificationIDPathParam]
+	if notificationID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Notification ID is required", nil), nil
+	}
+
+	// The body is optional for acknowledgments
+	var request AcknowledgeRequest
+	if event.Body != "" {
+		if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+		}
+	}
+
+	history, err := db.GetNotificationHistory(ctx, notificationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationId", notificationID).Msg("Failed to get notification history")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification", nil), nil
+	}
+	if history.ID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification not found", nil), nil
+	}
+
+	// Only recipients (or super admins) can acknowledge a notification
+	isRecipient := history.Request != nil && slices.Contains(history.Request.Recipients, userContext.UserID)
+	if !isRecipient && userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only recipients can acknowledge this notification", nil), nil
+	}
+
+	now := shared.GetCurrentTime()
+	ack := shared.Acknowledgment{
+		NotificationID: notificationID,
+		UserID:         userContext.UserID,
+		Type:           history.Type,
+		Note:           request.Note,
+		SentAt:         history.CreatedAt,
+		AcknowledgedAt: &now,
+		AckDate:        now.Format(shared.DateFormat),
+	}
+	if history.CreatedAt != nil {
+		ack.TimeToAckSeconds = now.Sub(*history.CreatedAt).Seconds()
+	}
+
+	created, err := db.CreateAcknowledgment(ctx, ack)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("notificationId", notificationID).Msg("Failed to create acknowledgment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to acknowledge notification", nil), nil
+	}
+	if !created {
+		return shared.CreateErrorResponse(http.StatusConflict, "Notification already acknowledged", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("notificationId", notificationID).Msg("Notification acknowledged successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, ack), nil
+}
+
+// simulateNotification renders what a notification would reach a user with on each channel, through the same
+// engine the processor delivers with. Nothing is queued or sent. Users simulate their own notifications,
+// admins anyone's
+func simulateNotification(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request shared.SimulationRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if !shared.ValidateNotificationType(request.Type) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type", nil), nil
+	}
+	for _, channel := range request.Channels {
+		if !shared.ValidateChannel(channel) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid channel: "+channel, nil), nil
+		}
+	}
+	recipientID, errResponse := shared.ValidateContext(request.RecipientID, userContext)
+	if recipientID == "" {
+		return errResponse, nil
+	}
+	if recipientID == "*" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Notifications are simulated for a user", nil), nil
+	}
+
+	user, err := db.GetUserByID(ctx, recipientID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to get user")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+	}
+	if user == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+	}
+
+	recipient, err := notificationEngine.Resolve(ctx, recipientID, nil)
+	if err != nil {
+		shared.LogWarn(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to resolve recipient")
+		return shared.CreateErrorResponse(http.StatusNotFound, "No preferences or config found for the user", nil), nil
+	}
+	if request.Language != "" {
+		recipient = recipient.WithLanguage(request.Language)
+	}
+
+	simulation := notificationEngine.Simulate(ctx, recipient, shared.NotificationRequest{
+		Type:       request.Type,
+		Recipients: []string{recipientID},
+		Variables:  request.Variables,
+		Channels:   request.Channels,
+	})
+	return shared.CreateAPIResponse(http.StatusOK, simulation), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("notification", handler))
+}
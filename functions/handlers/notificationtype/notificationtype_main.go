@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+const (
+	TypePathParam = "type"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Notification type handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Notification types are shared by every user of the service, only super admins can manage them
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage notification types", nil), nil
+	}
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createNotificationType(ctx, event, userContext)
+	case http.MethodPut:
+		return updateNotificationType(ctx, event, userContext)
+	case http.MethodGet:
+		if event.PathParameters != nil && event.PathParameters[TypePathParam] != "" {
+			return getNotificationType(ctx, event)
+		}
+		return listNotificationTypes(ctx)
+	case http.MethodDelete:
+		return deleteNotificationType(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type NotificationTypeRequest struct {
+	Type            string                      `json:"type,omitempty"` // Only on create
+	DisplayName     string                      `json:"displayName,omitempty"`
+	Description     string                      `json:"description,omitempty"`
+	Category        string                      `json:"category,omitempty"`
+	DefaultChannels []string                    `json:"defaultChannels,omitempty"` // Replaced as a whole, [] removes every default channel
+	Variables       []shared.VariableDefinition `json:"variables,omitempty"`       // Replaces the type's variable schema
+}
+
+func createNotificationType(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request NotificationTypeRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	notificationType := shared.NotificationType{
+		Type:            request.Type,
+		DisplayName:     request.DisplayName,
+		Description:     request.Description,
+		Category:        request.Category,
+		DefaultChannels: request.DefaultChannels,
+		Variables:       request.Variables,
+		CreatedBy:       userContext.UserID,
+	}
+	if err := notificationType.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type: "+err.Error(), nil), nil
+	}
+
+	// The schema is stored first, a type is never registered without the variables it was created with
+	if request.Variables != nil {
+		if _, err := db.PutVariableSchema(ctx, shared.VariableSchema{
+			Type:      notificationType.Type,
+			Variables: request.Variables,
+			UpdatedBy: userContext.UserID,
+		}); err != nil {
+			shared.LogError(ctx).Err(err).Str("type", notificationType.Type).Msg("Failed to store variable schema")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create notification type", nil), nil
+		}
+	}
+
+	created, err := db.CreateNotificationType(ctx, notificationType)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", notificationType.Type).Msg("Failed to create notification type")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create notification type", nil), nil
+	}
+	if !created {
+		return shared.CreateErrorResponse(http.StatusConflict, "Notification type already exists", nil), nil
+	}
+	shared.InvalidateNotificationTypes()
+
+	shared.LogAudit(ctx, "notification_type.create").Str("type", notificationType.Type).Msg("Notification type created")
+
+	return shared.CreateAPIResponse(http.StatusCreated, notificationType), nil
+}
+
+func updateNotificationType(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	name := event.PathParameters[TypePathParam]
+
+	var request NotificationTypeRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if request.DisplayName == "" && request.Description == "" && request.Category == "" && request.DefaultChannels == nil && request.Variables == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	if request.Type != "" && request.Type != name {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "A notification type cannot be renamed", nil), nil
+	}
+
+	existing, err := loadNotificationType(ctx, name)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification type", nil), nil
+	}
+	if existing.Type == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	// The merged type is validated as a whole
+	notificationType := existing
+	if request.DisplayName != "" {
+		notificationType.DisplayName = request.DisplayName
+	}
+	if request.Description != "" {
+		notificationType.Description = request.Description
+	}
+	if request.Category != "" {
+		notificationType.Category = request.Category
+	}
+	if request.DefaultChannels != nil {
+		notificationType.DefaultChannels = request.DefaultChannels
+	}
+	if request.Variables != nil {
+		notificationType.Variables = request.Variables
+	}
+	if err := notificationType.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type: "+err.Error(), nil), nil
+	}
+
+	if request.Variables != nil {
+		schema, err := db.GetVariableSchema(ctx, name)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to get variable schema")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update notification type", nil), nil
+		}
+		schema.Type = name
+		schema.Variables = request.Variables
+		schema.UpdatedBy = userContext.UserID
+		if _, err := db.PutVariableSchema(ctx, schema); err != nil {
+			shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to store variable schema")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update notification type", nil), nil
+		}
+	}
+
+	updated, err := db.PutNotificationType(ctx, notificationType)
+	if services.IsConditionalCheckFailed(err) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to update notification type")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update notification type", nil), nil
+	}
+
+	shared.LogAudit(ctx, "notification_type.update").Str("type", name).Msg("Notification type updated")
+
+	return shared.CreateAPIResponse(http.StatusOK, updated), nil
+}
+
+func getNotificationType(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	notificationType, err := loadNotificationType(ctx, event.PathParameters[TypePathParam])
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification type", nil), nil
+	}
+	if notificationType.Type == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, notificationType), nil
+}
+
+// listNotificationTypes returns the registered notification types. The built-in ones are not listed
+func listNotificationTypes(ctx context.Context) (shared.APIResponse, error) {
+	notificationTypes, err := db.GetNotificationTypes(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get notification types")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification types", nil), nil
+	}
+	if notificationTypes == nil {
+		notificationTypes = []shared.NotificationType{}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items: notificationTypes,
+		Count: len(notificationTypes),
+	}), nil
+}
+
+// deleteNotificationType removes a registered type with its variable schema. A type that templates still
+// use is kept, requests of a deleted type fail validation
+func deleteNotificationType(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	name := event.PathParameters[TypePathParam]
+
+	existing, err := db.GetNotificationType(ctx, name)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to get notification type")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve notification type", nil), nil
+	}
+	if existing.Type == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Notification type not found", nil), nil
+	}
+
+	templates, err := db.GetAllTemplates(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get templates")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to check templates of the notification type", nil), nil
+	}
+	var used int
+	for _, template := range templates {
+		if notificationType, _ := shared.ParseTypeChannel(template.TypeChannel); notificationType == name {
+			used++
+		}
+	}
+	if used > 0 {
+		return shared.CreateErrorResponse(http.StatusConflict, fmt.Sprintf("Notification type is used by %d templates, delete them first", used), nil), nil
+	}
+
+	if err := db.DeleteNotificationType(ctx, name); err != nil {
+		shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to delete notification type")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete notification type", nil), nil
+	}
+	shared.InvalidateNotificationTypes()
+	if err := db.DeleteVariableSchema(ctx, name); err != nil {
+		shared.LogWarn(ctx).Err(err).Str("type", name).Msg("Failed to delete variable schema of deleted notification type")
+	}
+
+	shared.LogAudit(ctx, "notification_type.delete").Str("type", name).Msg("Notification type deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Notification type deleted successfully"}), nil
+}
+
+// loadNotificationType gets a registered notification type with its variable schema, empty when not found
+func loadNotificationType(ctx context.Context, name string) (shared.NotificationType, error) {
+	notificationType, err := db.GetNotificationType(ctx, name)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to get notification type")
+		return shared.NotificationType{}, err
+	}
+	if notificationType.Type == "" {
+		return notificationType, nil
+	}
+
+	schema, err := db.GetVariableSchema(ctx, name)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", name).Msg("Failed to get variable schema")
+		return shared.NotificationType{}, err
+	}
+	notificationType.Variables = schema.Variables
+	return notificationType, nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("notificationtype", handler))
+}
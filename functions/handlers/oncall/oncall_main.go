@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	RotationIDPathParam = "rotationId"
+	LimitQueryParam     = "limit"
+	NextTokenQueryParam = "nextToken"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("On-call handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Anyone can view rotations, only super admins can manage them
+	if event.HTTPMethod != http.MethodGet && userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage on-call rotations", nil), nil
+	}
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createOnCallRotation(ctx, event)
+	case http.MethodPut:
+		return updateOnCallRotation(ctx, event)
+	case http.MethodGet:
+		if event.PathParameters != nil && event.PathParameters[RotationIDPathParam] != "" {
+			return getOnCallRotation(ctx, event)
+		}
+		return listOnCallRotations(ctx, event)
+	case http.MethodDelete:
+		return deleteOnCallRotation(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type OnCallRotationRequest struct {
+	Name       string                  `json:"name,omitempty"`
+	Members    []string                `json:"members,omitempty"`
+	StartAt    *time.Time              `json:"startAt,omitempty"`
+	ShiftHours int                     `json:"shiftHours,omitempty"`
+	Overrides  []shared.OnCallOverride `json:"overrides,omitempty"`
+}
+
+// OnCallRotationResponse includes the user currently on call
+type OnCallRotationResponse struct {
+	shared.OnCallRotation
+	CurrentOnCall string `json:"currentOnCall,omitempty"`
+}
+
+func validateOverrides(overrides []shared.OnCallOverride) shared.APIResponse {
+	for _, override := range overrides {
+		if override.UserID == "" || override.StartAt == nil || override.EndAt == nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Overrides require userId, startAt and endAt", nil)
+		}
+		if !override.EndAt.After(*override.StartAt) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Override endAt must be after startAt", nil)
+		}
+	}
+	return shared.APIResponse{}
+}
+
+func createOnCallRotation(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	var request OnCallRotationRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Name is required", nil), nil
+	}
+	if len(request.Members) == 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one member is required", nil), nil
+	}
+	if request.ShiftHours <= 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Shift hours must be greater than 0", nil), nil
+	}
+	if errResponse := validateOverrides(request.Overrides); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	startAt := request.StartAt
+	if startAt == nil {
+		now := shared.GetCurrentTime()
+		startAt = &now
+	}
+
+	rotation := shared.OnCallRotation{
+		RotationID: uuid.New().String(),
+		Name:       request.Name,
+		Members:    request.Members,
+		StartAt:    startAt,
+		ShiftHours: request.ShiftHours,
+		Overrides:  request.Overrides,
+	}
+
+	err = db.CreateOnCallRotation(ctx, rotation)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to create on-call rotation")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create on-call rotation", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("rotationId", rotation.RotationID).Msg("On-call rotation created successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, OnCallRotationResponse{
+		OnCallRotation: rotation,
+		CurrentOnCall:  rotation.CurrentOnCall(shared.GetCurrentTime()),
+	}), nil
+}
+
+func updateOnCallRotation(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	rotationID := event.PathParameters[RotationIDPathParam]
+	if rotationID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Rotation ID is required", nil), nil
+	}
+
+	var request OnCallRotationRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" && request.Members == nil && request.StartAt == nil && request.ShiftHours == 0 && request.Overrides == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	if request.Members != nil && len(request.Members) == 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one member is required", nil), nil
+	}
+	if request.ShiftHours < 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Shift hours must be greater than 0", nil), nil
+	}
+	if errResponse := validateOverrides(request.Overrides); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	existing, err := db.GetOnCallRotation(ctx, rotationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing on-call rotation")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve on-call rotation", nil), nil
+	}
+	if existing.RotationID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "On-call rotation not found", nil), nil
+	}
+
+	updatedRotation, err := db.UpdateOnCallRotation(ctx, shared.OnCallRotation{
+		RotationID: rotationID,
+		Name:       request.Name,
+		Members:    request.Members,
+		StartAt:    request.StartAt,
+		ShiftHours: request.ShiftHours,
+		Overrides:  request.Overrides,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to update on-call rotation")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update on-call rotation", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("rotationId", rotationID).Msg("On-call rotation updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, OnCallRotationResponse{
+		OnCallRotation: updatedRotation,
+		CurrentOnCall:  updatedRotation.CurrentOnCall(shared.GetCurrentTime()),
+	}), nil
+}
+
+func getOnCallRotation(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	rotationID := event.PathParameters[RotationIDPathParam]
+
+	rotation, err := db.GetOnCallRotation(ctx, rotationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get on-call rotation")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve on-call rotation", nil), nil
+	}
+	if rotation.RotationID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "On-call rotation not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, OnCallRotationResponse{
+		OnCallRotation: rotation,
+		CurrentOnCall:  rotation.CurrentOnCall(shared.GetCurrentTime()),
+	}), nil
+}
+
+func listOnCallRotations(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	rotations, nextKey, err := db.GetOnCallRotationsList(ctx, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get on-call rotations list")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve on-call rotations", nil), nil
+	}
+
+	now := shared.GetCurrentTime()
+	items := make([]OnCallRotationResponse, 0, len(rotations))
+	for _, rotation := range rotations {
+		items = append(items, OnCallRotationResponse{
+			OnCallRotation: rotation,
+			CurrentOnCall:  rotation.CurrentOnCall(now),
+		})
+	}
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     items,
+		Count:     len(items),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func deleteOnCallRotation(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	rotationID := event.PathParameters[RotationIDPathParam]
+	if rotationID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Rotation ID is required", nil), nil
+	}
+
+	err := db.DeleteOnCallRotation(ctx, rotationID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete on-call rotation")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete on-call rotation", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("rotationId", rotationID).Msg("On-call rotation deleted successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "On-call rotation deleted successfully"}), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("oncall", handler))
+}
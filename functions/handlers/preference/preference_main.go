@@ -2,18 +2,26 @@ package main
 
 import (
 	"context"
+	"maps"
 	"net/http"
 	"notification-service/functions/db"
+	"notification-service/functions/services"
 	"notification-service/functions/shared"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
 )
 
 const (
 	LimitQueryParam     = "limit"
 	NextTokenQueryParam = "nextToken"
 	ContextQueryParam   = "context"
+	StrictQueryParam    = "strict"
+	OverrideIDPathParam = "overrideId"
 )
 
 func init() {
@@ -21,14 +29,22 @@ func init() {
 }
 
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
-	shared.LogInfo().Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Preference handler invoked")
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Preference handler invoked")
 
 	// Extract user info from context
 	userContext, err := shared.GetUserContext(event.RequestContext)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user ID from context")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
 		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
 	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	if strings.Contains(event.Resource, "/critical-contact") {
+		return handleCriticalContact(ctx, event, userContext)
+	}
+	if strings.Contains(event.Resource, "/overrides") {
+		return handlePreferenceOverrides(ctx, event, userContext)
+	}
 
 	switch event.HTTPMethod {
 	case http.MethodPost:
@@ -36,6 +52,9 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.A
 	case http.MethodPut:
 		return updateUserPreferences(ctx, event, userContext)
 	case http.MethodGet:
+		if strings.HasSuffix(event.Resource, "/effective") {
+			return getEffectivePreferences(ctx, event, userContext)
+		}
 		// Check if this is a request for a specific user's preferences (has context query parameter)
 		if event.QueryStringParameters[ContextQueryParam] != "" {
 			return getUserPreferences(ctx, event, userContext)
@@ -49,10 +68,155 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.A
 }
 
 type UserPreferencesRequest struct {
-	Context     string                           `json:"context"`
-	Preferences map[string]shared.PreferenceItem `json:"preferences,omitempty"`
-	Timezone    string                           `json:"timezone,omitempty"`
-	Language    string                           `json:"language,omitempty"`
+	Context       string                           `json:"context"`
+	Preferences   map[string]shared.PreferenceItem `json:"preferences,omitempty"`
+	Timezone      string                           `json:"timezone,omitempty"`
+	Language      string                           `json:"language,omitempty"`
+	DigestTime    string                           `json:"digestTime,omitempty"`
+	MissedSummary *bool                            `json:"missedSummary,omitempty"`
+	DailyCaps     map[string]int                   `json:"dailyCaps,omitempty"`
+	Consent       map[string]bool                  `json:"consent,omitempty"` // Category to granted, timestamps are recorded on change
+}
+
+// clearablePreferenceFields are the preference fields an update clears when they are sent as null
+var clearablePreferenceFields = []string{db.ColPreferences, db.ColTimezone, db.ColLanguage, db.ColDigestTime, db.ColMissedSummary, db.ColDailyCaps}
+
+// validateConsent checks consent changes. Consent is recorded for audits, so only the user can give or withdraw it
+func validateConsent(request UserPreferencesRequest, userContext shared.UserContext) shared.APIResponse {
+	if len(request.Consent) == 0 {
+		return shared.APIResponse{}
+	}
+	if request.Context != userContext.UserID {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Consent can only be changed by the user", nil)
+	}
+	if err := shared.ValidateConsentChanges(request.Consent); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid consent: "+err.Error(), nil)
+	}
+	return shared.APIResponse{}
+}
+
+// auditConsentChanges records every category whose consent changed
+func auditConsentChanges(ctx context.Context, userID string, previous, current map[string]shared.CategoryConsent) {
+	for category, consent := range current {
+		if before, ok := previous[category]; ok && before.Granted == consent.Granted {
+			continue
+		}
+		action := "consent_revoked"
+		if consent.Granted {
+			action = "consent_granted"
+		}
+		shared.LogAudit(ctx, action).Str("targetUserId", userID).Str("category", category).Msg("Notification consent changed")
+	}
+}
+
+// validateDigestSettings checks delivery modes, the digest time and daily caps. Digests are delivered per user,
+// so the global context cannot use them
+func validateDigestSettings(request UserPreferencesRequest) shared.APIResponse {
+	for notificationType, prefItem := range request.Preferences {
+		if !shared.ValidateDelivery(prefItem.Delivery) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid delivery for "+notificationType+": "+prefItem.Delivery, nil)
+		}
+		if prefItem.Delivery == shared.DeliveryDailyDigest && request.Context == "*" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Daily digest is only available for user preferences", nil)
+		}
+	}
+	if request.DigestTime != "" {
+		if _, err := time.Parse("15:04", request.DigestTime); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid digest time, expected HH:MM", nil)
+		}
+	}
+	if len(request.DailyCaps) > 0 {
+		if request.Context == "*" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Daily caps are only available for user preferences", nil)
+		}
+		if err := shared.ValidateDailyCaps(request.DailyCaps); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid daily caps: "+err.Error(), nil)
+		}
+	}
+	return shared.APIResponse{}
+}
+
+// UserPreferencesResponse includes the type#channel combinations that have no template to deliver with
+type UserPreferencesResponse struct {
+	shared.UserPreferences
+	MissingTemplates []string `json:"missingTemplates,omitempty"`
+}
+
+// findMissingTemplates returns the enabled type#channel combinations with neither a context nor a global template
+func findMissingTemplates(ctx context.Context, context string, preferences map[string]shared.PreferenceItem) ([]string, error) {
+	textFallback := shared.GetEnvBool("TEMPLATE_TEXT_FALLBACK", false)
+	hasTemplate := func(typeChannel string) (bool, error) {
+		contexts := []string{context}
+		if context != "*" {
+			contexts = append(contexts, "*")
+		}
+		for _, templateContext := range contexts {
+			template, err := db.GetTemplateByTypeChannel(ctx, templateContext, typeChannel)
+			if err != nil {
+				return false, err
+			}
+			if template.TypeChannel != "" {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
+	missing := make([]string, 0)
+	for notificationType, prefItem := range preferences {
+		if prefItem.Enabled == nil || !*prefItem.Enabled {
+			continue
+		}
+		for _, channel := range prefItem.Channels {
+			found, err := hasTemplate(shared.BuildTypeChannel(notificationType, channel))
+			if err != nil {
+				return nil, err
+			}
+			// The processor can derive Slack and in-app content from the email template
+			if !found && textFallback && channel != shared.ChannelEmail {
+				found, err = hasTemplate(shared.BuildTypeChannel(notificationType, shared.ChannelEmail))
+				if err != nil {
+					return nil, err
+				}
+			}
+			if !found {
+				missing = append(missing, shared.BuildTypeChannel(notificationType, channel))
+			}
+		}
+	}
+	slices.Sort(missing)
+	return missing, nil
+}
+
+// checkMissingTemplates looks up missing templates. With ?strict=true the request is rejected when any are missing,
+// otherwise they are returned as a warning
+func checkMissingTemplates(ctx context.Context, event events.APIGatewayProxyRequest, context string, preferences map[string]shared.PreferenceItem) ([]string, shared.APIResponse) {
+	missing, err := findMissingTemplates(ctx, context, preferences)
+	if err != nil {
+		// Template lookup is advisory, do not block the preference change on it
+		shared.LogError(ctx).Err(err).Str("context", context).Msg("Failed to check templates for preferences")
+		return nil, shared.APIResponse{}
+	}
+
+	if len(missing) > 0 && event.QueryStringParameters[StrictQueryParam] == "true" {
+		return nil, shared.CreateErrorResponse(http.StatusBadRequest, "No template exists for some enabled channels", map[string]any{
+			"missingTemplates": missing,
+		})
+	}
+	if len(missing) > 0 {
+		shared.LogWarn(ctx).Str("context", context).Strs("missingTemplates", missing).Msg("Preferences enable channels without templates")
+	}
+	return missing, shared.APIResponse{}
+}
+
+// syncDigestSchedule keeps the user's digest schedule in line with their preferences
+func syncDigestSchedule(ctx context.Context, previous, current shared.UserPreferences) {
+	if !previous.HasDigestDelivery() && !current.HasDigestDelivery() {
+		return
+	}
+	if err := shared.SyncDigestSchedule(ctx, current); err != nil {
+		shared.LogError(ctx).Err(err).Str("context", current.Context).Msg("Failed to sync digest schedule")
+	}
 }
 
 func createUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -85,11 +249,22 @@ func createUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 	} else {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Preferences are required", nil), nil
 	}
+	if errResponse := validateDigestSettings(request); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	if errResponse := validateConsent(request, userContext); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	missingTemplates, errResponse := checkMissingTemplates(ctx, event, request.Context, request.Preferences)
+	if errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
 
 	// Check if preferences already exist
 	existing, err := db.GetUserPreferences(ctx, request.Context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to check existing preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to check existing preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to check existing preferences", nil), nil
 	}
 	if existing.Context != "" {
@@ -98,21 +273,33 @@ func createUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 
 	// Create new user preferences
 	userPreferences := shared.UserPreferences{
-		Context:     request.Context,
-		Preferences: request.Preferences,
-		Timezone:    request.Timezone,
-		Language:    request.Language,
+		Context:       request.Context,
+		Preferences:   request.Preferences,
+		Timezone:      request.Timezone,
+		Language:      request.Language,
+		DigestTime:    request.DigestTime,
+		MissedSummary: request.MissedSummary,
+		DailyCaps:     request.DailyCaps,
+	}
+	if len(request.Consent) > 0 {
+		userPreferences.Consent = shared.ApplyConsentChanges(nil, request.Consent, shared.GetCurrentTime())
 	}
 
 	err = db.CreateUserPreferences(ctx, userPreferences)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to create user preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to create user preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create user preferences", nil), nil
 	}
 
-	shared.LogInfo().Str("context", userPreferences.Context).Msg("User preferences created successfully")
+	syncDigestSchedule(ctx, shared.UserPreferences{}, userPreferences)
+	auditConsentChanges(ctx, userPreferences.Context, nil, userPreferences.Consent)
+
+	shared.LogInfo(ctx).Str("context", userPreferences.Context).Msg("User preferences created successfully")
 
-	return shared.CreateAPIResponse(http.StatusCreated, userPreferences), nil
+	return shared.CreateAPIResponse(http.StatusCreated, UserPreferencesResponse{
+		UserPreferences:  userPreferences,
+		MissingTemplates: missingTemplates,
+	}), nil
 }
 
 func updateUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -131,15 +318,42 @@ func updateUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 	// Get existing preferences to verify they exist
 	existing, err := db.GetUserPreferences(ctx, request.Context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get existing preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
 	}
 	if existing.Context == "" {
 		return shared.CreateErrorResponse(http.StatusNotFound, "User preferences not found", nil), nil
 	}
 
+	// Fields sent as null are cleared
+	nulls := shared.NullFields(event.Body)
+	if nulls[db.ColConsent] {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Consent cannot be cleared, withdraw it for each category instead", nil), nil
+	}
+	var cleared []string
+	for _, field := range clearablePreferenceFields {
+		if nulls[field] {
+			cleared = append(cleared, field)
+		}
+	}
+
+	// Null entries remove the preference of their type, the other entries are then merged into the stored ones
+	// rather than replacing them
+	if removed := shared.NullFields(event.Body, "preferences"); len(removed) > 0 {
+		preferences := maps.Clone(existing.Preferences)
+		if preferences == nil {
+			preferences = make(map[string]shared.PreferenceItem)
+		}
+		for notificationType := range removed {
+			delete(preferences, notificationType)
+			delete(request.Preferences, notificationType)
+		}
+		maps.Copy(preferences, request.Preferences)
+		request.Preferences = preferences
+	}
+
 	// Validate at least one field is provided
-	if request.Preferences == nil && request.Timezone == "" && request.Language == "" {
+	if request.Preferences == nil && request.Timezone == "" && request.Language == "" && request.DigestTime == "" && request.MissedSummary == nil && request.DailyCaps == nil && request.Consent == nil && len(cleared) == 0 {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
 	}
 
@@ -159,20 +373,50 @@ func updateUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 		}
 	}
 
+	if errResponse := validateDigestSettings(request); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	if errResponse := validateConsent(request, userContext); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	var missingTemplates []string
+	if request.Preferences != nil {
+		missingTemplates, errResponse = checkMissingTemplates(ctx, event, request.Context, request.Preferences)
+		if errResponse.StatusCode != 0 {
+			return errResponse, nil
+		}
+	}
+
+	var consent map[string]shared.CategoryConsent
+	if len(request.Consent) > 0 {
+		consent = shared.ApplyConsentChanges(existing.Consent, request.Consent, shared.GetCurrentTime())
+	}
+
 	updatedPreferences, err := db.UpdateUserPreferences(ctx, shared.UserPreferences{
-		Context:     request.Context,
-		Preferences: request.Preferences,
-		Timezone:    request.Timezone,
-		Language:    request.Language,
-	})
+		Context:       request.Context,
+		Preferences:   request.Preferences,
+		Timezone:      request.Timezone,
+		Language:      request.Language,
+		DigestTime:    request.DigestTime,
+		MissedSummary: request.MissedSummary,
+		DailyCaps:     request.DailyCaps,
+		Consent:       consent,
+	}, cleared...)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to update user preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to update user preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update user preferences", nil), nil
 	}
 
-	shared.LogInfo().Str("context", request.Context).Msg("User preferences updated successfully")
+	syncDigestSchedule(ctx, existing, updatedPreferences)
+	auditConsentChanges(ctx, updatedPreferences.Context, existing.Consent, updatedPreferences.Consent)
 
-	return shared.CreateAPIResponse(http.StatusOK, updatedPreferences), nil
+	shared.LogInfo(ctx).Str("context", request.Context).Msg("User preferences updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, UserPreferencesResponse{
+		UserPreferences:  updatedPreferences,
+		MissingTemplates: missingTemplates,
+	}), nil
 }
 
 func getUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -183,7 +427,7 @@ func getUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest
 
 	preferences, err := db.GetUserPreferences(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user preferences", nil), nil
 	}
 
@@ -194,6 +438,61 @@ func getUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest
 	return shared.CreateAPIResponse(http.StatusOK, preferences), nil
 }
 
+// EffectivePreferencesResponse is the preference set the processor applies to a user, with its active overrides
+// applied and listed with their expiry, and today's daily cap usage
+type EffectivePreferencesResponse struct {
+	shared.UserPreferences
+	Source    string                 `json:"source"` // "user" | "global" | "merged", user preferences merged over the global ones
+	DailyCaps []shared.DailyCapState `json:"dailyCapState,omitempty"`
+}
+
+func getEffectivePreferences(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	context, errResponse := shared.ValidateContext(event.QueryStringParameters[ContextQueryParam], userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+	if context == "*" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Effective preferences are resolved for a user", nil), nil
+	}
+
+	response := EffectivePreferencesResponse{Source: "user"}
+	preferences, err := db.GetUserPreferences(ctx, context)
+	if err == nil && preferences.Context == "" {
+		response.Source = "global"
+		preferences, err = db.GetUserPreferences(ctx, "*")
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user preferences")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user preferences", nil), nil
+	}
+	if preferences.Context == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User preferences not found", nil), nil
+	}
+	if response.Source == "user" && db.GetFallbackSettings(ctx).MergesPreferences() {
+		globalPreferences, err := db.GetUserPreferences(ctx, "*")
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get global preferences")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user preferences", nil), nil
+		}
+		response.Source = "merged"
+		preferences = preferences.MergeOver(globalPreferences)
+	}
+	response.UserPreferences = preferences.WithOverrides(shared.GetCurrentTime())
+
+	day := shared.DailyCapDay(preferences.Timezone, shared.GetCurrentTime())
+	for _, channel := range slices.Sorted(maps.Keys(preferences.DailyCaps)) {
+		dailyCap := preferences.DailyCap(channel)
+		count, err := db.GetDailyCount(ctx, db.BuildDailyCapKey(context, channel, day))
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("channel", channel).Msg("Failed to get daily cap count")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve daily cap state", nil), nil
+		}
+		response.DailyCaps = append(response.DailyCaps, shared.NewDailyCapState(channel, dailyCap, count))
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
 func listUserPreferences(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
 	// Only super admins can list all preferences
 	if userContext.Role != shared.RoleSuperAdmin {
@@ -212,7 +511,7 @@ func listUserPreferences(ctx context.Context, event events.APIGatewayProxyReques
 	// Get preferences list
 	preferences, nextKey, err := db.GetUserPreferencesList(ctx, limit, startKey)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user preferences list")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user preferences list")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences list", nil), nil
 	}
 
@@ -235,7 +534,7 @@ func deleteUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 	// Check if preferences exist before deleting
 	existing, err := db.GetUserPreferences(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to check existing preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to check existing preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to check existing preferences", nil), nil
 	}
 	if existing.Context == "" {
@@ -244,15 +543,276 @@ func deleteUserPreferences(ctx context.Context, event events.APIGatewayProxyRequ
 
 	err = db.DeleteUserPreferences(ctx, context)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to delete user preferences")
+		shared.LogError(ctx).Err(err).Msg("Failed to delete user preferences")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete user preferences", nil), nil
 	}
 
-	shared.LogInfo().Str("context", context).Msg("User preferences deleted successfully")
+	syncDigestSchedule(ctx, existing, shared.UserPreferences{Context: context})
+
+	shared.LogInfo(ctx).Str("context", context).Msg("User preferences deleted successfully")
 
 	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "User preferences deleted successfully"}), nil
 }
 
+func handlePreferenceOverrides(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createPreferenceOverride(ctx, event, userContext)
+	case http.MethodDelete:
+		return deletePreferenceOverride(ctx, event, userContext)
+	}
+	return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+}
+
+type PreferenceOverrideRequest struct {
+	Context         string                `json:"context"`
+	Types           []string              `json:"types,omitempty"` // Every type of the preferences when empty
+	Preference      shared.PreferenceItem `json:"preference"`
+	Reason          string                `json:"reason,omitempty"`
+	ExpiresAt       *time.Time            `json:"expiresAt,omitempty"`
+	DurationMinutes int                   `json:"durationMinutes,omitempty"` // Alternative to expiresAt, from now
+}
+
+// createPreferenceOverride adds a temporary override to a preference set. The processor applies it until it
+// expires, and the janitor removes it once expired
+func createPreferenceOverride(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request PreferenceOverrideRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+
+	now := shared.GetCurrentTime()
+	if request.ExpiresAt != nil && request.DurationMinutes != 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Set either expiresAt or durationMinutes", nil), nil
+	}
+	if request.DurationMinutes != 0 {
+		expiresAt := now.Add(time.Duration(request.DurationMinutes) * time.Minute)
+		request.ExpiresAt = &expiresAt
+	}
+
+	override := shared.PreferenceOverride{
+		OverrideID: uuid.New().String(),
+		Types:      request.Types,
+		Preference: request.Preference,
+		Reason:     request.Reason,
+		ExpiresAt:  request.ExpiresAt,
+		CreatedBy:  userContext.UserID,
+		CreatedAt:  &now,
+	}
+	if err := override.Validate(now); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid override: "+err.Error(), nil), nil
+	}
+
+	existing, err := db.GetUserPreferences(ctx, context)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing preferences")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
+	}
+	if existing.Context == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User preferences not found", nil), nil
+	}
+
+	// Expired overrides are dropped on the way
+	overrides := append(existing.ActiveOverrides(now), override)
+	if len(overrides) > shared.MaxPreferenceOverrides {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Too many active overrides", nil), nil
+	}
+
+	updatedPreferences, err := db.SetPreferenceOverrides(ctx, context, overrides, existing.Overrides)
+	if services.IsConditionalCheckFailed(err) {
+		return shared.CreateErrorResponse(http.StatusConflict, "Preferences changed, try again", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to add preference override")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to add preference override", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("context", context).Str("overrideId", override.OverrideID).Time("expiresAt", *override.ExpiresAt).Msg("Preference override added")
+
+	return shared.CreateAPIResponse(http.StatusCreated, updatedPreferences), nil
+}
+
+// deletePreferenceOverride reverts an override before it expires
+func deletePreferenceOverride(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	context, errResponse := shared.ValidateContext(event.QueryStringParameters[ContextQueryParam], userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+	overrideID := event.PathParameters[OverrideIDPathParam]
+
+	existing, err := db.GetUserPreferences(ctx, context)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing preferences")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
+	}
+
+	overrides := slices.DeleteFunc(slices.Clone(existing.Overrides), func(override shared.PreferenceOverride) bool {
+		return override.OverrideID == overrideID
+	})
+	if existing.Context == "" || len(overrides) == len(existing.Overrides) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Preference override not found", nil), nil
+	}
+
+	updatedPreferences, err := db.SetPreferenceOverrides(ctx, context, overrides, existing.Overrides)
+	if services.IsConditionalCheckFailed(err) {
+		return shared.CreateErrorResponse(http.StatusConflict, "Preferences changed, try again", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete preference override")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete preference override", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("context", context).Str("overrideId", overrideID).Msg("Preference override deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, updatedPreferences), nil
+}
+
+func handleCriticalContact(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	switch event.HTTPMethod {
+	case http.MethodGet:
+		return getCriticalContact(ctx, userContext)
+	case http.MethodPut:
+		return setCriticalContact(ctx, event, userContext)
+	case http.MethodPost:
+		if strings.HasSuffix(event.Resource, "/verify") {
+			return verifyCriticalContact(ctx, event, userContext)
+		}
+	case http.MethodDelete:
+		return deleteCriticalContact(ctx, userContext)
+	}
+	return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+}
+
+type CriticalContactRequest struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type VerifyCriticalContactRequest struct {
+	Code string `json:"code"`
+}
+
+func getCriticalContact(ctx context.Context, userContext shared.UserContext) (shared.APIResponse, error) {
+	user, err := db.GetUserByID(ctx, userContext.UserID)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve critical contact", nil), nil
+	}
+	if user == nil || user.CriticalContact == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Critical contact not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, user.CriticalContact), nil
+}
+
+// setCriticalContact stores a new unverified contact and sends it a verification code. Critical alerts
+// only go to the contact once the code has been confirmed
+func setCriticalContact(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request CriticalContactRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	contact := shared.CriticalContact{Type: request.Type, Value: strings.TrimSpace(request.Value)}
+	if err := contact.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid critical contact", err.Error()), nil
+	}
+
+	code, err := shared.NewVerificationCode()
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to generate verification code")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to set critical contact", nil), nil
+	}
+	expiresAt := shared.GetCurrentTime().Add(shared.CriticalContactCodeTTL)
+	contact.CodeHash = shared.HashVerificationCode(userContext.UserID, code)
+	contact.CodeExpiresAt = &expiresAt
+
+	globalConfig, err := db.GetSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to set critical contact", nil), nil
+	}
+	fromAddress := globalConfig.Config.EmailSettings.FromAddress
+	provider, err := services.NewEmailProvider(globalConfig.Config.EmailSettings)
+	if contact.Type == shared.CriticalContactEmail && (fromAddress == "" || err != nil) {
+		return shared.CreateErrorResponse(http.StatusUnprocessableEntity, "Email is not configured, a verification code cannot be sent", nil), nil
+	}
+
+	if _, err := db.SetCriticalContact(ctx, userContext.UserID, &contact); err != nil {
+		if services.IsConditionalCheckFailed(err) {
+			return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+		}
+		shared.LogError(ctx).Err(err).Msg("Failed to store critical contact")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to set critical contact", nil), nil
+	}
+
+	message := "Your critical alert verification code is " + code + ". It expires in 15 minutes."
+	if _, err := services.SendToCriticalContact(ctx, contact, provider, fromAddress, globalConfig.Config.SmsSettings.SenderID, "Verify your critical alert contact", "<p>"+message+"</p>", message); err != nil {
+		shared.LogError(ctx).Err(err).Str("contactType", contact.Type).Msg("Failed to send verification code")
+		return shared.CreateErrorResponse(http.StatusBadGateway, "Failed to send verification code", nil), nil
+	}
+
+	shared.LogAudit(ctx, "critical_contact_set").Str("contactType", contact.Type).Msg("Critical contact set, verification pending")
+
+	return shared.CreateAPIResponse(http.StatusAccepted, contact), nil
+}
+
+func verifyCriticalContact(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request VerifyCriticalContactRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil || request.Code == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	user, err := db.GetUserByID(ctx, userContext.UserID)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to verify critical contact", nil), nil
+	}
+	if user == nil || user.CriticalContact == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Critical contact not found", nil), nil
+	}
+
+	contact := *user.CriticalContact
+	if contact.Verified {
+		return shared.CreateAPIResponse(http.StatusOK, contact), nil
+	}
+	now := shared.GetCurrentTime()
+	if !contact.CheckCode(userContext.UserID, strings.TrimSpace(request.Code), now) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid or expired verification code", nil), nil
+	}
+
+	contact.Verified = true
+	contact.VerifiedAt = &now
+	contact.CodeHash = ""
+	contact.CodeExpiresAt = nil
+	if _, err := db.SetCriticalContact(ctx, userContext.UserID, &contact); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to store critical contact")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to verify critical contact", nil), nil
+	}
+
+	shared.LogAudit(ctx, "critical_contact_verified").Str("contactType", contact.Type).Msg("Critical contact verified")
+
+	return shared.CreateAPIResponse(http.StatusOK, contact), nil
+}
+
+func deleteCriticalContact(ctx context.Context, userContext shared.UserContext) (shared.APIResponse, error) {
+	if _, err := db.SetCriticalContact(ctx, userContext.UserID, nil); err != nil {
+		if services.IsConditionalCheckFailed(err) {
+			return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+		}
+		shared.LogError(ctx).Err(err).Msg("Failed to delete critical contact")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete critical contact", nil), nil
+	}
+
+	shared.LogAudit(ctx, "critical_contact_deleted").Msg("Critical contact deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Critical contact deleted successfully"}), nil
+}
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapAPIHandler("preference", handler))
 }
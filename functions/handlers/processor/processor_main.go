@@ -2,65 +2,240 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"notification-service/functions/db"
+	"notification-service/functions/engine"
+	"notification-service/functions/services"
 	"notification-service/functions/shared"
-	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
 )
 
+// notificationEngine resolves, renders and delivers the notifications of every recipient, sharing its caches
+var notificationEngine = engine.New()
+
 func init() {
 	shared.InitAWS()
+	shared.WarmHTTPConnections(context.Background())
 }
 
 func handler(ctx context.Context, sqsEvent events.SQSEvent) (events.SQSEventResponse, error) {
-	shared.LogInfo().Int("recordCount", len(sqsEvent.Records)).Msg("Notification processor started")
+	shared.LogInfo(ctx).Int("recordCount", len(sqsEvent.Records)).Msg("Notification processor started")
 
 	var failedRecords []events.SQSBatchItemFailure
 
 	for _, record := range sqsEvent.Records {
-		err := processMessage(ctx, record)
+		// A panic fails only its own message instead of the whole batch
+		err := shared.CatchPanic(ctx, func() error {
+			return processMessage(ctx, record)
+		})
 		if err != nil {
-			shared.LogError().Err(err).Str("messageId", record.MessageId).Msg("Failed to process message")
+			shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to process message")
+			if quarantineMessage(ctx, record, err) {
+				continue
+			}
 			// Continue processing other messages even if one fails
 			failedRecords = append(failedRecords, events.SQSBatchItemFailure{
 				ItemIdentifier: record.MessageId,
 			})
 			continue
 		}
-
 	}
 
-	shared.LogInfo().Msg("Notification processor completed")
+	shared.LogInfo(ctx).Msg("Notification processor completed")
 	return events.SQSEventResponse{
 		BatchItemFailures: failedRecords,
 	}, nil
 }
 
-func processMessage(ctx context.Context, record events.SQSMessage) error {
-	shared.LogInfo().Str("messageId", record.MessageId).Msg("Processing notification message")
+// quarantineMessage moves a message that failed on its last allowed receive to the quarantine table,
+// so it can be inspected and reprocessed by an admin. It reports whether the message was quarantined
+// and can be acknowledged. The threshold should match the queue's dead-letter maxReceiveCount
+func quarantineMessage(ctx context.Context, record events.SQSMessage, processErr error) bool {
+	if !shared.GetEnvBool("QUARANTINE_ENABLED", true) {
+		return false
+	}
+	receiveCount, err := strconv.Atoi(record.Attributes["ApproximateReceiveCount"])
+	if err != nil || receiveCount < shared.GetEnvInt("QUARANTINE_RECEIVE_COUNT", 3) {
+		return false
+	}
 
-	// Parse notification request from SQS message body
-	var notificationRequest shared.NotificationRequest
-	err := json.Unmarshal([]byte(record.Body), &notificationRequest)
+	err = db.CreateQuarantinedMessage(ctx, shared.QuarantinedMessage{
+		MessageID:    record.MessageId,
+		Body:         record.Body,
+		ReceiveCount: receiveCount,
+		Error:        processErr.Error(),
+	})
 	if err != nil {
-		shared.LogError().Err(err).Str("messageId", record.MessageId).Msg("Failed to parse notification request")
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to quarantine message")
+		return false
+	}
+
+	shared.LogWarn(ctx).Str("messageId", record.MessageId).Int("receiveCount", receiveCount).Msg("Message quarantined")
+
+	// A quarantined chunk will not be processed, its recipients count as failed so the job can complete
+	if request, err := decodeMessage(ctx, record); err == nil {
+		recordJobChunk(ctx, request, len(request.Recipients), 0, len(request.Recipients))
+	}
+	return true
+}
+
+func processMessage(ctx context.Context, record events.SQSMessage) (processErr error) {
+	shared.LogInfo(ctx).Str("messageId", record.MessageId).Msg("Processing notification message")
+
+	notificationRequest, err := decodeMessage(ctx, record)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to parse notification request")
 		return err
 	}
+	ctx = shared.WithLogProducer(ctx, notificationRequest.Producer)
+
+	// Invalid requests are rejected before any work with every problem found, instead of failing deep
+	// inside rendering. A retry cannot make them valid, so they are recorded and acknowledged
+	validationErrors, err := validateRequest(ctx, notificationRequest)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to validate notification request")
+		return err
+	}
+	if len(validationErrors) > 0 {
+		recordFailedNotification(ctx, record, notificationRequest, validationErrors)
+		recordJobChunk(ctx, notificationRequest, len(notificationRequest.Recipients), 0, len(notificationRequest.Recipients))
+		return nil
+	}
+
+	// A producer's dedup key is delivered at most once within its window, repeats are recorded as suppressed
+	if notificationRequest.DedupKey != "" {
+		holder, err := db.ClaimRequestDedupKey(ctx, notificationRequest.DedupKey, notificationRequest.ID, notificationRequest.DedupWindow())
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to claim dedup key")
+			return err
+		}
+		if holder != notificationRequest.ID {
+			recordDuplicateRequest(ctx, record, notificationRequest, holder)
+			return nil
+		}
+		// A request that fails gives up its claim, so it is not suppressed when it is sent again
+		defer func() {
+			if processErr == nil {
+				return
+			}
+			if err := db.ReleaseRequestDedupKey(ctx, notificationRequest.DedupKey, notificationRequest.ID); err != nil {
+				shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to release dedup key")
+			}
+		}()
+	}
+
+	// Segment requests are split into child requests, which are processed as they arrive. A schedule's
+	// occurrence is counted once split, its chunks are not occurrences
+	if notificationRequest.Segment != "" {
+		if err := expandSegment(ctx, notificationRequest); err != nil {
+			return err
+		}
+		if isScheduleOccurrence(notificationRequest) {
+			recordScheduleOccurrence(ctx, notificationRequest)
+		}
+		return nil
+	}
+
+	// Broadcasts to more recipients than the batch size are split the same way
+	if isBroadcast(ctx, notificationRequest) {
+		chunks, err := queueChunks(ctx, notificationRequest, notificationRequest.Recipients)
+		if err != nil {
+			return err
+		}
+		shared.LogInfo(ctx).Str("notificationRequestId", notificationRequest.ID).Int("recipients", len(notificationRequest.Recipients)).Int("childRequests", chunks).Msg("Broadcast split")
+		if isScheduleOccurrence(notificationRequest) {
+			recordScheduleOccurrence(ctx, notificationRequest)
+		}
+		return nil
+	}
+
+	// Sequence requests enroll their recipients, the steps arrive as their own requests
+	if notificationRequest.Sequence != "" {
+		return startSequence(ctx, notificationRequest)
+	}
+
+	// Steps of a cancelled, skipped or restarted enrollment are dropped
+	var sequence shared.Sequence
+	var enrollment shared.SequenceEnrollment
+	if notificationRequest.SequenceStep != nil {
+		var pending bool
+		sequence, enrollment, pending, err = loadSequenceStep(ctx, notificationRequest)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to load sequence enrollment")
+			return err
+		}
+		if !pending {
+			shared.LogInfo(ctx).Str("messageId", record.MessageId).Str("notificationRequestId", notificationRequest.ID).Msg("Sequence step no longer pending, skipping")
+			return nil
+		}
+	}
+
+	// Digest schedules carry no content, collect the notifications held for the user.
+	// Deferred digests already carry their content
+	var digestItems []shared.DigestItem
+	if notificationRequest.Digest && notificationRequest.Variables == nil {
+		digestItems, err = loadDigest(ctx, &notificationRequest)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to load digest items")
+			return err
+		}
+		if len(digestItems) == 0 {
+			shared.LogInfo(ctx).Str("messageId", record.MessageId).Msg("No notifications held for digest, skipping")
+			return nil
+		}
+	}
+
+	// Resolve on-call and team references so history records the users that were actually notified
+	var teams map[string]shared.Team
+	notificationRequest.Recipients, teams = expandRecipients(ctx, notificationRequest)
 
 	// Process the notification request
-	result, err := ProcessNotificationRequest(ctx, notificationRequest)
+	result, err := ProcessNotificationRequest(ctx, notificationRequest, teams)
 	if err != nil {
-		shared.LogError().Err(err).Str("messageId", record.MessageId).Msg("Failed to process notification request")
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to process notification request")
 		return err
 	}
 
+	// Held notifications are delivered, remove them from the digest
+	for _, item := range digestItems {
+		if err := db.DeleteDigestItem(ctx, item.UserID, item.ItemKey); err != nil {
+			shared.LogError(ctx).Err(err).Str("userId", item.UserID).Msg("Failed to delete digest item")
+		}
+	}
+
+	// Record the processing outcome for acknowledgments, replay and analytics
+	if err := db.CreateNotificationHistory(ctx, buildNotificationHistory(notificationRequest, result, messageSentAt(record))); err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to create notification history")
+	}
+	recordJobChunk(ctx, notificationRequest, result.TotalRecipients, result.SuccessCount, result.FailureCount)
+
+	// Occurrences of a user's schedule are counted once processed, so a retried message is not counted twice
+	if isScheduleOccurrence(notificationRequest) {
+		recordScheduleOccurrence(ctx, notificationRequest)
+	}
+
+	// The step is sent, move the enrollment on. A failure retries the message, whose step is still pending
+	if notificationRequest.SequenceStep != nil {
+		if _, err := db.AdvanceSequenceEnrollment(ctx, sequence, enrollment, shared.SequenceStepSent, notificationRequest.ID); err != nil && !errors.Is(err, db.ErrEnrollmentChanged) {
+			shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to advance sequence enrollment")
+			return err
+		}
+	}
+
 	// Log processing results
-	shared.LogInfo().
+	shared.LogInfo(ctx).
 		Str("messageId", record.MessageId).
 		Str("requestType", notificationRequest.Type).
 		Int("totalRecipients", result.TotalRecipients).
@@ -72,6 +247,535 @@ func processMessage(ctx context.Context, record events.SQSMessage) error {
 	return nil
 }
 
+// isScheduleOccurrence reports whether the request is a schedule firing, whoever it notifies. Deferred copies
+// of an occurrence, the chunks it is split into and dry runs are not counted
+func isScheduleOccurrence(request shared.NotificationRequest) bool {
+	return request.Producer != nil && request.Producer.Kind == shared.ProducerSchedule && request.Producer.ID == request.ID &&
+		!request.Deferred && !request.DryRun
+}
+
+// recordScheduleOccurrence counts an occurrence of the request's schedule. Once the schedule fired its
+// maxOccurrences it is cancelled, its EventBridge schedule deleted and its slot given back to the owner
+func recordScheduleOccurrence(ctx context.Context, request shared.NotificationRequest) {
+	schedule, err := db.RecordScheduleOccurrence(ctx, request.ID)
+	if services.IsConditionalCheckFailed(err) {
+		// The schedule was deleted after it fired
+		return
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", request.ID).Msg("Failed to record schedule occurrence")
+		return
+	}
+	if schedule.Status == shared.StatusCancelled || schedule.Schedule == nil || !schedule.Schedule.IsExhausted(schedule.Occurrences) {
+		return
+	}
+
+	if err := shared.DeleteEventBridgeSchedule(ctx, schedule.UserID, schedule.ScheduleID); err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", schedule.ScheduleID).Msg("Failed to delete EventBridge schedule of exhausted schedule")
+	}
+	if _, err := db.UpdateScheduledNotification(ctx, shared.ScheduledNotification{
+		ScheduleID: schedule.ScheduleID,
+		Status:     shared.StatusCancelled,
+		DryRun:     schedule.DryRun,
+	}); services.IsConditionalCheckFailed(err) {
+		// The owner cancelled it meanwhile and gave back its slot
+		return
+	} else if err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", schedule.ScheduleID).Msg("Failed to cancel exhausted schedule")
+		return
+	}
+	if err := db.ReleaseScheduleSlot(ctx, schedule.UserID); err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", schedule.ScheduleID).Msg("Failed to release schedule slot")
+	}
+	shared.LogInfo(ctx).Str("scheduleID", schedule.ScheduleID).Int("occurrences", schedule.Occurrences).Msg("Schedule reached its maximum occurrences, cancelled")
+}
+
+// recordDuplicateRequest records a request suppressed because another request holds its dedup key, with
+// one suppressed delivery per recipient so producers find its status like any other request's
+func recordDuplicateRequest(ctx context.Context, record events.SQSMessage, request shared.NotificationRequest, duplicateOf string) {
+	shared.LogInfo(ctx).Str("notificationRequestId", request.ID).Str("dedupKey", request.DedupKey).Str("duplicateOf", duplicateOf).Msg("Duplicate request suppressed")
+
+	result := &ProcessingResult{
+		RequestID:       request.ID,
+		TotalRecipients: len(request.Recipients),
+		SuccessCount:    len(request.Recipients),
+		Notifications:   make([]ProcessedNotification, 0, len(request.Recipients)),
+	}
+	for _, recipientID := range request.Recipients {
+		result.Notifications = append(result.Notifications, ProcessedNotification{
+			RecipientID: recipientID,
+			Type:        request.Type,
+			Suppressed:  true,
+			Success:     true,
+		})
+	}
+
+	history := buildNotificationHistory(request, result, messageSentAt(record))
+	history.DuplicateOf = duplicateOf
+	if err := db.CreateNotificationHistory(ctx, history); err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to create notification history")
+	}
+}
+
+// startSequence enrolls every recipient of the request in its sequence. Recipients still enrolled from an
+// earlier start are left on their current step
+func startSequence(ctx context.Context, request shared.NotificationRequest) error {
+	sequence, err := db.GetSequence(ctx, request.Sequence)
+	if err != nil {
+		return fmt.Errorf("failed to get sequence: %w", err)
+	}
+	if sequence.SequenceID == "" {
+		// Retrying cannot make the sequence appear, drop the message
+		shared.LogError(ctx).Str("sequenceId", request.Sequence).Str("notificationRequestId", request.ID).Msg("Sequence not found")
+		return nil
+	}
+
+	recipients, _ := expandRecipients(ctx, request)
+	for _, recipientID := range recipients {
+		_, err := db.StartSequenceEnrollment(ctx, sequence, recipientID, request.Variables)
+		if errors.Is(err, db.ErrEnrollmentActive) {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Str("sequenceId", sequence.SequenceID).Msg("Recipient already enrolled in sequence")
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to enroll %s in sequence: %w", recipientID, err)
+		}
+	}
+
+	shared.LogInfo(ctx).Str("notificationRequestId", request.ID).Str("sequenceId", sequence.SequenceID).Int("recipients", len(recipients)).Msg("Sequence started")
+	return nil
+}
+
+// loadSequenceStep returns the sequence and enrollment of a step request, and whether the enrollment is
+// still waiting for that step
+func loadSequenceStep(ctx context.Context, request shared.NotificationRequest) (shared.Sequence, shared.SequenceEnrollment, bool, error) {
+	ref := *request.SequenceStep
+	if len(request.Recipients) != 1 {
+		return shared.Sequence{}, shared.SequenceEnrollment{}, false, fmt.Errorf("sequence step request must have exactly one recipient, got %d", len(request.Recipients))
+	}
+
+	enrollment, err := db.GetSequenceEnrollment(ctx, request.Recipients[0], ref.SequenceID)
+	if err != nil {
+		return shared.Sequence{}, shared.SequenceEnrollment{}, false, err
+	}
+	if !enrollment.IsPendingStep(ref) {
+		return shared.Sequence{}, shared.SequenceEnrollment{}, false, nil
+	}
+
+	sequence, err := db.GetSequence(ctx, ref.SequenceID)
+	if err != nil {
+		return shared.Sequence{}, shared.SequenceEnrollment{}, false, err
+	}
+	// A deleted sequence, or one shortened past the step, has nothing left to send, end the enrollment
+	if sequence.SequenceID == "" || ref.Step >= len(sequence.Steps) {
+		if _, err := db.CancelSequenceEnrollment(ctx, enrollment); err != nil && !errors.Is(err, db.ErrEnrollmentChanged) {
+			return shared.Sequence{}, shared.SequenceEnrollment{}, false, err
+		}
+		return shared.Sequence{}, shared.SequenceEnrollment{}, false, nil
+	}
+	return sequence, enrollment, true, nil
+}
+
+// variableSchemaCache holds the variable schema of each notification type
+var variableSchemaCache = shared.NewTTLCache[shared.VariableSchema](shared.GetEnvDuration("VARIABLE_SCHEMA_CACHE_TTL", time.Minute))
+
+// validateRequest checks the request strictly against the variable schema of its type. The schema is only
+// read when the type is known
+func validateRequest(ctx context.Context, request shared.NotificationRequest) (shared.ValidationErrors, error) {
+	var schema shared.VariableSchema
+	if shared.ValidateNotificationType(request.Type) {
+		var err error
+		schema, err = getCachedVariableSchema(ctx, request.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get variable schema: %w", err)
+		}
+	}
+	return request.ValidateStrict(schema), nil
+}
+
+// getCachedVariableSchema gets the variable schema of a notification type through the schema cache
+func getCachedVariableSchema(ctx context.Context, notificationType string) (shared.VariableSchema, error) {
+	if schema, ok := variableSchemaCache.Get(notificationType); ok {
+		return schema, nil
+	}
+	schema, err := db.GetVariableSchema(ctx, notificationType)
+	if err != nil {
+		return shared.VariableSchema{}, err
+	}
+	variableSchemaCache.Set(notificationType, schema)
+	return schema, nil
+}
+
+// notificationTypeCache holds the registered notification types, an empty type when one is not registered
+var notificationTypeCache = shared.NewTTLCache[shared.NotificationType](shared.GetEnvDuration("NOTIFICATION_TYPES_CACHE_TTL", time.Minute))
+
+// getCachedNotificationType gets a registered notification type through the notification type cache
+func getCachedNotificationType(ctx context.Context, notificationType string) (shared.NotificationType, error) {
+	if cached, ok := notificationTypeCache.Get(notificationType); ok {
+		return cached, nil
+	}
+	registered, err := db.GetNotificationType(ctx, notificationType)
+	if err != nil {
+		return shared.NotificationType{}, err
+	}
+	notificationTypeCache.Set(notificationType, registered)
+	return registered, nil
+}
+
+// throttleExemptionCache holds throttle exemptions by ID, an empty exemption when there is none with the ID
+var throttleExemptionCache = shared.NewTTLCache[shared.ThrottleExemption](shared.GetEnvDuration("THROTTLE_EXEMPTIONS_CACHE_TTL", time.Minute))
+
+// getThrottleExemption returns the exemption of the recipient, or else of the request's producer, through the
+// exemption cache. It returns nil when neither is exempt; an exemption that cannot be read is not applied
+func getThrottleExemption(ctx context.Context, recipientID string, producer *shared.Producer) *shared.ThrottleExemption {
+	if shared.ThrottleExemptionsTable == "" {
+		return nil
+	}
+	ids := []string{shared.UserExemptionID(recipientID)}
+	if producer != nil && producer.ID != "" {
+		ids = append(ids, shared.ProducerExemptionID(producer.Kind, producer.ID))
+	}
+	for _, id := range ids {
+		exemption, ok := throttleExemptionCache.Get(id)
+		if !ok {
+			loaded, err := db.GetThrottleExemption(ctx, id)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Str("exemptionId", id).Msg("Failed to get throttle exemption")
+				continue
+			}
+			exemption = loaded
+			throttleExemptionCache.Set(id, exemption)
+		}
+		if exemption.ExemptionID != "" {
+			return &exemption
+		}
+	}
+	return nil
+}
+
+// auditThrottleExemption records that an exemption let a notification past a throttle
+func auditThrottleExemption(ctx context.Context, exemption *shared.ThrottleExemption, recipientID, channel, throttle string, request shared.NotificationRequest) {
+	shared.LogAudit(ctx, "throttle_exemption.apply").
+		Str("exemptionId", exemption.ExemptionID).
+		Str("subject", exemption.Subject()).
+		Str("throttle", throttle).
+		Str("recipientId", recipientID).
+		Str("channel", channel).
+		Str("notificationRequestId", request.ID).
+		Msg("Throttle exemption applied")
+}
+
+// recordFailedNotification stores a rejected message with its validation errors in the failed notifications table
+func recordFailedNotification(ctx context.Context, record events.SQSMessage, request shared.NotificationRequest, validationErrors shared.ValidationErrors) {
+	shared.LogWarn(ctx).
+		Str("messageId", record.MessageId).
+		Str("notificationRequestId", request.ID).
+		Str("type", request.Type).
+		Interface("validationErrors", validationErrors).
+		Msg("Notification request failed validation")
+
+	err := db.CreateFailedNotification(ctx, shared.FailedNotification{
+		MessageID: record.MessageId,
+		RequestID: request.ID,
+		Type:      request.Type,
+		Body:      record.Body,
+		Errors:    validationErrors,
+		Producer:  request.Producer,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("messageId", record.MessageId).Msg("Failed to record failed notification")
+	}
+}
+
+// messageSentAt returns when the message was sent to the queue, from its SentTimestamp attribute
+func messageSentAt(record events.SQSMessage) *time.Time {
+	millis, err := strconv.ParseInt(record.Attributes["SentTimestamp"], 10, 64)
+	if err != nil {
+		return nil
+	}
+	sentAt := time.UnixMilli(millis).UTC()
+	return &sentAt
+}
+
+// loadDigest fills the digest request with a summary of the notifications held for its recipient and returns
+// the held items it summarizes
+func loadDigest(ctx context.Context, request *shared.NotificationRequest) ([]shared.DigestItem, error) {
+	if len(request.Recipients) != 1 {
+		return nil, fmt.Errorf("digest request must have exactly one recipient, got %d", len(request.Recipients))
+	}
+	held, err := db.GetDigestItems(ctx, request.Recipients[0])
+	if err != nil {
+		return nil, err
+	}
+	return engine.BuildDigest(request, held)
+}
+
+// buildNotificationHistory converts a processing result into a history record
+func buildNotificationHistory(request shared.NotificationRequest, result *ProcessingResult, enqueuedAt *time.Time) shared.NotificationHistory {
+	deliveries := make([]shared.DeliveryResult, 0, len(result.Notifications))
+	for _, notification := range result.Notifications {
+		deliveries = append(deliveries, shared.DeliveryResult{
+			RecipientID:       notification.RecipientID,
+			Channel:           notification.Channel,
+			Success:           notification.Success,
+			Suppressed:        notification.Suppressed,
+			Deferred:          notification.Deferred,
+			Digested:          notification.Digested,
+			DryRun:            notification.DryRun,
+			Error:             notification.Error,
+			DeliveredAt:       notification.DeliveredAt,
+			ProviderMessageID: notification.ProviderMessageID,
+			EmailMessageID:    notification.EmailMessageID,
+			ThreadMessageID:   notification.ThreadMessageID,
+			ResponseStatus:    notification.ResponseStatus,
+		})
+	}
+
+	return shared.NotificationHistory{
+		ID:              request.ID,
+		Type:            request.Type,
+		Request:         &request,
+		TotalRecipients: result.TotalRecipients,
+		SuccessCount:    result.SuccessCount,
+		FailureCount:    result.FailureCount,
+		Deliveries:      deliveries,
+		Producer:        request.Producer,
+		EnqueuedAt:      enqueuedAt,
+		Tags:            request.Tags,
+	}
+}
+
+// expandRecipients resolves "oncall:<rotationId>" and "team:<teamId>" recipients into delivery targets.
+// The returned map links each target that came from a team to that team, so the team's shared
+// preferences and Slack channel can be applied
+func expandRecipients(ctx context.Context, request shared.NotificationRequest) ([]string, map[string]shared.Team) {
+	recipients := make([]string, 0, len(request.Recipients))
+	teams := make(map[string]shared.Team)
+	seen := make(map[string]bool)
+	add := func(recipientID string, team *shared.Team) {
+		if recipientID == "" || seen[recipientID] {
+			return
+		}
+		seen[recipientID] = true
+		recipients = append(recipients, recipientID)
+		if team != nil {
+			teams[recipientID] = *team
+		}
+	}
+
+	for _, recipientID := range request.Recipients {
+		if rotationID, ok := strings.CutPrefix(recipientID, shared.RecipientPrefixOnCall); ok {
+			for _, member := range resolveRotation(ctx, rotationID, request.Type) {
+				add(member, nil)
+			}
+			continue
+		}
+
+		teamID, ok := strings.CutPrefix(recipientID, shared.RecipientPrefixTeam)
+		if !ok {
+			add(recipientID, nil)
+			continue
+		}
+
+		team, err := db.GetTeam(ctx, teamID)
+		if err != nil || team.TeamID == "" {
+			shared.LogError(ctx).Err(err).Str("teamId", teamID).Msg("Failed to resolve team")
+			continue
+		}
+
+		switch team.Policy {
+		case shared.TeamPolicyChannel:
+			// The team itself is the recipient and only its shared Slack channel is notified
+			add(recipientID, &team)
+		case shared.TeamPolicyOnCall:
+			onCall := ""
+			if rotation, err := db.GetOnCallRotation(ctx, team.RotationID); err == nil {
+				onCall = rotation.CurrentOnCall(shared.GetCurrentTime())
+			}
+			if onCall == "" {
+				shared.LogWarn(ctx).Str("teamId", teamID).Str("rotationId", team.RotationID).Msg("No one is on call for team")
+				continue
+			}
+			add(onCall, &team)
+		default:
+			for _, member := range team.Members {
+				add(member, &team)
+			}
+		}
+	}
+
+	return recipients, teams
+}
+
+// isBroadcast reports whether a request lists more recipients than the processor batch size, it is then
+// split into chunks like a segment. Digests, sequences and chunks are sent as they are
+func isBroadcast(ctx context.Context, request shared.NotificationRequest) bool {
+	if request.Job != nil || request.Digest || request.Sequence != "" || request.SequenceStep != nil {
+		return false
+	}
+	return len(request.Recipients) > db.GetProcessorSettings(ctx).SegmentBatchSize()
+}
+
+// queueChunks queues the recipients as child requests of the processor batch size each, under a job that
+// rolls up their progress. It returns the number of child requests
+func queueChunks(ctx context.Context, request shared.NotificationRequest, recipients []string) (int, error) {
+	chunkSize := db.GetProcessorSettings(ctx).SegmentBatchSize()
+	var bodies []string
+	for chunk := range slices.Chunk(recipients, chunkSize) {
+		child := request
+		child.ID = fmt.Sprintf("%s-%d", request.ID, len(bodies)+1)
+		child.Segment = ""
+		// The request's dedup key is held by the request itself, its chunks are not duplicates of it
+		child.DedupKey, child.DedupWindowSeconds = "", 0
+		child.Recipients = chunk
+		child.Job = &shared.JobChunkRef{JobID: request.ID, Chunk: len(bodies) + 1}
+
+		body, err := json.Marshal(child)
+		if err != nil {
+			return 0, fmt.Errorf("failed to marshal child request: %w", err)
+		}
+		bodies = append(bodies, string(body))
+	}
+
+	started, err := db.StartJob(ctx, shared.Job{
+		JobID:       request.ID,
+		Type:        request.Type,
+		Segment:     request.Segment,
+		TotalChunks: len(bodies),
+		Queued:      len(recipients),
+		Producer:    request.Producer,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to start job: %w", err)
+	}
+	if !started {
+		shared.LogWarn(ctx).Str("jobId", request.ID).Msg("Job already running, queueing its chunks again")
+	}
+
+	if err := services.SqsSendMessages(ctx, shared.NotificationQueueURL, bodies); err != nil {
+		return 0, fmt.Errorf("failed to queue child requests: %w", err)
+	}
+	return len(bodies), nil
+}
+
+// recordJobChunk adds a processed chunk's outcome to its job. Failing to record it is logged and does not
+// retry the chunk, which would deliver it again
+func recordJobChunk(ctx context.Context, request shared.NotificationRequest, processed, succeeded, failed int) {
+	if request.Job == nil {
+		return
+	}
+	if err := db.RecordJobChunk(ctx, *request.Job, processed, succeeded, failed); err != nil {
+		shared.LogError(ctx).Err(err).Str("jobId", request.Job.JobID).Int("chunk", request.Job.Chunk).Msg("Failed to record job progress")
+	}
+}
+
+// expandSegment resolves the segment's users and queues them in chunks of the processor batch size as child requests.
+// Recipients listed on the request are included alongside the segment's users
+func expandSegment(ctx context.Context, request shared.NotificationRequest) error {
+	segment, err := db.GetSegment(ctx, request.Segment)
+	if err != nil {
+		return fmt.Errorf("failed to get segment: %w", err)
+	}
+	if segment.SegmentID == "" {
+		// Retrying cannot help, drop the request
+		shared.LogError(ctx).Str("segmentId", request.Segment).Str("notificationRequestId", request.ID).Msg("Segment not found")
+		return nil
+	}
+
+	members, err := resolveSegment(ctx, segment.Criteria)
+	if err != nil {
+		return fmt.Errorf("failed to resolve segment: %w", err)
+	}
+
+	recipients := make([]string, 0, len(request.Recipients)+len(members))
+	seen := make(map[string]bool)
+	for _, recipientID := range append(slices.Clone(request.Recipients), members...) {
+		if !seen[recipientID] {
+			seen[recipientID] = true
+			recipients = append(recipients, recipientID)
+		}
+	}
+
+	chunks, err := queueChunks(ctx, request, recipients)
+	if err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("notificationRequestId", request.ID).Str("segmentId", segment.SegmentID).Int("recipients", len(recipients)).Int("childRequests", chunks).Msg("Segment expanded")
+	return nil
+}
+
+// resolveSegment returns the IDs of the users matching the segment criteria
+func resolveSegment(ctx context.Context, criteria shared.SegmentCriteria) ([]string, error) {
+	var preferences map[string]shared.UserPreferences
+	if len(criteria.EnabledTypes) > 0 {
+		var err error
+		preferences, err = getAllPreferences(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var members []string
+	startKey := ""
+	for {
+		users, nextKey, err := db.GetUsersList(ctx, 100, startKey)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if !criteria.MatchesUser(user) {
+				continue
+			}
+			if preferences != nil {
+				// Users without preferences of their own fall back to the global preferences
+				effective, ok := preferences[user.UserID]
+				if !ok {
+					effective = preferences["*"]
+				}
+				if !criteria.MatchesPreferences(effective) {
+					continue
+				}
+			}
+			members = append(members, user.UserID)
+		}
+		if nextKey == "" {
+			return members, nil
+		}
+		startKey = nextKey
+	}
+}
+
+// getAllPreferences loads every stored preference set keyed by context
+func getAllPreferences(ctx context.Context) (map[string]shared.UserPreferences, error) {
+	items, err := db.GetAllUserPreferences(ctx)
+	if err != nil {
+		return nil, err
+	}
+	preferences := make(map[string]shared.UserPreferences, len(items))
+	for _, item := range items {
+		preferences[item.Context] = item
+	}
+	return preferences, nil
+}
+
+// resolveRotation returns the users an on-call reference resolves to. Alerts go to whoever
+// is currently on call, other notification types go to every member of the rotation
+func resolveRotation(ctx context.Context, rotationID, notificationType string) []string {
+	rotation, err := db.GetOnCallRotation(ctx, rotationID)
+	if err != nil || rotation.RotationID == "" {
+		shared.LogError(ctx).Err(err).Str("rotationId", rotationID).Msg("Failed to resolve on-call rotation")
+		return nil
+	}
+
+	if notificationType == shared.NotificationTypeAlert {
+		onCall := rotation.CurrentOnCall(shared.GetCurrentTime())
+		shared.LogInfo(ctx).Str("rotationId", rotationID).Str("userId", onCall).Msg("Routing alert to on-call user")
+		return []string{onCall}
+	}
+	return rotation.Members
+}
+
 // ProcessingResult represents the result of processing a notification request
 type ProcessingResult struct {
 	RequestID       string                  `json:"requestId"`
@@ -83,17 +787,29 @@ type ProcessingResult struct {
 
 // ProcessedNotification represents a single processed notification
 type ProcessedNotification struct {
-	RecipientID string `json:"recipientId"`
-	Type        string `json:"type"`
-	Channel     string `json:"channel"`
-	Content     string `json:"content"`
-	Success     bool   `json:"success"`
-	Error       string `json:"error,omitempty"` // error message if failed
+	RecipientID       string     `json:"recipientId"`
+	Type              string     `json:"type"`
+	Channel           string     `json:"channel"`
+	Content           string     `json:"content"`
+	ContentHash       string     `json:"contentHash,omitempty"`
+	Suppressed        bool       `json:"suppressed,omitempty"` // duplicate content within the dedup window
+	Deferred          bool       `json:"deferred,omitempty"`   // re-queued for the next working day
+	Digested          bool       `json:"digested,omitempty"`   // held for the recipient's daily digest
+	DryRun            bool       `json:"dryRun,omitempty"`     // rendered by a dry run, not delivered
+	Success           bool       `json:"success"`
+	Error             string     `json:"error,omitempty"`             // error message if failed
+	DeliveredAt       *time.Time `json:"deliveredAt,omitempty"`       // set when content was delivered
+	ProviderMessageID string     `json:"providerMessageId,omitempty"` // e.g. the SES message ID
+	EmailMessageID    string     `json:"emailMessageId,omitempty"`    // Message-ID header of the email
+	ThreadMessageID   string     `json:"threadMessageId,omitempty"`   // Message-ID of the thread's original email the email replies to
+	ResponseStatus    int        `json:"responseStatus,omitempty"`    // HTTP status of the webhook endpoint
+	ResponseBody      string     `json:"responseBody,omitempty"`      // Truncated response of the webhook endpoint
 }
 
-// ProcessNotificationRequest processes a notification request for all recipients
-func ProcessNotificationRequest(ctx context.Context, request shared.NotificationRequest) (*ProcessingResult, error) {
-	shared.LogInfo().
+// ProcessNotificationRequest processes a notification request for all recipients.
+// teams maps recipients that were resolved from a team to that team
+func ProcessNotificationRequest(ctx context.Context, request shared.NotificationRequest, teams map[string]shared.Team) (*ProcessingResult, error) {
+	shared.LogInfo(ctx).
 		Str("type", request.Type).
 		Int("recipientCount", len(request.Recipients)).
 		Msg("Starting notification request processing")
@@ -104,11 +820,37 @@ func ProcessNotificationRequest(ctx context.Context, request shared.Notification
 		Notifications:   make([]ProcessedNotification, 0),
 	}
 
-	// Process each recipient sequentially
-	for _, recipientID := range request.Recipients {
-		notifications, err := processRecipient(ctx, recipientID, request)
+	// Recipients are processed up to the configured concurrency, their outcomes are collected in order
+	settings := db.GetProcessorSettings(ctx)
+	limits := newProcessorLimits(settings)
+	outcomes := make([]recipientOutcome, len(request.Recipients))
+	slots := make(chan struct{}, settings.RecipientConcurrency())
+	var wg sync.WaitGroup
+	for i, recipientID := range request.Recipients {
+		var team *shared.Team
+		if t, ok := teams[recipientID]; ok {
+			team = &t
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			// A panic fails only its own recipient instead of the whole Lambda
+			outcomes[i].err = shared.CatchPanic(ctx, func() error {
+				var err error
+				outcomes[i].notifications, err = processRecipient(ctx, recipientID, request, team, limits)
+				return err
+			})
+			recordRecipientOutcome(ctx, recipientID, request, outcomes[i])
+		}()
+	}
+	wg.Wait()
+
+	for i, recipientID := range request.Recipients {
+		notifications, err := outcomes[i].notifications, outcomes[i].err
 		if err != nil {
-			shared.LogError().Err(err).Str("recipientId", recipientID).Msg("Failed to process recipient")
 			result.FailureCount++
 
 			// Add failed notification record
@@ -117,74 +859,281 @@ func ProcessNotificationRequest(ctx context.Context, request shared.Notification
 				Success:     false,
 				Error:       err.Error(),
 			})
-
-			// Add failed notification record to notification validation
-			err = db.CreateNotificationValidation(ctx, shared.NotificationValidation{
-				IDUserIDTypeChannel: shared.BuildIDUserIDTypeChannel(request.ID, recipientID, request.Type, ""),
-				Content:             "",
-				Error:               err.Error(),
-			})
-			if err != nil {
-				shared.LogError().Err(err).Str("recipientId", recipientID).Msg("Failed to create notification validation")
-			}
 			continue
 		}
 
-		// Add successful notifications to notification validation
-		for _, notification := range notifications {
-			err := db.CreateNotificationValidation(ctx, shared.NotificationValidation{
-				IDUserIDTypeChannel: shared.BuildIDUserIDTypeChannel(request.ID, recipientID, request.Type, notification.Channel),
-				Content:             notification.Content,
-				Error:               notification.Error,
-			})
-			if err != nil {
-				shared.LogError().Err(err).Str("recipientId", recipientID).Msg("Failed to create notification validation")
-			}
-		}
-
-		// Add successful notifications
+		// Add processed notifications. A recipient only fails when every channel failed
 		result.Notifications = append(result.Notifications, notifications...)
-		result.SuccessCount++
+		if allChannelsFailed(notifications) {
+			result.FailureCount++
+		} else {
+			result.SuccessCount++
+		}
 	}
 
 	return result, nil
 }
 
-// processRecipient processes notifications for a single recipient
-func processRecipient(ctx context.Context, recipientID string, request shared.NotificationRequest) ([]ProcessedNotification, error) {
-	shared.LogInfo().Str("recipientId", recipientID).Str("type", request.Type).Msg("Processing recipient")
+// recipientOutcome is what processing a recipient of a request produced
+type recipientOutcome struct {
+	notifications []ProcessedNotification
+	err           error
+}
 
-	// Step 1: Get effective user preferences (user-specific → global fallback)
-	preferences, err := getEffectivePreferences(ctx, recipientID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get effective preferences: %w", err)
+// recordRecipientOutcome writes the notification validation records of a processed recipient, one per
+// channel outcome or a single failed record when the recipient could not be processed
+func recordRecipientOutcome(ctx context.Context, recipientID string, request shared.NotificationRequest, outcome recipientOutcome) {
+	if outcome.err != nil {
+		shared.LogError(ctx).Err(outcome.err).Str("recipientId", recipientID).Msg("Failed to process recipient")
+		err := db.CreateNotificationValidation(ctx, shared.NotificationValidation{
+			IDUserIDTypeChannel: shared.BuildIDUserIDTypeChannel(request.ID, recipientID, request.Type, ""),
+			Content:             "",
+			Error:               outcome.err.Error(),
+			Producer:            request.Producer,
+		})
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to create notification validation")
+		}
+		return
+	}
+
+	// Add channel outcomes to notification validation
+	for _, notification := range outcome.notifications {
+		err := db.CreateNotificationValidation(ctx, shared.NotificationValidation{
+			IDUserIDTypeChannel: shared.BuildIDUserIDTypeChannel(request.ID, recipientID, request.Type, notification.Channel),
+			Content:             notification.Content,
+			ContentHash:         notification.ContentHash,
+			Suppressed:          notification.Suppressed,
+			ProviderMessageID:   notification.ProviderMessageID,
+			ResponseStatus:      notification.ResponseStatus,
+			ResponseBody:        notification.ResponseBody,
+			Error:               notification.Error,
+			Producer:            request.Producer,
+		})
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to create notification validation")
+		}
 	}
+}
 
-	// Step 2: Get effective system config (user-specific → global fallback)
-	config, err := getEffectiveConfig(ctx, recipientID)
+// processorLimits bounds the work of a request under the processor settings. The channel slots are
+// shared by every recipient of the request
+type processorLimits struct {
+	renderTimeout time.Duration
+	channelSlots  map[string]chan struct{}
+}
+
+func newProcessorLimits(settings shared.ProcessorSettings) processorLimits {
+	limits := processorLimits{
+		renderTimeout: settings.RenderTimeout(),
+		channelSlots:  make(map[string]chan struct{}),
+	}
+	for channel, parallelism := range settings.ChannelParallelism {
+		limits.channelSlots[channel] = make(chan struct{}, parallelism)
+	}
+	return limits
+}
+
+// acquire waits for a delivery slot of the channel and returns its release. Channels without a
+// parallelism limit never wait
+func (l processorLimits) acquire(ctx context.Context, channel string) (func(), error) {
+	slots, ok := l.channelSlots[channel]
+	if !ok {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// render runs fn within the render timeout. Rendering cannot be interrupted, a render running past
+// the timeout is abandoned like a hung channel call
+func (l processorLimits) render(ctx context.Context, fn func() (string, error)) (string, error) {
+	if l.renderTimeout <= 0 {
+		return fn()
+	}
+
+	type rendered struct {
+		content string
+		err     error
+	}
+	done := make(chan rendered, 1)
+	go func() {
+		content, err := fn()
+		done <- rendered{content, err}
+	}()
+
+	timer := time.NewTimer(l.renderTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.content, r.err
+	case <-timer.C:
+		return "", fmt.Errorf("rendering timed out after %s", l.renderTimeout)
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// allChannelsFailed reports whether at least one channel was attempted and none succeeded
+func allChannelsFailed(notifications []ProcessedNotification) bool {
+	for _, notification := range notifications {
+		if notification.Success {
+			return false
+		}
+	}
+	return len(notifications) > 0
+}
+
+// processRecipient processes notifications for a single recipient within the request's limits.
+// team is set when the recipient was resolved from a team
+func processRecipient(ctx context.Context, recipientID string, request shared.NotificationRequest, team *shared.Team, limits processorLimits) ([]ProcessedNotification, error) {
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", request.Type).Msg("Processing recipient")
+
+	// Routing rules run first: they may drop the notification for this recipient, change its priority or
+	// variables, or add channels. Digests and built-in templates had their rules applied or are not routed
+	var ruleChannels []string
+	if !request.Digest && request.SystemTemplate == "" {
+		outcome := evaluateRules(ctx, recipientID, request)
+		if outcome.Drop {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Strs("rules", outcome.Matched).Msg("Notification dropped by rule")
+			return []ProcessedNotification{}, nil
+		}
+		request.Variables = outcome.Variables
+		if outcome.Priority != "" {
+			request.Priority = outcome.Priority
+		}
+		ruleChannels = outcome.Channels
+	}
+
+	// Step 1: Get effective user preferences (user-specific → team → global fallback) and system config
+	// (user-specific → global fallback)
+	recipient, err := notificationEngine.Resolve(ctx, recipientID, team)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get effective config: %w", err)
+		return nil, err
 	}
 
-	// Step 3: Filter enabled channels
-	enabledChannels := filterEnabledChannels(preferences, config, request.Type)
-	if len(enabledChannels) == 0 {
-		shared.LogInfo().Str("recipientId", recipientID).Msg("No enabled channels for recipient")
-		return []ProcessedNotification{}, nil
+	// Custom notification types bring their category and the channels used when preferences do not name the type
+	if !shared.IsBuiltInNotificationType(request.Type) {
+		customType, err := getCachedNotificationType(ctx, request.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get notification type: %w", err)
+		}
+		if request.Category == "" {
+			request.Category = customType.Category
+		}
+		recipient.Preferences = customType.WithDefaultChannels(recipient.Preferences)
+	}
+
+	// Marketing and product updates are only delivered with the recipient's consent for the category
+	if !request.Digest && request.SystemTemplate == "" {
+		if category := shared.NotificationCategory(request); !recipient.Preferences.HasConsent(recipientID, category) {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Str("category", category).Msg("No consent for notification category")
+			return []ProcessedNotification{}, nil
+		}
+	}
+
+	// Critical alerts skip digests, working-day deferral and daily caps, and so do admin test notifications
+	// so support sees the delivery at once. Dry runs skip them too, holding or deferring has side effects
+	critical := request.Priority == shared.PriorityCritical
+	immediate := critical || request.Test || request.DryRun
+
+	// Exempt recipients and producers skip daily caps, the email warm-up limit and content dedup
+	exemption := getThrottleExemption(ctx, recipientID, request.Producer)
+
+	// Types the user receives as a daily digest are held until the digest schedule fires
+	if !immediate && !request.Digest && request.SystemTemplate == "" && recipient.Preferences.Context == recipientID && recipient.Preferences.IsDigestDelivery(request.Type) {
+		err := db.CreateDigestItem(ctx, shared.DigestItem{
+			UserID:    recipientID,
+			RequestID: request.ID,
+			Type:      request.Type,
+			Variables: request.Variables,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to hold notification for digest: %w", err)
+		}
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", request.Type).Msg("Notification held for daily digest")
+		return []ProcessedNotification{{
+			RecipientID: recipientID,
+			Type:        request.Type,
+			Digested:    true,
+			Success:     true,
+		}}, nil
+	}
+
+	// Non-urgent notifications arriving on a non-working day wait for the next working day
+	config := recipient.Config
+	if !immediate && config.Config != nil && config.Config.Calendar.ShouldDefer(request.Type) && !config.Config.Calendar.IsWorkingDay(shared.GetCurrentTime()) {
+		if err := deferRecipient(ctx, recipientID, request, config.Config.Calendar); err != nil {
+			return nil, fmt.Errorf("failed to defer notification: %w", err)
+		}
+		return []ProcessedNotification{{
+			RecipientID: recipientID,
+			Type:        request.Type,
+			Deferred:    true,
+			Success:     true,
+		}}, nil
 	}
 
-	// Step 4: Process template and create notifications for each enabled channel
 	notifications := make([]ProcessedNotification, 0)
 
+	// Templates are rendered with the variables localized for the recipient. Their attributes are only loaded
+	// once a template references them
+	variables := notificationEngine.LocalizeVariables(ctx, recipient, request)
+	attributesLoaded := false
+
+	// Critical alerts also go to the recipient's verified critical contact, whatever their channel preferences.
+	// Replays of failed channels only retry the contact when its delivery failed
+	if critical && !request.DryRun && (len(request.Channels) == 0 || slices.Contains(request.Channels, shared.ChannelCriticalContact)) {
+		if notification, ok := deliverToCriticalContact(ctx, recipient, request, variables); ok {
+			notifications = append(notifications, notification)
+		}
+	}
+
+	// Step 2: Filter enabled channels
+	enabledChannels := notificationEngine.Channels(ctx, recipient, request, ruleChannels)
+	if len(enabledChannels) == 0 {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Msg("No enabled channels for recipient")
+		return notifications, nil
+	}
+
+	// Step 3: Process template and create notifications for each enabled channel
 	for _, channel := range enabledChannels {
-		// Step 5: Get required template (user-specific → global → fatal error)
-		template, err := getRequiredTemplate(ctx, recipientID, request.Type, channel)
+		// Step 4: Get required template (user-specific → global → channel failure).
+		// A missing template only fails its channel, the other channels are still delivered
+		template, err := notificationEngine.Template(ctx, recipient, request, channel)
 		if err != nil {
-			return nil, fmt.Errorf("failed to get required template: %w", err)
+			shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to get required template")
+			notifications = append(notifications, ProcessedNotification{
+				RecipientID: recipientID,
+				Type:        request.Type,
+				Channel:     channel,
+				Success:     false,
+				Error:       fmt.Sprintf("failed to get required template: %v", err),
+			})
+			continue
 		}
-		content, err := processTemplateForChannel(template.Content, channel, request.Variables)
+
+		if !attributesLoaded && strings.Contains(template.Content, shared.UserAttributeVariablePrefix) {
+			attributesLoaded = true
+			variables = withRecipientAttributes(ctx, recipientID, variables)
+		}
+
+		// Run the channel step behind its timeout and circuit breaker so one hung channel
+		// cannot starve the others for this recipient
+		var content string
+		err = shared.CallChannel(ctx, channel, func(ctx context.Context) error {
+			var channelErr error
+			content, channelErr = limits.render(ctx, func() (string, error) {
+				return notificationEngine.Render(ctx, template, channel, variables)
+			})
+			return channelErr
+		})
 		if err != nil {
-			shared.LogError().Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to process template")
+			shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to process template")
 			notifications = append(notifications, ProcessedNotification{
 				RecipientID: recipientID,
 				Type:        request.Type,
@@ -195,219 +1144,408 @@ func processRecipient(ctx context.Context, recipientID string, request shared.No
 			continue
 		}
 
-		notifications = append(notifications, ProcessedNotification{
+		// Test notifications are marked so the recipient can tell them from real ones
+		if request.Test {
+			content = engine.MarkTestContent(channel, content)
+		}
+
+		// Suppress identical content already delivered to this recipient/channel within the dedup window, see
+		// ContentDeduplicated for the requests that are not. Exempt recipients and producers are never suppressed
+		// and do not claim the content
+		contentHash := hashContent(channel, content)
+		deduplicated := request.ContentDeduplicated()
+		var suppressed bool
+		if deduplicated && exemption != nil {
+			if contentDedupEnabled() {
+				auditThrottleExemption(ctx, exemption, recipientID, channel, shared.ThrottleContentDedup, request)
+			}
+		} else if deduplicated {
+			suppressed, err = isDuplicateContent(ctx, recipientID, channel, contentHash)
+			if err != nil {
+				// Fail open: a dedup store outage should not block delivery
+				shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to check content deduplication")
+			}
+		}
+		if suppressed {
+			shared.LogInfo(ctx).Str("recipientId", recipientID).Str("channel", channel).Str("contentHash", contentHash).Msg("Duplicate content suppressed")
+		}
+
+		// Past the recipient's daily cap the notification waits for the channel's end-of-day digest, exemptions
+		// deliver it and are audited
+		dailyCapped := !suppressed && !immediate && !request.Digest && request.SystemTemplate == "" && recipient.Preferences.Context == recipientID && recipient.Preferences.DailyCap(channel) > 0
+		if dailyCapped && exemption != nil {
+			auditThrottleExemption(ctx, exemption, recipientID, channel, shared.ThrottleDailyCap, request)
+		} else if dailyCapped {
+			held, err := holdOverDailyCap(ctx, recipientID, channel, request, recipient.Preferences)
+			if err != nil {
+				// Fail open: a counter outage should not block delivery
+				shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to apply daily cap")
+			}
+			if held {
+				notifications = append(notifications, ProcessedNotification{
+					RecipientID: recipientID,
+					Type:        request.Type,
+					Channel:     channel,
+					Digested:    true,
+					Success:     true,
+				})
+				continue
+			}
+		}
+
+		// A warming up sending domain defers emails past the day's limit to the next day, exemptions send them
+		warmingUp := channel == shared.ChannelEmail && !suppressed && !immediate
+		if warmingUp && exemption != nil {
+			if _, capped := engine.GlobalSettings(ctx, recipient.Config).EmailWarmUp.DailyLimit(shared.GetCurrentTime()); capped {
+				auditThrottleExemption(ctx, exemption, recipientID, channel, shared.ThrottleEmailWarmUp, request)
+			}
+		} else if warmingUp {
+			deferred, err := deferOverWarmUpLimit(ctx, recipientID, request, recipient.Config)
+			if err != nil {
+				// Fail open: a counter or scheduler outage should not block delivery
+				shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to apply email warm-up limit")
+			}
+			if deferred {
+				notifications = append(notifications, ProcessedNotification{
+					RecipientID: recipientID,
+					Type:        request.Type,
+					Channel:     channel,
+					Deferred:    true,
+					Success:     true,
+				})
+				continue
+			}
+		}
+
+		notification := ProcessedNotification{
 			RecipientID: recipientID,
+			Type:        request.Type,
 			Channel:     channel,
 			Content:     content,
+			ContentHash: contentHash,
+			Suppressed:  suppressed,
 			Success:     true,
-		})
+		}
+		// Dry runs stop short of the provider, the rendered content is recorded for the user to check
+		if request.DryRun {
+			notification.DryRun = true
+			notifications = append(notifications, notification)
+			continue
+		}
+		if !suppressed {
+			// Past the channel's parallelism the delivery waits for another recipient's to finish
+			var delivery engine.Delivery
+			release, sendErr := limits.acquire(ctx, channel)
+			if sendErr == nil {
+				delivery, sendErr = notificationEngine.Deliver(ctx, recipient, request, channel, content)
+				notification.ProviderMessageID, notification.EmailMessageID, notification.ThreadMessageID = delivery.ProviderMessageID, delivery.EmailMessageID, delivery.ThreadMessageID
+				notification.ResponseStatus, notification.ResponseBody = delivery.ResponseStatus, delivery.ResponseBody
+				release()
+			}
+			if sendErr != nil {
+				shared.LogError(ctx).Err(sendErr).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to send notification")
+				notification.Success = false
+				notification.Error = fmt.Sprintf("failed to send %s: %v", channel, sendErr)
+				if exemption == nil {
+					releaseContentDedup(ctx, recipientID, channel, contentHash)
+				}
+				notifications = append(notifications, notification)
+				continue
+			}
+			deliveredAt := shared.GetCurrentTime()
+			notification.DeliveredAt = &deliveredAt
+			if channel == shared.ChannelEmail {
+				recordEmailMessage(ctx, recipientID, request, delivery)
+			}
+		}
+		notifications = append(notifications, notification)
 	}
 
 	return notifications, nil
 }
 
-// getEffectivePreferences gets user preferences with global fallback
-func getEffectivePreferences(ctx context.Context, recipientID string) (shared.UserPreferences, error) {
-	// Try user-specific preferences first
-	userPrefs, err := db.GetUserPreferences(ctx, recipientID)
-	if err == nil && userPrefs.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Msg("Using user-specific preferences")
-		return userPrefs, nil
+// recordEmailMessage remembers which request and recipient an email sent through SES belongs to, so the
+// bounce handler can redeliver it after a soft bounce. Other providers do not report bounces to the service
+func recordEmailMessage(ctx context.Context, recipientID string, request shared.NotificationRequest, delivery engine.Delivery) {
+	if delivery.Provider != shared.EmailProviderSES || delivery.ProviderMessageID == "" {
+		return
 	}
-
-	// Fallback to global preferences
-	globalPrefs, err := db.GetUserPreferences(ctx, "*")
-	if err == nil && globalPrefs.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Msg("Using global preferences fallback")
-		return globalPrefs, nil
+	err := db.CreateEmailMessage(ctx, shared.EmailMessage{
+		MessageID:   delivery.ProviderMessageID,
+		RequestID:   request.ID,
+		RecipientID: recipientID,
+		Attempt:     request.BounceRetry,
+	})
+	if err != nil {
+		// Best effort: the email was sent, only a retry after a soft bounce is lost
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("messageId", delivery.ProviderMessageID).Msg("Failed to record email message")
 	}
-
-	// Return error if neither exists
-	return shared.UserPreferences{}, fmt.Errorf("no preferences found for recipient %s", recipientID)
 }
 
-// getEffectiveConfig gets system config with global fallback
-func getEffectiveConfig(ctx context.Context, recipientID string) (shared.SystemConfig, error) {
-	// Try user-specific config first
-	userConfig, err := db.GetSystemConfig(ctx, recipientID)
-	if err == nil && userConfig.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Msg("Using user-specific config")
-		return userConfig, nil
-	}
+// rulesCache holds every rule in evaluation order, a rule change reaches processors within its TTL
+var rulesCache = shared.NewTTLCache[[]shared.Rule](shared.GetEnvDuration("RULES_CACHE_TTL", time.Minute))
 
-	// Fallback to global config
-	globalConfig, err := db.GetSystemConfig(ctx, "*")
-	if err == nil && globalConfig.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Msg("Using global config fallback")
-		return globalConfig, nil
+// getCachedRules returns the routing rules through the rules cache
+func getCachedRules(ctx context.Context) ([]shared.Rule, error) {
+	if rules, ok := rulesCache.Get("*"); ok {
+		return rules, nil
 	}
-
-	// Return error if neither exists
-	return shared.SystemConfig{}, fmt.Errorf("no config found for recipient %s", recipientID)
+	rules, err := db.GetAllRules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rulesCache.Set("*", rules)
+	return rules, nil
 }
 
-// getRequiredTemplate gets template with user → global fallback, error if none found
-func getRequiredTemplate(ctx context.Context, recipientID, notificationType, channel string) (shared.Template, error) {
-	// Try user-specific template first
-	userTemplate, err := db.GetTemplateByTypeChannel(ctx, recipientID, shared.BuildTypeChannel(notificationType, channel))
-	if err == nil && userTemplate.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Str("type", notificationType).Msg("Using user-specific template")
-		return userTemplate, nil
+// evaluateRules runs the routing rules against the notification for one recipient. The recipient's
+// attributes are only loaded when a rule reads them
+func evaluateRules(ctx context.Context, recipientID string, request shared.NotificationRequest) shared.RuleOutcome {
+	rules, err := getCachedRules(ctx)
+	if err != nil {
+		// Fail open: a rules store outage should not block delivery
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to get rules")
+		return shared.RuleOutcome{Variables: request.Variables}
 	}
 
-	// Fallback to global template
-	globalTemplate, err := db.GetTemplateByTypeChannel(ctx, "*", shared.BuildTypeChannel(notificationType, channel))
-	if err == nil && globalTemplate.Context != "" {
-		shared.LogInfo().Str("recipientId", recipientID).Str("type", notificationType).Msg("Using global template fallback")
-		return globalTemplate, nil
+	input := shared.RuleInput{Type: request.Type, Variables: request.Variables}
+	if shared.NeedsRecipientAttributes(rules) && !strings.HasPrefix(recipientID, shared.RecipientPrefixTeam) {
+		user, err := db.GetUserByID(ctx, recipientID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Msg("Failed to get recipient attributes for rules")
+		} else if user != nil {
+			input.Attributes = user.Attributes
+		}
 	}
 
-	// Fatal error if no template found
-	return shared.Template{}, fmt.Errorf("no template found for type %s (fatal error)", notificationType)
+	outcome := shared.EvaluateRules(rules, input)
+	if len(outcome.Matched) > 0 {
+		shared.LogInfo(ctx).Str("recipientId", recipientID).Strs("rules", outcome.Matched).Msg("Rules matched")
+	}
+	return outcome
 }
 
-// filterEnabledChannels filters channels based on preferences, config, and template availability
-func filterEnabledChannels(preferences shared.UserPreferences, config shared.SystemConfig, notificationType string) []string {
-	enabledChannels := make([]string, 0)
-
-	// Get preference for this notification type
-	prefItem, hasPref := preferences.Preferences[notificationType]
-	if !hasPref || prefItem.Enabled == nil || !*prefItem.Enabled {
-		shared.LogInfo().Str("type", notificationType).Msg("Notification type disabled in preferences")
-		return enabledChannels
+// deferOverWarmUpLimit counts the email against the sending domain's warm-up limit for the UTC day. Past
+// the limit the email is deferred to the start of the next day
+func deferOverWarmUpLimit(ctx context.Context, recipientID string, request shared.NotificationRequest, config shared.SystemConfig) (bool, error) {
+	settings := engine.GlobalSettings(ctx, config)
+	now := shared.GetCurrentTime()
+	limit, capped := settings.EmailWarmUp.DailyLimit(now)
+	domain := shared.EmailDomain(settings.EmailSettings.FromAddressFor(request.Type))
+	if !capped || domain == "" {
+		return false, nil
 	}
 
-	// Check each preferred channel
-	for _, channel := range prefItem.Channels {
-		// Check if channel is enabled in system config
-		if !isChannelEnabledInConfig(config, channel) {
-			shared.LogInfo().Str("channel", channel).Msg("Channel disabled in system config")
-			continue
-		}
+	count, err := db.IncrementDailyCount(ctx, db.BuildWarmUpKey(domain, now.UTC().Format(shared.DateFormat)))
+	if err != nil {
+		return false, err
+	}
+	if count <= limit {
+		return false, nil
+	}
 
-		enabledChannels = append(enabledChannels, channel)
+	deliverAt := shared.NextWarmUpDay(now)
+	deferred := request
+	deferred.Recipients = []string{recipientID}
+	deferred.Deferred = true
+	deferred.Channels = []string{shared.ChannelEmail}
+	if err := shared.CreateOneTimeEventBridgeSchedule(ctx, recipientID, shared.DeferredScheduleIDPrefix+uuid.New().String(), deliverAt, deferred); err != nil {
+		return false, err
 	}
 
-	return enabledChannels
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("domain", domain).Int("limit", limit).Time("deliverAt", deliverAt).Msg("Email warm-up limit reached, email deferred to next day")
+	return true, nil
 }
 
-// isChannelEnabledInConfig checks if a channel is enabled in system config
-func isChannelEnabledInConfig(config shared.SystemConfig, channel string) bool {
-	if config.Config == nil {
-		return false
+// deliverToCriticalContact sends the request's email content to the recipient's verified critical contact,
+// rendered with the variables of the recipient's own deliveries. It reports false when the recipient has no
+// verified contact
+func deliverToCriticalContact(ctx context.Context, recipient engine.Recipient, request shared.NotificationRequest, variables map[string]any) (ProcessedNotification, bool) {
+	if strings.HasPrefix(recipient.ID, shared.RecipientPrefixTeam) {
+		return ProcessedNotification{}, false
 	}
-
-	switch channel {
-	case shared.ChannelEmail:
-		return config.Config.EmailSettings.Enabled != nil && *config.Config.EmailSettings.Enabled
-	case shared.ChannelSlack:
-		return config.Config.SlackSettings.Enabled != nil && *config.Config.SlackSettings.Enabled
-	case shared.ChannelInApp:
-		return config.Config.InAppSettings.Enabled != nil && *config.Config.InAppSettings.Enabled
-	default:
-		return false
+	user, err := db.GetUserByID(ctx, recipient.ID)
+	if err != nil || user == nil || user.CriticalContact == nil || !user.CriticalContact.Verified {
+		return ProcessedNotification{}, false
 	}
-}
 
-// processTemplateForChannel processes template variables for a specific channel
-func processTemplateForChannel(templateContent, channel string, variables map[string]any) (string, error) {
-	if templateContent == "" {
-		return "", fmt.Errorf("template content is empty")
+	notification := ProcessedNotification{
+		RecipientID: recipient.ID,
+		Type:        request.Type,
+		Channel:     shared.ChannelCriticalContact,
 	}
 
-	shared.LogInfo().Str("channel", channel).Msg("Processing template for channel")
-
-	// Parse template content based on channel
-	var processedContent string
-	var err error
-
-	switch channel {
-	case shared.ChannelEmail:
-		processedContent, err = processEmailTemplate(templateContent, variables)
-	case shared.ChannelSlack:
-		processedContent, err = processSlackTemplate(templateContent, variables)
-	case shared.ChannelInApp:
-		processedContent, err = processInAppTemplate(templateContent, variables)
-	default:
-		return "", fmt.Errorf("unsupported channel: %s", channel)
+	template, err := notificationEngine.Template(ctx, recipient, request, shared.ChannelEmail)
+	if err != nil {
+		notification.Error = fmt.Sprintf("failed to get required template: %v", err)
+		return notification, true
 	}
-
+	if strings.Contains(template.Content, shared.UserAttributeVariablePrefix) {
+		variables = withRecipientAttributes(ctx, recipient.ID, variables)
+	}
+	content, err := notificationEngine.Render(ctx, template, shared.ChannelEmail, variables)
 	if err != nil {
-		return "", fmt.Errorf("failed to process template for channel %s: %w", channel, err)
+		notification.Error = err.Error()
+		return notification, true
+	}
+	delivery, err := notificationEngine.Deliver(ctx, recipient, request, shared.ChannelCriticalContact, content)
+	if err != nil {
+		notification.Error = err.Error()
+		return notification, true
 	}
 
-	return processedContent, nil
+	deliveredAt := shared.GetCurrentTime()
+	notification.Content = content
+	notification.ProviderMessageID = delivery.ProviderMessageID
+	notification.Success = true
+	notification.DeliveredAt = &deliveredAt
+	return notification, true
 }
 
-// processEmailTemplate processes email template with subject and body
-func processEmailTemplate(templateContent string, variables map[string]any) (string, error) {
-	// Email templates are expected to be JSON with subject and body
-	var emailTemplate map[string]string
-	err := json.Unmarshal([]byte(templateContent), &emailTemplate)
+// holdOverDailyCap counts the notification against the recipient's daily cap for the channel. Once the cap
+// is exceeded the notification is held and the channel's overflow digest is scheduled for the end of the day
+func holdOverDailyCap(ctx context.Context, recipientID, channel string, request shared.NotificationRequest, preferences shared.UserPreferences) (bool, error) {
+	now := shared.GetCurrentTime()
+	day := shared.DailyCapDay(preferences.Timezone, now)
+	count, err := db.IncrementDailyCount(ctx, db.BuildDailyCapKey(recipientID, channel, day))
 	if err != nil {
-		return "", fmt.Errorf("invalid email template format: %w", err)
+		return false, err
+	}
+	if count <= preferences.DailyCap(channel) {
+		return false, nil
 	}
 
-	subject, hasSubject := emailTemplate["subject"]
-	body, hasBody := emailTemplate["body"]
+	err = db.CreateDigestItem(ctx, shared.DigestItem{
+		UserID:    recipientID,
+		RequestID: request.ID,
+		Type:      request.Type,
+		Channel:   channel,
+		Variables: request.Variables,
+	})
+	if err != nil {
+		return false, err
+	}
 
-	if !hasSubject || !hasBody {
-		return "", fmt.Errorf("email template must have both subject and body")
+	// Every overflow tries to schedule the digest, the schedule already existing is expected
+	scheduleID := shared.OverflowScheduleID(recipientID, channel, day)
+	err = shared.CreateOneTimeEventBridgeSchedule(ctx, recipientID, scheduleID, shared.OverflowDigestTime(preferences.Timezone, now), shared.NotificationRequest{
+		ID:         scheduleID,
+		Type:       shared.NotificationTypeNotification,
+		Recipients: []string{recipientID},
+		Digest:     true,
+		Overflow:   true,
+		Channels:   []string{channel},
+		Producer:   &shared.Producer{Kind: shared.ProducerSystem, ID: "overflow_digest"},
+	})
+	if err != nil && !shared.IsScheduleConflict(err) {
+		// The item is held, the next overflow retries the schedule
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to schedule overflow digest")
 	}
 
-	// Process variables in subject and body
-	processedSubject := replaceTemplateVariables(subject, variables)
-	processedBody := replaceTemplateVariables(body, variables)
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("channel", channel).Int("count", count).Msg("Daily cap reached, notification held for overflow digest")
+	return true, nil
+}
 
-	// Return as JSON
-	result := map[string]string{
-		"subject": processedSubject,
-		"body":    processedBody,
+// withRecipientAttributes adds the recipient's user attributes to the variables as user.<key>.
+// Recipients that are not users, or whose record cannot be read, render with the request variables only
+func withRecipientAttributes(ctx context.Context, recipientID string, variables map[string]any) map[string]any {
+	if strings.HasPrefix(recipientID, shared.RecipientPrefixTeam) {
+		return variables
+	}
+	user, err := db.GetUserByID(ctx, recipientID)
+	if err != nil || user == nil {
+		return variables
 	}
+	return shared.WithUserAttributes(variables, user.Attributes)
+}
 
-	resultBytes, err := json.Marshal(result)
+// decodeMessage parses the notification request from an SQS message, using the decoder selected by
+// the contentType message attribute. JSON bodies may arrive wrapped in SNS or EventBridge envelopes
+func decodeMessage(ctx context.Context, record events.SQSMessage) (shared.NotificationRequest, error) {
+	contentType := shared.ContentTypeJSON
+	if attribute, ok := record.MessageAttributes[shared.ContentTypeAttribute]; ok && attribute.StringValue != nil {
+		contentType = *attribute.StringValue
+	}
+	senderID := record.Attributes["SenderId"]
+	if contentType != shared.ContentTypeJSON {
+		notificationRequest, err := shared.DecodeNotificationRequest(contentType, record.Body)
+		if err != nil {
+			return shared.NotificationRequest{}, err
+		}
+		notificationRequest.Producer = shared.ResolveProducer(nil, shared.MessageOrigin{Envelope: shared.EnvelopeNone}, senderID)
+		return notificationRequest, nil
+	}
+
+	// Producers may publish through SNS or EventBridge, unwrap their envelopes first
+	body, origin, err := shared.UnwrapMessageBody(record.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal processed email template: %w", err)
+		return shared.NotificationRequest{}, err
+	}
+	if origin.Envelope != shared.EnvelopeNone {
+		shared.LogInfo(ctx).Str("messageId", record.MessageId).Str("envelope", origin.Envelope).Msg("Unwrapped message envelope")
 	}
 
-	return string(resultBytes), nil
+	var notificationRequest shared.NotificationRequest
+	if err := json.Unmarshal([]byte(body), &notificationRequest); err != nil {
+		return shared.NotificationRequest{}, err
+	}
+	notificationRequest.Producer = shared.ResolveProducer(notificationRequest.Producer, origin, senderID)
+	return notificationRequest, nil
 }
 
-// processSlackTemplate processes Slack template (simple text with variables)
-func processSlackTemplate(templateContent string, variables map[string]any) (string, error) {
-	// Slack templates can be simple text or JSON with more complex formatting
-	// For now, treat as simple text with variable replacement
-	return replaceTemplateVariables(templateContent, variables), nil
+// deferRecipient re-queues the request for a single recipient at the start of the next working day
+func deferRecipient(ctx context.Context, recipientID string, request shared.NotificationRequest, calendar shared.CalendarSettings) error {
+	deliverAt := calendar.NextWorkingTime(shared.GetCurrentTime())
+	if deliverAt.IsZero() {
+		return fmt.Errorf("business calendar has no working days")
+	}
+
+	deferred := request
+	deferred.Recipients = []string{recipientID}
+	deferred.Deferred = true
+	if err := shared.CreateOneTimeEventBridgeSchedule(ctx, recipientID, shared.DeferredScheduleIDPrefix+uuid.New().String(), deliverAt, deferred); err != nil {
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("recipientId", recipientID).Str("type", request.Type).Time("deliverAt", deliverAt).Msg("Notification deferred to next working day")
+	return nil
 }
 
-// processInAppTemplate processes in-app template (simple text with variables)
-func processInAppTemplate(templateContent string, variables map[string]any) (string, error) {
-	// In-app templates can be simple text or JSON with more complex formatting
-	// For now, treat as simple text with variable replacement
-	return replaceTemplateVariables(templateContent, variables), nil
+// hashContent returns the SHA-256 hash of the rendered content for a channel
+func hashContent(channel, content string) string {
+	sum := sha256.Sum256([]byte(channel + "\n" + content))
+	return hex.EncodeToString(sum[:])
 }
 
-// replaceTemplateVariables replaces template variables in the format {{variableName}}
-func replaceTemplateVariables(content string, variables map[string]any) string {
-	// Pattern to match {{variableName}}
-	re := regexp.MustCompile(`\{\{([^}]+)\}\}`)
+// contentDedupEnabled reports whether identical content is suppressed within a dedup window
+func contentDedupEnabled() bool {
+	return shared.GetEnvDuration("CONTENT_DEDUP_WINDOW", 0) > 0 && shared.DedupTable != ""
+}
 
-	return re.ReplaceAllStringFunc(content, func(match string) string {
-		// Extract variable name (remove {{ and }})
-		varName := strings.Trim(match, "{}")
-		varName = strings.TrimSpace(varName)
+// isDuplicateContent claims the content hash for the dedup window (CONTENT_DEDUP_WINDOW, disabled when unset)
+// and reports whether the same content was already delivered within it
+func isDuplicateContent(ctx context.Context, recipientID, channel, contentHash string) (bool, error) {
+	if !contentDedupEnabled() {
+		return false, nil
+	}
 
-		// Look up variable value
-		if value, exists := variables[varName]; exists {
-			return fmt.Sprintf("%v", value)
-		}
+	claimed, err := db.ClaimDedupKey(ctx, db.BuildContentDedupKey(recipientID, channel, contentHash), shared.GetEnvDuration("CONTENT_DEDUP_WINDOW", 0))
+	if err != nil {
+		return false, err
+	}
+	return !claimed, nil
+}
 
-		// Replace missing variables with empty string as per requirements
-		shared.LogInfo().Str("variable", varName).Msg("Template variable not found, replacing with empty string")
-		return ""
-	})
+// releaseContentDedup frees the content hash claimed for a delivery that failed, so a retry is not suppressed
+func releaseContentDedup(ctx context.Context, recipientID, channel, contentHash string) {
+	if !contentDedupEnabled() {
+		return
+	}
+	if err := db.ReleaseDedupKey(ctx, db.BuildContentDedupKey(recipientID, channel, contentHash)); err != nil {
+		shared.LogError(ctx).Err(err).Str("recipientId", recipientID).Str("channel", channel).Msg("Failed to release content dedup key")
+	}
 }
 
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapHandler("processor", handler))
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+// RollupDetail allows a manual run for a specific day
+type RollupDetail struct {
+	Date string `json:"date,omitempty"` // YYYY-MM-DD, defaults to yesterday (UTC)
+}
+
+func handler(ctx context.Context, event events.CloudWatchEvent) error {
+	date := shared.GetCurrentTime().AddDate(0, 0, -1).Format(shared.DateFormat)
+
+	var detail RollupDetail
+	if len(event.Detail) > 0 {
+		if err := json.Unmarshal(event.Detail, &detail); err == nil && detail.Date != "" {
+			if _, err := time.Parse(shared.DateFormat, detail.Date); err != nil {
+				shared.LogError(ctx).Err(err).Str("date", detail.Date).Msg("Invalid rollup date")
+				return err
+			}
+			date = detail.Date
+		}
+	}
+
+	shared.LogInfo(ctx).Str("date", date).Msg("Analytics rollup started")
+
+	if err := rollupAckSLA(ctx, date); err != nil {
+		shared.LogError(ctx).Err(err).Str("date", date).Msg("Failed to roll up acknowledgment SLA")
+		return err
+	}
+
+	if err := rollupDeliverySLA(ctx, date); err != nil {
+		shared.LogError(ctx).Err(err).Str("date", date).Msg("Failed to roll up delivery SLA")
+		return err
+	}
+
+	shared.LogInfo(ctx).Str("date", date).Msg("Analytics rollup completed")
+	return nil
+}
+
+// rollupAckSLA computes time-to-ack percentiles per notification type for a day
+func rollupAckSLA(ctx context.Context, date string) error {
+	acks, err := db.GetAllAcknowledgmentsByDate(ctx, date)
+	if err != nil {
+		return err
+	}
+
+	durationsByType := make(map[string][]float64)
+	for _, ack := range acks {
+		if ack.SentAt == nil || ack.Type == "" {
+			continue
+		}
+		durationsByType[ack.Type] = append(durationsByType[ack.Type], ack.TimeToAckSeconds)
+	}
+
+	for notificationType, durations := range durationsByType {
+		rollup := buildRollup(shared.BuildMetricKey(shared.MetricAckSLA, notificationType), date, durations)
+		if err := db.PutAnalyticsRollup(ctx, rollup); err != nil {
+			return err
+		}
+		shared.LogInfo(ctx).Str("type", notificationType).Int("count", rollup.Count).Float64("p95", rollup.P95).Msg("Acknowledgment SLA rolled up")
+	}
+	return nil
+}
+
+// rollupDeliverySLA computes end-to-end latency percentiles (enqueue to delivery) per channel for the
+// requests processed on a day. Suppressed, deferred and digested deliveries are left out
+func rollupDeliverySLA(ctx context.Context, date string) error {
+	from, err := time.Parse(shared.DateFormat, date)
+	if err != nil {
+		return err
+	}
+	histories, err := db.GetNotificationHistoryBetween(ctx, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+
+	// Latencies are rolled up per channel, and per channel and producer kind or tag
+	latenciesByKey := make(map[string][]float64)
+	for _, history := range histories {
+		if history.EnqueuedAt == nil {
+			continue
+		}
+		for _, delivery := range history.Deliveries {
+			if !delivery.Success || delivery.DeliveredAt == nil || delivery.Channel == "" {
+				continue
+			}
+			latency := max(delivery.DeliveredAt.Sub(*history.EnqueuedAt).Seconds(), 0)
+			key := shared.BuildMetricKey(shared.MetricDeliverySLA, delivery.Channel)
+			latenciesByKey[key] = append(latenciesByKey[key], latency)
+			if history.Producer != nil {
+				producerKey := shared.BuildMetricKey(key, history.Producer.Kind)
+				latenciesByKey[producerKey] = append(latenciesByKey[producerKey], latency)
+			}
+			for _, tag := range history.Tags {
+				tagKey := shared.BuildMetricKey(key, shared.TagMetricPrefix+tag)
+				latenciesByKey[tagKey] = append(latenciesByKey[tagKey], latency)
+			}
+		}
+	}
+
+	for key, latencies := range latenciesByKey {
+		rollup := buildRollup(key, date, latencies)
+		if err := db.PutAnalyticsRollup(ctx, rollup); err != nil {
+			return err
+		}
+		shared.LogInfo(ctx).Str("metricKey", key).Int("count", rollup.Count).Float64("p95", rollup.P95).Msg("Delivery SLA rolled up")
+	}
+	return nil
+}
+
+// buildRollup computes count, average and percentiles for a set of values
+func buildRollup(metricKey, date string, values []float64) shared.AnalyticsRollup {
+	sort.Float64s(values)
+
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+
+	rollup := shared.AnalyticsRollup{
+		MetricKey: metricKey,
+		Date:      date,
+		Count:     len(values),
+		P50:       shared.Percentile(values, 50),
+		P90:       shared.Percentile(values, 90),
+		P95:       shared.Percentile(values, 95),
+		P99:       shared.Percentile(values, 99),
+	}
+	if len(values) > 0 {
+		rollup.Average = total / float64(len(values))
+	}
+	return rollup
+}
+
+func main() {
+	lambda.Start(shared.WrapEventHandler("rollup", handler))
+}
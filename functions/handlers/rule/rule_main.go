@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/services"
+	"notification-service/functions/shared"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	RuleIDPathParam     = "ruleId"
+	LimitQueryParam     = "limit"
+	NextTokenQueryParam = "nextToken"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Rule handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Rules route every notification of the service, only super admins can see or manage them
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage rules", nil), nil
+	}
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createRule(ctx, event, userContext)
+	case http.MethodPut:
+		return updateRule(ctx, event)
+	case http.MethodGet:
+		if event.PathParameters != nil && event.PathParameters[RuleIDPathParam] != "" {
+			return getRule(ctx, event)
+		}
+		return listRules(ctx, event)
+	case http.MethodDelete:
+		return deleteRule(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type RuleRequest struct {
+	Name           string                 `json:"name,omitempty"`
+	Order          *int                   `json:"order,omitempty"`
+	Enabled        *bool                  `json:"enabled,omitempty"`
+	TemporaryUntil *time.Time             `json:"temporaryUntil,omitempty"` // The rule stops applying after it
+	Conditions     []shared.RuleCondition `json:"conditions,omitempty"`     // Replaced as a whole, [] removes every condition
+	Actions        []shared.RuleAction    `json:"actions,omitempty"`        // Replaced as a whole
+}
+
+func createRule(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request RuleRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Name is required", nil), nil
+	}
+	if err := shared.ValidateExpiry("temporaryUntil", request.TemporaryUntil); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	rule := shared.Rule{
+		RuleID:         uuid.New().String(),
+		Name:           request.Name,
+		Enabled:        request.Enabled,
+		TemporaryUntil: request.TemporaryUntil,
+		Conditions:     request.Conditions,
+		Actions:        request.Actions,
+		CreatedBy:      userContext.UserID,
+	}
+	if request.Order != nil {
+		rule.Order = *request.Order
+	}
+	if rule.Conditions == nil {
+		rule.Conditions = []shared.RuleCondition{}
+	}
+	if err := rule.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid rule: "+err.Error(), nil), nil
+	}
+
+	rule, err = db.CreateRule(ctx, rule)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to create rule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create rule", nil), nil
+	}
+
+	shared.LogAudit(ctx, "rule.create").Str("ruleId", rule.RuleID).Msg("Rule created")
+
+	return shared.CreateAPIResponse(http.StatusCreated, rule), nil
+}
+
+func updateRule(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	ruleID := event.PathParameters[RuleIDPathParam]
+	if ruleID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Rule ID is required", nil), nil
+	}
+
+	var request RuleRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" && request.Order == nil && request.Enabled == nil && request.TemporaryUntil == nil && request.Conditions == nil && request.Actions == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	if err := shared.ValidateExpiry("temporaryUntil", request.TemporaryUntil); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	existing, err := db.GetRule(ctx, ruleID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing rule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve rule", nil), nil
+	}
+	if existing.RuleID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Rule not found", nil), nil
+	}
+
+	// The merged rule is validated as a whole, e.g. actions cannot be emptied
+	rule := existing
+	if request.Name != "" {
+		rule.Name = request.Name
+	}
+	if request.Enabled != nil {
+		rule.Enabled = request.Enabled
+	}
+	if request.Order != nil {
+		rule.Order = *request.Order
+	}
+	if request.TemporaryUntil != nil {
+		rule.TemporaryUntil = request.TemporaryUntil
+	}
+	if request.Conditions != nil {
+		rule.Conditions = request.Conditions
+	}
+	if request.Actions != nil {
+		rule.Actions = request.Actions
+	}
+	if err := rule.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid rule: "+err.Error(), nil), nil
+	}
+
+	updatedRule, err := db.UpdateRule(ctx, rule)
+	if services.IsConditionalCheckFailed(err) {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Rule not found", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to update rule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update rule", nil), nil
+	}
+
+	shared.LogAudit(ctx, "rule.update").Str("ruleId", ruleID).Msg("Rule updated")
+
+	return shared.CreateAPIResponse(http.StatusOK, updatedRule), nil
+}
+
+func getRule(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	ruleID := event.PathParameters[RuleIDPathParam]
+
+	rule, err := db.GetRule(ctx, ruleID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get rule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve rule", nil), nil
+	}
+	if rule.RuleID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Rule not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, rule), nil
+}
+
+func listRules(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	rules, nextKey, err := db.GetRulesList(ctx, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get rules list")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve rules", nil), nil
+	}
+	shared.SortRules(rules)
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     rules,
+		Count:     len(rules),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func deleteRule(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	ruleID := event.PathParameters[RuleIDPathParam]
+	if ruleID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Rule ID is required", nil), nil
+	}
+
+	err := db.DeleteRule(ctx, ruleID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete rule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete rule", nil), nil
+	}
+
+	shared.LogAudit(ctx, "rule.delete").Str("ruleId", ruleID).Msg("Rule deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Rule deleted successfully"}), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("rule", handler))
+}
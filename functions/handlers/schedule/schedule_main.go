@@ -4,10 +4,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"notification-service/functions/db"
+	"notification-service/functions/services"
 	"notification-service/functions/shared"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -15,8 +20,17 @@ import (
 	"github.com/google/uuid"
 )
 
+const (
+	// DefaultNextRuns and MaxNextRuns bound the count of the next-runs endpoints
+	DefaultNextRuns = 5
+	MaxNextRuns     = 50
+
+	// MaxScheduleRecipients is how many recipients a schedule lists, larger audiences are scheduled as a segment
+	MaxScheduleRecipients = 100
+)
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapAPIHandler("schedule", handler))
 }
 
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (shared.APIResponse, error) {
@@ -24,12 +38,27 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (shared
 
 	userContext, err := shared.GetUserContext(request.RequestContext)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user context")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user context")
 		return shared.CreateErrorResponse(http.StatusUnauthorized, "Unauthorized", err.Error()), nil
 	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	if strings.HasSuffix(request.Resource, "/next-runs") {
+		if request.HTTPMethod != http.MethodGet {
+			return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+		}
+		return getNextRuns(ctx, request, userContext)
+	}
 
 	switch request.HTTPMethod {
 	case http.MethodPost:
+		if strings.HasSuffix(request.Resource, "/clone") {
+			scheduleID := request.PathParameters["scheduleId"]
+			if scheduleID == "" {
+				return shared.CreateErrorResponse(http.StatusBadRequest, "Schedule ID is required", nil), nil
+			}
+			return cloneScheduledNotification(ctx, request, scheduleID, userContext)
+		}
 		return createScheduledNotification(ctx, request, userContext)
 	case http.MethodGet:
 		if scheduleID := request.PathParameters["scheduleId"]; scheduleID != "" {
@@ -54,14 +83,10 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (shared
 }
 
 func createScheduledNotification(ctx context.Context, request events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
-	var reqBody struct {
-		Type      string                `json:"type"`
-		Variables map[string]any        `json:"variables"`
-		Schedule  shared.ScheduleConfig `json:"schedule"`
-	}
+	var reqBody shared.CreateScheduleRequest
 
 	if err := json.Unmarshal([]byte(request.Body), &reqBody); err != nil {
-		shared.LogError().Err(err).Msg("Failed to unmarshal request body")
+		shared.LogError(ctx).Err(err).Msg("Failed to unmarshal request body")
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
 	}
 
@@ -80,50 +105,268 @@ func createScheduledNotification(ctx context.Context, request events.APIGatewayP
 	if err := shared.ValidateCronExpression(reqBody.Schedule.Expression); err != nil {
 		return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid cron expression: %v", err), nil), nil
 	}
-
-	// Generate schedule ID
-	scheduleID := uuid.New().String()
-
-	// Create notification request payload for direct SQS delivery
-	notificationRequest := shared.NotificationRequest{
-		ID:         scheduleID,
-		Type:       reqBody.Type,
-		Recipients: []string{userContext.UserID}, // User is the recipient
-		Variables:  reqBody.Variables,
+	if err := shared.ValidateExpiry("endDate", reqBody.Schedule.EndDate); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
 	}
-
-	// Create EventBridge Schedule (direct to SQS)
-	if err := shared.CreateEventBridgeSchedule(ctx, scheduleID, reqBody.Schedule.Expression, notificationRequest); err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to create EventBridge schedule")
-		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create schedule", nil), nil
+	if err := shared.ValidateScheduleTimezone(reqBody.Schedule.Timezone); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	if err := reqBody.Schedule.ValidateMaxOccurrences(0); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	tags, err := shared.NormalizeTags(reqBody.Tags)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	recipients, errResponse, ok := validateScheduleAudience(ctx, reqBody.Recipients, reqBody.Segment, userContext)
+	if !ok {
+		return errResponse, nil
+	}
+	if reqBody.Schedule.Timezone == "" {
+		reqBody.Schedule.Timezone = preferredTimezone(ctx, userContext.UserID)
 	}
 
-	// Create scheduled notification
+	// Generate schedule ID
 	notification := shared.ScheduledNotification{
-		ScheduleID: scheduleID,
+		ScheduleID: uuid.New().String(),
 		UserID:     userContext.UserID,
 		Type:       reqBody.Type,
 		Variables:  reqBody.Variables,
 		Schedule:   &reqBody.Schedule,
 		Status:     shared.StatusActive,
+		DryRun:     reqBody.DryRun,
+		Tags:       tags,
+		Recipients: recipients,
+		Segment:    reqBody.Segment,
+	}
+	if errResponse, ok := createSchedule(ctx, notification); !ok {
+		return errResponse, nil
+	}
+
+	shared.LogInfo(ctx).Str("scheduleID", notification.ScheduleID).Str("userID", userContext.UserID).Int("recipients", len(recipients)).Str("segment", reqBody.Segment).Msg("Scheduled notification created successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, notification), nil
+}
+
+// createSchedule creates the EventBridge schedule of a new scheduled notification, sending its request straight
+// to the queue, and stores it, unless the user holds as many schedules as their limit allows. The EventBridge
+// schedule is removed again and the user's slot given back when the notification cannot be stored
+func createSchedule(ctx context.Context, notification shared.ScheduledNotification) (shared.APIResponse, bool) {
+	scheduleID := notification.ScheduleID
+
+	if errResponse, ok := claimScheduleSlot(ctx, notification.UserID); !ok {
+		return errResponse, false
+	}
+
+	// Create EventBridge Schedule (direct to SQS)
+	schedule := notification.Schedule
+	if err := shared.CreateEventBridgeSchedule(ctx, notification.UserID, scheduleID, schedule.Expression, schedule.Timezone, schedule.EndDate, scheduleRequest(notification)); err != nil {
+		releaseScheduleSlot(ctx, notification.UserID)
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to create EventBridge schedule")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create schedule", nil), false
 	}
 
 	if err := db.CreateScheduledNotification(ctx, notification); err != nil {
 		// Clean up EventBridge schedule if database creation fails
-		shared.DeleteEventBridgeSchedule(ctx, scheduleID)
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to create scheduled notification")
-		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create scheduled notification", nil), nil
+		shared.DeleteEventBridgeSchedule(ctx, notification.UserID, scheduleID)
+		releaseScheduleSlot(ctx, notification.UserID)
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to create scheduled notification")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create scheduled notification", nil), false
+	}
+	return shared.APIResponse{}, true
+}
+
+// claimScheduleSlot takes one of the user's schedule slots. Each user holds a limited number of active and
+// paused schedules, so one user cannot exhaust the account's EventBridge quota; cancelled schedules have no
+// EventBridge schedule and do not count. The slot is claimed with a conditional counter, so concurrent creates
+// cannot go over the limit
+func claimScheduleSlot(ctx context.Context, userID string) (shared.APIResponse, bool) {
+	limit := db.GetScheduleSettings(ctx).LimitFor(userID)
+	count, ok, err := db.ClaimScheduleSlot(ctx, userID, limit)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("userID", userID).Msg("Failed to claim schedule slot")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create schedule", nil), false
+	}
+	if !ok {
+		shared.LogWarn(ctx).Str("userID", userID).Int("count", count).Int("limit", limit).Msg("Schedule quota reached")
+		return shared.CreateErrorResponse(http.StatusTooManyRequests, fmt.Sprintf("Schedule limit reached (%d of %d), delete or cancel schedules first", count, limit),
+			map[string]int{"count": count, "limit": limit}), false
+	}
+	return shared.APIResponse{}, true
+}
+
+// releaseScheduleSlot gives back one of the user's schedule slots. A failure only leaves the user a slot short
+// and is logged
+func releaseScheduleSlot(ctx context.Context, userID string) {
+	if err := db.ReleaseScheduleSlot(ctx, userID); err != nil {
+		shared.LogError(ctx).Err(err).Str("userID", userID).Msg("Failed to release schedule slot")
 	}
+}
 
-	shared.LogInfo().Str("scheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification created successfully")
+// scheduleRequest builds the notification request a schedule sends straight to the queue each time it fires.
+// It notifies the schedule's recipients and segment, the owner when it has neither
+func scheduleRequest(notification shared.ScheduledNotification) shared.NotificationRequest {
+	recipients := notification.Recipients
+	if len(recipients) == 0 && notification.Segment == "" {
+		recipients = []string{notification.UserID}
+	}
+	return shared.NotificationRequest{
+		ID:         notification.ScheduleID,
+		Type:       notification.Type,
+		Recipients: recipients,
+		Segment:    notification.Segment,
+		Variables:  notification.Variables,
+		Producer:   &shared.Producer{Kind: shared.ProducerSchedule, ID: notification.ScheduleID},
+		DryRun:     notification.DryRun,
+		Tags:       notification.Tags,
+	}
+}
+
+// validateScheduleAudience checks the recipients and segment of a new schedule and returns the recipients
+// trimmed and without repeats. Only super admins schedule notifications for others, such as operational
+// reports for a team, and the teams, on-call rotations and segment they reference must exist
+func validateScheduleAudience(ctx context.Context, recipients []string, segmentID string, userContext shared.UserContext) ([]string, shared.APIResponse, bool) {
+	if len(recipients) == 0 && segmentID == "" {
+		return nil, shared.APIResponse{}, true
+	}
+	if userContext.Role != shared.RoleSuperAdmin {
+		return nil, shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can schedule notifications for other recipients", nil), false
+	}
+
+	normalized := make([]string, 0, len(recipients))
+	for _, recipientID := range recipients {
+		recipientID = strings.TrimSpace(recipientID)
+		if recipientID == "" {
+			return nil, shared.CreateErrorResponse(http.StatusBadRequest, "Recipients cannot be empty", nil), false
+		}
+		if !slices.Contains(normalized, recipientID) {
+			normalized = append(normalized, recipientID)
+		}
+	}
+	if len(normalized) > MaxScheduleRecipients {
+		return nil, shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("At most %d recipients are allowed, use a segment for larger audiences", MaxScheduleRecipients), nil), false
+	}
+
+	for _, recipientID := range normalized {
+		if rotationID, ok := strings.CutPrefix(recipientID, shared.RecipientPrefixOnCall); ok {
+			rotation, err := db.GetOnCallRotation(ctx, rotationID)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Str("rotationId", rotationID).Msg("Failed to get on-call rotation")
+				return nil, shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve on-call rotation", nil), false
+			}
+			if rotation.RotationID == "" {
+				return nil, shared.CreateErrorResponse(http.StatusBadRequest, "On-call rotation not found: "+rotationID, nil), false
+			}
+		}
+		if teamID, ok := strings.CutPrefix(recipientID, shared.RecipientPrefixTeam); ok {
+			team, err := db.GetTeam(ctx, teamID)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Str("teamId", teamID).Msg("Failed to get team")
+				return nil, shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve team", nil), false
+			}
+			if team.TeamID == "" {
+				return nil, shared.CreateErrorResponse(http.StatusBadRequest, "Team not found: "+teamID, nil), false
+			}
+		}
+	}
+
+	if segmentID != "" {
+		segment, err := db.GetSegment(ctx, segmentID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("segmentId", segmentID).Msg("Failed to get segment")
+			return nil, shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve segment", nil), false
+		}
+		if segment.SegmentID == "" {
+			return nil, shared.CreateErrorResponse(http.StatusBadRequest, "Segment not found: "+segmentID, nil), false
+		}
+	}
+	return normalized, shared.APIResponse{}, true
+}
+
+// cloneScheduledNotification copies one of the caller's schedules under a new schedule ID: its type, variables,
+// expression, timezone, limits, dry-run flag, tags, recipients and segment. The clone starts active with no
+// occurrences, whatever the state of the original
+func cloneScheduledNotification(ctx context.Context, request events.APIGatewayProxyRequest, scheduleID string, userContext shared.UserContext) (shared.APIResponse, error) {
+	var reqBody shared.CloneScheduleRequest
+	if request.Body != "" {
+		if err := shared.ParseRequestBody(request.Body, &reqBody); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+		}
+	}
+
+	source, err := db.GetScheduledNotification(ctx, scheduleID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to get scheduled notification")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve scheduled notification", nil), nil
+	}
+	if source.ScheduleID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Scheduled notification not found", nil), nil
+	}
+	if source.UserID != userContext.UserID {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Access denied", nil), nil
+	}
+	if source.Schedule == nil || source.Schedule.Expression == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Schedule configuration is required", nil), nil
+	}
+	// A schedule past its end date would never fire again
+	if err := shared.ValidateExpiry("endDate", source.Schedule.EndDate); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	// The audience is checked against the caller's current role, a user no longer super admin cannot clone
+	// schedules they made for others
+	recipients, errResponse, ok := validateScheduleAudience(ctx, source.Recipients, source.Segment, userContext)
+	if !ok {
+		return errResponse, nil
+	}
+
+	variables := maps.Clone(source.Variables)
+	if len(reqBody.Variables) > 0 {
+		if variables == nil {
+			variables = make(map[string]any, len(reqBody.Variables))
+		}
+		maps.Copy(variables, reqBody.Variables)
+	}
+
+	config := *source.Schedule
+	notification := shared.ScheduledNotification{
+		ScheduleID: uuid.New().String(),
+		UserID:     source.UserID,
+		Type:       source.Type,
+		Variables:  variables,
+		Schedule:   &config,
+		Status:     shared.StatusActive,
+		DryRun:     source.DryRun,
+		Tags:       source.Tags,
+		Recipients: recipients,
+		Segment:    source.Segment,
+	}
+	if errResponse, ok := createSchedule(ctx, notification); !ok {
+		return errResponse, nil
+	}
+
+	shared.LogInfo(ctx).Str("scheduleID", notification.ScheduleID).Str("sourceScheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification cloned successfully")
 
 	return shared.CreateAPIResponse(http.StatusCreated, notification), nil
 }
 
+// preferredTimezone returns the timezone of the user's preferences, UTC when they have none or it cannot be read
+func preferredTimezone(ctx context.Context, userID string) string {
+	preferences, err := db.GetUserPreferences(ctx, userID)
+	if err != nil {
+		shared.LogWarn(ctx).Err(err).Str("userID", userID).Msg("Failed to get user preferences, scheduling in UTC")
+		return "UTC"
+	}
+	if preferences.Timezone == "" || shared.ValidateScheduleTimezone(preferences.Timezone) != nil {
+		return "UTC"
+	}
+	return preferences.Timezone
+}
+
 func getScheduledNotification(ctx context.Context, scheduleID string, userContext shared.UserContext) (shared.APIResponse, error) {
 	notification, err := db.GetScheduledNotification(ctx, scheduleID)
 	if err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to get scheduled notification")
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to get scheduled notification")
 		return shared.CreateErrorResponse(http.StatusNotFound, "Scheduled notification not found", nil), nil
 	}
 
@@ -145,9 +388,15 @@ func listUserScheduledNotifications(ctx context.Context, request events.APIGatew
 
 	nextToken := request.QueryStringParameters["nextToken"]
 
-	notifications, nextTokenResult, err := db.GetUserScheduledNotifications(ctx, userContext.UserID, limit, nextToken)
+	// Only schedules carrying every tag of ?tag=team:payments,env:prod are listed
+	tags, err := shared.ParseTagFilter(request.QueryStringParameters["tag"])
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	notifications, nextTokenResult, err := db.GetUserScheduledNotifications(ctx, userContext.UserID, tags, limit, nextToken)
 	if err != nil {
-		shared.LogError().Err(err).Str("userID", userContext.UserID).Msg("Failed to list user scheduled notifications")
+		shared.LogError(ctx).Err(err).Str("userID", userContext.UserID).Msg("Failed to list user scheduled notifications")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to list scheduled notifications", nil), nil
 	}
 
@@ -164,7 +413,7 @@ func updateScheduledNotification(ctx context.Context, request events.APIGatewayP
 	// Get existing notification
 	existingNotification, err := db.GetScheduledNotification(ctx, scheduleID)
 	if err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to get existing scheduled notification")
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to get existing scheduled notification")
 		return shared.CreateErrorResponse(http.StatusNotFound, "Scheduled notification not found", nil), nil
 	}
 
@@ -173,19 +422,20 @@ func updateScheduledNotification(ctx context.Context, request events.APIGatewayP
 		return shared.CreateErrorResponse(http.StatusForbidden, "Access denied", nil), nil
 	}
 
-	var reqBody struct {
-		Variables map[string]any         `json:"variables,omitempty"`
-		Schedule  *shared.ScheduleConfig `json:"schedule,omitempty"`
-		Status    string                 `json:"status,omitempty"`
-	}
+	var reqBody shared.UpdateScheduleRequest
 
 	if err := json.Unmarshal([]byte(request.Body), &reqBody); err != nil {
-		shared.LogError().Err(err).Msg("Failed to unmarshal request body")
+		shared.LogError(ctx).Err(err).Msg("Failed to unmarshal request body")
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
 	}
 
+	// The dry-run flag is always written, it is kept unless the request changes it
 	updateNotification := shared.ScheduledNotification{
 		ScheduleID: scheduleID,
+		DryRun:     existingNotification.DryRun,
+	}
+	if reqBody.DryRun != nil {
+		updateNotification.DryRun = *reqBody.DryRun
 	}
 
 	// Update fields if provided
@@ -196,10 +446,25 @@ func updateScheduledNotification(ctx context.Context, request events.APIGatewayP
 		if reqBody.Status != shared.StatusActive && reqBody.Status != shared.StatusPaused && reqBody.Status != shared.StatusCancelled {
 			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid status", nil), nil
 		}
-		updateNotification.Status = reqBody.Status
+		// A cancelled schedule has no EventBridge schedule and gave back its slot, a clone takes its place
+		if existingNotification.Status == shared.StatusCancelled && reqBody.Status != shared.StatusCancelled {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "A cancelled schedule cannot be resumed, clone it instead", nil), nil
+		}
+		if reqBody.Status != existingNotification.Status {
+			updateNotification.Status = reqBody.Status
+		}
+	}
+	cancelling := reqBody.Status == shared.StatusCancelled && existingNotification.Status != shared.StatusCancelled
+	tags := existingNotification.Tags
+	if reqBody.Tags != nil {
+		if tags, err = shared.NormalizeTags(reqBody.Tags); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		updateNotification.Tags = tags
 	}
 
 	// Handle schedule updates
+	schedule := existingNotification.Schedule
 	if reqBody.Schedule != nil {
 		if reqBody.Schedule.Type != shared.ScheduleTypeCron {
 			return shared.CreateErrorResponse(http.StatusBadRequest, "Only cron schedule type is supported", nil), nil
@@ -207,6 +472,32 @@ func updateScheduledNotification(ctx context.Context, request events.APIGatewayP
 		if err := shared.ValidateCronExpression(reqBody.Schedule.Expression); err != nil {
 			return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid cron expression: %v", err), nil), nil
 		}
+		if err := shared.ValidateExpiry("endDate", reqBody.Schedule.EndDate); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		if err := shared.ValidateScheduleTimezone(reqBody.Schedule.Timezone); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		if err := reqBody.Schedule.ValidateMaxOccurrences(existingNotification.Occurrences); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		// A new expression keeps the schedule's timezone unless it names another
+		if reqBody.Schedule.Timezone == "" && existingNotification.Schedule != nil {
+			reqBody.Schedule.Timezone = existingNotification.Schedule.Timezone
+		}
+		if reqBody.Schedule.Timezone == "" {
+			reqBody.Schedule.Timezone = preferredTimezone(ctx, existingNotification.UserID)
+		}
+		schedule = reqBody.Schedule
+		updateNotification.Schedule = reqBody.Schedule
+	}
+
+	// The schedule's target carries the dry-run flag and the tags, so changing them rewrites the target like a new expression
+	retargeted := reqBody.Schedule != nil || updateNotification.DryRun != existingNotification.DryRun || !slices.Equal(tags, existingNotification.Tags)
+	if retargeted && !cancelling && existingNotification.Status != shared.StatusCancelled {
+		if schedule == nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Schedule configuration is required", nil), nil
+		}
 
 		// Create updated notification request payload
 		updatedVariables := existingNotification.Variables
@@ -214,54 +505,150 @@ func updateScheduledNotification(ctx context.Context, request events.APIGatewayP
 			updatedVariables = reqBody.Variables
 		}
 
-		updatedNotificationRequest := shared.NotificationRequest{
-			ID:         scheduleID,
-			Type:       existingNotification.Type,
-			Recipients: []string{existingNotification.UserID},
-			Variables:  updatedVariables,
-		}
+		target := existingNotification
+		target.Variables = updatedVariables
+		target.DryRun = updateNotification.DryRun
+		target.Tags = tags
+		updatedNotificationRequest := scheduleRequest(target)
 
 		// Update EventBridge schedule
-		if err := shared.UpdateEventBridgeSchedule(ctx, scheduleID, reqBody.Schedule.Expression, updatedNotificationRequest); err != nil {
-			shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to update EventBridge schedule")
+		if err := shared.UpdateEventBridgeSchedule(ctx, existingNotification.UserID, scheduleID, schedule.Expression, schedule.Timezone, schedule.EndDate, updatedNotificationRequest); err != nil {
+			shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to update EventBridge schedule")
 			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update schedule", nil), nil
 		}
-
-		updateNotification.Schedule = reqBody.Schedule
 	}
 
-	// Handle status updates (pause/resume schedules)
+	// Handle status updates (pause/resume schedules). Rewriting the target enables the schedule, a paused
+	// one is paused again
+	if reqBody.Status == "" && retargeted && existingNotification.Status == shared.StatusPaused {
+		reqBody.Status = shared.StatusPaused
+	}
 	if reqBody.Status != "" {
 		if reqBody.Status == shared.StatusPaused {
-			if err := shared.PauseEventBridgeSchedule(ctx, scheduleID); err != nil {
-				shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to pause EventBridge schedule")
+			if err := shared.PauseEventBridgeSchedule(ctx, existingNotification.UserID, scheduleID); err != nil {
+				shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to pause EventBridge schedule")
 				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to pause schedule", nil), nil
 			}
 		} else if reqBody.Status == shared.StatusActive {
-			if err := shared.ResumeEventBridgeSchedule(ctx, scheduleID); err != nil {
-				shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to resume EventBridge schedule")
+			if err := shared.ResumeEventBridgeSchedule(ctx, existingNotification.UserID, scheduleID); err != nil {
+				shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to resume EventBridge schedule")
 				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to resume schedule", nil), nil
 			}
+		} else if cancelling {
+			// Like an exhausted schedule, a cancelled one stops firing and frees its EventBridge schedule
+			if err := shared.DeleteEventBridgeSchedule(ctx, existingNotification.UserID, scheduleID); err != nil && !shared.IsScheduleNotFound(err) {
+				shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete EventBridge schedule")
+				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to cancel schedule", nil), nil
+			}
 		}
 	}
 
 	// Update notification in database
 	updatedNotification, err := db.UpdateScheduledNotification(ctx, updateNotification)
+	if services.IsConditionalCheckFailed(err) {
+		// Deleted meanwhile, or cancelled by reaching its maximum occurrences
+		return shared.CreateErrorResponse(http.StatusConflict, "Scheduled notification was cancelled or deleted meanwhile", nil), nil
+	}
 	if err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to update scheduled notification")
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to update scheduled notification")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update scheduled notification", nil), nil
 	}
+	if cancelling {
+		releaseScheduleSlot(ctx, existingNotification.UserID)
+	}
 
-	shared.LogInfo().Str("scheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification updated successfully")
+	shared.LogInfo(ctx).Str("scheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification updated successfully")
 
 	return shared.CreateAPIResponse(http.StatusOK, updatedNotification), nil
 }
 
+// getNextRuns returns the next firing times of a schedule, or of the expression and timezone in the query
+// string when no schedule is named, so expressions can be checked before a schedule is created
+func getNextRuns(ctx context.Context, request events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	count := DefaultNextRuns
+	if countStr := request.QueryStringParameters["count"]; countStr != "" {
+		parsed, err := strconv.Atoi(countStr)
+		if err != nil || parsed <= 0 || parsed > MaxNextRuns {
+			return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("count must be between 1 and %d", MaxNextRuns), nil), nil
+		}
+		count = parsed
+	}
+
+	now := shared.GetCurrentTime()
+	start := now
+	var config shared.ScheduleConfig
+	var occurrences int
+	cancelled := false
+	scheduleID := request.PathParameters["scheduleId"]
+	if scheduleID != "" {
+		notification, err := db.GetScheduledNotification(ctx, scheduleID)
+		if err != nil || notification.ScheduleID == "" {
+			return shared.CreateErrorResponse(http.StatusNotFound, "Scheduled notification not found", nil), nil
+		}
+		if notification.UserID != userContext.UserID {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Access denied", nil), nil
+		}
+		if notification.Schedule != nil {
+			config = *notification.Schedule
+		}
+		if notification.CreatedAt != nil {
+			start = *notification.CreatedAt
+		}
+		occurrences = notification.Occurrences
+		cancelled = notification.Status == shared.StatusCancelled
+	} else {
+		config.Expression = request.QueryStringParameters["expression"]
+		config.Timezone = request.QueryStringParameters["timezone"]
+		if config.Expression == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "expression is required", nil), nil
+		}
+		if err := shared.ValidateScheduleTimezone(config.Timezone); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		if config.Timezone == "" {
+			config.Timezone = preferredTimezone(ctx, userContext.UserID)
+		}
+	}
+	if config.Timezone == "" {
+		config.Timezone = "UTC"
+	}
+
+	expression, err := shared.ParseScheduleExpression(config.Expression)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid expression: %v", err), nil), nil
+	}
+	location, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	// Runs past the end date or the occurrence limit, and those of a cancelled schedule, never happen
+	if config.MaxOccurrences > 0 {
+		count = min(count, max(config.MaxOccurrences-occurrences, 0))
+	}
+	runs := make([]time.Time, 0, count)
+	if !cancelled && count > 0 {
+		for _, run := range expression.NextRuns(start, now, location, count) {
+			if config.EndDate != nil && run.After(*config.EndDate) {
+				break
+			}
+			runs = append(runs, run)
+		}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.ScheduleNextRuns{
+		ScheduleID: scheduleID,
+		Expression: config.Expression,
+		Timezone:   config.Timezone,
+		Runs:       runs,
+	}), nil
+}
+
 func deleteScheduledNotification(ctx context.Context, scheduleID string, userContext shared.UserContext) (shared.APIResponse, error) {
 	// Get existing notification
 	existingNotification, err := db.GetScheduledNotification(ctx, scheduleID)
 	if err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to get existing scheduled notification")
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to get existing scheduled notification")
 		return shared.CreateErrorResponse(http.StatusNotFound, "Scheduled notification not found", nil), nil
 	}
 
@@ -271,18 +658,22 @@ func deleteScheduledNotification(ctx context.Context, scheduleID string, userCon
 	}
 
 	// Delete EventBridge schedule
-	if err := shared.DeleteEventBridgeSchedule(ctx, scheduleID); err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete EventBridge schedule")
+	if err := shared.DeleteEventBridgeSchedule(ctx, existingNotification.UserID, scheduleID); err != nil {
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete EventBridge schedule")
 		// Continue with deletion even if EventBridge fails
 	}
 
 	// Delete from database
 	if err := db.DeleteScheduledNotification(ctx, scheduleID); err != nil {
-		shared.LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete scheduled notification")
+		shared.LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete scheduled notification")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete scheduled notification", nil), nil
 	}
+	// A cancelled schedule gave back its slot when it was cancelled
+	if existingNotification.Status != shared.StatusCancelled {
+		releaseScheduleSlot(ctx, existingNotification.UserID)
+	}
 
-	shared.LogInfo().Str("scheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification deleted successfully")
+	shared.LogInfo(ctx).Str("scheduleID", scheduleID).Str("userID", userContext.UserID).Msg("Scheduled notification deleted successfully")
 
 	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Scheduled notification deleted successfully"}), nil
 }
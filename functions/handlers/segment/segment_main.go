@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	SegmentIDPathParam  = "segmentId"
+	LimitQueryParam     = "limit"
+	NextTokenQueryParam = "nextToken"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Segment handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Segments select users across the whole service, only super admins can see or manage them
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage segments", nil), nil
+	}
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createSegment(ctx, event)
+	case http.MethodPut:
+		return updateSegment(ctx, event)
+	case http.MethodGet:
+		if event.PathParameters != nil && event.PathParameters[SegmentIDPathParam] != "" {
+			return getSegment(ctx, event)
+		}
+		return listSegments(ctx, event)
+	case http.MethodDelete:
+		return deleteSegment(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type SegmentRequest struct {
+	Name     string                 `json:"name,omitempty"`
+	Criteria shared.SegmentCriteria `json:"criteria"`
+}
+
+func createSegment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	var request SegmentRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Name is required", nil), nil
+	}
+	if err := request.Criteria.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid criteria: "+err.Error(), nil), nil
+	}
+
+	segment := shared.Segment{
+		SegmentID: uuid.New().String(),
+		Name:      request.Name,
+		Criteria:  request.Criteria,
+	}
+
+	err = db.CreateSegment(ctx, segment)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to create segment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create segment", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("segmentId", segment.SegmentID).Msg("Segment created successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, segment), nil
+}
+
+func updateSegment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	segmentID := event.PathParameters[SegmentIDPathParam]
+	if segmentID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Segment ID is required", nil), nil
+	}
+
+	var request SegmentRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" && request.Criteria.IsEmpty() {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	// Criteria are replaced as a whole
+	if !request.Criteria.IsEmpty() {
+		if err := request.Criteria.Validate(); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid criteria: "+err.Error(), nil), nil
+		}
+	}
+
+	existing, err := db.GetSegment(ctx, segmentID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing segment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve segment", nil), nil
+	}
+	if existing.SegmentID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Segment not found", nil), nil
+	}
+
+	updatedSegment, err := db.UpdateSegment(ctx, shared.Segment{
+		SegmentID: segmentID,
+		Name:      request.Name,
+		Criteria:  request.Criteria,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to update segment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update segment", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("segmentId", segmentID).Msg("Segment updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, updatedSegment), nil
+}
+
+func getSegment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	segmentID := event.PathParameters[SegmentIDPathParam]
+
+	segment, err := db.GetSegment(ctx, segmentID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get segment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve segment", nil), nil
+	}
+	if segment.SegmentID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Segment not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, segment), nil
+}
+
+func listSegments(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	segments, nextKey, err := db.GetSegmentsList(ctx, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get segments list")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve segments", nil), nil
+	}
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     segments,
+		Count:     len(segments),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func deleteSegment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	segmentID := event.PathParameters[SegmentIDPathParam]
+	if segmentID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Segment ID is required", nil), nil
+	}
+
+	err := db.DeleteSegment(ctx, segmentID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete segment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete segment", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("segmentId", segmentID).Msg("Segment deleted successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Segment deleted successfully"}), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("segment", handler))
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	SequenceIDPathParam = "sequenceId"
+	UserIDPathParam     = "userId"
+	LimitQueryParam     = "limit"
+	NextTokenQueryParam = "nextToken"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Sequence handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Sequences send notifications to any user over weeks, only super admins can manage them
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage sequences", nil), nil
+	}
+
+	switch {
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}/enrollments/{userId}/skip"):
+		return skipEnrollmentStep(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}/enrollments/{userId}"):
+		return getEnrollment(ctx, event)
+	case event.HTTPMethod == http.MethodDelete && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}/enrollments/{userId}"):
+		return cancelEnrollment(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}/enrollments"):
+		return startEnrollment(ctx, event)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}"):
+		return getSequence(ctx, event)
+	case event.HTTPMethod == http.MethodPut && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}"):
+		return updateSequence(ctx, event)
+	case event.HTTPMethod == http.MethodDelete && strings.HasSuffix(event.Resource, "/sequences/{sequenceId}"):
+		return deleteSequence(ctx, event)
+	case event.HTTPMethod == http.MethodPost && strings.HasSuffix(event.Resource, "/sequences"):
+		return createSequence(ctx, event, userContext)
+	case event.HTTPMethod == http.MethodGet && strings.HasSuffix(event.Resource, "/sequences"):
+		return listSequences(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type SequenceRequest struct {
+	Name        string                `json:"name,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Steps       []shared.SequenceStep `json:"steps,omitempty"`
+}
+
+type EnrollmentRequest struct {
+	UserID    string         `json:"userId"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+func createSequence(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request SequenceRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Name is required", nil), nil
+	}
+
+	sequence := shared.Sequence{
+		SequenceID:  uuid.New().String(),
+		Name:        request.Name,
+		Description: request.Description,
+		Steps:       request.Steps,
+		CreatedBy:   userContext.UserID,
+	}
+	if err := sequence.Validate(); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid steps: "+err.Error(), nil), nil
+	}
+
+	err = db.CreateSequence(ctx, sequence)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to create sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create sequence", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", sequence.SequenceID).Msg("Sequence created successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, sequence), nil
+}
+
+func updateSequence(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	sequenceID := event.PathParameters[SequenceIDPathParam]
+	if sequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Sequence ID is required", nil), nil
+	}
+
+	var request SequenceRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" && request.Description == "" && len(request.Steps) == 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	// Steps are replaced as a whole
+	if len(request.Steps) > 0 {
+		if err := (shared.Sequence{Steps: request.Steps}).Validate(); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid steps: "+err.Error(), nil), nil
+		}
+	}
+
+	existing, err := db.GetSequence(ctx, sequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequence", nil), nil
+	}
+	if existing.SequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Sequence not found", nil), nil
+	}
+
+	updatedSequence, err := db.UpdateSequence(ctx, shared.Sequence{
+		SequenceID:  sequenceID,
+		Name:        request.Name,
+		Description: request.Description,
+		Steps:       request.Steps,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to update sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update sequence", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", sequenceID).Msg("Sequence updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, updatedSequence), nil
+}
+
+func getSequence(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	sequenceID := event.PathParameters[SequenceIDPathParam]
+
+	sequence, err := db.GetSequence(ctx, sequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequence", nil), nil
+	}
+	if sequence.SequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Sequence not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, sequence), nil
+}
+
+func listSequences(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	sequences, nextKey, err := db.GetSequencesList(ctx, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get sequences list")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequences", nil), nil
+	}
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     sequences,
+		Count:     len(sequences),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+// deleteSequence removes the definition, active enrollments end when their next step finds it gone
+func deleteSequence(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	sequenceID := event.PathParameters[SequenceIDPathParam]
+	if sequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Sequence ID is required", nil), nil
+	}
+
+	err := db.DeleteSequence(ctx, sequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete sequence", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", sequenceID).Msg("Sequence deleted successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Sequence deleted successfully"}), nil
+}
+
+// startEnrollment enrolls a user in the sequence, its first step is sent or scheduled right away
+func startEnrollment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	sequenceID := event.PathParameters[SequenceIDPathParam]
+
+	var request EnrollmentRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if request.UserID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "User ID is required", nil), nil
+	}
+
+	sequence, err := db.GetSequence(ctx, sequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequence", nil), nil
+	}
+	if sequence.SequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Sequence not found", nil), nil
+	}
+
+	user, err := db.GetUserByID(ctx, request.UserID)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+	}
+	if user == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+	}
+
+	enrollment, err := db.StartSequenceEnrollment(ctx, sequence, request.UserID, request.Variables)
+	if errors.Is(err, db.ErrEnrollmentActive) {
+		return shared.CreateErrorResponse(http.StatusConflict, "User is already enrolled in the sequence", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to start sequence enrollment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to start sequence", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", sequenceID).Str("targetUserId", request.UserID).Str("runId", enrollment.RunID).Msg("Sequence enrollment started")
+
+	return shared.CreateAPIResponse(http.StatusCreated, enrollment), nil
+}
+
+func getEnrollment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	enrollment, errResponse := loadEnrollment(ctx, event)
+	if errResponse != nil {
+		return *errResponse, nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, enrollment), nil
+}
+
+// cancelEnrollment ends an active enrollment, its pending step is not sent
+func cancelEnrollment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	enrollment, errResponse := loadEnrollment(ctx, event)
+	if errResponse != nil {
+		return *errResponse, nil
+	}
+	if enrollment.Status != shared.SequenceEnrollmentActive {
+		return shared.CreateErrorResponse(http.StatusConflict, "Sequence enrollment is not active", nil), nil
+	}
+
+	cancelled, err := db.CancelSequenceEnrollment(ctx, enrollment)
+	if errors.Is(err, db.ErrEnrollmentChanged) {
+		return shared.CreateErrorResponse(http.StatusConflict, "Sequence enrollment changed, try again", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to cancel sequence enrollment")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to cancel sequence enrollment", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", enrollment.SequenceID).Str("targetUserId", enrollment.UserID).Msg("Sequence enrollment cancelled")
+
+	return shared.CreateAPIResponse(http.StatusOK, cancelled), nil
+}
+
+// skipEnrollmentStep drops the pending step of an active enrollment and moves on to the next one
+func skipEnrollmentStep(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	enrollment, errResponse := loadEnrollment(ctx, event)
+	if errResponse != nil {
+		return *errResponse, nil
+	}
+	if enrollment.Status != shared.SequenceEnrollmentActive {
+		return shared.CreateErrorResponse(http.StatusConflict, "Sequence enrollment is not active", nil), nil
+	}
+
+	sequence, err := db.GetSequence(ctx, enrollment.SequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get sequence")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequence", nil), nil
+	}
+	if sequence.SequenceID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Sequence not found", nil), nil
+	}
+
+	// The step's schedule goes first, a step already queued is dropped once the enrollment moved on
+	db.DeleteSequenceStepSchedule(ctx, enrollment)
+	advanced, err := db.AdvanceSequenceEnrollment(ctx, sequence, enrollment, shared.SequenceStepSkipped, "")
+	if errors.Is(err, db.ErrEnrollmentChanged) {
+		return shared.CreateErrorResponse(http.StatusConflict, "Sequence enrollment changed, try again", nil), nil
+	}
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to skip sequence step")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to skip sequence step", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("sequenceId", enrollment.SequenceID).Str("targetUserId", enrollment.UserID).Int("step", enrollment.CurrentStep).Msg("Sequence step skipped")
+
+	return shared.CreateAPIResponse(http.StatusOK, advanced), nil
+}
+
+// loadEnrollment returns the enrollment addressed by the path, or the error response to send
+func loadEnrollment(ctx context.Context, event events.APIGatewayProxyRequest) (shared.SequenceEnrollment, *shared.APIResponse) {
+	sequenceID := event.PathParameters[SequenceIDPathParam]
+	userID := event.PathParameters[UserIDPathParam]
+
+	enrollment, err := db.GetSequenceEnrollment(ctx, userID, sequenceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get sequence enrollment")
+		response := shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve sequence enrollment", nil)
+		return shared.SequenceEnrollment{}, &response
+	}
+	if enrollment.UserID == "" {
+		response := shared.CreateErrorResponse(http.StatusNotFound, "Sequence enrollment not found", nil)
+		return shared.SequenceEnrollment{}, &response
+	}
+	return enrollment, nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("sequence", handler))
+}
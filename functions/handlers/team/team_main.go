@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"notification-service/functions/db"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+)
+
+const (
+	TeamIDPathParam     = "teamId"
+	LimitQueryParam     = "limit"
+	NextTokenQueryParam = "nextToken"
+)
+
+func init() {
+	shared.InitAWS()
+}
+
+func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Team handler invoked")
+
+	// Extract user info from context
+	userContext, err := shared.GetUserContext(event.RequestContext)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
+		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
+	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// Anyone can view teams, only super admins can manage them
+	if event.HTTPMethod != http.MethodGet && userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can manage teams", nil), nil
+	}
+
+	switch event.HTTPMethod {
+	case http.MethodPost:
+		return createTeam(ctx, event)
+	case http.MethodPut:
+		return updateTeam(ctx, event)
+	case http.MethodGet:
+		if event.PathParameters != nil && event.PathParameters[TeamIDPathParam] != "" {
+			return getTeam(ctx, event)
+		}
+		return listTeams(ctx, event)
+	case http.MethodDelete:
+		return deleteTeam(ctx, event)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+type TeamRequest struct {
+	Name            string                           `json:"name,omitempty"`
+	Members         []string                         `json:"members,omitempty"`
+	Preferences     map[string]shared.PreferenceItem `json:"preferences,omitempty"`
+	SlackWebhookURL string                           `json:"slackWebhookUrl,omitempty"`
+	Policy          string                           `json:"policy,omitempty"`
+	RotationID      string                           `json:"rotationId,omitempty"`
+}
+
+// validateTeamPreferences checks notification types and channels of the shared preferences
+func validateTeamPreferences(preferences map[string]shared.PreferenceItem) shared.APIResponse {
+	for notificationType, prefItem := range preferences {
+		if !shared.ValidateNotificationType(notificationType) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid notification type: "+notificationType, nil)
+		}
+		for _, channel := range prefItem.Channels {
+			if !shared.ValidateChannel(channel) {
+				return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid channel: "+channel, nil)
+			}
+		}
+	}
+	return shared.APIResponse{}
+}
+
+// validateTeamWebhook checks that the team's Slack webhook, when set, is a Slack incoming webhook. Deliveries
+// post to it, so it must not point anywhere else
+func validateTeamWebhook(webhookURL string) shared.APIResponse {
+	if webhookURL == "" {
+		return shared.APIResponse{}
+	}
+	if err := shared.ValidateSlackWebhookURL(webhookURL); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid Slack webhook URL: "+err.Error(), nil)
+	}
+	return shared.APIResponse{}
+}
+
+// maskTeam hides the team's Slack webhook in responses, showing only its last 4 characters. Any user can read teams
+func maskTeam(team shared.Team) shared.Team {
+	team.SlackWebhookURL = shared.MaskSecret(team.SlackWebhookURL)
+	return team
+}
+
+// validateTeamPolicy checks that the team has what its delivery policy needs
+func validateTeamPolicy(ctx context.Context, team shared.Team) shared.APIResponse {
+	if !shared.ValidateTeamPolicy(team.Policy) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid policy: "+team.Policy, nil)
+	}
+
+	switch team.Policy {
+	case shared.TeamPolicyAllMembers:
+		if len(team.Members) == 0 {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "At least one member is required for the all_members policy", nil)
+		}
+	case shared.TeamPolicyChannel:
+		if team.SlackWebhookURL == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Slack webhook URL is required for the channel policy", nil)
+		}
+	case shared.TeamPolicyOnCall:
+		if team.RotationID == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Rotation ID is required for the oncall policy", nil)
+		}
+		rotation, err := db.GetOnCallRotation(ctx, team.RotationID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get on-call rotation")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve on-call rotation", nil)
+		}
+		if rotation.RotationID == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "On-call rotation not found", nil)
+		}
+	}
+	return shared.APIResponse{}
+}
+
+func createTeam(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	var request TeamRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Name is required", nil), nil
+	}
+	if request.Policy == "" {
+		request.Policy = shared.TeamPolicyAllMembers
+	}
+	if errResponse := validateTeamPreferences(request.Preferences); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	if errResponse := validateTeamWebhook(request.SlackWebhookURL); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	team := shared.Team{
+		TeamID:          uuid.New().String(),
+		Name:            request.Name,
+		Members:         request.Members,
+		Preferences:     request.Preferences,
+		SlackWebhookURL: request.SlackWebhookURL,
+		Policy:          request.Policy,
+		RotationID:      request.RotationID,
+	}
+	if errResponse := validateTeamPolicy(ctx, team); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	err = db.CreateTeam(ctx, team)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to create team")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create team", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("teamId", team.TeamID).Msg("Team created successfully")
+
+	return shared.CreateAPIResponse(http.StatusCreated, maskTeam(team)), nil
+}
+
+func updateTeam(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	teamID := event.PathParameters[TeamIDPathParam]
+	if teamID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Team ID is required", nil), nil
+	}
+
+	var request TeamRequest
+	err := shared.ParseRequestBody(event.Body, &request)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	if request.Name == "" && request.Members == nil && request.Preferences == nil && request.SlackWebhookURL == "" && request.Policy == "" && request.RotationID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
+	}
+	if errResponse := validateTeamPreferences(request.Preferences); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+	if errResponse := validateTeamWebhook(request.SlackWebhookURL); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	existing, err := db.GetTeam(ctx, teamID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing team")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve team", nil), nil
+	}
+	if existing.TeamID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Team not found", nil), nil
+	}
+
+	// Validate the policy against the team as it will look after the update
+	merged := existing
+	if request.Members != nil {
+		merged.Members = request.Members
+	}
+	if request.SlackWebhookURL != "" {
+		merged.SlackWebhookURL = request.SlackWebhookURL
+	}
+	if request.Policy != "" {
+		merged.Policy = request.Policy
+	}
+	if request.RotationID != "" {
+		merged.RotationID = request.RotationID
+	}
+	if errResponse := validateTeamPolicy(ctx, merged); errResponse.StatusCode != 0 {
+		return errResponse, nil
+	}
+
+	updatedTeam, err := db.UpdateTeam(ctx, shared.Team{
+		TeamID:          teamID,
+		Name:            request.Name,
+		Members:         request.Members,
+		Preferences:     request.Preferences,
+		SlackWebhookURL: request.SlackWebhookURL,
+		Policy:          request.Policy,
+		RotationID:      request.RotationID,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to update team")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update team", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("teamId", teamID).Msg("Team updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, maskTeam(updatedTeam)), nil
+}
+
+func getTeam(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	teamID := event.PathParameters[TeamIDPathParam]
+
+	team, err := db.GetTeam(ctx, teamID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get team")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve team", nil), nil
+	}
+	if team.TeamID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Team not found", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, maskTeam(team)), nil
+}
+
+func listTeams(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	// Parse query parameters
+	limit := shared.GetLimit(event.QueryStringParameters[LimitQueryParam])
+
+	// Handle pagination
+	var startKey string
+	if nextToken, ok := event.QueryStringParameters[NextTokenQueryParam]; ok && nextToken != "" {
+		startKey = nextToken
+	}
+
+	teams, nextKey, err := db.GetTeamsList(ctx, limit, startKey)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get teams list")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve teams", nil), nil
+	}
+
+	for i := range teams {
+		teams[i] = maskTeam(teams[i])
+	}
+
+	// Create response
+	response := shared.PaginatedResponse{
+		Items:     teams,
+		Count:     len(teams),
+		NextToken: nextKey,
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+func deleteTeam(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
+	teamID := event.PathParameters[TeamIDPathParam]
+	if teamID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Team ID is required", nil), nil
+	}
+
+	err := db.DeleteTeam(ctx, teamID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete team")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete team", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("teamId", teamID).Msg("Team deleted successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Team deleted successfully"}), nil
+}
+
+func main() {
+	lambda.Start(shared.WrapAPIHandler("team", handler))
+}
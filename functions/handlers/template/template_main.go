@@ -1,12 +1,16 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"net/http"
 	"net/url"
 	"notification-service/functions/db"
 	"notification-service/functions/shared"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -17,6 +21,8 @@ const (
 	LimitQueryParam     = "limit"
 	NextTokenQueryParam = "nextToken"
 	ContextQueryParam   = "context"
+	SharedQueryParam    = "shared"
+	TagQueryParam       = "tag"
 )
 
 func init() {
@@ -33,26 +39,48 @@ func validateTemplateID(templateID string) (string, shared.APIResponse) {
 		return "", shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template ID encoding", nil)
 	}
 
-	notificationType, channel := shared.ParseTypeChannel(typeChannel)
+	notificationType, channel, lang := shared.ParseTemplateKey(typeChannel)
 	if notificationType == "" || channel == "" {
-		return "", shared.CreateErrorResponse(http.StatusBadRequest, "Template ID must be in format 'type#channel'", nil)
+		return "", shared.CreateErrorResponse(http.StatusBadRequest, "Template ID must be in format 'type#channel' or 'type#channel#language'", nil)
+	}
+
+	// Language variants are stored under the canonical language tag
+	if lang != "" {
+		canonical := shared.CanonicalLanguage(lang)
+		if canonical == "" {
+			return "", shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template language", nil)
+		}
+		typeChannel = shared.BuildTemplateKey(notificationType, channel, canonical)
 	}
 
 	return typeChannel, shared.APIResponse{}
 }
 
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
-	shared.LogInfo().Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Template handler invoked")
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("Template handler invoked")
 
 	// Extract user info from context
 	userContext, err := shared.GetUserContext(event.RequestContext)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user ID from context")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
 		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
 	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
 
 	switch event.HTTPMethod {
 	case http.MethodPost:
+		if strings.HasSuffix(event.Resource, "/templates/seed") {
+			return installTemplateSeedPack(ctx, userContext)
+		}
+		if strings.HasSuffix(event.Resource, "/templates/validate") {
+			return validateTemplate(ctx, event, userContext)
+		}
+		if strings.HasSuffix(event.Resource, "/templates/bulk") {
+			return bulkUpdateTemplates(ctx, event, userContext)
+		}
+		if strings.HasSuffix(event.Resource, "/clone") {
+			return cloneTemplate(ctx, event, userContext)
+		}
 		return createTemplate(ctx, event, userContext)
 	case http.MethodPut:
 		return updateTemplate(ctx, event, userContext)
@@ -70,11 +98,27 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.A
 }
 
 type TemplateRequest struct {
-	Context string `json:"context"`
-	Type    string `json:"type"`
-	Channel string `json:"channel"`
-	Content string `json:"content"`
-	Enable  *bool  `json:"disable"`
+	Context        string     `json:"context"`
+	Type           string     `json:"type"`
+	Channel        string     `json:"channel"`
+	Language       string     `json:"language,omitempty"` // BCP 47 tag of a language variant, empty for the default template
+	Content        string     `json:"content"`
+	Format         string     `json:"format,omitempty"` // "text" | "markdown", kept on updates when empty
+	Enable         *bool      `json:"disable"`
+	TemporaryUntil *time.Time `json:"temporaryUntil,omitempty"` // The template is not used after it
+
+	SharedWith []shared.TemplateShare `json:"sharedWith,omitempty"` // Replaces the template's shares, an empty list stops sharing it
+	Tags       []string               `json:"tags,omitempty"`       // Replaces the template's tags, an empty list removes them
+}
+
+// clearableTemplateFields are the template fields an update clears when they are sent as null: a template
+// without temporaryUntil is permanent, one without format is plain text and one without sharedWith is not shared
+var clearableTemplateFields = []string{db.ColTemporary, db.ColFormat, db.ColSharedWith}
+
+// TemplateResponse is a saved template with the warnings the channel rules raised on its content
+type TemplateResponse struct {
+	shared.Template
+	Warnings []shared.TemplateIssue `json:"warnings,omitempty"`
 }
 
 func createTemplate(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -91,29 +135,66 @@ func createTemplate(ctx context.Context, event events.APIGatewayProxyRequest, us
 	}
 	request.Context = context
 
-	if request.Type == "" || !shared.ValidateNotificationType(request.Type) {
+	// Partials are stored under the reserved partial type, named by their channel: partial#footer
+	isPartial := request.Type == shared.PartialType
+	if !isPartial && (request.Type == "" || !shared.ValidateNotificationType(request.Type)) {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid notification type is required", nil), nil
 	}
 
-	if request.Channel == "" || !shared.ValidateChannel(request.Channel) {
+	if !isPartial && (request.Channel == "" || !shared.ValidateChannel(request.Channel)) {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid channel is required", nil), nil
 	}
 
+	if request.Language != "" {
+		if isPartial {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Partials are shared by every language", nil), nil
+		}
+		request.Language = shared.CanonicalLanguage(request.Language)
+		if request.Language == "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template language", nil), nil
+		}
+	}
+
 	if request.Content == "" {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Template content is required", nil), nil
 	}
+	if isPartial && request.Format != "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Partials take the format of the templates including them", nil), nil
+	}
+	if err := shared.ValidateTemplateFormat(request.Format, request.Channel, request.Content); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	if err := shared.ValidateExpiry("temporaryUntil", request.TemporaryUntil); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	tags, err := shared.NormalizeTags(request.Tags)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
 
-	variables := shared.ExtractVariablesFromContent(request.Content)
+	if len(request.SharedWith) > 0 {
+		if errResponse := validateTemplateShares(ctx, request.Context, request.SharedWith); errResponse != nil {
+			return *errResponse, nil
+		}
+	}
 
-	// Validate template variables against fixed set for the type
-	if invalidVars := shared.ValidateTemplateFixedVariables(request.Type, variables); len(invalidVars) > 0 {
-		return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid variables for type %s: %v", request.Type, invalidVars), nil), nil
+	compiled, contentErr := compileTemplateContent(ctx, request)
+	if contentErr != nil {
+		return *contentErr, nil
+	}
+	var warnings []shared.TemplateIssue
+	if !isPartial {
+		warnings = shared.LintTemplateContent(request.Channel, request.Format, request.Content)
+		if shared.HasLintErrors(warnings) {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template content", warnings), nil
+		}
 	}
 
 	// Check if template already exists
-	existing, err := db.GetTemplateByTypeChannel(ctx, request.Context, shared.BuildTypeChannel(request.Type, request.Channel))
+	typeChannel := shared.BuildTemplateKey(request.Type, request.Channel, request.Language)
+	existing, err := db.GetTemplateByTypeChannel(ctx, request.Context, typeChannel)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get existing template")
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing template")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
 	}
 	if existing.TypeChannel != "" {
@@ -122,21 +203,29 @@ func createTemplate(ctx context.Context, event events.APIGatewayProxyRequest, us
 
 	// Create new template
 	template := shared.Template{
-		Context:     request.Context,
-		TypeChannel: shared.BuildTypeChannel(request.Type, request.Channel),
-		Content:     request.Content,
-		IsActive:    &db.TemplateActive,
+		Context:        request.Context,
+		TypeChannel:    typeChannel,
+		Content:        request.Content,
+		Format:         request.Format,
+		IsActive:       &db.TemplateActive,
+		CreatedBy:      userContext.UserID,
+		Compiled:       compiled,
+		TemporaryUntil: request.TemporaryUntil,
+		SharedWith:     request.SharedWith,
+		Tags:           tags,
 	}
 
 	err = db.CreateTemplate(ctx, template)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to create template")
+		shared.LogError(ctx).Err(err).Msg("Failed to create template")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to create template", nil), nil
 	}
 
-	shared.LogInfo().Str("context", template.Context).Str("typeChannel", template.TypeChannel).Msg("Template created successfully")
+	invalidateTemplateCaches(ctx)
+
+	shared.LogInfo(ctx).Str("context", template.Context).Str("typeChannel", template.TypeChannel).Int("warnings", len(warnings)).Msg("Template created successfully")
 
-	return shared.CreateAPIResponse(http.StatusCreated, template), nil
+	return shared.CreateAPIResponse(http.StatusCreated, TemplateResponse{Template: template, Warnings: warnings}), nil
 }
 
 func updateTemplate(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
@@ -152,53 +241,298 @@ func updateTemplate(ctx context.Context, event events.APIGatewayProxyRequest, us
 		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
 	}
 
-	context, errResponse := shared.ValidateContext(request.Context, userContext)
-	if context == "" {
-		return errResponse, nil
+	// Users the owner shared the template with for editing update it in the owner's context
+	owner := sharedTemplateOwner(request.Context, userContext)
+	if owner != "" {
+		request.Context = owner
+	} else {
+		context, errResponse := shared.ValidateContext(request.Context, userContext)
+		if context == "" {
+			return errResponse, nil
+		}
+		request.Context = context
 	}
-	request.Context = context
-	request.Type, request.Channel = shared.ParseTypeChannel(typeChannel)
+	request.Type, request.Channel, request.Language = shared.ParseTemplateKey(typeChannel)
+
+	// Fields sent as null are cleared
+	nulls := shared.NullFields(event.Body)
+	var cleared []string
+	for _, field := range clearableTemplateFields {
+		if nulls[field] {
+			cleared = append(cleared, field)
+		}
+	}
+	unshared := nulls[db.ColSharedWith]
 
 	// Get existing template to verify ownership
 	existing, err := db.GetTemplateByTypeChannel(ctx, request.Context, typeChannel)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get existing template")
+		shared.LogError(ctx).Err(err).Msg("Failed to get existing template")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
 	}
 	if existing.TypeChannel == "" {
 		return shared.CreateErrorResponse(http.StatusNotFound, "Template not found", nil), nil
 	}
+	if owner != "" {
+		allowed, err := newTeamMembership(userContext.UserID).canAccess(ctx, existing, shared.TemplateAccessEdit)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to check template access")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
+		}
+		if !allowed {
+			return shared.CreateErrorResponse(http.StatusNotFound, "Template not found", nil), nil
+		}
+		if request.SharedWith != nil || unshared {
+			return shared.CreateErrorResponse(http.StatusForbidden, "Only the template owner can change who it is shared with", nil), nil
+		}
+	}
 
-	if request.Content == "" && request.Enable == nil {
+	if request.Content == "" && request.Format == "" && request.Enable == nil && request.TemporaryUntil == nil && request.SharedWith == nil && request.Tags == nil && len(cleared) == 0 {
 		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one field must be provided", nil), nil
 	}
+	var warnings []shared.TemplateIssue
+	if request.Format != "" || request.Content != "" || nulls[db.ColFormat] {
+		// The format is checked against the content the template ends up with, a cleared format is the default text
+		format, content := cmp.Or(request.Format, existing.Format), cmp.Or(request.Content, existing.Content)
+		if nulls[db.ColFormat] {
+			format = ""
+		}
+		if existing.IsPartial() && request.Format != "" {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Partials take the format of the templates including them", nil), nil
+		}
+		if err := shared.ValidateTemplateFormat(format, request.Channel, content); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+		if !existing.IsPartial() {
+			warnings = shared.LintTemplateContent(request.Channel, format, content)
+		}
+	}
+	if len(request.SharedWith) > 0 {
+		if errResponse := validateTemplateShares(ctx, request.Context, request.SharedWith); errResponse != nil {
+			return *errResponse, nil
+		}
+	}
+	if err := shared.ValidateExpiry("temporaryUntil", request.TemporaryUntil); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	if request.Tags != nil {
+		if request.Tags, err = shared.NormalizeTags(request.Tags); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+	}
 
 	// Validate the request
+	var compiled *shared.CompiledTemplate
 	if request.Content != "" {
-		variables := shared.ExtractVariablesFromContent(request.Content)
-		// Validate template variables against fixed set for the type
-		if invalidVars := shared.ValidateTemplateFixedVariables(request.Type, variables); len(invalidVars) > 0 {
-			return shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid variables for type %s: %v", request.Type, invalidVars), nil), nil
+		var contentErr *shared.APIResponse
+		compiled, contentErr = compileTemplateContent(ctx, request)
+		if contentErr != nil {
+			return *contentErr, nil
 		}
 	}
+	if shared.HasLintErrors(warnings) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template content", warnings), nil
+	}
 
 	updatedTemplate, err := db.UpdateTemplate(ctx, shared.Template{
-		Context:     request.Context,
-		TypeChannel: typeChannel,
-		Content:     request.Content,
-		IsActive:    request.Enable,
-	})
+		Context:        request.Context,
+		TypeChannel:    typeChannel,
+		Content:        request.Content,
+		Format:         request.Format,
+		IsActive:       request.Enable,
+		Compiled:       compiled,
+		TemporaryUntil: request.TemporaryUntil,
+		SharedWith:     request.SharedWith,
+		Tags:           request.Tags,
+	}, cleared...)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to update template")
+		shared.LogError(ctx).Err(err).Msg("Failed to update template")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update template", nil), nil
 	}
 
-	shared.LogInfo().Str("typeChannel", typeChannel).Str("context", existing.Context).Msg("Template updated successfully")
+	invalidateTemplateCaches(ctx)
 
-	return shared.CreateAPIResponse(http.StatusOK, updatedTemplate), nil
+	if request.SharedWith != nil || unshared {
+		shared.LogAudit(ctx, "template.share").Str("context", request.Context).Str("typeChannel", typeChannel).
+			Int("shares", len(request.SharedWith)).Msg("Template sharing changed")
+	}
+	if owner != "" {
+		shared.LogAudit(ctx, "template.shared_edit").Str("context", owner).Str("typeChannel", typeChannel).Msg("Shared template edited")
+	}
+
+	shared.LogInfo(ctx).Str("typeChannel", typeChannel).Str("context", existing.Context).Int("warnings", len(warnings)).Msg("Template updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, TemplateResponse{Template: updatedTemplate, Warnings: warnings}), nil
+}
+
+// TemplateCloneRequest names the context a global template is cloned into, the caller's own by default
+type TemplateCloneRequest struct {
+	Context string `json:"context,omitempty"`
+}
+
+// cloneTemplate copies a global template into the caller's context, or the one a super admin names, so it
+// can be customized from the global default. An existing template in the target context is never overwritten
+func cloneTemplate(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	typeChannel, errResponse := validateTemplateID(event.PathParameters[TemplateIDPathParam])
+	if typeChannel == "" {
+		return errResponse, nil
+	}
+
+	var request TemplateCloneRequest
+	if event.Body != "" {
+		if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+		}
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+	if context == "*" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Templates are cloned into a user context", nil), nil
+	}
+
+	source, err := db.GetTemplateByTypeChannel(ctx, "*", typeChannel)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global template")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
+	}
+	if source.TypeChannel == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Global template not found", nil), nil
+	}
+
+	// The clone starts active and permanent whatever the state of the global template, and keeps its tags
+	template := shared.Template{
+		Context:     context,
+		TypeChannel: typeChannel,
+		Content:     source.Content,
+		Format:      source.Format,
+		IsActive:    &db.TemplateActive,
+		CreatedBy:   userContext.UserID,
+		Compiled:    source.Compiled,
+		Tags:        source.Tags,
+	}
+	created, err := db.CreateTemplateIfNotExists(ctx, template)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to clone template")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to clone template", nil), nil
+	}
+	if !created {
+		return shared.CreateErrorResponse(http.StatusConflict, "Template already exists in the context", nil), nil
+	}
+
+	invalidateTemplateCaches(ctx)
+
+	var warnings []shared.TemplateIssue
+	if !template.IsPartial() {
+		_, channel, _ := shared.ParseTemplateKey(typeChannel)
+		warnings = shared.LintTemplateContent(channel, template.Format, template.Content)
+	}
+
+	shared.LogAudit(ctx, "template.clone").Str("context", context).Str("typeChannel", typeChannel).Msg("Global template cloned")
+
+	return shared.CreateAPIResponse(http.StatusCreated, TemplateResponse{Template: template, Warnings: warnings}), nil
+}
+
+// TemplateBulkRequest activates or deactivates every template of a context carrying all the tags
+type TemplateBulkRequest struct {
+	Context  string   `json:"context,omitempty"`
+	Tags     []string `json:"tags"`
+	IsActive *bool    `json:"isActive"`
+	DryRun   bool     `json:"dryRun,omitempty"` // Only list the templates that would change
+}
+
+// TemplateBulkResponse lists the templates a bulk update matched and those it changed
+type TemplateBulkResponse struct {
+	Context  string   `json:"context"`
+	Tags     []string `json:"tags"`
+	IsActive bool     `json:"isActive"`
+	DryRun   bool     `json:"dryRun,omitempty"`
+	Matched  int      `json:"matched"`
+	Updated  []string `json:"updated"` // type#channel of the templates whose state changed
+}
+
+// bulkUpdateTemplates activates or deactivates the tagged templates of the caller's context, or of the one a
+// super admin names. Templates already in the requested state are left untouched, so a failed run can be repeated
+func bulkUpdateTemplates(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request TemplateBulkRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+	if request.IsActive == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "isActive is required", nil), nil
+	}
+	// Without tags the operation would reach every template of the context
+	tags, err := shared.NormalizeTags(request.Tags)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	if len(tags) == 0 {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "At least one tag is required", nil), nil
+	}
+
+	response := TemplateBulkResponse{
+		Context:  context,
+		Tags:     tags,
+		IsActive: *request.IsActive,
+		DryRun:   request.DryRun,
+		Updated:  make([]string, 0),
+	}
+	var nextToken string
+	for {
+		templates, next, err := db.GetTemplatesList(ctx, context, tags, 0, nextToken)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get templates")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve templates", nil), nil
+		}
+		for _, template := range templates {
+			response.Matched++
+			if template.Active() == *request.IsActive {
+				continue
+			}
+			response.Updated = append(response.Updated, template.TypeChannel)
+			if request.DryRun {
+				continue
+			}
+			if _, err := db.UpdateTemplate(ctx, shared.Template{
+				Context:     context,
+				TypeChannel: template.TypeChannel,
+				IsActive:    request.IsActive,
+			}); err != nil {
+				shared.LogError(ctx).Err(err).Str("typeChannel", template.TypeChannel).Msg("Failed to update template")
+				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update templates, the operation can be retried", nil), nil
+			}
+		}
+		if next == "" {
+			break
+		}
+		nextToken = next
+	}
+
+	if request.DryRun {
+		return shared.CreateAPIResponse(http.StatusOK, response), nil
+	}
+	if len(response.Updated) > 0 {
+		invalidateTemplateCaches(ctx)
+	}
+
+	shared.LogAudit(ctx, "template.bulk_update").Str("context", context).Strs("tags", tags).Bool("isActive", *request.IsActive).
+		Int("matched", response.Matched).Int("updated", len(response.Updated)).Msg("Tagged templates updated")
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
 }
 
 func listTemplates(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	if event.QueryStringParameters[SharedQueryParam] == "true" {
+		return listSharedTemplates(ctx, userContext)
+	}
+
 	context, errResponse := shared.ValidateContext(event.QueryStringParameters[ContextQueryParam], userContext)
 	if context == "" {
 		return errResponse, nil
@@ -213,10 +547,16 @@ func listTemplates(ctx context.Context, event events.APIGatewayProxyRequest, use
 		startKey = nextToken
 	}
 
+	// Only templates carrying every tag of ?tag=legacy,team:billing are listed
+	tags, err := shared.ParseTagFilter(event.QueryStringParameters[TagQueryParam])
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
 	// Get templates list
-	templates, nextKey, err := db.GetTemplatesList(ctx, context, limit, startKey)
+	templates, nextKey, err := db.GetTemplatesList(ctx, context, tags, limit, startKey)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to unmarshal templates")
+		shared.LogError(ctx).Err(err).Msg("Failed to unmarshal templates")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to process templates", nil), nil
 	}
 
@@ -237,20 +577,35 @@ func getTemplateByID(ctx context.Context, event events.APIGatewayProxyRequest, u
 		return errResponse, nil
 	}
 
-	context, errResponse := shared.ValidateContext(event.QueryStringParameters[ContextQueryParam], userContext)
-	if context == "" {
-		return errResponse, nil
+	// Users the owner shared the template with read it in the owner's context
+	owner := sharedTemplateOwner(event.QueryStringParameters[ContextQueryParam], userContext)
+	context := owner
+	if owner == "" {
+		context, errResponse = shared.ValidateContext(event.QueryStringParameters[ContextQueryParam], userContext)
+		if context == "" {
+			return errResponse, nil
+		}
 	}
 
 	template, err := db.GetTemplateByTypeChannel(ctx, context, typeChannel)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get template")
+		shared.LogError(ctx).Err(err).Msg("Failed to get template")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
 	}
 
 	if template.Context == "" {
 		return shared.CreateErrorResponse(http.StatusNotFound, "Template not found", nil), nil
 	}
+	if owner != "" {
+		allowed, err := newTeamMembership(userContext.UserID).canAccess(ctx, template, shared.TemplateAccessRead)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to check template access")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve template", nil), nil
+		}
+		if !allowed {
+			return shared.CreateErrorResponse(http.StatusNotFound, "Template not found", nil), nil
+		}
+	}
 
 	return shared.CreateAPIResponse(http.StatusOK, template), nil
 }
@@ -272,10 +627,305 @@ func deleteTemplate(ctx context.Context, event events.APIGatewayProxyRequest, us
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete template", nil), nil
 	}
 
+	invalidateTemplateCaches(ctx)
+
 	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Template deleted successfully"}), nil
 
 }
 
+// listSharedTemplates returns the other users' templates shared with the user, directly or through a team
+func listSharedTemplates(ctx context.Context, userContext shared.UserContext) (shared.APIResponse, error) {
+	templates, err := db.GetSharedTemplates(ctx)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get shared templates")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to process templates", nil), nil
+	}
+
+	membership := newTeamMembership(userContext.UserID)
+	items := make([]shared.Template, 0)
+	for _, template := range templates {
+		allowed, err := membership.canAccess(ctx, template, shared.TemplateAccessRead)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to check template access")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to process templates", nil), nil
+		}
+		if allowed {
+			items = append(items, template)
+		}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items: items,
+		Count: len(items),
+	}), nil
+}
+
+// sharedTemplateOwner returns the other user's context a user addressed a template in, empty when the
+// request is for the caller's own templates or comes from a super admin
+func sharedTemplateOwner(context string, userContext shared.UserContext) string {
+	context = strings.TrimSpace(context)
+	if userContext.Role == shared.RoleSuperAdmin || context == "" || context == "*" || context == userContext.UserID {
+		return ""
+	}
+	return context
+}
+
+// validateTemplateShares checks the shares of a template in context, and that the users and teams they
+// name exist. Global templates are visible to everyone and are not shared
+func validateTemplateShares(ctx context.Context, context string, shares []shared.TemplateShare) *shared.APIResponse {
+	if context == "*" {
+		response := shared.CreateErrorResponse(http.StatusBadRequest, "Global templates cannot be shared", nil)
+		return &response
+	}
+	if err := shared.ValidateTemplateShares(shares, context); err != nil {
+		response := shared.CreateErrorResponse(http.StatusBadRequest, "Invalid sharing: "+err.Error(), nil)
+		return &response
+	}
+
+	for _, share := range shares {
+		var found bool
+		if teamID := share.TeamID(); teamID != "" {
+			team, err := db.GetTeam(ctx, teamID)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Str("teamId", teamID).Msg("Failed to get team")
+				response := shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to validate sharing", nil)
+				return &response
+			}
+			found = team.TeamID != ""
+		} else {
+			user, err := db.GetUserByID(ctx, share.Principal)
+			if err != nil {
+				response := shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to validate sharing", nil)
+				return &response
+			}
+			found = user != nil
+		}
+		if !found {
+			response := shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid sharing: %s not found", share.Principal), nil)
+			return &response
+		}
+	}
+	return nil
+}
+
+// teamMembership checks a user's access to shared templates, looking up each team it is shared with once
+type teamMembership struct {
+	userID  string
+	members map[string]bool
+}
+
+func newTeamMembership(userID string) *teamMembership {
+	return &teamMembership{userID: userID, members: make(map[string]bool)}
+}
+
+// canAccess reports whether the template is shared with the user, or a team they are a member of, with access
+func (m *teamMembership) canAccess(ctx context.Context, template shared.Template, access string) (bool, error) {
+	for _, share := range template.SharedWith {
+		if !share.Allows(access) {
+			continue
+		}
+		teamID := share.TeamID()
+		if teamID == "" {
+			if share.Principal == m.userID {
+				return true, nil
+			}
+			continue
+		}
+
+		member, ok := m.members[teamID]
+		if !ok {
+			team, err := db.GetTeam(ctx, teamID)
+			if err != nil {
+				return false, err
+			}
+			member = slices.Contains(team.Members, m.userID)
+			m.members[teamID] = member
+		}
+		if member {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// SeedPackResponse lists the seed pack templates that were installed and the ones that already existed
+type SeedPackResponse struct {
+	Installed []string `json:"installed"`
+	Skipped   []string `json:"skipped"`
+}
+
+// installTemplateSeedPack installs the global seed pack templates. Existing templates are never overwritten,
+// so the endpoint can be called again safely
+func installTemplateSeedPack(ctx context.Context, userContext shared.UserContext) (shared.APIResponse, error) {
+	if userContext.Role != shared.RoleSuperAdmin {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Only super admins can install the template seed pack", nil), nil
+	}
+
+	response := SeedPackResponse{
+		Installed: make([]string, 0, len(shared.TemplateSeedPack)),
+		Skipped:   make([]string, 0),
+	}
+
+	for _, seed := range shared.TemplateSeedPack {
+		typeChannel := shared.BuildTypeChannel(seed.Type, seed.Channel)
+		created, err := db.CreateTemplateIfNotExists(ctx, shared.Template{
+			Context:     "*",
+			TypeChannel: typeChannel,
+			Content:     seed.Content,
+			IsActive:    &db.TemplateActive,
+		})
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("typeChannel", typeChannel).Msg("Failed to install seed template")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to install template seed pack", nil), nil
+		}
+
+		if created {
+			response.Installed = append(response.Installed, typeChannel)
+		} else {
+			response.Skipped = append(response.Skipped, typeChannel)
+		}
+	}
+
+	if len(response.Installed) > 0 {
+		invalidateTemplateCaches(ctx)
+	}
+
+	shared.LogInfo(ctx).Int("installed", len(response.Installed)).Int("skipped", len(response.Skipped)).Msg("Template seed pack installed successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, response), nil
+}
+
+// validateTemplate lints template content without saving it: its structure and syntax for the channel, its size,
+// and its variables against the type's schema. Content problems are returned as issues, only a malformed request
+// fails
+func validateTemplate(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	var request TemplateRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+
+	context, errResponse := shared.ValidateContext(request.Context, userContext)
+	if context == "" {
+		return errResponse, nil
+	}
+
+	isPartial := request.Type == shared.PartialType
+	if !isPartial && (request.Type == "" || !shared.ValidateNotificationType(request.Type)) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid notification type is required", nil), nil
+	}
+	if !isPartial && (request.Channel == "" || !shared.ValidateChannel(request.Channel)) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Valid channel is required", nil), nil
+	}
+	if isPartial && request.Format != "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Partials take the format of the templates including them", nil), nil
+	}
+
+	var validation shared.TemplateValidation
+	if isPartial {
+		validation = shared.LintTemplate(request.Channel, "", request.Content, nil)
+	} else {
+		schema, err := db.GetVariableSchema(ctx, request.Type)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("type", request.Type).Msg("Failed to get variable schema")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to validate template variables", nil), nil
+		}
+		schema.Type = request.Type
+		validation = shared.LintTemplate(request.Channel, request.Format, request.Content, &schema)
+	}
+
+	// Partials the template includes must exist in the context or globally, or they render empty
+	for _, name := range shared.PartialNames(request.Content) {
+		found, err := partialExists(ctx, context, name)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Str("partial", name).Msg("Failed to get partial")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to validate template partials", nil), nil
+		}
+		if !found {
+			validation.Issues = append(validation.Issues, shared.TemplateIssue{
+				Severity: shared.IssueSeverityWarning,
+				Code:     "missing_partial",
+				Field:    name,
+				Message:  fmt.Sprintf("partial %s does not exist and renders empty", name),
+			})
+		}
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, validation), nil
+}
+
+// partialExists reports whether a partial is stored in the context or globally
+func partialExists(ctx context.Context, context, name string) (bool, error) {
+	for _, candidate := range []string{context, "*"} {
+		partial, err := db.GetTemplateByTypeChannel(ctx, candidate, shared.PartialTypeChannel(name))
+		if err != nil {
+			return false, err
+		}
+		if partial.TypeChannel != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// compileTemplateContent validates the content of a template request and compiles it. Template variables
+// are checked against the set registered for the type. Partials are shared by every type, only their
+// syntax is checked, and they are compiled with the templates including them
+func compileTemplateContent(ctx context.Context, request TemplateRequest) (*shared.CompiledTemplate, *shared.APIResponse) {
+	channel := request.Channel
+	if request.Type == shared.PartialType {
+		channel = ""
+	}
+	if err := shared.CheckTemplateSize(channel, request.Content); err != nil {
+		response := shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template content", err.Error())
+		return nil, &response
+	}
+
+	if request.Type == shared.PartialType {
+		if err := shared.ValidatePartial(request.Channel, request.Content); err != nil {
+			response := shared.CreateErrorResponse(http.StatusBadRequest, "Invalid partial", err.Error())
+			return nil, &response
+		}
+		return nil, nil
+	}
+
+	invalidVars, err := validateTemplateVariables(ctx, request.Type, request.Content)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("type", request.Type).Msg("Failed to get allowed variables")
+		response := shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to validate template variables", nil)
+		return nil, &response
+	}
+	if len(invalidVars) > 0 {
+		response := shared.CreateErrorResponse(http.StatusBadRequest, fmt.Sprintf("Invalid variables for type %s: %v", request.Type, invalidVars), nil)
+		return nil, &response
+	}
+
+	compiled, err := shared.CompileTemplateContent(request.Channel, request.Content)
+	if err != nil {
+		response := shared.CreateErrorResponse(http.StatusBadRequest, "Invalid template content", err.Error())
+		return nil, &response
+	}
+	return compiled, nil
+}
+
+// invalidateTemplateCaches bumps the templates version so processors drop their cached templates
+// validateTemplateVariables returns the variables in content that are not registered for the notification type
+func validateTemplateVariables(ctx context.Context, notificationType, content string) ([]string, error) {
+	allowed, err := db.GetTypeVariables(ctx, notificationType)
+	if err != nil {
+		return nil, err
+	}
+	if allowed == nil {
+		return []string{"unknown notification type"}, nil
+	}
+	return shared.ValidateTemplateVariables(allowed, shared.ExtractVariablesFromContent(content)), nil
+}
+
+func invalidateTemplateCaches(ctx context.Context) {
+	if err := db.BumpTemplatesVersion(ctx); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to bump templates version, processor caches will refresh on TTL")
+	}
+}
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapAPIHandler("template", handler))
 }
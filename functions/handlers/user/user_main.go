@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"notification-service/functions/db"
+	"notification-service/functions/services"
 	"notification-service/functions/shared"
+	"slices"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
@@ -12,8 +16,10 @@ import (
 
 const (
 	UserIDPathParam     = "userId"
+	DeviceIDPathParam   = "deviceId"
 	LimitQueryParam     = "limit"
 	NextTokenQueryParam = "nextToken"
+	TypesQueryParam     = "types"
 )
 
 func init() {
@@ -21,14 +27,28 @@ func init() {
 }
 
 func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.APIResponse, error) {
-	shared.LogInfo().Str("method", event.HTTPMethod).Str("path", event.Path).Msg("User handler invoked")
+	shared.LogInfo(ctx).Str("method", event.HTTPMethod).Str("path", event.Path).Msg("User handler invoked")
 
 	// Extract user info from context
 	userContext, err := shared.GetUserContext(event.RequestContext)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to get user ID from context")
+		shared.LogError(ctx).Err(err).Msg("Failed to get user ID from context")
 		return shared.CreateErrorResponse(http.StatusUnauthorized, "Invalid authentication", nil), nil
 	}
+	ctx = shared.WithLogUser(ctx, userContext.UserID)
+
+	// The caller's own user-scoped resources
+	if strings.HasSuffix(event.Resource, "/me/resources") {
+		if event.HTTPMethod != http.MethodDelete {
+			return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+		}
+		return deleteUserResources(ctx, event, userContext)
+	}
+
+	// Device registrations for push notifications
+	if strings.Contains(event.Resource, "/devices") {
+		return handleDevices(ctx, event, userContext)
+	}
 
 	switch event.HTTPMethod {
 	case http.MethodGet:
@@ -37,6 +57,8 @@ func handler(ctx context.Context, event events.APIGatewayProxyRequest) (shared.A
 			return getUserByID(ctx, event, userContext)
 		}
 		return listUsers(ctx, event, userContext)
+	case http.MethodPut:
+		return updateUser(ctx, event, userContext)
 	default:
 		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
 	}
@@ -60,7 +82,7 @@ func listUsers(ctx context.Context, event events.APIGatewayProxyRequest, userCon
 	// Get users list
 	users, nextKey, err := db.GetUsersList(ctx, limit, startKey)
 	if err != nil {
-		shared.LogError().Err(err).Msg("Failed to unmarshal users")
+		shared.LogError(ctx).Err(err).Msg("Failed to unmarshal users")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to process users", nil), nil
 	}
 
@@ -87,7 +109,7 @@ func getUserByID(ctx context.Context, event events.APIGatewayProxyRequest, reque
 
 	user, err := db.GetUserByID(ctx, targetUserID)
 	if err != nil {
-		shared.LogError().Err(err).Str("userId", targetUserID).Msg("Failed to get user")
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to get user")
 		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
 	}
 
@@ -98,6 +120,309 @@ func getUserByID(ctx context.Context, event events.APIGatewayProxyRequest, reque
 	return shared.CreateAPIResponse(http.StatusOK, user), nil
 }
 
+type UpdateUserRequest struct {
+	Attributes  map[string]string `json:"attributes"`
+	PhoneNumber *string           `json:"phoneNumber"` // E.164, "" removes it
+}
+
+// updateUser replaces the user's attributes and SMS phone number, an empty map or number clears them
+func updateUser(ctx context.Context, event events.APIGatewayProxyRequest, requestUser shared.UserContext) (shared.APIResponse, error) {
+	targetUserID := event.PathParameters[UserIDPathParam]
+	if targetUserID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "User ID is required", nil), nil
+	}
+
+	// Users can only update their own data unless they're super admin
+	if requestUser.Role != shared.RoleSuperAdmin && requestUser.UserID != targetUserID {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Cannot update other user's data", nil), nil
+	}
+
+	var request UpdateUserRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if request.Attributes == nil && request.PhoneNumber == nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Attributes or phone number are required", nil), nil
+	}
+	if err := shared.ValidateUserAttributes(request.Attributes); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+	if request.PhoneNumber != nil && *request.PhoneNumber != "" {
+		if err := shared.ValidatePhoneNumber(*request.PhoneNumber); err != nil {
+			return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+		}
+	}
+
+	existing, err := db.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to get user")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+	}
+	if existing == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+	}
+
+	user, err := db.UpdateUser(ctx, targetUserID, request.Attributes, request.PhoneNumber)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to update user")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to update user", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("targetUserId", targetUserID).Int("attributes", len(request.Attributes)).Bool("phoneNumber", request.PhoneNumber != nil).Msg("User updated successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, user), nil
+}
+
+// handleDevices serves a user's push devices, to the user or a super admin
+func handleDevices(ctx context.Context, event events.APIGatewayProxyRequest, requestUser shared.UserContext) (shared.APIResponse, error) {
+	targetUserID := event.PathParameters[UserIDPathParam]
+	if targetUserID == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "User ID is required", nil), nil
+	}
+	if requestUser.Role != shared.RoleSuperAdmin && requestUser.UserID != targetUserID {
+		return shared.CreateErrorResponse(http.StatusForbidden, "Cannot access other user's devices", nil), nil
+	}
+
+	deviceID := event.PathParameters[DeviceIDPathParam]
+	switch {
+	case event.HTTPMethod == http.MethodGet && deviceID == "":
+		return listDevices(ctx, targetUserID)
+	case event.HTTPMethod == http.MethodPost && deviceID == "":
+		return registerDevice(ctx, event, targetUserID)
+	case event.HTTPMethod == http.MethodDelete && deviceID != "":
+		return unregisterDevice(ctx, targetUserID, deviceID)
+	default:
+		return shared.CreateErrorResponse(http.StatusMethodNotAllowed, "Method not allowed", nil), nil
+	}
+}
+
+func listDevices(ctx context.Context, targetUserID string) (shared.APIResponse, error) {
+	devices, err := db.GetDeviceTokens(ctx, targetUserID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to get devices")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve devices", nil), nil
+	}
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.PaginatedResponse{
+		Items: devices,
+		Count: len(devices),
+	}), nil
+}
+
+type RegisterDeviceRequest struct {
+	Token    string `json:"token"`
+	Platform string `json:"platform"` // "fcm" | "apns" | "apns_sandbox"
+}
+
+// registerDevice creates the SNS platform endpoint of a device token and stores the device. Registering a
+// token again refreshes it, so apps can register on every launch
+func registerDevice(ctx context.Context, event events.APIGatewayProxyRequest, targetUserID string) (shared.APIResponse, error) {
+	var request RegisterDeviceRequest
+	if err := shared.ParseRequestBody(event.Body, &request); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid request body", nil), nil
+	}
+	if !shared.ValidatePushPlatform(request.Platform) {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid platform", nil), nil
+	}
+	if err := shared.ValidateDeviceToken(request.Token); err != nil {
+		return shared.CreateErrorResponse(http.StatusBadRequest, err.Error(), nil), nil
+	}
+
+	user, err := db.GetUserByID(ctx, targetUserID)
+	if err != nil {
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve user", nil), nil
+	}
+	if user == nil {
+		return shared.CreateErrorResponse(http.StatusNotFound, "User not found", nil), nil
+	}
+
+	globalConfig, err := db.GetSystemConfig(ctx, "*")
+	if err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to get global config")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve config", nil), nil
+	}
+	var platformApplicationARN string
+	if globalConfig.Config != nil {
+		platformApplicationARN = globalConfig.Config.PushSettings.PlatformApplicationARNs[request.Platform]
+	}
+	if platformApplicationARN == "" {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Push notifications are not configured for platform "+request.Platform, nil), nil
+	}
+
+	deviceID := shared.BuildDeviceID(request.Token)
+	devices, err := db.GetDeviceTokens(ctx, targetUserID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to get devices")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve devices", nil), nil
+	}
+	registered := slices.ContainsFunc(devices, func(device shared.DeviceToken) bool { return device.DeviceID == deviceID })
+	if !registered && len(devices) >= shared.MaxDevicesPerUser {
+		return shared.CreateErrorResponse(http.StatusBadRequest, "Device limit reached, unregister a device first", nil), nil
+	}
+
+	endpointARN, err := services.SnsCreatePlatformEndpoint(ctx, platformApplicationARN, request.Token)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Str("platform", request.Platform).Msg("Failed to create platform endpoint")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to register device", nil), nil
+	}
+
+	device, err := db.PutDeviceToken(ctx, shared.DeviceToken{
+		UserID:      targetUserID,
+		DeviceID:    deviceID,
+		Platform:    request.Platform,
+		Token:       request.Token,
+		EndpointARN: endpointARN,
+	})
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to store device")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to register device", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("targetUserId", targetUserID).Str("deviceId", deviceID).Str("platform", request.Platform).Bool("refreshed", registered).Msg("Device registered successfully")
+
+	status := http.StatusCreated
+	if registered {
+		status = http.StatusOK
+	}
+	return shared.CreateAPIResponse(status, device), nil
+}
+
+// unregisterDevice deletes a device and its SNS platform endpoint
+func unregisterDevice(ctx context.Context, targetUserID, deviceID string) (shared.APIResponse, error) {
+	device, err := db.GetDeviceToken(ctx, targetUserID, deviceID)
+	if err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Msg("Failed to get device")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve device", nil), nil
+	}
+	if device.DeviceID == "" {
+		return shared.CreateErrorResponse(http.StatusNotFound, "Device not found", nil), nil
+	}
+
+	if device.EndpointARN != "" {
+		if err := services.SnsDeleteEndpoint(ctx, device.EndpointARN); err != nil {
+			shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Str("deviceId", deviceID).Msg("Failed to delete platform endpoint")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to unregister device", nil), nil
+		}
+	}
+	if err := db.DeleteDeviceToken(ctx, targetUserID, deviceID); err != nil {
+		shared.LogError(ctx).Err(err).Str("targetUserId", targetUserID).Str("deviceId", deviceID).Msg("Failed to delete device")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to unregister device", nil), nil
+	}
+
+	shared.LogInfo(ctx).Str("targetUserId", targetUserID).Str("deviceId", deviceID).Msg("Device unregistered successfully")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.SuccessResponse{Message: "Device unregistered successfully"}), nil
+}
+
+// deleteUserResources removes the caller's templates, schedules and preferences, or the types listed in
+// ?types=, so the global defaults apply again. The EventBridge schedules are deleted first, then every record
+// in a single transaction; a failed request leaves the records in place and can be repeated
+func deleteUserResources(ctx context.Context, event events.APIGatewayProxyRequest, userContext shared.UserContext) (shared.APIResponse, error) {
+	resourceTypes := []string{shared.UserResourceTemplates, shared.UserResourceSchedules, shared.UserResourcePreferences}
+	if param := event.QueryStringParameters[TypesQueryParam]; param != "" {
+		resourceTypes = strings.Split(param, ",")
+		for _, resourceType := range resourceTypes {
+			if resourceType != shared.UserResourceTemplates && resourceType != shared.UserResourceSchedules && resourceType != shared.UserResourcePreferences {
+				return shared.CreateErrorResponse(http.StatusBadRequest, "Invalid resource type: "+resourceType, nil), nil
+			}
+		}
+	}
+	userID := userContext.UserID
+
+	var templates []shared.Template
+	if slices.Contains(resourceTypes, shared.UserResourceTemplates) {
+		var nextToken string
+		for {
+			page, next, err := db.GetTemplatesList(ctx, userID, nil, 0, nextToken)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Msg("Failed to list user templates")
+				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve templates", nil), nil
+			}
+			templates = append(templates, page...)
+			if next == "" {
+				break
+			}
+			nextToken = next
+		}
+	}
+
+	var schedules []shared.ScheduledNotification
+	if slices.Contains(resourceTypes, shared.UserResourceSchedules) {
+		var nextToken string
+		for {
+			page, next, err := db.GetUserScheduledNotifications(ctx, userID, nil, 0, nextToken)
+			if err != nil {
+				shared.LogError(ctx).Err(err).Msg("Failed to list user scheduled notifications")
+				return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve scheduled notifications", nil), nil
+			}
+			schedules = append(schedules, page...)
+			if next == "" {
+				break
+			}
+			nextToken = next
+		}
+	}
+
+	var preferences shared.UserPreferences
+	if slices.Contains(resourceTypes, shared.UserResourcePreferences) {
+		var err error
+		preferences, err = db.GetUserPreferences(ctx, userID)
+		if err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to get user preferences")
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to retrieve preferences", nil), nil
+		}
+	}
+	deletePreferences := preferences.Context != ""
+
+	count := len(templates) + len(schedules)
+	if len(schedules) > 0 {
+		// The user's schedule quota counter goes with their schedules
+		count++
+	}
+	if deletePreferences {
+		count++
+	}
+	if count > services.MaxTransactItems {
+		return shared.CreateErrorResponse(http.StatusConflict, fmt.Sprintf("Too many resources to delete at once (%d, at most %d), delete fewer types at a time", count, services.MaxTransactItems), nil), nil
+	}
+
+	// Schedules stop firing before their records go, a schedule EventBridge no longer has is already stopped
+	for _, schedule := range schedules {
+		if err := shared.DeleteEventBridgeSchedule(ctx, userID, schedule.ScheduleID); err != nil && !shared.IsScheduleNotFound(err) {
+			return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete schedules", nil), nil
+		}
+	}
+
+	if err := db.DeleteUserResources(ctx, userID, templates, schedules, deletePreferences); err != nil {
+		shared.LogError(ctx).Err(err).Msg("Failed to delete user resources")
+		return shared.CreateErrorResponse(http.StatusInternalServerError, "Failed to delete resources", nil), nil
+	}
+
+	if len(templates) > 0 {
+		if err := db.BumpTemplatesVersion(ctx); err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to bump templates version, processor caches will refresh on TTL")
+		}
+	}
+	if preferences.HasDigestDelivery() {
+		if err := shared.SyncDigestSchedule(ctx, shared.UserPreferences{Context: userID}); err != nil {
+			shared.LogError(ctx).Err(err).Msg("Failed to remove digest schedule")
+		}
+	}
+
+	shared.LogAudit(ctx, "user.resources_delete").
+		Strs("types", resourceTypes).
+		Int("templates", len(templates)).
+		Int("schedules", len(schedules)).
+		Bool("preferences", deletePreferences).
+		Msg("User resources deleted")
+
+	return shared.CreateAPIResponse(http.StatusOK, shared.UserResourcesDeletion{
+		Templates:   len(templates),
+		Schedules:   len(schedules),
+		Preferences: deletePreferences,
+	}), nil
+}
+
 func main() {
-	lambda.Start(handler)
+	lambda.Start(shared.WrapAPIHandler("user", handler))
 }
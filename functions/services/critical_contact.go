@@ -0,0 +1,29 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"notification-service/functions/shared"
+)
+
+// SendToCriticalContact sends a message to a critical contact: an email from fromAddress through the email
+// provider, or an SMS of the subject and plain-text body from senderID. It returns the provider's message ID
+func SendToCriticalContact(ctx context.Context, contact shared.CriticalContact, provider EmailProvider, fromAddress, senderID, subject, htmlBody, text string) (string, error) {
+	switch contact.Type {
+	case shared.CriticalContactEmail:
+		if fromAddress == "" {
+			return "", fmt.Errorf("no email from address configured")
+		}
+		return provider.Send(ctx, Email{
+			From:     fromAddress,
+			To:       contact.Value,
+			Subject:  subject,
+			HTMLBody: htmlBody,
+			TextBody: text,
+		})
+	case shared.CriticalContactPhone:
+		return SnsSendSMS(ctx, contact.Value, senderID, subject+"\n"+text)
+	default:
+		return "", fmt.Errorf("unsupported critical contact type: %s", contact.Type)
+	}
+}
@@ -2,6 +2,10 @@ package services
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"notification-service/functions/shared"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -24,13 +28,41 @@ func DbPutItem(ctx context.Context, tableName string, item any) error {
 	return err
 }
 
+// DbPutItemWithCondition puts the item only when the condition holds
+func DbPutItemWithCondition(ctx context.Context, tableName string, item any, condition expression.ConditionBuilder) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+
+	expr, err := expression.NewBuilder().WithCondition(condition).Build()
+	if err != nil {
+		return err
+	}
+
+	_, err = shared.DynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                 aws.String(tableName),
+		Item:                      av,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	return err
+}
+
+// IsConditionalCheckFailed reports whether err is a failed DynamoDB condition
+func IsConditionalCheckFailed(err error) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionErr)
+}
+
 func DbGetItem(ctx context.Context, tableName string, query any, out any) error {
 	av, err := attributevalue.MarshalMap(query)
 	if err != nil {
 		return err
 	}
 
-	shared.LogInfo().Str("tableName", tableName).Any("query", av).Msg("Getting item")
+	shared.LogInfo(ctx).Str("tableName", tableName).Any("query", av).Msg("Getting item")
 
 	result, err := shared.DynamoDBClient.GetItem(ctx, &dynamodb.GetItemInput{
 		TableName: aws.String(tableName),
@@ -163,3 +195,67 @@ func DbDeleteItem(ctx context.Context, tableName string, query any) error {
 	})
 	return err
 }
+
+// MaxTransactItems is how many items a single DynamoDB transaction can write
+const MaxTransactItems = 100
+
+// DbDeleteKey names an item to delete, by its table and key
+type DbDeleteKey struct {
+	TableName string
+	Key       any
+}
+
+// DbTransactDeleteItems deletes the items in a single transaction, either all of them or none
+func DbTransactDeleteItems(ctx context.Context, keys []DbDeleteKey) error {
+	items := make([]types.TransactWriteItem, 0, len(keys))
+	for _, key := range keys {
+		av, err := attributevalue.MarshalMap(key.Key)
+		if err != nil {
+			return err
+		}
+		items = append(items, types.TransactWriteItem{
+			Delete: &types.Delete{
+				TableName: aws.String(key.TableName),
+				Key:       av,
+			},
+		})
+	}
+
+	_, err := shared.DynamoDBClient.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: items,
+	})
+	return err
+}
+
+// EncodePageToken encodes the last evaluated key of a page as an opaque token. An index's key includes the
+// table's own key, so the next page resumes right after the last item even when sort keys are equal
+func EncodePageToken(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	var values map[string]any
+	if err := attributevalue.UnmarshalMap(key, &values); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// DecodePageToken decodes a token of EncodePageToken into the key the next page starts after, nil when empty
+func DecodePageToken(token string) (map[string]types.AttributeValue, error) {
+	if token == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+	var values map[string]any
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+	return attributevalue.MarshalMap(values)
+}
@@ -0,0 +1,310 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"notification-service/functions/shared"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Listed tables are paginated in a stable order through their ListIndex GSI, sorted by the table's list sort
+// key. Items are spread by their table key over ListKeyShards partitions of the index, "all#0" to "all#7", so
+// writes do not all land on one partition, and a page merges the partitions in list order. Items of dated
+// tables are listed per day of their sort key, "2024-01-15#3", so a date range reads only its days. Items
+// stored with the former single list key "all" are read alongside until the janitor moves them to a shard
+const (
+	ListIndex        = "ListIndex"
+	ListKeyAttribute = "listKey"
+	ListKeyAll       = "all"
+	ListKeyShards    = 8
+)
+
+// ListedTable is a table paginated through its ListIndex GSI
+type ListedTable struct {
+	TableName string
+	Key       string // The table's partition key, which picks the shard of an item
+	SortKey   string // The index's sort key, the list order
+	Dated     bool   // The sort key is a time and items are listed per day of it
+}
+
+// ListKey returns the list key of an item of the table from the values of its table key and sort key
+func (t ListedTable) ListKey(key, sortKey string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	prefix := ListKeyAll
+	if t.Dated && len(sortKey) >= len(time.DateOnly) {
+		prefix = sortKey[:len(time.DateOnly)]
+	}
+	return fmt.Sprintf("%s#%d", prefix, hash.Sum32()%ListKeyShards)
+}
+
+// listKeys returns the list keys of the table's items, those of the given day for a dated table
+func (t ListedTable) listKeys(day string) []string {
+	prefix := ListKeyAll
+	if t.Dated {
+		prefix = day
+	}
+	keys := make([]string, 0, ListKeyShards+1)
+	for shard := range ListKeyShards {
+		keys = append(keys, fmt.Sprintf("%s#%d", prefix, shard))
+	}
+	if !t.Dated {
+		keys = append(keys, ListKeyAll)
+	}
+	return keys
+}
+
+// compare orders two items of the table by their sort key, then by their table key
+func (t ListedTable) compare(a, b map[string]types.AttributeValue) int {
+	if c := compareAttributes(a[t.SortKey], b[t.SortKey]); c != 0 {
+		return c
+	}
+	return compareAttributes(a[t.Key], b[t.Key])
+}
+
+// indexKey returns the ListIndex key of an item, which a query resumes after
+func (t ListedTable) indexKey(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		ListKeyAttribute: item[ListKeyAttribute],
+		t.SortKey:        item[t.SortKey],
+		t.Key:            item[t.Key],
+	}
+}
+
+// DbPutListedItem puts an item of a listed table with its list key
+func DbPutListedItem(ctx context.Context, table ListedTable, item any) error {
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	av[ListKeyAttribute] = &types.AttributeValueMemberS{Value: table.ListKey(attributeString(av[table.Key]), attributeString(av[table.SortKey]))}
+
+	_, err = shared.DynamoDBClient.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(table.TableName),
+		Item:      av,
+	})
+	return err
+}
+
+// DbQueryList reads a page of a listed table in its list order, only the items matching the filter when it is
+// set. A limit of 0 reads every item. It returns the token of the next page, empty after the last one
+func DbQueryList(ctx context.Context, table ListedTable, limit int, pageToken string, filter expression.ConditionBuilder, out any) (string, error) {
+	return queryList(ctx, table, [][]string{table.listKeys("")}, nil, limit, pageToken, filter, nil, out)
+}
+
+// DbQueryListBetween reads a page of the items of a dated table whose sort key is in [from, to), in list order.
+// Only the items matching the filter are returned when it is set, with the attributes of the projection when
+// it is given
+func DbQueryListBetween(ctx context.Context, table ListedTable, from, to time.Time, limit int, pageToken string, filter expression.ConditionBuilder, projection *expression.ProjectionBuilder, out any) (string, error) {
+	var groups [][]string
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.AddDate(0, 0, 1) {
+		groups = append(groups, table.listKeys(day.Format(time.DateOnly)))
+	}
+
+	between := expression.Key(table.SortKey).Between(expression.Value(from), expression.Value(to))
+	before := expression.Name(table.SortKey).LessThan(expression.Value(to))
+	if filter.IsSet() {
+		before = before.And(filter)
+	}
+	return queryList(ctx, table, groups, &between, limit, pageToken, before, projection, out)
+}
+
+// listCursor is the position a page token resumes from: the group of partitions being read, the index key of
+// the last item taken from each of its partitions and the partitions read to their end
+type listCursor struct {
+	Group int                       `json:"g,omitempty"`
+	After map[string]map[string]any `json:"a,omitempty"`
+	Done  []string                  `json:"d,omitempty"`
+}
+
+// listPartition is the state of a partition of the ListIndex while a page is read
+type listPartition struct {
+	listKey   string
+	after     map[string]types.AttributeValue // Index key of the last item taken, where the next page resumes
+	next      map[string]types.AttributeValue // Where the next query reads from
+	items     []map[string]types.AttributeValue
+	exhausted bool
+}
+
+// queryList merges the partitions of each group of list keys in list order, one group after the other, until
+// the page is full
+func queryList(ctx context.Context, table ListedTable, groups [][]string, sortCondition *expression.KeyConditionBuilder, limit int, pageToken string, filter expression.ConditionBuilder, projection *expression.ProjectionBuilder, out any) (string, error) {
+	cursor, err := decodeListCursor(pageToken)
+	if err != nil {
+		return "", err
+	}
+	if projection != nil {
+		// The merge orders and resumes by the index key
+		withKeys := projection.AddNames(expression.Name(ListKeyAttribute), expression.Name(table.SortKey), expression.Name(table.Key))
+		projection = &withKeys
+	}
+
+	query := func(partition *listPartition) error {
+		condition := expression.Key(ListKeyAttribute).Equal(expression.Value(partition.listKey))
+		if sortCondition != nil {
+			condition = condition.And(*sortCondition)
+		}
+		builder := expression.NewBuilder().WithKeyCondition(condition)
+		if filter.IsSet() {
+			builder = builder.WithFilter(filter)
+		}
+		if projection != nil {
+			builder = builder.WithProjection(*projection)
+		}
+		expr, err := builder.Build()
+		if err != nil {
+			return err
+		}
+
+		input := &dynamodb.QueryInput{
+			TableName:                 aws.String(table.TableName),
+			IndexName:                 aws.String(ListIndex),
+			KeyConditionExpression:    expr.KeyCondition(),
+			FilterExpression:          expr.Filter(),
+			ProjectionExpression:      expr.Projection(),
+			ExpressionAttributeNames:  expr.Names(),
+			ExpressionAttributeValues: expr.Values(),
+			ExclusiveStartKey:         partition.next,
+		}
+		if limit > 0 {
+			input.Limit = aws.Int32(int32(limit))
+		}
+		result, err := shared.DynamoDBClient.Query(ctx, input)
+		if err != nil {
+			return err
+		}
+		partition.items, partition.next, partition.exhausted = result.Items, result.LastEvaluatedKey, result.LastEvaluatedKey == nil
+		return nil
+	}
+
+	var page []map[string]types.AttributeValue
+	for group := cursor.Group; group < len(groups); group++ {
+		partitions := make([]*listPartition, 0, len(groups[group]))
+		for _, listKey := range groups[group] {
+			partition := &listPartition{listKey: listKey}
+			if group == cursor.Group {
+				partition.exhausted = slices.Contains(cursor.Done, listKey)
+				if after, ok := cursor.After[listKey]; ok {
+					if partition.after, err = attributevalue.MarshalMap(after); err != nil {
+						return "", fmt.Errorf("invalid page token: %w", err)
+					}
+					partition.next = partition.after
+				}
+			}
+			partitions = append(partitions, partition)
+		}
+
+		for limit <= 0 || len(page) < limit {
+			var head *listPartition
+			for _, partition := range partitions {
+				// A filtered query may return no items before the partition's end
+				for len(partition.items) == 0 && !partition.exhausted {
+					if err := query(partition); err != nil {
+						return "", err
+					}
+				}
+				if len(partition.items) > 0 && (head == nil || table.compare(partition.items[0], head.items[0]) < 0) {
+					head = partition
+				}
+			}
+			if head == nil {
+				break
+			}
+			page = append(page, head.items[0])
+			head.after = table.indexKey(head.items[0])
+			head.items = head.items[1:]
+		}
+
+		if limit > 0 && len(page) >= limit {
+			token, err := encodeListCursor(group, len(groups), partitions)
+			if err != nil {
+				return "", err
+			}
+			return token, attributevalue.UnmarshalListOfMaps(page, out)
+		}
+	}
+	return "", attributevalue.UnmarshalListOfMaps(page, out)
+}
+
+// encodeListCursor encodes where the next page resumes as an opaque token, empty when every group is read
+func encodeListCursor(group, groups int, partitions []*listPartition) (string, error) {
+	cursor := listCursor{Group: group, After: make(map[string]map[string]any)}
+	for _, partition := range partitions {
+		if partition.exhausted && len(partition.items) == 0 {
+			cursor.Done = append(cursor.Done, partition.listKey)
+			continue
+		}
+		if partition.after == nil {
+			continue
+		}
+		var values map[string]any
+		if err := attributevalue.UnmarshalMap(partition.after, &values); err != nil {
+			return "", err
+		}
+		cursor.After[partition.listKey] = values
+	}
+	if len(cursor.Done) == len(partitions) {
+		if group+1 == groups {
+			return "", nil
+		}
+		cursor = listCursor{Group: group + 1}
+	}
+
+	data, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeListCursor decodes a token of encodeListCursor, the start of the list when it is empty
+func decodeListCursor(token string) (listCursor, error) {
+	var cursor listCursor
+	if token == "" {
+		return cursor, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return listCursor{}, fmt.Errorf("invalid page token: %w", err)
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return listCursor{}, fmt.Errorf("invalid page token: %w", err)
+	}
+	return cursor, nil
+}
+
+// compareAttributes orders two string or number attribute values
+func compareAttributes(a, b types.AttributeValue) int {
+	an, aNumber := a.(*types.AttributeValueMemberN)
+	bn, bNumber := b.(*types.AttributeValueMemberN)
+	if aNumber && bNumber {
+		x, _ := strconv.ParseFloat(an.Value, 64)
+		y, _ := strconv.ParseFloat(bn.Value, 64)
+		return cmp.Compare(x, y)
+	}
+	return strings.Compare(attributeString(a), attributeString(b))
+}
+
+// attributeString returns the value of a string or number attribute, empty for other types
+func attributeString(value types.AttributeValue) string {
+	switch v := value.(type) {
+	case *types.AttributeValueMemberS:
+		return v.Value
+	case *types.AttributeValueMemberN:
+		return v.Value
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"notification-service/functions/shared"
+)
+
+// Email is an email with an HTML body and its plain-text alternative
+type Email struct {
+	From     string
+	To       string
+	ReplyTo  string // Optional
+	Subject  string
+	HTMLBody string
+	TextBody string
+	Headers  map[string]string // Custom headers such as List-Unsubscribe, optional
+
+	// Threading headers, all optional
+	MessageID  string   // Message-ID header, providers that assign their own ignore it
+	InReplyTo  string   // Message-ID of the email this one follows up
+	References []string // Message-IDs of the thread, oldest first
+}
+
+// IsThreaded reports whether the email carries threading headers
+func (e Email) IsThreaded() bool {
+	return e.InReplyTo != "" || len(e.References) > 0
+}
+
+// IdentityVerification is whether a provider may send from an address or domain
+type IdentityVerification struct {
+	Identity string `json:"identity"`
+	Verified bool   `json:"verified"`
+	Status   string `json:"status"` // The provider's own status, e.g. "Pending" or "domain authenticated"
+}
+
+// EmailQuota is how much a provider account may still send
+type EmailQuota struct {
+	Limit       int64   `json:"limit"` // Emails per period, -1 when unlimited
+	Used        int64   `json:"used"`
+	Remaining   int64   `json:"remaining"` // -1 when unlimited
+	Period      string  `json:"period"`    // e.g. "24h" or "monthly"
+	MaxSendRate float64 `json:"maxSendRate,omitempty"`
+}
+
+// EmailProvider sends email through one provider account
+type EmailProvider interface {
+	// Name returns the provider, e.g. "ses"
+	Name() string
+	// Send sends the email and returns the provider's message ID
+	Send(ctx context.Context, email Email) (string, error)
+	// MessageIDHeader returns the Message-ID header of an email the provider sent under its message ID
+	MessageIDHeader(email Email, messageID string) string
+	// VerifyIdentity reports whether the account may send from an email address, directly or through its domain
+	VerifyIdentity(ctx context.Context, identity string) (IdentityVerification, error)
+	// Quota returns the account's sending quota
+	Quota(ctx context.Context) (EmailQuota, error)
+}
+
+// NewEmailProvider returns the provider the email settings select, the service's SES account by default
+func NewEmailProvider(settings shared.EmailSettings) (EmailProvider, error) {
+	switch settings.ProviderName() {
+	case shared.EmailProviderSES:
+		return sesProvider{}, nil
+	case shared.EmailProviderSendGrid:
+		if settings.SendGridAPIKey == "" {
+			return nil, fmt.Errorf("no SendGrid API key configured")
+		}
+		return newSendGridProvider(settings.SendGridAPIKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported email provider: %s", settings.Provider)
+	}
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"notification-service/functions/shared"
+	"os"
+	"strings"
+)
+
+// defaultSendGridAPIURL is the SendGrid API, SENDGRID_API_URL points at another region such as https://api.eu.sendgrid.com
+const defaultSendGridAPIURL = "https://api.sendgrid.com"
+
+// sendGridProvider sends through a tenant's own SendGrid account
+type sendGridProvider struct {
+	apiKey  string
+	baseURL string
+}
+
+func newSendGridProvider(apiKey string) sendGridProvider {
+	baseURL := os.Getenv("SENDGRID_API_URL")
+	if baseURL == "" {
+		baseURL = defaultSendGridAPIURL
+	}
+	return sendGridProvider{apiKey: apiKey, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+func (sendGridProvider) Name() string {
+	return shared.EmailProviderSendGrid
+}
+
+// sendGridAddress is an address of the v3 mail send API
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// toSendGridAddress splits an address such as "Alerts <alerts@example.com>" into its email and display name
+func toSendGridAddress(address string) sendGridAddress {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return sendGridAddress{Email: address}
+	}
+	return sendGridAddress{Email: parsed.Address, Name: parsed.Name}
+}
+
+// Send sends the email with the v3 mail send API and returns the SendGrid message ID
+func (p sendGridProvider) Send(ctx context.Context, email Email) (string, error) {
+	from := toSendGridAddress(email.From)
+	message := map[string]any{
+		"personalizations": []map[string]any{{"to": []sendGridAddress{toSendGridAddress(email.To)}}},
+		"from":             from,
+		"subject":          email.Subject,
+		// SendGrid requires the plain-text part first
+		"content": []map[string]string{
+			{"type": "text/plain", "value": email.TextBody},
+			{"type": "text/html", "value": email.HTMLBody},
+		},
+	}
+	if email.ReplyTo != "" {
+		message["reply_to"] = toSendGridAddress(email.ReplyTo)
+	}
+	if headers := sendGridHeaders(email); len(headers) > 0 {
+		message["headers"] = headers
+	}
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := p.do(ctx, http.MethodPost, "/v3/mail/send", payload)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return "", sendGridError(resp)
+	}
+	return resp.Header.Get("X-Message-Id"), nil
+}
+
+// sendGridHeaders returns the custom and threading headers of the email, SendGrid keeps a Message-ID given to it
+func sendGridHeaders(email Email) map[string]string {
+	headers := make(map[string]string)
+	for name, value := range email.Headers {
+		headers[name] = headerValue(value)
+	}
+	if email.MessageID != "" {
+		headers["Message-ID"] = email.MessageID
+	}
+	if email.InReplyTo != "" {
+		headers["In-Reply-To"] = email.InReplyTo
+	}
+	if len(email.References) > 0 {
+		headers["References"] = strings.Join(email.References, " ")
+	}
+	return headers
+}
+
+// MessageIDHeader returns the Message-ID the email was sent with
+func (sendGridProvider) MessageIDHeader(email Email, _ string) string {
+	return email.MessageID
+}
+
+// VerifyIdentity checks the address's domain authentication, then whether the address is a verified single sender
+func (p sendGridProvider) VerifyIdentity(ctx context.Context, identity string) (IdentityVerification, error) {
+	address := toSendGridAddress(identity).Email
+	verification := IdentityVerification{Identity: address, Status: "not verified"}
+
+	if domain := shared.EmailDomain(address); domain != "" {
+		var domains []struct {
+			Domain string `json:"domain"`
+			Valid  bool   `json:"valid"`
+		}
+		if err := p.getJSON(ctx, "/v3/whitelabel/domains?domain="+url.QueryEscape(domain), &domains); err != nil {
+			return IdentityVerification{}, err
+		}
+		for _, authenticated := range domains {
+			if strings.EqualFold(authenticated.Domain, domain) && authenticated.Valid {
+				verification.Verified = true
+				verification.Status = "domain authenticated"
+				return verification, nil
+			}
+		}
+	}
+
+	var senders struct {
+		Results []struct {
+			FromEmail string `json:"from_email"`
+			Verified  bool   `json:"verified"`
+		} `json:"results"`
+	}
+	if err := p.getJSON(ctx, "/v3/verified_senders", &senders); err != nil {
+		return IdentityVerification{}, err
+	}
+	for _, sender := range senders.Results {
+		if !strings.EqualFold(sender.FromEmail, address) {
+			continue
+		}
+		if sender.Verified {
+			verification.Verified = true
+			verification.Status = "sender verified"
+		} else {
+			verification.Status = "sender verification pending"
+		}
+		break
+	}
+	return verification, nil
+}
+
+// Quota returns the account's email credits for the current reset period
+func (p sendGridProvider) Quota(ctx context.Context) (EmailQuota, error) {
+	var credits struct {
+		Total          int64  `json:"total"`
+		Used           int64  `json:"used"`
+		Remain         int64  `json:"remain"`
+		ResetFrequency string `json:"reset_frequency"`
+	}
+	if err := p.getJSON(ctx, "/v3/user/credits", &credits); err != nil {
+		return EmailQuota{}, err
+	}
+	return EmailQuota{
+		Limit:     credits.Total,
+		Used:      credits.Used,
+		Remaining: credits.Remain,
+		Period:    credits.ResetFrequency,
+	}, nil
+}
+
+// getJSON reads a JSON response of the API into out
+func (p sendGridProvider) getJSON(ctx context.Context, path string, out any) error {
+	resp, err := p.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return sendGridError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// do sends an authenticated request to the API
+func (p sendGridProvider) do(ctx context.Context, method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return shared.GetHTTPClient(shared.HTTPProviderSendGrid).Do(req)
+}
+
+// sendGridError describes a failed API call with the start of SendGrid's error body
+func sendGridError(resp *http.Response) error {
+	reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+	return fmt.Errorf("sendgrid returned %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+}
@@ -0,0 +1,233 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"notification-service/functions/shared"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ses"
+	"github.com/aws/aws-sdk-go-v2/service/ses/types"
+)
+
+// sesProvider sends through the service's SES account
+type sesProvider struct{}
+
+func (sesProvider) Name() string {
+	return shared.EmailProviderSES
+}
+
+// Send sends the email and returns the SES message ID. Threaded emails and those with custom headers are sent
+// raw, SendEmail cannot set their headers
+func (sesProvider) Send(ctx context.Context, email Email) (string, error) {
+	if email.IsThreaded() || len(email.Headers) > 0 {
+		return sendRawEmail(ctx, email)
+	}
+
+	input := &ses.SendEmailInput{
+		Source:      aws.String(email.From),
+		Destination: &types.Destination{ToAddresses: []string{email.To}},
+		Message: &types.Message{
+			Subject: &types.Content{Data: aws.String(email.Subject), Charset: aws.String("UTF-8")},
+			Body: &types.Body{
+				Html: &types.Content{Data: aws.String(email.HTMLBody), Charset: aws.String("UTF-8")},
+				Text: &types.Content{Data: aws.String(email.TextBody), Charset: aws.String("UTF-8")},
+			},
+		},
+	}
+	if email.ReplyTo != "" {
+		input.ReplyToAddresses = []string{email.ReplyTo}
+	}
+	input.ConfigurationSetName = configurationSet()
+
+	out, err := shared.SESClient.SendEmail(ctx, input)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.MessageId), nil
+}
+
+// sendRawEmail sends the email as a MIME message with its threading and custom headers and returns the SES message ID
+func sendRawEmail(ctx context.Context, email Email) (string, error) {
+	raw, err := buildRawEmail(email)
+	if err != nil {
+		return "", err
+	}
+	out, err := shared.SESClient.SendRawEmail(ctx, &ses.SendRawEmailInput{
+		RawMessage:           &types.RawMessage{Data: raw},
+		ConfigurationSetName: configurationSet(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.MessageId), nil
+}
+
+// configurationSet returns the configuration set emails are sent with, which publishes their bounces to
+// the bounce handler. Nil sends without one
+func configurationSet() *string {
+	if shared.SESConfigurationSet == "" {
+		return nil
+	}
+	return aws.String(shared.SESConfigurationSet)
+}
+
+// buildRawEmail builds the multipart/alternative MIME message of the email, the plain-text part first
+func buildRawEmail(email Email) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain", email.TextBody},
+		{"text/html", email.HTMLBody},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType + "; charset=UTF-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		encoder := quotedprintable.NewWriter(writer)
+		if _, err := encoder.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	writeHeader := func(name, value string) {
+		if value != "" {
+			raw.WriteString(name + ": " + headerValue(value) + "\r\n")
+		}
+	}
+	writeHeader("From", email.From)
+	writeHeader("To", email.To)
+	writeHeader("Reply-To", email.ReplyTo)
+	writeHeader("Subject", mime.QEncoding.Encode("UTF-8", email.Subject))
+	writeHeader("In-Reply-To", email.InReplyTo)
+	writeHeader("References", strings.Join(email.References, " "))
+	for _, name := range slices.Sorted(maps.Keys(email.Headers)) {
+		writeHeader(name, mime.QEncoding.Encode("UTF-8", email.Headers[name]))
+	}
+	writeHeader("MIME-Version", "1.0")
+	writeHeader("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	raw.WriteString("\r\n")
+	raw.Write(body.Bytes())
+	return raw.Bytes(), nil
+}
+
+// headerValue keeps a header value on its line
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+// MessageIDHeader returns the Message-ID SES gave the email, SES replaces any Message-ID set on it
+func (sesProvider) MessageIDHeader(_ Email, messageID string) string {
+	if messageID == "" {
+		return ""
+	}
+	domain := "email.amazonses.com"
+	if shared.Region != "" && shared.Region != "us-east-1" {
+		domain = shared.Region + ".amazonses.com"
+	}
+	return "<" + messageID + "@" + domain + ">"
+}
+
+// VerifyIdentity checks the address and its domain, SES sends from either once it is verified
+func (sesProvider) VerifyIdentity(ctx context.Context, identity string) (IdentityVerification, error) {
+	if parsed, err := mail.ParseAddress(identity); err == nil {
+		identity = parsed.Address
+	}
+	domain := shared.EmailDomain(identity)
+	identities := []string{identity}
+	if domain != "" && domain != identity {
+		identities = append(identities, domain)
+	}
+	attributes, err := SesGetIdentityVerification(ctx, identities)
+	if err != nil {
+		return IdentityVerification{}, err
+	}
+
+	verification := IdentityVerification{Identity: identity, Status: "NotFound"}
+	for _, candidate := range identities {
+		attribute, ok := attributes[candidate]
+		if !ok {
+			continue
+		}
+		if attribute.VerificationStatus == types.VerificationStatusSuccess {
+			verification.Verified = true
+			verification.Status = string(attribute.VerificationStatus)
+			break
+		}
+		if verification.Status == "NotFound" {
+			verification.Status = string(attribute.VerificationStatus)
+		}
+	}
+	return verification, nil
+}
+
+// Quota returns the account's 24 hour sending quota
+func (sesProvider) Quota(ctx context.Context) (EmailQuota, error) {
+	out, err := shared.SESClient.GetSendQuota(ctx, &ses.GetSendQuotaInput{})
+	if err != nil {
+		return EmailQuota{}, err
+	}
+	quota := EmailQuota{
+		Limit:       int64(out.Max24HourSend),
+		Used:        int64(out.SentLast24Hours),
+		Remaining:   int64(out.Max24HourSend - out.SentLast24Hours),
+		Period:      "24h",
+		MaxSendRate: out.MaxSendRate,
+	}
+	if out.Max24HourSend < 0 {
+		quota.Limit, quota.Remaining = -1, -1
+	}
+	return quota, nil
+}
+
+// SesGetIdentityVerification returns the verification attributes of the identities SES knows about.
+// Identities that were never added to SES are missing from the result
+func SesGetIdentityVerification(ctx context.Context, identities []string) (map[string]types.IdentityVerificationAttributes, error) {
+	out, err := shared.SESClient.GetIdentityVerificationAttributes(ctx, &ses.GetIdentityVerificationAttributesInput{
+		Identities: identities,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.VerificationAttributes, nil
+}
+
+// SesGetIdentityDkim returns the DKIM signing attributes of the identities
+func SesGetIdentityDkim(ctx context.Context, identities []string) (map[string]types.IdentityDkimAttributes, error) {
+	out, err := shared.SESClient.GetIdentityDkimAttributes(ctx, &ses.GetIdentityDkimAttributesInput{
+		Identities: identities,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.DkimAttributes, nil
+}
+
+// SesGetIdentityMailFrom returns the custom MAIL FROM domain attributes of the identities
+func SesGetIdentityMailFrom(ctx context.Context, identities []string) (map[string]types.IdentityMailFromDomainAttributes, error) {
+	out, err := shared.SESClient.GetIdentityMailFromDomainAttributes(ctx, &ses.GetIdentityMailFromDomainAttributesInput{
+		Identities: identities,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.MailFromDomainAttributes, nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"notification-service/functions/shared"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// SnsSendSMS sends a transactional SMS to an E.164 phone number and returns the SNS message ID.
+// senderID is optional, the account's default sender is used without one
+func SnsSendSMS(ctx context.Context, phoneNumber, senderID, message string) (string, error) {
+	attributes := map[string]types.MessageAttributeValue{
+		"AWS.SNS.SMS.SMSType": {DataType: aws.String("String"), StringValue: aws.String("Transactional")},
+	}
+	if senderID != "" {
+		attributes["AWS.SNS.SMS.SenderID"] = types.MessageAttributeValue{DataType: aws.String("String"), StringValue: aws.String(senderID)}
+	}
+
+	out, err := shared.SNSClient.Publish(ctx, &sns.PublishInput{
+		PhoneNumber:       aws.String(phoneNumber),
+		Message:           aws.String(message),
+		MessageAttributes: attributes,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.MessageId), nil
+}
+
+// SnsCreatePlatformEndpoint registers a device token with an SNS platform application and returns the
+// endpoint ARN. Registering a token again returns its existing endpoint, which is re-enabled with the token
+// in case the platform had disabled it
+func SnsCreatePlatformEndpoint(ctx context.Context, platformApplicationARN, token string) (string, error) {
+	out, err := shared.SNSClient.CreatePlatformEndpoint(ctx, &sns.CreatePlatformEndpointInput{
+		PlatformApplicationArn: aws.String(platformApplicationARN),
+		Token:                  aws.String(token),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	endpointARN := aws.ToString(out.EndpointArn)
+	_, err = shared.SNSClient.SetEndpointAttributes(ctx, &sns.SetEndpointAttributesInput{
+		EndpointArn: aws.String(endpointARN),
+		Attributes: map[string]string{
+			"Enabled": "true",
+			"Token":   token,
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	return endpointARN, nil
+}
+
+// SnsPublishToEndpoint sends a push message built by shared.BuildPushMessage to a platform endpoint and
+// returns the SNS message ID
+func SnsPublishToEndpoint(ctx context.Context, endpointARN, message string) (string, error) {
+	out, err := shared.SNSClient.Publish(ctx, &sns.PublishInput{
+		TargetArn:        aws.String(endpointARN),
+		Message:          aws.String(message),
+		MessageStructure: aws.String("json"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.MessageId), nil
+}
+
+// SnsDeleteEndpoint deletes a platform endpoint, deleting one that no longer exists succeeds
+func SnsDeleteEndpoint(ctx context.Context, endpointARN string) error {
+	_, err := shared.SNSClient.DeleteEndpoint(ctx, &sns.DeleteEndpointInput{
+		EndpointArn: aws.String(endpointARN),
+	})
+	return err
+}
+
+// IsStaleEndpoint reports whether a publish failed because the platform no longer accepts the device's token,
+// after the app was uninstalled or the token rotated
+func IsStaleEndpoint(err error) bool {
+	var disabled *types.EndpointDisabledException
+	var notFound *types.NotFoundException
+	return errors.As(err, &disabled) || errors.As(err, &notFound)
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"notification-service/functions/shared"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// sqsMaxBatchSize is the largest batch SendMessageBatch accepts
+const sqsMaxBatchSize = 10
+
+// SqsSendError is returned when messages could not be sent. Batches are sent in order and sending stops at the
+// first batch that failed, so callers can tell the messages that were queued from the ones that were not
+type SqsSendError struct {
+	Unsent []int // Indexes of the bodies that were not sent, ascending
+	Err    error
+}
+
+func (e *SqsSendError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SqsSendError) Unwrap() error {
+	return e.Err
+}
+
+// SqsSendMessages sends the message bodies to the queue in batches. When a batch fails, its failed messages and
+// every later one are reported unsent in an SqsSendError
+func SqsSendMessages(ctx context.Context, queueURL string, bodies []string) error {
+	for start := 0; start < len(bodies); start += sqsMaxBatchSize {
+		end := min(start+sqsMaxBatchSize, len(bodies))
+
+		entries := make([]types.SendMessageBatchRequestEntry, 0, end-start)
+		for i, body := range bodies[start:end] {
+			entries = append(entries, types.SendMessageBatchRequestEntry{
+				Id:          aws.String(strconv.Itoa(i)),
+				MessageBody: aws.String(body),
+			})
+		}
+
+		out, err := shared.SQSClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			return &SqsSendError{Unsent: indexRange(start, len(bodies)), Err: err}
+		}
+		if len(out.Failed) > 0 {
+			var unsent []int
+			for _, failed := range out.Failed {
+				i, err := strconv.Atoi(aws.ToString(failed.Id))
+				if err != nil || i < 0 || i >= len(entries) {
+					// An entry that cannot be matched leaves the whole batch in doubt
+					unsent = indexRange(start, end)
+					break
+				}
+				unsent = append(unsent, start+i)
+			}
+			slices.Sort(unsent)
+			unsent = slices.Compact(unsent)
+			return &SqsSendError{
+				Unsent: append(unsent, indexRange(end, len(bodies))...),
+				Err:    fmt.Errorf("failed to send %d of %d messages: %s", len(out.Failed), len(entries), aws.ToString(out.Failed[0].Message)),
+			}
+		}
+	}
+	return nil
+}
+
+// indexRange returns the indexes from start up to, not including, end
+func indexRange(start, end int) []int {
+	indexes := make([]int, 0, max(end-start, 0))
+	for i := start; i < end; i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// EnqueueNotificationRequests queues notification requests as JSON messages on the notification queue. An
+// SqsSendError indexes the requests that were not queued
+func EnqueueNotificationRequests(ctx context.Context, requests []shared.NotificationRequest) error {
+	bodies := make([]string, 0, len(requests))
+	for _, request := range requests {
+		body, err := json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request %s: %w", request.ID, err)
+		}
+		bodies = append(bodies, string(body))
+	}
+	return SqsSendMessages(ctx, shared.NotificationQueueURL, bodies)
+}
+
+// SendNotificationAt queues the notification request at once when at has passed, otherwise it creates
+// the one-time schedule scheduleID that queues it then. A schedule already created under that ID is kept,
+// so a retried call does not fail
+func SendNotificationAt(ctx context.Context, userID, scheduleID string, at time.Time, request shared.NotificationRequest) error {
+	if !at.After(shared.GetCurrentTime()) {
+		return EnqueueNotificationRequests(ctx, []shared.NotificationRequest{request})
+	}
+	err := shared.CreateOneTimeEventBridgeSchedule(ctx, userID, scheduleID, at, request)
+	if err != nil && !shared.IsScheduleConflict(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"notification-service/functions/shared"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// fakeSQS answers SendMessageBatch calls, failing the entries failEntries lists for the call with that index
+// and every call from failCall on
+type fakeSQS struct {
+	calls       int
+	failEntries map[int][]string
+	failCall    int
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Entries []struct{ Id string }
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	call := f.calls
+	f.calls++
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	if f.failCall > 0 && call >= f.failCall {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"__type": "com.amazonaws.sqs#InternalError", "message": "internal error"})
+		return
+	}
+	successful, failed := []map[string]any{}, []map[string]any{}
+	for _, entry := range input.Entries {
+		if slices.Contains(f.failEntries[call], entry.Id) {
+			failed = append(failed, map[string]any{"Id": entry.Id, "Code": "InternalError", "Message": "entry failed", "SenderFault": false})
+			continue
+		}
+		successful = append(successful, map[string]any{"Id": entry.Id, "MessageId": "message-" + entry.Id, "MD5OfMessageBody": "unchecked"})
+	}
+	json.NewEncoder(w).Encode(map[string]any{"Successful": successful, "Failed": failed})
+}
+
+func TestSqsSendMessagesReportsUnsent(t *testing.T) {
+	bodies := make([]string, 25)
+	for i := range bodies {
+		bodies[i] = strconv.Itoa(i)
+	}
+	tests := []struct {
+		name       string
+		fake       *fakeSQS
+		wantUnsent []int
+	}{
+		{name: "all sent", fake: &fakeSQS{}},
+		{name: "entry of the second batch failed", fake: &fakeSQS{failEntries: map[int][]string{1: {"3", "1"}}}, wantUnsent: []int{11, 13, 20, 21, 22, 23, 24}},
+		{name: "third batch failed", fake: &fakeSQS{failCall: 2}, wantUnsent: []int{20, 21, 22, 23, 24}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.fake)
+			defer server.Close()
+			previous := shared.SQSClient
+			shared.SQSClient = sqs.New(sqs.Options{
+				Region:                           "us-east-1",
+				BaseEndpoint:                     aws.String(server.URL),
+				Credentials:                      aws.AnonymousCredentials{},
+				RetryMaxAttempts:                 1,
+				DisableMessageChecksumValidation: true,
+			})
+			defer func() { shared.SQSClient = previous }()
+
+			err := SqsSendMessages(context.Background(), server.URL+"/queue", bodies)
+			if tt.wantUnsent == nil {
+				if err != nil {
+					t.Fatalf("SqsSendMessages() error = %v", err)
+				}
+				return
+			}
+			var sendErr *SqsSendError
+			if !errors.As(err, &sendErr) || !reflect.DeepEqual(sendErr.Unsent, tt.wantUnsent) {
+				t.Fatalf("SqsSendMessages() error = %#v, want unsent %v", err, tt.wantUnsent)
+			}
+		})
+	}
+}
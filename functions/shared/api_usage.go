@@ -0,0 +1,85 @@
+package shared
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// AnonymousCaller is the usage caller of requests without a Cognito identity
+const AnonymousCaller = "anonymous"
+
+// defaultUsageRetentionDays is how long daily usage counters are kept unless USAGE_RETENTION_DAYS is set
+const defaultUsageRetentionDays = 90
+
+// BuildUsageKey builds the sort key of a caller's usage of an endpoint
+func BuildUsageKey(userID, endpoint string) string {
+	return userID + "#" + endpoint
+}
+
+// UsageEndpoint names the endpoint of an API request by its method and resource path, so calls to
+// /templates/alert%23email and /templates/report%23slack are counted together
+func UsageEndpoint(event events.APIGatewayProxyRequest) string {
+	resource := event.Resource
+	if resource == "" {
+		resource = event.Path
+	}
+	return event.HTTPMethod + " " + resource
+}
+
+// RecordAPIUsage adds an API call to the caller's daily counter of the endpoint. Counting fails open:
+// a usage table outage is logged and never fails the call
+func RecordAPIUsage(ctx context.Context, event events.APIGatewayProxyRequest, statusCode int) {
+	if UsageTable == "" || DynamoDBClient == nil {
+		return
+	}
+
+	userID := AnonymousCaller
+	if userContext, err := GetUserContext(event.RequestContext); err == nil {
+		userID = userContext.UserID
+	}
+	endpoint := UsageEndpoint(event)
+	now := GetCurrentTime()
+	expiresAt := int(now.AddDate(0, 0, GetEnvInt("USAGE_RETENTION_DAYS", defaultUsageRetentionDays)).Unix())
+
+	errorCount := 0
+	// A handler error without a response reaches the client as a 502
+	if statusCode == 0 || statusCode >= http.StatusBadRequest {
+		errorCount = 1
+	}
+
+	update := expression.Add(expression.Name("count"), expression.Value(1)).
+		Add(expression.Name("errorCount"), expression.Value(errorCount)).
+		Set(expression.Name("userId"), expression.Value(userID)).
+		Set(expression.Name("endpoint"), expression.Value(endpoint)).
+		Set(expression.Name("expiresAt"), expression.IfNotExists(expression.Name("expiresAt"), expression.Value(expiresAt)))
+	expr, err := expression.NewBuilder().WithUpdate(update).Build()
+	if err != nil {
+		LogWarn(ctx).Err(err).Msg("Failed to build API usage update")
+		return
+	}
+	key, err := attributevalue.MarshalMap(map[string]string{
+		"date":     now.Format(DateFormat),
+		"usageKey": BuildUsageKey(userID, endpoint),
+	})
+	if err != nil {
+		LogWarn(ctx).Err(err).Msg("Failed to build API usage key")
+		return
+	}
+
+	_, err = DynamoDBClient.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(UsageTable),
+		Key:                       key,
+		UpdateExpression:          expr.Update(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+	})
+	if err != nil {
+		LogWarn(ctx).Err(err).Str("endpoint", endpoint).Int("status", statusCode).Msg("Failed to record API usage")
+	}
+}
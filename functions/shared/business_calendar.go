@@ -0,0 +1,127 @@
+package shared
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	_ "time/tzdata" // Lambda runtimes do not ship a timezone database
+)
+
+const defaultWorkdayStart = "09:00"
+
+// DeferredScheduleIDPrefix marks the one-time schedules that re-queue deferred notifications
+const DeferredScheduleIDPrefix = "deferred-"
+
+var (
+	defaultWorkingDays   = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+	defaultDeferredTypes = []string{NotificationTypeReport, NotificationTypeNotification}
+)
+
+// IsEnabled reports whether the business calendar should be applied
+func (c CalendarSettings) IsEnabled() bool {
+	return c.Enabled != nil && *c.Enabled
+}
+
+// IsEmpty reports whether no calendar field is set
+func (c CalendarSettings) IsEmpty() bool {
+	return c.Enabled == nil && c.Timezone == "" && len(c.WorkingDays) == 0 && len(c.Holidays) == 0 && c.WorkdayStart == "" && len(c.DeferredTypes) == 0
+}
+
+// Validate checks the timezone, working days, holidays, workday start and deferred types
+func (c CalendarSettings) Validate() error {
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid timezone: %s", c.Timezone)
+	}
+	for _, day := range c.WorkingDays {
+		if _, ok := parseWeekday(day); !ok {
+			return fmt.Errorf("invalid working day: %s", day)
+		}
+	}
+	for _, holiday := range c.Holidays {
+		if _, err := time.Parse(DateFormat, holiday); err != nil {
+			return fmt.Errorf("invalid holiday date: %s", holiday)
+		}
+	}
+	if c.WorkdayStart != "" {
+		if _, err := time.Parse("15:04", c.WorkdayStart); err != nil {
+			return fmt.Errorf("invalid workday start: %s", c.WorkdayStart)
+		}
+	}
+	for _, notificationType := range c.DeferredTypes {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid deferred type: %s", notificationType)
+		}
+	}
+	return nil
+}
+
+// ShouldDefer reports whether a notification type is deferred on non-working days
+func (c CalendarSettings) ShouldDefer(notificationType string) bool {
+	if !c.IsEnabled() {
+		return false
+	}
+	if len(c.DeferredTypes) == 0 {
+		return slices.Contains(defaultDeferredTypes, notificationType)
+	}
+	return slices.Contains(c.DeferredTypes, notificationType)
+}
+
+// IsWorkingDay reports whether t falls on a working day that is not a holiday
+func (c CalendarSettings) IsWorkingDay(t time.Time) bool {
+	local := t.In(c.location())
+	if slices.Contains(c.Holidays, local.Format(DateFormat)) {
+		return false
+	}
+	return slices.Contains(c.workingDays(), local.Weekday())
+}
+
+// NextWorkingTime returns the start of the next working day after t.
+// The zero time is returned when the calendar has no working days
+func (c CalendarSettings) NextWorkingTime(t time.Time) time.Time {
+	start, _ := time.Parse("15:04", c.WorkdayStart)
+	if c.WorkdayStart == "" {
+		start, _ = time.Parse("15:04", defaultWorkdayStart)
+	}
+
+	local := t.In(c.location())
+	// Holidays can chain onto weekends, but never for more than a year
+	for i := 1; i <= 366; i++ {
+		day := local.AddDate(0, 0, i)
+		if c.IsWorkingDay(day) {
+			return time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, day.Location())
+		}
+	}
+	return time.Time{}
+}
+
+func (c CalendarSettings) location() *time.Location {
+	location, err := time.LoadLocation(c.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+func (c CalendarSettings) workingDays() []time.Weekday {
+	if len(c.WorkingDays) == 0 {
+		return defaultWorkingDays
+	}
+
+	days := make([]time.Weekday, 0, len(c.WorkingDays))
+	for _, day := range c.WorkingDays {
+		if weekday, ok := parseWeekday(day); ok {
+			days = append(days, weekday)
+		}
+	}
+	return days
+}
+
+func parseWeekday(day string) (time.Weekday, bool) {
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		if strings.EqualFold(weekday.String(), day) {
+			return weekday, true
+		}
+	}
+	return time.Sunday, false
+}
@@ -0,0 +1,210 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half_open"
+)
+
+const (
+	defaultChannelTimeout          = 15 * time.Second
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned when a channel call is rejected by an open circuit
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// RejectedError is a failure caused by the request rather than the provider, such as a post to a revoked
+// webhook. The provider answered, so it fails the call without counting against the circuit breaker
+type RejectedError struct {
+	Err error
+}
+
+func (e *RejectedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RejectedError) Unwrap() error {
+	return e.Err
+}
+
+// CircuitBreaker stops calling a failing channel after a number of consecutive failures
+// and lets a single probe through once the open period has elapsed
+type CircuitBreaker struct {
+	Name             string
+	FailureThreshold int
+	OpenDuration     time.Duration
+
+	mu            sync.Mutex
+	state         string
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+}
+
+// NewCircuitBreaker creates a closed circuit breaker
+func NewCircuitBreaker(name string, failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		Name:             name,
+		FailureThreshold: failureThreshold,
+		OpenDuration:     openDuration,
+		state:            CircuitClosed,
+	}
+}
+
+// Allow reports whether a call may proceed
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.OpenDuration {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.probeInFlight = true
+		LogInfo(context.Background()).Str("circuit", cb.Name).Msg("Circuit breaker half-open, sending probe")
+		return true
+	case CircuitHalfOpen:
+		if cb.probeInFlight {
+			return false
+		}
+		cb.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+// RecordSuccess closes the circuit and resets the failure count
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state != CircuitClosed {
+		LogInfo(context.Background()).Str("circuit", cb.Name).Msg("Circuit breaker closed")
+	}
+	cb.state = CircuitClosed
+	cb.failures = 0
+	cb.probeInFlight = false
+}
+
+// RecordFailure counts a failure and opens the circuit when the threshold is reached
+func (cb *CircuitBreaker) RecordFailure() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.failures++
+	cb.probeInFlight = false
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.FailureThreshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+		LogWarn(context.Background()).Str("circuit", cb.Name).Int("failures", cb.failures).Msg("Circuit breaker opened")
+	}
+}
+
+// State returns the current circuit state
+func (cb *CircuitBreaker) State() string {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+var (
+	channelBreakers   = map[string]*CircuitBreaker{}
+	channelBreakersMu sync.Mutex
+)
+
+// GetChannelCircuitBreaker returns the circuit breaker for a channel.
+// CIRCUIT_BREAKER_FAILURE_THRESHOLD and CIRCUIT_BREAKER_OPEN_SECONDS override the defaults
+func GetChannelCircuitBreaker(channel string) *CircuitBreaker {
+	channelBreakersMu.Lock()
+	defer channelBreakersMu.Unlock()
+
+	if breaker, ok := channelBreakers[channel]; ok {
+		return breaker
+	}
+
+	threshold := GetEnvInt("CIRCUIT_BREAKER_FAILURE_THRESHOLD", defaultCircuitFailureThreshold)
+	openDuration := time.Duration(GetEnvInt("CIRCUIT_BREAKER_OPEN_SECONDS", int(defaultCircuitOpenDuration.Seconds()))) * time.Second
+
+	breaker := NewCircuitBreaker(channel, threshold, openDuration)
+	channelBreakers[channel] = breaker
+	return breaker
+}
+
+// GetChannelTimeout returns the delivery timeout for a channel.
+// The timeout can be overridden with CHANNEL_TIMEOUT_<CHANNEL> (e.g. CHANNEL_TIMEOUT_SLACK=5s)
+func GetChannelTimeout(channel string) time.Duration {
+	return GetEnvDuration("CHANNEL_TIMEOUT_"+strings.ToUpper(channel), defaultChannelTimeout)
+}
+
+// breakerBypassKey marks a context whose channel calls skip the circuit breakers
+type breakerBypassKey struct{}
+
+// WithoutCircuitBreaker returns a context whose channel calls run within the channel timeout but neither
+// wait for nor count against the circuit breakers. Channel tests use it, so a misconfigured channel under
+// test does not trip the breaker every other delivery goes through
+func WithoutCircuitBreaker(ctx context.Context) context.Context {
+	return context.WithValue(ctx, breakerBypassKey{}, true)
+}
+
+// CallChannel runs fn for a channel guarded by the channel timeout and circuit breaker.
+// fn is abandoned once the timeout expires so a hung provider cannot block other channels
+func CallChannel(ctx context.Context, channel string, fn func(ctx context.Context) error) error {
+	return callGuarded(ctx, channel, GetChannelCircuitBreaker(channel), fn)
+}
+
+// CallChannelEndpoint is CallChannel with a circuit breaker per endpoint, for channels delivering to
+// endpoints run by different parties so one failing endpoint does not stop deliveries to the others
+func CallChannelEndpoint(ctx context.Context, channel, endpoint string, fn func(ctx context.Context) error) error {
+	return callGuarded(ctx, channel, GetChannelCircuitBreaker(channel+"#"+endpoint), fn)
+}
+
+// callGuarded runs fn behind the breaker, within the channel timeout
+func callGuarded(ctx context.Context, channel string, breaker *CircuitBreaker, fn func(ctx context.Context) error) error {
+	if bypass, _ := ctx.Value(breakerBypassKey{}).(bool); bypass {
+		breaker = nil
+	}
+	if breaker != nil && !breaker.Allow() {
+		return fmt.Errorf("channel %s: %w", channel, ErrCircuitOpen)
+	}
+
+	channelCtx, cancel := context.WithTimeout(ctx, GetChannelTimeout(channel))
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(channelCtx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-channelCtx.Done():
+		err = fmt.Errorf("channel %s timed out: %w", channel, channelCtx.Err())
+	}
+
+	if breaker == nil {
+		return err
+	}
+	var rejected *RejectedError
+	if err != nil && !errors.As(err, &rejected) {
+		breaker.RecordFailure()
+		return err
+	}
+	breaker.RecordSuccess()
+	return err
+}
@@ -0,0 +1,106 @@
+package shared
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Constants for notification categories
+const (
+	CategoryOperational    = "operational"     // Service messages, always delivered
+	CategoryProductUpdates = "product_updates" // Delivered until the user revokes consent
+	CategoryMarketing      = "marketing"       // Only delivered once the user has granted consent
+)
+
+// Constants for consent states in the consent report
+const (
+	ConsentGranted = "granted"
+	ConsentRevoked = "revoked"
+)
+
+// notificationTypeCategories is the category of each notification type, requests may name another one
+var notificationTypeCategories = map[string]string{
+	NotificationTypeAlert:        CategoryOperational,
+	NotificationTypeReport:       CategoryOperational,
+	NotificationTypeNotification: CategoryProductUpdates,
+}
+
+// CategoryConsent records a user's consent for one category. Both timestamps are kept so an audit can
+// tell when consent was last given and last withdrawn
+type CategoryConsent struct {
+	Granted   bool       `json:"granted" dynamodbav:"granted"`
+	GrantedAt *time.Time `json:"grantedAt,omitempty" dynamodbav:"grantedAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty" dynamodbav:"revokedAt,omitempty"`
+}
+
+// ValidateCategory validates if the category is valid
+func ValidateCategory(category string) bool {
+	return category == CategoryOperational || category == CategoryProductUpdates || category == CategoryMarketing
+}
+
+// NotificationCategory returns the category a request is delivered under: the one it names, or its type's
+func NotificationCategory(request NotificationRequest) string {
+	if request.Category != "" {
+		return request.Category
+	}
+	if category, ok := notificationTypeCategories[request.Type]; ok {
+		return category
+	}
+	return CategoryOperational
+}
+
+// ValidateConsentChanges checks that consent is only given or withdrawn for categories that need it
+func ValidateConsentChanges(changes map[string]bool) error {
+	for category := range changes {
+		if !ValidateCategory(category) {
+			return fmt.Errorf("invalid category: %s", category)
+		}
+		if category == CategoryOperational {
+			return fmt.Errorf("operational notifications do not require consent")
+		}
+	}
+	return nil
+}
+
+// ApplyConsentChanges returns the consent records with the changes applied. Only categories whose
+// consent actually changes get a new timestamp
+func ApplyConsentChanges(current map[string]CategoryConsent, changes map[string]bool, now time.Time) map[string]CategoryConsent {
+	updated := maps.Clone(current)
+	if updated == nil {
+		updated = make(map[string]CategoryConsent)
+	}
+	for _, category := range slices.Sorted(maps.Keys(changes)) {
+		granted := changes[category]
+		consent, exists := updated[category]
+		if exists && consent.Granted == granted {
+			continue
+		}
+		consent.Granted = granted
+		if granted {
+			consent.GrantedAt = &now
+		} else {
+			consent.RevokedAt = &now
+		}
+		updated[category] = consent
+	}
+	return updated
+}
+
+// HasConsent reports whether the user's preferences allow notifications of the category. Consent is only
+// read from the user's own preferences, global and team preferences never grant it
+func (p UserPreferences) HasConsent(userID, category string) bool {
+	consent, recorded := CategoryConsent{}, false
+	if p.Context == userID {
+		consent, recorded = p.Consent[category]
+	}
+	switch category {
+	case CategoryMarketing:
+		return recorded && consent.Granted
+	case CategoryProductUpdates:
+		return !recorded || consent.Granted
+	default:
+		return true
+	}
+}
@@ -0,0 +1,614 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The models below cross the API and SQS boundary: producers, clients and stored items written by earlier
+// versions depend on their JSON field names. Each has a golden fixture in testdata/contracts written from a
+// sample setting every field. A renamed, removed or retyped field changes the encoding and fails the tests.
+// After an intended, backward-compatible change, rewrite the fixtures with
+//
+//	go test ./functions/shared -run Contract -update
+//
+// and review the diff. Fixtures in testdata/contracts/legacy are payloads of earlier versions and are never
+// rewritten: they must keep decoding without losing a field.
+var updateContracts = flag.Bool("update", false, "rewrite the golden contract fixtures")
+
+const contractsDir = "testdata/contracts"
+
+var contractTime = time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+
+// contractSamples returns a sample of each model with every field set
+func contractSamples() map[string]any {
+	enabled := true
+	later := contractTime.Add(time.Hour)
+	producer := &Producer{Kind: ProducerServiceAccount, ID: "billing", Principal: "AROAEXAMPLE:billing"}
+	request := &NotificationRequest{
+		ID:                 "req-1",
+		Type:               NotificationTypeAlert,
+		Recipients:         []string{"user-1", "team:ops"},
+		Variables:          map[string]any{"serverName": "web-1", "count": 3},
+		Digest:             true,
+		Segment:            "segment-1",
+		Sequence:           "sequence-1",
+		SequenceStep:       &SequenceStepRef{SequenceID: "sequence-1", RunID: "run-1", Step: 1},
+		SystemTemplate:     SystemTemplateExpiryReminder,
+		Channels:           []string{ChannelEmail, ChannelSlack},
+		ReplayOf:           "req-0",
+		Overflow:           true,
+		Priority:           PriorityCritical,
+		Category:           CategoryOperational,
+		Test:               true,
+		Producer:           producer,
+		DedupKey:           "billing:invoice-42",
+		DedupWindowSeconds: 600,
+		Job:                &JobChunkRef{JobID: "req-0", Chunk: 1},
+		CorrelationKey:     "incident-42",
+		DryRun:             true,
+		Deferred:           true,
+		Tags:               []string{"team:payments", "env:prod"},
+		BounceRetry:        1,
+	}
+	preferenceItem := PreferenceItem{Channels: []string{ChannelEmail}, Enabled: &enabled, Delivery: DeliveryDailyDigest}
+	override := &PreferenceOverride{
+		OverrideID: "override-1",
+		Types:      []string{NotificationTypeAlert},
+		Preference: preferenceItem,
+		Reason:     "Incident INC-42",
+		ExpiresAt:  &later,
+		CreatedBy:  "user-1",
+		CreatedAt:  &contractTime,
+	}
+	schedule := &ScheduleConfig{Type: ScheduleTypeCron, Expression: "cron(0 9 * * ? *)", EndDate: &later, Timezone: "Europe/Berlin", MaxOccurrences: 12}
+	delivery := DeliveryResult{
+		RecipientID:       "user-1",
+		Channel:           ChannelWebhook,
+		Success:           true,
+		Suppressed:        true,
+		Deferred:          true,
+		Digested:          true,
+		DryRun:            true,
+		Error:             "timeout",
+		DeliveredAt:       &contractTime,
+		ProviderMessageID: "msg-1",
+		EmailMessageID:    "<msg-2@example.com>",
+		ThreadMessageID:   "<msg-1@example.com>",
+		ResponseStatus:    202,
+	}
+	condition := RuleCondition{Field: "variables.env", Operator: "in", Value: "prod", Values: []string{"prod", "staging"}}
+	action := RuleAction{Type: "set_variable", Channel: ChannelSMS, Priority: PriorityNormal, Variable: "env", Value: "production"}
+	criteria := SegmentCriteria{
+		Roles:        []string{RoleUser},
+		Orgs:         []string{"example.com"},
+		EnabledTypes: []string{NotificationTypeReport},
+		Attributes:   map[string][]string{"plan": {"pro"}},
+	}
+
+	return map[string]any{
+		"notification_request": request,
+		"producer":             producer,
+		"schedule_config":      schedule,
+		"create_schedule_request": &CreateScheduleRequest{
+			Type:       NotificationTypeReport,
+			Variables:  map[string]any{"reportType": "weekly"},
+			Schedule:   *schedule,
+			DryRun:     true,
+			Tags:       []string{"team:payments"},
+			Recipients: []string{"user-2", RecipientPrefixTeam + "team-1"},
+			Segment:    "segment-1",
+		},
+		"update_schedule_request": &UpdateScheduleRequest{
+			Variables: map[string]any{"reportType": "monthly"},
+			Schedule:  schedule,
+			Status:    StatusPaused,
+			DryRun:    &enabled,
+			Tags:      []string{"team:payments", "env:prod"},
+		},
+		"clone_schedule_request": &CloneScheduleRequest{
+			Variables: map[string]any{"reportType": "quarterly"},
+		},
+		"scheduled_notification": &ScheduledNotification{
+			ScheduleID:  "schedule-1",
+			UserID:      "user-1",
+			Type:        NotificationTypeReport,
+			Variables:   map[string]any{"reportType": "weekly"},
+			Schedule:    schedule,
+			Status:      StatusActive,
+			DryRun:      true,
+			Occurrences: 3,
+			Tags:        []string{"team:payments", "env:prod"},
+			Recipients:  []string{"user-2", RecipientPrefixTeam + "team-1"},
+			Segment:     "segment-1",
+			CreatedAt:   &contractTime,
+			UpdatedAt:   &contractTime,
+		},
+		"preference_item": &preferenceItem,
+		"user_preferences": &UserPreferences{
+			Context:       "user-1",
+			Preferences:   map[string]PreferenceItem{NotificationTypeAlert: preferenceItem},
+			Timezone:      "Europe/Berlin",
+			Language:      "de",
+			DigestTime:    "08:30",
+			MissedSummary: &enabled,
+			DailyCaps:     map[string]int{ChannelSMS: 5},
+			Consent:       map[string]CategoryConsent{CategoryMarketing: {Granted: true, GrantedAt: &contractTime, RevokedAt: &later}},
+			Overrides:     []PreferenceOverride{*override},
+			CreatedAt:     &contractTime,
+			UpdatedAt:     &contractTime,
+		},
+		"preference_override": override,
+		"template": &Template{
+			Context:        "*",
+			TypeChannel:    "alert#email",
+			Content:        `{"subject": "Alert on {{serverName}}", "body": "{{message}}"}`,
+			Format:         TemplateFormatMarkdown,
+			IsActive:       &enabled,
+			CreatedBy:      "admin-1",
+			TemporaryUntil: &later,
+			SharedWith:     []TemplateShare{{Principal: "team:ops", Access: TemplateAccessEdit}},
+			Tags:           []string{"legacy", "team:ops"},
+			CreatedAt:      &contractTime,
+			UpdatedAt:      &contractTime,
+		},
+		"user": &User{
+			UserID:          "user-1",
+			Email:           "user@example.com",
+			PhoneNumber:     "+14155550123",
+			Role:            RoleUser,
+			IsActive:        &enabled,
+			Attributes:      map[string]string{"plan": "pro"},
+			CriticalContact: &CriticalContact{Type: CriticalContactPhone, Value: "+14155550199", Verified: true, VerifiedAt: &contractTime},
+			CreatedAt:       &contractTime,
+			UpdatedAt:       &contractTime,
+		},
+		"system_config": &SystemConfig{
+			Context:     "user-1",
+			Config:      &SystemSettings{EmailSettings: EmailSettings{FromAddress: "alerts@example.com"}},
+			Description: "Alert routing",
+			CreatedAt:   &contractTime,
+			UpdatedAt:   &contractTime,
+		},
+		"system_settings": &SystemSettings{
+			SlackSettings:     SlackSettings{WebhookURL: "https://hooks.slack.com/services/T/B/X", WebhookURLByType: map[string]string{NotificationTypeAlert: "https://hooks.slack.com/services/T/B/Y"}, Enabled: &enabled},
+			EmailSettings:     EmailSettings{FromAddress: "noreply@example.com", FromAddressByType: map[string]string{NotificationTypeAlert: "alerts@example.com"}, ReplyToAddress: "support@example.com", Provider: EmailProviderSendGrid, SendGridAPIKey: "SG.key", Enabled: &enabled},
+			InAppSettings:     InAppSettings{PlatformAppIDs: []string{"app-1"}, Enabled: &enabled},
+			SmsSettings:       SmsSettings{SenderID: "ACME", Enabled: &enabled},
+			PushSettings:      PushSettings{PlatformApplicationARNs: map[string]string{PushPlatformFCM: "arn:aws:sns:us-east-1:123456789012:app/GCM/acme"}, Enabled: &enabled},
+			WebhookSettings:   WebhookSettings{URL: "https://example.com/hook", Secret: "secret", ExpectedStatuses: []int{200}, ExpectedBody: `"ok":true`, EndpointsByType: map[string]WebhookEndpointSettings{"alert": {URL: "https://example.com/alerts", Secret: "secret", ExpectedStatuses: []int{202}, ExpectedBody: "accepted"}}, Enabled: &enabled},
+			TeamsSettings:     TeamsSettings{WebhookURL: "https://example.webhook.office.com/webhookb2/x", Enabled: &enabled},
+			Calendar:          CalendarSettings{Enabled: &enabled, Timezone: "UTC", WorkingDays: []string{"monday"}, Holidays: []string{"2024-12-25"}, WorkdayStart: "09:00", DeferredTypes: []string{NotificationTypeReport}},
+			Localization:      LocalizationSettings{},
+			EmailWarmUp:       EmailWarmUpSettings{},
+			EnvironmentBanner: EnvironmentBannerSettings{},
+			Retention:         RetentionSettings{},
+			Processor:         ProcessorSettings{},
+			Fallback:          FallbackSettings{},
+			Schedules:         ScheduleSettings{},
+			EmailBounces:      EmailBounceSettings{},
+		},
+		"notification_history": &NotificationHistory{
+			ID:              "req-1",
+			Type:            NotificationTypeAlert,
+			Request:         request,
+			TotalRecipients: 2,
+			SuccessCount:    1,
+			FailureCount:    1,
+			Deliveries:      []DeliveryResult{delivery},
+			Producer:        producer,
+			EnqueuedAt:      &contractTime,
+			DuplicateOf:     "req-0",
+			Tags:            []string{"team:payments", "env:prod"},
+			CreatedAt:       &later,
+			ExpiresAt:       1705400000,
+		},
+		"delivery_result": &delivery,
+		"acknowledgment": &Acknowledgment{
+			NotificationID:   "req-1",
+			UserID:           "user-1",
+			Type:             NotificationTypeAlert,
+			Note:             "on it",
+			SentAt:           &contractTime,
+			AcknowledgedAt:   &later,
+			AckDate:          "2024-01-15",
+			TimeToAckSeconds: 3600,
+			ExpiresAt:        1705400000,
+		},
+		"inbox_item": &InboxItem{
+			UserID:         "user-1",
+			NotificationID: "req-1",
+			Type:           NotificationTypeNotification,
+			Content:        "Your report is ready https://example.com/r/1",
+			Read:           true,
+			ReadAt:         &later,
+			Previews:       []LinkPreview{{URL: "https://example.com/r/1", Title: "Report", Description: "Weekly", Image: "https://example.com/i.png", SiteName: "Example"}},
+			CreatedAt:      &contractTime,
+			ExpiresAt:      1705400000,
+		},
+		"device_token": &DeviceToken{
+			UserID:    "user-1",
+			DeviceID:  "device-1",
+			Platform:  PushPlatformFCM,
+			CreatedAt: &contractTime,
+			UpdatedAt: &contractTime,
+		},
+		"rule": &Rule{
+			RuleID:         "rule-1",
+			Name:           "Escalate production alerts",
+			Order:          10,
+			Enabled:        &enabled,
+			Conditions:     []RuleCondition{condition},
+			Actions:        []RuleAction{action},
+			CreatedBy:      "admin-1",
+			TemporaryUntil: &later,
+			CreatedAt:      &contractTime,
+			UpdatedAt:      &contractTime,
+		},
+		"rule_condition": &condition,
+		"rule_action":    &action,
+		"team": &Team{
+			TeamID:          "team-1",
+			Name:            "Ops",
+			Members:         []string{"user-1", "user-2"},
+			Preferences:     map[string]PreferenceItem{NotificationTypeAlert: preferenceItem},
+			SlackWebhookURL: "https://hooks.slack.com/services/T/B/Z",
+			Policy:          TeamPolicyOnCall,
+			RotationID:      "rotation-1",
+			CreatedAt:       &contractTime,
+			UpdatedAt:       &contractTime,
+		},
+		"oncall_rotation": &OnCallRotation{
+			RotationID: "rotation-1",
+			Name:       "Primary",
+			Members:    []string{"user-1", "user-2"},
+			StartAt:    &contractTime,
+			ShiftHours: 24,
+			Overrides:  []OnCallOverride{{UserID: "user-2", StartAt: &contractTime, EndAt: &later}},
+			CreatedAt:  &contractTime,
+			UpdatedAt:  &contractTime,
+		},
+		"segment": &Segment{
+			SegmentID: "segment-1",
+			Name:      "Pro users",
+			Criteria:  criteria,
+			CreatedAt: &contractTime,
+			UpdatedAt: &contractTime,
+		},
+		"segment_criteria": &criteria,
+		"sequence": &Sequence{
+			SequenceID:  "sequence-1",
+			Name:        "Onboarding",
+			Description: "Welcome new users over their first week",
+			Steps: []SequenceStep{{
+				Type:         NotificationTypeNotification,
+				DelayMinutes: 1440,
+				Variables:    map[string]any{"tip": "profile"},
+				Channels:     []string{ChannelEmail},
+			}},
+			CreatedBy: "admin-1",
+			CreatedAt: &contractTime,
+			UpdatedAt: &contractTime,
+		},
+		"sequence_enrollment": &SequenceEnrollment{
+			UserID:      "user-1",
+			SequenceID:  "sequence-1",
+			RunID:       "run-1",
+			Status:      SequenceEnrollmentActive,
+			CurrentStep: 1,
+			NextStepAt:  &later,
+			Variables:   map[string]any{"name": "Ada"},
+			Steps: []SequenceStepOutcome{{
+				Step:      0,
+				Outcome:   SequenceStepSent,
+				RequestID: "sequence-run-1-0",
+				At:        &contractTime,
+			}},
+			StartedAt: &contractTime,
+			UpdatedAt: &contractTime,
+		},
+		"variable_schema": &VariableSchema{
+			Type: NotificationTypeAlert,
+			Variables: []VariableDefinition{{
+				Name:        "serverName",
+				Type:        VariableTypeString,
+				Required:    true,
+				Description: "Host that raised the alert",
+			}},
+			UpdatedBy: "admin-1",
+			CreatedAt: &contractTime,
+			UpdatedAt: &later,
+		},
+		"notification_type": &NotificationType{
+			Type:            "invoice",
+			DisplayName:     "Invoices",
+			Description:     "Invoices issued to the customer",
+			Category:        CategoryOperational,
+			DefaultChannels: []string{ChannelEmail},
+			Variables: []VariableDefinition{{
+				Name:     "amount",
+				Type:     VariableTypeNumber,
+				Required: true,
+			}},
+			CreatedBy: "admin-1",
+			CreatedAt: &contractTime,
+			UpdatedAt: &later,
+		},
+		"template_validation": &TemplateValidation{
+			Valid: false,
+			Issues: []TemplateIssue{{
+				Severity: IssueSeverityError,
+				Code:     "undeclared_variable",
+				Field:    "hostname",
+				Message:  "variable hostname is not declared for type alert",
+			}},
+			Variables: []string{"serverName", "hostname"},
+		},
+		"throttle_exemption": &ThrottleExemption{
+			ExemptionID:  ProducerExemptionID(ProducerServiceAccount, "AROAEXAMPLE:billing"),
+			Scope:        ExemptionScopeProducer,
+			UserID:       "user-1",
+			ProducerKind: ProducerServiceAccount,
+			ProducerID:   "AROAEXAMPLE:billing",
+			Reason:       "Billing outage alerts must never be held",
+			CreatedBy:    "admin-1",
+			CreatedAt:    &contractTime,
+		},
+		"schedule_next_runs": &ScheduleNextRuns{
+			ScheduleID: "schedule-1",
+			Expression: "0 9 * * ? *",
+			Timezone:   "UTC",
+			Runs:       []time.Time{contractTime, later},
+		},
+		"user_resources_deletion": &UserResourcesDeletion{
+			Templates:   4,
+			Schedules:   2,
+			Preferences: true,
+		},
+		"channel_test_result": &ChannelTestResult{
+			Channel:    ChannelEmail,
+			Context:    "user-1",
+			Enabled:    true,
+			Provider:   EmailProviderSendGrid,
+			Recipient:  "user-1@example.com",
+			MessageID:  "msg-1",
+			StatusCode: 202,
+			Response:   "accepted",
+			Devices:    2,
+			Error:      "device device-3: endpoint disabled",
+		},
+		"job": &Job{
+			JobID:           "req-0",
+			Type:            NotificationTypeAlert,
+			Segment:         "segment-1",
+			Status:          JobStatusCompleted,
+			TotalChunks:     2,
+			ChunksProcessed: 2,
+			Queued:          150,
+			Processed:       150,
+			Succeeded:       148,
+			Failed:          2,
+			Producer:        producer,
+			CreatedAt:       &contractTime,
+			UpdatedAt:       &later,
+			CompletedAt:     &later,
+			ExpiresAt:       1705318200,
+		},
+		"error_response": &ErrorResponse{Message: "Invalid request body", Details: "unexpected end of JSON input"},
+		"paginated_response": &PaginatedResponse{
+			Items:     []string{"a", "b"},
+			NextToken: "token",
+			Count:     2,
+		},
+	}
+}
+
+func contractPath(name string) string {
+	return filepath.Join(contractsDir, name+".json")
+}
+
+func encodeContract(t *testing.T, value any) []byte {
+	t.Helper()
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return append(data, '\n')
+}
+
+// TestContractGolden checks that each model still encodes exactly as its fixture
+func TestContractGolden(t *testing.T) {
+	for name, sample := range contractSamples() {
+		t.Run(name, func(t *testing.T) {
+			encoded := encodeContract(t, sample)
+			if *updateContracts {
+				if err := os.MkdirAll(contractsDir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(contractPath(name), encoded, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			golden, err := os.ReadFile(contractPath(name))
+			if err != nil {
+				t.Fatalf("missing fixture, run with -update to create it: %v", err)
+			}
+			if !bytes.Equal(encoded, golden) {
+				t.Errorf("encoding of %s changed, a rename or removal breaks existing producers and clients.\nwant:\n%s\ngot:\n%s", name, golden, encoded)
+			}
+		})
+	}
+}
+
+// TestContractDecode checks that each fixture decodes without unknown fields and encodes back unchanged,
+// so payloads written by the current producers are still read in full
+func TestContractDecode(t *testing.T) {
+	for name, sample := range contractSamples() {
+		t.Run(name, func(t *testing.T) {
+			golden, err := os.ReadFile(contractPath(name))
+			if err != nil {
+				t.Skip("no fixture yet")
+			}
+			decoded := reflect.New(reflect.TypeOf(sample).Elem()).Interface()
+			decoder := json.NewDecoder(bytes.NewReader(golden))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(decoded); err != nil {
+				t.Fatalf("fixture no longer decodes: %v", err)
+			}
+			assertSameJSON(t, golden, encodeContract(t, decoded))
+		})
+	}
+}
+
+// TestContractSamplesComplete checks that each sample sets every field of its model, so a new field is
+// covered by the fixtures from the start
+func TestContractSamplesComplete(t *testing.T) {
+	for name, sample := range contractSamples() {
+		t.Run(name, func(t *testing.T) {
+			var encoded map[string]any
+			if err := json.Unmarshal(encodeContract(t, sample), &encoded); err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range jsonFieldNames(reflect.TypeOf(sample).Elem()) {
+				if _, ok := encoded[field]; !ok {
+					t.Errorf("sample of %s does not set %q, set it so the field is part of the contract", name, field)
+				}
+			}
+		})
+	}
+}
+
+// TestContractLegacyPayloads checks that payloads written by earlier versions still decode without
+// unknown fields and keep every value they carried
+func TestContractLegacyPayloads(t *testing.T) {
+	models := map[string]func() any{
+		"notification_request":    func() any { return &NotificationRequest{} },
+		"create_schedule_request": func() any { return &CreateScheduleRequest{} },
+		"user_preferences":        func() any { return &UserPreferences{} },
+		"notification_history":    func() any { return &NotificationHistory{} },
+	}
+
+	paths, err := filepath.Glob(filepath.Join(contractsDir, "legacy", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no legacy payloads found")
+	}
+	for _, path := range paths {
+		base := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(base, func(t *testing.T) {
+			// Files are named <model>.<version>.json
+			model, _, _ := strings.Cut(base, ".")
+			newModel, ok := models[model]
+			if !ok {
+				t.Fatalf("unknown model %s", model)
+			}
+			payload, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded := newModel()
+			decoder := json.NewDecoder(bytes.NewReader(payload))
+			decoder.DisallowUnknownFields()
+			if err := decoder.Decode(decoded); err != nil {
+				t.Fatalf("legacy payload no longer decodes: %v", err)
+			}
+			assertSameJSON(t, payload, encodeContract(t, decoded))
+		})
+	}
+}
+
+// TestContractProtobufBody checks that the protobuf queue encoding still reads the golden message, which
+// fixes the field numbers of proto/notification_request.proto
+func TestContractProtobufBody(t *testing.T) {
+	request := NotificationRequest{
+		ID:         "req-1",
+		Type:       NotificationTypeAlert,
+		Recipients: []string{"user-1", "user-2"},
+		Variables:  map[string]any{"serverName": "web-1", "count": float64(3)},
+		Digest:     true,
+	}
+	path := filepath.Join(contractsDir, "notification_request.pb.b64")
+
+	if *updateContracts {
+		body, err := EncodeProtobufBody(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(body+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing fixture, run with -update to create it: %v", err)
+	}
+	decoded, err := DecodeNotificationRequest(ContentTypeProtobuf, strings.TrimSpace(string(golden)))
+	if err != nil {
+		t.Fatalf("golden protobuf body no longer decodes: %v", err)
+	}
+	if !reflect.DeepEqual(decoded, request) {
+		t.Errorf("golden protobuf body decoded to %+v, want %+v", decoded, request)
+	}
+}
+
+// assertSameJSON compares two JSON documents regardless of formatting, reporting every top-level field
+// that was lost or changed
+func assertSameJSON(t *testing.T, want, got []byte) {
+	t.Helper()
+	var wantFields, gotFields map[string]any
+	if err := json.Unmarshal(want, &wantFields); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(got, &gotFields); err != nil {
+		t.Fatal(err)
+	}
+	for field, value := range wantFields {
+		gotValue, ok := gotFields[field]
+		if !ok {
+			t.Errorf("field %q is lost when decoded", field)
+			continue
+		}
+		if !reflect.DeepEqual(value, gotValue) {
+			t.Errorf("field %q changed when decoded: want %v, got %v", field, value, gotValue)
+		}
+	}
+	for field := range gotFields {
+		if _, ok := wantFields[field]; !ok {
+			t.Errorf("field %q appeared when decoded", field)
+		}
+	}
+}
+
+// jsonFieldNames lists the JSON names of a struct's encoded fields
+func jsonFieldNames(structType reflect.Type) []string {
+	var names []string
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,364 @@
+package shared
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds of the year field of EventBridge Scheduler cron expressions
+const (
+	cronMinYear = 1970
+	cronMaxYear = 2199
+)
+
+var (
+	cronMonthNames   = []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}
+	cronWeekdayNames = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+)
+
+// ScheduleExpression is a parsed EventBridge Scheduler cron or rate expression
+type ScheduleExpression struct {
+	cron *cronSchedule
+	rate time.Duration
+}
+
+// ParseScheduleExpression parses a cron expression, bare or wrapped as cron(...), or a rate(...) expression
+func ParseScheduleExpression(expression string) (ScheduleExpression, error) {
+	expression = strings.TrimSpace(expression)
+	if inner, ok := strings.CutPrefix(expression, "rate("); ok && strings.HasSuffix(inner, ")") {
+		rate, err := parseRate(strings.TrimSuffix(inner, ")"))
+		if err != nil {
+			return ScheduleExpression{}, err
+		}
+		return ScheduleExpression{rate: rate}, nil
+	}
+	if inner, ok := strings.CutPrefix(expression, "cron("); ok && strings.HasSuffix(inner, ")") {
+		expression = strings.TrimSuffix(inner, ")")
+	}
+	cron, err := parseCron(expression)
+	if err != nil {
+		return ScheduleExpression{}, err
+	}
+	return ScheduleExpression{cron: cron}, nil
+}
+
+// NextRuns returns up to count firing times after the given time, in loc and earliest first. Rate expressions
+// fire every interval counted from start
+func (e ScheduleExpression) NextRuns(start, after time.Time, loc *time.Location, count int) []time.Time {
+	runs := make([]time.Time, 0, count)
+	if after.Before(start) {
+		after = start
+	}
+
+	if e.rate > 0 {
+		next := start.Add((after.Sub(start)/e.rate + 1) * e.rate)
+		for len(runs) < count && next.Year() <= cronMaxYear {
+			runs = append(runs, next.In(loc))
+			next = next.Add(e.rate)
+		}
+		return runs
+	}
+
+	for len(runs) < count {
+		next, ok := e.cron.next(after, loc)
+		if !ok {
+			break
+		}
+		runs = append(runs, next)
+		after = next
+	}
+	return runs
+}
+
+// parseRate parses the "value unit" of a rate expression. EventBridge requires the singular unit for 1
+func parseRate(spec string) (time.Duration, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 2 {
+		return 0, fmt.Errorf("rate expression must be rate(value unit)")
+	}
+	value, err := strconv.Atoi(fields[0])
+	if err != nil || value <= 0 {
+		return 0, fmt.Errorf("rate value must be a positive integer: %s", fields[0])
+	}
+
+	units := map[string]time.Duration{"minute": time.Minute, "hour": time.Hour, "day": 24 * time.Hour}
+	unit := fields[1]
+	if value != 1 {
+		singular, ok := strings.CutSuffix(unit, "s")
+		if !ok {
+			return 0, fmt.Errorf("rate unit must be plural for values other than 1: %s", unit)
+		}
+		unit = singular
+	}
+	duration, ok := units[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid rate unit: %s", fields[1])
+	}
+	return time.Duration(value) * duration, nil
+}
+
+// cronSchedule is a parsed 6-field cron expression. A nil day matcher is the field set to '?'
+type cronSchedule struct {
+	minutes     cronField
+	hours       cronField
+	months      cronField
+	years       cronField
+	daysOfMonth func(year int, month time.Month, day int) bool
+	daysOfWeek  func(year int, month time.Month, day int) bool
+}
+
+// parseCron parses minute hour day-of-month month day-of-week year. Exactly one of the day fields is '?'
+func parseCron(expression string) (*cronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("cron expression must have 6 fields (minute hour day-of-month month day-of-week year), got %d fields", len(fields))
+	}
+	if (fields[2] == "?") == (fields[4] == "?") {
+		return nil, fmt.Errorf("use '?' in exactly one of the day-of-month and day-of-week fields")
+	}
+
+	var schedule cronSchedule
+	var err error
+	if schedule.minutes, err = parseCronField("minute", fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if schedule.hours, err = parseCronField("hour", fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfMonth, err = parseDayOfMonth(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.months, err = parseCronField("month", fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, err
+	}
+	if schedule.daysOfWeek, err = parseDayOfWeek(fields[4]); err != nil {
+		return nil, err
+	}
+	if schedule.years, err = parseCronField("year", fields[5], cronMinYear, cronMaxYear, nil); err != nil {
+		return nil, err
+	}
+	return &schedule, nil
+}
+
+// next returns the first firing time after the given time, in loc. It reports false when the expression
+// never fires again. The search walks the wall clock, kept in UTC so that daylight saving time cannot move
+// it backwards: a time skipped when the clocks went forward does not fire, and a time repeated when they
+// went back fires once
+func (c *cronSchedule) next(after time.Time, loc *time.Location) (time.Time, bool) {
+	local := after.In(loc)
+	wall := time.Date(local.Year(), local.Month(), local.Day(), local.Hour(), local.Minute()+1, 0, 0, time.UTC)
+	for wall.Year() <= cronMaxYear {
+		year, month, day := wall.Date()
+		if !c.years.has(year) {
+			wall = time.Date(year+1, time.January, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !c.months.has(int(month)) {
+			wall = time.Date(year, month+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if c.matchesDay(year, month, day) {
+			if hour, minute, ok := c.nextTime(wall.Hour(), wall.Minute()); ok {
+				next := time.Date(year, month, day, hour, minute, 0, 0, loc)
+				if next.Hour() == hour && next.Minute() == minute && next.After(after) {
+					return next, true
+				}
+				wall = time.Date(year, month, day, hour, minute+1, 0, 0, time.UTC)
+				continue
+			}
+		}
+		wall = time.Date(year, month, day+1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Time{}, false
+}
+
+func (c *cronSchedule) matchesDay(year int, month time.Month, day int) bool {
+	if c.daysOfMonth != nil {
+		return c.daysOfMonth(year, month, day)
+	}
+	return c.daysOfWeek(year, month, day)
+}
+
+// nextTime returns the first hour and minute of the day the expression fires at, from the given time on
+func (c *cronSchedule) nextTime(hour, minute int) (int, int, bool) {
+	for h := hour; h < 24; h++ {
+		if !c.hours.has(h) {
+			continue
+		}
+		start := 0
+		if h == hour {
+			start = minute
+		}
+		for m := start; m < 60; m++ {
+			if c.minutes.has(m) {
+				return h, m, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// parseDayOfMonth parses the day-of-month field: days, L for the last day of the month, nW for the weekday
+// nearest to day n and LW for the last weekday of the month
+func parseDayOfMonth(spec string) (func(year int, month time.Month, day int) bool, error) {
+	switch {
+	case spec == "?":
+		return nil, nil
+	case spec == "L":
+		return func(year int, month time.Month, day int) bool {
+			return day == daysInMonth(year, month)
+		}, nil
+	case spec == "LW":
+		return func(year int, month time.Month, day int) bool {
+			return day == nearestWeekday(year, month, daysInMonth(year, month))
+		}, nil
+	case strings.HasSuffix(spec, "W"):
+		target, err := strconv.Atoi(strings.TrimSuffix(spec, "W"))
+		if err != nil || target < 1 || target > 31 {
+			return nil, fmt.Errorf("invalid day-of-month field: %s", spec)
+		}
+		return func(year int, month time.Month, day int) bool {
+			return target <= daysInMonth(year, month) && day == nearestWeekday(year, month, target)
+		}, nil
+	}
+
+	field, err := parseCronField("day-of-month", spec, 1, 31, nil)
+	if err != nil {
+		return nil, err
+	}
+	return func(year int, month time.Month, day int) bool {
+		return field.has(day)
+	}, nil
+}
+
+// parseDayOfWeek parses the day-of-week field, 1 (SUN) to 7 (SAT): days, L for Saturday, nL for the last
+// day n of the month and n#k for the k-th day n of the month
+func parseDayOfWeek(spec string) (func(year int, month time.Month, day int) bool, error) {
+	weekday := func(year int, month time.Month, day int) int {
+		return int(time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday()) + 1
+	}
+
+	switch {
+	case spec == "?":
+		return nil, nil
+	case spec == "L":
+		spec = "7"
+	case strings.HasSuffix(spec, "L"):
+		target, err := cronValue(strings.TrimSuffix(spec, "L"), 1, 7, cronWeekdayNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid day-of-week field: %s", spec)
+		}
+		return func(year int, month time.Month, day int) bool {
+			return weekday(year, month, day) == target && day+7 > daysInMonth(year, month)
+		}, nil
+	case strings.Contains(spec, "#"):
+		daySpec, nthSpec, _ := strings.Cut(spec, "#")
+		target, err := cronValue(daySpec, 1, 7, cronWeekdayNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid day-of-week field: %s", spec)
+		}
+		nth, err := strconv.Atoi(nthSpec)
+		if err != nil || nth < 1 || nth > 5 {
+			return nil, fmt.Errorf("invalid day-of-week field: %s", spec)
+		}
+		return func(year int, month time.Month, day int) bool {
+			return weekday(year, month, day) == target && (day-1)/7+1 == nth
+		}, nil
+	}
+
+	field, err := parseCronField("day-of-week", spec, 1, 7, cronWeekdayNames)
+	if err != nil {
+		return nil, err
+	}
+	return func(year int, month time.Month, day int) bool {
+		return field.has(weekday(year, month, day))
+	}, nil
+}
+
+// cronField is the set of values a field of a cron expression matches
+type cronField struct {
+	min   int
+	match []bool
+}
+
+func (f cronField) has(value int) bool {
+	i := value - f.min
+	return i >= 0 && i < len(f.match) && f.match[i]
+}
+
+// parseCronField parses a comma separated list of *, values, ranges and /steps between min and max.
+// Names, such as JAN or MON, stand for their values
+func parseCronField(name, spec string, min, max int, names []string) (cronField, error) {
+	field := cronField{min: min, match: make([]bool, max-min+1)}
+	for _, part := range strings.Split(spec, ",") {
+		rangeSpec, stepSpec, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			var err error
+			if step, err = strconv.Atoi(stepSpec); err != nil || step <= 0 {
+				return cronField{}, fmt.Errorf("invalid step in %s field: %s", name, part)
+			}
+		}
+
+		first, last := min, max
+		if rangeSpec != "*" {
+			from, to, isRange := strings.Cut(rangeSpec, "-")
+			var err error
+			if first, err = cronValue(from, min, max, names); err != nil {
+				return cronField{}, fmt.Errorf("invalid %s field: %w", name, err)
+			}
+			switch {
+			case isRange:
+				if last, err = cronValue(to, min, max, names); err != nil {
+					return cronField{}, fmt.Errorf("invalid %s field: %w", name, err)
+				}
+				if last < first {
+					return cronField{}, fmt.Errorf("invalid %s field: range %s is reversed", name, rangeSpec)
+				}
+			case !stepped:
+				last = first
+			}
+		}
+		for value := first; value <= last; value += step {
+			field.match[value-min] = true
+		}
+	}
+	return field, nil
+}
+
+// cronValue parses a value of a cron field, or one of its names
+func cronValue(spec string, min, max int, names []string) (int, error) {
+	for i, name := range names {
+		if strings.EqualFold(spec, name) {
+			return min + i, nil
+		}
+	}
+	value, err := strconv.Atoi(spec)
+	if err != nil || value < min || value > max {
+		return 0, fmt.Errorf("%q is not between %d and %d", spec, min, max)
+	}
+	return value, nil
+}
+
+func daysInMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// nearestWeekday returns the weekday closest to the day without leaving its month
+func nearestWeekday(year int, month time.Month, day int) int {
+	switch time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Weekday() {
+	case time.Saturday:
+		if day == 1 {
+			return day + 2
+		}
+		return day - 1
+	case time.Sunday:
+		if day == daysInMonth(year, month) {
+			return day - 2
+		}
+		return day + 1
+	}
+	return day
+}
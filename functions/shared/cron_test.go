@@ -0,0 +1,245 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestScheduleExpressionNextRuns(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		zone       string
+		start      string // The schedule's creation, after when empty
+		after      string
+		count      int
+		want       []string
+	}{
+		{
+			name:       "time skipped when daylight saving time starts",
+			expression: "30 2 * * ? *",
+			zone:       "America/New_York",
+			after:      "2026-03-07T00:00:00-05:00",
+			count:      3,
+			want:       []string{"2026-03-07T02:30:00-05:00", "2026-03-09T02:30:00-04:00", "2026-03-10T02:30:00-04:00"},
+		},
+		{
+			name:       "hourly across the skipped hour",
+			expression: "30 * * * ? *",
+			zone:       "America/New_York",
+			after:      "2026-03-08T00:00:00-05:00",
+			count:      3,
+			want:       []string{"2026-03-08T00:30:00-05:00", "2026-03-08T01:30:00-05:00", "2026-03-08T03:30:00-04:00"},
+		},
+		{
+			name:       "time repeated when daylight saving time ends fires once",
+			expression: "30 1 * * ? *",
+			zone:       "America/New_York",
+			after:      "2026-10-31T12:00:00-04:00",
+			count:      2,
+			want:       []string{"2026-11-01T01:30:00-04:00", "2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name:       "hourly across the repeated hour",
+			expression: "0 * * * ? *",
+			zone:       "America/New_York",
+			after:      "2026-11-01T00:30:00-04:00",
+			count:      3,
+			want:       []string{"2026-11-01T01:00:00-04:00", "2026-11-01T02:00:00-05:00", "2026-11-01T03:00:00-05:00"},
+		},
+		{
+			name:       "from within the repeated hour",
+			expression: "30 1 * * ? *",
+			zone:       "America/New_York",
+			after:      "2026-11-01T01:10:00-05:00",
+			count:      1,
+			want:       []string{"2026-11-02T01:30:00-05:00"},
+		},
+		{
+			name:       "wrapped in cron()",
+			expression: "cron(0 12 * * ? *)",
+			zone:       "UTC",
+			after:      "2026-01-01T12:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-02T12:00:00Z", "2026-01-03T12:00:00Z"},
+		},
+		{
+			name:       "last day of the month",
+			expression: "0 9 L * ? *",
+			zone:       "UTC",
+			after:      "2026-01-15T00:00:00Z",
+			count:      3,
+			want:       []string{"2026-01-31T09:00:00Z", "2026-02-28T09:00:00Z", "2026-03-31T09:00:00Z"},
+		},
+		{
+			name:       "weekday nearest to a weekend day",
+			expression: "0 9 15W 2,8 ? *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-02-16T09:00:00Z", "2026-08-14T09:00:00Z"},
+		},
+		{
+			name:       "nearest weekday stays in its month",
+			expression: "0 9 1W 8 ? *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      1,
+			want:       []string{"2026-08-03T09:00:00Z"},
+		},
+		{
+			name:       "last weekday of the month",
+			expression: "0 9 LW * ? *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-30T09:00:00Z", "2026-02-27T09:00:00Z"},
+		},
+		{
+			name:       "second Monday of the month",
+			expression: "0 9 ? * MON#2 *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-12T09:00:00Z", "2026-02-09T09:00:00Z"},
+		},
+		{
+			name:       "last Friday of the month",
+			expression: "0 9 ? * 6L *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-30T09:00:00Z", "2026-02-27T09:00:00Z"},
+		},
+		{
+			name:       "L alone in the day of week is Saturday",
+			expression: "0 9 ? * L *",
+			zone:       "UTC",
+			after:      "2026-01-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-03T09:00:00Z", "2026-01-10T09:00:00Z"},
+		},
+		{
+			name:       "steps and ranges",
+			expression: "0/20 9-10 ? * MON-FRI *",
+			zone:       "UTC",
+			after:      "2026-01-02T10:30:00Z",
+			count:      3,
+			want:       []string{"2026-01-02T10:40:00Z", "2026-01-05T09:00:00Z", "2026-01-05T09:20:00Z"},
+		},
+		{
+			name:       "lists",
+			expression: "15 8,18 1,15 * ? *",
+			zone:       "UTC",
+			after:      "2026-01-01T12:00:00Z",
+			count:      3,
+			want:       []string{"2026-01-01T18:15:00Z", "2026-01-15T08:15:00Z", "2026-01-15T18:15:00Z"},
+		},
+		{
+			name:       "month names",
+			expression: "0 0 1 JAN,JUL ? *",
+			zone:       "UTC",
+			after:      "2026-02-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-07-01T00:00:00Z", "2027-01-01T00:00:00Z"},
+		},
+		{
+			name:       "year ends the runs",
+			expression: "0 0 1 1 ? 2027",
+			zone:       "UTC",
+			after:      "2026-03-01T00:00:00Z",
+			count:      3,
+			want:       []string{"2027-01-01T00:00:00Z"},
+		},
+		{
+			name:       "evaluated in the timezone",
+			expression: "0 9 * * ? *",
+			zone:       "Europe/Berlin",
+			after:      "2026-03-28T12:00:00+01:00",
+			count:      2,
+			want:       []string{"2026-03-29T09:00:00+02:00", "2026-03-30T09:00:00+02:00"},
+		},
+		{
+			name:       "rate counts from the start",
+			expression: "rate(5 minutes)",
+			zone:       "UTC",
+			start:      "2026-01-01T10:00:00Z",
+			after:      "2026-01-01T10:12:00Z",
+			count:      2,
+			want:       []string{"2026-01-01T10:15:00Z", "2026-01-01T10:20:00Z"},
+		},
+		{
+			name:       "rate before the start",
+			expression: "rate(1 day)",
+			zone:       "UTC",
+			start:      "2026-01-01T00:00:00Z",
+			after:      "2025-12-01T00:00:00Z",
+			count:      2,
+			want:       []string{"2026-01-02T00:00:00Z", "2026-01-03T00:00:00Z"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expression, err := ParseScheduleExpression(test.expression)
+			if err != nil {
+				t.Fatalf("ParseScheduleExpression(%q): %v", test.expression, err)
+			}
+			loc, err := time.LoadLocation(test.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			after := mustParseTime(t, test.after)
+			start := after
+			if test.start != "" {
+				start = mustParseTime(t, test.start)
+			}
+
+			var got []string
+			for _, run := range expression.NextRuns(start, after, loc, test.count) {
+				got = append(got, run.Format(time.RFC3339))
+			}
+			if !slices.Equal(got, test.want) {
+				t.Errorf("NextRuns(%q) = %v, want %v", test.expression, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleExpressionErrors(t *testing.T) {
+	for _, expression := range []string{
+		"0 9 * *",
+		"0 9 * * * *",
+		"0 9 ? * ? *",
+		"60 9 * * ? *",
+		"0 24 * * ? *",
+		"0 9 32 * ? *",
+		"0 9 * 13 ? *",
+		"0 9 ? * 8 *",
+		"0 9 * * ? 2200",
+		"0 17-9 * * ? *",
+		"0/0 9 * * ? *",
+		"0 9 0W * ? *",
+		"0 9 ? * MON#6 *",
+		"0 9 ? * 9L *",
+		"rate(0 minutes)",
+		"rate(1 minutes)",
+		"rate(5 minute)",
+		"rate(5 weeks)",
+		"rate(5)",
+	} {
+		if _, err := ParseScheduleExpression(expression); err == nil {
+			t.Errorf("ParseScheduleExpression(%q) succeeded, want an error", expression)
+		}
+	}
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
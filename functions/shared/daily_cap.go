@@ -0,0 +1,87 @@
+package shared
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultOverflowDigestTime = "21:00"
+
+// OverflowScheduleIDPrefix marks the one-time schedules that deliver notifications held after a daily cap was reached
+const OverflowScheduleIDPrefix = "overflow-"
+
+// DailyCapState reports how much of a channel's daily cap the recipient has used today
+type DailyCapState struct {
+	Channel   string `json:"channel"`
+	Cap       int    `json:"cap"`
+	Delivered int    `json:"delivered"` // Notifications delivered today, at most the cap
+	Held      int    `json:"held"`      // Notifications held for today's overflow digest
+	Reached   bool   `json:"reached"`
+}
+
+// NewDailyCapState derives the cap state from the number of notifications counted today
+func NewDailyCapState(channel string, dailyCap, count int) DailyCapState {
+	return DailyCapState{
+		Channel:   channel,
+		Cap:       dailyCap,
+		Delivered: min(count, dailyCap),
+		Held:      max(count-dailyCap, 0),
+		Reached:   count >= dailyCap,
+	}
+}
+
+// DailyCap returns the recipient's daily cap for the channel, 0 when it is uncapped
+func (p UserPreferences) DailyCap(channel string) int {
+	return p.DailyCaps[channel]
+}
+
+// ValidateDailyCaps checks that caps are set for known channels and allow at least one notification
+func ValidateDailyCaps(caps map[string]int) error {
+	for channel, dailyCap := range caps {
+		if !ValidateChannel(channel) {
+			return fmt.Errorf("invalid channel: %s", channel)
+		}
+		if dailyCap < 1 {
+			return fmt.Errorf("daily cap for %s must be at least 1", channel)
+		}
+	}
+	return nil
+}
+
+// DailyCapDay returns the recipient's local date that notifications at t count against
+func DailyCapDay(timezone string, t time.Time) string {
+	location := time.UTC
+	if loaded, err := time.LoadLocation(timezone); err == nil {
+		location = loaded
+	}
+	return t.In(location).Format(DateFormat)
+}
+
+// OverflowScheduleID returns the ID of the schedule delivering a recipient's overflow digest for a channel and day.
+// The ID is derived from a hash so it stays within the schedule name limit
+func OverflowScheduleID(userID, channel, day string) string {
+	return OverflowScheduleIDPrefix + uuid.NewSHA1(uuid.NameSpaceOID, []byte(userID+"#"+channel+"#"+day)).String()
+}
+
+// OverflowDigestTime returns when today's overflow digest is delivered: DAILY_CAP_DIGEST_TIME (default 21:00)
+// in the recipient's timezone, or a minute from now once that time has passed
+func OverflowDigestTime(timezone string, now time.Time) time.Time {
+	location := time.UTC
+	if loaded, err := time.LoadLocation(timezone); err == nil {
+		location = loaded
+	}
+	at, err := time.Parse("15:04", os.Getenv("DAILY_CAP_DIGEST_TIME"))
+	if err != nil {
+		at, _ = time.Parse("15:04", defaultOverflowDigestTime)
+	}
+
+	local := now.In(location)
+	deliverAt := time.Date(local.Year(), local.Month(), local.Day(), at.Hour(), at.Minute(), 0, 0, location)
+	if earliest := now.Add(time.Minute); deliverAt.Before(earliest) {
+		return earliest
+	}
+	return deliverAt
+}
@@ -0,0 +1,85 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+const defaultDigestTime = "09:00"
+
+// DigestScheduleIDPrefix marks the schedules that deliver daily digests
+const DigestScheduleIDPrefix = "digest-"
+
+// DigestScheduleID returns the ID of the schedule that delivers a user's daily digest
+func DigestScheduleID(userID string) string {
+	return DigestScheduleIDPrefix + userID
+}
+
+// HasDigestDelivery reports whether any notification type is set to daily digest
+func (p UserPreferences) HasDigestDelivery() bool {
+	for _, item := range p.Preferences {
+		if item.Delivery == DeliveryDailyDigest {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDigestDelivery reports whether a notification type is held for the daily digest
+func (p UserPreferences) IsDigestDelivery(notificationType string) bool {
+	item, ok := p.Preferences[notificationType]
+	return ok && item.Delivery == DeliveryDailyDigest
+}
+
+// ValidateDelivery validates if the preference delivery mode is valid
+func ValidateDelivery(delivery string) bool {
+	return delivery == "" || delivery == DeliveryImmediate || delivery == DeliveryDailyDigest
+}
+
+// SyncDigestSchedule creates or updates the user's digest schedule when any type uses daily digest,
+// and removes it when none do
+func SyncDigestSchedule(ctx context.Context, preferences UserPreferences) error {
+	scheduleID := DigestScheduleID(preferences.Context)
+
+	if !preferences.HasDigestDelivery() {
+		err := DeleteEventBridgeSchedule(ctx, preferences.Context, scheduleID)
+		if err != nil && !IsScheduleNotFound(err) {
+			return err
+		}
+		return nil
+	}
+
+	digestTime := preferences.DigestTime
+	if digestTime == "" {
+		digestTime = defaultDigestTime
+	}
+	at, err := time.Parse("15:04", digestTime)
+	if err != nil {
+		return fmt.Errorf("invalid digest time: %s", digestTime)
+	}
+
+	return PutEventBridgeSchedule(ctx, preferences.Context, scheduleID, fmt.Sprintf("%d %d * * ? *", at.Minute(), at.Hour()), preferences.Timezone, NotificationRequest{
+		ID:         scheduleID,
+		Type:       NotificationTypeNotification,
+		Recipients: []string{preferences.Context},
+		Digest:     true,
+		Producer:   &Producer{Kind: ProducerSystem, ID: "digest"},
+	})
+}
+
+// SummarizeNotification describes a notification in one line from the fixed variables of its type
+func SummarizeNotification(notificationType string, variables map[string]any) string {
+	variable := func(name string) string {
+		return fmt.Sprintf("%v", variables[name])
+	}
+
+	switch notificationType {
+	case NotificationTypeAlert:
+		return fmt.Sprintf("[alert] %s (%s): %s", variable("serverName"), variable("status"), variable("message"))
+	case NotificationTypeReport:
+		return fmt.Sprintf("[report] %s for %s", variable("reportType"), variable("period"))
+	default:
+		return fmt.Sprintf("[notification] %s: %s", variable("title"), variable("message"))
+	}
+}
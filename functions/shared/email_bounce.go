@@ -0,0 +1,162 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BounceRetryScheduleIDPrefix marks the one-time schedules that redeliver soft-bounced emails
+const BounceRetryScheduleIDPrefix = "bounce-retry-"
+
+// SES bounce types. Permanent bounces are hard, the address cannot receive email; transient ones are soft,
+// such as a full mailbox, and may succeed later. Undetermined bounces are not retried either
+const (
+	SESBounceTypePermanent    = "Permanent"
+	SESBounceTypeTransient    = "Transient"
+	SESBounceTypeUndetermined = "Undetermined"
+)
+
+// Limits of the bounce retry settings
+const (
+	maxBounceRetries          = 10
+	defaultBounceRetries      = 3
+	maxBounceRetryDelay       = 24 * time.Hour
+	defaultBounceRetryMinutes = 15
+)
+
+// EmailBounceSettings controls the redelivery of soft-bounced emails. Each attempt waits twice as long as
+// the one before, starting from the retry delay and capped at a day
+type EmailBounceSettings struct {
+	MaxRetries        *int `json:"maxRetries,omitempty" dynamodbav:"maxRetries,omitempty"`               // Redelivery attempts per email, 3 by default, 0 disables them
+	RetryDelayMinutes int  `json:"retryDelayMinutes,omitempty" dynamodbav:"retryDelayMinutes,omitempty"` // Delay before the first attempt, 15 by default
+}
+
+// IsEmpty reports whether no bounce setting is set
+func (b EmailBounceSettings) IsEmpty() bool {
+	return b.MaxRetries == nil && b.RetryDelayMinutes == 0
+}
+
+// Validate checks that the retries and their delay are within bounds
+func (b EmailBounceSettings) Validate() error {
+	if b.MaxRetries != nil && (*b.MaxRetries < 0 || *b.MaxRetries > maxBounceRetries) {
+		return fmt.Errorf("maxRetries must be between 0 and %d", maxBounceRetries)
+	}
+	if b.RetryDelayMinutes < 0 || b.RetryDelayMinutes > int(maxBounceRetryDelay/time.Minute) {
+		return fmt.Errorf("retryDelayMinutes must be between 0 (the default) and %d", int(maxBounceRetryDelay/time.Minute))
+	}
+	return nil
+}
+
+// RetryLimit returns how many times a soft-bounced email is redelivered
+func (b EmailBounceSettings) RetryLimit() int {
+	if b.MaxRetries == nil {
+		return defaultBounceRetries
+	}
+	return *b.MaxRetries
+}
+
+// RetryDelay returns how long the redelivery attempt waits after the bounce, attempts counting from 1
+func (b EmailBounceSettings) RetryDelay(attempt int) time.Duration {
+	delay := time.Duration(b.RetryDelayMinutes) * time.Minute
+	if delay == 0 {
+		delay = defaultBounceRetryMinutes * time.Minute
+	}
+	for range max(attempt-1, 0) {
+		delay *= 2
+		if delay >= maxBounceRetryDelay {
+			return maxBounceRetryDelay
+		}
+	}
+	return delay
+}
+
+// BounceRetryRequest builds the request redelivering a soft-bounced email to its recipient on the email
+// channel. It gets an ID of its own, so its history does not replace the bounced request's, and points at
+// the request that first bounced
+func BounceRetryRequest(bounced NotificationRequest, recipientID string, attempt int) NotificationRequest {
+	original := bounced.ID
+	if bounced.BounceRetry > 0 && bounced.ReplayOf != "" {
+		original = bounced.ReplayOf
+	}
+
+	retry := bounced
+	retry.ID = fmt.Sprintf("%s-bounce-%d-%s", original, attempt, uuid.NewSHA1(uuid.NameSpaceOID, []byte(recipientID)).String()[:8])
+	retry.ReplayOf = original
+	retry.Recipients = []string{recipientID}
+	retry.Channels = []string{ChannelEmail}
+	retry.Segment = ""
+	retry.Job = nil
+	// The redelivery is sent on purpose, the producer's dedup key would suppress it
+	retry.DedupKey, retry.DedupWindowSeconds = "", 0
+	retry.Deferred = true
+	retry.BounceRetry = attempt
+	return retry
+}
+
+// BounceRetryScheduleID returns the ID of the one-time schedule redelivering a bounced email. It is derived
+// from the SES message ID, so a bounce notification delivered twice schedules one redelivery
+func BounceRetryScheduleID(messageID string) string {
+	return BounceRetryScheduleIDPrefix + uuid.NewSHA1(uuid.NameSpaceOID, []byte(messageID)).String()
+}
+
+// SESNotification is an SES email event published to SNS, by a configuration set's event destination
+// (eventType) or by an identity's notification topic (notificationType)
+type SESNotification struct {
+	EventType        string     `json:"eventType,omitempty"`
+	NotificationType string     `json:"notificationType,omitempty"`
+	Bounce           *SESBounce `json:"bounce,omitempty"`
+	Mail             SESMail    `json:"mail"`
+}
+
+// Type returns the kind of event, e.g. "Bounce"
+func (n SESNotification) Type() string {
+	if n.EventType != "" {
+		return n.EventType
+	}
+	return n.NotificationType
+}
+
+// SESBounce describes why SES could not deliver an email
+type SESBounce struct {
+	BounceType        string                `json:"bounceType"`
+	BounceSubType     string                `json:"bounceSubType"`
+	BouncedRecipients []SESBouncedRecipient `json:"bouncedRecipients"`
+	Timestamp         *time.Time            `json:"timestamp,omitempty"`
+}
+
+// SESBouncedRecipient is an address that bounced
+type SESBouncedRecipient struct {
+	EmailAddress   string `json:"emailAddress"`
+	Status         string `json:"status,omitempty"`
+	DiagnosticCode string `json:"diagnosticCode,omitempty"`
+}
+
+// SESMail identifies the email an event is about
+type SESMail struct {
+	MessageID   string   `json:"messageId"`
+	Destination []string `json:"destination,omitempty"`
+}
+
+// IsHard reports whether the address cannot receive email
+func (b SESBounce) IsHard() bool {
+	return b.BounceType == SESBounceTypePermanent
+}
+
+// IsSoft reports whether the bounce is temporary and the email may be delivered later
+func (b SESBounce) IsSoft() bool {
+	return b.BounceType == SESBounceTypeTransient
+}
+
+// Classification returns "hard", "soft" or "undetermined"
+func (b SESBounce) Classification() string {
+	switch {
+	case b.IsHard():
+		return "hard"
+	case b.IsSoft():
+		return "soft"
+	default:
+		return "undetermined"
+	}
+}
@@ -0,0 +1,86 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// MaxEmailHeaders is how many custom headers an email template may set
+const MaxEmailHeaders = 10
+
+// EmailContent is the content of an email template, and of a rendered email. The body is HTML, or the
+// plain-text alternative of the htmlBody when there is one. The preheader is the hidden text inboxes show
+// beside the subject, headers are custom headers such as List-Unsubscribe or X-Campaign-ID
+type EmailContent struct {
+	Subject   string            `json:"subject"`
+	Body      string            `json:"body"`
+	HTMLBody  string            `json:"htmlBody,omitempty"`
+	Preheader string            `json:"preheader,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
+}
+
+// ParseEmailContent parses the JSON content of an email template or a rendered email
+func ParseEmailContent(content string) (EmailContent, error) {
+	var email EmailContent
+	if err := json.Unmarshal([]byte(content), &email); err != nil {
+		return EmailContent{}, err
+	}
+	return email, nil
+}
+
+// Bodies returns the HTML and plain-text bodies of the email. With an htmlBody the body is the plain-text
+// alternative as written, otherwise the body is HTML and the text is derived from it
+func (e EmailContent) Bodies() (string, string) {
+	if e.HTMLBody != "" {
+		return e.HTMLBody, e.Body
+	}
+	return e.Body, StripHTML(e.Body)
+}
+
+// emailHeaderNamePattern matches a header field name
+var emailHeaderNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// reservedEmailHeaders are set by the service or the provider, templates cannot override them
+var reservedEmailHeaders = []string{
+	"bcc", "cc", "content-disposition", "content-transfer-encoding", "content-type", "date", "dkim-signature",
+	"from", "in-reply-to", "message-id", "mime-version", "references", "reply-to", "return-path", "sender",
+	"subject", "to",
+}
+
+// ValidateEmailHeaders checks the custom headers of an email template: at most MaxEmailHeaders, with valid
+// names that the service does not set itself
+func ValidateEmailHeaders(headers map[string]string) error {
+	if len(headers) > MaxEmailHeaders {
+		return fmt.Errorf("email templates set at most %d headers", MaxEmailHeaders)
+	}
+	for name := range headers {
+		if err := ValidateEmailHeader(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateEmailHeader checks the name of a custom email header
+func ValidateEmailHeader(name string) error {
+	if !emailHeaderNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid email header name %q", name)
+	}
+	if slices.Contains(reservedEmailHeaders, strings.ToLower(name)) {
+		return fmt.Errorf("email header %s is set by the service", name)
+	}
+	return nil
+}
+
+// ApplyPreheader puts the preheader as hidden text at the very top of an HTML email body, where inboxes pick
+// the preview shown beside the subject
+func ApplyPreheader(preheader, body string) string {
+	if preheader == "" {
+		return body
+	}
+	return `<div style="display:none;max-height:0;overflow:hidden;mso-hide:all">` + html.EscapeString(preheader) + "</div>" + body
+}
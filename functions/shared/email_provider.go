@@ -0,0 +1,61 @@
+package shared
+
+import "fmt"
+
+// Constants for email providers
+const (
+	EmailProviderSES      = "ses"
+	EmailProviderSendGrid = "sendgrid"
+)
+
+// ProviderName returns the email provider of the settings, SES when none is set
+func (e EmailSettings) ProviderName() string {
+	if e.Provider == "" {
+		return EmailProviderSES
+	}
+	return e.Provider
+}
+
+// HasOwnProvider reports whether the settings bring their own email provider instead of the service's SES account
+func (e EmailSettings) HasOwnProvider() bool {
+	return e.ProviderName() != EmailProviderSES
+}
+
+// Validate checks the provider and that it comes with the credentials it needs
+func (e EmailSettings) Validate() error {
+	switch e.ProviderName() {
+	case EmailProviderSES:
+		if e.SendGridAPIKey != "" {
+			return fmt.Errorf("sendGridApiKey is only used with the sendgrid provider")
+		}
+	case EmailProviderSendGrid:
+		if e.SendGridAPIKey == "" {
+			return fmt.Errorf("sendGridApiKey is required with the sendgrid provider")
+		}
+	default:
+		return fmt.Errorf("invalid email provider: %s", e.Provider)
+	}
+	return nil
+}
+
+// WithGlobalDefaults completes the settings from the global email settings. Only settings with their own provider
+// set from and reply-to addresses, missing ones and the provider are taken from the global settings
+func (e EmailSettings) WithGlobalDefaults(global EmailSettings) EmailSettings {
+	if !e.HasOwnProvider() {
+		e.Provider = global.Provider
+		e.SendGridAPIKey = global.SendGridAPIKey
+	}
+	if e.FromAddress == "" {
+		e.FromAddress = global.FromAddress
+		e.FromAddressByType = global.FromAddressByType
+	}
+	if e.ReplyToAddress == "" {
+		e.ReplyToAddress = global.ReplyToAddress
+	}
+	return e
+}
+
+// NeedsGlobalDefaults reports whether WithGlobalDefaults would change the settings
+func (e EmailSettings) NeedsGlobalDefaults() bool {
+	return !e.HasOwnProvider() || e.FromAddress == "" || e.ReplyToAddress == ""
+}
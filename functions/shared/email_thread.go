@@ -0,0 +1,28 @@
+package shared
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MaxCorrelationKeyLength is the longest correlation key a request may carry
+const MaxCorrelationKeyLength = 256
+
+// defaultEmailThreadDays is how long follow-up emails keep threading under the first one of a correlation key
+const defaultEmailThreadDays = 30
+
+// EmailThreadWindow returns how long a correlation key's first email is kept as the thread's root, from
+// EMAIL_THREAD_DAYS. A follow-up after the window starts a new thread
+func EmailThreadWindow() time.Duration {
+	return time.Duration(max(GetEnvInt("EMAIL_THREAD_DAYS", defaultEmailThreadDays), 1)) * 24 * time.Hour
+}
+
+// NewEmailMessageID generates a Message-ID header for an email sent from the address, on the address's domain
+func NewEmailMessageID(fromAddress string) string {
+	domain := EmailDomain(fromAddress)
+	if domain == "" {
+		domain = "notification-service"
+	}
+	return "<" + uuid.NewString() + "@" + domain + ">"
+}
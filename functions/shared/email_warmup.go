@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// defaultWarmUpLimits is a two-week ramp, the number of emails allowed on each day
+var defaultWarmUpLimits = []int{50, 100, 200, 400, 800, 1500, 3000, 5000, 8000, 12000, 20000, 30000, 50000, 75000}
+
+// EmailWarmUpSettings caps the daily email volume of a new From domain, ramping it up day by day.
+// Emails past the day's limit are deferred to the next day. Once the ramp is over there is no cap
+type EmailWarmUpSettings struct {
+	Enabled     *bool  `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+	StartDate   string `json:"startDate,omitempty" dynamodbav:"startDate,omitempty"`     // YYYY-MM-DD (UTC), first day of the ramp
+	DailyLimits []int  `json:"dailyLimits,omitempty" dynamodbav:"dailyLimits,omitempty"` // Emails allowed on each day of the ramp, defaults to a two-week ramp
+}
+
+// IsEnabled reports whether the warm-up should be applied
+func (w EmailWarmUpSettings) IsEnabled() bool {
+	return w.Enabled != nil && *w.Enabled
+}
+
+// IsEmpty reports whether no warm-up field is set
+func (w EmailWarmUpSettings) IsEmpty() bool {
+	return w.Enabled == nil && w.StartDate == "" && len(w.DailyLimits) == 0
+}
+
+// Validate checks the start date and that the daily limits are positive and never decrease
+func (w EmailWarmUpSettings) Validate() error {
+	if w.IsEnabled() && w.StartDate == "" {
+		return fmt.Errorf("start date is required")
+	}
+	if w.StartDate != "" {
+		if _, err := time.Parse(DateFormat, w.StartDate); err != nil {
+			return fmt.Errorf("invalid start date: %s", w.StartDate)
+		}
+	}
+	for i, limit := range w.DailyLimits {
+		if limit < 1 {
+			return fmt.Errorf("daily limit for day %d must be at least 1", i+1)
+		}
+		if i > 0 && limit < w.DailyLimits[i-1] {
+			return fmt.Errorf("daily limit for day %d is lower than the day before", i+1)
+		}
+	}
+	return nil
+}
+
+// DailyLimit returns the number of emails allowed on the UTC day of t. It reports false when the
+// warm-up is disabled or its ramp is over. Days before the start date get the first day's limit
+func (w EmailWarmUpSettings) DailyLimit(t time.Time) (int, bool) {
+	if !w.IsEnabled() {
+		return 0, false
+	}
+	start, err := time.Parse(DateFormat, w.StartDate)
+	if err != nil {
+		return 0, false
+	}
+	limits := w.DailyLimits
+	if len(limits) == 0 {
+		limits = defaultWarmUpLimits
+	}
+	day := max(int(t.UTC().Sub(start).Hours()/24), 0)
+	if day >= len(limits) {
+		return 0, false
+	}
+	return limits[day], true
+}
+
+// NextWarmUpDay returns the start of the UTC day after t, when deferred emails are sent again
+func NextWarmUpDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24*time.Hour).AddDate(0, 0, 1)
+}
+
+// EmailDomain returns the lower-cased domain of an email address, empty when it cannot be parsed
+func EmailDomain(address string) string {
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return ""
+	}
+	at := strings.LastIndex(parsed.Address, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(parsed.Address[at+1:])
+}
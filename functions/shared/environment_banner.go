@@ -0,0 +1,91 @@
+package shared
+
+import (
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+)
+
+// productionEnvironments are the ENVIRONMENT names whose notifications carry no banner by default
+var productionEnvironments = []string{"prod", "production"}
+
+// Length limits for the environment banner settings
+const (
+	maxSubjectPrefixLength = 32
+	maxBannerTextLength    = 200
+)
+
+// EnvironmentBannerSettings marks notifications sent from a non-production environment so they are never
+// mistaken for production ones. Email subjects and Slack messages get the prefix, email bodies get the banner
+type EnvironmentBannerSettings struct {
+	Enabled       *bool  `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`             // Defaults to on outside production
+	SubjectPrefix string `json:"subjectPrefix,omitempty" dynamodbav:"subjectPrefix,omitempty"` // Defaults to the upper-cased environment, e.g. "[STAGING]"
+	BannerText    string `json:"bannerText,omitempty" dynamodbav:"bannerText,omitempty"`       // Shown above email bodies
+}
+
+// IsEmpty reports whether no banner field is set
+func (b EnvironmentBannerSettings) IsEmpty() bool {
+	return b.Enabled == nil && b.SubjectPrefix == "" && b.BannerText == ""
+}
+
+// Validate checks that the prefix is a single short line and the banner text is not too long
+func (b EnvironmentBannerSettings) Validate() error {
+	if strings.ContainsAny(b.SubjectPrefix, "\r\n") {
+		return fmt.Errorf("subject prefix must be a single line")
+	}
+	if len(b.SubjectPrefix) > maxSubjectPrefixLength {
+		return fmt.Errorf("subject prefix must be at most %d characters", maxSubjectPrefixLength)
+	}
+	if len(b.BannerText) > maxBannerTextLength {
+		return fmt.Errorf("banner text must be at most %d characters", maxBannerTextLength)
+	}
+	return nil
+}
+
+// Resolve returns the subject prefix and banner text of notifications sent from the environment, both empty
+// when the banner is off. Unless enabled or disabled explicitly, it is on outside production
+func (b EnvironmentBannerSettings) Resolve(environment string) (prefix, banner string) {
+	enabled := environment != "" && !slices.Contains(productionEnvironments, strings.ToLower(environment))
+	if b.Enabled != nil {
+		enabled = *b.Enabled
+	}
+	if !enabled {
+		return "", ""
+	}
+
+	prefix = b.SubjectPrefix
+	if prefix == "" && environment != "" {
+		prefix = "[" + strings.ToUpper(environment) + "]"
+	}
+	banner = b.BannerText
+	if banner == "" && environment != "" {
+		banner = fmt.Sprintf("This notification was sent from the %s environment.", environment)
+	}
+	return prefix, banner
+}
+
+// ApplySubjectPrefix prepends the prefix to a subject or message, unless it already starts with it
+func ApplySubjectPrefix(prefix, subject string) string {
+	if prefix == "" || strings.HasPrefix(subject, prefix) {
+		return subject
+	}
+	return prefix + " " + subject
+}
+
+// ApplyTextBanner puts the banner text above a plain-text email body
+func ApplyTextBanner(banner, body string) string {
+	if banner == "" {
+		return body
+	}
+	return banner + "\n\n" + body
+}
+
+// ApplyHTMLBanner puts the banner text above an HTML email body
+func ApplyHTMLBanner(banner, body string) string {
+	if banner == "" {
+		return body
+	}
+	return `<div style="background:#fff3cd;border:1px solid #ffc107;padding:8px;margin-bottom:16px;font-weight:bold">` +
+		html.EscapeString(banner) + "</div>" + body
+}
@@ -3,31 +3,173 @@ package shared
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/scheduler"
 	"github.com/aws/aws-sdk-go-v2/service/scheduler/types"
 )
 
-// CreateEventBridgeSchedule creates a new EventBridge Schedule that sends directly to SQS
-func CreateEventBridgeSchedule(ctx context.Context, scheduleID, cronExpression string, notificationRequest NotificationRequest) error {
-	scheduleName := fmt.Sprintf("schedule-%s", scheduleID)
+// maxScheduleGroupNameLength is EventBridge Scheduler's limit on group names
+const maxScheduleGroupNameLength = 64
+
+// knownScheduleGroups caches per-user groups already created by this container
+var knownScheduleGroups sync.Map
+
+// ScheduleGroupForUser returns the schedule group holding a user's schedules. With SCHEDULE_GROUP_PER_USER
+// enabled each user gets a group of their own, otherwise all schedules share the environment's group.
+// An empty result means the account's default group
+func ScheduleGroupForUser(userID string) string {
+	if ScheduleGroup == "" || userID == "" || !GetEnvBool("SCHEDULE_GROUP_PER_USER", false) {
+		return ScheduleGroup
+	}
+
+	group := ScheduleGroup + "-" + userID
+	if len(group) > maxScheduleGroupNameLength {
+		LogWarn(context.Background()).Str("userID", userID).Str("group", group).Msg("Per-user schedule group name too long, using environment group")
+		return ScheduleGroup
+	}
+	return group
+}
+
+// scheduleGroupName returns the schedule group for a user as an API parameter, nil selecting the default group
+func scheduleGroupName(userID string) *string {
+	group := ScheduleGroupForUser(userID)
+	if group == "" {
+		return nil
+	}
+	return aws.String(group)
+}
+
+// ensureScheduleGroup creates a per-user schedule group if it does not exist yet.
+// The environment group is managed by the stack and is never created here
+func ensureScheduleGroup(ctx context.Context, groupName *string) error {
+	if groupName == nil || *groupName == ScheduleGroup {
+		return nil
+	}
+	if _, ok := knownScheduleGroups.Load(*groupName); ok {
+		return nil
+	}
+
+	_, err := SchedulerClient.CreateScheduleGroup(ctx, &scheduler.CreateScheduleGroupInput{
+		Name: groupName,
+	})
+	var conflict *types.ConflictException
+	if err != nil && !errors.As(err, &conflict) {
+		LogError(ctx).Err(err).Str("group", *groupName).Msg("Failed to create schedule group")
+		return fmt.Errorf("failed to create schedule group: %w", err)
+	}
+
+	knownScheduleGroups.Store(*groupName, true)
+	return nil
+}
+
+// ValidateScheduleTimezone checks that the timezone is a name of the IANA tz database, which EventBridge Scheduler
+// evaluates expressions in. Empty selects the default timezone
+func ValidateScheduleTimezone(timezone string) error {
+	if timezone == "" {
+		return nil
+	}
+	if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+		return fmt.Errorf("invalid timezone: %s", timezone)
+	}
+	return nil
+}
+
+// ValidateMaxOccurrences checks the schedule's occurrence limit against the occurrences it already fired.
+// Zero leaves the schedule unlimited
+func (c ScheduleConfig) ValidateMaxOccurrences(occurrences int) error {
+	if c.MaxOccurrences < 0 {
+		return fmt.Errorf("maxOccurrences cannot be negative")
+	}
+	if c.MaxOccurrences > 0 && c.MaxOccurrences <= occurrences {
+		return fmt.Errorf("maxOccurrences must be greater than the %d occurrences already fired", occurrences)
+	}
+	return nil
+}
+
+// IsExhausted reports whether the schedule fired its maximum occurrences
+func (c ScheduleConfig) IsExhausted(occurrences int) bool {
+	return c.MaxOccurrences > 0 && occurrences >= c.MaxOccurrences
+}
+
+// scheduleTimezone returns the timezone a schedule's expression is evaluated in, UTC when none is set
+func scheduleTimezone(timezone string) *string {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	return aws.String(timezone)
+}
+
+// ListEventBridgeSchedules lists the service's schedules in every group it owns, keyed by schedule ID.
+// With per-user groups this walks all groups sharing the environment group's prefix
+func ListEventBridgeSchedules(ctx context.Context) (map[string]types.ScheduleSummary, error) {
+	groups := []*string{scheduleGroupName("")}
+	if ScheduleGroup != "" && GetEnvBool("SCHEDULE_GROUP_PER_USER", false) {
+		groupPaginator := scheduler.NewListScheduleGroupsPaginator(SchedulerClient, &scheduler.ListScheduleGroupsInput{
+			NamePrefix: aws.String(ScheduleGroup + "-"),
+		})
+		for groupPaginator.HasMorePages() {
+			page, err := groupPaginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list schedule groups: %w", err)
+			}
+			for _, group := range page.ScheduleGroups {
+				groups = append(groups, group.Name)
+			}
+		}
+	}
+
+	namePrefix := ScheduleName("")
+	schedules := make(map[string]types.ScheduleSummary)
+	for _, group := range groups {
+		paginator := scheduler.NewListSchedulesPaginator(SchedulerClient, &scheduler.ListSchedulesInput{
+			GroupName:  group,
+			NamePrefix: aws.String(namePrefix),
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list schedules: %w", err)
+			}
+			for _, summary := range page.Schedules {
+				schedules[strings.TrimPrefix(aws.ToString(summary.Name), namePrefix)] = summary
+			}
+		}
+	}
+
+	return schedules, nil
+}
+
+// CreateEventBridgeSchedule creates a new EventBridge Schedule that sends directly to SQS, until endDate when it is set.
+// The cron expression is evaluated in timezone, UTC when empty
+func CreateEventBridgeSchedule(ctx context.Context, userID, scheduleID, cronExpression, timezone string, endDate *time.Time, notificationRequest NotificationRequest) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
 
 	// Marshal the complete notification request
 	inputJSON, err := json.Marshal(notificationRequest)
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
 		return fmt.Errorf("failed to marshal notification request: %w", err)
 	}
 
+	if err := ensureScheduleGroup(ctx, groupName); err != nil {
+		return err
+	}
+
 	// Create the schedule targeting SQS directly
 	_, err = SchedulerClient.CreateSchedule(ctx, &scheduler.CreateScheduleInput{
 		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
 		Description:                aws.String(fmt.Sprintf("Scheduled notification for %s", scheduleID)),
 		ScheduleExpression:         aws.String(fmt.Sprintf("cron(%s)", cronExpression)),
-		ScheduleExpressionTimezone: aws.String("UTC"),
+		ScheduleExpressionTimezone: scheduleTimezone(timezone),
+		EndDate:                    endDate,
 		State:                      types.ScheduleStateEnabled,
 		FlexibleTimeWindow: &types.FlexibleTimeWindow{
 			Mode: types.FlexibleTimeWindowModeOff,
@@ -41,31 +183,172 @@ func CreateEventBridgeSchedule(ctx context.Context, scheduleID, cronExpression s
 	})
 
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to create EventBridge schedule")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to create EventBridge schedule")
 		return fmt.Errorf("failed to create EventBridge schedule: %w", err)
 	}
 
-	LogInfo().Str("scheduleID", scheduleID).Str("scheduleName", scheduleName).Msg("EventBridge schedule created successfully (direct to SQS)")
+	LogInfo(ctx).Str("scheduleID", scheduleID).Str("scheduleName", scheduleName).Msg("EventBridge schedule created successfully (direct to SQS)")
 	return nil
 }
 
-// UpdateEventBridgeSchedule updates an existing EventBridge Schedule
-func UpdateEventBridgeSchedule(ctx context.Context, scheduleID, cronExpression string, notificationRequest NotificationRequest) error {
-	scheduleName := fmt.Sprintf("schedule-%s", scheduleID)
+// CreateOneTimeEventBridgeSchedule creates a schedule that sends the notification request to SQS once at the given time.
+// The schedule deletes itself after it fires
+func CreateOneTimeEventBridgeSchedule(ctx context.Context, userID, scheduleID string, at time.Time, notificationRequest NotificationRequest) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
 
 	// Marshal the complete notification request
 	inputJSON, err := json.Marshal(notificationRequest)
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
+		return fmt.Errorf("failed to marshal notification request: %w", err)
+	}
+
+	if err := ensureScheduleGroup(ctx, groupName); err != nil {
+		return err
+	}
+
+	_, err = SchedulerClient.CreateSchedule(ctx, &scheduler.CreateScheduleInput{
+		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
+		Description:                aws.String(fmt.Sprintf("One-time notification for %s", notificationRequest.ID)),
+		ScheduleExpression:         aws.String(fmt.Sprintf("at(%s)", at.UTC().Format("2006-01-02T15:04:05"))),
+		ScheduleExpressionTimezone: aws.String("UTC"),
+		State:                      types.ScheduleStateEnabled,
+		ActionAfterCompletion:      types.ActionAfterCompletionDelete,
+		FlexibleTimeWindow: &types.FlexibleTimeWindow{
+			Mode: types.FlexibleTimeWindowModeOff,
+		},
+		Target: &types.Target{
+			Arn:     aws.String(NotificationQueueArn), // Direct to SQS (ARN format)
+			RoleArn: aws.String(SchedulerRoleArn),
+			Input:   aws.String(string(inputJSON)),
+		},
+	})
+
+	if err != nil {
+		// Callers that create idempotently named schedules expect conflicts
+		if !IsScheduleConflict(err) {
+			LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to create one-time EventBridge schedule")
+		}
+		return fmt.Errorf("failed to create one-time EventBridge schedule: %w", err)
+	}
+
+	LogInfo(ctx).Str("scheduleID", scheduleID).Time("at", at).Msg("One-time EventBridge schedule created successfully")
+	return nil
+}
+
+// PutEventBridgeSchedule creates or replaces a cron schedule evaluated in the given timezone
+func PutEventBridgeSchedule(ctx context.Context, userID, scheduleID, cronExpression, timezone string, notificationRequest NotificationRequest) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
+	if timezone == "" {
+		timezone = "UTC"
+	}
+
+	// Marshal the complete notification request
+	inputJSON, err := json.Marshal(notificationRequest)
+	if err != nil {
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
+		return fmt.Errorf("failed to marshal notification request: %w", err)
+	}
+
+	description := aws.String(fmt.Sprintf("Scheduled notification for %s", scheduleID))
+	flexibleTimeWindow := &types.FlexibleTimeWindow{
+		Mode: types.FlexibleTimeWindowModeOff,
+	}
+	target := &types.Target{
+		Arn:     aws.String(NotificationQueueArn), // Direct to SQS (ARN format)
+		RoleArn: aws.String(SchedulerRoleArn),
+		Input:   aws.String(string(inputJSON)),
+	}
+
+	if err := ensureScheduleGroup(ctx, groupName); err != nil {
+		return err
+	}
+
+	_, err = SchedulerClient.CreateSchedule(ctx, &scheduler.CreateScheduleInput{
+		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
+		Description:                description,
+		ScheduleExpression:         aws.String(fmt.Sprintf("cron(%s)", cronExpression)),
+		ScheduleExpressionTimezone: aws.String(timezone),
+		State:                      types.ScheduleStateEnabled,
+		FlexibleTimeWindow:         flexibleTimeWindow,
+		Target:                     target,
+	})
+
+	var conflict *types.ConflictException
+	if errors.As(err, &conflict) {
+		// Schedule already exists, replace it
+		_, err = SchedulerClient.UpdateSchedule(ctx, &scheduler.UpdateScheduleInput{
+			Name:                       aws.String(scheduleName),
+			GroupName:                  groupName,
+			Description:                description,
+			ScheduleExpression:         aws.String(fmt.Sprintf("cron(%s)", cronExpression)),
+			ScheduleExpressionTimezone: aws.String(timezone),
+			State:                      types.ScheduleStateEnabled,
+			FlexibleTimeWindow:         flexibleTimeWindow,
+			Target:                     target,
+		})
+	}
+
+	if err != nil {
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to put EventBridge schedule")
+		return fmt.Errorf("failed to put EventBridge schedule: %w", err)
+	}
+
+	LogInfo(ctx).Str("scheduleID", scheduleID).Str("timezone", timezone).Msg("EventBridge schedule saved successfully")
+	return nil
+}
+
+// GetEventBridgeScheduleState returns the state of a schedule's EventBridge schedule, empty when it does not exist
+func GetEventBridgeScheduleState(ctx context.Context, userID, scheduleID string) (types.ScheduleState, error) {
+	out, err := SchedulerClient.GetSchedule(ctx, &scheduler.GetScheduleInput{
+		Name:      aws.String(ScheduleName(scheduleID)),
+		GroupName: scheduleGroupName(userID),
+	})
+	if IsScheduleNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get schedule details: %w", err)
+	}
+	return out.State, nil
+}
+
+// IsScheduleNotFound reports whether the error is EventBridge Scheduler's ResourceNotFoundException
+func IsScheduleNotFound(err error) bool {
+	var notFound *types.ResourceNotFoundException
+	return errors.As(err, &notFound)
+}
+
+// IsScheduleConflict reports whether the error is EventBridge Scheduler's ConflictException
+func IsScheduleConflict(err error) bool {
+	var conflict *types.ConflictException
+	return errors.As(err, &conflict)
+}
+
+// UpdateEventBridgeSchedule updates an existing EventBridge Schedule, endDate and timezone replace the previous ones
+func UpdateEventBridgeSchedule(ctx context.Context, userID, scheduleID, cronExpression, timezone string, endDate *time.Time, notificationRequest NotificationRequest) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
+
+	// Marshal the complete notification request
+	inputJSON, err := json.Marshal(notificationRequest)
+	if err != nil {
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to marshal notification request")
 		return fmt.Errorf("failed to marshal notification request: %w", err)
 	}
 
 	// Update the schedule
 	_, err = SchedulerClient.UpdateSchedule(ctx, &scheduler.UpdateScheduleInput{
 		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
 		Description:                aws.String(fmt.Sprintf("Scheduled notification for %s", scheduleID)),
 		ScheduleExpression:         aws.String(fmt.Sprintf("cron(%s)", cronExpression)),
-		ScheduleExpressionTimezone: aws.String("UTC"),
+		ScheduleExpressionTimezone: scheduleTimezone(timezone),
+		EndDate:                    endDate,
 		State:                      types.ScheduleStateEnabled,
 		FlexibleTimeWindow: &types.FlexibleTimeWindow{
 			Mode: types.FlexibleTimeWindowModeOff,
@@ -79,38 +362,42 @@ func UpdateEventBridgeSchedule(ctx context.Context, scheduleID, cronExpression s
 	})
 
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to update EventBridge schedule")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to update EventBridge schedule")
 		return fmt.Errorf("failed to update EventBridge schedule: %w", err)
 	}
 
-	LogInfo().Str("scheduleID", scheduleID).Msg("EventBridge schedule updated successfully")
+	LogInfo(ctx).Str("scheduleID", scheduleID).Msg("EventBridge schedule updated successfully")
 	return nil
 }
 
 // DeleteEventBridgeSchedule deletes an EventBridge Schedule
-func DeleteEventBridgeSchedule(ctx context.Context, scheduleID string) error {
-	scheduleName := fmt.Sprintf("schedule-%s", scheduleID)
+func DeleteEventBridgeSchedule(ctx context.Context, userID, scheduleID string) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
 
 	_, err := SchedulerClient.DeleteSchedule(ctx, &scheduler.DeleteScheduleInput{
-		Name: aws.String(scheduleName),
+		Name:      aws.String(scheduleName),
+		GroupName: groupName,
 	})
 
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete EventBridge schedule")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to delete EventBridge schedule")
 		return fmt.Errorf("failed to delete EventBridge schedule: %w", err)
 	}
 
-	LogInfo().Str("scheduleID", scheduleID).Msg("EventBridge schedule deleted successfully")
+	LogInfo(ctx).Str("scheduleID", scheduleID).Msg("EventBridge schedule deleted successfully")
 	return nil
 }
 
 // PauseEventBridgeSchedule pauses an EventBridge Schedule
-func PauseEventBridgeSchedule(ctx context.Context, scheduleID string) error {
-	scheduleName := fmt.Sprintf("schedule-%s", scheduleID)
+func PauseEventBridgeSchedule(ctx context.Context, userID, scheduleID string) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
 
 	// Get current schedule details
 	getOutput, err := SchedulerClient.GetSchedule(ctx, &scheduler.GetScheduleInput{
-		Name: aws.String(scheduleName),
+		Name:      aws.String(scheduleName),
+		GroupName: groupName,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get schedule details: %w", err)
@@ -119,30 +406,34 @@ func PauseEventBridgeSchedule(ctx context.Context, scheduleID string) error {
 	// Update with disabled state
 	_, err = SchedulerClient.UpdateSchedule(ctx, &scheduler.UpdateScheduleInput{
 		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
 		Description:                getOutput.Description,
 		ScheduleExpression:         getOutput.ScheduleExpression,
 		ScheduleExpressionTimezone: getOutput.ScheduleExpressionTimezone,
+		EndDate:                    getOutput.EndDate,
 		State:                      types.ScheduleStateDisabled,
 		FlexibleTimeWindow:         getOutput.FlexibleTimeWindow,
 		Target:                     getOutput.Target,
 	})
 
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to pause EventBridge schedule")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to pause EventBridge schedule")
 		return fmt.Errorf("failed to pause EventBridge schedule: %w", err)
 	}
 
-	LogInfo().Str("scheduleID", scheduleID).Msg("EventBridge schedule paused successfully")
+	LogInfo(ctx).Str("scheduleID", scheduleID).Msg("EventBridge schedule paused successfully")
 	return nil
 }
 
 // ResumeEventBridgeSchedule resumes a paused EventBridge Schedule
-func ResumeEventBridgeSchedule(ctx context.Context, scheduleID string) error {
-	scheduleName := fmt.Sprintf("schedule-%s", scheduleID)
+func ResumeEventBridgeSchedule(ctx context.Context, userID, scheduleID string) error {
+	scheduleName := ScheduleName(scheduleID)
+	groupName := scheduleGroupName(userID)
 
 	// Get current schedule details
 	getOutput, err := SchedulerClient.GetSchedule(ctx, &scheduler.GetScheduleInput{
-		Name: aws.String(scheduleName),
+		Name:      aws.String(scheduleName),
+		GroupName: groupName,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get schedule details: %w", err)
@@ -151,20 +442,22 @@ func ResumeEventBridgeSchedule(ctx context.Context, scheduleID string) error {
 	// Update with enabled state
 	_, err = SchedulerClient.UpdateSchedule(ctx, &scheduler.UpdateScheduleInput{
 		Name:                       aws.String(scheduleName),
+		GroupName:                  groupName,
 		Description:                getOutput.Description,
 		ScheduleExpression:         getOutput.ScheduleExpression,
 		ScheduleExpressionTimezone: getOutput.ScheduleExpressionTimezone,
+		EndDate:                    getOutput.EndDate,
 		State:                      types.ScheduleStateEnabled,
 		FlexibleTimeWindow:         getOutput.FlexibleTimeWindow,
 		Target:                     getOutput.Target,
 	})
 
 	if err != nil {
-		LogError().Err(err).Str("scheduleID", scheduleID).Msg("Failed to resume EventBridge schedule")
+		LogError(ctx).Err(err).Str("scheduleID", scheduleID).Msg("Failed to resume EventBridge schedule")
 		return fmt.Errorf("failed to resume EventBridge schedule: %w", err)
 	}
 
-	LogInfo().Str("scheduleID", scheduleID).Msg("EventBridge schedule resumed successfully")
+	LogInfo(ctx).Str("scheduleID", scheduleID).Msg("EventBridge schedule resumed successfully")
 	return nil
 }
 
@@ -180,21 +473,6 @@ func ValidateCronExpression(cronExpr string) error {
 	if cronExpr == "" {
 		return fmt.Errorf("cron expression cannot be empty")
 	}
-
-	// Basic field count validation for EventBridge Scheduler (6 fields required)
-	fields := strings.Fields(cronExpr)
-	if len(fields) != 6 {
-		return fmt.Errorf("cron expression must have 6 fields (minute hour day-of-month month day-of-week year), got %d fields", len(fields))
-	}
-
-	// Validate the day-of-month and day-of-week constraint
-	dayOfMonth := fields[2] // 3rd field
-	dayOfWeek := fields[4]  // 5th field
-
-	if dayOfMonth == "*" && dayOfWeek == "*" {
-		return fmt.Errorf("cannot use '*' in both day-of-month and day-of-week fields. Use '?' in one of them")
-	}
-
-	// Let EventBridge validate the detailed syntax
-	return nil
+	_, err := parseCron(cronExpr)
+	return err
 }
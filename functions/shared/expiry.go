@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+)
+
+// Constants for the kinds of expiring resources owners are reminded about
+const (
+	ExpiryKindSchedule = "schedule"
+	ExpiryKindRule     = "rule"
+	ExpiryKindTemplate = "template"
+)
+
+// ValidateExpiry checks that an end date or temporary expiry is in the future
+func ValidateExpiry(field string, expiry *time.Time) error {
+	if expiry != nil && !expiry.After(GetCurrentTime()) {
+		return fmt.Errorf("%s must be in the future", field)
+	}
+	return nil
+}
+
+// isPast reports whether an optional expiry has passed
+func isPast(expiry *time.Time, now time.Time) bool {
+	return expiry != nil && !now.Before(*expiry)
+}
+
+// IsExpired reports whether a temporary rule has passed its expiry and no longer applies
+func (r Rule) IsExpired(now time.Time) bool {
+	return isPast(r.TemporaryUntil, now)
+}
+
+// IsExpired reports whether a temporary template has passed its expiry and is no longer used
+func (t Template) IsExpired(now time.Time) bool {
+	return isPast(t.TemporaryUntil, now)
+}
+
+// Active reports whether a template is in use. Templates stored without the flag are active
+func (t Template) Active() bool {
+	return t.IsActive == nil || *t.IsActive
+}
+
+// IsExpired reports whether a preference override has passed its expiry and no longer applies
+func (o PreferenceOverride) IsExpired(now time.Time) bool {
+	return o.ExpiresAt == nil || isPast(o.ExpiresAt, now)
+}
+
+// Owner returns the user reminded before a temporary template expires: the user of a user template,
+// the creator of a global one
+func (t Template) Owner() string {
+	if t.Context != "*" {
+		return t.Context
+	}
+	return t.CreatedBy
+}
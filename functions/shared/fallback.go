@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"fmt"
+	"maps"
+)
+
+// Fallback policies, how a user's document combines with the global one
+const (
+	FallbackReplace = "replace" // The user's document is used alone once they have one
+	FallbackMerge   = "merge"   // The user's document is layered over the global one
+)
+
+// FallbackSettings chooses, per resource falling back from a user to the global document, whether the user's
+// document replaces the global one or is merged over it
+type FallbackSettings struct {
+	Preferences string `json:"preferences,omitempty" dynamodbav:"preferences,omitempty"` // "merge" (default) | "replace"
+}
+
+// IsEmpty reports whether no fallback policy is set
+func (s FallbackSettings) IsEmpty() bool {
+	return s.Preferences == ""
+}
+
+// Validate checks that every policy is known
+func (s FallbackSettings) Validate() error {
+	if s.Preferences != "" && s.Preferences != FallbackReplace && s.Preferences != FallbackMerge {
+		return fmt.Errorf("preferences must be %s or %s", FallbackReplace, FallbackMerge)
+	}
+	return nil
+}
+
+// MergesPreferences reports whether user preferences are merged over the global ones, unless replacing is chosen
+func (s FallbackSettings) MergesPreferences() bool {
+	return s.Preferences != FallbackReplace
+}
+
+// MergeOver layers the preferences over the global ones per notification type: types they do not mention inherit
+// the global entry, and the fields a type's entry leaves unset (channels, enabled, delivery) inherit the global
+// entry's. Every other setting is kept as is
+func (p UserPreferences) MergeOver(global UserPreferences) UserPreferences {
+	if len(global.Preferences) == 0 {
+		return p
+	}
+	merged := maps.Clone(global.Preferences)
+	for notificationType, item := range p.Preferences {
+		merged[notificationType] = item.mergeOver(global.Preferences[notificationType])
+	}
+	p.Preferences = merged
+	return p
+}
+
+// mergeOver fills the fields the item leaves unset from the global item
+func (i PreferenceItem) mergeOver(global PreferenceItem) PreferenceItem {
+	if i.Channels == nil {
+		i.Channels = global.Channels
+	}
+	if i.Enabled == nil {
+		i.Enabled = global.Enabled
+	}
+	if i.Delivery == "" {
+		i.Delivery = global.Delivery
+	}
+	return i
+}
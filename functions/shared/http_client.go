@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Constants for outbound HTTP providers
+const (
+	HTTPProviderSlack    = "slack"
+	HTTPProviderWebhook  = "webhook"
+	HTTPProviderTeams    = "teams"
+	HTTPProviderFetch    = "fetch"
+	HTTPProviderSendGrid = "sendgrid"
+)
+
+// defaultHTTPTimeouts are used when no HTTP_TIMEOUT_<PROVIDER> env variable is set
+var defaultHTTPTimeouts = map[string]time.Duration{
+	HTTPProviderSlack:    5 * time.Second,
+	HTTPProviderWebhook:  10 * time.Second,
+	HTTPProviderTeams:    5 * time.Second,
+	HTTPProviderFetch:    5 * time.Second,
+	HTTPProviderSendGrid: 10 * time.Second,
+}
+
+const defaultHTTPTimeout = 10 * time.Second
+
+var (
+	// httpTransport is shared by every provider client so keep-alive connections
+	// survive across invocations of a warm Lambda container
+	httpTransport = &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		MaxConnsPerHost:       50,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+
+	httpClients   = map[string]*http.Client{}
+	httpClientsMu sync.Mutex
+)
+
+// GetHTTPClient returns the pooled HTTP client for a provider.
+// The timeout can be overridden with HTTP_TIMEOUT_<PROVIDER> (e.g. HTTP_TIMEOUT_SLACK=3s)
+func GetHTTPClient(provider string) *http.Client {
+	httpClientsMu.Lock()
+	defer httpClientsMu.Unlock()
+
+	if client, ok := httpClients[provider]; ok {
+		return client
+	}
+
+	client := &http.Client{
+		Transport: httpTransport,
+		Timeout:   GetHTTPTimeout(provider),
+	}
+	httpClients[provider] = client
+	return client
+}
+
+// GetHTTPTimeout returns the configured request timeout for a provider
+func GetHTTPTimeout(provider string) time.Duration {
+	timeout, ok := defaultHTTPTimeouts[provider]
+	if !ok {
+		timeout = defaultHTTPTimeout
+	}
+	return GetEnvDuration("HTTP_TIMEOUT_"+strings.ToUpper(provider), timeout)
+}
+
+// WarmHTTPConnections opens keep-alive connections to the URLs listed in HTTP_WARM_URLS
+// so the first delivery after a cold start does not pay for DNS and TLS setup
+func WarmHTTPConnections(ctx context.Context) {
+	warmURLs := os.Getenv("HTTP_WARM_URLS")
+	if warmURLs == "" {
+		return
+	}
+
+	client := GetHTTPClient(HTTPProviderFetch)
+	for _, rawURL := range strings.Split(warmURLs, ",") {
+		rawURL = strings.TrimSpace(rawURL)
+		if rawURL == "" {
+			continue
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+		if err != nil {
+			LogWarn(ctx).Err(err).Str("url", rawURL).Msg("Invalid warm-up URL")
+			continue
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			LogWarn(ctx).Err(err).Str("url", rawURL).Msg("Failed to warm HTTP connection")
+			continue
+		}
+		resp.Body.Close()
+	}
+}
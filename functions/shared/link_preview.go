@@ -0,0 +1,180 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// MaxLinkPreviews caps the links previewed for one in-app notification
+const MaxLinkPreviews = 3
+
+// maxLinkPreviewPageBytes is how much of a page is read looking for its metadata, which sits in the head
+const maxLinkPreviewPageBytes = 512 * 1024
+
+var (
+	// linkPattern matches http(s) links in rendered in-app content
+	linkPattern = regexp.MustCompile(`https?://[^\s<>"']+`)
+	// metaTagPattern matches a <meta> tag, metaAttrPattern its attributes
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)([a-z:_-]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+	titleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// LinkPreview is the Open Graph metadata of a link in an in-app notification, so clients can render a
+// rich preview without fetching the page themselves
+type LinkPreview struct {
+	URL         string `json:"url" dynamodbav:"url"`
+	Title       string `json:"title,omitempty" dynamodbav:"title,omitempty"`
+	Description string `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Image       string `json:"image,omitempty" dynamodbav:"image,omitempty"`
+	SiteName    string `json:"siteName,omitempty" dynamodbav:"siteName,omitempty"`
+}
+
+// ExtractLinks returns the distinct http(s) links in content in order of appearance, at most limit of them
+func ExtractLinks(content string, limit int) []string {
+	var links []string
+	for _, link := range linkPattern.FindAllString(content, -1) {
+		// Sentence punctuation right after a link is not part of it
+		link = strings.TrimRight(link, ".,;:!?)]}")
+		if slices.Contains(links, link) {
+			continue
+		}
+		links = append(links, link)
+		if len(links) == limit {
+			break
+		}
+	}
+	return links
+}
+
+// linkPreviewClient only connects to public addresses: the links come from notification content, so
+// they must not be able to reach the VPC, the metadata endpoint or localhost
+var linkPreviewClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: dialPublicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        20,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	Timeout: GetHTTPTimeout(HTTPProviderFetch),
+}
+
+// dialPublicOnly refuses connections to addresses that are not public, for clients that follow URLs
+// coming from users or content
+func dialPublicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return fmt.Errorf("connection blocked to non-public address %s", host)
+	}
+	return nil
+}
+
+// FetchLinkPreview reads the Open Graph metadata of a page, falling back to its <title>. It returns nil
+// when the link is not an HTML page or has no title
+func FetchLinkPreview(ctx context.Context, link string) (*LinkPreview, error) {
+	parsed, err := url.Parse(link)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return nil, fmt.Errorf("invalid link: %s", link)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "notification-service-link-preview/1.0")
+
+	resp, err := linkPreviewClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("link returned %d", resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" {
+		return nil, nil
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkPreviewPageBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	preview := parseOpenGraph(string(page))
+	if preview.Title == "" {
+		return nil, nil
+	}
+	preview.URL = link
+	if preview.Image != "" {
+		// Relative images are resolved against the page that was finally served
+		if image, err := resp.Request.URL.Parse(preview.Image); err == nil && (image.Scheme == "http" || image.Scheme == "https") {
+			preview.Image = image.String()
+		} else {
+			preview.Image = ""
+		}
+	}
+	return &preview, nil
+}
+
+// parseOpenGraph reads the og: meta tags of a page, using <title> and the description meta tag when
+// the page has no Open Graph title or description
+func parseOpenGraph(page string) LinkPreview {
+	var preview LinkPreview
+	var fallbackDescription string
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		attributes := make(map[string]string)
+		for _, match := range metaAttrPattern.FindAllStringSubmatch(tag, -1) {
+			attributes[strings.ToLower(match[1])] = html.UnescapeString(strings.TrimSpace(match[2] + match[3]))
+		}
+		property := strings.ToLower(attributes["property"])
+		if property == "" {
+			property = strings.ToLower(attributes["name"])
+		}
+		content := attributes["content"]
+		switch property {
+		case "og:title":
+			preview.Title = content
+		case "og:description":
+			preview.Description = content
+		case "og:image", "og:image:url":
+			if preview.Image == "" {
+				preview.Image = content
+			}
+		case "og:site_name":
+			preview.SiteName = content
+		case "description":
+			fallbackDescription = content
+		}
+	}
+
+	if preview.Title == "" {
+		if match := titleTagPattern.FindStringSubmatch(page); match != nil {
+			preview.Title = html.UnescapeString(strings.TrimSpace(match[1]))
+		}
+	}
+	if preview.Description == "" {
+		preview.Description = fallbackDescription
+	}
+	return preview
+}
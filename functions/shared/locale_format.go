@@ -0,0 +1,145 @@
+package shared
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// localeTags are the languages with a date-time layout, the first one is the fallback
+var (
+	localeTags = []language.Tag{
+		language.AmericanEnglish, // default
+		language.BritishEnglish,
+		language.German,
+		language.French,
+		language.Spanish,
+		language.Italian,
+		language.Portuguese,
+		language.Dutch,
+		language.Japanese,
+		language.Chinese,
+	}
+	dateTimeLayouts = map[language.Tag]string{
+		language.AmericanEnglish: "Jan 2, 2006 3:04 PM MST",
+		language.BritishEnglish:  "2 Jan 2006 15:04 MST",
+		language.German:          "02.01.2006 15:04 MST",
+		language.French:          "02/01/2006 15:04 MST",
+		language.Spanish:         "02/01/2006 15:04 MST",
+		language.Italian:         "02/01/2006 15:04 MST",
+		language.Portuguese:      "02/01/2006 15:04 MST",
+		language.Dutch:           "02-01-2006 15:04 MST",
+		language.Japanese:        "2006/01/02 15:04 MST",
+		language.Chinese:         "2006/01/02 15:04 MST",
+	}
+	localeMatcher = language.NewMatcher(localeTags)
+)
+
+// dateTimeInputLayouts are the timestamp formats recognised in variables
+var dateTimeInputLayouts = []string{time.RFC3339Nano, time.RFC3339, "2006-01-02T15:04:05"}
+
+// LocaleFormatter renders variable values for a recipient's language and timezone
+type LocaleFormatter struct {
+	printer  *message.Printer
+	layout   string
+	location *time.Location
+}
+
+// NewLocaleFormatter creates a formatter for a BCP 47 language tag and IANA timezone.
+// Unknown languages fall back to American English and unknown timezones to UTC
+func NewLocaleFormatter(lang, timezone string) LocaleFormatter {
+	tag := language.AmericanEnglish
+	if parsed, err := language.Parse(lang); err == nil {
+		tag = parsed
+	}
+	_, index, _ := localeMatcher.Match(tag)
+
+	location := time.UTC
+	if loaded, err := time.LoadLocation(timezone); err == nil && timezone != "" {
+		location = loaded
+	}
+
+	return LocaleFormatter{
+		printer:  message.NewPrinter(tag),
+		layout:   dateTimeLayouts[localeTags[index]],
+		location: location,
+	}
+}
+
+// IsSupportedLocale reports whether values can be formatted for lang without falling back to American English
+func IsSupportedLocale(lang string) bool {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return false
+	}
+	_, index, _ := localeMatcher.Match(tag)
+	base, _ := tag.Base()
+	matched, _ := localeTags[index].Base()
+	return base == matched
+}
+
+// LocalizeVariables returns a copy of the variables with numbers, timestamps and
+// {"value", "unit"} measurements formatted for the recipient, nested values included
+func (f LocaleFormatter) LocalizeVariables(variables map[string]any) map[string]any {
+	if variables == nil {
+		return nil
+	}
+	localized := make(map[string]any, len(variables))
+	for key, value := range variables {
+		localized[key] = f.localize(value)
+	}
+	return localized
+}
+
+func (f LocaleFormatter) localize(value any) any {
+	switch v := value.(type) {
+	case float64:
+		return f.FormatNumber(v)
+	case int:
+		return f.FormatNumber(float64(v))
+	case int64:
+		return f.FormatNumber(float64(v))
+	case time.Time:
+		return f.FormatTime(v)
+	case string:
+		for _, layout := range dateTimeInputLayouts {
+			if parsed, err := time.Parse(layout, v); err == nil {
+				return f.FormatTime(parsed)
+			}
+		}
+		return v
+	case map[string]any:
+		// Measurements render as a localized number followed by their unit
+		if amount, ok := v["value"].(float64); ok && len(v) == 2 {
+			if unit, ok := v["unit"].(string); ok {
+				return fmt.Sprintf("%s %s", f.FormatNumber(amount), unit)
+			}
+		}
+		return f.LocalizeVariables(v)
+	case []any:
+		localized := make([]any, len(v))
+		for i, item := range v {
+			localized[i] = f.localize(item)
+		}
+		return localized
+	default:
+		return value
+	}
+}
+
+// FormatNumber formats a number with the locale's grouping and decimal separators
+func (f LocaleFormatter) FormatNumber(value float64) string {
+	if value == math.Trunc(value) && math.Abs(value) < 1e15 {
+		return f.printer.Sprint(number.Decimal(int64(value)))
+	}
+	return f.printer.Sprint(number.Decimal(value, number.MaxFractionDigits(2)))
+}
+
+// FormatTime formats a timestamp in the recipient's timezone using the locale's layout
+func (f LocaleFormatter) FormatTime(value time.Time) string {
+	return value.In(f.location).Format(f.layout)
+}
@@ -0,0 +1,93 @@
+package shared
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+const defaultLanguage = "en"
+
+// LocalizationSettings controls which languages are tried, in order, for a recipient's language
+type LocalizationSettings struct {
+	DefaultLanguage string              `json:"defaultLanguage,omitempty" dynamodbav:"defaultLanguage,omitempty"` // Last resort for every chain, defaults to "en"
+	Fallbacks       map[string][]string `json:"fallbacks,omitempty" dynamodbav:"fallbacks,omitempty"`             // e.g. "pt-BR": ["pt", "es"]
+}
+
+// IsEmpty reports whether no localization field is set
+func (l LocalizationSettings) IsEmpty() bool {
+	return l.DefaultLanguage == "" && len(l.Fallbacks) == 0
+}
+
+// Validate checks that every language is a well-formed BCP 47 tag
+func (l LocalizationSettings) Validate() error {
+	if l.DefaultLanguage != "" {
+		if _, err := language.Parse(l.DefaultLanguage); err != nil {
+			return fmt.Errorf("invalid default language: %s", l.DefaultLanguage)
+		}
+	}
+	for lang, fallbacks := range l.Fallbacks {
+		if _, err := language.Parse(lang); err != nil {
+			return fmt.Errorf("invalid language: %s", lang)
+		}
+		for _, fallback := range fallbacks {
+			if _, err := language.Parse(fallback); err != nil {
+				return fmt.Errorf("invalid fallback language for %s: %s", lang, fallback)
+			}
+		}
+	}
+	return nil
+}
+
+// LanguageChain returns the languages to try for lang, most specific first. Configured fallbacks
+// replace the implicit parent languages (pt-BR → pt), and the default language always comes last
+func (l LocalizationSettings) LanguageChain(lang string) []string {
+	var chain []string
+	add := func(candidate string) {
+		if candidate != "" && !slices.ContainsFunc(chain, func(existing string) bool {
+			return strings.EqualFold(existing, candidate)
+		}) {
+			chain = append(chain, candidate)
+		}
+	}
+
+	add(lang)
+	if fallbacks, ok := l.fallbacksFor(lang); ok {
+		for _, fallback := range fallbacks {
+			add(fallback)
+		}
+	} else {
+		for parent := lang; strings.Contains(parent, "-"); {
+			parent = parent[:strings.LastIndex(parent, "-")]
+			add(parent)
+		}
+	}
+
+	if l.DefaultLanguage != "" {
+		add(l.DefaultLanguage)
+	} else {
+		add(defaultLanguage)
+	}
+	return chain
+}
+
+// CanonicalLanguage returns the canonical form of a BCP 47 tag (pt-br → pt-BR), empty when it is not well-formed
+func CanonicalLanguage(lang string) string {
+	tag, err := language.Parse(lang)
+	if err != nil {
+		return ""
+	}
+	return tag.String()
+}
+
+// fallbacksFor looks up the configured fallbacks for lang ignoring case
+func (l LocalizationSettings) fallbacksFor(lang string) ([]string, bool) {
+	for configured, fallbacks := range l.Fallbacks {
+		if strings.EqualFold(configured, lang) {
+			return fallbacks, true
+		}
+	}
+	return nil, false
+}
@@ -1,30 +1,71 @@
 package shared
 
 import (
+	"context"
 	"os"
 
+	"github.com/aws/aws-lambda-go/lambdacontext"
 	"github.com/rs/zerolog"
 )
 
 var logger zerolog.Logger
 
+// handlerNameKey stores the handler name set by WithLogger in the context
+type handlerNameKey struct{}
+
 func init() {
 	logger = zerolog.New(os.Stdout).With().Timestamp().Logger()
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
+	// Contexts without a request logger fall back to the base logger
+	zerolog.DefaultContextLogger = &logger
+}
+
+// WithLogger returns a context carrying a logger that stamps the handler name and the
+// Lambda request ID on every line. The handler wrappers call it once per invocation
+func WithLogger(ctx context.Context, handler string) context.Context {
+	builder := logger.With().Str("handler", handler)
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		builder = builder.Str("requestId", lc.AwsRequestID)
+	}
+	requestLogger := builder.Logger()
+	return requestLogger.WithContext(context.WithValue(ctx, handlerNameKey{}, handler))
+}
+
+// HandlerName returns the handler name set by WithLogger, or "" when none was set
+func HandlerName(ctx context.Context) string {
+	name, _ := ctx.Value(handlerNameKey{}).(string)
+	return name
+}
+
+// WithLogUser returns a context whose logger also stamps the calling user's ID
+func WithLogUser(ctx context.Context, userID string) context.Context {
+	userLogger := zerolog.Ctx(ctx).With().Str("userId", userID).Logger()
+	return userLogger.WithContext(ctx)
+}
+
+// Logger returns the request-scoped logger stored in the context, or the base logger
+func Logger(ctx context.Context) *zerolog.Logger {
+	return zerolog.Ctx(ctx)
+}
+
+func LogInfo(ctx context.Context) *zerolog.Event {
+	return Logger(ctx).Info()
 }
 
-func LogInfo() *zerolog.Event {
-	return logger.Info()
+func LogError(ctx context.Context) *zerolog.Event {
+	return Logger(ctx).Error()
 }
 
-func LogError() *zerolog.Event {
-	return logger.Error()
+func LogWarn(ctx context.Context) *zerolog.Event {
+	return Logger(ctx).Warn()
 }
 
-func LogWarn() *zerolog.Event {
-	return logger.Warn()
+func LogDebug(ctx context.Context) *zerolog.Event {
+	return Logger(ctx).Debug()
 }
 
-func LogDebug() *zerolog.Event {
-	return logger.Debug()
+// LogAudit starts an audit record for a privileged action. Audit records carry "audit": true
+// so they can be filtered out of the regular logs
+func LogAudit(ctx context.Context, action string) *zerolog.Event {
+	return Logger(ctx).Info().Bool("audit", true).Str("action", action)
 }
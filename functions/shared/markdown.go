@@ -0,0 +1,575 @@
+package shared
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Template formats. Text templates, the default, are sent as written
+const (
+	TemplateFormatText     = "text"
+	TemplateFormatMarkdown = "markdown"
+)
+
+// ValidateTemplateFormat checks the format of a template's content for its channel. Markdown email content
+// has no htmlBody, the HTML part is converted from its body
+func ValidateTemplateFormat(format, channel, content string) error {
+	switch format {
+	case "", TemplateFormatText:
+		return nil
+	case TemplateFormatMarkdown:
+	default:
+		return fmt.Errorf("invalid format: %s", format)
+	}
+	if channel != ChannelEmail {
+		return nil
+	}
+	email, err := ParseEmailContent(content)
+	if err != nil {
+		// Invalid email content is reported when the template is compiled
+		return nil
+	}
+	if email.HTMLBody != "" {
+		return fmt.Errorf("markdown email templates cannot have an htmlBody, it is converted from the body")
+	}
+	return nil
+}
+
+// ConvertMarkdown converts rendered text of a template in the format for a channel: Markdown becomes Slack
+// mrkdwn for Slack and plain text for SMS, in-app, push and webhooks. Teams cards render Markdown
+// themselves and email has its own conversion, MarkdownToHTML and MarkdownToText; their text, like text
+// of templates in no format, is returned unchanged
+func ConvertMarkdown(format, channel, text string) string {
+	if format != TemplateFormatMarkdown {
+		return text
+	}
+	switch channel {
+	case ChannelSlack:
+		return MarkdownToMrkdwn(text)
+	case ChannelSMS, ChannelInApp, ChannelPush, ChannelWebhook:
+		return MarkdownToText(text)
+	default:
+		return text
+	}
+}
+
+// MarkdownToHTML converts Markdown to HTML. It supports headings, paragraphs, bullet and numbered lists,
+// block quotes, fenced code blocks, thematic breaks, and bold, italic, strikethrough, code and link
+// spans. Raw HTML is escaped, and links other than http, https and mailto are rendered as their text
+func MarkdownToHTML(markdown string) string {
+	var builder strings.Builder
+	writeHTMLBlocks(&builder, parseMarkdownBlocks(markdown))
+	return strings.TrimSuffix(builder.String(), "\n")
+}
+
+// MarkdownToMrkdwn converts Markdown to Slack mrkdwn. Headings become bold lines and list items bullets
+func MarkdownToMrkdwn(markdown string) string {
+	return joinMarkdownBlocks(parseMarkdownBlocks(markdown), true)
+}
+
+// MarkdownToText converts Markdown to plain text, dropping the markup. Links keep their URL after the text
+func MarkdownToText(markdown string) string {
+	return joinMarkdownBlocks(parseMarkdownBlocks(markdown), false)
+}
+
+// Kinds of Markdown blocks
+const (
+	blockParagraph = iota
+	blockHeading
+	blockList
+	blockQuote
+	blockCode
+	blockBreak
+)
+
+// markdownBlock is a block of a Markdown document. Lists hold their item texts, quotes their blocks
+type markdownBlock struct {
+	kind     int
+	level    int // Heading level
+	text     string
+	items    []string
+	ordered  bool
+	start    int // First number of an ordered list
+	children []markdownBlock
+}
+
+var (
+	headingPattern   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?[ \t#]*$`)
+	bulletPattern    = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	orderedPattern   = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	quotePattern     = regexp.MustCompile(`^ {0,3}> ?(.*)$`)
+	fencePattern     = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	breakLinePattern = regexp.MustCompile(`^ {0,3}((\*[ \t]*){3,}|(-[ \t]*){3,}|(_[ \t]*){3,})$`)
+)
+
+// parseMarkdownBlocks splits Markdown into its blocks. Lists are not nested: lines indented under an item
+// continue its text
+func parseMarkdownBlocks(markdown string) []markdownBlock {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var blocks []markdownBlock
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			blocks = append(blocks, markdownBlock{kind: blockParagraph, text: strings.Join(paragraph, "\n")})
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+
+		case fencePattern.MatchString(line):
+			flush()
+			fence := fencePattern.FindStringSubmatch(line)[1]
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			blocks = append(blocks, markdownBlock{kind: blockCode, text: strings.Join(code, "\n")})
+
+		case headingPattern.MatchString(line):
+			flush()
+			match := headingPattern.FindStringSubmatch(line)
+			blocks = append(blocks, markdownBlock{kind: blockHeading, level: len(match[1]), text: match[2]})
+
+		case breakLinePattern.MatchString(line):
+			flush()
+			blocks = append(blocks, markdownBlock{kind: blockBreak})
+
+		case quotePattern.MatchString(line):
+			flush()
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quotePattern.FindStringSubmatch(lines[i])[1])
+			}
+			i--
+			blocks = append(blocks, markdownBlock{kind: blockQuote, children: parseMarkdownBlocks(strings.Join(quoted, "\n"))})
+
+		case startsList(line, len(paragraph) > 0):
+			flush()
+			list := markdownBlock{kind: blockList, ordered: orderedPattern.MatchString(line)}
+			if list.ordered {
+				list.start, _ = strconv.Atoi(orderedPattern.FindStringSubmatch(line)[1])
+			}
+			for ; i < len(lines); i++ {
+				if item, ok := listItem(lines[i], list.ordered); ok {
+					list.items = append(list.items, item)
+					continue
+				}
+				// Indented lines continue the item, anything else ends the list
+				if len(list.items) > 0 && strings.TrimSpace(lines[i]) != "" && (strings.HasPrefix(lines[i], " ") || strings.HasPrefix(lines[i], "\t")) {
+					list.items[len(list.items)-1] += "\n" + strings.TrimSpace(lines[i])
+					continue
+				}
+				break
+			}
+			i--
+			blocks = append(blocks, list)
+
+		default:
+			paragraph = append(paragraph, strings.TrimLeft(line, " \t"))
+		}
+	}
+	flush()
+	return blocks
+}
+
+// startsList reports whether line starts a list. Within a paragraph only bullets and lists numbered from 1
+// do, so a sentence wrapped before a number stays in its paragraph
+func startsList(line string, inParagraph bool) bool {
+	if bulletPattern.MatchString(line) {
+		return true
+	}
+	match := orderedPattern.FindStringSubmatch(line)
+	return match != nil && (!inParagraph || match[1] == "1")
+}
+
+// listItem returns the text of a list item line of the list kind
+func listItem(line string, ordered bool) (string, bool) {
+	if ordered {
+		if match := orderedPattern.FindStringSubmatch(line); match != nil {
+			return match[2], true
+		}
+		return "", false
+	}
+	if match := bulletPattern.FindStringSubmatch(line); match != nil && !breakLinePattern.MatchString(line) {
+		return match[1], true
+	}
+	return "", false
+}
+
+func writeHTMLBlocks(builder *strings.Builder, blocks []markdownBlock) {
+	for _, block := range blocks {
+		switch block.kind {
+		case blockParagraph:
+			builder.WriteString("<p>" + htmlInline(parseMarkdownInline(block.text)) + "</p>\n")
+		case blockHeading:
+			fmt.Fprintf(builder, "<h%d>%s</h%d>\n", block.level, htmlInline(parseMarkdownInline(block.text)), block.level)
+		case blockList:
+			tag := "ul"
+			if block.ordered {
+				tag = "ol"
+			}
+			if block.ordered && block.start != 1 {
+				fmt.Fprintf(builder, "<ol start=\"%d\">\n", block.start)
+			} else {
+				builder.WriteString("<" + tag + ">\n")
+			}
+			for _, item := range block.items {
+				builder.WriteString("<li>" + htmlInline(parseMarkdownInline(item)) + "</li>\n")
+			}
+			builder.WriteString("</" + tag + ">\n")
+		case blockQuote:
+			builder.WriteString("<blockquote>\n")
+			writeHTMLBlocks(builder, block.children)
+			builder.WriteString("</blockquote>\n")
+		case blockCode:
+			builder.WriteString("<pre><code>" + html.EscapeString(block.text) + "</code></pre>\n")
+		case blockBreak:
+			builder.WriteString("<hr>\n")
+		}
+	}
+}
+
+// joinMarkdownBlocks writes the blocks as Slack mrkdwn or plain text, separated by blank lines
+func joinMarkdownBlocks(blocks []markdownBlock, slack bool) string {
+	inline, bullet := textInline, "- "
+	if slack {
+		inline, bullet = mrkdwnInline, "• "
+	}
+	parts := make([]string, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.kind {
+		case blockParagraph:
+			parts = append(parts, inline(parseMarkdownInline(block.text)))
+		case blockHeading:
+			spans := parseMarkdownInline(block.text)
+			// Slack has no headings, they become bold lines without the spans' own markup
+			if slack {
+				if text := textInline(spans); text != "" {
+					parts = append(parts, "*"+escapeMrkdwn(text)+"*")
+					continue
+				}
+			}
+			parts = append(parts, inline(spans))
+		case blockList:
+			lines := make([]string, len(block.items))
+			for i, item := range block.items {
+				prefix := bullet
+				if block.ordered {
+					prefix = strconv.Itoa(block.start+i) + ". "
+				}
+				lines[i] = prefix + inline(parseMarkdownInline(item))
+			}
+			parts = append(parts, strings.Join(lines, "\n"))
+		case blockQuote:
+			quoted := strings.Split(joinMarkdownBlocks(block.children, slack), "\n")
+			for i, line := range quoted {
+				quoted[i] = strings.TrimRight("> "+line, " ")
+			}
+			parts = append(parts, strings.Join(quoted, "\n"))
+		case blockCode:
+			if slack {
+				parts = append(parts, "```\n"+escapeMrkdwn(block.text)+"\n```")
+			} else {
+				parts = append(parts, block.text)
+			}
+		case blockBreak:
+			parts = append(parts, "---")
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// Kinds of Markdown spans
+const (
+	inlineText = iota
+	inlineStrong
+	inlineEmphasis
+	inlineStrike
+	inlineCode
+	inlineLink
+	inlineLineBreak
+)
+
+// markdownInline is a span of a Markdown block. Emphasis and links hold their content as children
+type markdownInline struct {
+	kind     int
+	text     string
+	url      string
+	children []markdownInline
+}
+
+// parseMarkdownInline splits text into its spans. Unmatched delimiters are kept as text, and an underscore
+// only delimits emphasis at a word boundary so snake_case names stay intact
+func parseMarkdownInline(text string) []markdownInline {
+	var spans []markdownInline
+	var literal strings.Builder
+	emit := func(span markdownInline) {
+		if literal.Len() > 0 {
+			spans = append(spans, markdownInline{kind: inlineText, text: literal.String()})
+			literal.Reset()
+		}
+		spans = append(spans, span)
+	}
+
+	for i := 0; i < len(text); {
+		rest := text[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_{}[]()#+-.!~<>|", rune(rest[1])):
+			literal.WriteByte(rest[1])
+			i += 2
+			continue
+
+		case rest[0] == '\\' && strings.HasPrefix(rest, "\\\n"), strings.HasPrefix(rest, "  \n"):
+			emit(markdownInline{kind: inlineLineBreak})
+			i += strings.Index(rest, "\n") + 1
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end > 0 {
+				emit(markdownInline{kind: inlineCode, text: rest[1 : end+1]})
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 && isAutolink(rest[1:end]) {
+				url := rest[1:end]
+				emit(markdownInline{kind: inlineLink, url: url, children: []markdownInline{{kind: inlineText, text: url}}})
+				i += end + 1
+				continue
+			}
+
+		case rest[0] == '[':
+			if label, url, length, ok := parseMarkdownLink(rest); ok {
+				emit(markdownInline{kind: inlineLink, url: url, children: parseMarkdownInline(label)})
+				i += length
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"), strings.HasPrefix(rest, "__"), strings.HasPrefix(rest, "~~"):
+			kind := inlineStrong
+			if rest[0] == '~' {
+				kind = inlineStrike
+			}
+			if inner, length, ok := delimited(text, i, rest[:2]); ok {
+				emit(markdownInline{kind: kind, children: parseMarkdownInline(inner)})
+				i += length
+				continue
+			}
+
+		case rest[0] == '*', rest[0] == '_':
+			if inner, length, ok := delimited(text, i, rest[:1]); ok {
+				emit(markdownInline{kind: inlineEmphasis, children: parseMarkdownInline(inner)})
+				i += length
+				continue
+			}
+		}
+		literal.WriteByte(rest[0])
+		i++
+	}
+	if literal.Len() > 0 {
+		spans = append(spans, markdownInline{kind: inlineText, text: literal.String()})
+	}
+	return spans
+}
+
+// delimited finds the span opened by delimiter at position start of text. The content cannot start or end
+// with a space, and underscores must open and close at word boundaries
+func delimited(text string, start int, delimiter string) (string, int, bool) {
+	open := start + len(delimiter)
+	if open >= len(text) || text[open] == ' ' || text[open] == '\n' {
+		return "", 0, false
+	}
+	underscore := delimiter[0] == '_'
+	if underscore && isWordBefore(text, start) {
+		return "", 0, false
+	}
+	for offset := open + 1; offset <= len(text)-len(delimiter); offset++ {
+		if !strings.HasPrefix(text[offset:], delimiter) || text[offset-1] == ' ' || text[offset-1] == '\\' {
+			continue
+		}
+		end := offset + len(delimiter)
+		// A single delimiter does not close on a doubled one, e.g. *a **b** c*
+		if len(delimiter) == 1 && end < len(text) && text[end] == delimiter[0] {
+			offset++
+			continue
+		}
+		if underscore && isWordAt(text, end) {
+			continue
+		}
+		return text[open:offset], end - start, true
+	}
+	return "", 0, false
+}
+
+// parseMarkdownLink parses a [label](url) link at the start of text
+func parseMarkdownLink(text string) (string, string, int, bool) {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if i+1 >= len(text) || text[i+1] != '(' {
+				return "", "", 0, false
+			}
+			end := closingParen(text[i+2:])
+			if end < 0 {
+				return "", "", 0, false
+			}
+			url := strings.TrimSpace(text[i+2 : i+2+end])
+			// An optional title after the URL is dropped
+			if space := strings.IndexAny(url, " \t"); space > 0 {
+				url = url[:space]
+			}
+			return text[1:i], strings.Trim(url, "<>"), i + 3 + end, true
+		case '\n':
+			if depth == 0 {
+				return "", "", 0, false
+			}
+		}
+	}
+	return "", "", 0, false
+}
+
+// closingParen returns the position of the parenthesis closing text, skipping balanced pairs, or -1
+func closingParen(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return i
+			}
+			depth--
+		case '\n':
+			return -1
+		}
+	}
+	return -1
+}
+
+func isAutolink(text string) bool {
+	return strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") || strings.HasPrefix(text, "mailto:")
+}
+
+// safeLinkURL reports whether a link URL may be rendered as a link: web and mail URLs and relative ones
+func safeLinkURL(url string) bool {
+	lower := strings.ToLower(url)
+	if isAutolink(lower) {
+		return true
+	}
+	colon := strings.IndexByte(lower, ':')
+	return url != "" && (colon < 0 || strings.ContainsAny(lower[:colon], "/?#"))
+}
+
+// isWordBefore reports whether a letter or digit ends text before position i
+func isWordBefore(text string, i int) bool {
+	r, _ := utf8.DecodeLastRuneInString(text[:i])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isWordAt reports whether a letter or digit starts text at position i
+func isWordAt(text string, i int) bool {
+	r, _ := utf8.DecodeRuneInString(text[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+func htmlInline(spans []markdownInline) string {
+	var builder strings.Builder
+	for _, span := range spans {
+		switch span.kind {
+		case inlineText:
+			builder.WriteString(html.EscapeString(span.text))
+		case inlineStrong:
+			builder.WriteString("<strong>" + htmlInline(span.children) + "</strong>")
+		case inlineEmphasis:
+			builder.WriteString("<em>" + htmlInline(span.children) + "</em>")
+		case inlineStrike:
+			builder.WriteString("<del>" + htmlInline(span.children) + "</del>")
+		case inlineCode:
+			builder.WriteString("<code>" + html.EscapeString(span.text) + "</code>")
+		case inlineLink:
+			if safeLinkURL(span.url) {
+				builder.WriteString(`<a href="` + html.EscapeString(span.url) + `">` + htmlInline(span.children) + "</a>")
+			} else {
+				builder.WriteString(htmlInline(span.children))
+			}
+		case inlineLineBreak:
+			builder.WriteString("<br>\n")
+		}
+	}
+	return builder.String()
+}
+
+// mrkdwnInline writes spans as Slack mrkdwn, escaping the characters Slack reserves for control sequences
+func mrkdwnInline(spans []markdownInline) string {
+	var builder strings.Builder
+	for _, span := range spans {
+		switch span.kind {
+		case inlineText:
+			builder.WriteString(escapeMrkdwn(span.text))
+		case inlineStrong:
+			builder.WriteString("*" + mrkdwnInline(span.children) + "*")
+		case inlineEmphasis:
+			builder.WriteString("_" + mrkdwnInline(span.children) + "_")
+		case inlineStrike:
+			builder.WriteString("~" + mrkdwnInline(span.children) + "~")
+		case inlineCode:
+			builder.WriteString("`" + escapeMrkdwn(span.text) + "`")
+		case inlineLink:
+			label := mrkdwnInline(span.children)
+			if !safeLinkURL(span.url) {
+				builder.WriteString(label)
+			} else if label == escapeMrkdwn(span.url) {
+				builder.WriteString("<" + escapeMrkdwn(span.url) + ">")
+			} else {
+				builder.WriteString("<" + escapeMrkdwn(span.url) + "|" + strings.ReplaceAll(label, "|", "¦") + ">")
+			}
+		case inlineLineBreak:
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
+
+func escapeMrkdwn(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func textInline(spans []markdownInline) string {
+	var builder strings.Builder
+	for _, span := range spans {
+		switch span.kind {
+		case inlineText, inlineCode:
+			builder.WriteString(span.text)
+		case inlineStrong, inlineEmphasis, inlineStrike:
+			builder.WriteString(textInline(span.children))
+		case inlineLink:
+			label := textInline(span.children)
+			builder.WriteString(label)
+			if label != span.url && safeLinkURL(span.url) {
+				builder.WriteString(" (" + span.url + ")")
+			}
+		case inlineLineBreak:
+			builder.WriteString("\n")
+		}
+	}
+	return builder.String()
+}
@@ -0,0 +1,272 @@
+package shared
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// ContentTypeAttribute is the SQS message attribute selecting the body decoder
+const ContentTypeAttribute = "contentType"
+
+// Supported queue message content types
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// MessageDecoder decodes a queue message body into a notification request
+type MessageDecoder func(body string) (NotificationRequest, error)
+
+// messageDecoders holds the binary decoders by content type. JSON bodies are parsed by the processor,
+// which also unwraps SNS and EventBridge envelopes
+var messageDecoders = map[string]MessageDecoder{
+	ContentTypeProtobuf: decodeProtobufBody,
+}
+
+// DecodeNotificationRequest decodes a message body with the decoder registered for its content type
+func DecodeNotificationRequest(contentType, body string) (NotificationRequest, error) {
+	decoder, ok := messageDecoders[contentType]
+	if !ok {
+		return NotificationRequest{}, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+	return decoder(body)
+}
+
+// Field numbers from proto/notification_request.proto
+const (
+	protoFieldID            = 1
+	protoFieldType          = 2
+	protoFieldRecipients    = 3
+	protoFieldVariables     = 4
+	protoFieldDigest        = 5
+	protoFieldVariablesJSON = 6
+	protoFieldDedupKey      = 7
+	protoFieldDedupWindow   = 8
+	protoFieldCorrelation   = 9
+	protoFieldPriority      = 10
+	protoFieldCategory      = 11
+	protoFieldChannels      = 12
+	protoFieldSegment       = 13
+	protoFieldTags          = 14
+)
+
+// Protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// EncodeProtobufBody serializes a notification request in the protobuf encoding, base64-encoded for an SQS body
+func EncodeProtobufBody(request NotificationRequest) (string, error) {
+	buf, err := MarshalProtobufRequest(request)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf), nil
+}
+
+// MarshalProtobufRequest serializes a notification request as the NotificationRequest protobuf message
+func MarshalProtobufRequest(request NotificationRequest) ([]byte, error) {
+	var buf []byte
+	buf = appendProtoString(buf, protoFieldID, request.ID)
+	buf = appendProtoString(buf, protoFieldType, request.Type)
+	for _, recipient := range request.Recipients {
+		buf = appendProtoBytes(buf, protoFieldRecipients, []byte(recipient))
+	}
+
+	structured := make(map[string]any)
+	for key, value := range request.Variables {
+		str, ok := value.(string)
+		if !ok {
+			structured[key] = value
+			continue
+		}
+		var entry []byte
+		entry = appendProtoBytes(entry, 1, []byte(key))
+		entry = appendProtoBytes(entry, 2, []byte(str))
+		buf = appendProtoBytes(buf, protoFieldVariables, entry)
+	}
+
+	if request.Digest {
+		buf = binary.AppendUvarint(buf, protoFieldDigest<<3|wireVarint)
+		buf = binary.AppendUvarint(buf, 1)
+	}
+	if len(structured) > 0 {
+		variablesJSON, err := json.Marshal(structured)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal variables: %w", err)
+		}
+		buf = appendProtoBytes(buf, protoFieldVariablesJSON, variablesJSON)
+	}
+	buf = appendProtoString(buf, protoFieldDedupKey, request.DedupKey)
+	if request.DedupWindowSeconds > 0 {
+		buf = binary.AppendUvarint(buf, protoFieldDedupWindow<<3|wireVarint)
+		buf = binary.AppendUvarint(buf, uint64(request.DedupWindowSeconds))
+	}
+	buf = appendProtoString(buf, protoFieldCorrelation, request.CorrelationKey)
+	buf = appendProtoString(buf, protoFieldPriority, request.Priority)
+	buf = appendProtoString(buf, protoFieldCategory, request.Category)
+	for _, channel := range request.Channels {
+		buf = appendProtoBytes(buf, protoFieldChannels, []byte(channel))
+	}
+	buf = appendProtoString(buf, protoFieldSegment, request.Segment)
+	for _, tag := range request.Tags {
+		buf = appendProtoBytes(buf, protoFieldTags, []byte(tag))
+	}
+
+	return buf, nil
+}
+
+func decodeProtobufBody(body string) (NotificationRequest, error) {
+	data, err := base64.StdEncoding.DecodeString(body)
+	if err != nil {
+		return NotificationRequest{}, fmt.Errorf("invalid base64 body: %w", err)
+	}
+	return UnmarshalProtobufRequest(data)
+}
+
+// UnmarshalProtobufRequest parses a NotificationRequest protobuf message
+func UnmarshalProtobufRequest(data []byte) (NotificationRequest, error) {
+	var request NotificationRequest
+	var variablesJSON []byte
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readProtoField(data)
+		if err != nil {
+			return NotificationRequest{}, err
+		}
+		data = rest
+
+		switch {
+		case field == protoFieldID && wireType == wireBytes:
+			request.ID = string(value)
+		case field == protoFieldType && wireType == wireBytes:
+			request.Type = string(value)
+		case field == protoFieldRecipients && wireType == wireBytes:
+			request.Recipients = append(request.Recipients, string(value))
+		case field == protoFieldVariables && wireType == wireBytes:
+			key, val, err := decodeProtoMapEntry(value)
+			if err != nil {
+				return NotificationRequest{}, err
+			}
+			if request.Variables == nil {
+				request.Variables = make(map[string]any)
+			}
+			request.Variables[key] = val
+		case field == protoFieldDigest && wireType == wireVarint:
+			flag, _ := binary.Uvarint(value)
+			request.Digest = flag != 0
+		case field == protoFieldVariablesJSON && wireType == wireBytes:
+			variablesJSON = value
+		case field == protoFieldDedupKey && wireType == wireBytes:
+			request.DedupKey = string(value)
+		case field == protoFieldDedupWindow && wireType == wireVarint:
+			seconds, _ := binary.Uvarint(value)
+			request.DedupWindowSeconds = int(min(seconds, MaxDedupWindowSeconds+1))
+		case field == protoFieldCorrelation && wireType == wireBytes:
+			request.CorrelationKey = string(value)
+		case field == protoFieldPriority && wireType == wireBytes:
+			request.Priority = string(value)
+		case field == protoFieldCategory && wireType == wireBytes:
+			request.Category = string(value)
+		case field == protoFieldChannels && wireType == wireBytes:
+			request.Channels = append(request.Channels, string(value))
+		case field == protoFieldSegment && wireType == wireBytes:
+			request.Segment = string(value)
+		case field == protoFieldTags && wireType == wireBytes:
+			request.Tags = append(request.Tags, string(value))
+		}
+		// Unknown fields are skipped so producers can move ahead of the processor
+	}
+
+	if len(variablesJSON) > 0 {
+		var structured map[string]any
+		if err := json.Unmarshal(variablesJSON, &structured); err != nil {
+			return NotificationRequest{}, fmt.Errorf("invalid variables_json: %w", err)
+		}
+		if request.Variables == nil {
+			request.Variables = make(map[string]any, len(structured))
+		}
+		for key, value := range structured {
+			request.Variables[key] = value
+		}
+	}
+
+	return request, nil
+}
+
+// decodeProtoMapEntry decodes a map<string, string> entry
+func decodeProtoMapEntry(data []byte) (string, string, error) {
+	var key, value string
+	for len(data) > 0 {
+		field, wireType, fieldValue, rest, err := readProtoField(data)
+		if err != nil {
+			return "", "", err
+		}
+		data = rest
+		if wireType != wireBytes {
+			continue
+		}
+		switch field {
+		case 1:
+			key = string(fieldValue)
+		case 2:
+			value = string(fieldValue)
+		}
+	}
+	return key, value, nil
+}
+
+// readProtoField reads one field, returning its raw value (the varint bytes for varints) and the remaining data
+func readProtoField(data []byte) (field uint64, wireType uint64, value []byte, rest []byte, err error) {
+	tag, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, 0, nil, nil, fmt.Errorf("invalid protobuf tag")
+	}
+	data = data[n:]
+	field, wireType = tag>>3, tag&0x7
+
+	switch wireType {
+	case wireVarint:
+		_, n = binary.Uvarint(data)
+		if n <= 0 {
+			return 0, 0, nil, nil, fmt.Errorf("invalid varint for field %d", field)
+		}
+		return field, wireType, data[:n], data[n:], nil
+	case wireFixed64:
+		if len(data) < 8 {
+			return 0, 0, nil, nil, fmt.Errorf("truncated fixed64 for field %d", field)
+		}
+		return field, wireType, data[:8], data[8:], nil
+	case wireBytes:
+		length, n := binary.Uvarint(data)
+		if n <= 0 || uint64(len(data)-n) < length {
+			return 0, 0, nil, nil, fmt.Errorf("truncated bytes for field %d", field)
+		}
+		end := n + int(length)
+		return field, wireType, data[n:end], data[end:], nil
+	case wireFixed32:
+		if len(data) < 4 {
+			return 0, 0, nil, nil, fmt.Errorf("truncated fixed32 for field %d", field)
+		}
+		return field, wireType, data[:4], data[4:], nil
+	default:
+		return 0, 0, nil, nil, fmt.Errorf("unsupported wire type %d for field %d", wireType, field)
+	}
+}
+
+func appendProtoString(buf []byte, field uint64, value string) []byte {
+	if value == "" {
+		return buf
+	}
+	return appendProtoBytes(buf, field, []byte(value))
+}
+
+func appendProtoBytes(buf []byte, field uint64, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, field<<3|wireBytes)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
@@ -0,0 +1,65 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtobufRequestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		request NotificationRequest
+	}{
+		{
+			name:    "minimal",
+			request: NotificationRequest{ID: "request-1", Type: "alert", Recipients: []string{"user-1"}},
+		},
+		{
+			name: "every field",
+			request: NotificationRequest{
+				ID:                 "request-2",
+				Type:               "alert",
+				Recipients:         []string{"user-1", "user-2"},
+				Variables:          map[string]any{"message": "Disk full", "count": float64(3), "hosts": []any{"a", "b"}},
+				Digest:             true,
+				DedupKey:           "disk-full-a",
+				DedupWindowSeconds: 600,
+				CorrelationKey:     "incident-42",
+				Priority:           PriorityCritical,
+				Category:           "marketing",
+				Channels:           []string{ChannelEmail, ChannelSlack},
+				Segment:            "segment-1",
+				Tags:               []string{"team:payments", "env:prod"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := EncodeProtobufBody(tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := DecodeNotificationRequest(ContentTypeProtobuf, body)
+			if err != nil {
+				t.Fatalf("DecodeNotificationRequest() error = %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.request) {
+				t.Fatalf("round trip = %+v, want %+v", decoded, tt.request)
+			}
+		})
+	}
+}
+
+func TestUnmarshalProtobufRequestSkipsUnknownFields(t *testing.T) {
+	data, err := MarshalProtobufRequest(NotificationRequest{ID: "request-1", Type: "alert", Priority: PriorityCritical})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Field 99, a string from a newer producer
+	data = appendProtoString(data, 99, "newer")
+
+	request, err := UnmarshalProtobufRequest(data)
+	if err != nil || request.ID != "request-1" || request.Priority != PriorityCritical {
+		t.Fatalf("UnmarshalProtobufRequest() = %+v, %v", request, err)
+	}
+}
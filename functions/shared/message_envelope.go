@@ -0,0 +1,70 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Envelope formats the processor can unwrap
+const (
+	EnvelopeNone        = "none"
+	EnvelopeSNS         = "sns"
+	EnvelopeEventBridge = "eventbridge"
+)
+
+// maxEnvelopeDepth bounds unwrapping, e.g. an EventBridge event forwarded through SNS
+const maxEnvelopeDepth = 3
+
+// messageEnvelope holds the fields used to detect SNS notifications and EventBridge events
+type messageEnvelope struct {
+	Type       string          `json:"Type"`
+	TopicArn   string          `json:"TopicArn"`
+	Message    *string         `json:"Message"`
+	DetailType string          `json:"detail-type"`
+	Source     string          `json:"source"`
+	Detail     json.RawMessage `json:"detail"`
+}
+
+// MessageOrigin is the outermost envelope of a queue message and who published through it
+type MessageOrigin struct {
+	Envelope string // EnvelopeNone, EnvelopeSNS or EnvelopeEventBridge
+	Source   string // Topic ARN of an SNS notification, source of an EventBridge event
+}
+
+// UnwrapMessageBody strips SNS and EventBridge envelopes from a queue message body and returns
+// the inner payload along with the outermost envelope found. Bodies without an envelope are returned as is
+func UnwrapMessageBody(body string) (string, MessageOrigin, error) {
+	origin := MessageOrigin{Envelope: EnvelopeNone}
+	for depth := 0; depth < maxEnvelopeDepth; depth++ {
+		var wrapper messageEnvelope
+		if err := json.Unmarshal([]byte(body), &wrapper); err != nil {
+			// Not an object we understand, let the caller report the parse failure
+			return body, origin, nil
+		}
+
+		var kind, source string
+		switch {
+		case wrapper.Type == "Notification" && wrapper.TopicArn != "" && wrapper.Message != nil:
+			kind = EnvelopeSNS
+			source = wrapper.TopicArn
+			body = *wrapper.Message
+		case wrapper.DetailType != "" && wrapper.Source != "" && len(wrapper.Detail) > 0:
+			kind = EnvelopeEventBridge
+			source = wrapper.Source
+			body = string(wrapper.Detail)
+			// Some producers put the request in detail as a JSON string
+			var detail string
+			if json.Unmarshal(wrapper.Detail, &detail) == nil {
+				body = detail
+			}
+		default:
+			return body, origin, nil
+		}
+
+		if origin.Envelope == EnvelopeNone {
+			origin = MessageOrigin{Envelope: kind, Source: source}
+		}
+	}
+
+	return "", origin, fmt.Errorf("message is wrapped in more than %d envelopes", maxEnvelopeDepth)
+}
@@ -0,0 +1,41 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// MetricsNamespace is the CloudWatch namespace of the service's custom metrics
+const MetricsNamespace = "NotificationService"
+
+// Constants for custom metric names
+const (
+	MetricHandlerPanic = "HandlerPanic"
+)
+
+// EmitMetric writes a count metric in CloudWatch Embedded Metric Format. Lambda ships stdout to
+// CloudWatch Logs, which extracts the metric without an API call
+func EmitMetric(name string, value float64, dimensions map[string]string) {
+	dimensionKeys := make([]string, 0, len(dimensions))
+	record := map[string]any{name: value}
+	for key, dimValue := range dimensions {
+		dimensionKeys = append(dimensionKeys, key)
+		record[key] = dimValue
+	}
+	record["_aws"] = map[string]any{
+		"Timestamp": GetCurrentTime().UnixMilli(),
+		"CloudWatchMetrics": []map[string]any{{
+			"Namespace":  MetricsNamespace,
+			"Dimensions": [][]string{dimensionKeys},
+			"Metrics":    []map[string]string{{"Name": name, "Unit": "Count"}},
+		}},
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		logger.Error().Err(err).Str("metric", name).Msg("Failed to marshal metric")
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(line))
+}
@@ -10,56 +10,193 @@ type UserContext struct {
 
 // User represents a user in the notification service
 type User struct {
-	UserID    string     `json:"userId" dynamodbav:"userId"`
-	Email     string     `json:"email,omitempty" dynamodbav:"email,omitempty"`
-	Role      string     `json:"role,omitempty" dynamodbav:"role,omitempty"` // "super_admin" | "user"
-	IsActive  *bool      `json:"isActive,omitempty" dynamodbav:"isActive,omitempty"`
-	CreatedAt *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
-	UpdatedAt *time.Time `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	UserID      string            `json:"userId" dynamodbav:"userId"`
+	Email       string            `json:"email,omitempty" dynamodbav:"email,omitempty"`
+	PhoneNumber string            `json:"phoneNumber,omitempty" dynamodbav:"phoneNumber,omitempty"` // E.164, where SMS notifications are sent
+	Role        string            `json:"role,omitempty" dynamodbav:"role,omitempty"`               // "super_admin" | "user"
+	IsActive    *bool             `json:"isActive,omitempty" dynamodbav:"isActive,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty" dynamodbav:"attributes,omitempty"` // e.g. department, region, plan. Rendered as {{user.<key>}}
+	// Where priority=critical requests are always sent, managed through /preferences/critical-contact
+	CriticalContact *CriticalContact `json:"criticalContact,omitempty" dynamodbav:"criticalContact,omitempty"`
+	CreatedAt       *time.Time       `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt       *time.Time       `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
 }
 
 // Template represents a notification template
 type Template struct {
-	Context     string     `json:"context" dynamodbav:"context"`           // "*" for global, userId for user-specific
-	TypeChannel string     `json:"type#channel" dynamodbav:"type#channel"` // "alert#email", "report#slack", etc.
-	Content     string     `json:"content,omitempty" dynamodbav:"content,omitempty"`
-	IsActive    *bool      `json:"isActive,omitempty" dynamodbav:"isActive,omitempty"`
-	CreatedAt   *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
-	UpdatedAt   *time.Time `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	Context        string          `json:"context" dynamodbav:"context"`           // "*" for global, userId for user-specific
+	TypeChannel    string          `json:"type#channel" dynamodbav:"type#channel"` // "alert#email", "report#slack", etc.
+	Content        string          `json:"content,omitempty" dynamodbav:"content,omitempty"`
+	Format         string          `json:"format,omitempty" dynamodbav:"format,omitempty"` // "text" (default) | "markdown", converted for each channel when rendered
+	IsActive       *bool           `json:"isActive,omitempty" dynamodbav:"isActive,omitempty"`
+	CreatedBy      string          `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	TemporaryUntil *time.Time      `json:"temporaryUntil,omitempty" dynamodbav:"temporaryUntil,omitempty"` // Temporary templates are not used after it, their owner is reminded before
+	SharedWith     []TemplateShare `json:"sharedWith,omitempty" dynamodbav:"sharedWith,omitempty"`         // Users and teams a user template is shared with
+	Tags           []string        `json:"tags,omitempty" dynamodbav:"tags,omitempty"`                     // Group templates for listing and bulk operations
+	CreatedAt      *time.Time      `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt      *time.Time      `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+
+	Compiled *CompiledTemplate `json:"-" dynamodbav:"compiled,omitempty"` // Parsed content, set on save
+}
+
+// NotificationType is a notification type registered by a super admin beside the built-in ones
+type NotificationType struct {
+	Type            string               `json:"type" dynamodbav:"type"`
+	DisplayName     string               `json:"displayName" dynamodbav:"displayName"`
+	Description     string               `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Category        string               `json:"category,omitempty" dynamodbav:"category,omitempty"`               // Category of its requests that name none, operational when empty
+	DefaultChannels []string             `json:"defaultChannels,omitempty" dynamodbav:"defaultChannels,omitempty"` // Used for recipients whose preferences have no entry for the type
+	Variables       []VariableDefinition `json:"variables,omitempty" dynamodbav:"-"`                               // The type's variable schema, stored in the variable schemas table
+	CreatedBy       string               `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	CreatedAt       *time.Time           `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt       *time.Time           `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// ThrottleExemption lifts daily caps, the email warm-up limit and content dedup for a recipient or for every
+// request of a producer, so designated critical systems always get through
+type ThrottleExemption struct {
+	ExemptionID  string     `json:"exemptionId" dynamodbav:"exemptionId"` // Derived from the scope and subject, one exemption per subject
+	Scope        string     `json:"scope" dynamodbav:"scope"`             // "user" | "producer"
+	UserID       string     `json:"userId,omitempty" dynamodbav:"userId,omitempty"`
+	ProducerKind string     `json:"producerKind,omitempty" dynamodbav:"producerKind,omitempty"`
+	ProducerID   string     `json:"producerId,omitempty" dynamodbav:"producerId,omitempty"`
+	Reason       string     `json:"reason" dynamodbav:"reason"`
+	CreatedBy    string     `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	CreatedAt    *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+}
+
+// VariableSchema declares the variables of a notification type: templates may only use declared variables,
+// and requests must carry the required ones with values of the declared types
+type VariableSchema struct {
+	Type      string               `json:"type" dynamodbav:"type"`
+	Variables []VariableDefinition `json:"variables" dynamodbav:"variables"`
+	UpdatedBy string               `json:"updatedBy,omitempty" dynamodbav:"updatedBy,omitempty"`
+	CreatedAt *time.Time           `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt *time.Time           `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// VariableDefinition declares one variable of a notification type
+type VariableDefinition struct {
+	Name        string `json:"name" dynamodbav:"name"`
+	Type        string `json:"type,omitempty" dynamodbav:"type,omitempty"` // "string" | "number" | "boolean", any of them when empty
+	Required    bool   `json:"required,omitempty" dynamodbav:"required,omitempty"`
+	Description string `json:"description,omitempty" dynamodbav:"description,omitempty"`
+}
+
+// TemplateIssue is a problem found when linting template content. Templates with errors cannot be saved,
+// warnings point at content that may not render as intended
+type TemplateIssue struct {
+	Severity string `json:"severity"`        // "error" | "warning"
+	Code     string `json:"code"`            // e.g. "undeclared_variable", "invalid_json"
+	Field    string `json:"field,omitempty"` // Email or Teams field, or variable, the issue is about
+	Message  string `json:"message"`
+}
+
+// TemplateValidation is the result of linting template content without saving it
+type TemplateValidation struct {
+	Valid     bool            `json:"valid"` // No issue is an error
+	Issues    []TemplateIssue `json:"issues"`
+	Variables []string        `json:"variables"` // Variables the content uses, each once
+}
+
+// TemplateShare grants a user, or every member of a team, access to another user's template
+type TemplateShare struct {
+	Principal string `json:"principal" dynamodbav:"principal"` // User ID, or "team:<teamId>"
+	Access    string `json:"access" dynamodbav:"access"`       // "read" | "edit"
 }
 
 // UserPreferences represents user notification preferences
 type UserPreferences struct {
-	Context     string                    `json:"context" dynamodbav:"context"` // "*" for global, userId for user-specific
-	Preferences map[string]PreferenceItem `json:"preferences,omitempty" dynamodbav:"preferences,omitempty"`
-	Timezone    string                    `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`
-	Language    string                    `json:"language,omitempty" dynamodbav:"language,omitempty"`
-	CreatedAt   *time.Time                `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
-	UpdatedAt   *time.Time                `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	Context       string                     `json:"context" dynamodbav:"context"` // "*" for global, userId for user-specific
+	Preferences   map[string]PreferenceItem  `json:"preferences,omitempty" dynamodbav:"preferences,omitempty"`
+	Timezone      string                     `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`
+	Language      string                     `json:"language,omitempty" dynamodbav:"language,omitempty"`
+	DigestTime    string                     `json:"digestTime,omitempty" dynamodbav:"digestTime,omitempty"`       // HH:MM in the user's timezone, defaults to 09:00
+	MissedSummary *bool                      `json:"missedSummary,omitempty" dynamodbav:"missedSummary,omitempty"` // Weekly summary of unread in-app notifications, on unless false
+	DailyCaps     map[string]int             `json:"dailyCaps,omitempty" dynamodbav:"dailyCaps,omitempty"`         // Per channel, notifications beyond the cap go to an end-of-day digest
+	Consent       map[string]CategoryConsent `json:"consent,omitempty" dynamodbav:"consent,omitempty"`             // Per category, user contexts only
+	Overrides     []PreferenceOverride       `json:"overrides,omitempty" dynamodbav:"overrides,omitempty"`         // Temporary, applied in order until they expire
+	CreatedAt     *time.Time                 `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt     *time.Time                 `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// PreferenceOverride temporarily replaces the channels or the enabled state of some or all notification
+// types, e.g. every type to Slack for the next 8 hours
+type PreferenceOverride struct {
+	OverrideID string         `json:"overrideId" dynamodbav:"overrideId"`
+	Types      []string       `json:"types,omitempty" dynamodbav:"types,omitempty"` // Every type of the preferences when empty
+	Preference PreferenceItem `json:"preference" dynamodbav:"preference"`           // Set fields replace the stored ones
+	Reason     string         `json:"reason,omitempty" dynamodbav:"reason,omitempty"`
+	ExpiresAt  *time.Time     `json:"expiresAt" dynamodbav:"expiresAt"`
+	CreatedBy  string         `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	CreatedAt  *time.Time     `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
 }
 
 // PreferenceItem represents preferences for a notification type
 type PreferenceItem struct {
 	Channels []string `json:"channels,omitempty" dynamodbav:"channels,omitempty"`
 	Enabled  *bool    `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+	Delivery string   `json:"delivery,omitempty" dynamodbav:"delivery,omitempty"` // "immediate" | "daily_digest", defaults to immediate
 }
 
 // ScheduledNotification represents a scheduled notification
 type ScheduledNotification struct {
-	ScheduleID string          `json:"scheduleId,omitempty" dynamodbav:"scheduleId,omitempty"`
-	UserID     string          `json:"userId,omitempty" dynamodbav:"userId,omitempty"`
-	Type       string          `json:"type,omitempty" dynamodbav:"type,omitempty"`
-	Variables  map[string]any  `json:"variables,omitempty" dynamodbav:"variables,omitempty"`
-	Schedule   *ScheduleConfig `json:"schedule,omitempty" dynamodbav:"schedule,omitempty"`
-	Status     string          `json:"status,omitempty" dynamodbav:"status,omitempty"` // "active" | "paused" | "cancelled"
-	CreatedAt  *time.Time      `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
-	UpdatedAt  *time.Time      `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	ScheduleID  string          `json:"scheduleId,omitempty" dynamodbav:"scheduleId,omitempty"`
+	UserID      string          `json:"userId,omitempty" dynamodbav:"userId,omitempty"`
+	Type        string          `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Variables   map[string]any  `json:"variables,omitempty" dynamodbav:"variables,omitempty"`
+	Schedule    *ScheduleConfig `json:"schedule,omitempty" dynamodbav:"schedule,omitempty"`
+	Status      string          `json:"status,omitempty" dynamodbav:"status,omitempty"`           // "active" | "paused" | "cancelled"
+	DryRun      bool            `json:"dryRun,omitempty" dynamodbav:"dryRun,omitempty"`           // Occurrences are rendered and recorded without being delivered
+	Occurrences int             `json:"occurrences,omitempty" dynamodbav:"occurrences,omitempty"` // Occurrences processed so far, dry runs are not counted
+	Tags        []string        `json:"tags,omitempty" dynamodbav:"tags,omitempty"`               // e.g. "team:payments", carried into the requests it sends
+	Recipients  []string        `json:"recipients,omitempty" dynamodbav:"recipients,omitempty"`   // Set by super admins, user IDs and team: or oncall: references. The owner when empty
+	Segment     string          `json:"segment,omitempty" dynamodbav:"segment,omitempty"`         // Set by super admins, segment ID whose users are notified alongside the recipients
+	CreatedAt   *time.Time      `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt   *time.Time      `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// CreateScheduleRequest is the body of POST /scheduled-notifications
+type CreateScheduleRequest struct {
+	Type       string         `json:"type"`
+	Variables  map[string]any `json:"variables"`
+	Schedule   ScheduleConfig `json:"schedule"`
+	DryRun     bool           `json:"dryRun,omitempty"`
+	Tags       []string       `json:"tags,omitempty"`
+	Recipients []string       `json:"recipients,omitempty"` // Super admins only, the caller when neither recipients nor a segment are set
+	Segment    string         `json:"segment,omitempty"`    // Super admins only
+}
+
+// UpdateScheduleRequest is the body of PUT /scheduled-notifications/{scheduleId}, omitted fields are kept
+type UpdateScheduleRequest struct {
+	Variables map[string]any  `json:"variables,omitempty"`
+	Schedule  *ScheduleConfig `json:"schedule,omitempty"`
+	Status    string          `json:"status,omitempty"`
+	DryRun    *bool           `json:"dryRun,omitempty"` // false takes the schedule live
+	Tags      []string        `json:"tags,omitempty"`   // Replaces the tags, an empty list removes them
+}
+
+// CloneScheduleRequest is the body of POST /scheduled-notifications/{scheduleId}/clone. Its variables replace
+// those of the cloned schedule, the others are copied
+type CloneScheduleRequest struct {
+	Variables map[string]any `json:"variables,omitempty"`
 }
 
 // ScheduleConfig represents the scheduling configuration
 type ScheduleConfig struct {
-	Type       string `json:"type,omitempty" dynamodbav:"type,omitempty"`             // "one_time" | "recurring" | "cron"
-	Expression string `json:"expression,omitempty" dynamodbav:"expression,omitempty"` // ISO timestamp or cron expression
+	Type           string     `json:"type,omitempty" dynamodbav:"type,omitempty"`                     // "one_time" | "recurring" | "cron"
+	Expression     string     `json:"expression,omitempty" dynamodbav:"expression,omitempty"`         // ISO timestamp or cron expression
+	EndDate        *time.Time `json:"endDate,omitempty" dynamodbav:"endDate,omitempty"`               // The schedule stops firing after it, its owner is reminded before
+	Timezone       string     `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`             // IANA timezone the expression is evaluated in, the user's preferred one by default
+	MaxOccurrences int        `json:"maxOccurrences,omitempty" dynamodbav:"maxOccurrences,omitempty"` // The schedule is cancelled once it fired this many times
+}
+
+// ScheduleNextRuns lists the upcoming firing times of a schedule or of an expression being tried out
+type ScheduleNextRuns struct {
+	ScheduleID string      `json:"scheduleId,omitempty"`
+	Expression string      `json:"expression"`
+	Timezone   string      `json:"timezone"`
+	Runs       []time.Time `json:"runs"` // In the timezone, earliest first
 }
 
 // SystemConfig represents system configuration
@@ -73,22 +210,45 @@ type SystemConfig struct {
 
 // SystemSettings represents the actual system settings data
 type SystemSettings struct {
-	SlackSettings SlackSettings `json:"slack,omitempty" dynamodbav:"slack,omitempty"`
-	EmailSettings EmailSettings `json:"email,omitempty" dynamodbav:"email,omitempty"`
-	InAppSettings InAppSettings `json:"inApp,omitempty" dynamodbav:"inApp,omitempty"`
+	SlackSettings     SlackSettings             `json:"slack,omitempty" dynamodbav:"slack,omitempty"`
+	EmailSettings     EmailSettings             `json:"email,omitempty" dynamodbav:"email,omitempty"`
+	InAppSettings     InAppSettings             `json:"inApp,omitempty" dynamodbav:"inApp,omitempty"`
+	SmsSettings       SmsSettings               `json:"sms,omitempty" dynamodbav:"sms,omitempty"`
+	PushSettings      PushSettings              `json:"push,omitempty" dynamodbav:"push,omitempty"`
+	WebhookSettings   WebhookSettings           `json:"webhook,omitempty" dynamodbav:"webhook,omitempty"`
+	TeamsSettings     TeamsSettings             `json:"teams,omitempty" dynamodbav:"teams,omitempty"`
+	Calendar          CalendarSettings          `json:"calendar,omitempty" dynamodbav:"calendar,omitempty"`
+	Localization      LocalizationSettings      `json:"localization,omitempty" dynamodbav:"localization,omitempty"`           // Global only
+	EmailWarmUp       EmailWarmUpSettings       `json:"emailWarmUp,omitempty" dynamodbav:"emailWarmUp,omitempty"`             // Global only, applies to the from address's domain
+	EnvironmentBanner EnvironmentBannerSettings `json:"environmentBanner,omitempty" dynamodbav:"environmentBanner,omitempty"` // Global only
+	Retention         RetentionSettings         `json:"retention,omitempty" dynamodbav:"retention,omitempty"`                 // Global only
+	Processor         ProcessorSettings         `json:"processor,omitempty" dynamodbav:"processor,omitempty"`                 // Global only
+	Fallback          FallbackSettings          `json:"fallback,omitempty" dynamodbav:"fallback,omitempty"`                   // Global only
+	Schedules         ScheduleSettings          `json:"schedules,omitempty" dynamodbav:"schedules,omitempty"`                 // Global only
+	EmailBounces      EmailBounceSettings       `json:"emailBounces,omitempty" dynamodbav:"emailBounces,omitempty"`           // Global only, redelivery of soft-bounced emails
 }
 
 // SlackSettings represents Slack configuration
 type SlackSettings struct {
-	WebhookURL string `json:"webhookUrl,omitempty" dynamodbav:"webhookUrl,omitempty"`
+	WebhookURL       string            `json:"webhookUrl,omitempty" dynamodbav:"webhookUrl,omitempty"`
+	WebhookURLByType map[string]string `json:"webhookUrlByType,omitempty" dynamodbav:"webhookUrlByType,omitempty"` // Notification type to the webhook of another Slack channel
+	Enabled          *bool             `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+}
+
+// TeamsSettings represents Microsoft Teams configuration
+type TeamsSettings struct {
+	WebhookURL string `json:"webhookUrl,omitempty" dynamodbav:"webhookUrl,omitempty"` // Incoming webhook or workflow URL of the Teams channel
 	Enabled    *bool  `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
 }
 
 // EmailSettings represents email configuration
 type EmailSettings struct {
-	FromAddress    string `json:"fromAddress,omitempty" dynamodbav:"fromAddress,omitempty"`
-	ReplyToAddress string `json:"replyToAddress,omitempty" dynamodbav:"replyToAddress,omitempty"`
-	Enabled        *bool  `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+	FromAddress       string            `json:"fromAddress,omitempty" dynamodbav:"fromAddress,omitempty"`
+	FromAddressByType map[string]string `json:"fromAddressByType,omitempty" dynamodbav:"fromAddressByType,omitempty"` // Notification type to its own from address, e.g. alerts@
+	ReplyToAddress    string            `json:"replyToAddress,omitempty" dynamodbav:"replyToAddress,omitempty"`
+	Provider          string            `json:"provider,omitempty" dynamodbav:"provider,omitempty"`             // "ses" (default) | "sendgrid"
+	SendGridAPIKey    string            `json:"sendGridApiKey,omitempty" dynamodbav:"sendGridApiKey,omitempty"` // Required with the sendgrid provider
+	Enabled           *bool             `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
 }
 
 // InAppSettings represents in-app notification configuration
@@ -97,12 +257,243 @@ type InAppSettings struct {
 	Enabled        *bool    `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
 }
 
+// SmsSettings represents SMS configuration
+type SmsSettings struct {
+	SenderID string `json:"senderId,omitempty" dynamodbav:"senderId,omitempty"` // Alphanumeric sender ID, in countries that support one
+	Enabled  *bool  `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+}
+
+// PushSettings represents push notification configuration
+type PushSettings struct {
+	PlatformApplicationARNs map[string]string `json:"platformApplicationArns,omitempty" dynamodbav:"platformApplicationArns,omitempty"` // Global only, push platform to its SNS platform application
+	Enabled                 *bool             `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+}
+
+// WebhookSettings represents the configuration of a user's outbound webhooks: the default endpoint, and the
+// endpoints of notification types posted elsewhere
+type WebhookSettings struct {
+	URL              string                             `json:"url,omitempty" dynamodbav:"url,omitempty"`
+	Secret           string                             `json:"secret,omitempty" dynamodbav:"secret,omitempty"`                     // Signs every delivery, see SignWebhook
+	ExpectedStatuses []int                              `json:"expectedStatuses,omitempty" dynamodbav:"expectedStatuses,omitempty"` // Statuses that count as delivered, defaults to any 2xx
+	ExpectedBody     string                             `json:"expectedBody,omitempty" dynamodbav:"expectedBody,omitempty"`         // Text the response body must contain to count as delivered
+	EndpointsByType  map[string]WebhookEndpointSettings `json:"endpointsByType,omitempty" dynamodbav:"endpointsByType,omitempty"`   // Notification type to an endpoint of its own
+	Enabled          *bool                              `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+}
+
+// WebhookEndpointSettings is an endpoint webhooks are posted to, with the responses that count as delivered
+type WebhookEndpointSettings struct {
+	URL              string `json:"url" dynamodbav:"url"`
+	Secret           string `json:"secret" dynamodbav:"secret"`
+	ExpectedStatuses []int  `json:"expectedStatuses,omitempty" dynamodbav:"expectedStatuses,omitempty"` // Defaults to any 2xx
+	ExpectedBody     string `json:"expectedBody,omitempty" dynamodbav:"expectedBody,omitempty"`         // Checked against the first 1 KB of the body
+}
+
+// CalendarSettings represents the business calendar used to defer non-urgent notifications
+type CalendarSettings struct {
+	Enabled       *bool    `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"`
+	Timezone      string   `json:"timezone,omitempty" dynamodbav:"timezone,omitempty"`           // IANA name, defaults to UTC
+	WorkingDays   []string `json:"workingDays,omitempty" dynamodbav:"workingDays,omitempty"`     // "monday".."sunday", defaults to Monday-Friday
+	Holidays      []string `json:"holidays,omitempty" dynamodbav:"holidays,omitempty"`           // YYYY-MM-DD
+	WorkdayStart  string   `json:"workdayStart,omitempty" dynamodbav:"workdayStart,omitempty"`   // HH:MM deferred notifications are sent at, defaults to 09:00
+	DeferredTypes []string `json:"deferredTypes,omitempty" dynamodbav:"deferredTypes,omitempty"` // Defaults to report and notification
+}
+
 // NotificationRequest represents a request to send a notification
 type NotificationRequest struct {
-	ID         string         `json:"id"`
-	Type       string         `json:"type"`
-	Recipients []string       `json:"recipients"`
-	Variables  map[string]any `json:"variables"`
+	ID                 string           `json:"id" dynamodbav:"id"`
+	Type               string           `json:"type" dynamodbav:"type"`
+	Recipients         []string         `json:"recipients" dynamodbav:"recipients"`
+	Variables          map[string]any   `json:"variables" dynamodbav:"variables"`
+	Digest             bool             `json:"digest,omitempty" dynamodbav:"digest,omitempty"`                         // Set by digest schedules, delivers held notifications
+	Segment            string           `json:"segment,omitempty" dynamodbav:"segment,omitempty"`                       // Segment ID, expanded into child requests by the processor
+	SystemTemplate     string           `json:"systemTemplate,omitempty" dynamodbav:"systemTemplate,omitempty"`         // Built-in email template used instead of stored templates
+	Channels           []string         `json:"channels,omitempty" dynamodbav:"channels,omitempty"`                     // Restricts delivery to these channels
+	ReplayOf           string           `json:"replayOf,omitempty" dynamodbav:"replayOf,omitempty"`                     // ID of the request this one replays
+	Overflow           bool             `json:"overflow,omitempty" dynamodbav:"overflow,omitempty"`                     // Digest of the notifications held after the daily cap of Channels was reached
+	Priority           string           `json:"priority,omitempty" dynamodbav:"priority,omitempty"`                     // "critical" also reaches each recipient's verified critical contact
+	Category           string           `json:"category,omitempty" dynamodbav:"category,omitempty"`                     // Overrides the type's category, e.g. "marketing"
+	Test               bool             `json:"test,omitempty" dynamodbav:"test,omitempty"`                             // Admin test notification, marked and delivered at once
+	Producer           *Producer        `json:"producer,omitempty" dynamodbav:"producer,omitempty"`                     // Who queued the request, resolved by the processor
+	Sequence           string           `json:"sequence,omitempty" dynamodbav:"sequence,omitempty"`                     // Sequence ID started for each recipient instead of sending a notification
+	SequenceStep       *SequenceStepRef `json:"sequenceStep,omitempty" dynamodbav:"sequenceStep,omitempty"`             // Set on the steps of a sequence enrollment
+	DedupKey           string           `json:"dedupKey,omitempty" dynamodbav:"dedupKey,omitempty"`                     // Producer key, a request repeating it within the window is suppressed
+	DedupWindowSeconds int              `json:"dedupWindowSeconds,omitempty" dynamodbav:"dedupWindowSeconds,omitempty"` // Window of DedupKey, an hour by default
+	Job                *JobChunkRef     `json:"job,omitempty" dynamodbav:"job,omitempty"`                               // Set on the chunks a segment or broadcast was split into
+	CorrelationKey     string           `json:"correlationKey,omitempty" dynamodbav:"correlationKey,omitempty"`         // Emails of requests sharing it thread under the first one each recipient got
+	DryRun             bool             `json:"dryRun,omitempty" dynamodbav:"dryRun,omitempty"`                         // Runs the pipeline and records the rendered content without delivering it
+	Deferred           bool             `json:"deferred,omitempty" dynamodbav:"deferred,omitempty"`                     // Re-queued by the processor for a later delivery, not a new occurrence of its schedule
+	Tags               []string         `json:"tags,omitempty" dynamodbav:"tags,omitempty"`                             // Tags of the schedule that sent the request, recorded in its history
+	BounceRetry        int              `json:"bounceRetry,omitempty" dynamodbav:"bounceRetry,omitempty"`               // Redelivery attempt of an email that soft-bounced, set on its one-time schedule
+}
+
+// JobChunkRef identifies a chunk of a job, the child request carrying part of a split request's recipients
+type JobChunkRef struct {
+	JobID string `json:"jobId" dynamodbav:"jobId"`
+	Chunk int    `json:"chunk" dynamodbav:"chunk"` // 1-based
+}
+
+// Job rolls up the progress of a segment or broadcast request split into chunks. Its ID is the request's
+type Job struct {
+	JobID           string     `json:"jobId" dynamodbav:"jobId"`
+	Type            string     `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Segment         string     `json:"segment,omitempty" dynamodbav:"segment,omitempty"` // Segment ID, empty for broadcasts
+	Status          string     `json:"status" dynamodbav:"status"`                       // "running" | "completed"
+	TotalChunks     int        `json:"totalChunks" dynamodbav:"totalChunks"`
+	ChunksProcessed int        `json:"chunksProcessed" dynamodbav:"chunksProcessed"`
+	Queued          int        `json:"queued" dynamodbav:"queued"`       // Recipients queued in the chunks
+	Processed       int        `json:"processed" dynamodbav:"processed"` // Recipients processed, teams count their members
+	Succeeded       int        `json:"succeeded" dynamodbav:"succeeded"`
+	Failed          int        `json:"failed" dynamodbav:"failed"`
+	Producer        *Producer  `json:"producer,omitempty" dynamodbav:"producer,omitempty"`
+	DoneChunks      []int      `json:"-" dynamodbav:"doneChunks,omitempty,numberset"` // Chunks already counted, so a redelivered chunk is counted once
+	CreatedAt       *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt       *time.Time `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty" dynamodbav:"completedAt,omitempty"`
+	ExpiresAt       int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// DigestItem represents a notification held for a user's next digest
+type DigestItem struct {
+	UserID    string         `json:"userId" dynamodbav:"userId"`
+	ItemKey   string         `json:"itemKey" dynamodbav:"itemKey"`                     // createdAt#requestId, keeps items in arrival order
+	Channel   string         `json:"channel,omitempty" dynamodbav:"channel,omitempty"` // Set for items held after the channel's daily cap was reached
+	RequestID string         `json:"requestId,omitempty" dynamodbav:"requestId,omitempty"`
+	Type      string         `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Variables map[string]any `json:"variables,omitempty" dynamodbav:"variables,omitempty"`
+	CreatedAt *time.Time     `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	ExpiresAt int            `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// InboxItem is an in-app notification kept in a user's inbox until they delete it or it expires
+type InboxItem struct {
+	UserID         string        `json:"userId" dynamodbav:"userId"`
+	NotificationID string        `json:"notificationId" dynamodbav:"notificationId"` // ID of the request that delivered it
+	Type           string        `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Content        string        `json:"content,omitempty" dynamodbav:"content,omitempty"`
+	Read           bool          `json:"read" dynamodbav:"read,omitempty"`
+	ReadAt         *time.Time    `json:"readAt,omitempty" dynamodbav:"readAt,omitempty"`
+	Previews       []LinkPreview `json:"previews,omitempty" dynamodbav:"previews,omitempty"` // Added shortly after delivery for the links in the content
+	CreatedAt      *time.Time    `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	ExpiresAt      int           `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// DeviceToken is a device registered for push notifications. The token itself is never returned by the
+// API, devices are referred to by their ID
+type DeviceToken struct {
+	UserID      string     `json:"userId" dynamodbav:"userId"`
+	DeviceID    string     `json:"deviceId" dynamodbav:"deviceId"` // Derived from the token, see BuildDeviceID
+	Platform    string     `json:"platform,omitempty" dynamodbav:"platform,omitempty"`
+	Token       string     `json:"-" dynamodbav:"token,omitempty"`
+	EndpointARN string     `json:"-" dynamodbav:"endpointArn,omitempty"` // SNS platform endpoint of the token
+	CreatedAt   *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// QuarantinedMessage represents a queue message that kept failing and was moved out of the queue
+type QuarantinedMessage struct {
+	MessageID     string     `json:"messageId" dynamodbav:"messageId"`
+	Body          string     `json:"body" dynamodbav:"body"`
+	ReceiveCount  int        `json:"receiveCount" dynamodbav:"receiveCount"`
+	Error         string     `json:"error" dynamodbav:"error"` // Error of the last attempt
+	QuarantinedAt *time.Time `json:"quarantinedAt,omitempty" dynamodbav:"quarantinedAt,omitempty"`
+	ExpiresAt     int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// EmailMessage ties an email sent through SES to the request and recipient it was sent for, so the bounce
+// handler can tell which delivery bounced and redeliver it
+type EmailMessage struct {
+	MessageID   string     `json:"messageId" dynamodbav:"messageId"` // SES message ID
+	RequestID   string     `json:"requestId,omitempty" dynamodbav:"requestId,omitempty"`
+	RecipientID string     `json:"recipientId,omitempty" dynamodbav:"recipientId,omitempty"`
+	Attempt     int        `json:"attempt,omitempty" dynamodbav:"attempt,omitempty"` // Redelivery attempt, 0 for the first delivery
+	Bounce      string     `json:"bounce,omitempty" dynamodbav:"bounce,omitempty"`   // "hard" | "soft" | "undetermined" once the email bounced
+	SentAt      *time.Time `json:"sentAt,omitempty" dynamodbav:"sentAt,omitempty"`
+	BouncedAt   *time.Time `json:"bouncedAt,omitempty" dynamodbav:"bouncedAt,omitempty"`
+	ExpiresAt   int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// FailedNotification represents a queue message the processor rejected as invalid. It is acknowledged
+// rather than retried, a retry cannot make it valid
+type FailedNotification struct {
+	MessageID string           `json:"messageId" dynamodbav:"messageId"`
+	RequestID string           `json:"requestId,omitempty" dynamodbav:"requestId,omitempty"`
+	Type      string           `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Body      string           `json:"body" dynamodbav:"body"`
+	Errors    ValidationErrors `json:"errors" dynamodbav:"errors"`
+	Producer  *Producer        `json:"producer,omitempty" dynamodbav:"producer,omitempty"`
+	FailedAt  *time.Time       `json:"failedAt,omitempty" dynamodbav:"failedAt,omitempty"`
+	ExpiresAt int              `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// NotificationHistory represents the processing outcome of a notification request
+type NotificationHistory struct {
+	ID              string               `json:"id" dynamodbav:"id"`
+	Type            string               `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Request         *NotificationRequest `json:"request,omitempty" dynamodbav:"request,omitempty"`
+	TotalRecipients int                  `json:"totalRecipients" dynamodbav:"totalRecipients"`
+	SuccessCount    int                  `json:"successCount" dynamodbav:"successCount"`
+	FailureCount    int                  `json:"failureCount" dynamodbav:"failureCount"`
+	Deliveries      []DeliveryResult     `json:"deliveries,omitempty" dynamodbav:"deliveries,omitempty"`
+	Producer        *Producer            `json:"producer,omitempty" dynamodbav:"producer,omitempty"`       // Who queued the request
+	EnqueuedAt      *time.Time           `json:"enqueuedAt,omitempty" dynamodbav:"enqueuedAt,omitempty"`   // When the request's message reached the queue
+	DuplicateOf     string               `json:"duplicateOf,omitempty" dynamodbav:"duplicateOf,omitempty"` // Request holding the dedup key, set when this one was suppressed
+	Tags            []string             `json:"tags,omitempty" dynamodbav:"tags,omitempty"`               // Tags of the request, analytics are also rolled up per tag
+	CreatedAt       *time.Time           `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	ExpiresAt       int                  `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+}
+
+// DeliveryResult represents the outcome for one recipient and channel
+type DeliveryResult struct {
+	RecipientID       string     `json:"recipientId" dynamodbav:"recipientId"`
+	Channel           string     `json:"channel,omitempty" dynamodbav:"channel,omitempty"`
+	Success           bool       `json:"success" dynamodbav:"success"`
+	Suppressed        bool       `json:"suppressed,omitempty" dynamodbav:"suppressed,omitempty"`
+	Deferred          bool       `json:"deferred,omitempty" dynamodbav:"deferred,omitempty"`
+	Digested          bool       `json:"digested,omitempty" dynamodbav:"digested,omitempty"`
+	DryRun            bool       `json:"dryRun,omitempty" dynamodbav:"dryRun,omitempty"` // rendered by a dry run, not delivered
+	Error             string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
+	DeliveredAt       *time.Time `json:"deliveredAt,omitempty" dynamodbav:"deliveredAt,omitempty"`
+	ProviderMessageID string     `json:"providerMessageId,omitempty" dynamodbav:"providerMessageId,omitempty"` // e.g. the SES message ID
+	EmailMessageID    string     `json:"emailMessageId,omitempty" dynamodbav:"emailMessageId,omitempty"`       // Message-ID header of the email
+	ThreadMessageID   string     `json:"threadMessageId,omitempty" dynamodbav:"threadMessageId,omitempty"`     // Message-ID of the correlation key's original email the email replies to
+	ResponseStatus    int        `json:"responseStatus,omitempty" dynamodbav:"responseStatus,omitempty"`       // HTTP status of the webhook endpoint
+}
+
+// Acknowledgment represents a recipient acknowledging a notification
+type Acknowledgment struct {
+	NotificationID   string     `json:"notificationId" dynamodbav:"notificationId"`
+	UserID           string     `json:"userId" dynamodbav:"userId"`
+	Type             string     `json:"type,omitempty" dynamodbav:"type,omitempty"`
+	Note             string     `json:"note,omitempty" dynamodbav:"note,omitempty"`
+	SentAt           *time.Time `json:"sentAt,omitempty" dynamodbav:"sentAt,omitempty"`
+	AcknowledgedAt   *time.Time `json:"acknowledgedAt,omitempty" dynamodbav:"acknowledgedAt,omitempty"`
+	AckDate          string     `json:"ackDate,omitempty" dynamodbav:"ackDate,omitempty"` // YYYY-MM-DD, used by the rollup job
+	TimeToAckSeconds float64    `json:"timeToAckSeconds,omitempty" dynamodbav:"timeToAckSeconds,omitempty"`
+	ExpiresAt        int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"` // Set by the audit retention policy
+}
+
+// AnalyticsRollup represents an aggregated daily metric
+type AnalyticsRollup struct {
+	MetricKey string     `json:"metricKey" dynamodbav:"metricKey"` // e.g. "ack_sla#alert"
+	Date      string     `json:"date" dynamodbav:"date"`           // YYYY-MM-DD
+	Count     int        `json:"count" dynamodbav:"count"`
+	Average   float64    `json:"average" dynamodbav:"average"`
+	P50       float64    `json:"p50" dynamodbav:"p50"`
+	P90       float64    `json:"p90" dynamodbav:"p90"`
+	P95       float64    `json:"p95" dynamodbav:"p95"`
+	P99       float64    `json:"p99" dynamodbav:"p99"`
+	CreatedAt *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+}
+
+// APIUsage counts a caller's calls to one endpoint on a UTC day
+type APIUsage struct {
+	Date       string `json:"date" dynamodbav:"date"`         // YYYY-MM-DD
+	UsageKey   string `json:"-" dynamodbav:"usageKey"`        // "<userId>#<endpoint>"
+	UserID     string `json:"userId" dynamodbav:"userId"`     // Cognito sub of the caller, "anonymous" without one
+	Endpoint   string `json:"endpoint" dynamodbav:"endpoint"` // Method and resource path, e.g. "GET /templates/{templateId}"
+	Count      int    `json:"count" dynamodbav:"count"`
+	ErrorCount int    `json:"errorCount" dynamodbav:"errorCount"` // Calls answered with a 4xx or 5xx
+	ExpiresAt  int    `json:"-" dynamodbav:"expiresAt,omitempty"`
 }
 
 // APIResponse represents a standard API response
@@ -118,11 +509,67 @@ type ErrorResponse struct {
 	Details interface{} `json:"details,omitempty"`
 }
 
+// User-scoped resource types DELETE /me/resources removes
+const (
+	UserResourceTemplates   = "templates"
+	UserResourceSchedules   = "schedules"
+	UserResourcePreferences = "preferences"
+)
+
+// UserResourcesDeletion reports what DELETE /me/resources removed
+type UserResourcesDeletion struct {
+	Templates   int  `json:"templates"`   // User-specific templates deleted
+	Schedules   int  `json:"schedules"`   // Scheduled notifications deleted with their EventBridge schedules
+	Preferences bool `json:"preferences"` // Whether the user's preferences were deleted
+}
+
+// SimulationRequest is the body of POST /notifications/simulate
+type SimulationRequest struct {
+	Type        string         `json:"type"`
+	RecipientID string         `json:"recipientId,omitempty"` // The calling user when empty, another user for admins
+	Variables   map[string]any `json:"variables,omitempty"`
+	Channels    []string       `json:"channels,omitempty"` // Restricts the simulation to these channels
+	Language    string         `json:"language,omitempty"` // Language whose template variants are tried first
+}
+
+// Simulation is what a notification would reach a recipient with, rendered without being sent
+type Simulation struct {
+	RecipientID string              `json:"recipientId"`
+	Type        string              `json:"type"`
+	Skipped     string              `json:"skipped,omitempty"` // Why the recipient would not receive the type at all
+	Channels    []ChannelSimulation `json:"channels,omitempty"`
+}
+
+// ChannelSimulation is the content a notification would be delivered with on a channel
+type ChannelSimulation struct {
+	Channel          string   `json:"channel"`
+	Template         string   `json:"template,omitempty"` // Context and type#channel of the template used
+	Subject          string   `json:"subject,omitempty"`  // Email subject or Teams card title
+	Body             string   `json:"body,omitempty"`
+	HTMLBody         string   `json:"htmlBody,omitempty"`
+	MissingVariables []string `json:"missingVariables,omitempty"`
+	Skipped          string   `json:"skipped,omitempty"` // Why nothing would be sent on the channel
+}
+
 // SuccessResponse represents a success response
 type SuccessResponse struct {
 	Message string `json:"message"`
 }
 
+// ChannelTestResult reports a test message sent through a channel with the caller's effective config
+type ChannelTestResult struct {
+	Channel    string `json:"channel"`
+	Context    string `json:"context"`              // Context of the config the channel settings came from, "*" for the global one
+	Enabled    bool   `json:"enabled"`              // Whether that config enables the channel, the test is sent either way
+	Provider   string `json:"provider,omitempty"`   // Email provider
+	Recipient  string `json:"recipient,omitempty"`  // Email address, phone number or user ID the test went to
+	MessageID  string `json:"messageId,omitempty"`  // Provider message ID of email, SMS and push
+	StatusCode int    `json:"statusCode,omitempty"` // Webhook endpoint's response status
+	Response   string `json:"response,omitempty"`   // Webhook endpoint's response body, truncated
+	Devices    int    `json:"devices,omitempty"`    // Push devices the test was delivered to
+	Error      string `json:"error,omitempty"`
+}
+
 // PaginatedResponse represents a paginated response
 type PaginatedResponse struct {
 	Items     any    `json:"items"`
@@ -134,9 +581,172 @@ type PaginatedResponse struct {
 type NotificationValidation struct {
 	IDUserIDTypeChannel string     `json:"id#userId#type#channel" dynamodbav:"id#userId#type#channel"`
 	Content             string     `json:"content,omitempty" dynamodbav:"content,omitempty"`
+	Producer            *Producer  `json:"producer,omitempty" dynamodbav:"producer,omitempty"` // Who queued the request
 	CreatedAt           *time.Time `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
 	Error               string     `json:"error,omitempty" dynamodbav:"error,omitempty"`
-	ExpiresAt           int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"` // 1 day expiration
+	ContentHash         string     `json:"contentHash,omitempty" dynamodbav:"contentHash,omitempty"`
+	Suppressed          bool       `json:"suppressed,omitempty" dynamodbav:"suppressed,omitempty"` // duplicate content within the dedup window
+	ProviderMessageID   string     `json:"providerMessageId,omitempty" dynamodbav:"providerMessageId,omitempty"`
+	ResponseStatus      int        `json:"responseStatus,omitempty" dynamodbav:"responseStatus,omitempty"` // HTTP status of the webhook endpoint
+	ResponseBody        string     `json:"responseBody,omitempty" dynamodbav:"responseBody,omitempty"`     // Truncated response of the webhook endpoint
+	ExpiresAt           int        `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`           // Set by the results retention policy, 1 day by default
+}
+
+// DedupRecord marks a key (e.g. recipient/channel/content hash) as already delivered until it expires
+type DedupRecord struct {
+	DedupKey  string       `json:"dedupKey" dynamodbav:"dedupKey"`
+	CreatedAt *time.Time   `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	ExpiresAt int          `json:"expiresAt,omitempty" dynamodbav:"expiresAt,omitempty"`
+	Count     int          `json:"count,omitempty" dynamodbav:"count,omitempty"`         // Used by counters such as daily caps
+	RequestID string       `json:"requestId,omitempty" dynamodbav:"requestId,omitempty"` // Used by producer dedup keys, the request that claimed the key
+	Preview   *LinkPreview `json:"preview,omitempty" dynamodbav:"preview,omitempty"`     // Used by the link preview cache, nil for links without one
+	MessageID string       `json:"messageId,omitempty" dynamodbav:"messageId,omitempty"` // Used by email threads, the Message-ID of the thread's original email
+}
+
+// OnCallRotation represents a built-in on-call rotation
+type OnCallRotation struct {
+	RotationID string           `json:"rotationId" dynamodbav:"rotationId"`
+	Name       string           `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Members    []string         `json:"members,omitempty" dynamodbav:"members,omitempty"`       // User IDs in rotation order
+	StartAt    *time.Time       `json:"startAt,omitempty" dynamodbav:"startAt,omitempty"`       // Start of the first member's first shift
+	ShiftHours int              `json:"shiftHours,omitempty" dynamodbav:"shiftHours,omitempty"` // Length of each shift
+	Overrides  []OnCallOverride `json:"overrides,omitempty" dynamodbav:"overrides,omitempty"`
+	CreatedAt  *time.Time       `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt  *time.Time       `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// OnCallOverride temporarily replaces the scheduled on-call user
+type OnCallOverride struct {
+	UserID  string     `json:"userId" dynamodbav:"userId"`
+	StartAt *time.Time `json:"startAt" dynamodbav:"startAt"`
+	EndAt   *time.Time `json:"endAt" dynamodbav:"endAt"`
+}
+
+// CurrentOnCall returns the user on call at the given time, or "" if the rotation has not started
+func (r OnCallRotation) CurrentOnCall(now time.Time) string {
+	for _, override := range r.Overrides {
+		if override.StartAt != nil && override.EndAt != nil && !now.Before(*override.StartAt) && now.Before(*override.EndAt) {
+			return override.UserID
+		}
+	}
+
+	if len(r.Members) == 0 || r.StartAt == nil || r.ShiftHours <= 0 || now.Before(*r.StartAt) {
+		return ""
+	}
+
+	shift := int(now.Sub(*r.StartAt) / (time.Duration(r.ShiftHours) * time.Hour))
+	return r.Members[shift%len(r.Members)]
+}
+
+// Team represents a group of users notified together
+type Team struct {
+	TeamID          string                    `json:"teamId" dynamodbav:"teamId"`
+	Name            string                    `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Members         []string                  `json:"members,omitempty" dynamodbav:"members,omitempty"`
+	Preferences     map[string]PreferenceItem `json:"preferences,omitempty" dynamodbav:"preferences,omitempty"`         // Shared preferences, used when a member has none of their own
+	SlackWebhookURL string                    `json:"slackWebhookUrl,omitempty" dynamodbav:"slackWebhookUrl,omitempty"` // Shared team Slack channel
+	Policy          string                    `json:"policy,omitempty" dynamodbav:"policy,omitempty"`                   // "all_members" | "oncall" | "channel"
+	RotationID      string                    `json:"rotationId,omitempty" dynamodbav:"rotationId,omitempty"`           // On-call rotation used by the "oncall" policy
+	CreatedAt       *time.Time                `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt       *time.Time                `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// Segment is a named set of users selected by their attributes
+type Segment struct {
+	SegmentID string          `json:"segmentId" dynamodbav:"segmentId"`
+	Name      string          `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Criteria  SegmentCriteria `json:"criteria" dynamodbav:"criteria"`
+	CreatedAt *time.Time      `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt *time.Time      `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// SegmentCriteria selects the users of a segment, every criterion that is set must match
+type SegmentCriteria struct {
+	Roles        []string            `json:"roles,omitempty" dynamodbav:"roles,omitempty"`
+	Orgs         []string            `json:"orgs,omitempty" dynamodbav:"orgs,omitempty"`                 // Organisation email domains, e.g. "example.com"
+	EnabledTypes []string            `json:"enabledTypes,omitempty" dynamodbav:"enabledTypes,omitempty"` // Notification types the user's preferences must enable
+	Attributes   map[string][]string `json:"attributes,omitempty" dynamodbav:"attributes,omitempty"`     // User attribute key to accepted values
+}
+
+// Sequence is an ordered set of notifications sent to a user with delays between the steps, e.g. an
+// onboarding drip campaign. Users are enrolled one at a time, see SequenceEnrollment
+type Sequence struct {
+	SequenceID  string         `json:"sequenceId" dynamodbav:"sequenceId"`
+	Name        string         `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Description string         `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	Steps       []SequenceStep `json:"steps" dynamodbav:"steps"`
+	CreatedBy   string         `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	CreatedAt   *time.Time     `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt   *time.Time     `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// SequenceStep is a notification of a sequence, rendered with the type's templates like any other
+type SequenceStep struct {
+	Type         string         `json:"type" dynamodbav:"type"`
+	DelayMinutes int            `json:"delayMinutes,omitempty" dynamodbav:"delayMinutes,omitempty"` // Wait after the previous step, or after the start for the first one
+	Variables    map[string]any `json:"variables,omitempty" dynamodbav:"variables,omitempty"`       // Override the variables given at the start
+	Channels     []string       `json:"channels,omitempty" dynamodbav:"channels,omitempty"`         // Restricts delivery to these channels
+}
+
+// SequenceEnrollment is a user's progress through a sequence. A user has at most one enrollment per
+// sequence, starting the sequence again replaces a completed or cancelled one
+type SequenceEnrollment struct {
+	UserID      string                `json:"userId" dynamodbav:"userId"`
+	SequenceID  string                `json:"sequenceId" dynamodbav:"sequenceId"`
+	RunID       string                `json:"runId" dynamodbav:"runId"` // Identifies this start, steps queued for an earlier one are dropped
+	Status      string                `json:"status" dynamodbav:"status"`
+	CurrentStep int                   `json:"currentStep" dynamodbav:"currentStep"`                   // Index of the step waiting to be sent
+	NextStepAt  *time.Time            `json:"nextStepAt,omitempty" dynamodbav:"nextStepAt,omitempty"` // When the current step is due, unset once the enrollment ended
+	Variables   map[string]any        `json:"variables,omitempty" dynamodbav:"variables,omitempty"`   // Given at the start, shared by every step
+	Steps       []SequenceStepOutcome `json:"steps,omitempty" dynamodbav:"steps,omitempty"`           // Steps already sent or skipped
+	StartedAt   *time.Time            `json:"startedAt,omitempty" dynamodbav:"startedAt,omitempty"`
+	UpdatedAt   *time.Time            `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// SequenceStepOutcome records what happened to a step of an enrollment
+type SequenceStepOutcome struct {
+	Step      int        `json:"step" dynamodbav:"step"`
+	Outcome   string     `json:"outcome" dynamodbav:"outcome"`                         // "sent" or "skipped"
+	RequestID string     `json:"requestId,omitempty" dynamodbav:"requestId,omitempty"` // Notification request of a sent step
+	At        *time.Time `json:"at,omitempty" dynamodbav:"at,omitempty"`
+}
+
+// SequenceStepRef marks a notification request as a step of a user's sequence enrollment
+type SequenceStepRef struct {
+	SequenceID string `json:"sequenceId" dynamodbav:"sequenceId"`
+	RunID      string `json:"runId" dynamodbav:"runId"`
+	Step       int    `json:"step" dynamodbav:"step"`
+}
+
+// Rule routes or changes notifications matching all of its conditions, see EvaluateRules
+type Rule struct {
+	RuleID         string          `json:"ruleId" dynamodbav:"ruleId"`
+	Name           string          `json:"name,omitempty" dynamodbav:"name,omitempty"`
+	Order          int             `json:"order" dynamodbav:"order"`                         // Rules run in ascending order
+	Enabled        *bool           `json:"enabled,omitempty" dynamodbav:"enabled,omitempty"` // Rules are enabled unless set to false
+	Conditions     []RuleCondition `json:"conditions" dynamodbav:"conditions"`               // All must match, no conditions matches every notification
+	Actions        []RuleAction    `json:"actions" dynamodbav:"actions"`
+	CreatedBy      string          `json:"createdBy,omitempty" dynamodbav:"createdBy,omitempty"`
+	TemporaryUntil *time.Time      `json:"temporaryUntil,omitempty" dynamodbav:"temporaryUntil,omitempty"` // Temporary rules stop applying after it, their creator is reminded before
+	CreatedAt      *time.Time      `json:"createdAt,omitempty" dynamodbav:"createdAt,omitempty"`
+	UpdatedAt      *time.Time      `json:"updatedAt,omitempty" dynamodbav:"updatedAt,omitempty"`
+}
+
+// RuleCondition compares a field of the notification or its recipient with a value
+type RuleCondition struct {
+	Field    string   `json:"field" dynamodbav:"field"`       // "type" | "variables.<name>" | "recipient.<attribute>"
+	Operator string   `json:"operator" dynamodbav:"operator"` // "equals" | "not_equals" | "in" | "contains" | "exists"
+	Value    string   `json:"value,omitempty" dynamodbav:"value,omitempty"`
+	Values   []string `json:"values,omitempty" dynamodbav:"values,omitempty"` // For "in"
+}
+
+// RuleAction is what a matching rule does to the notification for the recipient
+type RuleAction struct {
+	Type     string `json:"type" dynamodbav:"type"`                             // "add_channel" | "set_priority" | "set_variable" | "drop"
+	Channel  string `json:"channel,omitempty" dynamodbav:"channel,omitempty"`   // For "add_channel"
+	Priority string `json:"priority,omitempty" dynamodbav:"priority,omitempty"` // For "set_priority", "critical" or "normal"
+	Variable string `json:"variable,omitempty" dynamodbav:"variable,omitempty"` // For "set_variable"
+	Value    string `json:"value,omitempty" dynamodbav:"value,omitempty"`       // For "set_variable"
 }
 
 // Constants for notification types
@@ -148,9 +758,32 @@ const (
 
 // Constants for channels
 const (
-	ChannelEmail = "email"
-	ChannelSlack = "slack"
-	ChannelInApp = "in_app"
+	ChannelEmail   = "email"
+	ChannelSlack   = "slack"
+	ChannelInApp   = "in_app"
+	ChannelSMS     = "sms"
+	ChannelPush    = "push"
+	ChannelWebhook = "webhook"
+	ChannelTeams   = "teams"
+)
+
+// Constants for recipient references resolved by the processor
+const (
+	RecipientPrefixOnCall = "oncall:" // "oncall:<rotationId>"
+	RecipientPrefixTeam   = "team:"   // "team:<teamId>"
+)
+
+// Constants for team delivery policies
+const (
+	TeamPolicyAllMembers = "all_members"
+	TeamPolicyOnCall     = "oncall"
+	TeamPolicyChannel    = "channel"
+)
+
+// Constants for preference delivery modes
+const (
+	DeliveryImmediate   = "immediate"
+	DeliveryDailyDigest = "daily_digest"
 )
 
 // Constants for user roles
@@ -164,6 +797,15 @@ const (
 	ScheduleTypeCron = "cron"
 )
 
+// Constants for analytics metrics
+const (
+	MetricAckSLA      = "ack_sla"
+	MetricDeliverySLA = "delivery_sla"
+)
+
+// DateFormat is the layout used for daily rollup keys
+const DateFormat = "2006-01-02"
+
 // Constants for notification status
 const (
 	StatusActive    = "active"
@@ -171,3 +813,9 @@ const (
 	StatusCancelled = "cancelled"
 	StatusCompleted = "completed"
 )
+
+// Statuses of a job
+const (
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+)
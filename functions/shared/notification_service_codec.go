@@ -0,0 +1,143 @@
+package shared
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Field numbers from proto/notification_service.proto
+const (
+	protoFieldBatchRequests       = 1
+	protoFieldResponseID          = 1
+	protoFieldResponseDuplicateOf = 2
+	protoFieldBatchResults        = 1
+	protoFieldResultID            = 1
+	protoFieldResultQueued        = 2
+	protoFieldResultError         = 3
+	protoFieldResultDuplicateOf   = 4
+)
+
+// SendResult is the outcome of one request of a gRPC SendBatch call
+type SendResult struct {
+	ID          string
+	Queued      bool
+	Error       string // Why the request was rejected, empty when queued
+	DuplicateOf string // Request holding the dedup key, set when this one was suppressed
+}
+
+// UnmarshalSendBatchRequest parses a SendBatchRequest protobuf message into its notification requests
+func UnmarshalSendBatchRequest(data []byte) ([]NotificationRequest, error) {
+	var requests []NotificationRequest
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readProtoField(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		if field != protoFieldBatchRequests || wireType != wireBytes {
+			continue
+		}
+		request, err := UnmarshalProtobufRequest(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request %d: %w", len(requests), err)
+		}
+		requests = append(requests, request)
+	}
+	return requests, nil
+}
+
+// MarshalSendNotificationResponse serializes the SendNotificationResponse of a request, duplicateOf is
+// set when it was suppressed as a duplicate instead of queued
+func MarshalSendNotificationResponse(id, duplicateOf string) []byte {
+	buf := appendProtoString(nil, protoFieldResponseID, id)
+	return appendProtoString(buf, protoFieldResponseDuplicateOf, duplicateOf)
+}
+
+// MarshalSendBatchResponse serializes the SendBatchResponse of a batch, one result per request
+func MarshalSendBatchResponse(results []SendResult) []byte {
+	var buf []byte
+	for _, result := range results {
+		var entry []byte
+		entry = appendProtoString(entry, protoFieldResultID, result.ID)
+		if result.Queued {
+			entry = binary.AppendUvarint(entry, protoFieldResultQueued<<3|wireVarint)
+			entry = binary.AppendUvarint(entry, 1)
+		}
+		entry = appendProtoString(entry, protoFieldResultError, result.Error)
+		entry = appendProtoString(entry, protoFieldResultDuplicateOf, result.DuplicateOf)
+		buf = appendProtoBytes(buf, protoFieldBatchResults, entry)
+	}
+	return buf
+}
+
+// MarshalSendBatchRequest serializes the notification requests of a batch as a SendBatchRequest
+func MarshalSendBatchRequest(requests []NotificationRequest) ([]byte, error) {
+	var buf []byte
+	for i, request := range requests {
+		entry, err := MarshalProtobufRequest(request)
+		if err != nil {
+			return nil, fmt.Errorf("invalid request %d: %w", i, err)
+		}
+		buf = appendProtoBytes(buf, protoFieldBatchRequests, entry)
+	}
+	return buf, nil
+}
+
+// UnmarshalSendNotificationResponse parses a SendNotificationResponse into the request's ID and, when it
+// was suppressed as a duplicate, the request it duplicates
+func UnmarshalSendNotificationResponse(data []byte) (id, duplicateOf string, err error) {
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readProtoField(data)
+		if err != nil {
+			return "", "", err
+		}
+		data = rest
+		if wireType != wireBytes {
+			continue
+		}
+		switch field {
+		case protoFieldResponseID:
+			id = string(value)
+		case protoFieldResponseDuplicateOf:
+			duplicateOf = string(value)
+		}
+	}
+	return id, duplicateOf, nil
+}
+
+// UnmarshalSendBatchResponse parses a SendBatchResponse into its per-request results
+func UnmarshalSendBatchResponse(data []byte) ([]SendResult, error) {
+	var results []SendResult
+	for len(data) > 0 {
+		field, wireType, value, rest, err := readProtoField(data)
+		if err != nil {
+			return nil, err
+		}
+		data = rest
+		if field != protoFieldBatchResults || wireType != wireBytes {
+			continue
+		}
+
+		var result SendResult
+		for len(value) > 0 {
+			resultField, resultWireType, resultValue, resultRest, err := readProtoField(value)
+			if err != nil {
+				return nil, err
+			}
+			value = resultRest
+			switch {
+			case resultField == protoFieldResultID && resultWireType == wireBytes:
+				result.ID = string(resultValue)
+			case resultField == protoFieldResultQueued && resultWireType == wireVarint:
+				flag, _ := binary.Uvarint(resultValue)
+				result.Queued = flag != 0
+			case resultField == protoFieldResultError && resultWireType == wireBytes:
+				result.Error = string(resultValue)
+			case resultField == protoFieldResultDuplicateOf && resultWireType == wireBytes:
+				result.DuplicateOf = string(resultValue)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,153 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// builtInNotificationTypes are the notification types the service always knows
+var builtInNotificationTypes = []string{NotificationTypeAlert, NotificationTypeReport, NotificationTypeNotification}
+
+// notificationTypeNamePattern matches the names custom notification types can be registered with
+var notificationTypeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,63}$`)
+
+var (
+	customTypesMu       sync.Mutex
+	customTypes         map[string]bool
+	customTypesLoaded   bool
+	customTypesLoadedAt time.Time
+	customTypesTTL      = GetEnvDuration("NOTIFICATION_TYPES_CACHE_TTL", time.Minute)
+)
+
+// IsBuiltInNotificationType reports whether the notification type is one of the built-in ones
+func IsBuiltInNotificationType(notificationType string) bool {
+	return slices.Contains(builtInNotificationTypes, notificationType)
+}
+
+// ValidateNotificationType reports whether the notification type is built in or registered in the
+// notification types table. Registered types are read through a cache refreshed every
+// NOTIFICATION_TYPES_CACHE_TTL (default 1 minute); while the table cannot be read the types last loaded apply
+func ValidateNotificationType(notificationType string) bool {
+	if IsBuiltInNotificationType(notificationType) {
+		return true
+	}
+	if notificationType == "" {
+		return false
+	}
+	return customNotificationTypes()[notificationType]
+}
+
+// NotificationTypeNames returns the built-in notification types followed by the registered ones, sorted
+func NotificationTypeNames() []string {
+	names := slices.Clone(builtInNotificationTypes)
+	return append(names, slices.Sorted(maps.Keys(customNotificationTypes()))...)
+}
+
+// InvalidateNotificationTypes drops the cached registered types, so the next check reads the table
+func InvalidateNotificationTypes() {
+	customTypesMu.Lock()
+	defer customTypesMu.Unlock()
+	customTypesLoaded = false
+}
+
+// Validate checks a custom notification type: a lowercase name that is not reserved, a display name, and
+// known category and default channels
+func (t NotificationType) Validate() error {
+	if !notificationTypeNamePattern.MatchString(t.Type) {
+		return fmt.Errorf("type must be 2-64 lowercase letters, digits or underscores, starting with a letter")
+	}
+	if IsBuiltInNotificationType(t.Type) || t.Type == PartialType {
+		return fmt.Errorf("type %s is reserved", t.Type)
+	}
+	if t.DisplayName == "" {
+		return fmt.Errorf("displayName is required")
+	}
+	if t.Category != "" && !ValidateCategory(t.Category) {
+		return fmt.Errorf("invalid category: %s", t.Category)
+	}
+	for _, channel := range t.DefaultChannels {
+		if !ValidateChannel(channel) {
+			return fmt.Errorf("invalid default channel: %s", channel)
+		}
+	}
+	return VariableSchema{Variables: t.Variables}.Validate()
+}
+
+// WithDefaultChannels returns the preferences with the type's default channels enabled when they have no
+// entry for the type
+func (t NotificationType) WithDefaultChannels(preferences UserPreferences) UserPreferences {
+	if len(t.DefaultChannels) == 0 {
+		return preferences
+	}
+	if _, exists := preferences.Preferences[t.Type]; exists {
+		return preferences
+	}
+	enabled := true
+	items := maps.Clone(preferences.Preferences)
+	if items == nil {
+		items = make(map[string]PreferenceItem)
+	}
+	items[t.Type] = PreferenceItem{Channels: slices.Clone(t.DefaultChannels), Enabled: &enabled}
+	preferences.Preferences = items
+	return preferences
+}
+
+// customNotificationTypes returns the registered notification types, loading them when the cache expired
+func customNotificationTypes() map[string]bool {
+	customTypesMu.Lock()
+	defer customTypesMu.Unlock()
+
+	if customTypesLoaded && time.Since(customTypesLoadedAt) < customTypesTTL {
+		return customTypes
+	}
+	if NotificationTypesTable == "" || DynamoDBClient == nil {
+		return customTypes
+	}
+
+	ctx := context.Background()
+	loaded, err := scanNotificationTypeNames(ctx)
+	// A failed load is retried after the TTL rather than on every check
+	customTypesLoaded = true
+	customTypesLoadedAt = time.Now()
+	if err != nil {
+		LogWarn(ctx).Err(err).Msg("Failed to load notification types, using the last loaded ones")
+		return customTypes
+	}
+	customTypes = loaded
+	return customTypes
+}
+
+// scanNotificationTypeNames reads the names of the registered notification types
+func scanNotificationTypeNames(ctx context.Context) (map[string]bool, error) {
+	names := make(map[string]bool)
+	paginator := dynamodb.NewScanPaginator(DynamoDBClient, &dynamodb.ScanInput{
+		TableName:                aws.String(NotificationTypesTable),
+		ProjectionExpression:     aws.String("#type"),
+		ExpressionAttributeNames: map[string]string{"#type": "type"},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var items []struct {
+			Type string `dynamodbav:"type"`
+		}
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			names[item.Type] = true
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,53 @@
+package shared
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlBreakPattern  = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</h[1-6]>|</tr>`)
+	htmlTagPattern    = regexp.MustCompile(`<[^>]*>`)
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// StripHTML converts HTML to plain text, keeping line breaks for block elements.
+// Template variables such as {{message}} are left untouched
+func StripHTML(content string) string {
+	text := htmlBreakPattern.ReplaceAllString(content, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = strings.Join(lines, "\n")
+
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(text, "\n\n"))
+}
+
+// DerivePlainTextTemplate builds plain-text template content from an email template
+// ({"subject": ..., "body": ...}), using the subject as the title
+func DerivePlainTextTemplate(emailContent string) (string, error) {
+	emailTemplate, err := ParseEmailContent(emailContent)
+	if err != nil {
+		return "", fmt.Errorf("invalid email template format: %w", err)
+	}
+
+	subject := StripHTML(emailTemplate.Subject)
+	body := StripHTML(emailTemplate.Body)
+	if subject == "" && body == "" {
+		return "", fmt.Errorf("email template has no subject or body")
+	}
+
+	if subject == "" {
+		return body, nil
+	}
+	if body == "" {
+		return subject, nil
+	}
+	return subject + "\n\n" + body, nil
+}
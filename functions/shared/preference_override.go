@@ -0,0 +1,88 @@
+package shared
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+)
+
+// Limits of preference overrides
+const (
+	MaxPreferenceOverrides        = 10
+	MaxPreferenceOverrideDuration = 30 * 24 * time.Hour
+)
+
+// Validate checks a new preference override: known types and channels, at least one of channels and
+// enabled set, and an expiry in the future within MaxPreferenceOverrideDuration. Delivery modes are not
+// overridden, they would need the digest schedule to follow the override
+func (o PreferenceOverride) Validate(now time.Time) error {
+	for _, notificationType := range o.Types {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid notification type: %s", notificationType)
+		}
+	}
+	if o.Preference.Channels == nil && o.Preference.Enabled == nil {
+		return fmt.Errorf("preference must set channels or enabled")
+	}
+	for _, channel := range o.Preference.Channels {
+		if !ValidateChannel(channel) {
+			return fmt.Errorf("invalid channel: %s", channel)
+		}
+	}
+	if o.Preference.Delivery != "" {
+		return fmt.Errorf("delivery cannot be overridden")
+	}
+	if o.ExpiresAt == nil || !o.ExpiresAt.After(now) {
+		return fmt.Errorf("expiresAt must be in the future")
+	}
+	if o.ExpiresAt.Sub(now) > MaxPreferenceOverrideDuration {
+		return fmt.Errorf("expiresAt must be within %d days", int(MaxPreferenceOverrideDuration.Hours()/24))
+	}
+	return nil
+}
+
+// ActiveOverrides returns the overrides that have not expired, in the order they apply
+func (p UserPreferences) ActiveOverrides(now time.Time) []PreferenceOverride {
+	var active []PreferenceOverride
+	for _, override := range p.Overrides {
+		if !override.IsExpired(now) {
+			active = append(active, override)
+		}
+	}
+	return active
+}
+
+// WithOverrides returns the preferences with their active overrides applied in order, a later override
+// winning over an earlier one. Overrides is left with the active overrides only
+func (p UserPreferences) WithOverrides(now time.Time) UserPreferences {
+	active := p.ActiveOverrides(now)
+	p.Overrides = active
+	if len(active) == 0 {
+		return p
+	}
+
+	preferences := maps.Clone(p.Preferences)
+	if preferences == nil {
+		preferences = make(map[string]PreferenceItem)
+	}
+	for _, override := range active {
+		types := override.Types
+		if len(types) == 0 {
+			types = slices.Collect(maps.Keys(preferences))
+		}
+		for _, notificationType := range types {
+			item := preferences[notificationType]
+			if override.Preference.Channels != nil {
+				item.Channels = slices.Clone(override.Preference.Channels)
+			}
+			if override.Preference.Enabled != nil {
+				enabled := *override.Preference.Enabled
+				item.Enabled = &enabled
+			}
+			preferences[notificationType] = item
+		}
+	}
+	p.Preferences = preferences
+	return p
+}
@@ -0,0 +1,73 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limits of the processor tuning knobs
+const (
+	maxRecipientConcurrency   = 50
+	maxChannelParallelism     = 50
+	maxRenderTimeoutSeconds   = 30
+	maxProcessorBatchSize     = 1000
+	defaultProcessorBatchSize = 100
+)
+
+// ProcessorSettings tunes the throughput of the notification processor. Unset knobs fall back to the
+// processor's environment: PROCESSOR_RECIPIENT_CONCURRENCY (1, recipients one at a time), no channel limit,
+// no render timeout besides the channel timeout, and SEGMENT_CHUNK_SIZE (100) recipients per segment chunk
+type ProcessorSettings struct {
+	MaxRecipientConcurrency int            `json:"maxRecipientConcurrency,omitempty" dynamodbav:"maxRecipientConcurrency,omitempty"` // Recipients of a request processed at once
+	ChannelParallelism      map[string]int `json:"channelParallelism,omitempty" dynamodbav:"channelParallelism,omitempty"`           // Channel to its deliveries in flight at once across the recipients of a request
+	RenderTimeoutSeconds    int            `json:"renderTimeoutSeconds,omitempty" dynamodbav:"renderTimeoutSeconds,omitempty"`       // Rendering a template for a channel fails the channel past it
+	BatchSize               int            `json:"batchSize,omitempty" dynamodbav:"batchSize,omitempty"`                             // Recipients per child request a segment is queued in
+}
+
+// IsEmpty reports whether no processor knob is set
+func (s ProcessorSettings) IsEmpty() bool {
+	return s.MaxRecipientConcurrency == 0 && len(s.ChannelParallelism) == 0 && s.RenderTimeoutSeconds == 0 && s.BatchSize == 0
+}
+
+// Validate checks that every knob is within its limits and that channel limits name known channels
+func (s ProcessorSettings) Validate() error {
+	if s.MaxRecipientConcurrency < 0 || s.MaxRecipientConcurrency > maxRecipientConcurrency {
+		return fmt.Errorf("maxRecipientConcurrency must be between 1 and %d", maxRecipientConcurrency)
+	}
+	for channel, parallelism := range s.ChannelParallelism {
+		if !ValidateChannel(channel) {
+			return fmt.Errorf("invalid channel: %s", channel)
+		}
+		if parallelism < 1 || parallelism > maxChannelParallelism {
+			return fmt.Errorf("%s parallelism must be between 1 and %d", channel, maxChannelParallelism)
+		}
+	}
+	if s.RenderTimeoutSeconds < 0 || s.RenderTimeoutSeconds > maxRenderTimeoutSeconds {
+		return fmt.Errorf("renderTimeoutSeconds must be between 1 and %d", maxRenderTimeoutSeconds)
+	}
+	if s.BatchSize < 0 || s.BatchSize > maxProcessorBatchSize {
+		return fmt.Errorf("batchSize must be between 1 and %d", maxProcessorBatchSize)
+	}
+	return nil
+}
+
+// RecipientConcurrency returns how many recipients of a request are processed at once
+func (s ProcessorSettings) RecipientConcurrency() int {
+	if s.MaxRecipientConcurrency > 0 {
+		return s.MaxRecipientConcurrency
+	}
+	return max(GetEnvInt("PROCESSOR_RECIPIENT_CONCURRENCY", 1), 1)
+}
+
+// RenderTimeout returns how long rendering a template may take, 0 when only the channel timeout applies
+func (s ProcessorSettings) RenderTimeout() time.Duration {
+	return time.Duration(s.RenderTimeoutSeconds) * time.Second
+}
+
+// SegmentBatchSize returns how many recipients each child request of a segment carries
+func (s ProcessorSettings) SegmentBatchSize() int {
+	if s.BatchSize > 0 {
+		return s.BatchSize
+	}
+	return max(GetEnvInt("SEGMENT_CHUNK_SIZE", defaultProcessorBatchSize), 1)
+}
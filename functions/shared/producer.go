@@ -0,0 +1,62 @@
+package shared
+
+import (
+	"context"
+
+	"github.com/rs/zerolog"
+)
+
+// Constants for the kinds of producers that queue notification requests
+const (
+	ProducerSchedule       = "schedule"        // A user's schedule, ID is the schedule ID
+	ProducerAPIUser        = "api_user"        // A user acting through the API, e.g. an admin replay, ID is the user ID
+	ProducerServiceAccount = "service_account" // A service sending straight to the queue, ID is its AWS principal
+	ProducerEventBridge    = "eventbridge"     // An EventBridge rule forwarding events, ID is the event source
+	ProducerSNSTopic       = "sns_topic"       // An SNS topic subscription, ID is the topic ARN
+	ProducerSystem         = "system"          // A job of the service itself, ID names the job, e.g. "digest"
+)
+
+// Producer is the identity that queued a notification request. Kind and ID are declared by the service's own
+// producers or derived from the message envelope, Principal is the AWS identity SQS saw sending the message
+type Producer struct {
+	Kind      string `json:"kind" dynamodbav:"kind"`
+	ID        string `json:"id,omitempty" dynamodbav:"id,omitempty"`
+	Principal string `json:"principal,omitempty" dynamodbav:"principal,omitempty"` // SQS SenderId, e.g. "AROAEXAMPLE:session"
+}
+
+// ValidateProducerKind checks that a producer kind is known
+func ValidateProducerKind(kind string) bool {
+	switch kind {
+	case ProducerSchedule, ProducerAPIUser, ProducerServiceAccount, ProducerEventBridge, ProducerSNSTopic, ProducerSystem:
+		return true
+	}
+	return false
+}
+
+// ResolveProducer returns the producer of a queue message: the declared one when its kind is known, otherwise
+// the SNS topic or EventBridge source the message came through, or the sending principal as a service account.
+// The principal is always the one SQS reports, a declared one is not trusted
+func ResolveProducer(declared *Producer, origin MessageOrigin, senderID string) *Producer {
+	var producer Producer
+	switch {
+	case declared != nil && ValidateProducerKind(declared.Kind):
+		producer = Producer{Kind: declared.Kind, ID: declared.ID}
+	case origin.Envelope == EnvelopeSNS:
+		producer = Producer{Kind: ProducerSNSTopic, ID: origin.Source}
+	case origin.Envelope == EnvelopeEventBridge:
+		producer = Producer{Kind: ProducerEventBridge, ID: origin.Source}
+	default:
+		producer = Producer{Kind: ProducerServiceAccount, ID: senderID}
+	}
+	producer.Principal = senderID
+	return &producer
+}
+
+// WithLogProducer returns a context whose logger also stamps the producer of the request being processed
+func WithLogProducer(ctx context.Context, producer *Producer) context.Context {
+	if producer == nil {
+		return ctx
+	}
+	producerLogger := zerolog.Ctx(ctx).With().Str("producerKind", producer.Kind).Str("producerId", producer.ID).Logger()
+	return producerLogger.WithContext(ctx)
+}
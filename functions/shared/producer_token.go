@@ -0,0 +1,76 @@
+package shared
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxProducerIDLength bounds the producer ID a token is issued to
+const maxProducerIDLength = 128
+
+// minProducerSecretLength is the shortest secret producer tokens are signed with
+const minProducerSecretLength = 32
+
+// ErrInvalidProducerToken is returned for tokens that are malformed, expired or not signed with the secret
+var ErrInvalidProducerToken = errors.New("invalid producer token")
+
+// SignProducerToken issues the token a service presents to the gRPC API to send as producerID, in the form
+// "<base64url producer ID>.<expiry in Unix seconds, 0 for none>.<hex HMAC-SHA256 of the first two parts>".
+// Tokens are only checked against the secret, rotating it revokes every token issued with it
+func SignProducerToken(secret, producerID string, expiresAt time.Time) (string, error) {
+	if len(secret) < minProducerSecretLength {
+		return "", fmt.Errorf("producer token secret must be at least %d characters", minProducerSecretLength)
+	}
+	if producerID == "" || len(producerID) > maxProducerIDLength {
+		return "", fmt.Errorf("producer ID must be between 1 and %d characters", maxProducerIDLength)
+	}
+	var expiry int64
+	if !expiresAt.IsZero() {
+		expiry = expiresAt.Unix()
+	}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(producerID)) + "." + strconv.FormatInt(expiry, 10)
+	return payload + "." + signProducerToken(secret, payload), nil
+}
+
+// VerifyProducerToken returns the producer ID a token was issued to, ErrInvalidProducerToken when it was not
+// signed with the secret or expired before now
+func VerifyProducerToken(secret, token string, now time.Time) (string, error) {
+	if len(secret) < minProducerSecretLength {
+		return "", ErrInvalidProducerToken
+	}
+	encodedID, rest, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidProducerToken
+	}
+	expiry, signature, ok := strings.Cut(rest, ".")
+	if !ok {
+		return "", ErrInvalidProducerToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(signProducerToken(secret, encodedID+"."+expiry))) {
+		return "", ErrInvalidProducerToken
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || (expiresAt != 0 && now.Unix() >= expiresAt) {
+		return "", ErrInvalidProducerToken
+	}
+	producerID, err := base64.RawURLEncoding.DecodeString(encodedID)
+	if err != nil || len(producerID) == 0 || len(producerID) > maxProducerIDLength {
+		return "", ErrInvalidProducerToken
+	}
+	return string(producerID), nil
+}
+
+// signProducerToken returns the hex HMAC-SHA256 of a token's payload
+func signProducerToken(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,56 @@
+package shared
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyProducerToken(t *testing.T) {
+	secret := strings.Repeat("s", minProducerSecretLength)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	forever, err := SignProducerToken(secret, "billing.jobs", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expiring, err := SignProducerToken(secret, "billing", now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	encodedID, rest, _ := strings.Cut(expiring, ".")
+	otherID, _, _ := strings.Cut(forever, ".")
+
+	tests := []struct {
+		name   string
+		secret string
+		token  string
+		now    time.Time
+		want   string
+	}{
+		{name: "without expiry", secret: secret, token: forever, now: now.AddDate(10, 0, 0), want: "billing.jobs"},
+		{name: "before its expiry", secret: secret, token: expiring, now: now, want: "billing"},
+		{name: "expired", secret: secret, token: expiring, now: now.Add(time.Hour)},
+		{name: "signed with another secret", secret: strings.Repeat("t", minProducerSecretLength), token: expiring, now: now},
+		{name: "producer ID swapped", secret: secret, token: otherID + "." + rest, now: now},
+		{name: "expiry removed", secret: secret, token: encodedID + ".0." + rest[strings.Index(rest, ".")+1:], now: now},
+		{name: "malformed", secret: secret, token: "billing", now: now},
+		{name: "empty", secret: secret, token: "", now: now},
+		{name: "server without a secret", secret: "", token: expiring, now: now},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyProducerToken(tt.secret, tt.token, tt.now)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidProducerToken) {
+					t.Fatalf("VerifyProducerToken() = %q, %v, want ErrInvalidProducerToken", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("VerifyProducerToken() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package shared
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Constants for push platforms, each backed by an SNS platform application
+const (
+	PushPlatformFCM         = "fcm"
+	PushPlatformAPNS        = "apns"
+	PushPlatformAPNSSandbox = "apns_sandbox"
+)
+
+// MaxDevicesPerUser caps the devices a user can register for push notifications
+const MaxDevicesPerUser = 20
+
+// maxDeviceTokenLength is longer than any FCM or APNs token
+const maxDeviceTokenLength = 4096
+
+// IsEmpty reports whether no push field is set
+func (p PushSettings) IsEmpty() bool {
+	return len(p.PlatformApplicationARNs) == 0 && p.Enabled == nil
+}
+
+// Validate checks that every platform is known and mapped to an SNS platform application ARN
+func (p PushSettings) Validate() error {
+	for platform, arn := range p.PlatformApplicationARNs {
+		if !ValidatePushPlatform(platform) {
+			return fmt.Errorf("invalid push platform: %s", platform)
+		}
+		if !strings.HasPrefix(arn, "arn:aws:sns:") || !strings.Contains(arn, ":app/") {
+			return fmt.Errorf("invalid platform application ARN for %s", platform)
+		}
+	}
+	return nil
+}
+
+// ValidatePushPlatform validates if the push platform is valid
+func ValidatePushPlatform(platform string) bool {
+	return platform == PushPlatformFCM || platform == PushPlatformAPNS || platform == PushPlatformAPNSSandbox
+}
+
+// ValidateDeviceToken checks that a device token is a single word of reasonable length
+func ValidateDeviceToken(token string) error {
+	if token == "" {
+		return fmt.Errorf("device token is required")
+	}
+	if len(token) > maxDeviceTokenLength || strings.ContainsAny(token, " \t\r\n") {
+		return fmt.Errorf("invalid device token")
+	}
+	return nil
+}
+
+// BuildDeviceID derives the stable ID of a device from its token, so a device registered twice keeps one entry
+func BuildDeviceID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
+
+// BuildPushMessage builds the SNS message of a push notification, with the payload each platform expects
+func BuildPushMessage(title, body string) (string, error) {
+	gcm, err := json.Marshal(map[string]any{
+		"notification": map[string]string{"title": title, "body": body},
+	})
+	if err != nil {
+		return "", err
+	}
+	apns, err := json.Marshal(map[string]any{
+		"aps": map[string]any{"alert": map[string]string{"title": title, "body": body}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	message, err := json.Marshal(map[string]string{
+		"default":      body,
+		"GCM":          string(gcm),
+		"APNS":         string(apns),
+		"APNS_SANDBOX": string(apns),
+	})
+	if err != nil {
+		return "", err
+	}
+	return string(message), nil
+}
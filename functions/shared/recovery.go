@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// APIHandlerFunc is the signature of the API Gateway handlers
+type APIHandlerFunc func(ctx context.Context, event events.APIGatewayProxyRequest) (APIResponse, error)
+
+// CatchPanic runs fn and turns a panic into an error. The panic and its stack are logged with the
+// context's correlation IDs and counted in the HandlerPanic metric
+func CatchPanic(ctx context.Context, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			reportPanic(ctx, r)
+		}
+	}()
+	return fn()
+}
+
+func reportPanic(ctx context.Context, r any) {
+	LogError(ctx).Interface("panic", r).Str("stack", string(debug.Stack())).Msg("Recovered from panic")
+	EmitMetric(MetricHandlerPanic, 1, map[string]string{"Handler": HandlerName(ctx)})
+}
+
+// WrapAPIHandler attaches the request-scoped logger, answers a panic with a 500 instead of
+// crashing the Lambda runtime and counts the call in the caller's API usage
+func WrapAPIHandler(name string, handler APIHandlerFunc) APIHandlerFunc {
+	return func(ctx context.Context, event events.APIGatewayProxyRequest) (APIResponse, error) {
+		ctx = WithLogger(ctx, name)
+
+		var response APIResponse
+		var handlerErr error
+		if err := CatchPanic(ctx, func() error {
+			response, handlerErr = handler(ctx, event)
+			return nil
+		}); err != nil {
+			response, handlerErr = CreateErrorResponse(http.StatusInternalServerError, "Internal server error", nil), nil
+		}
+		RecordAPIUsage(ctx, event, response.StatusCode)
+		return response, handlerErr
+	}
+}
+
+// WrapHandler attaches the request-scoped logger to an event-driven handler and returns a panic
+// as an error
+func WrapHandler[E, R any](name string, handler func(context.Context, E) (R, error)) func(context.Context, E) (R, error) {
+	return func(ctx context.Context, event E) (R, error) {
+		ctx = WithLogger(ctx, name)
+
+		var response R
+		err := CatchPanic(ctx, func() error {
+			var handlerErr error
+			response, handlerErr = handler(ctx, event)
+			return handlerErr
+		})
+		return response, err
+	}
+}
+
+// WrapEventHandler is WrapHandler for handlers that return only an error
+func WrapEventHandler[E any](name string, handler func(context.Context, E) error) func(context.Context, E) error {
+	return func(ctx context.Context, event E) error {
+		ctx = WithLogger(ctx, name)
+		return CatchPanic(ctx, func() error {
+			return handler(ctx, event)
+		})
+	}
+}
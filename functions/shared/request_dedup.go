@@ -0,0 +1,25 @@
+package shared
+
+import "time"
+
+// Limits of producer dedup keys
+const (
+	MaxDedupKeyLength         = 256
+	DefaultDedupWindowSeconds = 3600
+	MaxDedupWindowSeconds     = 7 * 24 * 3600
+)
+
+// DedupWindow returns how long the request's dedup key suppresses requests repeating it
+func (r NotificationRequest) DedupWindow() time.Duration {
+	if r.DedupWindowSeconds > 0 {
+		return time.Duration(r.DedupWindowSeconds) * time.Second
+	}
+	return DefaultDedupWindowSeconds * time.Second
+}
+
+// ContentDeduplicated reports whether content the request delivers is suppressed when it repeats content
+// delivered within the dedup window. Test notifications are sent every time, support may repeat one while
+// fixing a channel, dry runs deliver nothing to claim, and bounce redeliveries repeat the bounced email on purpose
+func (r NotificationRequest) ContentDeduplicated() bool {
+	return !r.Test && !r.DryRun && r.BounceRetry == 0
+}
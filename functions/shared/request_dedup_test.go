@@ -0,0 +1,25 @@
+package shared
+
+import "testing"
+
+func TestContentDeduplicated(t *testing.T) {
+	bounced := NotificationRequest{ID: "request-1", Type: "alert", Recipients: []string{"user-1", "user-2"}, DedupKey: "alert-1"}
+	tests := []struct {
+		name    string
+		request NotificationRequest
+		want    bool
+	}{
+		{name: "delivery", request: bounced, want: true},
+		{name: "test notification", request: NotificationRequest{Test: true}},
+		{name: "dry run", request: NotificationRequest{DryRun: true}},
+		{name: "bounce redelivery", request: BounceRetryRequest(bounced, "user-1", 1)},
+		{name: "later bounce redelivery", request: BounceRetryRequest(BounceRetryRequest(bounced, "user-1", 1), "user-1", 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.request.ContentDeduplicated(); got != tt.want {
+				t.Fatalf("ContentDeduplicated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
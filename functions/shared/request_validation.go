@@ -0,0 +1,121 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError is a field of a notification request that failed validation
+type ValidationError struct {
+	Field  string `json:"field" dynamodbav:"field"`
+	Reason string `json:"reason" dynamodbav:"reason"`
+}
+
+func (e ValidationError) Error() string {
+	return e.Reason
+}
+
+// ValidationErrors is every problem found in a notification request
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	reasons := make([]string, len(e))
+	for i, validationError := range e {
+		reasons[i] = validationError.Field + ": " + validationError.Reason
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Validate checks a notification request queued by a producer through the API: its type unless it starts
+// a sequence, recipients or segment, channels, priority and category. Requests written straight to the
+// queue are not validated before the processor reads them, it checks them with ValidateStrict
+func (r NotificationRequest) Validate() error {
+	if errs := r.fieldErrors(); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateStrict checks a request read from the queue before it is processed: everything Validate checks,
+// a non-empty ID, and the variables against the type's schema: declared variables must hold values of their
+// type, and required ones must be set. Digests and built-in templates carry no variables of their own and
+// are not checked for required ones. It returns every problem found, nil when valid
+func (r NotificationRequest) ValidateStrict(schema VariableSchema) ValidationErrors {
+	var errs ValidationErrors
+	if r.ID == "" {
+		errs = append(errs, ValidationError{Field: "id", Reason: "id is required"})
+	}
+	errs = append(errs, r.fieldErrors()...)
+	checkRequired := !r.Digest && !r.Overflow && r.SystemTemplate == "" && r.Sequence == ""
+	for _, variable := range schema.Variables {
+		value, exists := r.Variables[variable.Name]
+		if !exists {
+			if variable.Required && checkRequired {
+				errs = append(errs, ValidationError{
+					Field:  "variables." + variable.Name,
+					Reason: fmt.Sprintf("variable %s is required", variable.Name),
+				})
+			}
+			continue
+		}
+		if !variable.accepts(value) {
+			errs = append(errs, ValidationError{
+				Field:  "variables." + variable.Name,
+				Reason: fmt.Sprintf("variable %s must be %s, got %T", variable.Name, variable.typeName(), value),
+			})
+		}
+	}
+	return errs
+}
+
+// fieldErrors returns the problems Validate reports, in the order it checks them
+func (r NotificationRequest) fieldErrors() ValidationErrors {
+	var errs ValidationErrors
+	// Sequence starts send the types of the sequence's steps
+	if r.Sequence == "" && !ValidateNotificationType(r.Type) {
+		errs = append(errs, ValidationError{Field: "type", Reason: fmt.Sprintf("invalid notification type: %s", r.Type)})
+	}
+	if r.Segment == "" && len(r.Recipients) == 0 {
+		errs = append(errs, ValidationError{Field: "recipients", Reason: "recipients or segment is required"})
+	}
+	for _, recipient := range r.Recipients {
+		if recipient == "" {
+			errs = append(errs, ValidationError{Field: "recipients", Reason: "recipients cannot contain an empty ID"})
+			break
+		}
+	}
+	for _, channel := range r.Channels {
+		if !ValidateChannel(channel) {
+			errs = append(errs, ValidationError{Field: "channels", Reason: fmt.Sprintf("invalid channel: %s", channel)})
+		}
+	}
+	if r.Priority != "" && r.Priority != PriorityCritical && r.Priority != PriorityNormal {
+		errs = append(errs, ValidationError{Field: "priority", Reason: fmt.Sprintf("invalid priority: %s", r.Priority)})
+	}
+	if r.Category != "" && !ValidateCategory(r.Category) {
+		errs = append(errs, ValidationError{Field: "category", Reason: fmt.Sprintf("invalid category: %s", r.Category)})
+	}
+	if len(r.DedupKey) > MaxDedupKeyLength {
+		errs = append(errs, ValidationError{Field: "dedupKey", Reason: fmt.Sprintf("dedupKey must be at most %d characters", MaxDedupKeyLength)})
+	}
+	if len(r.CorrelationKey) > MaxCorrelationKeyLength {
+		errs = append(errs, ValidationError{Field: "correlationKey", Reason: fmt.Sprintf("correlationKey must be at most %d characters", MaxCorrelationKeyLength)})
+	}
+	if r.DedupWindowSeconds != 0 && r.DedupKey == "" {
+		errs = append(errs, ValidationError{Field: "dedupWindowSeconds", Reason: "dedupWindowSeconds requires dedupKey"})
+	} else if r.DedupWindowSeconds < 0 || r.DedupWindowSeconds > MaxDedupWindowSeconds {
+		errs = append(errs, ValidationError{Field: "dedupWindowSeconds", Reason: fmt.Sprintf("dedupWindowSeconds must be between 1 and %d", MaxDedupWindowSeconds)})
+	}
+	return errs
+}
+
+// isScalarVariable reports whether a variable value renders as text in a template. Maps, lists and nulls
+// would render as Go syntax
+func isScalarVariable(value any) bool {
+	switch value.(type) {
+	case string, bool, float64, float32, int, int32, int64, uint, uint32, uint64:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,13 @@
+package shared
+
+// ResourceName prefixes a resource name with the configured RESOURCE_PREFIX so that
+// several stacks can share one account without name collisions
+func ResourceName(name string) string {
+	return ResourcePrefix + name
+}
+
+// ScheduleName returns the EventBridge schedule name for a schedule ID.
+// EventBridge limits names to 64 characters, so keep RESOURCE_PREFIX short
+func ScheduleName(scheduleID string) string {
+	return ResourceName("schedule-" + scheduleID)
+}
@@ -0,0 +1,90 @@
+package shared
+
+import (
+	"fmt"
+	"time"
+)
+
+// Managed tables the retention janitor enforces a policy on
+const (
+	RetentionHistory    = "history"    // Notification history
+	RetentionAudit      = "audit"      // Acknowledgments, the record of who acknowledged what
+	RetentionResults    = "results"    // Notification validation results
+	RetentionQuarantine = "quarantine" // Quarantined queue messages and failed notifications
+)
+
+// Retention limits, history feeds the weekly missed summary and the analytics rollup so it is kept for
+// at least two weeks
+const (
+	maxRetentionDays        = 3650
+	minHistoryRetentionDays = 14
+)
+
+// defaultRetentionDays is how long rows are kept when the global config sets no policy, 0 keeps them forever
+var defaultRetentionDays = map[string]int{
+	RetentionHistory:    30,
+	RetentionAudit:      0,
+	RetentionResults:    1,
+	RetentionQuarantine: 30,
+}
+
+// RetentionSettings is how many days the rows of each managed table are kept. Unset tables keep their
+// default: 30 days of history and quarantined messages, 1 day of validation results and acknowledgments forever
+type RetentionSettings struct {
+	HistoryDays    int `json:"historyDays,omitempty" dynamodbav:"historyDays,omitempty"`
+	AuditDays      int `json:"auditDays,omitempty" dynamodbav:"auditDays,omitempty"`
+	ResultsDays    int `json:"resultsDays,omitempty" dynamodbav:"resultsDays,omitempty"`
+	QuarantineDays int `json:"quarantineDays,omitempty" dynamodbav:"quarantineDays,omitempty"`
+}
+
+// IsEmpty reports whether no retention field is set
+func (r RetentionSettings) IsEmpty() bool {
+	return r.HistoryDays == 0 && r.AuditDays == 0 && r.ResultsDays == 0 && r.QuarantineDays == 0
+}
+
+// Validate checks that every period is between a day and ten years, and that history outlives the jobs reading it
+func (r RetentionSettings) Validate() error {
+	periods := map[string]int{
+		RetentionHistory:    r.HistoryDays,
+		RetentionAudit:      r.AuditDays,
+		RetentionResults:    r.ResultsDays,
+		RetentionQuarantine: r.QuarantineDays,
+	}
+	for table, days := range periods {
+		if days < 0 || days > maxRetentionDays {
+			return fmt.Errorf("%s retention must be between 1 and %d days", table, maxRetentionDays)
+		}
+	}
+	if r.HistoryDays != 0 && r.HistoryDays < minHistoryRetentionDays {
+		return fmt.Errorf("history retention must be at least %d days", minHistoryRetentionDays)
+	}
+	return nil
+}
+
+// Days returns how many days rows of the table are kept, 0 when they are kept forever
+func (r RetentionSettings) Days(table string) int {
+	var days int
+	switch table {
+	case RetentionHistory:
+		days = r.HistoryDays
+	case RetentionAudit:
+		days = r.AuditDays
+	case RetentionResults:
+		days = r.ResultsDays
+	case RetentionQuarantine:
+		days = r.QuarantineDays
+	}
+	if days == 0 {
+		days = defaultRetentionDays[table]
+	}
+	return days
+}
+
+// ExpiresAt returns the TTL of a row of the table created at createdAt, 0 when it is kept forever
+func (r RetentionSettings) ExpiresAt(table string, createdAt time.Time) int {
+	days := r.Days(table)
+	if days == 0 {
+		return 0
+	}
+	return int(createdAt.AddDate(0, 0, days).Unix())
+}
@@ -0,0 +1,259 @@
+package shared
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Constants for rule condition fields. Variables and recipient attributes are named after the prefix,
+// e.g. "variables.environment" or "recipient.region"
+const (
+	RuleFieldType            = "type"
+	RuleFieldVariablePrefix  = "variables."
+	RuleFieldRecipientPrefix = "recipient."
+)
+
+// Constants for rule condition operators
+const (
+	RuleOperatorEquals    = "equals"
+	RuleOperatorNotEquals = "not_equals"
+	RuleOperatorIn        = "in"
+	RuleOperatorContains  = "contains"
+	RuleOperatorExists    = "exists"
+)
+
+// Constants for rule actions
+const (
+	RuleActionAddChannel  = "add_channel"
+	RuleActionSetPriority = "set_priority"
+	RuleActionSetVariable = "set_variable"
+	RuleActionDrop        = "drop"
+)
+
+// PriorityNormal is the priority a set_priority action uses to downgrade a critical request
+const PriorityNormal = "normal"
+
+// Rule limits
+const (
+	maxRuleConditions = 10
+	maxRuleActions    = 10
+	maxRuleValues     = 50
+)
+
+// ruleVariablePattern matches the variable names rules can read and write
+var ruleVariablePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// IsEnabled reports whether the rule is evaluated
+func (r Rule) IsEnabled() bool {
+	return r.Enabled == nil || *r.Enabled
+}
+
+// Validate checks the rule's conditions and actions
+func (r Rule) Validate() error {
+	if len(r.Conditions) > maxRuleConditions {
+		return fmt.Errorf("at most %d conditions are allowed", maxRuleConditions)
+	}
+	for _, condition := range r.Conditions {
+		if err := condition.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(r.Actions) == 0 {
+		return fmt.Errorf("at least one action is required")
+	}
+	if len(r.Actions) > maxRuleActions {
+		return fmt.Errorf("at most %d actions are allowed", maxRuleActions)
+	}
+	for _, action := range r.Actions {
+		if err := action.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the condition's field, operator and values
+func (c RuleCondition) Validate() error {
+	switch {
+	case c.Field == RuleFieldType:
+	case strings.HasPrefix(c.Field, RuleFieldVariablePrefix):
+		if !ruleVariablePattern.MatchString(strings.TrimPrefix(c.Field, RuleFieldVariablePrefix)) {
+			return fmt.Errorf("invalid variable in field: %s", c.Field)
+		}
+	case strings.HasPrefix(c.Field, RuleFieldRecipientPrefix):
+		if !ValidateUserAttributeKey(strings.TrimPrefix(c.Field, RuleFieldRecipientPrefix)) {
+			return fmt.Errorf("invalid attribute in field: %s", c.Field)
+		}
+	default:
+		return fmt.Errorf("invalid field: %s", c.Field)
+	}
+
+	switch c.Operator {
+	case RuleOperatorEquals, RuleOperatorNotEquals, RuleOperatorContains:
+		if c.Value == "" {
+			return fmt.Errorf("operator %s needs a value", c.Operator)
+		}
+	case RuleOperatorIn:
+		if len(c.Values) == 0 || len(c.Values) > maxRuleValues {
+			return fmt.Errorf("operator in needs between 1 and %d values", maxRuleValues)
+		}
+	case RuleOperatorExists:
+	default:
+		return fmt.Errorf("invalid operator: %s", c.Operator)
+	}
+	return nil
+}
+
+// Validate checks that the action has the parameters its type needs
+func (a RuleAction) Validate() error {
+	switch a.Type {
+	case RuleActionAddChannel:
+		if !ValidateChannel(a.Channel) {
+			return fmt.Errorf("invalid channel: %s", a.Channel)
+		}
+	case RuleActionSetPriority:
+		if a.Priority != PriorityCritical && a.Priority != PriorityNormal {
+			return fmt.Errorf("priority must be %s or %s", PriorityCritical, PriorityNormal)
+		}
+	case RuleActionSetVariable:
+		if !ruleVariablePattern.MatchString(a.Variable) {
+			return fmt.Errorf("invalid variable: %s", a.Variable)
+		}
+	case RuleActionDrop:
+	default:
+		return fmt.Errorf("invalid action: %s", a.Type)
+	}
+	return nil
+}
+
+// RuleInput is the notification and recipient the conditions are evaluated against
+type RuleInput struct {
+	Type       string
+	Variables  map[string]any
+	Attributes map[string]string // The recipient's user attributes
+}
+
+// RuleOutcome is what the matching rules did to a notification for one recipient
+type RuleOutcome struct {
+	Matched   []string       // IDs of the rules that matched, in evaluation order
+	Drop      bool           // The notification is not delivered to the recipient
+	Priority  string         // Set when a rule changed the priority
+	Channels  []string       // Channels added to the recipient's preferred ones
+	Variables map[string]any // The variables with the rewrites applied
+}
+
+// Matches reports whether the condition holds for the input. Values are compared as text
+func (c RuleCondition) Matches(input RuleInput) bool {
+	value, ok := c.lookup(input)
+	switch c.Operator {
+	case RuleOperatorExists:
+		return ok
+	case RuleOperatorEquals:
+		return ok && value == c.Value
+	case RuleOperatorNotEquals:
+		return !ok || value != c.Value
+	case RuleOperatorIn:
+		return ok && slices.Contains(c.Values, value)
+	case RuleOperatorContains:
+		return ok && strings.Contains(value, c.Value)
+	default:
+		return false
+	}
+}
+
+// lookup returns the value of the condition's field and whether it is set
+func (c RuleCondition) lookup(input RuleInput) (string, bool) {
+	switch {
+	case c.Field == RuleFieldType:
+		return input.Type, true
+	case strings.HasPrefix(c.Field, RuleFieldVariablePrefix):
+		value, ok := input.Variables[strings.TrimPrefix(c.Field, RuleFieldVariablePrefix)]
+		if !ok || value == nil {
+			return "", false
+		}
+		return fmt.Sprint(value), true
+	case strings.HasPrefix(c.Field, RuleFieldRecipientPrefix):
+		value, ok := input.Attributes[strings.TrimPrefix(c.Field, RuleFieldRecipientPrefix)]
+		return value, ok
+	default:
+		return "", false
+	}
+}
+
+// Matches reports whether every condition of the rule holds for the input
+func (r Rule) Matches(input RuleInput) bool {
+	for _, condition := range r.Conditions {
+		if !condition.Matches(input) {
+			return false
+		}
+	}
+	return true
+}
+
+// NeedsRecipientAttributes reports whether any enabled rule reads the recipient's attributes
+func NeedsRecipientAttributes(rules []Rule) bool {
+	for _, rule := range rules {
+		if !rule.IsEnabled() {
+			continue
+		}
+		for _, condition := range rule.Conditions {
+			if strings.HasPrefix(condition.Field, RuleFieldRecipientPrefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SortRules orders rules for evaluation, by order and then by ID so ties are stable
+func SortRules(rules []Rule) {
+	slices.SortStableFunc(rules, func(a, b Rule) int {
+		if a.Order != b.Order {
+			return a.Order - b.Order
+		}
+		return strings.Compare(a.RuleID, b.RuleID)
+	})
+}
+
+// EvaluateRules runs the enabled, unexpired rules in order against the input. Later rules see the variables
+// rewritten by earlier ones, and a drop stops the evaluation
+func EvaluateRules(rules []Rule, input RuleInput) RuleOutcome {
+	outcome := RuleOutcome{Variables: input.Variables}
+	rewritten := false
+	now := GetCurrentTime()
+	for _, rule := range rules {
+		if !rule.IsEnabled() || rule.IsExpired(now) || !rule.Matches(input) {
+			continue
+		}
+		outcome.Matched = append(outcome.Matched, rule.RuleID)
+
+		for _, action := range rule.Actions {
+			switch action.Type {
+			case RuleActionDrop:
+				outcome.Drop = true
+				return outcome
+			case RuleActionAddChannel:
+				if !slices.Contains(outcome.Channels, action.Channel) {
+					outcome.Channels = append(outcome.Channels, action.Channel)
+				}
+			case RuleActionSetPriority:
+				outcome.Priority = action.Priority
+			case RuleActionSetVariable:
+				// The request's variables are shared by every recipient, they are copied before the first rewrite
+				if !rewritten {
+					outcome.Variables = maps.Clone(outcome.Variables)
+					if outcome.Variables == nil {
+						outcome.Variables = map[string]any{}
+					}
+					rewritten = true
+				}
+				outcome.Variables[action.Variable] = action.Value
+				input.Variables = outcome.Variables
+			}
+		}
+	}
+	return outcome
+}
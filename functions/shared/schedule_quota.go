@@ -0,0 +1,48 @@
+package shared
+
+import "fmt"
+
+// Limits of the schedule quota
+const (
+	maxSchedulesPerUser     = 10000
+	defaultSchedulesPerUser = 200
+)
+
+// ScheduleSettings caps how many schedules each user holds, so a single user cannot exhaust the account's
+// EventBridge schedule quota. Unset, the limit falls back to MAX_SCHEDULES_PER_USER (200)
+type ScheduleSettings struct {
+	MaxPerUser int            `json:"maxPerUser,omitempty" dynamodbav:"maxPerUser,omitempty"` // Active and paused schedules a user may hold, 0 for the default
+	UserLimits map[string]int `json:"userLimits,omitempty" dynamodbav:"userLimits,omitempty"` // User ID to the limit replacing maxPerUser for them
+}
+
+// IsEmpty reports whether no schedule limit is set
+func (s ScheduleSettings) IsEmpty() bool {
+	return s.MaxPerUser == 0 && len(s.UserLimits) == 0
+}
+
+// Validate checks that every limit is within bounds
+func (s ScheduleSettings) Validate() error {
+	if s.MaxPerUser < 0 || s.MaxPerUser > maxSchedulesPerUser {
+		return fmt.Errorf("maxPerUser must be between 0 (the default) and %d", maxSchedulesPerUser)
+	}
+	for userID, limit := range s.UserLimits {
+		if userID == "" {
+			return fmt.Errorf("userLimits keys must be user IDs")
+		}
+		if limit < 1 || limit > maxSchedulesPerUser {
+			return fmt.Errorf("limit of %s must be between 1 and %d", userID, maxSchedulesPerUser)
+		}
+	}
+	return nil
+}
+
+// LimitFor returns how many schedules the user may hold: their own limit, the global one, or the default
+func (s ScheduleSettings) LimitFor(userID string) int {
+	if limit, ok := s.UserLimits[userID]; ok {
+		return limit
+	}
+	if s.MaxPerUser > 0 {
+		return s.MaxPerUser
+	}
+	return max(GetEnvInt("MAX_SCHEDULES_PER_USER", defaultSchedulesPerUser), 1)
+}
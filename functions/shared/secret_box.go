@@ -0,0 +1,250 @@
+package shared
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// EncryptedValuePrefix marks values encrypted with EncryptSecret. Values without it are stored in plain text
+const EncryptedValuePrefix = "enc:v1:"
+
+// secretFetchTimeout bounds the read of the encryption key from Secrets Manager
+const secretFetchTimeout = 5 * time.Second
+
+// secretCipherCache keeps the cipher between invocations, so the key is read from Secrets Manager once per
+// Lambda container. A failed read is not cached and is tried again on the next use
+var (
+	secretCipherMu    sync.Mutex
+	secretCipherCache cipher.AEAD
+)
+
+// secretCipher builds an AES-256-GCM cipher keyed from the secret CONFIG_ENCRYPTION_KEY_SECRET_ARN points at,
+// read at runtime so the key is never part of the function's configuration. CONFIG_ENCRYPTION_KEY holds the
+// key itself for local runs
+func secretCipher() (cipher.AEAD, error) {
+	secretCipherMu.Lock()
+	defer secretCipherMu.Unlock()
+	if secretCipherCache != nil {
+		return secretCipherCache, nil
+	}
+
+	secret, err := configEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	secretCipherCache = gcm
+	return gcm, nil
+}
+
+// configEncryptionKey returns the key config secrets are encrypted with
+func configEncryptionKey() (string, error) {
+	if secret := os.Getenv("CONFIG_ENCRYPTION_KEY"); secret != "" {
+		return secret, nil
+	}
+	secretARN := os.Getenv("CONFIG_ENCRYPTION_KEY_SECRET_ARN")
+	if secretARN == "" || SecretsManagerClient == nil {
+		return "", errors.New("CONFIG_ENCRYPTION_KEY_SECRET_ARN is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretFetchTimeout)
+	defer cancel()
+	out, err := SecretsManagerClient.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read the config encryption key: %w", err)
+	}
+	if out.SecretString == nil || *out.SecretString == "" {
+		return "", errors.New("config encryption key secret is empty")
+	}
+	return *out.SecretString, nil
+}
+
+// EncryptSecret encrypts a value for storage. Empty values are returned unchanged, as are values that are
+// already encrypted with the key. A value that only looks encrypted, such as a user secret starting with the
+// prefix, is encrypted like any other so it reads back as it was written
+func EncryptSecret(value string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	if strings.HasPrefix(value, EncryptedValuePrefix) {
+		if _, err := DecryptSecret(value); err == nil {
+			return value, nil
+		}
+	}
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(value), nil)
+	return EncryptedValuePrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// DecryptSecret reverses EncryptSecret. Values stored before encryption was introduced are returned unchanged
+func DecryptSecret(value string) (string, error) {
+	if !strings.HasPrefix(value, EncryptedValuePrefix) {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncryptedValuePrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	gcm, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plain), nil
+}
+
+// MaskSecret hides all but the last 4 characters of a value
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 4 {
+		return "****"
+	}
+	return "****" + value[len(value)-4:]
+}
+
+// IsMaskedSecret reports whether a value has the format MaskSecret returns
+func IsMaskedSecret(value string) bool {
+	return strings.HasPrefix(value, "****")
+}
+
+// MaskSettings hides the webhook URLs, webhook secrets, email addresses and SendGrid key of the settings,
+// showing only their last 4 characters
+func MaskSettings(settings SystemSettings) SystemSettings {
+	settings.SlackSettings.WebhookURL = MaskSecret(settings.SlackSettings.WebhookURL)
+	settings.SlackSettings.WebhookURLByType = maskValues(settings.SlackSettings.WebhookURLByType)
+	settings.EmailSettings.FromAddress = MaskSecret(settings.EmailSettings.FromAddress)
+	settings.EmailSettings.FromAddressByType = maskValues(settings.EmailSettings.FromAddressByType)
+	settings.EmailSettings.ReplyToAddress = MaskSecret(settings.EmailSettings.ReplyToAddress)
+	settings.EmailSettings.SendGridAPIKey = MaskSecret(settings.EmailSettings.SendGridAPIKey)
+	settings.WebhookSettings.URL = MaskSecret(settings.WebhookSettings.URL)
+	settings.WebhookSettings.Secret = MaskSecret(settings.WebhookSettings.Secret)
+	settings.WebhookSettings.EndpointsByType = maskEndpoints(settings.WebhookSettings.EndpointsByType)
+	settings.TeamsSettings.WebhookURL = MaskSecret(settings.TeamsSettings.WebhookURL)
+	return settings
+}
+
+// maskValues returns a copy of the map with every value masked
+func maskValues(values map[string]string) map[string]string {
+	if values == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(values))
+	for key, value := range values {
+		masked[key] = MaskSecret(value)
+	}
+	return masked
+}
+
+// maskEndpoints returns a copy of the webhook endpoints with their URLs and secrets masked
+func maskEndpoints(endpoints map[string]WebhookEndpointSettings) map[string]WebhookEndpointSettings {
+	if endpoints == nil {
+		return nil
+	}
+	masked := make(map[string]WebhookEndpointSettings, len(endpoints))
+	for notificationType, endpoint := range endpoints {
+		endpoint.URL = MaskSecret(endpoint.URL)
+		endpoint.Secret = MaskSecret(endpoint.Secret)
+		masked[notificationType] = endpoint
+	}
+	return masked
+}
+
+// RestoreMaskedSettings puts back the stored value of every field MaskSettings hides whose submitted value is
+// the mask of the stored one, so settings read with masking can be written back unchanged. A masked value
+// that matches nothing stored is rejected rather than saved
+func RestoreMaskedSettings(submitted *SystemSettings, stored SystemSettings) error {
+	fields := []struct {
+		name      string
+		submitted *string
+		stored    string
+	}{
+		{"slack.webhookUrl", &submitted.SlackSettings.WebhookURL, stored.SlackSettings.WebhookURL},
+		{"email.fromAddress", &submitted.EmailSettings.FromAddress, stored.EmailSettings.FromAddress},
+		{"email.replyToAddress", &submitted.EmailSettings.ReplyToAddress, stored.EmailSettings.ReplyToAddress},
+		{"email.sendGridApiKey", &submitted.EmailSettings.SendGridAPIKey, stored.EmailSettings.SendGridAPIKey},
+		{"webhook.url", &submitted.WebhookSettings.URL, stored.WebhookSettings.URL},
+		{"webhook.secret", &submitted.WebhookSettings.Secret, stored.WebhookSettings.Secret},
+		{"teams.webhookUrl", &submitted.TeamsSettings.WebhookURL, stored.TeamsSettings.WebhookURL},
+	}
+	for _, field := range fields {
+		if err := restoreMaskedValue(field.name, field.submitted, field.stored); err != nil {
+			return err
+		}
+	}
+	for notificationType, endpoint := range submitted.WebhookSettings.EndpointsByType {
+		name := "webhook.endpointsByType." + notificationType
+		storedEndpoint := stored.WebhookSettings.EndpointsByType[notificationType]
+		if err := restoreMaskedValue(name+".url", &endpoint.URL, storedEndpoint.URL); err != nil {
+			return err
+		}
+		if err := restoreMaskedValue(name+".secret", &endpoint.Secret, storedEndpoint.Secret); err != nil {
+			return err
+		}
+		submitted.WebhookSettings.EndpointsByType[notificationType] = endpoint
+	}
+	if err := restoreMaskedValues("slack.webhookUrlByType", submitted.SlackSettings.WebhookURLByType, stored.SlackSettings.WebhookURLByType); err != nil {
+		return err
+	}
+	return restoreMaskedValues("email.fromAddressByType", submitted.EmailSettings.FromAddressByType, stored.EmailSettings.FromAddressByType)
+}
+
+// restoreMaskedValue replaces a submitted mask of the stored value with the stored value
+func restoreMaskedValue(name string, submitted *string, stored string) error {
+	if !IsMaskedSecret(*submitted) {
+		return nil
+	}
+	if stored == "" || *submitted != MaskSecret(stored) {
+		return fmt.Errorf("%s is a masked value that does not match the stored one, send the full value or leave it out", name)
+	}
+	*submitted = stored
+	return nil
+}
+
+// restoreMaskedValues applies restoreMaskedValue to every value of the map, in place
+func restoreMaskedValues(name string, submitted, stored map[string]string) error {
+	for key, value := range submitted {
+		if err := restoreMaskedValue(name+"."+key, &value, stored[key]); err != nil {
+			return err
+		}
+		submitted[key] = value
+	}
+	return nil
+}
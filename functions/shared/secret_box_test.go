@@ -0,0 +1,91 @@
+package shared
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEncryptSecretValidatesPrefix(t *testing.T) {
+	t.Setenv("CONFIG_ENCRYPTION_KEY", "test-key")
+	secretCipherCache = nil
+	t.Cleanup(func() { secretCipherCache = nil })
+
+	encrypted, err := EncryptSecret("https://example.com/hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values already encrypted with the key are stored as they are
+	if again, err := EncryptSecret(encrypted); err != nil || again != encrypted {
+		t.Fatalf("EncryptSecret(encrypted) = %q, %v, want it unchanged", again, err)
+	}
+
+	// A user value that only has the prefix is encrypted and reads back as it was written
+	for _, value := range []string{EncryptedValuePrefix + "my-secret", EncryptedValuePrefix + "aGVsbG8gd29ybGQgaGVsbG8gd29ybGQ="} {
+		stored, err := EncryptSecret(value)
+		if err != nil || stored == value {
+			t.Fatalf("EncryptSecret(%q) = %q, %v, want it encrypted", value, stored, err)
+		}
+		if decrypted, err := DecryptSecret(stored); err != nil || decrypted != value {
+			t.Fatalf("DecryptSecret(EncryptSecret(%q)) = %q, %v", value, decrypted, err)
+		}
+	}
+}
+
+func TestRestoreMaskedSettingsRoundTrip(t *testing.T) {
+	stored := SystemSettings{
+		SlackSettings: SlackSettings{
+			WebhookURL:       "https://hooks.slack.com/services/T000/B000/abcd",
+			WebhookURLByType: map[string]string{"alert": "https://hooks.slack.com/services/T000/B001/efgh"},
+		},
+		EmailSettings: EmailSettings{
+			Provider:          "sendgrid",
+			FromAddress:       "noreply@example.com",
+			FromAddressByType: map[string]string{"alert": "alerts@example.com"},
+			ReplyToAddress:    "support@example.com",
+			SendGridAPIKey:    "SG.key",
+		},
+		WebhookSettings: WebhookSettings{
+			URL:    "https://example.com/hooks",
+			Secret: "0123456789abcdef0123456789abcdef",
+			EndpointsByType: map[string]WebhookEndpointSettings{
+				"alert": {URL: "https://example.com/alerts", Secret: "abcdef0123456789abcdef0123456789", ExpectedStatuses: []int{202}},
+			},
+		},
+		TeamsSettings: TeamsSettings{WebhookURL: "https://example.webhook.office.com/webhookb2/1234"},
+	}
+
+	// The settings a GET returns, written back as they are
+	submitted := MaskSettings(stored)
+	if err := RestoreMaskedSettings(&submitted, stored); err != nil {
+		t.Fatalf("RestoreMaskedSettings() error = %v", err)
+	}
+	if !reflect.DeepEqual(submitted, stored) {
+		t.Fatalf("RestoreMaskedSettings() = %+v, want %+v", submitted, stored)
+	}
+
+	// New values replace the stored ones
+	submitted = MaskSettings(stored)
+	submitted.WebhookSettings.Secret = "fedcba9876543210fedcba9876543210"
+	if err := RestoreMaskedSettings(&submitted, stored); err != nil || submitted.WebhookSettings.Secret != "fedcba9876543210fedcba9876543210" {
+		t.Fatalf("RestoreMaskedSettings() secret = %q, %v, want the new secret", submitted.WebhookSettings.Secret, err)
+	}
+}
+
+func TestRestoreMaskedSettingsRejectsUnknownMasks(t *testing.T) {
+	stored := SystemSettings{WebhookSettings: WebhookSettings{URL: "https://example.com/hooks"}}
+	tests := []struct {
+		name      string
+		submitted SystemSettings
+	}{
+		{name: "mask of another value", submitted: SystemSettings{WebhookSettings: WebhookSettings{URL: "****wxyz"}}},
+		{name: "mask of nothing stored", submitted: SystemSettings{TeamsSettings: TeamsSettings{WebhookURL: "****1234"}}},
+		{name: "mask in a map", submitted: SystemSettings{SlackSettings: SlackSettings{WebhookURLByType: map[string]string{"alert": "****efgh"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := RestoreMaskedSettings(&tt.submitted, stored); err == nil {
+				t.Fatalf("RestoreMaskedSettings() accepted %+v", tt.submitted)
+			}
+		})
+	}
+}
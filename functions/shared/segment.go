@@ -0,0 +1,73 @@
+package shared
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// IsEmpty reports whether no criterion is set. An empty segment would target every user
+func (c SegmentCriteria) IsEmpty() bool {
+	return len(c.Roles) == 0 && len(c.Orgs) == 0 && len(c.EnabledTypes) == 0 && len(c.Attributes) == 0
+}
+
+// Validate checks the roles and notification types used by the criteria
+func (c SegmentCriteria) Validate() error {
+	if c.IsEmpty() {
+		return fmt.Errorf("at least one criterion is required")
+	}
+	for _, role := range c.Roles {
+		if role != RoleSuperAdmin && role != RoleUser {
+			return fmt.Errorf("invalid role: %s", role)
+		}
+	}
+	for _, notificationType := range c.EnabledTypes {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid notification type: %s", notificationType)
+		}
+	}
+	for key, values := range c.Attributes {
+		if !ValidateUserAttributeKey(key) {
+			return fmt.Errorf("invalid attribute key: %s", key)
+		}
+		if len(values) == 0 {
+			return fmt.Errorf("attribute %s needs at least one value", key)
+		}
+	}
+	return nil
+}
+
+// MatchesUser reports whether the user satisfies the role, organisation and attribute criteria.
+// Preference criteria are checked separately against the user's effective preferences
+func (c SegmentCriteria) MatchesUser(user User) bool {
+	if user.IsActive != nil && !*user.IsActive {
+		return false
+	}
+	if len(c.Roles) > 0 && !slices.Contains(c.Roles, user.Role) {
+		return false
+	}
+	if len(c.Orgs) > 0 {
+		_, domain, found := strings.Cut(user.Email, "@")
+		if !found || !slices.ContainsFunc(c.Orgs, func(org string) bool { return strings.EqualFold(org, domain) }) {
+			return false
+		}
+	}
+	for key, values := range c.Attributes {
+		value, ok := user.Attributes[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesPreferences reports whether the preferences enable every type the criteria require
+func (c SegmentCriteria) MatchesPreferences(preferences UserPreferences) bool {
+	for _, notificationType := range c.EnabledTypes {
+		item, ok := preferences.Preferences[notificationType]
+		if !ok || item.Enabled == nil || !*item.Enabled {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,56 @@
+package shared
+
+import (
+	"fmt"
+	"net/mail"
+)
+
+// IsEmpty reports whether no email field is set
+func (e EmailSettings) IsEmpty() bool {
+	return e.FromAddress == "" && len(e.FromAddressByType) == 0 && e.ReplyToAddress == "" && e.Provider == "" &&
+		e.SendGridAPIKey == "" && e.Enabled == nil
+}
+
+// IsEmpty reports whether no Slack field is set
+func (s SlackSettings) IsEmpty() bool {
+	return s.WebhookURL == "" && len(s.WebhookURLByType) == 0 && s.Enabled == nil
+}
+
+// FromAddressFor returns the from address of a notification type, the default one when the type has none
+func (e EmailSettings) FromAddressFor(notificationType string) string {
+	if address := e.FromAddressByType[notificationType]; address != "" {
+		return address
+	}
+	return e.FromAddress
+}
+
+// WebhookURLFor returns the webhook of a notification type, the default one when the type has none
+func (s SlackSettings) WebhookURLFor(notificationType string) string {
+	if webhookURL := s.WebhookURLByType[notificationType]; webhookURL != "" {
+		return webhookURL
+	}
+	return s.WebhookURL
+}
+
+// ValidateSenderOverrides checks that overrides are set for known notification types, with plain email
+// addresses and Slack incoming webhooks
+func ValidateSenderOverrides(settings SystemSettings) error {
+	for notificationType, address := range settings.EmailSettings.FromAddressByType {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid notification type for from address: %s", notificationType)
+		}
+		parsed, err := mail.ParseAddress(address)
+		if err != nil || parsed.Address != address {
+			return fmt.Errorf("from address for %s must be a plain email address", notificationType)
+		}
+	}
+	for notificationType, webhookURL := range settings.SlackSettings.WebhookURLByType {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid notification type for Slack webhook: %s", notificationType)
+		}
+		if err := ValidateSlackWebhookURL(webhookURL); err != nil {
+			return fmt.Errorf("Slack webhook for %s: %w", notificationType, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package shared
+
+import (
+	"fmt"
+	"maps"
+	"time"
+)
+
+// Statuses of a sequence enrollment
+const (
+	SequenceEnrollmentActive    = "active"
+	SequenceEnrollmentCompleted = "completed"
+	SequenceEnrollmentCancelled = "cancelled"
+)
+
+// Outcomes of a sequence step
+const (
+	SequenceStepSent    = "sent"
+	SequenceStepSkipped = "skipped"
+)
+
+// Limits of a sequence definition
+const (
+	MaxSequenceSteps        = 20
+	MaxSequenceDelayMinutes = 90 * 24 * 60
+)
+
+// SequenceStepSchedulePrefix prefixes the one-time schedules that send the delayed steps of sequences
+const SequenceStepSchedulePrefix = "sequence-"
+
+// Validate checks the steps of a sequence: at least one and at most MaxSequenceSteps, each with a known
+// type, valid channels and a delay of up to 90 days
+func (s Sequence) Validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	if len(s.Steps) > MaxSequenceSteps {
+		return fmt.Errorf("a sequence can have at most %d steps", MaxSequenceSteps)
+	}
+	for i, step := range s.Steps {
+		if !ValidateNotificationType(step.Type) {
+			return fmt.Errorf("step %d: invalid notification type: %s", i, step.Type)
+		}
+		if step.DelayMinutes < 0 || step.DelayMinutes > MaxSequenceDelayMinutes {
+			return fmt.Errorf("step %d: delayMinutes must be between 0 and %d", i, MaxSequenceDelayMinutes)
+		}
+		for _, channel := range step.Channels {
+			if !ValidateChannel(channel) {
+				return fmt.Errorf("step %d: invalid channel: %s", i, channel)
+			}
+		}
+	}
+	return nil
+}
+
+// StepDueAt returns when a step is due if the previous one, or the start for the first step, happened at from
+func (s Sequence) StepDueAt(step int, from time.Time) time.Time {
+	return from.Add(time.Duration(s.Steps[step].DelayMinutes) * time.Minute)
+}
+
+// IsPendingStep reports whether the enrollment is active and waiting for the step of the same run
+func (e SequenceEnrollment) IsPendingStep(ref SequenceStepRef) bool {
+	return e.Status == SequenceEnrollmentActive && e.RunID == ref.RunID && e.CurrentStep == ref.Step
+}
+
+// SequenceStepScheduleID returns the ID of the one-time schedule sending a step of an enrollment run
+func SequenceStepScheduleID(runID string, step int) string {
+	return fmt.Sprintf("%s%s-%d", SequenceStepSchedulePrefix, runID, step)
+}
+
+// SequenceStepRequest builds the notification request of the enrollment's current step. Its ID is derived
+// from the run and step, so a step queued twice is the same request
+func SequenceStepRequest(sequence Sequence, enrollment SequenceEnrollment) NotificationRequest {
+	step := sequence.Steps[enrollment.CurrentStep]
+	variables := make(map[string]any, len(enrollment.Variables)+len(step.Variables))
+	maps.Copy(variables, enrollment.Variables)
+	maps.Copy(variables, step.Variables)
+
+	return NotificationRequest{
+		ID:         SequenceStepScheduleID(enrollment.RunID, enrollment.CurrentStep),
+		Type:       step.Type,
+		Recipients: []string{enrollment.UserID},
+		Variables:  variables,
+		Channels:   step.Channels,
+		SequenceStep: &SequenceStepRef{
+			SequenceID: sequence.SequenceID,
+			RunID:      enrollment.RunID,
+			Step:       enrollment.CurrentStep,
+		},
+		Producer: &Producer{Kind: ProducerSystem, ID: "sequence"},
+	}
+}
@@ -0,0 +1,118 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bounds for the wait before retrying a rate limited Slack post
+const (
+	defaultSlackRetryAfter = time.Second
+	maxSlackRetryAfter     = 10 * time.Second
+)
+
+// SlackRateLimitError is returned when Slack rejects a post with 429, RetryAfter is the wait Slack asked for
+type SlackRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SlackRateLimitError) Error() string {
+	return fmt.Sprintf("slack rate limited the webhook, retry after %s", e.RetryAfter)
+}
+
+// slackWebhookHosts are the hosts Slack issues incoming webhook URLs on
+var slackWebhookHosts = []string{"hooks.slack.com", "hooks.slack-gov.com"}
+
+// ValidateSlackWebhookURL checks that the URL is an https Slack incoming webhook
+func ValidateSlackWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL")
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https")
+	}
+	if !slices.Contains(slackWebhookHosts, parsed.Hostname()) {
+		return fmt.Errorf("webhook URL must be on %s", strings.Join(slackWebhookHosts, " or "))
+	}
+	if !strings.HasPrefix(parsed.Path, "/services/") && !strings.HasPrefix(parsed.Path, "/workflows/") {
+		return fmt.Errorf("webhook URL must be a Slack incoming webhook")
+	}
+	return nil
+}
+
+// PostSlackMessage posts a plain text message to a Slack incoming webhook
+func PostSlackMessage(ctx context.Context, webhookURL, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := GetHTTPClient(HTTPProviderSlack).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &SlackRateLimitError{RetryAfter: parseSlackRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	if resp.StatusCode != http.StatusOK {
+		// Slack explains failures in a short plain text body, e.g. "invalid_token"
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		err := fmt.Errorf("slack returned %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+		if resp.StatusCode < http.StatusInternalServerError {
+			// A revoked or deleted webhook is the recipient's problem, not an outage of Slack
+			return &RejectedError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// PostSlackMessageWithRetry posts a message, retrying rate limited posts after the wait Slack asks for.
+// Posts are retried up to SLACK_MAX_RETRIES times (default 3) and never past the context's deadline
+func PostSlackMessageWithRetry(ctx context.Context, webhookURL, text string) error {
+	maxRetries := GetEnvInt("SLACK_MAX_RETRIES", 3)
+	for attempt := 0; ; attempt++ {
+		err := PostSlackMessage(ctx, webhookURL, text)
+		var rateLimited *SlackRateLimitError
+		if !errors.As(err, &rateLimited) || attempt >= maxRetries {
+			return err
+		}
+
+		LogWarn(ctx).Int("attempt", attempt+1).Dur("retryAfter", rateLimited.RetryAfter).Msg("Slack rate limited the webhook, retrying")
+		timer := time.NewTimer(rateLimited.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// parseSlackRetryAfter reads the Retry-After header (in seconds), capping how long a post is held back
+func parseSlackRetryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || seconds <= 0 {
+		return defaultSlackRetryAfter
+	}
+	return min(time.Duration(seconds)*time.Second, maxSlackRetryAfter)
+}
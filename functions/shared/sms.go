@@ -0,0 +1,87 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf16"
+)
+
+// MaxSMSLength is the longest SMS SNS delivers, in bytes. Longer messages are split into parts by the
+// carrier, each one billed
+const MaxSMSLength = 1600
+
+// Constants for SMS encodings. Messages of GSM 03.38 characters only are sent as GSM-7, anything else as UCS-2
+const (
+	SMSEncodingGSM7 = "GSM-7"
+	SMSEncodingUCS2 = "UCS-2"
+)
+
+// GSM 03.38 characters. Characters of the extension table take two septets
+const (
+	gsm7Basic     = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+	gsm7Extension = "^{}\\[~]|€\f"
+)
+
+var (
+	// smsSenderIDPattern matches an alphanumeric sender ID of up to 11 letters and digits
+	smsSenderIDPattern = regexp.MustCompile(`^[A-Za-z0-9]{1,11}$`)
+	// letterPattern matches a letter, sender IDs made of digits only are rejected by carriers
+	letterPattern = regexp.MustCompile(`[A-Za-z]`)
+)
+
+// IsEmpty reports whether no SMS field is set
+func (s SmsSettings) IsEmpty() bool {
+	return s.SenderID == "" && s.Enabled == nil
+}
+
+// Validate checks that the sender ID is one SNS accepts
+func (s SmsSettings) Validate() error {
+	if s.SenderID == "" {
+		return nil
+	}
+	if !smsSenderIDPattern.MatchString(s.SenderID) || !letterPattern.MatchString(s.SenderID) {
+		return fmt.Errorf("sender ID must be 1-11 letters and digits with at least one letter")
+	}
+	return nil
+}
+
+// ValidatePhoneNumber checks that a phone number is in E.164 format, e.g. +14155550123
+func ValidatePhoneNumber(phoneNumber string) error {
+	if !e164Pattern.MatchString(phoneNumber) {
+		return fmt.Errorf("phone number must be in E.164 format, e.g. +14155550123")
+	}
+	return nil
+}
+
+// CheckSMSLength fails SMS content longer than MaxSMSLength
+func CheckSMSLength(content string) error {
+	if len(content) > MaxSMSLength {
+		return fmt.Errorf("SMS is %d bytes, over the %d byte limit", len(content), MaxSMSLength)
+	}
+	return nil
+}
+
+// SMSSegments returns how many parts an SMS is sent in, each billed, and its encoding. A GSM-7 message holds
+// 160 characters, 153 per part once split; a UCS-2 one 70, 67 per part
+func SMSSegments(text string) (int, string) {
+	septets := 0
+	for _, r := range text {
+		switch {
+		case strings.ContainsRune(gsm7Basic, r):
+			septets++
+		case strings.ContainsRune(gsm7Extension, r):
+			septets += 2
+		default:
+			return segmentCount(len(utf16.Encode([]rune(text))), 70, 67), SMSEncodingUCS2
+		}
+	}
+	return segmentCount(septets, 160, 153), SMSEncodingGSM7
+}
+
+func segmentCount(length, single, perPart int) int {
+	if length <= single {
+		return 1
+	}
+	return (length + perPart - 1) / perPart
+}
@@ -0,0 +1,18 @@
+package shared
+
+// Built-in email templates for notifications the service sends on its own behalf
+const (
+	SystemTemplateMissedSummary  = "missed_summary"
+	SystemTemplateExpiryReminder = "expiry_reminder"
+)
+
+// SystemTemplates holds the email content of each built-in template
+var SystemTemplates = map[string]string{
+	SystemTemplateMissedSummary:  `{"subject": "What you missed: {{count}} unread notifications", "body": "You have {{count}} notifications you have not read yet:\n\n{{message}}\n\nTo stop these summaries, set missedSummary to false in your notification preferences."}`,
+	SystemTemplateExpiryReminder: `{"subject": "Your {{kind}} {{name}} expires on {{expiresAt}}", "body": "Your {{kind}} {{name}} expires on {{expiresAt}} UTC, in {{days}} days.\n\n{{consequence}}"}`,
+}
+
+// IsMissedSummaryEnabled reports whether the user receives the weekly summary of unread notifications
+func (p UserPreferences) IsMissedSummaryEnabled() bool {
+	return p.MissedSummary == nil || *p.MissedSummary
+}
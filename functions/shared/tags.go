@@ -0,0 +1,50 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Limits of the tags a resource carries
+const (
+	MaxTags      = 20
+	MaxTagLength = 64
+)
+
+// TagMetricPrefix marks the analytics dimension of a tag, e.g. delivery_sla#email#tag:team:payments
+const TagMetricPrefix = "tag:"
+
+// tagPattern allows tags such as team:payments or env:prod. Commas separate the tags of a filter and '#'
+// the parts of metric keys, so neither can be part of a tag
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.:/=+@-]*$`)
+
+// NormalizeTags lowercases and trims tags, drops repeated ones and checks they are valid. The order is kept
+func NormalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		}
+		if !tagPattern.MatchString(tag) {
+			return nil, fmt.Errorf("invalid tag %q: use lowercase letters, digits and _ . : / = + @ -", tag)
+		}
+		if !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > MaxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", MaxTags)
+	}
+	return normalized, nil
+}
+
+// ParseTagFilter parses the comma separated tags of a tag query parameter, nil when it is empty
+func ParseTagFilter(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	return NormalizeTags(strings.Split(value, ","))
+}
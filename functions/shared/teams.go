@@ -0,0 +1,156 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// teamsWebhookHostSuffixes are the domains Microsoft issues Teams incoming webhook and workflow URLs on
+var teamsWebhookHostSuffixes = []string{".webhook.office.com", ".logic.azure.com", ".api.powerplatform.com"}
+
+// TeamsRateLimitError is returned when Teams rejects a post with 429, RetryAfter is the wait Teams asked for
+type TeamsRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TeamsRateLimitError) Error() string {
+	return fmt.Sprintf("teams rate limited the webhook, retry after %s", e.RetryAfter)
+}
+
+// TeamsMessage is the rendered content of a Teams template, turned into an Adaptive Card when posted
+type TeamsMessage struct {
+	Title string `json:"title,omitempty"`
+	Text  string `json:"text"`
+}
+
+// ParseTeamsMessage reads rendered Teams content, content that is not a message is the text
+func ParseTeamsMessage(content string) TeamsMessage {
+	var message TeamsMessage
+	if err := json.Unmarshal([]byte(content), &message); err != nil {
+		return TeamsMessage{Text: content}
+	}
+	return message
+}
+
+// IsEmpty reports whether no Teams field is set
+func (t TeamsSettings) IsEmpty() bool {
+	return t.WebhookURL == "" && t.Enabled == nil
+}
+
+// Validate checks the webhook URL when it is set
+func (t TeamsSettings) Validate() error {
+	if t.WebhookURL != "" {
+		return ValidateTeamsWebhookURL(t.WebhookURL)
+	}
+	return nil
+}
+
+// ValidateTeamsWebhookURL checks that the URL is an https Teams incoming webhook or workflow URL
+func ValidateTeamsWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL")
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https")
+	}
+	host := parsed.Hostname()
+	if !slices.ContainsFunc(teamsWebhookHostSuffixes, func(suffix string) bool { return strings.HasSuffix(host, suffix) }) {
+		return fmt.Errorf("webhook URL must be a Teams incoming webhook or workflow")
+	}
+	return nil
+}
+
+// BuildTeamsCard wraps a message in the Adaptive Card payload Teams webhooks accept: the title as a bold
+// heading and the text below it. Text keeps the Markdown subset Adaptive Cards render
+func BuildTeamsCard(message TeamsMessage) ([]byte, error) {
+	body := make([]map[string]any, 0, 2)
+	if message.Title != "" {
+		body = append(body, map[string]any{
+			"type":   "TextBlock",
+			"text":   message.Title,
+			"weight": "Bolder",
+			"size":   "Medium",
+			"wrap":   true,
+		})
+	}
+	body = append(body, map[string]any{
+		"type": "TextBlock",
+		"text": message.Text,
+		"wrap": true,
+	})
+
+	return json.Marshal(map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"body":    body,
+			},
+		}},
+	})
+}
+
+// PostTeamsMessage posts an Adaptive Card payload to a Teams webhook
+func PostTeamsMessage(ctx context.Context, webhookURL string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := GetHTTPClient(HTTPProviderTeams).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return &TeamsRateLimitError{RetryAfter: parseSlackRetryAfter(resp.Header.Get("Retry-After"))}
+	}
+	// Incoming webhooks answer 200, workflows 202
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		reason, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		err := fmt.Errorf("teams returned %d: %s", resp.StatusCode, strings.TrimSpace(string(reason)))
+		if resp.StatusCode < http.StatusInternalServerError {
+			// A removed webhook or workflow fails its recipient without counting as an outage of Teams
+			return &RejectedError{Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// PostTeamsMessageWithRetry posts a payload, retrying rate limited posts after the wait Teams asks for.
+// Posts are retried up to TEAMS_MAX_RETRIES times (default 3) and never past the context's deadline
+func PostTeamsMessageWithRetry(ctx context.Context, webhookURL string, payload []byte) error {
+	maxRetries := GetEnvInt("TEAMS_MAX_RETRIES", 3)
+	for attempt := 0; ; attempt++ {
+		err := PostTeamsMessage(ctx, webhookURL, payload)
+		var rateLimited *TeamsRateLimitError
+		if !errors.As(err, &rateLimited) || attempt >= maxRetries {
+			return err
+		}
+
+		LogWarn(ctx).Int("attempt", attempt+1).Dur("retryAfter", rateLimited.RetryAfter).Msg("Teams rate limited the webhook, retrying")
+		timer := time.NewTimer(rateLimited.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TemplateEngineVersion identifies the compiled template format. Bump it whenever the parser or the
+// format changes: stored templates compiled by another version are recompiled when they are loaded
+const TemplateEngineVersion = 4
+
+// TemplateVariablePattern matches a {{variableName}} placeholder
+var TemplateVariablePattern = regexp.MustCompile(`\{\{([^}]+)\}\}`)
+
+// TemplatePart is literal text, a variable placeholder or, for text using template syntax, the
+// text/template source of a compiled template
+type TemplatePart struct {
+	Text     string `json:"text,omitempty" dynamodbav:"t,omitempty"`
+	Variable string `json:"variable,omitempty" dynamodbav:"v,omitempty"`
+	Template string `json:"template,omitempty" dynamodbav:"s,omitempty"`
+}
+
+// CompiledTemplate is the parsed form of a template's content, stored alongside the source so the
+// processor does not parse it on every render
+type CompiledTemplate struct {
+	EngineVersion int            `json:"engineVersion" dynamodbav:"engineVersion"`
+	Subject       []TemplatePart `json:"subject,omitempty" dynamodbav:"subject,omitempty"` // Email subject, Teams card title
+	Body          []TemplatePart `json:"body" dynamodbav:"body"`
+	HTMLBody      []TemplatePart `json:"htmlBody,omitempty" dynamodbav:"htmlBody,omitempty"` // Email HTML alternative of the plain-text body
+
+	Preheader []TemplatePart            `json:"preheader,omitempty" dynamodbav:"preheader,omitempty"` // Email preview text
+	Headers   map[string][]TemplatePart `json:"headers,omitempty" dynamodbav:"headers,omitempty"`     // Email custom headers
+}
+
+// IsCurrent reports whether the template was compiled by the running engine version
+func (c *CompiledTemplate) IsCurrent() bool {
+	return c != nil && c.EngineVersion == TemplateEngineVersion
+}
+
+// CompileTemplate parses template content for a channel. Email content is a JSON object with a
+// subject and a body, and optionally an htmlBody that makes the body its plain-text alternative, a
+// preheader and custom headers whose values are rendered like the rest, Teams
+// content either a JSON object with a title and a text or plain text, the other channels are plain text
+func CompileTemplate(channel, content string) (*CompiledTemplate, error) {
+	if content == "" {
+		return nil, fmt.Errorf("template content is empty")
+	}
+
+	compiled := &CompiledTemplate{EngineVersion: TemplateEngineVersion}
+	if channel == ChannelTeams {
+		return compileTeamsTemplate(compiled, content)
+	}
+	if channel != ChannelEmail {
+		body, err := compileTemplateParts(content)
+		if err != nil {
+			return nil, err
+		}
+		compiled.Body = body
+		// The text alone must fit in an SMS, variables are checked once rendered. Templates that cannot
+		// render without variables are only checked then
+		if channel == ChannelSMS {
+			if text, err := RenderTemplateParts(compiled.Body, nil, nil); err == nil {
+				if err := CheckSMSLength(text); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return compiled, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		return nil, fmt.Errorf("invalid email template format: %w", err)
+	}
+	_, hasSubject := fields["subject"]
+	_, hasBody := fields["body"]
+	if !hasSubject || !hasBody {
+		return nil, fmt.Errorf("email template must have both subject and body")
+	}
+	emailTemplate, err := ParseEmailContent(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email template format: %w", err)
+	}
+
+	if compiled.Subject, err = compileTemplateParts(emailTemplate.Subject); err != nil {
+		return nil, fmt.Errorf("invalid email subject: %w", err)
+	}
+	if compiled.Body, err = compileTemplateParts(emailTemplate.Body); err != nil {
+		return nil, fmt.Errorf("invalid email body: %w", err)
+	}
+	if _, ok := fields["htmlBody"]; ok {
+		if emailTemplate.HTMLBody == "" {
+			return nil, fmt.Errorf("email template htmlBody cannot be empty")
+		}
+		if compiled.HTMLBody, err = compileTemplateParts(emailTemplate.HTMLBody); err != nil {
+			return nil, fmt.Errorf("invalid email htmlBody: %w", err)
+		}
+	}
+	if emailTemplate.Preheader != "" {
+		if compiled.Preheader, err = compileTemplateParts(emailTemplate.Preheader); err != nil {
+			return nil, fmt.Errorf("invalid email preheader: %w", err)
+		}
+	}
+	if err := ValidateEmailHeaders(emailTemplate.Headers); err != nil {
+		return nil, err
+	}
+	for name, value := range emailTemplate.Headers {
+		parts, err := compileTemplateParts(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid email header %s: %w", name, err)
+		}
+		if compiled.Headers == nil {
+			compiled.Headers = make(map[string][]TemplatePart, len(emailTemplate.Headers))
+		}
+		compiled.Headers[name] = parts
+	}
+	return compiled, nil
+}
+
+// compileTeamsTemplate compiles a Teams card template. Content that is not a JSON object is the card's text
+func compileTeamsTemplate(compiled *CompiledTemplate, content string) (*CompiledTemplate, error) {
+	var err error
+	if !strings.HasPrefix(strings.TrimSpace(content), "{\"") {
+		if compiled.Body, err = compileTemplateParts(content); err != nil {
+			return nil, err
+		}
+		return compiled, nil
+	}
+
+	var message TeamsMessage
+	if err := json.Unmarshal([]byte(content), &message); err != nil {
+		return nil, fmt.Errorf("invalid Teams template format: %w", err)
+	}
+	if message.Text == "" {
+		return nil, fmt.Errorf("teams template must have a text")
+	}
+
+	if compiled.Subject, err = compileTemplateParts(message.Title); err != nil {
+		return nil, fmt.Errorf("invalid Teams title: %w", err)
+	}
+	if compiled.Body, err = compileTemplateParts(message.Text); err != nil {
+		return nil, fmt.Errorf("invalid Teams text: %w", err)
+	}
+	return compiled, nil
+}
+
+// compileTemplateParts splits text into literal and variable parts. Text using template syntax is
+// checked and kept whole as a template part
+func compileTemplateParts(text string) ([]TemplatePart, error) {
+	if usesTemplateSyntax(text) {
+		if _, err := parseTemplateSource(text); err != nil {
+			return nil, err
+		}
+		return []TemplatePart{{Template: text}}, nil
+	}
+
+	var parts []TemplatePart
+	last := 0
+	for _, match := range TemplateVariablePattern.FindAllStringIndex(text, -1) {
+		if match[0] > last {
+			parts = append(parts, TemplatePart{Text: text[last:match[0]]})
+		}
+		name := strings.TrimSpace(strings.Trim(text[match[0]:match[1]], "{}"))
+		parts = append(parts, TemplatePart{Variable: name})
+		last = match[1]
+	}
+	if last < len(text) {
+		parts = append(parts, TemplatePart{Text: text[last:]})
+	}
+	return parts, nil
+}
+
+// RenderTemplateParts writes the parts with their variables substituted. Variables missing from the
+// map render as empty strings and are passed to onMissing. Only template parts can fail to render,
+// e.g. comparing a number with text
+func RenderTemplateParts(parts []TemplatePart, variables map[string]any, onMissing func(name string)) (string, error) {
+	var builder strings.Builder
+	for _, part := range parts {
+		if part.Template != "" {
+			rendered, err := renderTemplateSource(part.Template, variables, onMissing)
+			if err != nil {
+				return "", err
+			}
+			builder.WriteString(rendered)
+			continue
+		}
+		if part.Variable == "" {
+			builder.WriteString(part.Text)
+			continue
+		}
+		value, exists := variables[part.Variable]
+		if !exists {
+			if onMissing != nil {
+				onMissing(part.Variable)
+			}
+			continue
+		}
+		if text, ok := value.(string); ok {
+			builder.WriteString(text)
+		} else {
+			fmt.Fprintf(&builder, "%v", value)
+		}
+	}
+	return builder.String(), nil
+}
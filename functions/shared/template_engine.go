@@ -0,0 +1,412 @@
+package shared
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+)
+
+// Template text is either plain {{name}} placeholders, compiled into parts and substituted directly, or
+// Go text/template source using conditionals, loops and functions. In the latter a bare {{name}} still
+// outputs the variable of that name, wherever it appears; .name reads a variable in pipelines such as
+// {{if .status}} or {{.status | default "unknown"}}, and inside {{range}} or {{with}} dot is the element.
+
+// simplePlaceholderPattern matches the inside of a {{name}} placeholder, with optional trim markers.
+// Names may contain dots and dashes, e.g. user.firstName
+var simplePlaceholderPattern = regexp.MustCompile(`^(-\s+)?\s*([A-Za-z_][A-Za-z0-9_.\-]*)\s*(\s+-)?$`)
+
+// templateKeywords are actions that look like a placeholder but belong to the template syntax
+var templateKeywords = []string{"end", "else", "break", "continue", "nil", "true", "false"}
+
+// variableFunc is the template function a {{name}} placeholder is rewritten to
+const variableFunc = "var"
+
+// templateFuncs is the restricted function map of templates. call would reach functions in variables and
+// is disabled; var is bound to the rendered variables at execution. The comparisons replace the builtin
+// ones, which cannot compare the float64 numbers of JSON variables with integer constants
+var templateFuncs = template.FuncMap{
+	variableFunc: func(string) any { return "" },
+	"call":       func(...any) (any, error) { return nil, fmt.Errorf("call is not allowed in templates") },
+	"default":    templateDefault,
+	"upper":      strings.ToUpper,
+	"lower":      strings.ToLower,
+	"trim":       strings.TrimSpace,
+	"join":       templateJoin,
+	"eq":         templateEqual,
+	"ne":         func(a, b any) bool { return !templateEqual(a, b) },
+	"lt":         func(a, b any) (bool, error) { c, err := templateCompare(a, b); return c < 0, err },
+	"le":         func(a, b any) (bool, error) { c, err := templateCompare(a, b); return c <= 0, err },
+	"gt":         func(a, b any) (bool, error) { c, err := templateCompare(a, b); return c > 0, err },
+	"ge":         func(a, b any) (bool, error) { c, err := templateCompare(a, b); return c >= 0, err },
+}
+
+// Limits of template rendering. A rendered text stops at maxRenderedTextSize, so a loop cannot exhaust
+// memory, and the parsed sources cache is emptied once it holds maxParsedTemplates of them
+const (
+	maxRenderedTextSize = 1 << 20
+	maxParsedTemplates  = 1000
+)
+
+// ErrRenderedTextTooLarge is returned when a template renders more than maxRenderedTextSize bytes
+var ErrRenderedTextTooLarge = fmt.Errorf("rendered template exceeds %d bytes", maxRenderedTextSize)
+
+// parsedTemplates caches parsed template sources, a template is parsed once per process while the cache
+// has room. Previews and tests render texts that are never stored, so the cache is bounded
+var (
+	parsedTemplatesMu sync.Mutex
+	parsedTemplates   = make(map[string]*template.Template)
+)
+
+// cappedWriter collects rendered text up to a limit, writes past it fail and stop the execution
+type cappedWriter struct {
+	builder strings.Builder
+	limit   int
+}
+
+func (w *cappedWriter) Write(p []byte) (int, error) {
+	if w.builder.Len()+len(p) > w.limit {
+		return 0, ErrRenderedTextTooLarge
+	}
+	return w.builder.Write(p)
+}
+
+// templateDefault returns value, or fallback when value is missing, nil or an empty string.
+// {{.status | default "unknown"}}
+func templateDefault(fallback, value any) any {
+	if value == nil {
+		return fallback
+	}
+	if text, ok := value.(string); ok && text == "" {
+		return fallback
+	}
+	return value
+}
+
+// templateJoin joins the elements of a list variable with sep. {{join .tags ", "}}
+func templateJoin(list any, sep string) string {
+	switch items := list.(type) {
+	case []string:
+		return strings.Join(items, sep)
+	case []any:
+		texts := make([]string, len(items))
+		for i, item := range items {
+			texts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(texts, sep)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(list)
+	}
+}
+
+// templateNumber returns a numeric value as a float64
+func templateNumber(value any) (float64, bool) {
+	switch number := value.(type) {
+	case float64:
+		return number, true
+	case float32:
+		return float64(number), true
+	case int:
+		return float64(number), true
+	case int32:
+		return float64(number), true
+	case int64:
+		return float64(number), true
+	case uint:
+		return float64(number), true
+	case uint32:
+		return float64(number), true
+	case uint64:
+		return float64(number), true
+	default:
+		return 0, false
+	}
+}
+
+// templateEqual reports whether a equals any of others, numbers are compared by value
+func templateEqual(a any, others ...any) bool {
+	for _, other := range others {
+		x, aIsNumber := templateNumber(a)
+		y, otherIsNumber := templateNumber(other)
+		if aIsNumber && otherIsNumber {
+			if x == y {
+				return true
+			}
+			continue
+		}
+		if reflect.DeepEqual(a, other) {
+			return true
+		}
+	}
+	return false
+}
+
+// templateCompare orders two numbers or two strings
+func templateCompare(a, b any) (int, error) {
+	x, aIsNumber := templateNumber(a)
+	y, bIsNumber := templateNumber(b)
+	if aIsNumber && bIsNumber {
+		return cmp.Compare(x, y), nil
+	}
+	textA, aIsText := a.(string)
+	textB, bIsText := b.(string)
+	if aIsText && bIsText {
+		return strings.Compare(textA, textB), nil
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+// isSimplePlaceholder reports whether the inside of a {{...}} action is a plain variable placeholder
+// and returns the variable's name
+func isSimplePlaceholder(inner string) (string, bool) {
+	match := simplePlaceholderPattern.FindStringSubmatch(inner)
+	if match == nil || match[1] != "" || match[3] != "" || slices.Contains(templateKeywords, match[2]) {
+		return "", false
+	}
+	return match[2], true
+}
+
+// usesTemplateSyntax reports whether text has any action other than plain {{name}} placeholders
+func usesTemplateSyntax(text string) bool {
+	for _, match := range TemplateVariablePattern.FindAllStringSubmatch(text, -1) {
+		if _, ok := isSimplePlaceholder(match[1]); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// toTemplateSource rewrites the {{name}} placeholders of template text into var calls, which read the
+// variable from the rendered variables wherever dot points
+func toTemplateSource(text string) string {
+	return TemplateVariablePattern.ReplaceAllStringFunc(text, func(action string) string {
+		inner := action[2 : len(action)-2]
+		if match := simplePlaceholderPattern.FindStringSubmatch(inner); match != nil && !slices.Contains(templateKeywords, match[2]) {
+			return fmt.Sprintf("{{%s%s %q%s}}", match[1], variableFunc, match[2], match[3])
+		}
+		return action
+	})
+}
+
+// parseTemplateSource parses template text with the restricted function map. Defining or invoking
+// named templates is rejected, a template renders only its own text, and so is ranging over anything but
+// variables: ranging over a number or a length loops that many times, even without output
+func parseTemplateSource(text string) (*template.Template, error) {
+	parsedTemplatesMu.Lock()
+	cached, ok := parsedTemplates[text]
+	parsedTemplatesMu.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	parsed, err := template.New("content").Funcs(templateFuncs).Parse(toTemplateSource(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template syntax: %w", err)
+	}
+	if len(parsed.Templates()) > 1 || containsTemplateNode(parsed.Tree.Root) {
+		return nil, fmt.Errorf("invalid template syntax: named templates are not allowed")
+	}
+	if containsCountedRange(parsed.Tree.Root) {
+		return nil, fmt.Errorf("invalid template syntax: range only iterates over variables, not numbers or lengths")
+	}
+
+	parsedTemplatesMu.Lock()
+	if len(parsedTemplates) >= maxParsedTemplates {
+		clear(parsedTemplates)
+	}
+	parsedTemplates[text] = parsed
+	parsedTemplatesMu.Unlock()
+	return parsed, nil
+}
+
+// containsCountedRange reports whether the tree has a {{range}} whose pipeline holds a number or calls len,
+// such as {{range 1000000000}}, which Go templates iterate over as a count
+func containsCountedRange(node parse.Node) bool {
+	found := false
+	walkTemplateTree(node, false, func(node parse.Node, _ bool) {
+		rangeNode, ok := node.(*parse.RangeNode)
+		if !ok || rangeNode.Pipe == nil {
+			return
+		}
+		walkTemplateTree(rangeNode.Pipe, false, func(node parse.Node, _ bool) {
+			switch n := node.(type) {
+			case *parse.NumberNode:
+				found = true
+			case *parse.IdentifierNode:
+				if n.Ident == "len" {
+					found = true
+				}
+			}
+		})
+	})
+	return found
+}
+
+// containsTemplateNode reports whether the tree invokes a named template
+func containsTemplateNode(node parse.Node) bool {
+	found := false
+	walkTemplateTree(node, false, func(node parse.Node, _ bool) {
+		if _, ok := node.(*parse.TemplateNode); ok {
+			found = true
+		}
+	})
+	return found
+}
+
+// renderTemplateSource executes template text against the variables. Variables read by {{name}} that
+// are missing render as empty strings and are passed to onMissing
+func renderTemplateSource(text string, variables map[string]any, onMissing func(name string)) (string, error) {
+	parsed, err := parseTemplateSource(text)
+	if err != nil {
+		return "", err
+	}
+	// The parsed template is shared, bind var to these variables on a copy
+	tmpl, err := parsed.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{variableFunc: func(name string) any {
+		value, exists := variables[name]
+		if !exists {
+			if onMissing != nil {
+				onMissing(name)
+			}
+			return ""
+		}
+		return value
+	}})
+
+	output := &cappedWriter{limit: maxRenderedTextSize}
+	if err := tmpl.Execute(output, variables); err != nil {
+		if errors.Is(err, ErrRenderedTextTooLarge) {
+			return "", ErrRenderedTextTooLarge
+		}
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return output.builder.String(), nil
+}
+
+// walkTemplateTree calls visit for every node of the tree. inScope is true inside {{range}} and {{with}}
+// bodies, where dot is no longer the variables
+func walkTemplateTree(node parse.Node, inScope bool, visit func(node parse.Node, inScope bool)) {
+	if node == nil {
+		return
+	}
+	visit(node, inScope)
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			walkTemplateTree(child, inScope, visit)
+		}
+	case *parse.ActionNode:
+		walkTemplateTree(n.Pipe, inScope, visit)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, command := range n.Cmds {
+			walkTemplateTree(command, inScope, visit)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplateTree(arg, inScope, visit)
+		}
+	case *parse.ChainNode:
+		walkTemplateTree(n.Node, inScope, visit)
+	case *parse.IfNode:
+		walkTemplateTree(n.Pipe, inScope, visit)
+		walkTemplateTree(n.List, inScope, visit)
+		walkTemplateTree(n.ElseList, inScope, visit)
+	case *parse.RangeNode:
+		walkTemplateTree(n.Pipe, inScope, visit)
+		walkTemplateTree(n.List, true, visit)
+		walkTemplateTree(n.ElseList, inScope, visit)
+	case *parse.WithNode:
+		walkTemplateTree(n.Pipe, inScope, visit)
+		walkTemplateTree(n.List, true, visit)
+		walkTemplateTree(n.ElseList, inScope, visit)
+	}
+}
+
+// templateSourceVariables returns the variables template text reads: {{name}} placeholders, .name
+// outside {{range}} and {{with}}, and $.name anywhere
+func templateSourceVariables(text string) ([]string, error) {
+	parsed, err := parseTemplateSource(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	walkTemplateTree(parsed.Tree.Root, false, func(node parse.Node, inScope bool) {
+		switch n := node.(type) {
+		case *parse.CommandNode:
+			if identifier, ok := n.Args[0].(*parse.IdentifierNode); ok && identifier.Ident == variableFunc && len(n.Args) == 2 {
+				if name, ok := n.Args[1].(*parse.StringNode); ok {
+					names = append(names, name.Text)
+				}
+			}
+		case *parse.FieldNode:
+			if !inScope {
+				names = append(names, n.Ident[0])
+			}
+		case *parse.VariableNode:
+			if n.Ident[0] == "$" && len(n.Ident) > 1 {
+				names = append(names, n.Ident[1])
+			}
+		}
+	})
+	return names, nil
+}
+
+// templateTextVariables returns the variables of template text, falling back to every {{...}}
+// placeholder when the text is not valid template syntax. Partial references are not variables
+func templateTextVariables(text string) []string {
+	text = partialReferencePattern.ReplaceAllString(text, "")
+	if usesTemplateSyntax(text) {
+		if names, err := templateSourceVariables(text); err == nil {
+			return names
+		}
+	}
+	var names []string
+	for _, match := range TemplateVariablePattern.FindAllStringSubmatch(text, -1) {
+		names = append(names, strings.TrimSpace(match[1]))
+	}
+	return names
+}
+
+// ExtractVariablesFromContent returns the variables used by template content, in order of appearance
+// and with repeats. The texts of JSON contents (email subject and bodies, Teams title and text) are
+// read separately, in key order
+func ExtractVariablesFromContent(content string) []string {
+	var fields map[string]any
+	if !strings.HasPrefix(strings.TrimSpace(content), "{\"") || json.Unmarshal([]byte(content), &fields) != nil {
+		return templateTextVariables(content)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var names []string
+	for _, key := range keys {
+		if text, ok := fields[key].(string); ok {
+			names = append(names, templateTextVariables(text)...)
+		}
+	}
+	return names
+}
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplateSourceRejectsCountedRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		wantErr bool
+	}{
+		{name: "range over a number", text: "{{range 1000000000}}x{{end}}", wantErr: true},
+		{name: "range over a number with variables", text: "{{range $i, $n := 1000000000}}{{end}}", wantErr: true},
+		{name: "range over a length", text: "{{range len .message}}x{{end}}", wantErr: true},
+		{name: "range over a variable", text: "{{range .items}}{{.}}{{end}}"},
+		{name: "range over a variable with variables", text: "{{range $i, $item := .items}}{{$item}}{{end}}"},
+		{name: "number outside a range", text: "{{if gt .count 10}}many{{end}}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseTemplateSource(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTemplateSource(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateSourceCapsOutput(t *testing.T) {
+	items := make([]any, 2000)
+	for i := range items {
+		items[i] = strings.Repeat("x", 1000)
+	}
+
+	_, err := renderTemplateSource("{{range .items}}{{.}}{{end}}", map[string]any{"items": items}, nil)
+	if !errors.Is(err, ErrRenderedTextTooLarge) {
+		t.Fatalf("renderTemplateSource() error = %v, want ErrRenderedTextTooLarge", err)
+	}
+
+	rendered, err := renderTemplateSource("{{range .items}}{{.}}{{end}}", map[string]any{"items": items[:10]}, nil)
+	if err != nil || len(rendered) != 10000 {
+		t.Fatalf("renderTemplateSource() = %d bytes, %v, want 10000 bytes", len(rendered), err)
+	}
+}
+
+func TestParsedTemplatesCacheIsBounded(t *testing.T) {
+	for i := range maxParsedTemplates + 10 {
+		if _, err := parseTemplateSource(strings.Repeat(" ", i) + "{{if .a}}a{{end}}"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parsedTemplatesMu.Lock()
+	defer parsedTemplatesMu.Unlock()
+	if len(parsedTemplates) > maxParsedTemplates {
+		t.Fatalf("parsedTemplates holds %d sources, want at most %d", len(parsedTemplates), maxParsedTemplates)
+	}
+}
@@ -0,0 +1,305 @@
+package shared
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Constants for template issue severities
+const (
+	IssueSeverityError   = "error"
+	IssueSeverityWarning = "warning"
+)
+
+// Size limits of template content. Stored templates also hold their compiled form, which must fit in the same
+// DynamoDB item
+const (
+	MaxTemplateContentLength = 150 * 1024 // Bytes
+	MaxSlackTextLength       = 40000      // Characters, Slack truncates longer messages
+	MaxTeamsCardLength       = 28 * 1024  // Bytes, Teams rejects larger cards
+	MaxPushBodyLength        = 4000       // Bytes, APNs rejects payloads over 4 KB
+)
+
+// lintHTMLTagPattern matches an HTML tag. Slack's <https://...|text>, <@user> and <!here> markup does not match
+var lintHTMLTagPattern = regexp.MustCompile(`</?[A-Za-z][A-Za-z0-9]*(\s[^<>]*)?/?>`)
+
+// insecureLinkPattern matches an http link
+var insecureLinkPattern = regexp.MustCompile(`\bhttp://[^\s"'<>|()\[\]{}]+`)
+
+// channelDisplayNames names channels in lint messages
+var channelDisplayNames = map[string]string{ChannelSlack: "Slack", ChannelSMS: "SMS"}
+
+// emailTemplateFields are the text fields an email template may have, besides its headers object
+var emailTemplateFields = []string{"subject", "body", "htmlBody", "preheader"}
+
+// teamsTemplateFields are the fields a Teams card template may have
+var teamsTemplateFields = []string{"title", "text"}
+
+// LintTemplate checks template content for a channel the way saving it does, and reports content that may not
+// render as intended. Variables are checked against the type's schema; partials are shared by every type and
+// are passed a nil schema, their channel is their name
+func LintTemplate(channel, format, content string, schema *VariableSchema) TemplateValidation {
+	var lint templateLint
+	validation := TemplateValidation{Variables: []string{}}
+
+	// Partials are named by their channel, only the template limit applies to them
+	sizeErr := CheckTemplateSize(channel, content)
+	if schema == nil {
+		sizeErr = CheckTemplateSize("", content)
+	}
+	switch {
+	case content == "":
+		lint.errorf("empty_content", "", "template content is empty")
+	case sizeErr != nil:
+		lint.errorf("too_large", "", "%v", sizeErr)
+	case schema == nil:
+		if err := ValidatePartial(channel, content); err != nil {
+			lint.errorf("invalid_partial", "", "%v", err)
+		}
+	default:
+		lint.checkFormat(channel, format, content)
+		// Variables and channel rules are only checked on content that compiles
+		if !lint.checkStructure(channel, content) {
+			break
+		}
+		if _, err := CompileTemplateContent(channel, content); err != nil {
+			lint.errorf("invalid_syntax", "", "%v", err)
+			break
+		}
+		lint.checkChannelRules(channel, format, content)
+		validation.Variables = lint.checkVariables(content, *schema)
+	}
+
+	validation.Issues = lint.issues
+	if validation.Issues == nil {
+		validation.Issues = []TemplateIssue{}
+	}
+	validation.Valid = !HasLintErrors(validation.Issues)
+	return validation
+}
+
+// LintTemplateContent runs the channel rules on template content that compiles for the channel, as saving a
+// template does. Saves with errors are rejected, warnings are returned with the saved template
+func LintTemplateContent(channel, format, content string) []TemplateIssue {
+	var lint templateLint
+	if lint.checkStructure(channel, content) {
+		lint.checkChannelRules(channel, format, content)
+	}
+	return lint.issues
+}
+
+// HasLintErrors reports whether any of the issues is an error
+func HasLintErrors(issues []TemplateIssue) bool {
+	return slices.ContainsFunc(issues, func(issue TemplateIssue) bool {
+		return issue.Severity == IssueSeverityError
+	})
+}
+
+// templateLint collects the issues found in template content
+type templateLint struct {
+	issues []TemplateIssue
+}
+
+func (l *templateLint) errorf(code, field, format string, args ...any) {
+	l.issues = append(l.issues, TemplateIssue{Severity: IssueSeverityError, Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *templateLint) warnf(code, field, format string, args ...any) {
+	l.issues = append(l.issues, TemplateIssue{Severity: IssueSeverityWarning, Code: code, Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *templateLint) checkFormat(channel, format, content string) {
+	if err := ValidateTemplateFormat(format, channel, content); err != nil {
+		l.errorf("invalid_format", "", "%v", err)
+	}
+}
+
+// checkStructure checks what each channel's content must look like. It reports false when the content is too
+// malformed to compile
+func (l *templateLint) checkStructure(channel, content string) bool {
+	switch channel {
+	case ChannelEmail:
+		return l.checkJSONFields(content, emailTemplateFields, []string{"subject", "body"}, "headers") && l.checkEmailHeaders(content)
+	case ChannelTeams:
+		if isJSONObject(content) {
+			return l.checkJSONFields(content, teamsTemplateFields, nil)
+		}
+	case ChannelSlack:
+		if isJSONObject(content) {
+			l.warnf("slack_json", "", "Slack templates are posted as message text, JSON such as Block Kit blocks is sent as is")
+		}
+		if strings.Count(content, "```")%2 != 0 {
+			l.warnf("unclosed_code_block", "", "a ``` code block is not closed, the rest of the message renders as code")
+		}
+	}
+	return true
+}
+
+// checkChannelRules flags content that does not suit its channel: HTML in Slack and SMS text, which show
+// the tags as typed, an empty email subject, links that do not use https, and SMS split into several segments
+func (l *templateLint) checkChannelRules(channel, format, content string) {
+	switch channel {
+	case ChannelSlack, ChannelSMS:
+		if tags := lintHTMLTagPattern.FindAllString(content, 3); len(tags) > 0 {
+			l.warnf("html_tags", "", "%s does not render HTML, tags such as %s are shown as typed", channelDisplayNames[channel], strings.Join(tags, " "))
+		}
+	case ChannelEmail:
+		if email, err := ParseEmailContent(content); err == nil && strings.TrimSpace(email.Subject) == "" {
+			l.warnf("empty_subject", "subject", "email subject is empty")
+		}
+	}
+
+	var links []string
+	for _, link := range insecureLinkPattern.FindAllString(content, -1) {
+		if !slices.Contains(links, link) {
+			links = append(links, link)
+			l.warnf("insecure_link", "", "link %s does not use https", link)
+		}
+	}
+
+	if channel == ChannelSMS {
+		if segments, encoding := SMSSegments(smsStaticText(format, content)); segments > 1 {
+			l.warnf("sms_segments", "", "SMS is %d %s segments before variables are filled in, each billed", segments, encoding)
+		}
+	}
+}
+
+// smsStaticText returns the text of an SMS template with its variables left empty
+func smsStaticText(format, content string) string {
+	compiled, err := CompileTemplate(ChannelSMS, InlinePartials(content, nil))
+	if err != nil {
+		return content
+	}
+	text, err := RenderTemplateParts(compiled.Body, nil, nil)
+	if err != nil {
+		return content
+	}
+	return ConvertMarkdown(format, ChannelSMS, text)
+}
+
+// CheckTemplateSize fails template content over the size limit of templates or of its channel. Variables are
+// filled in when the template is rendered, the content itself must fit
+func CheckTemplateSize(channel, content string) error {
+	if len(content) > MaxTemplateContentLength {
+		return fmt.Errorf("template is %d bytes, over the %d byte limit", len(content), MaxTemplateContentLength)
+	}
+	switch channel {
+	case ChannelSlack:
+		if length := utf8.RuneCountInString(content); length > MaxSlackTextLength {
+			return fmt.Errorf("Slack message is %d characters, over the %d character limit", length, MaxSlackTextLength)
+		}
+	case ChannelTeams:
+		if len(content) > MaxTeamsCardLength {
+			return fmt.Errorf("Teams card is %d bytes, over the %d byte limit", len(content), MaxTeamsCardLength)
+		}
+	case ChannelPush:
+		if len(content) > MaxPushBodyLength {
+			return fmt.Errorf("push body is %d bytes, over the %d byte limit", len(content), MaxPushBodyLength)
+		}
+	}
+	return nil
+}
+
+// checkJSONFields checks that content is a JSON object of string fields, besides the objects whose caller checks
+// them, that the required ones are set, and warns about fields that are ignored. It reports false when the
+// content is not such an object
+func (l *templateLint) checkJSONFields(content string, known, required []string, objects ...string) bool {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(content), &fields); err != nil {
+		l.errorf("invalid_json", "", "template is not a valid JSON object: %s", describeJSONError(content, err))
+		return false
+	}
+
+	valid := true
+	for _, name := range required {
+		if _, ok := fields[name]; !ok {
+			l.errorf("missing_field", name, "template must have a %s", name)
+			valid = false
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(fields)) {
+		if slices.Contains(objects, name) {
+			continue
+		}
+		if _, ok := fields[name].(string); !ok {
+			l.errorf("invalid_field", name, "%s must be a string", name)
+			valid = false
+			continue
+		}
+		if !slices.Contains(known, name) {
+			l.warnf("unknown_field", name, "%s is not used, known fields are %s", name, strings.Join(append(slices.Clone(known), objects...), ", "))
+		}
+	}
+	return valid
+}
+
+// checkEmailHeaders checks that the headers of an email template are an object of string values, at most
+// MaxEmailHeaders of them, with names the service does not set itself
+func (l *templateLint) checkEmailHeaders(content string) bool {
+	email, err := ParseEmailContent(content)
+	if err != nil {
+		l.errorf("invalid_field", "headers", "headers must be an object of string values")
+		return false
+	}
+	if len(email.Headers) > MaxEmailHeaders {
+		l.errorf("too_many_headers", "headers", "email templates set at most %d headers", MaxEmailHeaders)
+		return false
+	}
+	valid := true
+	for _, name := range slices.Sorted(maps.Keys(email.Headers)) {
+		if err := ValidateEmailHeader(name); err != nil {
+			l.errorf("invalid_header", "headers."+name, "%v", err)
+			valid = false
+		}
+	}
+	return valid
+}
+
+// checkVariables checks the variables content uses against the type's schema and returns them, each once.
+// Required variables the content does not use are reported as warnings
+func (l *templateLint) checkVariables(content string, schema VariableSchema) []string {
+	used := []string{}
+	for _, name := range ExtractVariablesFromContent(content) {
+		if !slices.Contains(used, name) {
+			used = append(used, name)
+		}
+	}
+
+	declared := schema.Names()
+	if len(declared) == 0 {
+		l.errorf("no_variable_schema", "", "notification type %s declares no variables", schema.Type)
+		return used
+	}
+	for _, name := range ValidateTemplateVariables(declared, used) {
+		l.errorf("undeclared_variable", name, "variable %s is not declared for type %s", name, schema.Type)
+	}
+	for _, variable := range schema.Variables {
+		if variable.Required && !slices.Contains(used, variable.Name) {
+			l.warnf("unused_required_variable", variable.Name, "required variable %s is not used", variable.Name)
+		}
+	}
+	return used
+}
+
+// isJSONObject reports whether content is meant as a JSON object, as template content holding fields is
+func isJSONObject(content string) bool {
+	return strings.HasPrefix(strings.TrimSpace(content), "{\"")
+}
+
+// describeJSONError adds the line and column of a syntax error to its message
+func describeJSONError(content string, err error) string {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return err.Error()
+	}
+	before := content[:min(int(syntaxErr.Offset), len(content))]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:])
+	return fmt.Sprintf("%v at line %d, column %d", err, line, column)
+}
@@ -0,0 +1,109 @@
+package shared
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Partials are reusable fragments, such as a footer or a branding header, that templates include with
+// {{> name}}. They are stored as templates of the reserved type partial, with type#channel partial#<name>,
+// and resolved with the same user → global fallback as templates when a template using them is rendered.
+
+// PartialType is the reserved type under which partials are stored
+const PartialType = "partial"
+
+// partialReferencePattern matches a {{> name}} partial reference
+var partialReferencePattern = regexp.MustCompile(`\{\{>\s*([A-Za-z0-9_\-]+)\s*\}\}`)
+
+// partialNamePattern matches the name of a partial
+var partialNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-]{1,64}$`)
+
+// PartialTypeChannel returns the type#channel key a partial is stored under
+func PartialTypeChannel(name string) string {
+	return BuildTypeChannel(PartialType, name)
+}
+
+// IsPartial reports whether the template is a partial
+func (t Template) IsPartial() bool {
+	notificationType, _ := ParseTypeChannel(t.TypeChannel)
+	return notificationType == PartialType
+}
+
+// Precompiled reports whether the template's compiled form is stored with it. Partials are compiled as
+// part of the templates including them, and templates including partials are compiled when they are
+// rendered, once their partials are inlined
+func (t Template) Precompiled() bool {
+	return !t.IsPartial() && !UsesPartials(t.Content)
+}
+
+// UsesPartials reports whether template content includes any partial
+func UsesPartials(content string) bool {
+	return partialReferencePattern.MatchString(content)
+}
+
+// PartialNames returns the names of the partials template content includes, each once
+func PartialNames(content string) []string {
+	var names []string
+	for _, match := range partialReferencePattern.FindAllStringSubmatch(content, -1) {
+		if !slices.Contains(names, match[1]) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// InlinePartials replaces the partial references of template content with the partials' content.
+// Partials missing from the map are removed. The texts of JSON contents are inlined separately, so the
+// content stays valid JSON
+func InlinePartials(content string, partials map[string]string) string {
+	inline := func(text string) string {
+		return partialReferencePattern.ReplaceAllStringFunc(text, func(reference string) string {
+			return partials[partialReferencePattern.FindStringSubmatch(reference)[1]]
+		})
+	}
+
+	var fields map[string]any
+	if !strings.HasPrefix(strings.TrimSpace(content), "{\"") || json.Unmarshal([]byte(content), &fields) != nil {
+		return inline(content)
+	}
+	for key, value := range fields {
+		if text, ok := value.(string); ok {
+			fields[key] = inline(text)
+		}
+	}
+	inlined, err := json.Marshal(fields)
+	if err != nil {
+		return content
+	}
+	return string(inlined)
+}
+
+// ValidatePartial checks the name and content of a partial. A partial cannot include other partials
+func ValidatePartial(name, content string) error {
+	if !partialNamePattern.MatchString(name) {
+		return fmt.Errorf("partial name must be 1 to 64 letters, digits, dashes or underscores")
+	}
+	if content == "" {
+		return fmt.Errorf("partial content is empty")
+	}
+	if UsesPartials(content) {
+		return fmt.Errorf("partials cannot include other partials")
+	}
+	_, err := compileTemplateParts(content)
+	return err
+}
+
+// CompileTemplateContent compiles template content for a channel as CompileTemplate does. Content including
+// partials is checked with its partials left out and has no stored compiled form, it returns nil
+func CompileTemplateContent(channel, content string) (*CompiledTemplate, error) {
+	if !UsesPartials(content) {
+		return CompileTemplate(channel, content)
+	}
+	if _, err := CompileTemplate(channel, InlinePartials(content, nil)); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
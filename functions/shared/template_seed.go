@@ -0,0 +1,118 @@
+package shared
+
+// SeedTemplate is a global template shipped with the service
+type SeedTemplate struct {
+	Type    string
+	Channel string
+	Content string
+}
+
+// TemplateSeedPack is the curated set of global templates installed into a fresh environment.
+// It covers every notification type on every channel and only uses each type's fixed variables
+var TemplateSeedPack = []SeedTemplate{
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelEmail,
+		Content: `{"subject": "[{{environment}}] Alert on {{serverName}}: {{status}}", "body": "An alert was raised on {{serverName}} in {{environment}}.\n\nStatus: {{status}}\nMessage: {{message}}"}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelSlack,
+		Content: `:rotating_light: *Alert* on {{serverName}} ({{environment}}) is {{status}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelInApp,
+		Content: `Alert: {{serverName}} is {{status}} in {{environment}} - {{message}}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelSMS,
+		Content: `ALERT {{serverName}} ({{environment}}) {{status}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelPush,
+		Content: `{{serverName}} is {{status}} in {{environment}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelWebhook,
+		Content: `Alert on {{serverName}} ({{environment}}) is {{status}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeAlert,
+		Channel: ChannelTeams,
+		Content: `{"title": "[{{environment}}] Alert on {{serverName}}: {{status}}", "text": "{{message}}"}`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelEmail,
+		Content: `{"subject": "{{reportType}} report for {{period}}", "body": "Your {{reportType}} report for {{period}} is ready.\n\n{{data}}"}`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelSlack,
+		Content: `:bar_chart: *{{reportType}} report* for {{period}}: {{data}}`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelInApp,
+		Content: `{{reportType}} report for {{period}}: {{data}}`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelSMS,
+		Content: `Your {{reportType}} report for {{period}} is ready`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelPush,
+		Content: `Your {{reportType}} report for {{period}} is ready`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelWebhook,
+		Content: `{{reportType}} report for {{period}}: {{data}}`,
+	},
+	{
+		Type:    NotificationTypeReport,
+		Channel: ChannelTeams,
+		Content: `{"title": "{{reportType}} report for {{period}}", "text": "{{data}}"}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelEmail,
+		Content: `{"subject": "{{title}}", "body": "{{message}}\n\n{{actionUrl}}"}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelSlack,
+		Content: `*{{title}}* {{message}} {{actionUrl}}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelInApp,
+		Content: `{{title}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelSMS,
+		Content: `{{title}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelPush,
+		Content: `{{title}}: {{message}}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelWebhook,
+		Content: `{{title}}: {{message}} {{actionUrl}}`,
+	},
+	{
+		Type:    NotificationTypeNotification,
+		Channel: ChannelTeams,
+		Content: `{"title": "{{title}}", "text": "{{message}}\n\n{{actionUrl}}"}`,
+	},
+}
@@ -0,0 +1,54 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Constants for the access a template share grants
+const (
+	TemplateAccessRead = "read"
+	TemplateAccessEdit = "edit"
+)
+
+// MaxTemplateShares bounds how many users and teams a template can be shared with
+const MaxTemplateShares = 50
+
+// ValidateTemplateShares checks the shares of a template owned by owner: a known access, a user or team
+// principal other than the owner, each listed once
+func ValidateTemplateShares(shares []TemplateShare, owner string) error {
+	if len(shares) > MaxTemplateShares {
+		return fmt.Errorf("a template can be shared with at most %d users and teams", MaxTemplateShares)
+	}
+	seen := make(map[string]bool, len(shares))
+	for _, share := range shares {
+		if share.Principal == "" || share.Principal == RecipientPrefixTeam {
+			return fmt.Errorf("principal is required")
+		}
+		if share.Principal == owner {
+			return fmt.Errorf("a template cannot be shared with its owner")
+		}
+		if share.Access != TemplateAccessRead && share.Access != TemplateAccessEdit {
+			return fmt.Errorf("invalid access for %s: %s", share.Principal, share.Access)
+		}
+		if seen[share.Principal] {
+			return fmt.Errorf("%s is listed more than once", share.Principal)
+		}
+		seen[share.Principal] = true
+	}
+	return nil
+}
+
+// TeamID returns the team a share is granted to, empty when it is granted to a user
+func (s TemplateShare) TeamID() string {
+	teamID, ok := strings.CutPrefix(s.Principal, RecipientPrefixTeam)
+	if !ok {
+		return ""
+	}
+	return teamID
+}
+
+// Allows reports whether the share grants access, edit access including read
+func (s TemplateShare) Allows(access string) bool {
+	return s.Access == TemplateAccessEdit || s.Access == access
+}
@@ -0,0 +1,29 @@
+package shared
+
+// Canned content of channel tests
+const (
+	ChannelTestSubject = "Test notification"
+	ChannelTestMessage = "Test message from the notification service. If you received this, the channel is configured correctly."
+)
+
+// ChannelEnabled reports whether the settings turn the channel on
+func (s SystemSettings) ChannelEnabled(channel string) bool {
+	var enabled *bool
+	switch channel {
+	case ChannelEmail:
+		enabled = s.EmailSettings.Enabled
+	case ChannelSlack:
+		enabled = s.SlackSettings.Enabled
+	case ChannelInApp:
+		enabled = s.InAppSettings.Enabled
+	case ChannelSMS:
+		enabled = s.SmsSettings.Enabled
+	case ChannelPush:
+		enabled = s.PushSettings.Enabled
+	case ChannelWebhook:
+		enabled = s.WebhookSettings.Enabled
+	case ChannelTeams:
+		enabled = s.TeamsSettings.Enabled
+	}
+	return enabled != nil && *enabled
+}
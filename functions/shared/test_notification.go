@@ -0,0 +1,24 @@
+package shared
+
+// TestNotificationPrefix marks the content of admin test notifications
+const TestNotificationPrefix = "[TEST]"
+
+// TestRequestIDPrefix starts the request ID of admin test notifications
+const TestRequestIDPrefix = "test-"
+
+// SampleVariables returns a readable placeholder value of the declared type for each variable of the
+// schema, so a test notification renders every part of the template
+func SampleVariables(schema VariableSchema) map[string]any {
+	variables := make(map[string]any, len(schema.Variables))
+	for _, variable := range schema.Variables {
+		switch variable.Type {
+		case VariableTypeNumber:
+			variables[variable.Name] = 42
+		case VariableTypeBoolean:
+			variables[variable.Name] = true
+		default:
+			variables[variable.Name] = "sample " + variable.Name
+		}
+	}
+	return variables
+}
@@ -0,0 +1,75 @@
+package shared
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Constants for throttle exemption scopes
+const (
+	ExemptionScopeUser     = "user"     // Notifications to the user are exempt
+	ExemptionScopeProducer = "producer" // Requests queued by the producer are exempt
+)
+
+// Constants for the throttles an exemption lifts, named in its audit records
+const (
+	ThrottleDailyCap     = "daily_cap"
+	ThrottleEmailWarmUp  = "email_warm_up"
+	ThrottleContentDedup = "content_dedup"
+)
+
+// UserExemptionID returns the ID of the user's throttle exemption
+func UserExemptionID(userID string) string {
+	return throttleExemptionID(ExemptionScopeUser + "#" + userID)
+}
+
+// ProducerExemptionID returns the ID of the producer's throttle exemption. Producer IDs may be ARNs, the ID is
+// derived from a hash so it fits in a path segment
+func ProducerExemptionID(kind, id string) string {
+	return throttleExemptionID(ExemptionScopeProducer + "#" + kind + "#" + id)
+}
+
+func throttleExemptionID(subject string) string {
+	return uuid.NewSHA1(uuid.NameSpaceOID, []byte(subject)).String()
+}
+
+// Validate checks the exemption's scope, that it names the subject of its scope only and has a reason,
+// and sets its ID
+func (e *ThrottleExemption) Validate() error {
+	switch e.Scope {
+	case ExemptionScopeUser:
+		if e.UserID == "" {
+			return fmt.Errorf("userId is required for a user exemption")
+		}
+		if e.ProducerKind != "" || e.ProducerID != "" {
+			return fmt.Errorf("a user exemption cannot name a producer")
+		}
+		e.ExemptionID = UserExemptionID(e.UserID)
+	case ExemptionScopeProducer:
+		if !ValidateProducerKind(e.ProducerKind) {
+			return fmt.Errorf("invalid producer kind: %s", e.ProducerKind)
+		}
+		if e.ProducerID == "" {
+			return fmt.Errorf("producerId is required for a producer exemption")
+		}
+		if e.UserID != "" {
+			return fmt.Errorf("a producer exemption cannot name a user")
+		}
+		e.ExemptionID = ProducerExemptionID(e.ProducerKind, e.ProducerID)
+	default:
+		return fmt.Errorf("scope must be %s or %s", ExemptionScopeUser, ExemptionScopeProducer)
+	}
+	if e.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+	return nil
+}
+
+// Subject names what the exemption applies to, e.g. "user:user-1" or "producer:service_account:billing"
+func (e ThrottleExemption) Subject() string {
+	if e.Scope == ExemptionScopeProducer {
+		return ExemptionScopeProducer + ":" + e.ProducerKind + ":" + e.ProducerID
+	}
+	return ExemptionScopeUser + ":" + e.UserID
+}
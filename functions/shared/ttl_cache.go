@@ -0,0 +1,67 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+type ttlCacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// TTLCache is a concurrency-safe in-memory cache whose entries expire after a fixed TTL.
+// It lives for the lifetime of a warm Lambda container
+type TTLCache[V any] struct {
+	mu    sync.RWMutex
+	ttl   time.Duration
+	items map[string]ttlCacheEntry[V]
+}
+
+// NewTTLCache creates an empty cache with the given TTL
+func NewTTLCache[V any](ttl time.Duration) *TTLCache[V] {
+	return &TTLCache[V]{
+		ttl:   ttl,
+		items: make(map[string]ttlCacheEntry[V]),
+	}
+}
+
+// Get returns the cached value if present and not expired
+func (c *TTLCache[V]) Get(key string) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, ok := c.items[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// Set stores a value for the cache TTL
+func (c *TTLCache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items[key] = ttlCacheEntry[V]{
+		value:     value,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+}
+
+// Delete removes a single key
+func (c *TTLCache[V]) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.items, key)
+}
+
+// Clear removes every entry
+func (c *TTLCache[V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[string]ttlCacheEntry[V])
+}
@@ -0,0 +1,54 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// UserAttributeVariablePrefix namespaces user attributes among template variables, e.g. {{user.region}}
+const UserAttributeVariablePrefix = "user."
+
+const (
+	maxUserAttributes          = 50
+	maxUserAttributeValueBytes = 256
+)
+
+var userAttributeKeyPattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{0,63}$`)
+
+// ValidateUserAttributeKey validates if the key can be stored and referenced from templates
+func ValidateUserAttributeKey(key string) bool {
+	return userAttributeKeyPattern.MatchString(key)
+}
+
+// ValidateUserAttributes checks the number, keys and value sizes of user attributes
+func ValidateUserAttributes(attributes map[string]string) error {
+	if len(attributes) > maxUserAttributes {
+		return fmt.Errorf("at most %d attributes are allowed", maxUserAttributes)
+	}
+	for key, value := range attributes {
+		if !ValidateUserAttributeKey(key) {
+			return fmt.Errorf("invalid attribute key: %s", key)
+		}
+		if len(value) > maxUserAttributeValueBytes {
+			return fmt.Errorf("value of attribute %s exceeds %d bytes", key, maxUserAttributeValueBytes)
+		}
+	}
+	return nil
+}
+
+// WithUserAttributes returns the variables with the user's attributes added as user.<key>.
+// Variables sent with the request take precedence
+func WithUserAttributes(variables map[string]any, attributes map[string]string) map[string]any {
+	if len(attributes) == 0 {
+		return variables
+	}
+
+	merged := make(map[string]any, len(variables)+len(attributes))
+	for key, value := range attributes {
+		merged[UserAttributeVariablePrefix+key] = value
+	}
+	for key, value := range variables {
+		merged[key] = value
+	}
+	return merged
+}
@@ -5,9 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"os"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/scheduler"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -24,12 +25,13 @@ import (
 
 // AWS service clients
 var (
-	DynamoDBClient  *dynamodb.Client
-	SQSClient       *sqs.Client
-	SNSClient       *sns.Client
-	SESClient       *ses.Client
-	SchedulerClient *scheduler.Client
-	AWSConfig       aws.Config
+	DynamoDBClient       *dynamodb.Client
+	SQSClient            *sqs.Client
+	SNSClient            *sns.Client
+	SESClient            *ses.Client
+	SchedulerClient      *scheduler.Client
+	SecretsManagerClient *secretsmanager.Client
+	AWSConfig            aws.Config
 )
 
 // Environment variables
@@ -40,11 +42,35 @@ var (
 	SchedulesTable              string
 	ConfigTable                 string
 	NotificationValidationTable string
+	DedupTable                  string
+	HistoryTable                string
+	AcknowledgmentsTable        string
+	AnalyticsTable              string
+	OnCallTable                 string
+	TeamsTable                  string
+	DigestTable                 string
+	SegmentsTable               string
+	QuarantineTable             string
+	FailedNotificationsTable    string
+	SequencesTable              string
+	SequenceEnrollmentsTable    string
+	JobsTable                   string
+	VariableSchemasTable        string
+	NotificationTypesTable      string
+	ThrottleExemptionsTable     string
+	InboxTable                  string
+	DeviceTokensTable           string
+	RulesTable                  string
+	UsageTable                  string
+	EmailMessagesTable          string
 	NotificationQueueURL        string
 	NotificationTopicARN        string
 	SchedulerRoleArn            string
 	NotificationQueueArn        string
 	UserPoolID                  string
+	ResourcePrefix              string
+	ScheduleGroup               string
+	SESConfigurationSet         string
 	Environment                 string
 	Region                      string
 )
@@ -58,11 +84,35 @@ func InitAWS() {
 	SchedulesTable = os.Getenv("SCHEDULES_TABLE")
 	ConfigTable = os.Getenv("CONFIG_TABLE")
 	NotificationValidationTable = os.Getenv("NOTIFICATION_VALIDATION_TABLE")
+	DedupTable = os.Getenv("DEDUP_TABLE")
+	HistoryTable = os.Getenv("HISTORY_TABLE")
+	AcknowledgmentsTable = os.Getenv("ACKNOWLEDGMENTS_TABLE")
+	AnalyticsTable = os.Getenv("ANALYTICS_TABLE")
+	OnCallTable = os.Getenv("ONCALL_TABLE")
+	TeamsTable = os.Getenv("TEAMS_TABLE")
+	DigestTable = os.Getenv("DIGEST_TABLE")
+	SegmentsTable = os.Getenv("SEGMENTS_TABLE")
+	QuarantineTable = os.Getenv("QUARANTINE_TABLE")
+	FailedNotificationsTable = os.Getenv("FAILED_NOTIFICATIONS_TABLE")
+	SequencesTable = os.Getenv("SEQUENCES_TABLE")
+	SequenceEnrollmentsTable = os.Getenv("SEQUENCE_ENROLLMENTS_TABLE")
+	JobsTable = os.Getenv("JOBS_TABLE")
+	VariableSchemasTable = os.Getenv("VARIABLE_SCHEMAS_TABLE")
+	NotificationTypesTable = os.Getenv("NOTIFICATION_TYPES_TABLE")
+	ThrottleExemptionsTable = os.Getenv("THROTTLE_EXEMPTIONS_TABLE")
+	InboxTable = os.Getenv("INBOX_TABLE")
+	DeviceTokensTable = os.Getenv("DEVICE_TOKENS_TABLE")
+	RulesTable = os.Getenv("RULES_TABLE")
+	UsageTable = os.Getenv("USAGE_TABLE")
+	EmailMessagesTable = os.Getenv("EMAIL_MESSAGES_TABLE")
 	NotificationQueueURL = os.Getenv("NOTIFICATION_QUEUE_URL")
 	NotificationTopicARN = os.Getenv("NOTIFICATION_TOPIC_ARN")
 	SchedulerRoleArn = os.Getenv("SCHEDULER_ROLE_ARN")
 	NotificationQueueArn = os.Getenv("NOTIFICATION_QUEUE_ARN")
 	UserPoolID = os.Getenv("USER_POOL_ID")
+	ResourcePrefix = os.Getenv("RESOURCE_PREFIX")
+	ScheduleGroup = os.Getenv("SCHEDULE_GROUP")
+	SESConfigurationSet = os.Getenv("SES_CONFIGURATION_SET")
 	Environment = os.Getenv("ENVIRONMENT")
 	Region = os.Getenv("REGION")
 
@@ -81,6 +131,7 @@ func InitAWS() {
 	SNSClient = sns.NewFromConfig(AWSConfig)
 	SESClient = ses.NewFromConfig(AWSConfig)
 	SchedulerClient = scheduler.NewFromConfig(AWSConfig)
+	SecretsManagerClient = secretsmanager.NewFromConfig(AWSConfig)
 }
 
 // CreateAPIResponse creates a standard API Gateway response
@@ -122,6 +173,33 @@ func ParseRequestBody(body string, target interface{}) error {
 	return json.Unmarshal([]byte(body), target)
 }
 
+// NullFields returns the keys set to null in the JSON object of the body, or in its nested object at path.
+// Updates clear the fields sent as null and leave the omitted ones unchanged
+func NullFields(body string, path ...string) map[string]bool {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &object); err != nil {
+		return nil
+	}
+	for _, key := range path {
+		nested := object[key]
+		object = nil
+		if err := json.Unmarshal(nested, &object); err != nil {
+			return nil
+		}
+	}
+
+	var nulls map[string]bool
+	for key, value := range object {
+		if strings.TrimSpace(string(value)) == "null" {
+			if nulls == nil {
+				nulls = make(map[string]bool)
+			}
+			nulls[key] = true
+		}
+	}
+	return nulls
+}
+
 func GetLimit(limitStr string) int {
 	limit := 50
 	if limitStr != "" {
@@ -134,20 +212,51 @@ func GetLimit(limitStr string) int {
 	return limit
 }
 
-// ValidateNotificationType validates if the notification type is valid
-func ValidateNotificationType(notificationType string) bool {
-	validTypes := []string{NotificationTypeAlert, NotificationTypeReport, NotificationTypeNotification}
-	for _, validType := range validTypes {
-		if notificationType == validType {
-			return true
-		}
+// GetEnvInt reads a positive integer env variable, falling back to defaultValue
+func GetEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
 	}
-	return false
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		LogWarn(context.Background()).Str("env", key).Str("value", value).Msg("Invalid integer env value, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvBool reads a boolean env variable, falling back to defaultValue
+func GetEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		LogWarn(context.Background()).Str("env", key).Str("value", value).Msg("Invalid boolean env value, using default")
+		return defaultValue
+	}
+	return parsed
+}
+
+// GetEnvDuration reads a duration env variable (e.g. "30s"), falling back to defaultValue
+func GetEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil || parsed <= 0 {
+		LogWarn(context.Background()).Str("env", key).Str("value", value).Msg("Invalid duration env value, using default")
+		return defaultValue
+	}
+	return parsed
 }
 
 // ValidateChannel validates if the channel is valid
 func ValidateChannel(channel string) bool {
-	validChannels := []string{ChannelEmail, ChannelSlack, ChannelInApp}
+	validChannels := []string{ChannelEmail, ChannelSlack, ChannelInApp, ChannelSMS, ChannelPush, ChannelWebhook, ChannelTeams}
 	for _, validChannel := range validChannels {
 		if channel == validChannel {
 			return true
@@ -156,11 +265,42 @@ func ValidateChannel(channel string) bool {
 	return false
 }
 
+// ValidateTeamPolicy validates if the team delivery policy is valid
+func ValidateTeamPolicy(policy string) bool {
+	validPolicies := []string{TeamPolicyAllMembers, TeamPolicyOnCall, TeamPolicyChannel}
+	for _, validPolicy := range validPolicies {
+		if policy == validPolicy {
+			return true
+		}
+	}
+	return false
+}
+
 // GetCurrentTime returns the current time in UTC
 func GetCurrentTime() time.Time {
 	return time.Now().UTC()
 }
 
+// Percentile returns the p-th percentile (0-100) of sorted values using nearest-rank
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// BuildMetricKey creates the composite key for analytics rollups
+func BuildMetricKey(metric, dimension string) string {
+	return metric + "#" + dimension
+}
+
 // GetUserContext extracts user ID from the Lambda context/claims
 // This would be populated by the API Gateway Cognito authorizer
 func GetUserContext(requestContext events.APIGatewayProxyRequestContext) (UserContext, error) {
@@ -197,46 +337,54 @@ func BuildTypeChannel(notificationType, channel string) string {
 	return notificationType + "#" + channel
 }
 
+// BuildTemplateKey creates the composite key of a template in a language, the default template's key when
+// lang is empty
+func BuildTemplateKey(notificationType, channel, lang string) string {
+	if lang == "" {
+		return BuildTypeChannel(notificationType, channel)
+	}
+	return BuildTypeChannel(notificationType, channel) + "#" + lang
+}
+
 // BuildIDUserIDTypeChannel creates the composite key for notification validations
 func BuildIDUserIDTypeChannel(id, userId, notificationType, channel string) string {
 	return id + "#" + userId + "#" + notificationType + "#" + channel
 }
 
-// ParseTypeChannel splits the composite key into type and channel
+// ParseTypeChannel splits the composite key into type and channel, ignoring the language of a localized template
 func ParseTypeChannel(typeChannel string) (notificationType, channel string) {
-	parts := strings.Split(typeChannel, "#")
-	if len(parts) == 2 {
-		return parts[0], parts[1]
-	}
-	return "", ""
+	notificationType, channel, _ = ParseTemplateKey(typeChannel)
+	return notificationType, channel
 }
 
-func ExtractVariablesFromContent(content string) []string {
-	re := regexp.MustCompile(`{{.*?}}`)
-	matches := re.FindAllString(content, -1)
-	// Trip {} from the matches
-	for i, match := range matches {
-		matches[i] = strings.Trim(match, "{}")
+// ParseTemplateKey splits a template key into type, channel and language, empty for the default template
+func ParseTemplateKey(key string) (notificationType, channel, lang string) {
+	parts := strings.Split(key, "#")
+	switch {
+	case len(parts) == 2:
+		return parts[0], parts[1], ""
+	case len(parts) == 3 && parts[2] != "":
+		return parts[0], parts[1], parts[2]
 	}
-	return matches
+	return "", "", ""
 }
 
-// ValidateTemplateFixedVariables validates that the template uses only allowed variables for its type
-func ValidateTemplateFixedVariables(notificationType string, providedVars []string) []string {
-	// Define allowed variables for each notification type
-	allowedVars := map[string][]string{
-		"alert":        {"serverName", "environment", "status", "message"},
-		"report":       {"reportType", "period", "data"},
-		"notification": {"title", "message", "actionUrl"},
-	}
-
-	allowed, exists := allowedVars[notificationType]
-	if !exists {
-		return []string{"unknown notification type"}
-	}
+// DefaultTemplateVariables lists the variables allowed for each notification type until a variable schema
+// is stored for it
+var DefaultTemplateVariables = map[string][]string{
+	"alert":        {"serverName", "environment", "status", "message"},
+	"report":       {"reportType", "period", "data"},
+	"notification": {"title", "message", "actionUrl"},
+}
 
+// ValidateTemplateVariables returns the provided variables that are not in the allowed list
+func ValidateTemplateVariables(allowed []string, providedVars []string) []string {
 	var invalid []string
 	for _, provided := range providedVars {
+		// User attributes are filled in per recipient and valid for every type
+		if strings.HasPrefix(provided, UserAttributeVariablePrefix) {
+			continue
+		}
 		found := false
 		for _, allowed := range allowed {
 			if provided == allowed {
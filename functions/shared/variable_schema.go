@@ -0,0 +1,95 @@
+package shared
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Constants for the types a variable schema can declare
+const (
+	VariableTypeString  = "string"
+	VariableTypeNumber  = "number"
+	VariableTypeBoolean = "boolean"
+)
+
+// MaxSchemaVariables bounds how many variables a notification type can declare
+const MaxSchemaVariables = 100
+
+// variableNamePattern matches the names variables can be declared with
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidVariableName reports whether name can be declared in a variable schema
+func ValidVariableName(name string) bool {
+	return variableNamePattern.MatchString(name)
+}
+
+// Validate checks that every variable has a valid, unique name and a known type
+func (s VariableSchema) Validate() error {
+	if len(s.Variables) > MaxSchemaVariables {
+		return fmt.Errorf("at most %d variables can be declared", MaxSchemaVariables)
+	}
+	seen := make(map[string]bool, len(s.Variables))
+	for _, variable := range s.Variables {
+		if !ValidVariableName(variable.Name) {
+			return fmt.Errorf("invalid variable name: %q", variable.Name)
+		}
+		if seen[variable.Name] {
+			return fmt.Errorf("variable %s is declared more than once", variable.Name)
+		}
+		seen[variable.Name] = true
+		switch variable.Type {
+		case "", VariableTypeString, VariableTypeNumber, VariableTypeBoolean:
+		default:
+			return fmt.Errorf("invalid type for variable %s: %s", variable.Name, variable.Type)
+		}
+	}
+	return nil
+}
+
+// Names returns the names of the declared variables, in declaration order
+func (s VariableSchema) Names() []string {
+	names := make([]string, 0, len(s.Variables))
+	for _, variable := range s.Variables {
+		names = append(names, variable.Name)
+	}
+	return names
+}
+
+// DefaultVariableSchema returns the built-in schema of a notification type: its DefaultTemplateVariables,
+// each optional and of any type. It has no variables for types without defaults
+func DefaultVariableSchema(notificationType string) VariableSchema {
+	schema := VariableSchema{Type: notificationType}
+	for _, name := range DefaultTemplateVariables[notificationType] {
+		schema.Variables = append(schema.Variables, VariableDefinition{Name: name})
+	}
+	return schema
+}
+
+// accepts reports whether value has the declared type. Untyped variables accept any value templates
+// render as text
+func (d VariableDefinition) accepts(value any) bool {
+	switch d.Type {
+	case VariableTypeString:
+		_, ok := value.(string)
+		return ok
+	case VariableTypeBoolean:
+		_, ok := value.(bool)
+		return ok
+	case VariableTypeNumber:
+		switch value.(type) {
+		case float64, float32, int, int32, int64, uint, uint32, uint64:
+			return true
+		}
+		return false
+	default:
+		return isScalarVariable(value)
+	}
+}
+
+// typeName describes the values a variable accepts, for validation errors
+func (d VariableDefinition) typeName() string {
+	if d.Type == "" {
+		return "a string, number or boolean"
+	}
+	return "a " + d.Type
+}
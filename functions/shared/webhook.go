@@ -0,0 +1,256 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with every webhook delivery. The signature is the hex HMAC-SHA256 of "<timestamp>.<body>"
+// keyed with the endpoint's secret, receivers recompute it and reject stale timestamps to stop replays
+const (
+	WebhookSignatureHeader = "X-Notification-Signature"
+	WebhookTimestampHeader = "X-Notification-Timestamp"
+	WebhookIDHeader        = "X-Notification-Id" // Same on every retry, receivers dedupe on it
+)
+
+// Webhook limits
+const (
+	minWebhookSecretLength  = 16
+	maxWebhookSecretLength  = 256
+	maxWebhookResponseBytes = 1024 // Of the response body kept with the delivery
+	defaultWebhookBackoff   = 500 * time.Millisecond
+	maxWebhookBackoff       = 8 * time.Second
+)
+
+// webhookClient only connects to public addresses and does not follow redirects: the URL is configured by
+// users, so it must not be able to reach the VPC, the metadata endpoint or localhost
+var webhookClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: dialPublicOnly,
+		}).DialContext,
+		TLSHandshakeTimeout: 5 * time.Second,
+		MaxIdleConns:        20,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+	Timeout: GetHTTPTimeout(HTTPProviderWebhook),
+}
+
+// WebhookPayload is the JSON body posted to a webhook
+type WebhookPayload struct {
+	ID          string    `json:"id"` // ID of the notification request
+	Type        string    `json:"type"`
+	RecipientID string    `json:"recipientId"`
+	Content     string    `json:"content"` // Rendered webhook template
+	Test        bool      `json:"test,omitempty"`
+	SentAt      time.Time `json:"sentAt"`
+}
+
+// WebhookResponse is the endpoint's answer to a delivery, the body truncated
+type WebhookResponse struct {
+	StatusCode int
+	Body       string
+}
+
+// WebhookStatusError is returned when the endpoint answers with a status the settings do not expect
+type WebhookStatusError struct {
+	StatusCode int
+}
+
+func (e *WebhookStatusError) Error() string {
+	return fmt.Sprintf("webhook returned unexpected status %d", e.StatusCode)
+}
+
+// ErrUnexpectedWebhookBody is returned when the endpoint answers with an expected status but a body without the
+// expected text, such as a 200 carrying an error
+var ErrUnexpectedWebhookBody = errors.New("webhook response body does not contain the expected text")
+
+// IsEmpty reports whether no webhook field is set
+func (w WebhookSettings) IsEmpty() bool {
+	return w.URL == "" && w.Secret == "" && len(w.ExpectedStatuses) == 0 && w.ExpectedBody == "" && len(w.EndpointsByType) == 0 && w.Enabled == nil
+}
+
+// Validate checks the fields that are set: an https URL, a secret long enough to sign with and real HTTP
+// statuses. Endpoints of notification types need both a URL and a secret
+func (w WebhookSettings) Validate() error {
+	if w.URL != "" {
+		if err := ValidateWebhookURL(w.URL); err != nil {
+			return err
+		}
+	}
+	if err := w.EndpointFor("").validate(); err != nil {
+		return err
+	}
+	for notificationType, endpoint := range w.EndpointsByType {
+		if !ValidateNotificationType(notificationType) {
+			return fmt.Errorf("invalid notification type for webhook endpoint: %s", notificationType)
+		}
+		if endpoint.URL == "" || endpoint.Secret == "" {
+			return fmt.Errorf("webhook endpoint for %s needs a URL and a secret", notificationType)
+		}
+		if err := ValidateWebhookURL(endpoint.URL); err != nil {
+			return fmt.Errorf("webhook endpoint for %s: %w", notificationType, err)
+		}
+		if err := endpoint.validate(); err != nil {
+			return fmt.Errorf("webhook endpoint for %s: %w", notificationType, err)
+		}
+	}
+	return nil
+}
+
+// EndpointFor returns the endpoint a notification type is posted to, the default one when the type has none
+func (w WebhookSettings) EndpointFor(notificationType string) WebhookEndpointSettings {
+	if endpoint, ok := w.EndpointsByType[notificationType]; ok {
+		return endpoint
+	}
+	return WebhookEndpointSettings{
+		URL:              w.URL,
+		Secret:           w.Secret,
+		ExpectedStatuses: w.ExpectedStatuses,
+		ExpectedBody:     w.ExpectedBody,
+	}
+}
+
+// validate checks the secret length, the expected statuses and the expected body of the endpoint
+func (e WebhookEndpointSettings) validate() error {
+	if e.Secret != "" && (len(e.Secret) < minWebhookSecretLength || len(e.Secret) > maxWebhookSecretLength) {
+		return fmt.Errorf("secret must be between %d and %d characters", minWebhookSecretLength, maxWebhookSecretLength)
+	}
+	for _, status := range e.ExpectedStatuses {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid expected status: %d", status)
+		}
+	}
+	if len(e.ExpectedBody) > maxWebhookResponseBytes {
+		return fmt.Errorf("expected body must be at most %d characters", maxWebhookResponseBytes)
+	}
+	return nil
+}
+
+// IsExpectedStatus reports whether a response status counts as delivered, any 2xx unless statuses are configured
+func (e WebhookEndpointSettings) IsExpectedStatus(status int) bool {
+	if len(e.ExpectedStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(e.ExpectedStatuses, status)
+}
+
+// CheckResponse returns the error of a response that does not count as delivered: a WebhookStatusError for a
+// status that is not expected, ErrUnexpectedWebhookBody for a body without the expected text
+func (e WebhookEndpointSettings) CheckResponse(response WebhookResponse) error {
+	if !e.IsExpectedStatus(response.StatusCode) {
+		return &WebhookStatusError{StatusCode: response.StatusCode}
+	}
+	if e.ExpectedBody != "" && !strings.Contains(response.Body, e.ExpectedBody) {
+		return ErrUnexpectedWebhookBody
+	}
+	return nil
+}
+
+// ValidateWebhookURL checks that the URL is an absolute https URL without credentials
+func ValidateWebhookURL(rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid URL")
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use https")
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("webhook URL must not contain credentials")
+	}
+	return nil
+}
+
+// WebhookEndpoint returns the host of a webhook URL, deliveries to one host share a circuit breaker
+func WebhookEndpoint(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return parsed.Host
+}
+
+// SignWebhook returns the signature header value of a body sent at timestamp (Unix seconds)
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// PostWebhook signs and posts a body to the endpoint once. A response is returned whenever the endpoint
+// answered, with the error of CheckResponse when it does not count as delivered
+func PostWebhook(ctx context.Context, endpoint WebhookEndpointSettings, id string, body []byte) (WebhookResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return WebhookResponse{}, err
+	}
+	timestamp := GetCurrentTime().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "notification-service-webhook/1.0")
+	req.Header.Set(WebhookIDHeader, id)
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(endpoint.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return WebhookResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBytes))
+	response := WebhookResponse{
+		StatusCode: resp.StatusCode,
+		Body:       strings.ToValidUTF8(strings.TrimSpace(string(responseBody)), ""),
+	}
+	return response, endpoint.CheckResponse(response)
+}
+
+// PostWebhookWithRetry posts a body to the endpoint, retrying network errors, 429s and 5xx with exponential
+// backoff. Posts are retried up to WEBHOOK_MAX_RETRIES times (default 3) and never past the context's deadline.
+// The last response is returned along with the error
+func PostWebhookWithRetry(ctx context.Context, endpoint WebhookEndpointSettings, id string, body []byte) (WebhookResponse, error) {
+	maxRetries := GetEnvInt("WEBHOOK_MAX_RETRIES", 3)
+	backoff := defaultWebhookBackoff
+	for attempt := 0; ; attempt++ {
+		response, err := PostWebhook(ctx, endpoint, id, body)
+		if err == nil || !isRetryableWebhookResponse(response) || attempt >= maxRetries {
+			return response, err
+		}
+
+		LogWarn(ctx).Err(err).Int("attempt", attempt+1).Int("status", response.StatusCode).Dur("backoff", backoff).Msg("Webhook delivery failed, retrying")
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return response, err
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, maxWebhookBackoff)
+	}
+}
+
+// isRetryableWebhookResponse reports whether a failed post may succeed later: the endpoint could not be
+// reached, was rate limited or failed on its side
+func isRetryableWebhookResponse(response WebhookResponse) bool {
+	return response.StatusCode == 0 || response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
@@ -0,0 +1,86 @@
+package shared
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWebhookEndpointFor(t *testing.T) {
+	settings := WebhookSettings{
+		URL:              "https://example.com/hooks",
+		Secret:           strings.Repeat("s", minWebhookSecretLength),
+		ExpectedStatuses: []int{200},
+		ExpectedBody:     `"ok":true`,
+		EndpointsByType: map[string]WebhookEndpointSettings{
+			"alert": {URL: "https://example.com/alerts", Secret: strings.Repeat("a", minWebhookSecretLength), ExpectedStatuses: []int{202}},
+		},
+	}
+
+	alert := settings.EndpointFor("alert")
+	if alert.URL != "https://example.com/alerts" || alert.ExpectedBody != "" || !alert.IsExpectedStatus(202) || alert.IsExpectedStatus(200) {
+		t.Fatalf("EndpointFor(alert) = %+v, want the alert endpoint with its own expectations", alert)
+	}
+	info := settings.EndpointFor("info")
+	if info.URL != settings.URL || info.Secret != settings.Secret || info.ExpectedBody != settings.ExpectedBody || !info.IsExpectedStatus(200) {
+		t.Fatalf("EndpointFor(info) = %+v, want the default endpoint", info)
+	}
+}
+
+func TestWebhookCheckResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		endpoint   WebhookEndpointSettings
+		response   WebhookResponse
+		wantStatus int
+		wantBody   bool
+	}{
+		{name: "any 2xx", response: WebhookResponse{StatusCode: 204}},
+		{name: "error status", response: WebhookResponse{StatusCode: 500}, wantStatus: 500},
+		{name: "unexpected 2xx", endpoint: WebhookEndpointSettings{ExpectedStatuses: []int{202}}, response: WebhookResponse{StatusCode: 200}, wantStatus: 200},
+		{name: "expected body", endpoint: WebhookEndpointSettings{ExpectedBody: `"ok":true`}, response: WebhookResponse{StatusCode: 200, Body: `{"ok":true}`}},
+		{name: "200 with an error body", endpoint: WebhookEndpointSettings{ExpectedBody: `"ok":true`}, response: WebhookResponse{StatusCode: 200, Body: `{"ok":false,"error":"invalid_payload"}`}, wantBody: true},
+		{name: "status checked before the body", endpoint: WebhookEndpointSettings{ExpectedBody: `"ok":true`}, response: WebhookResponse{StatusCode: 503}, wantStatus: 503},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.endpoint.CheckResponse(tt.response)
+			var statusErr *WebhookStatusError
+			switch {
+			case tt.wantStatus != 0:
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("CheckResponse() = %v, want a WebhookStatusError for %d", err, tt.wantStatus)
+				}
+			case tt.wantBody:
+				if !errors.Is(err, ErrUnexpectedWebhookBody) {
+					t.Fatalf("CheckResponse() = %v, want ErrUnexpectedWebhookBody", err)
+				}
+			case err != nil:
+				t.Fatalf("CheckResponse() = %v, want delivered", err)
+			}
+		})
+	}
+}
+
+func TestWebhookSettingsValidateEndpoints(t *testing.T) {
+	secret := strings.Repeat("s", minWebhookSecretLength)
+	tests := []struct {
+		name      string
+		endpoints map[string]WebhookEndpointSettings
+		wantErr   bool
+	}{
+		{name: "complete endpoint", endpoints: map[string]WebhookEndpointSettings{"alert": {URL: "https://example.com/alerts", Secret: secret, ExpectedStatuses: []int{202}}}},
+		{name: "without a secret", endpoints: map[string]WebhookEndpointSettings{"alert": {URL: "https://example.com/alerts"}}, wantErr: true},
+		{name: "plain http", endpoints: map[string]WebhookEndpointSettings{"alert": {URL: "http://example.com/alerts", Secret: secret}}, wantErr: true},
+		{name: "invalid status", endpoints: map[string]WebhookEndpointSettings{"alert": {URL: "https://example.com/alerts", Secret: secret, ExpectedStatuses: []int{999}}}, wantErr: true},
+		{name: "unknown type", endpoints: map[string]WebhookEndpointSettings{"": {URL: "https://example.com/alerts", Secret: secret}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := WebhookSettings{EndpointsByType: tt.endpoints}.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
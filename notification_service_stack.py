@@ -9,8 +9,17 @@ from aws_cdk import (
     aws_apigateway as apigateway,
     aws_cognito as cognito,
     aws_sqs as sqs,
+    aws_sns as sns,
+    aws_ses as ses,
     aws_iam as iam,
     aws_logs as logs,
+    aws_events as events,
+    aws_events_targets as targets,
+    aws_scheduler as scheduler,
+    aws_secretsmanager as secretsmanager,
+    aws_ec2 as ec2,
+    aws_ecs as ecs,
+    aws_ecs_patterns as ecs_patterns,
 )
 from constructs import Construct
 import os
@@ -18,10 +27,12 @@ import time
 
 class NotificationServiceStack(Stack):
 
-    def __init__(self, scope: Construct, construct_id: str, environment_name: str = "dev", **kwargs) -> None:
+    def __init__(self, scope: Construct, construct_id: str, environment_name: str = "dev", resource_prefix: str = "", enable_grpc_service: bool = False, **kwargs) -> None:
         super().__init__(scope, construct_id, **kwargs)
         
         self.environment_name = environment_name
+        self.resource_prefix = resource_prefix
+        self.enable_grpc_service = enable_grpc_service
         
         # Create DynamoDB tables
         self._create_dynamodb_tables()
@@ -38,6 +49,10 @@ class NotificationServiceStack(Stack):
         # Create API Gateway
         self._create_api_gateway()
         
+        # Create the gRPC service for internal high-volume producers, it needs a VPC so it is opt-in
+        if self.enable_grpc_service:
+            self._create_grpc_service()
+        
         # Create outputs
         self._create_outputs()
 
@@ -157,6 +172,390 @@ class NotificationServiceStack(Stack):
             removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
         )
 
+        # Dedup table - short-lived keys used to suppress duplicate deliveries within a window
+        self.dedup_table = dynamodb.Table(
+            self, f"Dedup-{self.environment_name}",
+            table_name=f"notification-service-dedup-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="dedupKey",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            time_to_live_attribute="expiresAt",
+            removal_policy=RemovalPolicy.DESTROY
+        )
+
+        # Notification History table - processing outcome per notification request
+        self.history_table = dynamodb.Table(
+            self, f"History-{self.environment_name}",
+            table_name=f"notification-service-history-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="id",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            time_to_live_attribute="expiresAt",
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Acknowledgments table
+        self.acknowledgments_table = dynamodb.Table(
+            self, f"Acknowledgments-{self.environment_name}",
+            table_name=f"notification-service-acknowledgments-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="notificationId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="userId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            time_to_live_attribute="expiresAt",
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # GSI: ackDate + acknowledgedAt for the daily analytics rollup
+        self.acknowledgments_table.add_global_secondary_index(
+            index_name="AckDateIndex",
+            partition_key=dynamodb.Attribute(
+                name="ackDate",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="acknowledgedAt",
+                type=dynamodb.AttributeType.STRING
+            ),
+            projection_type=dynamodb.ProjectionType.ALL
+        )
+
+        # Analytics table - daily rollups keyed by metric
+        self.analytics_table = dynamodb.Table(
+            self, f"Analytics-{self.environment_name}",
+            table_name=f"notification-service-analytics-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="metricKey",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="date",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # On-call rotations table
+        self.oncall_table = dynamodb.Table(
+            self, f"OnCallRotations-{self.environment_name}",
+            table_name=f"notification-service-oncall-rotations-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="rotationId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Teams table
+        self.teams_table = dynamodb.Table(
+            self, f"Teams-{self.environment_name}",
+            table_name=f"notification-service-teams-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="teamId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Segments table
+        self.segments_table = dynamodb.Table(
+            self, f"Segments-{self.environment_name}",
+            table_name=f"notification-service-segments-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="segmentId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Sequences table - ordered notification steps with delays, such as onboarding flows
+        self.sequences_table = dynamodb.Table(
+            self, f"Sequences-{self.environment_name}",
+            table_name=f"notification-service-sequences-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="sequenceId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Sequence enrollments table - each user's progress through a sequence
+        self.sequence_enrollments_table = dynamodb.Table(
+            self, f"SequenceEnrollments-{self.environment_name}",
+            table_name=f"notification-service-sequence-enrollments-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="userId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="sequenceId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Jobs table - rolled-up progress of segment and broadcast requests split into chunks
+        self.jobs_table = dynamodb.Table(
+            self, f"Jobs-{self.environment_name}",
+            table_name=f"notification-service-jobs-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="jobId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            time_to_live_attribute="expiresAt",
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Variable schemas table - variables each notification type declares, with their types and whether they are required
+        self.variable_schemas_table = dynamodb.Table(
+            self, f"VariableSchemas-{self.environment_name}",
+            table_name=f"notification-service-variable-schemas-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="type",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Notification types table - custom notification types registered by super admins
+        self.notification_types_table = dynamodb.Table(
+            self, f"NotificationTypes-{self.environment_name}",
+            table_name=f"notification-service-notification-types-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="type",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Throttle exemptions table - users and producers exempt from daily caps, the email warm-up limit and content dedup
+        self.throttle_exemptions_table = dynamodb.Table(
+            self, f"ThrottleExemptions-{self.environment_name}",
+            table_name=f"notification-service-throttle-exemptions-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="exemptionId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Quarantine table - queue messages that kept failing, held for inspection and reprocessing
+        self.quarantine_table = dynamodb.Table(
+            self, f"Quarantine-{self.environment_name}",
+            table_name=f"notification-service-quarantine-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="messageId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            time_to_live_attribute="expiresAt",
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Failed notifications table - queue messages the processor rejected as invalid, with their validation errors
+        self.failed_notifications_table = dynamodb.Table(
+            self, f"FailedNotifications-{self.environment_name}",
+            table_name=f"notification-service-failed-notifications-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="messageId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            time_to_live_attribute="expiresAt",
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Digest table - notifications held for a user's daily digest
+        self.digest_table = dynamodb.Table(
+            self, f"DigestItems-{self.environment_name}",
+            table_name=f"notification-service-digest-items-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="userId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="itemKey",
+                type=dynamodb.AttributeType.STRING
+            ),
+            time_to_live_attribute="expiresAt",
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Inbox table - in-app notifications per user
+        self.inbox_table = dynamodb.Table(
+            self, f"Inbox-{self.environment_name}",
+            table_name=f"notification-service-inbox-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="userId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="notificationId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            time_to_live_attribute="expiresAt",
+            stream=dynamodb.StreamViewType.NEW_AND_OLD_IMAGES,  # Feeds the link preview Lambda
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # LSI: userId + createdAt to list an inbox newest first
+        self.inbox_table.add_local_secondary_index(
+            index_name="CreatedAtIndex",
+            sort_key=dynamodb.Attribute(
+                name="createdAt",
+                type=dynamodb.AttributeType.STRING
+            ),
+            projection_type=dynamodb.ProjectionType.ALL
+        )
+
+        # Device tokens table - devices registered for push notifications, with their SNS platform endpoints
+        self.device_tokens_table = dynamodb.Table(
+            self, f"DeviceTokens-{self.environment_name}",
+            table_name=f"notification-service-device-tokens-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="userId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="deviceId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Rules table - routing rules the processor evaluates before channel filtering
+        self.rules_table = dynamodb.Table(
+            self, f"Rules-{self.environment_name}",
+            table_name=f"notification-service-rules-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="ruleId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            point_in_time_recovery=False if self.environment_name == "dev" else True,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Usage table - daily API call counters per caller and endpoint
+        self.usage_table = dynamodb.Table(
+            self, f"Usage-{self.environment_name}",
+            table_name=f"notification-service-usage-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="date",
+                type=dynamodb.AttributeType.STRING
+            ),
+            sort_key=dynamodb.Attribute(
+                name="usageKey",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            time_to_live_attribute="expiresAt",
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # Email messages table - emails sent through SES, so their bounces can be traced back to the delivery
+        self.email_messages_table = dynamodb.Table(
+            self, f"EmailMessages-{self.environment_name}",
+            table_name=f"notification-service-email-messages-{self.environment_name}",
+            partition_key=dynamodb.Attribute(
+                name="messageId",
+                type=dynamodb.AttributeType.STRING
+            ),
+            billing_mode=dynamodb.BillingMode.PAY_PER_REQUEST,
+            time_to_live_attribute="expiresAt",
+            encryption=dynamodb.TableEncryption.AWS_MANAGED,
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN
+        )
+
+        # ListIndex GSIs: listKey ("all#<shard>", one of 8 shards picked by the item's key, or "<date>#<shard>"
+        # for history) + the list sort key, so list endpoints paginate in a stable order instead of scan order
+        # without writing every item to one partition. Rules are listed in evaluation order, users by ID
+        listed_tables = [
+            (self.schedules_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.preferences_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.config_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.teams_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.segments_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.sequences_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.rules_table, "order", dynamodb.AttributeType.NUMBER),
+            (self.oncall_table, "createdAt", dynamodb.AttributeType.STRING),
+            (self.quarantine_table, "quarantinedAt", dynamodb.AttributeType.STRING),
+            (self.users_table, "userId", dynamodb.AttributeType.STRING),
+            (self.history_table, "createdAt", dynamodb.AttributeType.STRING),
+        ]
+        for table, sort_key, sort_key_type in listed_tables:
+            table.add_global_secondary_index(
+                index_name="ListIndex",
+                partition_key=dynamodb.Attribute(
+                    name="listKey",
+                    type=dynamodb.AttributeType.STRING
+                ),
+                sort_key=dynamodb.Attribute(
+                    name=sort_key,
+                    type=sort_key_type
+                ),
+                projection_type=dynamodb.ProjectionType.ALL
+            )
+
     def _create_cognito_user_pool(self):
         """Create Cognito User Pool for authentication"""
         
@@ -225,6 +624,39 @@ class NotificationServiceStack(Stack):
         # Grant EventBridge Scheduler permission to send messages to SQS
         self.notification_queue.grant_send_messages(self.scheduler_role)
 
+        # Schedule group per environment so multiple stacks can coexist in one account
+        self.schedule_group = scheduler.CfnScheduleGroup(
+            self, f"ScheduleGroup-{self.environment_name}",
+            name=f"{self.resource_prefix}notification-service-{self.environment_name}",
+        )
+
+        # Key for the secrets stored in system configs, such as user Slack webhooks
+        self.config_encryption_key = secretsmanager.Secret(
+            self, f"ConfigEncryptionKey-{self.environment_name}",
+            description="Encrypts secrets stored in notification service system configs",
+            generate_secret_string=secretsmanager.SecretStringGenerator(
+                password_length=64,
+                exclude_punctuation=True,
+            ),
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN,
+        )
+
+        # Bounces of the emails sent through SES, published by the configuration set they are sent with
+        self.bounce_topic = sns.Topic(
+            self, f"BounceTopic-{self.environment_name}",
+            topic_name=f"notification-service-bounces-{self.environment_name}"
+        )
+
+        self.ses_configuration_set = ses.ConfigurationSet(
+            self, f"ConfigurationSet-{self.environment_name}",
+            configuration_set_name=f"{self.resource_prefix}notification-service-{self.environment_name}"
+        )
+        self.ses_configuration_set.add_event_destination(
+            f"BounceDestination-{self.environment_name}",
+            destination=ses.EventDestination.sns_topic(self.bounce_topic),
+            events=[ses.EmailSendingEvent.BOUNCE]
+        )
+
         # Common Lambda configuration
         lambda_environment = {
             "USERS_TABLE": self.users_table.table_name,
@@ -233,9 +665,33 @@ class NotificationServiceStack(Stack):
             "SCHEDULES_TABLE": self.schedules_table.table_name,
             "CONFIG_TABLE": self.config_table.table_name,
             "NOTIFICATION_VALIDATION_TABLE": self.notification_validation_table.table_name,
+            "DEDUP_TABLE": self.dedup_table.table_name,
+            "HISTORY_TABLE": self.history_table.table_name,
+            "ACKNOWLEDGMENTS_TABLE": self.acknowledgments_table.table_name,
+            "ANALYTICS_TABLE": self.analytics_table.table_name,
+            "ONCALL_TABLE": self.oncall_table.table_name,
+            "TEAMS_TABLE": self.teams_table.table_name,
+            "DIGEST_TABLE": self.digest_table.table_name,
+            "SEGMENTS_TABLE": self.segments_table.table_name,
+            "SEQUENCES_TABLE": self.sequences_table.table_name,
+            "SEQUENCE_ENROLLMENTS_TABLE": self.sequence_enrollments_table.table_name,
+            "JOBS_TABLE": self.jobs_table.table_name,
+            "VARIABLE_SCHEMAS_TABLE": self.variable_schemas_table.table_name,
+            "NOTIFICATION_TYPES_TABLE": self.notification_types_table.table_name,
+            "THROTTLE_EXEMPTIONS_TABLE": self.throttle_exemptions_table.table_name,
+            "QUARANTINE_TABLE": self.quarantine_table.table_name,
+            "FAILED_NOTIFICATIONS_TABLE": self.failed_notifications_table.table_name,
+            "INBOX_TABLE": self.inbox_table.table_name,
+            "DEVICE_TOKENS_TABLE": self.device_tokens_table.table_name,
+            "RULES_TABLE": self.rules_table.table_name,
+            "USAGE_TABLE": self.usage_table.table_name,
+            "EMAIL_MESSAGES_TABLE": self.email_messages_table.table_name,
             "NOTIFICATION_QUEUE_URL": self.notification_queue.queue_url,
             "NOTIFICATION_QUEUE_ARN": self.notification_queue.queue_arn,
             "SCHEDULER_ROLE_ARN": self.scheduler_role.role_arn,
+            "SCHEDULE_GROUP": self.schedule_group.ref,
+            "SES_CONFIGURATION_SET": self.ses_configuration_set.configuration_set_name,
+            "RESOURCE_PREFIX": self.resource_prefix,
             "USER_POOL_ID": self.user_pool.user_pool_id,
             "ENVIRONMENT": self.environment_name,
             "REGION": self.region
@@ -257,6 +713,27 @@ class NotificationServiceStack(Stack):
         self.schedules_table.grant_read_write_data(lambda_role)
         self.config_table.grant_read_write_data(lambda_role)
         self.notification_validation_table.grant_read_write_data(lambda_role)
+        self.dedup_table.grant_read_write_data(lambda_role)
+        self.history_table.grant_read_write_data(lambda_role)
+        self.acknowledgments_table.grant_read_write_data(lambda_role)
+        self.analytics_table.grant_read_write_data(lambda_role)
+        self.oncall_table.grant_read_write_data(lambda_role)
+        self.teams_table.grant_read_write_data(lambda_role)
+        self.digest_table.grant_read_write_data(lambda_role)
+        self.segments_table.grant_read_write_data(lambda_role)
+        self.sequences_table.grant_read_write_data(lambda_role)
+        self.sequence_enrollments_table.grant_read_write_data(lambda_role)
+        self.jobs_table.grant_read_write_data(lambda_role)
+        self.variable_schemas_table.grant_read_write_data(lambda_role)
+        self.notification_types_table.grant_read_write_data(lambda_role)
+        self.throttle_exemptions_table.grant_read_write_data(lambda_role)
+        self.quarantine_table.grant_read_write_data(lambda_role)
+        self.failed_notifications_table.grant_read_write_data(lambda_role)
+        self.inbox_table.grant_read_write_data(lambda_role)
+        self.device_tokens_table.grant_read_write_data(lambda_role)
+        self.rules_table.grant_read_write_data(lambda_role)
+        self.usage_table.grant_read_write_data(lambda_role)
+        self.email_messages_table.grant_read_write_data(lambda_role)
         
         # Grant permissions to Cognito
         lambda_role.add_to_policy(
@@ -273,21 +750,53 @@ class NotificationServiceStack(Stack):
                     "scheduler:CreateSchedule",
                     "scheduler:UpdateSchedule", 
                     "scheduler:DeleteSchedule",
-                    "scheduler:GetSchedule"
+                    "scheduler:GetSchedule",
+                    "scheduler:ListSchedules",
+                    "scheduler:CreateScheduleGroup",
+                    "scheduler:ListScheduleGroups"
                 ],
                 resources=["*"]
             )
         )
         
-        # Grant permission to pass the scheduler role to EventBridge Scheduler
+        # Grant permissions to send critical contact verification codes and alerts, and SMS notifications
         lambda_role.add_to_policy(
             iam.PolicyStatement(
-                actions=["iam:PassRole"],
-                resources=[self.scheduler_role.role_arn]
+                actions=["ses:SendEmail", "ses:SendRawEmail", "sns:Publish"],
+                resources=["*"]
             )
         )
-        
-        # User Handler Lambda
+
+        # Grant permissions to manage the SNS platform endpoints of push devices
+        lambda_role.add_to_policy(
+            iam.PolicyStatement(
+                actions=["sns:CreatePlatformEndpoint", "sns:SetEndpointAttributes", "sns:DeleteEndpoint"],
+                resources=["*"]
+            )
+        )
+        
+        # Grant permissions to check the SES setup of the From domains and the sending quota
+        lambda_role.add_to_policy(
+            iam.PolicyStatement(
+                actions=[
+                    "ses:GetIdentityVerificationAttributes",
+                    "ses:GetIdentityDkimAttributes",
+                    "ses:GetIdentityMailFromDomainAttributes",
+                    "ses:GetSendQuota"
+                ],
+                resources=["*"]
+            )
+        )
+        
+        # Grant permission to pass the scheduler role to EventBridge Scheduler
+        lambda_role.add_to_policy(
+            iam.PolicyStatement(
+                actions=["iam:PassRole"],
+                resources=[self.scheduler_role.role_arn]
+            )
+        )
+        
+        # User Handler Lambda
         self.user_handler = _lambda.Function(
             self, f"UserHandler-{self.environment_name}",
             function_name=f"NotificationService-UserHandler-{self.environment_name}",
@@ -357,8 +866,9 @@ class NotificationServiceStack(Stack):
             log_retention=logs.RetentionDays.ONE_WEEK
         )
 
-        # Grant SQS permissions to the processor
+        # Grant SQS permissions to the processor, which also queues the child requests of segment fan-outs
         self.notification_queue.grant_consume_messages(lambda_role)
+        self.notification_queue.grant_send_messages(lambda_role)
 
         # Add SQS event source to trigger the processor
         self.processor_handler.add_event_source(
@@ -383,6 +893,302 @@ class NotificationServiceStack(Stack):
             log_retention=logs.RetentionDays.ONE_WEEK
         )
 
+        # Notification Handler Lambda
+        self.notification_handler = _lambda.Function(
+            self, f"NotificationHandler-{self.environment_name}",
+            function_name=f"NotificationService-NotificationHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/notification"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Analytics Handler Lambda
+        self.analytics_handler = _lambda.Function(
+            self, f"AnalyticsHandler-{self.environment_name}",
+            function_name=f"NotificationService-AnalyticsHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/analytics"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # On-call Handler Lambda
+        self.oncall_handler = _lambda.Function(
+            self, f"OnCallHandler-{self.environment_name}",
+            function_name=f"NotificationService-OnCallHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/oncall"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Team Handler Lambda
+        self.team_handler = _lambda.Function(
+            self, f"TeamHandler-{self.environment_name}",
+            function_name=f"NotificationService-TeamHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/team"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Segment Handler Lambda
+        self.segment_handler = _lambda.Function(
+            self, f"SegmentHandler-{self.environment_name}",
+            function_name=f"NotificationService-SegmentHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/segment"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Sequence Handler Lambda
+        self.sequence_handler = _lambda.Function(
+            self, f"SequenceHandler-{self.environment_name}",
+            function_name=f"NotificationService-SequenceHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/sequence"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Job Handler Lambda
+        self.job_handler = _lambda.Function(
+            self, f"JobHandler-{self.environment_name}",
+            function_name=f"NotificationService-JobHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/job"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Notification Type Handler Lambda
+        self.notification_type_handler = _lambda.Function(
+            self, f"NotificationTypeHandler-{self.environment_name}",
+            function_name=f"NotificationService-NotificationTypeHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/notificationtype"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Rule Handler Lambda
+        self.rule_handler = _lambda.Function(
+            self, f"RuleHandler-{self.environment_name}",
+            function_name=f"NotificationService-RuleHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/rule"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Inbox Handler Lambda
+        self.inbox_handler = _lambda.Function(
+            self, f"InboxHandler-{self.environment_name}",
+            function_name=f"NotificationService-InboxHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/inbox"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Link Preview Lambda - attaches Open Graph previews to in-app notifications as they are delivered
+        self.link_preview_handler = _lambda.Function(
+            self, f"LinkPreviewHandler-{self.environment_name}",
+            function_name=f"NotificationService-LinkPreviewHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/linkpreview"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(60),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        self.link_preview_handler.add_event_source(
+            lambda_event_sources.DynamoEventSource(
+                self.inbox_table,
+                starting_position=_lambda.StartingPosition.LATEST,
+                batch_size=10,
+                retry_attempts=2,
+                filters=[
+                    _lambda.FilterCriteria.filter({"eventName": _lambda.FilterRule.or_("INSERT", "MODIFY")})
+                ]
+            )
+        )
+
+        # Admin Handler Lambda - scans whole tables, so it gets a longer timeout
+        self.admin_handler = _lambda.Function(
+            self, f"AdminHandler-{self.environment_name}",
+            function_name=f"NotificationService-AdminHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/admin"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.minutes(1),
+            memory_size=512,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        # Analytics Rollup Lambda - runs daily for the previous day
+        self.rollup_handler = _lambda.Function(
+            self, f"RollupHandler-{self.environment_name}",
+            function_name=f"NotificationService-RollupHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/rollup"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.minutes(5),
+            memory_size=512,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        events.Rule(
+            self, f"RollupSchedule-{self.environment_name}",
+            schedule=events.Schedule.cron(minute="15", hour="0"),
+            targets=[targets.LambdaFunction(self.rollup_handler)]
+        )
+
+        # Missed Summary Lambda - weekly email listing unread in-app notifications
+        self.missed_summary_handler = _lambda.Function(
+            self, f"MissedSummaryHandler-{self.environment_name}",
+            function_name=f"NotificationService-MissedSummaryHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/missedsummary"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.minutes(5),
+            memory_size=512,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        events.Rule(
+            self, f"MissedSummarySchedule-{self.environment_name}",
+            schedule=events.Schedule.cron(minute="0", hour="8", week_day="MON"),
+            targets=[targets.LambdaFunction(self.missed_summary_handler)]
+        )
+
+        # Expiry Reminder Lambda - daily email to owners of schedules, rules and templates about to expire
+        self.expiry_reminder_handler = _lambda.Function(
+            self, f"ExpiryReminderHandler-{self.environment_name}",
+            function_name=f"NotificationService-ExpiryReminderHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/expiryreminder"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.minutes(5),
+            memory_size=512,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        events.Rule(
+            self, f"ExpiryReminderSchedule-{self.environment_name}",
+            schedule=events.Schedule.cron(minute="0", hour="7"),
+            targets=[targets.LambdaFunction(self.expiry_reminder_handler)]
+        )
+
+        # Retention Janitor Lambda - enforces the global retention policy on history, acknowledgments,
+        # validation results, quarantined messages and failed notifications, and removes expired preference overrides
+        self.janitor_handler = _lambda.Function(
+            self, f"JanitorHandler-{self.environment_name}",
+            function_name=f"NotificationService-JanitorHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/janitor"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.minutes(15),
+            memory_size=512,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        events.Rule(
+            self, f"JanitorSchedule-{self.environment_name}",
+            schedule=events.Schedule.cron(minute="30", hour="3"),
+            targets=[targets.LambdaFunction(self.janitor_handler)]
+        )
+
+        # Bounce Lambda - records SES bounces and schedules the redelivery of soft-bounced emails
+        self.bounce_handler = _lambda.Function(
+            self, f"BounceHandler-{self.environment_name}",
+            function_name=f"NotificationService-BounceHandler-{self.environment_name}",
+            runtime=_lambda.Runtime.PROVIDED_AL2,
+            handler="bootstrap",
+            code=_lambda.Code.from_asset("./build/bounce"),
+            environment=lambda_environment,
+            role=lambda_role,
+            timeout=Duration.seconds(30),
+            memory_size=256,
+            log_retention=logs.RetentionDays.ONE_WEEK
+        )
+
+        self.bounce_handler.add_event_source(
+            lambda_event_sources.SnsEventSource(self.bounce_topic)
+        )
+
+        # Functions that read or write the encrypted secrets of configs and teams get the ARN of the encryption
+        # key and read it at runtime, the key itself stays out of the template and the functions' environment
+        for handler in [
+            self.user_handler,
+            self.template_handler,
+            self.preference_handler,
+            self.config_handler,
+            self.processor_handler,
+            self.schedule_handler,
+            self.notification_handler,
+            self.team_handler,
+            self.admin_handler,
+            self.bounce_handler,
+        ]:
+            handler.add_environment("CONFIG_ENCRYPTION_KEY_SECRET_ARN", self.config_encryption_key.secret_arn)
+        self.config_encryption_key.grant_read(lambda_role)
+
     def _create_api_gateway(self):
         """Create API Gateway for the REST API"""
         
@@ -423,10 +1229,58 @@ class NotificationServiceStack(Stack):
             "GET", 
             apigateway.LambdaIntegration(self.user_handler),
         )
+        user_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.user_handler),
+        )
+
+        user_devices_resource = user_resource.add_resource("devices")
+        user_device_resource = user_devices_resource.add_resource("{deviceId}")
+
+        user_devices_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.user_handler),
+        )
+        user_devices_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.user_handler),
+        )
+        user_device_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.user_handler),
+        )
+
+        # The caller's own resources, deleted to fall back to the global defaults
+        me_resources_resource = api_v1.add_resource("me").add_resource("resources")
+        me_resources_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.user_handler),
+        )
         
         # Templates endpoints
         templates_resource = api_v1.add_resource("templates")
         template_resource = templates_resource.add_resource("{templateId}")
+        templates_seed_resource = templates_resource.add_resource("seed")
+        templates_validate_resource = templates_resource.add_resource("validate")
+        template_clone_resource = template_resource.add_resource("clone")
+        templates_bulk_resource = templates_resource.add_resource("bulk")
+
+        templates_seed_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.template_handler),
+        )
+        templates_validate_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.template_handler),
+        )
+        template_clone_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.template_handler),
+        )
+        templates_bulk_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.template_handler),
+        )
         
         templates_resource.add_method(
             "GET", 
@@ -468,6 +1322,47 @@ class NotificationServiceStack(Stack):
             "DELETE", 
             apigateway.LambdaIntegration(self.preference_handler),
         )
+
+        preferences_effective_resource = preferences_resource.add_resource("effective")
+
+        preferences_effective_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+
+        preferences_overrides_resource = preferences_resource.add_resource("overrides")
+        preferences_override_resource = preferences_overrides_resource.add_resource("{overrideId}")
+
+        preferences_overrides_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+        preferences_override_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+
+        preferences_critical_contact_resource = preferences_resource.add_resource("critical-contact")
+
+        preferences_critical_contact_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+        preferences_critical_contact_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+        preferences_critical_contact_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
+
+        preferences_critical_contact_verify_resource = preferences_critical_contact_resource.add_resource("verify")
+
+        preferences_critical_contact_verify_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.preference_handler),
+        )
         
         # Config endpoints
         config_resource = api_v1.add_resource("config")
@@ -488,10 +1383,27 @@ class NotificationServiceStack(Stack):
             "DELETE", 
             apigateway.LambdaIntegration(self.config_handler),
         )
+
+        config_slack_test_resource = config_resource.add_resource("slack").add_resource("test")
+
+        config_slack_test_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.config_handler),
+        )
+
+        config_test_channel_resource = config_resource.add_resource("test-channel")
+
+        config_test_channel_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.config_handler),
+        )
         
         # Scheduled Notifications endpoints
         scheduled_notifications_resource = api_v1.add_resource("scheduled-notifications")
         scheduled_notification_resource = scheduled_notifications_resource.add_resource("{scheduleId}")
+        scheduled_notifications_next_runs_resource = scheduled_notifications_resource.add_resource("next-runs")
+        scheduled_notification_next_runs_resource = scheduled_notification_resource.add_resource("next-runs")
+        scheduled_notification_clone_resource = scheduled_notification_resource.add_resource("clone")
         
         scheduled_notifications_resource.add_method(
             "GET", 
@@ -513,7 +1425,469 @@ class NotificationServiceStack(Stack):
             "DELETE", 
             apigateway.LambdaIntegration(self.schedule_handler),
         )
+        scheduled_notifications_next_runs_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.schedule_handler),
+        )
+        scheduled_notification_next_runs_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.schedule_handler),
+        )
+        scheduled_notification_clone_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.schedule_handler),
+        )
+
+        # Notifications endpoints
+        notifications_resource = api_v1.add_resource("notifications")
+        notification_resource = notifications_resource.add_resource("{notificationId}")
+        notification_ack_resource = notification_resource.add_resource("ack")
+        notifications_simulate_resource = notifications_resource.add_resource("simulate")
+
+        notification_ack_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.notification_handler),
+        )
+        notifications_simulate_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.notification_handler),
+        )
+
+        # Analytics endpoints
+        analytics_resource = api_v1.add_resource("analytics")
+        ack_sla_resource = analytics_resource.add_resource("ack-sla")
+
+        ack_sla_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.analytics_handler),
+        )
+
+        delivery_sla_resource = analytics_resource.add_resource("sla")
+
+        delivery_sla_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.analytics_handler),
+        )
+
+        # On-call endpoints
+        oncall_resource = api_v1.add_resource("oncall")
+        oncall_rotation_resource = oncall_resource.add_resource("{rotationId}")
+
+        oncall_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.oncall_handler),
+        )
+        oncall_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.oncall_handler),
+        )
+        oncall_rotation_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.oncall_handler),
+        )
+        oncall_rotation_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.oncall_handler),
+        )
+        oncall_rotation_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.oncall_handler),
+        )
+
+        # Team endpoints
+        teams_resource = api_v1.add_resource("teams")
+        team_resource = teams_resource.add_resource("{teamId}")
+
+        teams_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.team_handler),
+        )
+        teams_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.team_handler),
+        )
+        team_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.team_handler),
+        )
+        team_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.team_handler),
+        )
+        team_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.team_handler),
+        )
+
+        # Segment endpoints
+        segments_resource = api_v1.add_resource("segments")
+        segment_resource = segments_resource.add_resource("{segmentId}")
+
+        segments_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.segment_handler),
+        )
+        segments_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.segment_handler),
+        )
+        segment_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.segment_handler),
+        )
+        segment_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.segment_handler),
+        )
+        segment_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.segment_handler),
+        )
+
+        # Sequence endpoints
+        sequences_resource = api_v1.add_resource("sequences")
+        sequence_resource = sequences_resource.add_resource("{sequenceId}")
+        enrollments_resource = sequence_resource.add_resource("enrollments")
+        enrollment_resource = enrollments_resource.add_resource("{userId}")
+        enrollment_skip_resource = enrollment_resource.add_resource("skip")
+
+        sequences_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        sequences_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        sequence_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        sequence_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        sequence_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        enrollments_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        enrollment_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        enrollment_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+        enrollment_skip_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.sequence_handler),
+        )
+
+        # Job endpoints
+        jobs_resource = api_v1.add_resource("jobs")
+        job_resource = jobs_resource.add_resource("{jobId}")
+
+        job_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.job_handler),
+        )
+
+        # Notification type endpoints
+        notification_types_resource = api_v1.add_resource("notification-types")
+        notification_type_resource = notification_types_resource.add_resource("{type}")
+
+        notification_types_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.notification_type_handler),
+        )
+        notification_types_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.notification_type_handler),
+        )
+        notification_type_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.notification_type_handler),
+        )
+        notification_type_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.notification_type_handler),
+        )
+        notification_type_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.notification_type_handler),
+        )
+
+        # Rule endpoints
+        rules_resource = api_v1.add_resource("rules")
+        rule_resource = rules_resource.add_resource("{ruleId}")
+
+        rules_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.rule_handler),
+        )
+        rules_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.rule_handler),
+        )
+        rule_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.rule_handler),
+        )
+        rule_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.rule_handler),
+        )
+        rule_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.rule_handler),
+        )
+
+        # Inbox endpoints
+        inbox_resource = api_v1.add_resource("inbox")
+        inbox_item_resource = inbox_resource.add_resource("{notificationId}")
+        inbox_read_resource = inbox_item_resource.add_resource("read")
+
+        inbox_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.inbox_handler),
+        )
+        inbox_item_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.inbox_handler),
+        )
+        inbox_item_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.inbox_handler),
+        )
+        inbox_read_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.inbox_handler),
+        )
+
+        # Admin endpoints
+        admin_resource = api_v1.add_resource("admin")
+        admin_consistency_resource = admin_resource.add_resource("consistency")
+
+        admin_consistency_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_notifications_resource = admin_resource.add_resource("notifications")
+        admin_notification_resource = admin_notifications_resource.add_resource("{requestId}")
+        admin_notifications_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_replay_resource = admin_notification_resource.add_resource("replay")
+        admin_artifacts_resource = admin_notification_resource.add_resource("artifacts")
+
+        admin_artifacts_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_replay_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_rename_variable_resource = admin_resource.add_resource("templates").add_resource("rename-variable")
+
+        admin_rename_variable_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_variable_schemas_resource = admin_resource.add_resource("variable-schemas")
+        admin_variable_schema_resource = admin_variable_schemas_resource.add_resource("{type}")
+
+        admin_variable_schemas_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_variable_schema_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_variable_schema_resource.add_method(
+            "PUT",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_variable_schema_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_schedules_resource = admin_resource.add_resource("schedules")
+
+        admin_schedules_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_quarantine_resource = admin_resource.add_resource("quarantine")
+        admin_quarantined_message_resource = admin_quarantine_resource.add_resource("{messageId}")
+        admin_reprocess_resource = admin_quarantined_message_resource.add_resource("reprocess")
+
+        admin_quarantine_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_quarantined_message_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_reprocess_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_consent_report_resource = admin_resource.add_resource("consent-report")
+
+        admin_consent_report_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_usage_resource = admin_resource.add_resource("usage")
+
+        admin_usage_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_email_resource = admin_resource.add_resource("email")
+        admin_domain_status_resource = admin_email_resource.add_resource("domain-status")
+
+        admin_domain_status_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_provider_status_resource = admin_email_resource.add_resource("provider-status")
+
+        admin_provider_status_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_test_notification_resource = admin_resource.add_resource("users").add_resource("{userId}").add_resource("test-notification")
+
+        admin_test_notification_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+        admin_throttle_exemptions_resource = admin_resource.add_resource("throttle-exemptions")
+        admin_throttle_exemption_resource = admin_throttle_exemptions_resource.add_resource("{exemptionId}")
+
+        admin_throttle_exemptions_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+        admin_throttle_exemptions_resource.add_method(
+            "POST",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+        admin_throttle_exemption_resource.add_method(
+            "GET",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+        admin_throttle_exemption_resource.add_method(
+            "DELETE",
+            apigateway.LambdaIntegration(self.admin_handler),
+        )
+
+
+    def _create_grpc_service(self):
+        """Create the gRPC server container behind an internal Network Load Balancer"""
+        
+        grpc_port = 50051
+        
+        self.grpc_vpc = ec2.Vpc(
+            self, f"GrpcVpc-{self.environment_name}",
+            max_azs=2,
+            nat_gateways=1
+        )
+        
+        cluster = ecs.Cluster(
+            self, f"GrpcCluster-{self.environment_name}",
+            vpc=self.grpc_vpc
+        )
+        
+        # Signs the producer tokens callers authenticate with, issued with `notifyctl producer-token`
+        self.grpc_producer_secret = secretsmanager.Secret(
+            self, f"GrpcProducerSecret-{self.environment_name}",
+            description="Signs the producer tokens of the notification service gRPC API",
+            generate_secret_string=secretsmanager.SecretStringGenerator(
+                password_length=64,
+                exclude_punctuation=True,
+            ),
+            removal_policy=RemovalPolicy.DESTROY if self.environment_name == "dev" else RemovalPolicy.RETAIN,
+        )
+        
+        self.grpc_service = ecs_patterns.NetworkLoadBalancedFargateService(
+            self, f"GrpcService-{self.environment_name}",
+            cluster=cluster,
+            cpu=512,
+            memory_limit_mib=1024,
+            desired_count=2,
+            public_load_balancer=False,
+            listener_port=grpc_port,
+            task_image_options=ecs_patterns.NetworkLoadBalancedTaskImageOptions(
+                image=ecs.ContainerImage.from_asset(".", file="cmd/grpcserver/Dockerfile"),
+                container_port=grpc_port,
+                environment={
+                    "NOTIFICATION_QUEUE_URL": self.notification_queue.queue_url,
+                    "DEDUP_TABLE": self.dedup_table.table_name,
+                    "GRPC_PORT": str(grpc_port),
+                    "ENVIRONMENT": self.environment_name,
+                    "REGION": self.region
+                },
+                secrets={
+                    "GRPC_PRODUCER_SECRET": ecs.Secret.from_secrets_manager(self.grpc_producer_secret)
+                },
+                log_driver=ecs.LogDrivers.aws_logs(
+                    stream_prefix="grpcserver",
+                    log_retention=logs.RetentionDays.ONE_WEEK
+                )
+            )
+        )
         
+        # Producers in the VPC reach the tasks through the load balancer, which keeps the client address
+        self.grpc_service.service.connections.allow_from(
+            ec2.Peer.ipv4(self.grpc_vpc.vpc_cidr_block),
+            ec2.Port.tcp(grpc_port)
+        )
+        
+        # The processor records the task role as the producer principal of the requests the server queues
+        self.notification_queue.grant_send_messages(self.grpc_service.task_definition.task_role)
+        # Dedup keys are claimed when requests are queued, so duplicates are reported to the producer
+        self.dedup_table.grant_read_write_data(self.grpc_service.task_definition.task_role)
+        
+        CfnOutput(
+            self, "GrpcEndpoint",
+            value=f"{self.grpc_service.load_balancer.load_balancer_dns_name}:{grpc_port}",
+            description="Internal gRPC endpoint for high-volume producers"
+        )
+        
+        CfnOutput(
+            self, "GrpcProducerSecretArn",
+            value=self.grpc_producer_secret.secret_arn,
+            description="Secret signing the gRPC producer tokens, read it to issue tokens with notifyctl producer-token"
+        )
 
     def _create_outputs(self):
         """Create CloudFormation outputs"""
@@ -572,6 +1946,12 @@ class NotificationServiceStack(Stack):
             description="EventBridge Scheduler Role ARN"
         )
 
+        CfnOutput(
+            self, "ScheduleGroupName",
+            value=self.schedule_group.ref,
+            description="EventBridge Scheduler Group Name"
+        )
+
         CfnOutput(
             self, "SchedulesTable",
             value=self.schedules_table.table_name,
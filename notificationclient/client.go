@@ -0,0 +1,394 @@
+// Package notificationclient is the Go client of the notification service for internal services. It sends
+// notifications through the gRPC API and manages schedules and preferences through the REST API, with the
+// service's own models, Cognito authentication and retries of throttled or unavailable calls.
+//
+//	client := notificationclient.New(apiURL,
+//		notificationclient.WithTokenSource(tokens),
+//		notificationclient.WithGRPCEndpoint("internal-nlb.example:50051"),
+//		notificationclient.WithProducerToken(os.Getenv("NOTIFICATION_PRODUCER_TOKEN")))
+//	result, err := client.SendNotification(ctx, notificationclient.NotificationRequest{Type: "alert", Recipients: []string{userID}})
+package notificationclient
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults of the retry policy
+const (
+	defaultMaxAttempts = 3
+	defaultRetryDelay  = 200 * time.Millisecond
+	maxRetryDelay      = 5 * time.Second
+)
+
+// defaultTimeout bounds each attempt of a call when no HTTP client is given
+const defaultTimeout = 10 * time.Second
+
+// TokenSource returns the Cognito ID token sent in the Authorization header of REST calls. It is asked
+// for a token on every attempt, so it can refresh an expiring one
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// StaticToken is a TokenSource that always returns the same token
+type StaticToken string
+
+func (t StaticToken) Token(context.Context) (string, error) {
+	return string(t), nil
+}
+
+// Client calls the notification service. It is safe for concurrent use
+type Client struct {
+	baseURL       string
+	grpcAddr      string
+	producerToken string
+	grpcTLS       *tls.Config
+	httpClient    *http.Client
+	grpcClient    *http.Client
+	tokens        TokenSource
+	maxAttempts   int
+	retryDelay    time.Duration
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client of REST calls
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithTokenSource sets the source of the Cognito ID tokens of REST calls
+func WithTokenSource(tokens TokenSource) Option {
+	return func(c *Client) { c.tokens = tokens }
+}
+
+// WithGRPCEndpoint sets the host:port of the gRPC API, required to send notifications
+func WithGRPCEndpoint(addr string) Option {
+	return func(c *Client) { c.grpcAddr = addr }
+}
+
+// WithGRPCTLS connects to the gRPC API over TLS, verifying the server with the config or the system roots
+// when it is nil. Without it calls are plaintext, for servers reached inside their VPC
+func WithGRPCTLS(config *tls.Config) Option {
+	return func(c *Client) { c.grpcTLS = cmp.Or(config, &tls.Config{}) }
+}
+
+// WithProducerToken sets the producer token gRPC calls authenticate with, issued to the calling service with
+// shared.SignProducerToken (notifyctl producer-token). The service it names is recorded as the producer of
+// the notifications it sends
+func WithProducerToken(token string) Option {
+	return func(c *Client) { c.producerToken = token }
+}
+
+// WithRetry sets how many times a call is attempted and the delay before the first retry, which doubles
+// on each further retry. One attempt disables retries
+func WithRetry(maxAttempts int, delay time.Duration) Option {
+	return func(c *Client) {
+		c.maxAttempts = max(maxAttempts, 1)
+		c.retryDelay = delay
+	}
+}
+
+// New returns a client of the REST API at baseURL, the stage URL of the API Gateway (APIGatewayURL output)
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:     strings.TrimSuffix(baseURL, "/"),
+		httpClient:  &http.Client{Timeout: defaultTimeout},
+		maxAttempts: defaultMaxAttempts,
+		retryDelay:  defaultRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.grpcClient = newGRPCClient(c.grpcTLS)
+	return c
+}
+
+// CreateSchedule creates a schedule sending a notification of the type to the request's recipients and segment,
+// which only super admins may set, or to the calling user when neither is set
+func (c *Client) CreateSchedule(ctx context.Context, request CreateScheduleRequest) (ScheduledNotification, error) {
+	var schedule ScheduledNotification
+	// A create is only retried when throttled, an unavailable handler may already have created the schedule
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/scheduled-notifications", nil, request, &schedule, isThrottled)
+	return schedule, err
+}
+
+// GetPreferences returns the preferences of a context: the calling user's ID, another user's for admins,
+// or "*" for the global preferences. An empty context is the calling user's
+func (c *Client) GetPreferences(ctx context.Context, context string) (UserPreferences, error) {
+	query := url.Values{}
+	if context != "" {
+		query.Set("context", context)
+	}
+	var preferences UserPreferences
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/preferences", query, nil, &preferences, isRetryableStatus)
+	return preferences, err
+}
+
+// ListSchedules returns a page of the calling user's schedules and the token of the next page, empty on the
+// last one. With tags only the schedules carrying every tag are listed
+func (c *Client) ListSchedules(ctx context.Context, nextToken string, tags ...string) ([]ScheduledNotification, string, error) {
+	query := url.Values{}
+	if nextToken != "" {
+		query.Set("nextToken", nextToken)
+	}
+	if len(tags) > 0 {
+		query.Set("tag", strings.Join(tags, ","))
+	}
+	var page struct {
+		Items     []ScheduledNotification `json:"items"`
+		NextToken string                  `json:"nextToken"`
+	}
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/scheduled-notifications", query, nil, &page, isRetryableStatus)
+	return page.Items, page.NextToken, err
+}
+
+// UpdateSchedule changes the given fields of a schedule, e.g. its status to pause or resume it
+func (c *Client) UpdateSchedule(ctx context.Context, scheduleID string, request UpdateScheduleRequest) (ScheduledNotification, error) {
+	var schedule ScheduledNotification
+	err := c.doREST(ctx, http.MethodPut, "/api/v1/scheduled-notifications/"+url.PathEscape(scheduleID), nil, request, &schedule, isRetryableStatus)
+	return schedule, err
+}
+
+// CloneSchedule copies one of the calling user's schedules under a new schedule ID, with the given variables
+// replacing the copied ones
+func (c *Client) CloneSchedule(ctx context.Context, scheduleID string, request CloneScheduleRequest) (ScheduledNotification, error) {
+	var schedule ScheduledNotification
+	// Like a create, a clone is only retried when throttled
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/scheduled-notifications/"+url.PathEscape(scheduleID)+"/clone", nil, request, &schedule, isThrottled)
+	return schedule, err
+}
+
+// GetScheduleNextRuns returns the next firing times of a schedule, count defaults to 5
+func (c *Client) GetScheduleNextRuns(ctx context.Context, scheduleID string, count int) (ScheduleNextRuns, error) {
+	query := url.Values{}
+	if count > 0 {
+		query.Set("count", strconv.Itoa(count))
+	}
+	var runs ScheduleNextRuns
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/scheduled-notifications/"+url.PathEscape(scheduleID)+"/next-runs", query, nil, &runs, isRetryableStatus)
+	return runs, err
+}
+
+// PreviewScheduleRuns returns the next firing times of a cron or rate expression before a schedule is
+// created with it. An empty timezone is the calling user's preferred one
+func (c *Client) PreviewScheduleRuns(ctx context.Context, expression, timezone string, count int) (ScheduleNextRuns, error) {
+	query := url.Values{}
+	query.Set("expression", expression)
+	if timezone != "" {
+		query.Set("timezone", timezone)
+	}
+	if count > 0 {
+		query.Set("count", strconv.Itoa(count))
+	}
+	var runs ScheduleNextRuns
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/scheduled-notifications/next-runs", query, nil, &runs, isRetryableStatus)
+	return runs, err
+}
+
+// GetEffectivePreferences returns the preferences the processor applies to a user, with their active
+// overrides applied. An empty user ID is the calling user
+func (c *Client) GetEffectivePreferences(ctx context.Context, userID string) (UserPreferences, error) {
+	query := url.Values{}
+	if userID != "" {
+		query.Set("context", userID)
+	}
+	var preferences UserPreferences
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/preferences/effective", query, nil, &preferences, isRetryableStatus)
+	return preferences, err
+}
+
+// Simulate renders what a notification would reach a user with on each channel without sending it. Users
+// simulate their own notifications, admins anyone's
+func (c *Client) Simulate(ctx context.Context, request SimulationRequest) (Simulation, error) {
+	var simulation Simulation
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/notifications/simulate", nil, request, &simulation, isRetryableStatus)
+	return simulation, err
+}
+
+// GetTemplate returns a template of a context by its ID, type#channel or type#channel#language
+func (c *Client) GetTemplate(ctx context.Context, context, templateID string) (Template, error) {
+	query := url.Values{}
+	if context != "" {
+		query.Set("context", context)
+	}
+	var template Template
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/templates/"+url.PathEscape(templateID), query, nil, &template, isRetryableStatus)
+	return template, err
+}
+
+// CreateTemplate creates a template, it fails with an APIError when one already exists
+func (c *Client) CreateTemplate(ctx context.Context, request SaveTemplateRequest) (Template, error) {
+	var template Template
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/templates", nil, request, &template, isThrottled)
+	return template, err
+}
+
+// UpdateTemplate replaces the content of an existing template, an APIError with status 404 reports it
+// does not exist
+func (c *Client) UpdateTemplate(ctx context.Context, templateID string, request SaveTemplateRequest) (Template, error) {
+	var template Template
+	err := c.doREST(ctx, http.MethodPut, "/api/v1/templates/"+url.PathEscape(templateID), nil, request, &template, isRetryableStatus)
+	return template, err
+}
+
+// CloneTemplate copies a global template into a context, the calling user's when empty. An APIError with
+// status 409 reports the context already has the template
+func (c *Client) CloneTemplate(ctx context.Context, templateID, context string) (Template, error) {
+	var template Template
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/templates/"+url.PathEscape(templateID)+"/clone", nil,
+		map[string]string{"context": context}, &template, isThrottled)
+	return template, err
+}
+
+// SetTemplatesActive activates or deactivates every template of a context, the calling user's when empty,
+// carrying all the tags. With dryRun the templates that would change are only reported
+func (c *Client) SetTemplatesActive(ctx context.Context, context string, tags []string, active, dryRun bool) (TemplateBulkResult, error) {
+	request := map[string]any{"context": context, "tags": tags, "isActive": active, "dryRun": dryRun}
+	var result TemplateBulkResult
+	// Templates already in the requested state are skipped, so the call can be repeated
+	err := c.doREST(ctx, http.MethodPost, "/api/v1/templates/bulk", nil, request, &result, isRetryableStatus)
+	return result, err
+}
+
+// DeleteMyResources deletes the calling user's templates, schedules and preferences, or only the given
+// resource types, so the global defaults apply again
+func (c *Client) DeleteMyResources(ctx context.Context, resourceTypes ...string) (UserResourcesDeletion, error) {
+	query := url.Values{}
+	if len(resourceTypes) > 0 {
+		query.Set("types", strings.Join(resourceTypes, ","))
+	}
+	var deletion UserResourcesDeletion
+	err := c.doREST(ctx, http.MethodDelete, "/api/v1/me/resources", query, nil, &deletion, isRetryableStatus)
+	return deletion, err
+}
+
+// GetConfig returns the system config of a context, with its secrets masked unless reveal is set, which
+// only super admins can do
+func (c *Client) GetConfig(ctx context.Context, context string, reveal bool) (SystemConfig, error) {
+	query := url.Values{}
+	query.Set("context", context)
+	if reveal {
+		query.Set("reveal", "true")
+	}
+	var config SystemConfig
+	err := c.doREST(ctx, http.MethodGet, "/api/v1/config", query, nil, &config, isRetryableStatus)
+	return config, err
+}
+
+// UpdateConfig merges the given settings into the existing system config of their context
+func (c *Client) UpdateConfig(ctx context.Context, config SystemConfig) (SystemConfig, error) {
+	var updated SystemConfig
+	err := c.doREST(ctx, http.MethodPut, "/api/v1/config", nil, config, &updated, isRetryableStatus)
+	return updated, err
+}
+
+// doREST sends a REST call, retrying the responses retryable accepts and failed connections, and decodes
+// the JSON response into out
+func (c *Client) doREST(ctx context.Context, method, path string, query url.Values, body, out any, retryable func(int) bool) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+	endpoint := c.baseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	return c.retry(ctx, func() (time.Duration, bool, error) {
+		req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return 0, false, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.tokens != nil {
+			token, err := c.tokens.Token(ctx)
+			if err != nil {
+				return 0, false, fmt.Errorf("failed to get token: %w", err)
+			}
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return 0, true, err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, true, err
+		}
+
+		if resp.StatusCode >= http.StatusBadRequest {
+			apiErr := &APIError{StatusCode: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+			var errorBody struct {
+				Message string `json:"message"`
+				Details any    `json:"details"`
+			}
+			if json.Unmarshal(data, &errorBody) == nil && errorBody.Message != "" {
+				apiErr.Message, apiErr.Details = errorBody.Message, errorBody.Details
+			}
+			return retryAfter(resp.Header.Get("Retry-After")), retryable(resp.StatusCode), apiErr
+		}
+		if out == nil {
+			return 0, false, nil
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return 0, false, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return 0, false, nil
+	})
+}
+
+// retry runs attempt until it succeeds, fails with an error it does not mark retryable or runs out of
+// attempts. A positive wait returned by attempt, e.g. a Retry-After, replaces the backoff delay
+func (c *Client) retry(ctx context.Context, attempt func() (wait time.Duration, retryable bool, err error)) error {
+	delay := c.retryDelay
+	for i := 1; ; i++ {
+		wait, retryable, err := attempt()
+		if err == nil || !retryable || i >= c.maxAttempts {
+			return err
+		}
+		if wait <= 0 {
+			wait = delay
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(min(wait, maxRetryDelay)):
+		}
+		delay *= 2
+	}
+}
+
+func isThrottled(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+}
+
+// retryAfter reads a Retry-After header in seconds, 0 when it is absent
+func retryAfter(header string) time.Duration {
+	seconds, err := strconv.Atoi(header)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
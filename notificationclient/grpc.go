@@ -0,0 +1,154 @@
+package notificationclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"notification-service/functions/shared"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Full method names from proto/notification_service.proto
+const (
+	methodSendNotification = "/notification.v1.NotificationService/SendNotification"
+	methodSendBatch        = "/notification.v1.NotificationService/SendBatch"
+)
+
+// gRPC status codes the client retries
+const (
+	codeResourceExhausted = 8
+	codeUnavailable       = 14
+)
+
+// messageHeaderSize is the length-prefixed message header: a compressed flag and a 4-byte big-endian length
+const messageHeaderSize = 5
+
+// newGRPCClient returns an HTTP client speaking HTTP/2 over TLS with the config, or plaintext HTTP/2 with prior
+// knowledge when it is nil, as the gRPC server expects
+func newGRPCClient(tlsConfig *tls.Config) *http.Client {
+	var protocols http.Protocols
+	if tlsConfig != nil {
+		protocols.SetHTTP2(true)
+	} else {
+		protocols.SetUnencryptedHTTP2(true)
+	}
+	return &http.Client{
+		Timeout:   defaultTimeout,
+		Transport: &http.Transport{Protocols: &protocols, TLSClientConfig: tlsConfig},
+	}
+}
+
+// SendNotification queues a notification request and returns its result. A request without an ID gets one
+// before the first attempt, so a retried call cannot queue it twice under different IDs. A request whose
+// dedup key is held by another request within its window is not queued, its result names that request
+func (c *Client) SendNotification(ctx context.Context, request NotificationRequest) (SendResult, error) {
+	if request.ID == "" {
+		request.ID = uuid.New().String()
+	}
+	message, err := shared.MarshalProtobufRequest(request)
+	if err != nil {
+		return SendResult{}, err
+	}
+	response, err := c.callGRPC(ctx, methodSendNotification, message)
+	if err != nil {
+		return SendResult{}, err
+	}
+	id, duplicateOf, err := shared.UnmarshalSendNotificationResponse(response)
+	if err != nil {
+		return SendResult{}, err
+	}
+	return SendResult{ID: id, Queued: duplicateOf == "", DuplicateOf: duplicateOf}, nil
+}
+
+// SendBatch queues the valid requests of a batch and returns one result per request, in request order.
+// Requests without an ID get one, so the batch can be retried as a whole
+func (c *Client) SendBatch(ctx context.Context, requests []NotificationRequest) ([]SendResult, error) {
+	batch := make([]NotificationRequest, len(requests))
+	for i, request := range requests {
+		if request.ID == "" {
+			request.ID = uuid.New().String()
+		}
+		batch[i] = request
+	}
+	message, err := shared.MarshalSendBatchRequest(batch)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.callGRPC(ctx, methodSendBatch, message)
+	if err != nil {
+		return nil, err
+	}
+	return shared.UnmarshalSendBatchResponse(response)
+}
+
+// callGRPC makes a unary gRPC call, retrying failed connections and UNAVAILABLE or RESOURCE_EXHAUSTED statuses
+func (c *Client) callGRPC(ctx context.Context, method string, message []byte) ([]byte, error) {
+	if c.grpcAddr == "" {
+		return nil, fmt.Errorf("no gRPC endpoint configured, use WithGRPCEndpoint")
+	}
+	if c.producerToken == "" {
+		return nil, fmt.Errorf("no producer token configured, use WithProducerToken")
+	}
+
+	scheme := "http://"
+	if c.grpcTLS != nil {
+		scheme = "https://"
+	}
+	framed := make([]byte, messageHeaderSize, messageHeaderSize+len(message))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(message)))
+	framed = append(framed, message...)
+
+	var response []byte
+	err := c.retry(ctx, func() (time.Duration, bool, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+c.grpcAddr+method, bytes.NewReader(framed))
+		if err != nil {
+			return 0, false, err
+		}
+		req.Header.Set("Content-Type", "application/grpc")
+		req.Header.Set("TE", "trailers")
+		req.Header.Set("Authorization", "Bearer "+c.producerToken)
+
+		resp, err := c.grpcClient.Do(req)
+		if err != nil {
+			return 0, true, err
+		}
+		defer resp.Body.Close()
+		// The trailers are only set once the body has been read
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, true, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return 0, resp.StatusCode >= http.StatusInternalServerError, fmt.Errorf("gRPC endpoint returned HTTP %d", resp.StatusCode)
+		}
+
+		// A failed call is a trailers-only response, its status is in the headers
+		statusHeader, messageHeader := resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+		if statusHeader == "" {
+			statusHeader, messageHeader = resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+		}
+		code, err := strconv.Atoi(statusHeader)
+		if err != nil {
+			return 0, false, fmt.Errorf("gRPC response has no valid grpc-status")
+		}
+		if code != 0 {
+			statusMessage, _ := url.PathUnescape(messageHeader)
+			return 0, code == codeUnavailable || code == codeResourceExhausted, &GRPCError{Code: code, Message: statusMessage}
+		}
+
+		if len(data) < messageHeaderSize || int(binary.BigEndian.Uint32(data[1:messageHeaderSize])) != len(data)-messageHeaderSize {
+			return 0, false, fmt.Errorf("malformed gRPC response message")
+		}
+		response = data[messageHeaderSize:]
+		return 0, false, nil
+	})
+	return response, err
+}
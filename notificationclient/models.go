@@ -0,0 +1,71 @@
+package notificationclient
+
+import (
+	"fmt"
+	"notification-service/functions/shared"
+)
+
+// The request and response models are the service's own, so clients and handlers cannot drift apart
+type (
+	NotificationRequest   = shared.NotificationRequest
+	SendResult            = shared.SendResult
+	ScheduledNotification = shared.ScheduledNotification
+	ScheduleConfig        = shared.ScheduleConfig
+	CreateScheduleRequest = shared.CreateScheduleRequest
+	UpdateScheduleRequest = shared.UpdateScheduleRequest
+	CloneScheduleRequest  = shared.CloneScheduleRequest
+	ScheduleNextRuns      = shared.ScheduleNextRuns
+	UserPreferences       = shared.UserPreferences
+	PreferenceItem        = shared.PreferenceItem
+	Template              = shared.Template
+	SystemConfig          = shared.SystemConfig
+	SystemSettings        = shared.SystemSettings
+	UserResourcesDeletion = shared.UserResourcesDeletion
+	SimulationRequest     = shared.SimulationRequest
+	Simulation            = shared.Simulation
+	ChannelSimulation     = shared.ChannelSimulation
+)
+
+// SaveTemplateRequest is the body of template creates and updates. Updates take the type, channel and
+// language from the template ID
+type SaveTemplateRequest struct {
+	Context  string   `json:"context,omitempty"` // "*" for a global template, empty for the calling user's
+	Type     string   `json:"type,omitempty"`
+	Channel  string   `json:"channel,omitempty"`
+	Language string   `json:"language,omitempty"`
+	Content  string   `json:"content"`
+	Format   string   `json:"format,omitempty"` // "text" | "markdown", kept on updates when empty
+	Tags     []string `json:"tags,omitempty"`   // Replaces the template's tags on updates
+}
+
+// TemplateBulkResult reports the templates a bulk activation or deactivation matched, and the type#channel of
+// those whose state it changed
+type TemplateBulkResult struct {
+	Context  string   `json:"context"`
+	Tags     []string `json:"tags"`
+	IsActive bool     `json:"isActive"`
+	DryRun   bool     `json:"dryRun,omitempty"`
+	Matched  int      `json:"matched"`
+	Updated  []string `json:"updated"`
+}
+
+// APIError is an error response of the REST API
+type APIError struct {
+	StatusCode int
+	Message    string
+	Details    any
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notification API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// GRPCError is a failed call to the gRPC API, Code is the gRPC status code
+type GRPCError struct {
+	Code    int
+	Message string
+}
+
+func (e *GRPCError) Error() string {
+	return fmt.Sprintf("notification gRPC API returned status %d: %s", e.Code, e.Message)
+}
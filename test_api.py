@@ -357,7 +357,7 @@ def test_system_config_positive(test_super_admin: User, test_user: User):
     # Test creating user system config
     user_config = {
         "slack": {
-            "webhookUrl": "https://hooks.slack.com/user-webhook",
+            "webhookUrl": "https://hooks.slack.com/services/T000/B000/user-webhook",
             "enabled": True
         },
         "email": {
@@ -373,7 +373,7 @@ def test_system_config_positive(test_super_admin: User, test_user: User):
     assert response.status_code == 201
     response_json = response.json()
     assert response_json["context"] == test_user.user_id
-    assert response_json["config"]["slack"]["webhookUrl"] == "https://hooks.slack.com/user-webhook"
+    assert response_json["config"]["slack"]["webhookUrl"] == "****hook"
     assert response_json["config"]["slack"]["enabled"] == True
     assert response_json["config"]["email"]["enabled"] == False
     assert response_json["config"]["inApp"]["platformAppIds"] == ["app1", "app2"]
@@ -384,7 +384,7 @@ def test_system_config_positive(test_super_admin: User, test_user: User):
     assert response.status_code == 200
     response_json = response.json()
     assert response_json["context"] == test_user.user_id
-    assert response_json["config"]["slack"]["webhookUrl"] == "https://hooks.slack.com/user-webhook"
+    assert response_json["config"]["slack"]["webhookUrl"] == "****hook"
     
     # Test updating user system config (partial update)
     updated_config = {
@@ -403,7 +403,7 @@ def test_system_config_positive(test_super_admin: User, test_user: User):
     assert response_json["config"]["slack"]["enabled"] == False
     assert response_json["config"]["email"]["enabled"] == True
     # Webhook URL should be preserved from previous config
-    assert response_json["config"]["slack"]["webhookUrl"] == "https://hooks.slack.com/user-webhook"
+    assert response_json["config"]["slack"]["webhookUrl"] == "****hook"
     assert response_json["config"]["inApp"]["platformAppIds"] == ["app1", "app2"]
     
     # Test creating global system config (super admin only)
@@ -425,15 +425,27 @@ def test_system_config_positive(test_super_admin: User, test_user: User):
     assert response.status_code == 201
     response_json = response.json()
     assert response_json["context"] == "*"
-    assert response_json["config"]["email"]["fromAddress"] == "notifications@company.com"
-    assert response_json["config"]["email"]["replyToAddress"] == "noreply@company.com"
+    # Addresses are masked in responses
+    assert response_json["config"]["email"]["fromAddress"] == "****.com"
+    assert response_json["config"]["email"]["replyToAddress"] == "****.com"
     
     # Test getting global system config
     response = test_super_admin.get_system_config("*")
     assert response.status_code == 200
     response_json = response.json()
     assert response_json["context"] == "*"
+    assert response_json["config"]["email"]["fromAddress"] == "****.com"
+    
+    # Super admins can reveal the full values
+    response = test_super_admin.get_system_config("*", reveal=True)
+    assert response.status_code == 200
+    response_json = response.json()
     assert response_json["config"]["email"]["fromAddress"] == "notifications@company.com"
+    assert response_json["config"]["email"]["replyToAddress"] == "noreply@company.com"
+    
+    # Normal users cannot reveal secrets, even in their own config
+    response = test_user.get_system_config(test_user.user_id, reveal=True)
+    assert response.status_code == 403
     
     # Test listing all system configs (super admin only)
     response = test_super_admin.get_system_config_list()
@@ -484,7 +496,7 @@ def test_system_config_permission_validation(test_super_admin: User, test_user:
     # Test super admin trying to modify forbidden fields in global config
     invalid_global_config = {
         "slack": {
-            "webhookUrl": "https://hooks.slack.com/global-webhook",
+            "webhookUrl": "https://hooks.slack.com/services/T000/B000/global-webhook",
             "enabled": True
         }
     }
@@ -522,7 +534,7 @@ def test_system_config_user_permission_merge(test_super_admin: User, test_user:
     # Create user config
     user_config = {
         "slack": {
-            "webhookUrl": "https://hooks.slack.com/user-webhook",
+            "webhookUrl": "https://hooks.slack.com/services/T000/B000/user-webhook",
             "enabled": True
         },
         "inApp": {
@@ -548,7 +560,7 @@ def test_system_config_user_permission_merge(test_super_admin: User, test_user:
     # User's email enable/disable should be updated
     assert response_json["config"]["email"]["enabled"] == False
     # But webhook URL and platform app IDs should be preserved from user's original config
-    assert response_json["config"]["slack"]["webhookUrl"] == "https://hooks.slack.com/user-webhook"
+    assert response_json["config"]["slack"]["webhookUrl"] == "****hook"
     assert response_json["config"]["inApp"]["platformAppIds"] == ["user-app1"]
     
     # Clean up
@@ -560,6 +572,10 @@ def test_system_config_validation_errors(test_user: User):
     response = test_user.create_system_config("", None, "Empty config")
     assert response.status_code == 400  # Should fail with empty config
     
+    # Test creating config with a webhook URL that is not a Slack incoming webhook
+    response = test_user.create_system_config("", {"slack": {"webhookUrl": "http://example.com/hook", "enabled": True}}, "Invalid webhook")
+    assert response.status_code == 400
+    
     # Test updating non-existent config
     config = {
         "slack": {
@@ -630,12 +646,16 @@ def test_system_config_super_admin_global_replacement(test_super_admin: User):
     response_json = response.json()
     
     # Config should be completely replaced
-    assert response_json["config"]["email"]["fromAddress"] == "new@company.com"
-    assert response_json["config"]["email"]["replyToAddress"] == "noreply@company.com"
     assert response_json["config"]["inApp"]["enabled"] == True
     # Slack settings should be from new config (not preserved from old)
     assert "enabled" not in response_json["config"]["slack"] or response_json["config"]["slack"]["enabled"] is None
     
+    response = test_super_admin.get_system_config("*", reveal=True)
+    assert response.status_code == 200
+    response_json = response.json()
+    assert response_json["config"]["email"]["fromAddress"] == "new@company.com"
+    assert response_json["config"]["email"]["replyToAddress"] == "noreply@company.com"
+    
     # Clean up
     test_super_admin.delete_system_config("*")
 
@@ -737,12 +757,41 @@ def test_notification_queue_publishing(test_super_admin: User, test_user: User):
     report_validation = get_notification_validation_data(report_id, test_super_admin.user_id, "report", "email")
     assert report_validation["content"]["S"] == "{\"body\":\"There is a report in Weekly Performance Report for 2024-01-01 to 2024-01-07 with data System performance metrics for the past week\",\"subject\":\"There is a report in Weekly Performance Report for 2024-01-01 to 2024-01-07\"}"
     assert "error" not in report_validation
+    assert "providerMessageId" in report_validation
     
     # Specific user template should be sent to the user
     notification_validation = get_notification_validation_data(notification_id, test_user.user_id, "notification", "in_app")
     assert notification_validation["content"]["S"] == "User Notification: System Maintenance is Scheduled maintenance will begin at 2 AM UTC with https://example.com/acknowledge"
     assert "error" not in notification_validation
     
+    # In-app notifications are kept in the recipient's inbox
+    response = test_user.get_inbox_item(notification_id)
+    assert response.status_code == 200
+    inbox_item = response.json()
+    assert inbox_item["content"] == "User Notification: System Maintenance is Scheduled maintenance will begin at 2 AM UTC with https://example.com/acknowledge"
+    assert inbox_item["read"] == False
+    
+    response = test_user.get_inbox(unread=True)
+    assert response.status_code == 200
+    assert notification_id in [item["notificationId"] for item in response.json()["items"]]
+    
+    response = test_user.mark_inbox_item_read(notification_id)
+    assert response.status_code == 200
+    assert response.json()["read"] == True
+    
+    response = test_user.get_inbox(unread=True)
+    assert response.status_code == 200
+    assert notification_id not in [item["notificationId"] for item in response.json()["items"]]
+    
+    # Other users cannot see the notification
+    response = test_super_admin.get_inbox_item(notification_id)
+    assert response.status_code == 404
+    
+    response = test_user.delete_inbox_item(notification_id)
+    assert response.status_code == 200
+    response = test_user.get_inbox_item(notification_id)
+    assert response.status_code == 404
+    
     # Clean up
     test_super_admin.delete_template("*", "alert", "email")
     test_super_admin.delete_template("*", "alert", "slack")
@@ -758,6 +807,40 @@ def test_notification_queue_publishing(test_super_admin: User, test_user: User):
     test_user.delete_template(test_user.user_id, "notification", "in_app")
     test_user.delete_user_preferences(test_user.user_id)
 
+def test_notification_acknowledgment(test_super_admin: User, test_user: User):
+    notification_id = str(uuid.uuid4())
+
+    # History is recorded even when the recipient has no deliverable channels
+    response = test_super_admin.send_alert_notification(
+        id=notification_id,
+        recipients=[test_super_admin.user_id],
+        server_name="web-server-02",
+        environment="staging",
+    )
+    assert "MessageId" in response
+
+    time.sleep(5)
+
+    # Non-recipients cannot acknowledge
+    response = test_user.acknowledge_notification(notification_id)
+    assert response.status_code == 403
+
+    response = test_super_admin.acknowledge_notification(notification_id, note="Looking into it")
+    assert response.status_code == 201
+    response_json = response.json()
+    assert response_json["notificationId"] == notification_id
+    assert response_json["userId"] == test_super_admin.user_id
+    assert response_json["type"] == "alert"
+    assert "acknowledgedAt" in response_json
+
+    # Second acknowledgment is rejected
+    response = test_super_admin.acknowledge_notification(notification_id)
+    assert response.status_code == 409
+
+    # Unknown notification
+    response = test_super_admin.acknowledge_notification(str(uuid.uuid4()))
+    assert response.status_code == 404
+
 def test_scheduled_notifications(test_user: User, test_super_admin: User):
     """Test scheduled notification CRUD operations and delivery"""
     
@@ -816,6 +899,34 @@ def test_scheduled_notifications(test_user: User, test_super_admin: User):
     assert response.status_code == 200
     response_json = response.json()
     assert response_json["message"] == "Scheduled notification deleted successfully"
+
+def test_scheduled_notifications_for_others_by_normal_user(test_user: User, test_super_admin: User):
+    """Only super admins schedule notifications for other recipients, teams and segments"""
+    variables = {"message": "Weekly report", "serverName": "web-server-01", "environment": "production", "status": "ok"}
+    response = test_user.get_scheduled_notifications_list()
+    assert response.status_code == 200
+    schedules_before = response.json()["count"]
+
+    audiences = [
+        {"recipients": [test_super_admin.user_id]},
+        {"recipients": [test_user.user_id]},
+        {"recipients": [f"team:{uuid.uuid4()}"]},
+        {"segment": str(uuid.uuid4())},
+    ]
+    for audience in audiences:
+        response = test_user.create_scheduled_notification(
+            notification_type="alert",
+            variables=variables,
+            cron_expression="0 9 ? * MON *",
+            **audience
+        )
+        assert response.status_code == 403, audience
+        assert response.json()["message"] == "Only super admins can schedule notifications for other recipients"
+
+    # Nothing was scheduled
+    response = test_user.get_scheduled_notifications_list()
+    assert response.status_code == 200
+    assert response.json()["count"] == schedules_before
     
 def test_scheduled_notifications_delivery_verification(test_user: User, test_super_admin: User):
     """Test scheduled notification delivery with verification - creates a schedule for next minute"""
@@ -4,6 +4,7 @@ import jwt
 import requests
 import logging
 import json
+import random
 from urllib.parse import quote
 
 logger = logging.getLogger(__name__)
@@ -72,6 +73,8 @@ class User:
                     "email": {"S": self.email},
                     "role": {"S": self.role},
                     "isActive": {"BOOL": True},
+                    # Any list shard, so the user is listed right away
+                    "listKey": {"S": f"all#{random.randrange(8)}"},
                     "createdAt": {"S": datetime.now(timezone.utc).isoformat()},
                     "updatedAt": {"S": datetime.now(timezone.utc).isoformat()},
                 }
@@ -131,6 +134,26 @@ class User:
     def get_user_by_id(self, user_id):
         return self.make_api_request("GET", f"/users/{user_id}")
     
+    def update_user_attributes(self, user_id, attributes):
+        """Replace a user's attributes (own user or super admin)"""
+        return self.make_api_request("PUT", f"/users/{user_id}", body={"attributes": attributes})
+
+    def update_user_phone_number(self, user_id, phone_number):
+        """Set a user's SMS phone number, an empty string removes it (own user or super admin)"""
+        return self.make_api_request("PUT", f"/users/{user_id}", body={"phoneNumber": phone_number})
+
+    def get_devices(self, user_id):
+        """List a user's push devices (own user or super admin)"""
+        return self.make_api_request("GET", f"/users/{user_id}/devices")
+
+    def register_device(self, user_id, token, platform):
+        """Register a device token for push notifications (own user or super admin)"""
+        return self.make_api_request("POST", f"/users/{user_id}/devices", body={"token": token, "platform": platform})
+
+    def unregister_device(self, user_id, device_id):
+        """Unregister a push device (own user or super admin)"""
+        return self.make_api_request("DELETE", f"/users/{user_id}/devices/{device_id}")
+    
     def create_template(self, context, type, channel, content):
         return self.make_api_request("POST", "/templates", body={
             "context": context,
@@ -139,6 +162,59 @@ class User:
             "content": content
         })
     
+    def install_template_seed_pack(self):
+        """Install the global template seed pack (super admin only)"""
+        return self.make_api_request("POST", "/templates/seed")
+    
+    def get_consistency_report(self):
+        """Get the cross-resource consistency report (super admin only)"""
+        return self.make_api_request("GET", "/admin/consistency")
+    
+    def replay_notification(self, request_id, failed_only=False):
+        """Re-enqueue a processed notification (super admin only)"""
+        return self.make_api_request("POST", f"/admin/notifications/{request_id}/replay", body={"failedOnly": failed_only})
+    
+    def get_notification_artifacts(self, request_id):
+        """Get the artifact bundle of a processed notification (super admin only)"""
+        return self.make_api_request("GET", f"/admin/notifications/{request_id}/artifacts")
+
+    def send_test_notification(self, user_id, notification_type, variables=None, channels=None):
+        """Send a notification type to a user with sample variables, marked as test (super admin only)"""
+        body = {"type": notification_type}
+        if variables is not None:
+            body["variables"] = variables
+        if channels is not None:
+            body["channels"] = channels
+        return self.make_api_request("POST", f"/admin/users/{user_id}/test-notification", body=body)
+    
+    def rename_template_variable(self, type, from_name, to_name, dry_run=False):
+        """Rename a variable across all templates of a type (super admin only)"""
+        return self.make_api_request("POST", "/admin/templates/rename-variable", body={
+            "type": type,
+            "from": from_name,
+            "to": to_name,
+            "dryRun": dry_run
+        })
+    
+    def get_quarantined_messages(self):
+        """List messages quarantined by the processor (super admin only)"""
+        return self.make_api_request("GET", "/admin/quarantine")
+    
+    def reprocess_quarantined_message(self, message_id):
+        """Requeue a quarantined message (super admin only)"""
+        return self.make_api_request("POST", f"/admin/quarantine/{message_id}/reprocess")
+    
+    def get_consent_report(self, category=None):
+        """Report the notification consent recorded per user (super admin only)"""
+        path = "/admin/consent-report"
+        if category:
+            path += f"?category={category}"
+        return self.make_api_request("GET", path)
+    
+    def get_email_domain_status(self):
+        """Check the SES verification, DKIM and MAIL FROM setup of the From domains (super admin only)"""
+        return self.make_api_request("GET", "/admin/email/domain-status")
+    
     def get_templates_list(self, context):
         return self.make_api_request("GET", f"/templates?context={context}")
     
@@ -169,6 +245,10 @@ class User:
         """Get user preferences by context"""
         return self.make_api_request("GET", f"/preferences?context={context}")
     
+    def get_effective_preferences(self, context):
+        """Get the preferences applied to a user, with today's daily cap usage"""
+        return self.make_api_request("GET", f"/preferences/effective?context={context}")
+    
     def get_user_preferences_list(self, limit=None, next_token=None):
         """List all user preferences (super admin only)"""
         query_params = []
@@ -184,8 +264,8 @@ class User:
         
         return self.make_api_request("GET", path)
     
-    def update_user_preferences(self, context, preferences=None, timezone=None, language=None):
-        """Update user preferences"""
+    def update_user_preferences(self, context, preferences=None, timezone=None, language=None, consent=None):
+        """Update user preferences. consent maps categories to granted"""
         body = {"context": context}
         if preferences is not None:
             body["preferences"] = preferences
@@ -193,12 +273,30 @@ class User:
             body["timezone"] = timezone
         if language is not None:
             body["language"] = language
+        if consent is not None:
+            body["consent"] = consent
         return self.make_api_request("PUT", "/preferences", body=body)
     
     def delete_user_preferences(self, context):
         """Delete user preferences by context"""
         return self.make_api_request("DELETE", f"/preferences?context={context}")
     
+    def get_critical_contact(self):
+        """Get the caller's critical alert contact"""
+        return self.make_api_request("GET", "/preferences/critical-contact")
+    
+    def set_critical_contact(self, type, value):
+        """Set the caller's critical alert contact and send it a verification code"""
+        return self.make_api_request("PUT", "/preferences/critical-contact", body={"type": type, "value": value})
+    
+    def verify_critical_contact(self, code):
+        """Confirm the caller's critical alert contact with the code sent to it"""
+        return self.make_api_request("POST", "/preferences/critical-contact/verify", body={"code": code})
+    
+    def delete_critical_contact(self):
+        """Remove the caller's critical alert contact"""
+        return self.make_api_request("DELETE", "/preferences/critical-contact")
+    
     def create_system_config(self, context, config=None, description=None):
         """Create system config"""
         body = {"context": context}
@@ -208,9 +306,15 @@ class User:
             body["description"] = description
         return self.make_api_request("POST", "/config", body=body)
     
-    def get_system_config(self, context):
-        """Get system config by context"""
-        return self.make_api_request("GET", f"/config?context={context}")
+    def get_system_config(self, context, reveal=False):
+        """Get system config by context, secrets are masked unless a super admin asks to reveal them"""
+        suffix = "&reveal=true" if reveal else ""
+        return self.make_api_request("GET", f"/config?context={context}{suffix}")
+    
+    def test_slack_webhook(self, context=None):
+        """Post a test message to the Slack webhook in the config"""
+        body = {"context": context} if context else {}
+        return self.make_api_request("POST", "/config/slack/test", body=body)
     
     def get_system_config_list(self, limit=None, next_token=None):
         """List all system configs (super admin only)"""
@@ -240,6 +344,42 @@ class User:
         """Delete system config by context"""
         return self.make_api_request("DELETE", f"/config?context={context}")
     
+    def acknowledge_notification(self, notification_id, note=None):
+        """Acknowledge a processed notification"""
+        body = {}
+        if note is not None:
+            body["note"] = note
+        return self.make_api_request("POST", f"/notifications/{notification_id}/ack", body=body)
+
+    def get_inbox(self, unread=False, limit=None, next_token=None):
+        """List the caller's in-app inbox, newest first"""
+        query_params = []
+        if unread:
+            query_params.append("unread=true")
+        if limit:
+            query_params.append(f"limit={limit}")
+        if next_token:
+            query_params.append(f"nextToken={next_token}")
+        
+        query_string = "&".join(query_params)
+        path = "/inbox"
+        if query_string:
+            path += f"?{query_string}"
+        
+        return self.make_api_request("GET", path)
+    
+    def get_inbox_item(self, notification_id):
+        """Get an in-app notification from the caller's inbox"""
+        return self.make_api_request("GET", f"/inbox/{notification_id}")
+    
+    def mark_inbox_item_read(self, notification_id):
+        """Mark an in-app notification as read"""
+        return self.make_api_request("POST", f"/inbox/{notification_id}/read")
+    
+    def delete_inbox_item(self, notification_id):
+        """Delete an in-app notification from the caller's inbox"""
+        return self.make_api_request("DELETE", f"/inbox/{notification_id}")
+
     def send_notification_to_queue(self, id, notification_type, recipients, variables=None):
         """Send a notification request to SQS queue"""
         if variables is None:
@@ -292,8 +432,8 @@ class User:
         return self.send_notification_to_queue(id, "notification", recipients, variables)
     
     # Scheduled Notification Methods
-    def create_scheduled_notification(self, notification_type, variables, cron_expression, timezone="UTC"):
-        """Create a scheduled notification"""
+    def create_scheduled_notification(self, notification_type, variables, cron_expression, timezone="UTC", recipients=None, segment=None):
+        """Create a scheduled notification, for the caller unless recipients or a segment are given"""
         body = {
             "type": notification_type,
             "variables": variables,
@@ -303,6 +443,10 @@ class User:
                 "timezone": timezone
             }
         }
+        if recipients is not None:
+            body["recipients"] = recipients
+        if segment is not None:
+            body["segment"] = segment
         return self.make_api_request("POST", "/scheduled-notifications", body=body)
     
     def get_scheduled_notifications_list(self, limit=None, next_token=None):